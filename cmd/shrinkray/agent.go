@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	shrinkray "github.com/gwlsn/shrinkray"
+	"github.com/gwlsn/shrinkray/internal/ffmpeg"
+	"github.com/gwlsn/shrinkray/internal/logger"
+	"github.com/gwlsn/shrinkray/internal/remote"
+)
+
+var agentLog = logger.For("agent")
+
+// agentCommand implements "shrinkray agent": pull jobs from a Shrinkray
+// server, transcode them with this machine's encoders and upload results.
+func agentCommand(args []string) int {
+	fs := flag.NewFlagSet("agent", flag.ExitOnError)
+	server := fs.String("server", os.Getenv("SHRINKRAY_SERVER"), "Shrinkray server URL, e.g. http://nas:8080")
+	token := fs.String("token", os.Getenv("SHRINKRAY_REMOTE_TOKEN"), "Shared remote token (remote.token on the server)")
+	name := fs.String("name", "", "Agent name shown on the server (default: hostname)")
+	workDir := fs.String("work-dir", filepath.Join(os.TempDir(), "shrinkray-agent"), "Directory for staged sources and outputs")
+	ffmpegPath := fs.String("ffmpeg", "ffmpeg", "Path to ffmpeg")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: shrinkray agent --server http://nas:8080 --token SECRET")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *server == "" || *token == "" {
+		fs.Usage()
+		return 2
+	}
+
+	ffmpeg.DetectEncoders(*ffmpegPath)
+	ffmpeg.InitPresets()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	agentLog.Info("Pulling jobs", "server", *server)
+	err := remote.RunAgent(ctx, remote.AgentConfig{
+		Server:     *server,
+		Token:      *token,
+		Name:       *name,
+		WorkDir:    *workDir,
+		FFmpegPath: *ffmpegPath,
+		Version:    shrinkray.Version,
+	})
+	if err != nil && err != context.Canceled {
+		agentLog.Error("Agent stopped", "error", err)
+		return 1
+	}
+	return 0
+}
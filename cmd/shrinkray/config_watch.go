@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"log"
 	"os"
 	"path/filepath"
 	"time"
@@ -10,13 +9,36 @@ import (
 	"github.com/fsnotify/fsnotify"
 	"github.com/gwlsn/shrinkray/internal/api"
 	"github.com/gwlsn/shrinkray/internal/config"
+	"github.com/gwlsn/shrinkray/internal/logger"
 )
 
+var configLog = logger.For("config")
+
 type configReloadOptions struct {
 	mediaOverride string
 	queueFile     string
 }
 
+// loadReloadedConfig re-reads the config file, keeping the command-line and
+// environment overrides the server was started with
+func loadReloadedConfig(cfgPath string, cfg *config.Config, opts configReloadOptions) (*config.Config, error) {
+	newCfg, err := config.Load(cfgPath)
+	if err != nil {
+		return nil, err
+	}
+	if opts.mediaOverride != "" {
+		newCfg.MediaPath = opts.mediaOverride
+	}
+	if opts.queueFile != "" {
+		newCfg.QueueFile = opts.queueFile
+	}
+
+	if newCfg.MediaPath == "" {
+		newCfg.MediaPath = cfg.MediaPath
+	}
+	return newCfg, nil
+}
+
 func startConfigWatcher(ctx context.Context, cfgPath string, handler *api.Handler, cfg *config.Config, opts configReloadOptions) {
 	if cfgPath == "" {
 		return
@@ -24,13 +46,13 @@ func startConfigWatcher(ctx context.Context, cfgPath string, handler *api.Handle
 
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
-		log.Printf("Warning: Failed to start config watcher: %v", err)
+		configLog.Warn("Failed to start config watcher", "error", err)
 		return
 	}
 
 	watchDir := filepath.Dir(cfgPath)
 	if err := watcher.Add(watchDir); err != nil {
-		log.Printf("Warning: Failed to watch config directory %s: %v", watchDir, err)
+		configLog.Warn("Failed to watch config directory", "path", watchDir, "error", err)
 		_ = watcher.Close()
 		return
 	}
@@ -50,28 +72,18 @@ func startConfigWatcher(ctx context.Context, cfgPath string, handler *api.Handle
 				timer.Stop()
 			}
 			timer = time.AfterFunc(250*time.Millisecond, func() {
-				newCfg, err := config.Load(cfgPath)
+				newCfg, err := loadReloadedConfig(cfgPath, cfg, opts)
 				if err != nil {
-					log.Printf("Warning: Failed to reload config from %s: %v", cfgPath, err)
+					configLog.Warn("Failed to reload config", "path", cfgPath, "error", err)
 					return
 				}
-				if opts.mediaOverride != "" {
-					newCfg.MediaPath = opts.mediaOverride
-				}
-				if opts.queueFile != "" {
-					newCfg.QueueFile = opts.queueFile
-				}
-
-				if newCfg.MediaPath == "" {
-					newCfg.MediaPath = cfg.MediaPath
-				}
 				if _, err := os.Stat(newCfg.MediaPath); err != nil {
-					log.Printf("Warning: Ignoring config reload, media path unavailable: %s (%v)", newCfg.MediaPath, err)
+					configLog.Warn("Ignoring config reload, media path unavailable", "path", newCfg.MediaPath, "error", err)
 					return
 				}
 
 				handler.ApplyConfig(newCfg)
-				log.Printf("Config reloaded from %s", cfgPath)
+				configLog.Info("Config reloaded", "path", cfgPath)
 			})
 		}
 
@@ -106,7 +118,7 @@ func startConfigWatcher(ctx context.Context, cfgPath string, handler *api.Handle
 				if !ok {
 					return
 				}
-				log.Printf("Warning: Config watcher error: %v", err)
+				configLog.Warn("Config watcher error", "error", err)
 			}
 		}
 	}()
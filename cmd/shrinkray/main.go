@@ -9,21 +9,45 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"syscall"
+	"time"
 
 	shrinkray "github.com/gwlsn/shrinkray"
 	"github.com/gwlsn/shrinkray/internal/api"
 	"github.com/gwlsn/shrinkray/internal/auth"
+	"github.com/gwlsn/shrinkray/internal/auth/header"
 	"github.com/gwlsn/shrinkray/internal/auth/oidc"
 	"github.com/gwlsn/shrinkray/internal/auth/password"
+	"github.com/gwlsn/shrinkray/internal/autoscale"
 	"github.com/gwlsn/shrinkray/internal/browse"
 	"github.com/gwlsn/shrinkray/internal/config"
+	"github.com/gwlsn/shrinkray/internal/energy"
 	"github.com/gwlsn/shrinkray/internal/ffmpeg"
+	"github.com/gwlsn/shrinkray/internal/integrations/arr"
+	"github.com/gwlsn/shrinkray/internal/integrations/mediaserver"
 	"github.com/gwlsn/shrinkray/internal/jobs"
 	"github.com/gwlsn/shrinkray/internal/logger"
+	"github.com/gwlsn/shrinkray/internal/mountwatch"
+	"github.com/gwlsn/shrinkray/internal/remote"
+	"github.com/gwlsn/shrinkray/internal/retention"
+	"github.com/gwlsn/shrinkray/internal/scan"
+	"github.com/gwlsn/shrinkray/internal/selfcheck"
+	"github.com/gwlsn/shrinkray/internal/trash"
 )
 
+var mainLog = logger.For("main")
+
 func main() {
+	// Headless batch mode: shrinkray run --path ... --preset ...
+	if len(os.Args) > 1 && os.Args[1] == "run" {
+		os.Exit(runCommand(os.Args[2:]))
+	}
+	// Remote worker: shrinkray agent --server ... --token ...
+	if len(os.Args) > 1 && os.Args[1] == "agent" {
+		os.Exit(agentCommand(os.Args[2:]))
+	}
+
 	// Parse command line flags
 	configPath := flag.String("config", "", "Path to config file (default: ./config/shrinkray.yaml)")
 	port := flag.Int("port", 8080, "Port to listen on")
@@ -31,25 +55,15 @@ func main() {
 	debugUI := flag.Bool("debug", false, "Use debug UI instead of production UI")
 	flag.Parse()
 
-	// Determine config path
-	cfgPath := *configPath
-	if cfgPath == "" {
-		// Check environment variable
-		if envPath := os.Getenv("CONFIG_PATH"); envPath != "" {
-			cfgPath = envPath
-		} else {
-			// Default to ./config/shrinkray.yaml
-			cfgPath = "config/shrinkray.yaml"
-		}
-	}
-
+	cfgPath := resolveConfigPath(*configPath)
 	cfg, err := config.Load(cfgPath)
 	if err != nil {
-		log.Printf("Warning: Could not load config from %s: %v", cfgPath, err)
+		mainLog.Warn("Could not load config, using defaults", "path", cfgPath, "error", err)
 		cfg = config.DefaultConfig()
 	}
 
-	logger.Init(cfg.LogLevel)
+	logger.Init(cfg.LogLevel, cfg.LogFormat, cfg.LogLevels)
+	logger.SetBufferSize(cfg.LogBufferLines)
 
 	// Override with environment variables
 	mediaOverride := ""
@@ -79,7 +93,7 @@ func main() {
 
 	// Ensure config directory exists
 	if err := os.MkdirAll(filepath.Dir(cfg.QueueFile), 0755); err != nil {
-		log.Printf("Warning: Could not create config directory: %v", err)
+		mainLog.Warn("Could not create config directory", "error", err)
 	}
 
 	fmt.Println("╔═══════════════════════════════════════════════════════════╗")
@@ -107,7 +121,12 @@ func main() {
 
 	// Detect available hardware encoders
 	ffmpeg.DetectEncoders(cfg.FFmpegPath)
+	ffmpeg.SetPresetEncoders(cfg.PresetEncoders)
+	ffmpeg.SetSVTAV1Options(svtAV1Options(cfg))
+	ffmpeg.SetAudioCodec(cfg.AudioCodec)
+	ffmpeg.SetReencodeAboveBPP(cfg.ReencodeAboveBPP)
 	ffmpeg.InitPresets()
+	setVideoExtensions(cfg)
 
 	// Display detected encoders
 	fmt.Println("  Encoders:")
@@ -124,20 +143,108 @@ func main() {
 	fmt.Println()
 
 	// Initialize components
+	ffmpeg.SetProbeConcurrency(cfg.ProbeConcurrency)
 	prober := ffmpeg.NewProber(cfg.FFprobePath)
 	browser := browse.NewBrowser(prober, cfg.MediaPath)
 	browser.SetHideProcessingTmp(cfg.HideProcessingTmp)
+	browser.EnableThumbnails(cfg.FFmpegPath, filepath.Join(filepath.Dir(cfg.QueueFile), "thumbs"), int64(cfg.ThumbnailCacheMB)<<20)
+	probeCacheFile := filepath.Join(filepath.Dir(cfg.QueueFile), "probe_cache.json")
+	if err := browser.LoadCache(probeCacheFile); err != nil {
+		mainLog.Warn("Could not load probe cache", "error", err)
+	}
 
 	queue, err := jobs.NewQueue(cfg.QueueFile)
 	if err != nil {
 		log.Fatalf("Failed to initialize job queue: %v", err)
 	}
+	queue.SetProgressRate(cfg.ProgressEventsPerSecond)
+
+	// Finish file swaps a crash interrupted and clear stale temp files
+	jobs.RecoverInterrupted(queue, browser.InvalidateCache)
 
 	workerPool := jobs.NewWorkerPool(queue, cfg, browser.InvalidateCache)
 
 	// Create API handler
 	handler := api.NewHandler(browser, queue, workerPool, cfg, cfgPath)
 
+	// Self-check the environment so misconfigured deployments show up in
+	// the log (and at /api/selfcheck) instead of as failed jobs later
+	selfCheck := selfcheck.Run(context.Background(), cfg)
+	selfCheck.Log()
+	handler.SetSelfCheck(selfCheck)
+
+	// Library scanner; reports are saved next to the queue file
+	scanner := scan.NewScanner(browser, filepath.Join(filepath.Dir(cfg.QueueFile), "scans"))
+	handler.SetScanner(scanner)
+
+	// Track .old originals kept by original_handling: keep so they can be
+	// cleaned up later; pick up ones from completed jobs already in the queue
+	originals, err := retention.NewStore(filepath.Join(filepath.Dir(cfg.QueueFile), "originals.json"))
+	if err != nil {
+		log.Fatalf("Failed to load kept originals: %v", err)
+	}
+	for _, job := range queue.GetAll() {
+		if job.Status == jobs.StatusComplete {
+			originals.Track(job.InputPath, job.OutputPath, job.CompletedAt)
+		}
+	}
+	handler.SetRetention(originals)
+
+	// Originals moved aside by trash_originals, restorable per job
+	trashStore, err := trash.NewStore(cfg.MediaPath)
+	if err != nil {
+		log.Fatalf("Failed to load trash: %v", err)
+	}
+	workerPool.SetTrash(trashStore)
+	handler.SetTrash(trashStore)
+
+	// Energy counters for energy.measure; without them, energy is modeled
+	// from energy.watts
+	energyTracker := energy.NewTracker()
+	workerPool.SetEnergyTracker(energyTracker)
+	if cfg.Energy.Enabled && cfg.Energy.Measure && len(energyTracker.Sources()) == 0 {
+		mainLog.Warn("No RAPL or nvidia-smi energy counters found; energy is modeled from energy.watts")
+	}
+
+	// Daily stats for /api/stats/history, backfilled from the queue on first run
+	history, err := jobs.NewHistory(filepath.Join(filepath.Dir(cfg.QueueFile), "stats_history.json"))
+	if err != nil {
+		log.Fatalf("Failed to load stats history: %v", err)
+	}
+	history.Backfill(queue.GetAll())
+	handler.SetHistory(history)
+
+	// Per-preset/per-encoder outcomes for /api/stats/presets
+	analytics, err := jobs.NewAnalytics(filepath.Join(filepath.Dir(cfg.QueueFile), "analytics.json"))
+	if err != nil {
+		log.Fatalf("Failed to load analytics: %v", err)
+	}
+	analytics.Backfill(queue.GetAll())
+	handler.SetAnalytics(analytics)
+
+	// Estimate vs actual output sizes, which calibrate future estimates
+	estimates, err := jobs.NewEstimateStats(filepath.Join(filepath.Dir(cfg.QueueFile), "estimates.json"))
+	if err != nil {
+		log.Fatalf("Failed to load estimate stats: %v", err)
+	}
+	estimates.Backfill(queue.GetAll())
+	handler.SetEstimateStats(estimates)
+
+	// Ask Sonarr/Radarr and Plex/Jellyfin to rescan after files are replaced
+	arrNotifier := arr.NewNotifier(arr.DefaultDelay, arr.ClientsFromConfig(cfg.Integrations)...)
+	mediaNotifier := mediaserver.NewNotifier(mediaserver.DefaultDelay, mediaserver.ClientsFromConfig(cfg.Integrations)...)
+	workerPool.SetOnComplete(func(inputPath, outputPath string) {
+		originals.Track(inputPath, outputPath, time.Now())
+		arrNotifier.OnComplete(inputPath, outputPath)
+		mediaNotifier.OnComplete(inputPath, outputPath)
+	})
+	handler.SetArrNotifier(arrNotifier)
+	handler.SetMediaServerNotifier(mediaNotifier)
+
+	// Remote agents pull jobs when remote.token is set
+	remoteCoordinator := remote.NewCoordinator(queue, workerPool, cfg)
+	handler.SetRemote(remoteCoordinator)
+
 	authRegistry := auth.NewRegistry()
 	authRegistry.Register("noop", auth.NewNoopProvider())
 
@@ -148,11 +255,56 @@ func main() {
 
 	var authMiddleware *auth.Middleware
 	if cfg.Auth.Enabled {
+		authPages, err := auth.NewPages(shrinkray.WebFS, auth.Branding{
+			Title:       cfg.Auth.Branding.Title,
+			LogoURL:     cfg.Auth.Branding.LogoURL,
+			AccentColor: cfg.Auth.Branding.AccentColor,
+			Theme:       cfg.Auth.Branding.Theme,
+			Locale:      cfg.Auth.Branding.Locale,
+		})
+		if err != nil {
+			log.Fatalf("Failed to load login page: %v", err)
+		}
+		authPages.SetBasePath(cfg.BasePath)
+
+		var sessionStore *auth.SessionStore
+		if cfg.Auth.SessionStore == "file" {
+			sessionStore, err = auth.NewSessionStore(filepath.Join(filepath.Dir(cfg.QueueFile), "sessions.json"))
+			if err != nil {
+				log.Fatalf("Failed to load sessions: %v", err)
+			}
+			handler.SetSessionStore(sessionStore)
+		}
+
 		if providerName == "password" {
 			passwordProvider, err := password.NewProvider(cfg.Auth.Password.Users, cfg.Auth.Password.HashAlgo, cfg.Auth.Secret)
 			if err != nil {
 				log.Fatalf("Failed to initialize password auth: %v", err)
 			}
+			passwordProvider.SetPages(authPages)
+			passwordProvider.SetBasePath(cfg.BasePath)
+			lockout := password.DefaultLockoutPolicy()
+			lockout.MaxAttempts = cfg.Auth.Password.MaxAttempts
+			lockout.Lockout = time.Duration(cfg.Auth.Password.LockoutSeconds) * time.Second
+			lockout.TrustForwardedFor = cfg.Auth.Password.TrustForwardedFor
+			for _, proxy := range cfg.Auth.Password.TrustedProxies {
+				prefix, err := auth.ParsePrefix(proxy)
+				if err != nil {
+					log.Fatalf("Invalid auth.password.trusted_proxies entry %q: expected a CIDR or IP address", proxy)
+				}
+				lockout.TrustedProxies = append(lockout.TrustedProxies, prefix)
+			}
+			passwordProvider.SetLockoutPolicy(lockout)
+			if captchaCfg := cfg.Auth.Password.Captcha; captchaCfg.Service != "" {
+				captcha, err := password.NewCaptcha(captchaCfg.Service, captchaCfg.SiteKey, captchaCfg.Secret)
+				if err != nil {
+					log.Fatalf("Failed to initialize login captcha: %v", err)
+				}
+				passwordProvider.SetCaptcha(captcha, captchaCfg.AfterFailures)
+			}
+			if sessionStore != nil {
+				passwordProvider.SetSessionStore(sessionStore)
+			}
 			authRegistry.Register("password", passwordProvider)
 		}
 		if providerName == "oidc" {
@@ -170,9 +322,28 @@ func main() {
 			if err != nil {
 				log.Fatalf("Failed to initialize oidc auth: %v", err)
 			}
+			oidcProvider.SetPages(authPages)
+			oidcProvider.SetBasePath(cfg.BasePath)
+			if sessionStore != nil {
+				oidcProvider.SetSessionStore(sessionStore)
+			}
 			authRegistry.Register("oidc", oidcProvider)
 		}
 
+		if providerName == "header" {
+			headerProvider, err := header.NewProvider(
+				cfg.Auth.Header.TrustedProxies,
+				cfg.Auth.Header.UserHeader,
+				cfg.Auth.Header.GroupsHeader,
+				cfg.Auth.Header.AllowedGroups,
+				cfg.Auth.Header.LogoutURL,
+			)
+			if err != nil {
+				log.Fatalf("Failed to initialize header auth: %v", err)
+			}
+			authRegistry.Register("header", headerProvider)
+		}
+
 		authProvider, ok := authRegistry.Provider(providerName)
 		if !ok {
 			log.Fatalf("Unknown auth provider: %s", providerName)
@@ -184,13 +355,71 @@ func main() {
 
 	router := api.NewRouter(handler, shrinkray.WebFS, *debugUI, authMiddleware)
 
+	// Refuse clients outside access.allowed_networks
+	allowlist, err := auth.NewAllowlist(cfg.Access.AllowedNetworks, cfg.Access.TrustedProxies, cfg.Access.MutatingOnly)
+	if err != nil {
+		log.Fatalf("Access: %v", err)
+	}
+
 	// Start config watcher
 	watchCtx, watchCancel := context.WithCancel(context.Background())
-	startConfigWatcher(watchCtx, cfgPath, handler, cfg, configReloadOptions{
+	reloadOpts := configReloadOptions{
 		mediaOverride: mediaOverride,
 		queueFile:     cfg.QueueFile,
+	}
+	startConfigWatcher(watchCtx, cfgPath, handler, cfg, reloadOpts)
+
+	// POST /api/config/validate and /api/config/reload read the file the same way
+	handler.SetConfigLoader(func() (*config.Config, error) {
+		return loadReloadedConfig(cfgPath, cfg, reloadOpts)
+	})
+
+	// Keep the search index fresh in the background
+	browser.StartIndexer(watchCtx, browse.DefaultIndexInterval)
+	go energyTracker.Run(watchCtx)
+
+	// Run scheduled library scans (scan_interval_hours, 0 = off)
+	scanner.StartScheduler(watchCtx, func() time.Duration {
+		return time.Duration(cfg.ScanIntervalHours) * time.Hour
+	}, func() *ffmpeg.Preset {
+		return ffmpeg.GetPreset("compress-hevc")
+	})
+
+	// Delete kept originals that are verified or past original_retention_days
+	originals.StartScheduler(watchCtx, func() time.Duration {
+		return time.Duration(cfg.OriginalRetentionDays) * 24 * time.Hour
+	})
+
+	// Purge trashed originals past trash_retention_days
+	trashStore.StartScheduler(watchCtx, func() time.Duration {
+		return time.Duration(cfg.TrashRetentionDays) * 24 * time.Hour
 	})
 
+	// Requeue jobs from remote agents that stop reporting
+	remoteCoordinator.StartReaper(watchCtx)
+
+	// Grow and shrink the worker pool with system load when autoscale is on
+	scaler := autoscale.New(workerPool, queue, func() config.AutoscaleConfig {
+		return cfg.Autoscale
+	})
+	scaler.Start(watchCtx)
+	handler.SetAutoscaler(scaler)
+
+	// Hold the queue while a media mount is unreachable
+	mountWatcher := mountwatch.New(queue, workerPool, func() config.MountWatchConfig {
+		return cfg.MountWatch
+	}, cfg.MountWatchPaths)
+	mountWatcher.Start(watchCtx)
+
+	// Record finished jobs in the daily stats history, analytics and
+	// estimate calibration
+	history.Watch(watchCtx, queue)
+	analytics.Watch(watchCtx, queue)
+	estimates.Watch(watchCtx, queue)
+
+	// Queue-level notifications: queue drained, batch finished, failure streaks
+	handler.WatchNotifications(watchCtx)
+
 	// Start worker pool
 	workerPool.Start()
 	defer workerPool.Stop()
@@ -200,6 +429,16 @@ func main() {
 		uiMode = "debug"
 	}
 	fmt.Printf("  UI mode:      %s\n", uiMode)
+	if cfg.BasePath != "" {
+		fmt.Printf("  Base path:    %s/\n", cfg.BasePath)
+	}
+	if allowlist != nil {
+		scope := "all requests"
+		if cfg.Access.MutatingOnly {
+			scope = "changes only"
+		}
+		fmt.Printf("  Access:       %s (%s)\n", strings.Join(cfg.Access.AllowedNetworks, ", "), scope)
+	}
 	fmt.Printf("  Starting server on port %d\n", *port)
 	fmt.Println()
 	fmt.Println("  Press Ctrl+C to stop")
@@ -208,29 +447,112 @@ func main() {
 	// Set up graceful shutdown
 	server := &http.Server{
 		Addr:    fmt.Sprintf(":%d", *port),
-		Handler: router,
+		Handler: api.WithBasePath(allowlist.Wrap(router), cfg.BasePath),
+	}
+	var redirectServer *http.Server
+	if cfg.TLS.Enabled() {
+		redirectServer, err = configureTLS(cfg, server)
+		if err != nil {
+			log.Fatalf("TLS: %v", err)
+		}
 	}
 
 	// Handle shutdown signals
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
+	shutdownDone := make(chan struct{})
 	go func() {
+		defer close(shutdownDone)
 		<-sigChan
 		fmt.Println("\n  Shutting down...")
 		watchCancel()
-		workerPool.Stop()
-		server.Close()
+		handler.BeginShutdown()
+		if err := queue.Flush(); err != nil {
+			mainLog.Warn("Could not save queue", "error", err)
+		}
+
+		// Let running jobs finish within the grace period; a second signal
+		// stops them right away. Unfinished jobs are requeued.
+		grace := time.Duration(cfg.ShutdownGraceSeconds) * time.Second
+		if stats := queue.Stats(); stats.Running > 0 && grace > 0 {
+			fmt.Printf("  Waiting up to %s for %d running job(s); press Ctrl+C again to stop now\n", grace, stats.Running)
+		}
+		drainCtx, drainCancel := context.WithTimeout(context.Background(), grace)
+		go func() {
+			select {
+			case <-sigChan:
+				drainCancel()
+			case <-drainCtx.Done():
+			}
+		}()
+		workerPool.Shutdown(drainCtx)
+		drainCancel()
+
+		if err := queue.Flush(); err != nil {
+			mainLog.Warn("Could not save queue", "error", err)
+		}
+		if err := browser.FlushCache(); err != nil {
+			mainLog.Warn("Could not save probe cache", "error", err)
+		}
+
+		handler.CloseStreams()
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer shutdownCancel()
+		if redirectServer != nil {
+			_ = redirectServer.Shutdown(shutdownCtx)
+		}
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			server.Close()
+		}
 	}()
 
 	// Start server
-	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+	if redirectServer != nil {
+		go func() {
+			if err := redirectServer.ListenAndServe(); err != http.ErrServerClosed {
+				mainLog.Warn("HTTP redirect server stopped", "error", err)
+			}
+		}()
+	}
+	if cfg.TLS.Enabled() {
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
 		log.Fatalf("Server error: %v", err)
 	}
+	<-shutdownDone
 
 	fmt.Println("  Goodbye!")
 }
 
+// resolveConfigPath returns the -config flag, then $CONFIG_PATH, then
+// ./config/shrinkray.yaml
+func resolveConfigPath(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	if envPath := os.Getenv("CONFIG_PATH"); envPath != "" {
+		return envPath
+	}
+	return "config/shrinkray.yaml"
+}
+
+// svtAV1Options returns the configured libsvtav1 settings
+func svtAV1Options(cfg *config.Config) ffmpeg.SVTAV1Options {
+	return ffmpeg.SVTAV1Options{Preset: cfg.SVTAV1Preset, FilmGrain: cfg.SVTAV1FilmGrain, Tune: cfg.SVTAV1Tune}
+}
+
+// setVideoExtensions applies the configured video extensions, warning about
+// any that can't be used
+func setVideoExtensions(cfg *config.Config) {
+	if ignored := ffmpeg.SetVideoExtensions(cfg.ExtraVideoExtensions, cfg.ExcludedVideoExtensions); len(ignored) > 0 {
+		mainLog.Warn("Ignoring extra_video_extensions: still image or raw formats", "extensions", strings.Join(ignored, ", "))
+	}
+}
+
 func checkFFmpeg(cfg *config.Config) error {
 	fmt.Printf("  FFmpeg:       %s\n", cfg.FFmpegPath)
 	fmt.Printf("  FFprobe:      %s\n", cfg.FFprobePath)
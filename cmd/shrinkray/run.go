@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/browse"
+	"github.com/gwlsn/shrinkray/internal/config"
+	"github.com/gwlsn/shrinkray/internal/ffmpeg"
+	"github.com/gwlsn/shrinkray/internal/jobs"
+	"github.com/gwlsn/shrinkray/internal/logger"
+)
+
+// runProgressInterval is how often progress of running jobs is printed
+const runProgressInterval = 10 * time.Second
+
+// runCommand implements "shrinkray run": queue every video under --path,
+// transcode without the HTTP server, print progress and exit when the queue
+// drains. The exit code is 1 if any job failed.
+func runCommand(args []string) int {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	configPath := fs.String("config", "", "Path to config file (default: ./config/shrinkray.yaml)")
+	path := fs.String("path", "", "File or directory to transcode (required)")
+	presetID := fs.String("preset", "compress-hevc", "Preset ID")
+	workers := fs.Int("workers", 0, "Concurrent transcodes (default: workers from config)")
+	noRecurse := fs.Bool("no-recurse", false, "Don't descend into subdirectories")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: shrinkray run --path /media/TV [--preset compress-hevc] [--workers 2]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *path == "" {
+		fs.Usage()
+		return 2
+	}
+
+	cfgPath := resolveConfigPath(*configPath)
+	cfg, err := config.Load(cfgPath)
+	if err != nil {
+		mainLog.Warn("Could not load config, using defaults", "path", cfgPath, "error", err)
+		cfg = config.DefaultConfig()
+	}
+	logger.Init(cfg.LogLevel, cfg.LogFormat, cfg.LogLevels)
+
+	root, err := filepath.Abs(*path)
+	if err != nil {
+		mainLog.Error("Invalid path", "path", *path, "error", err)
+		return 1
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		mainLog.Error("Path does not exist", "path", root)
+		return 1
+	}
+	mediaRoot := root
+	if !info.IsDir() {
+		mediaRoot = filepath.Dir(root)
+	}
+
+	// Batch runs ignore the server's schedule and never touch its queue file
+	cfg.MediaPath = mediaRoot
+	cfg.ScheduleEnabled = false
+	if *workers > 0 {
+		cfg.Workers = *workers
+	}
+
+	ffmpeg.DetectEncoders(cfg.FFmpegPath)
+	ffmpeg.SetPresetEncoders(cfg.PresetEncoders)
+	ffmpeg.SetSVTAV1Options(svtAV1Options(cfg))
+	ffmpeg.SetAudioCodec(cfg.AudioCodec)
+	ffmpeg.SetReencodeAboveBPP(cfg.ReencodeAboveBPP)
+	ffmpeg.InitPresets()
+	setVideoExtensions(cfg)
+	preset := ffmpeg.GetPreset(*presetID)
+	if preset == nil {
+		mainLog.Error("Unknown preset", "preset", *presetID)
+		return 2
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	fmt.Printf("Scanning %s...\n", root)
+	ffmpeg.SetProbeConcurrency(cfg.ProbeConcurrency)
+	browser := browse.NewBrowser(ffmpeg.NewProber(cfg.FFprobePath), mediaRoot)
+	probes, err := browser.GetVideoFilesWithOptions(ctx, []string{root}, browse.GetVideoFilesOptions{Recursive: !*noRecurse})
+	if err != nil {
+		mainLog.Error("Failed to scan", "path", root, "error", err)
+		return 1
+	}
+	if len(probes) == 0 {
+		fmt.Println("No video files found")
+		return 0
+	}
+
+	queue, err := jobs.NewQueue("")
+	if err != nil {
+		mainLog.Error("Failed to create queue", "error", err)
+		return 1
+	}
+	if _, err := queue.AddMultiple(probes, preset.ID); err != nil {
+		mainLog.Error("Failed to queue files", "error", err)
+		return 1
+	}
+
+	stats := queue.Stats()
+	fmt.Printf("Queued %d files with %s (%d skipped), %d workers\n",
+		stats.Pending, preset.ID, stats.Skipped, cfg.Workers)
+
+	pool := jobs.NewWorkerPool(queue, cfg, nil)
+	pool.Start()
+
+	interrupted := !waitForDrain(ctx, queue)
+	pool.Stop()
+
+	stats = queue.Stats()
+	fmt.Println()
+	fmt.Printf("Done: %d complete, %d failed, %d skipped, %d no gain; saved %s\n",
+		stats.Complete, stats.Failed+stats.VerifyFailed, stats.Skipped, stats.NoGain, ffmpeg.FormatBytes(stats.TotalSaved))
+
+	if interrupted {
+		fmt.Println("Interrupted")
+		return 130
+	}
+	if stats.Failed > 0 || stats.VerifyFailed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// waitForDrain prints job transitions and periodic progress until no job is
+// workable or running. Returns false if ctx was cancelled first.
+func waitForDrain(ctx context.Context, queue *jobs.Queue) bool {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	seen := make(map[string]jobs.Status)
+	lastProgress := time.Now()
+	finished := 0
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+
+		active := false
+		showProgress := time.Since(lastProgress) >= runProgressInterval
+		// Software fallbacks add jobs, so the total can grow
+		all := queue.GetAll()
+		for _, job := range all {
+			if !job.IsTerminal() {
+				active = true
+			}
+
+			name := filepath.Base(job.InputPath)
+			if seen[job.ID] == job.Status {
+				if showProgress && job.Status == jobs.StatusRunning {
+					fmt.Printf("  %s: %.1f%% at %.2fx, ETA %s\n", name, job.Progress, job.Speed, job.ETA)
+				}
+				continue
+			}
+			seen[job.ID] = job.Status
+			if job.IsTerminal() {
+				finished++
+			}
+
+			switch job.Status {
+			case jobs.StatusRunning:
+				fmt.Printf("Started %s (%s)\n", name, job.Encoder)
+			case jobs.StatusComplete:
+				fmt.Printf("[%d/%d] Complete %s: %s -> %s\n", finished, len(all), name,
+					ffmpeg.FormatBytes(job.InputSize), ffmpeg.FormatBytes(job.OutputSize))
+			case jobs.StatusFailed:
+				fmt.Printf("[%d/%d] Failed %s: %s\n", finished, len(all), name, job.Error)
+			case jobs.StatusNoGain:
+				fmt.Printf("[%d/%d] No gain %s\n", finished, len(all), name)
+			case jobs.StatusVerifyFailed:
+				fmt.Printf("[%d/%d] Verification failed %s: %s (original kept)\n", finished, len(all), name, job.Error)
+			case jobs.StatusSkipped, jobs.StatusCancelled:
+				// Skips are summarized up front and at the end
+			case jobs.StatusWaitingDisk:
+				fmt.Printf("Waiting for disk space: %s\n", job.Error)
+			}
+		}
+		if showProgress {
+			lastProgress = time.Now()
+		}
+
+		if !active {
+			return true
+		}
+	}
+}
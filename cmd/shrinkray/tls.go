@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/config"
+	"github.com/gwlsn/shrinkray/internal/logger"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+var tlsLog = logger.For("tls")
+
+// configureTLS sets up HTTPS on server from cfg.TLS. It returns the plain
+// HTTP server to run alongside it (redirects and ACME challenges), or nil
+// if tls.redirect_addr is empty.
+func configureTLS(cfg *config.Config, server *http.Server) (*http.Server, error) {
+	var httpHandler http.Handler = http.HandlerFunc(redirectToHTTPS)
+
+	if len(cfg.TLS.ACMEDomains) > 0 {
+		cacheDir := cfg.TLS.ACMECacheDir
+		if cacheDir == "" {
+			cacheDir = filepath.Join(filepath.Dir(cfg.QueueFile), "acme")
+		}
+		if err := os.MkdirAll(cacheDir, 0700); err != nil {
+			return nil, fmt.Errorf("create ACME cache dir: %w", err)
+		}
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.TLS.ACMEDomains...),
+			Cache:      autocert.DirCache(cacheDir),
+			Email:      cfg.TLS.ACMEEmail,
+		}
+		server.TLSConfig = manager.TLSConfig()
+		httpHandler = manager.HTTPHandler(httpHandler)
+		fmt.Printf("  TLS:          Let's Encrypt for %v\n", cfg.TLS.ACMEDomains)
+	} else {
+		certs := &certReloader{certFile: cfg.TLS.CertFile, keyFile: cfg.TLS.KeyFile}
+		if _, err := certs.GetCertificate(nil); err != nil {
+			return nil, err
+		}
+		server.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: certs.GetCertificate,
+		}
+		fmt.Printf("  TLS:          %s\n", cfg.TLS.CertFile)
+	}
+
+	if cfg.TLS.RedirectAddr == "" {
+		return nil, nil
+	}
+	fmt.Printf("  HTTP:         %s (redirects to HTTPS)\n", cfg.TLS.RedirectAddr)
+	return &http.Server{
+		Addr:              cfg.TLS.RedirectAddr,
+		Handler:           httpHandler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}, nil
+}
+
+// redirectToHTTPS sends plain HTTP requests to the same URL over HTTPS.
+// The HTTPS port is not known from the Host header, so it is dropped; put
+// the server on 443 when redirecting.
+func redirectToHTTPS(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	target := "https://" + host + r.URL.RequestURI()
+	http.Redirect(w, r, target, http.StatusMovedPermanently)
+}
+
+// certReloader serves a certificate from disk, reloading it when the files
+// change so renewed certificates are picked up without a restart.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+	checked time.Time
+}
+
+// certCheckInterval limits how often the certificate files are stat'ed.
+const certCheckInterval = 30 * time.Second
+
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if c.cert != nil && now.Sub(c.checked) < certCheckInterval {
+		return c.cert, nil
+	}
+	c.checked = now
+
+	modTime := c.modTime
+	for _, path := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			if c.cert != nil {
+				tlsLog.Warn("Keeping current certificate", "error", err)
+				return c.cert, nil
+			}
+			return nil, fmt.Errorf("load TLS certificate: %w", err)
+		}
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+	if c.cert != nil && !modTime.After(c.modTime) {
+		return c.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		if c.cert != nil {
+			tlsLog.Warn("Keeping current certificate, failed to load new one", "error", err)
+			return c.cert, nil
+		}
+		return nil, fmt.Errorf("load TLS certificate: %w", err)
+	}
+	if c.cert != nil {
+		tlsLog.Info("Reloaded certificate", "path", c.certFile)
+	}
+	c.cert = &cert
+	c.modTime = modTime
+	return c.cert, nil
+}
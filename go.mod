@@ -14,5 +14,7 @@ require (
 
 require (
 	github.com/go-jose/go-jose/v4 v4.1.3 // indirect
+	golang.org/x/net v0.47.0 // indirect
 	golang.org/x/sys v0.39.0 // indirect
+	golang.org/x/text v0.32.0 // indirect
 )
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gwlsn/shrinkray/internal/jobs"
+)
+
+// SetAnalytics enables GET /api/stats/presets
+func (h *Handler) SetAnalytics(analytics *jobs.Analytics) {
+	h.analytics = analytics
+}
+
+// SetEstimateStats enables GET /api/stats/estimates
+func (h *Handler) SetEstimateStats(estimates *jobs.EstimateStats) {
+	h.estimates = estimates
+}
+
+// PresetStats handles GET /api/stats/presets
+// Reports average savings, failure rate and speed for each preset, overall
+// and per encoder.
+func (h *Handler) PresetStats(w http.ResponseWriter, r *http.Request) {
+	if h.analytics == nil {
+		writeError(w, http.StatusServiceUnavailable, "analytics are not available")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"presets": h.analytics.Presets(),
+	})
+}
+
+// EstimateStats handles GET /api/stats/estimates
+// Reports how far size estimates were off for each source codec, encoder
+// and preset, and the correction applied to new estimates.
+func (h *Handler) EstimateStats(w http.ResponseWriter, r *http.Request) {
+	if h.estimates == nil {
+		writeError(w, http.StatusServiceUnavailable, "estimate stats are not available")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"estimates":   h.estimates.Calibration(),
+		"min_samples": jobs.MinCalibrationSamples,
+	})
+}
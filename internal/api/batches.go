@@ -0,0 +1,118 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gwlsn/shrinkray/internal/jobs"
+)
+
+// ListBatches handles GET /api/batches
+func (h *Handler) ListBatches(w http.ResponseWriter, r *http.Request) {
+	viewer := h.jobViewer(r)
+	batches := h.queue.Batches()
+	visible := make([]jobs.BatchSummary, 0, len(batches))
+	for _, batch := range batches {
+		if viewer == "" || batch.CreatedBy == viewer {
+			visible = append(visible, batch)
+		}
+	}
+	writeJSON(w, http.StatusOK, visible)
+}
+
+// GetBatch handles GET /api/batches/:id
+func (h *Handler) GetBatch(w http.ResponseWriter, r *http.Request) {
+	summary, batchJobs := h.visibleBatch(r)
+	if summary == nil {
+		writeError(w, http.StatusNotFound, "batch not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"batch": summary,
+		"jobs":  batchJobs,
+	})
+}
+
+// CancelBatch handles POST /api/batches/:id/cancel. Jobs that haven't
+// finished are cancelled; finished jobs are kept.
+func (h *Handler) CancelBatch(w http.ResponseWriter, r *http.Request) {
+	summary, batchJobs := h.visibleBatch(r)
+	if summary == nil {
+		writeError(w, http.StatusNotFound, "batch not found")
+		return
+	}
+
+	cancelled := 0
+	for _, job := range batchJobs {
+		if job.IsTerminal() {
+			continue
+		}
+		if job.Status == jobs.StatusRunning {
+			h.workerPool.CancelJob(job.ID)
+		}
+		if err := h.queue.CancelJob(job.ID); err != nil {
+			// Finished while we were cancelling the others
+			continue
+		}
+		cancelled++
+	}
+
+	apiLog.Info("Cancelled batch", "batch", summary.ID, "jobs", cancelled)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":    "cancelled",
+		"cancelled": cancelled,
+	})
+}
+
+// PauseBatch handles POST /api/batches/:id/pause. Pending jobs are held and
+// running ones paused.
+func (h *Handler) PauseBatch(w http.ResponseWriter, r *http.Request) {
+	h.setBatchPaused(w, r, true)
+}
+
+// ResumeBatch handles POST /api/batches/:id/resume
+func (h *Handler) ResumeBatch(w http.ResponseWriter, r *http.Request) {
+	h.setBatchPaused(w, r, false)
+}
+
+func (h *Handler) setBatchPaused(w http.ResponseWriter, r *http.Request, paused bool) {
+	summary, batchJobs := h.visibleBatch(r)
+	if summary == nil {
+		writeError(w, http.StatusNotFound, "batch not found")
+		return
+	}
+
+	if err := h.queue.SetBatchPaused(summary.ID, paused); err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	for _, job := range batchJobs {
+		if job.Status != jobs.StatusRunning {
+			continue
+		}
+		// Jobs on remote agents can't be paused and simply run to the end
+		if paused {
+			h.workerPool.PauseJob(job.ID)
+		} else {
+			h.workerPool.ResumeJob(job.ID)
+		}
+	}
+
+	status := "resumed"
+	if paused {
+		status = "paused"
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": status})
+}
+
+// visibleBatch returns the batch named in the path, or nil if it doesn't
+// exist or, with job_visibility "own", belongs to another user
+func (h *Handler) visibleBatch(r *http.Request) (*jobs.BatchSummary, []*jobs.Job) {
+	summary, batchJobs := h.queue.GetBatch(r.PathValue("id"))
+	if summary == nil {
+		return nil, nil
+	}
+	if viewer := h.jobViewer(r); viewer != "" && summary.CreatedBy != viewer {
+		return nil, nil
+	}
+	return summary, batchJobs
+}
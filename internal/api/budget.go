@@ -0,0 +1,114 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/browse"
+	"github.com/gwlsn/shrinkray/internal/ffmpeg"
+	"github.com/gwlsn/shrinkray/internal/jobs"
+)
+
+// FitJobsRequest is the request body for queuing a batch under a size budget
+type FitJobsRequest struct {
+	Paths             []string `json:"paths"`
+	PresetID          string   `json:"preset_id"`
+	BudgetMB          int64    `json:"budget_mb"`                    // Total size the batch should fit in
+	IncludeSubfolders *bool    `json:"include_subfolders,omitempty"` // Default: true
+	DryRun            bool     `json:"dry_run,omitempty"`            // Only return the plan
+}
+
+// FitJobs handles POST /api/jobs/fit
+// Probes the files under paths, splits the budget across them by their
+// estimated output (see ffmpeg.PlanBudget) and queues each with its share
+// as target_size_mb, so the whole batch lands under the budget. Already
+// queued files are left out.
+func (h *Handler) FitJobs(w http.ResponseWriter, r *http.Request) {
+	if h.refuseWhileShuttingDown(w) {
+		return
+	}
+
+	var req FitJobsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if len(req.Paths) == 0 {
+		writeError(w, http.StatusBadRequest, "no paths provided")
+		return
+	}
+	if req.BudgetMB <= 0 {
+		writeError(w, http.StatusBadRequest, "budget_mb must be greater than 0")
+		return
+	}
+	preset := ffmpeg.GetPreset(req.PresetID)
+	if preset == nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown preset: %s", req.PresetID))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Minute)
+	defer cancel()
+
+	opts := browse.GetVideoFilesOptions{Recursive: true}
+	if req.IncludeSubfolders != nil {
+		opts.Recursive = *req.IncludeSubfolders
+	}
+	probes, err := h.browser.GetVideoFilesWithOptions(ctx, req.Paths, opts)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	queuedPaths := h.queue.EnqueuedPaths()
+	candidates := make([]*ffmpeg.ProbeResult, 0, len(probes))
+	for _, probe := range probes {
+		if _, ok := queuedPaths[probe.Path]; !ok {
+			candidates = append(candidates, probe)
+		}
+	}
+
+	plan, err := ffmpeg.PlanBudget(candidates, preset, req.BudgetMB<<20)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	queued := 0
+	if !req.DryRun && len(plan.Targets) > 0 {
+		targets := make(map[string]int, len(plan.Targets))
+		toQueue := make([]*ffmpeg.ProbeResult, 0, len(plan.Targets))
+		for _, target := range plan.Targets {
+			targets[target.Path] = int(target.TargetSize >> 20)
+		}
+		for _, probe := range candidates {
+			if _, ok := targets[probe.Path]; ok {
+				toQueue = append(toQueue, probe)
+			}
+		}
+
+		added, err := h.queue.AddMultipleWith(jobs.AddOptions{CreatedBy: requestUser(r)}, toQueue, req.PresetID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		for _, job := range added {
+			targetMB := targets[job.InputPath]
+			if _, err := h.queue.UpdateJob(job.ID, jobs.JobPatch{TargetSizeMB: &targetMB}); err != nil {
+				apiLog.Warn("Could not set target size on job", "job", job.ID, "error", err)
+				continue
+			}
+			queued++
+		}
+		apiLog.Info("Queued files to fit a budget", "count", queued, "budget_mb", req.BudgetMB, "planned_mb", plan.TotalSize>>20)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"dry_run": req.DryRun,
+		"scanned": len(probes),
+		"queued":  queued,
+		"plan":    plan,
+	})
+}
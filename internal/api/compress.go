@@ -0,0 +1,98 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// gzipMinSize is the smallest body worth compressing
+const gzipMinSize = 1024
+
+// conditional buffers a GET response so it can be tagged with an ETag,
+// answered with 304 Not Modified when the client already has it, and
+// gzipped for clients that accept it. Only for bounded JSON responses;
+// streams and file downloads must not be wrapped.
+func conditional(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		buf := &bufferedResponse{header: w.Header(), status: http.StatusOK}
+		next.ServeHTTP(buf, r)
+
+		body := buf.body.Bytes()
+		w.Header().Add("Vary", "Accept-Encoding")
+		if buf.status != http.StatusOK {
+			w.WriteHeader(buf.status)
+			w.Write(body)
+			return
+		}
+
+		// Weak tag: the gzipped and plain bodies are the same representation
+		sum := sha1.Sum(body)
+		etag := `W/"` + hex.EncodeToString(sum[:10]) + `"`
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", "no-cache")
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.Header().Del("Content-Type")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		if len(body) >= gzipMinSize && headerContains(r.Header, "Accept-Encoding", "gzip") {
+			var zipped bytes.Buffer
+			zw := gzip.NewWriter(&zipped)
+			zw.Write(body)
+			zw.Close()
+			body = zipped.Bytes()
+			w.Header().Set("Content-Encoding", "gzip")
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(http.StatusOK)
+		if r.Method != http.MethodHead {
+			w.Write(body)
+		}
+	})
+}
+
+// etagMatches reports whether an If-None-Match header matches etag,
+// using weak comparison (RFC 9110 13.1.2)
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	want := strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == want {
+			return true
+		}
+	}
+	return false
+}
+
+// bufferedResponse collects a handler's status and body
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	b.status = status
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	return b.body.Write(p)
+}
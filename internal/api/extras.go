@@ -0,0 +1,56 @@
+package api
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/browse"
+	"github.com/gwlsn/shrinkray/internal/jobs"
+)
+
+// extrasFilter leaves the likely samples and extras found in a CreateJobs
+// request's folders out of its batch. Files asked for by path are always
+// queued.
+type extrasFilter struct {
+	requested map[string]struct{}
+	excluded  []jobs.ExcludedFile
+}
+
+// newExtrasFilter returns nil when the request includes extras
+func newExtrasFilter(req CreateJobsRequest) *extrasFilter {
+	if req.IncludeExtras {
+		return nil
+	}
+	f := &extrasFilter{requested: make(map[string]struct{}, len(req.Paths))}
+	for _, path := range req.Paths {
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+		f.requested[path] = struct{}{}
+	}
+	return f
+}
+
+// keep reports whether to queue the file at path. duration is 0 when it
+// hasn't been probed.
+func (f *extrasFilter) keep(path string, duration time.Duration) bool {
+	if f == nil {
+		return true
+	}
+	if _, ok := f.requested[path]; ok {
+		return true
+	}
+	reason := browse.ExtraReason(path, duration)
+	if reason == "" {
+		return true
+	}
+	f.excluded = append(f.excluded, jobs.ExcludedFile{Path: path, Reason: reason})
+	return false
+}
+
+// record adds the files left out to the batch
+func (f *extrasFilter) record(queue *jobs.Queue, batchID string) {
+	if f != nil {
+		queue.ExcludeFromBatch(batchID, f.excluded)
+	}
+}
@@ -3,34 +3,74 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"maps"
 	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	shrinkray "github.com/gwlsn/shrinkray"
+	"github.com/gwlsn/shrinkray/internal/auth"
+	"github.com/gwlsn/shrinkray/internal/autoscale"
 	"github.com/gwlsn/shrinkray/internal/browse"
 	"github.com/gwlsn/shrinkray/internal/config"
 	"github.com/gwlsn/shrinkray/internal/ffmpeg"
+	"github.com/gwlsn/shrinkray/internal/integrations/arr"
+	"github.com/gwlsn/shrinkray/internal/integrations/mediaserver"
 	"github.com/gwlsn/shrinkray/internal/jobs"
+	"github.com/gwlsn/shrinkray/internal/logger"
 	"github.com/gwlsn/shrinkray/internal/ntfy"
 	"github.com/gwlsn/shrinkray/internal/pushover"
+	"github.com/gwlsn/shrinkray/internal/remote"
+	"github.com/gwlsn/shrinkray/internal/retention"
+	"github.com/gwlsn/shrinkray/internal/scan"
+	"github.com/gwlsn/shrinkray/internal/selfcheck"
+	"github.com/gwlsn/shrinkray/internal/trash"
 )
 
+var apiLog = logger.For("api")
+
 // Handler provides HTTP API handlers
 type Handler struct {
-	browser    *browse.Browser
-	queue      *jobs.Queue
-	workerPool *jobs.WorkerPool
-	cfg        *config.Config
-	cfgPath    string
-	pushover   *pushover.Client
-	ntfy       *ntfy.Client
-	notifyMu   sync.Mutex // Protects notification sending to prevent duplicates
+	browser      *browse.Browser
+	queue        *jobs.Queue
+	workerPool   *jobs.WorkerPool
+	cfg          *config.Config
+	cfgPath      string
+	loadConfig   func() (*config.Config, error) // Re-reads cfgPath for /api/config/reload
+	pushover     *pushover.Client
+	ntfy         *ntfy.Client
+	scanner      *scan.Scanner
+	arr          *arr.Notifier
+	mediaServers *mediaserver.Notifier
+	remote       *remote.Coordinator
+	autoscaler   *autoscale.Scaler
+	retention    *retention.Store
+	trash        *trash.Store
+	sessions     *auth.SessionStore
+	history      *jobs.History
+	analytics    *jobs.Analytics
+	estimates    *jobs.EstimateStats
+	previews     previewCache
+	selfCheck    atomic.Pointer[selfcheck.Report]
+	notifyMu     sync.Mutex // Protects notification sending to prevent duplicates
+
+	lastDiskNotify time.Time // Last low-disk-space notification (guarded by notifyMu)
+
+	presetTestBusy atomic.Bool // A POST /api/presets/{id}/test encode is running
+
+	shuttingDown  atomic.Bool   // Set on shutdown; new jobs are refused
+	streamsClosed chan struct{} // Closed to end SSE/WebSocket streams
+	closeOnce     sync.Once
 }
 
 // NewHandler creates a new API handler
@@ -44,16 +84,39 @@ func NewHandler(browser *browse.Browser, queue *jobs.Queue, workerPool *jobs.Wor
 		cfgPath:    cfgPath,
 		pushover:   pushover.NewClient(cfg.PushoverUserKey, cfg.PushoverAppToken),
 		ntfy:       ntfy.NewClient(cfg.NtfyServer, cfg.NtfyTopic, cfg.NtfyToken),
+
+		streamsClosed: make(chan struct{}),
 	}
 }
 
+// BeginShutdown makes the API refuse new jobs while running ones drain
+func (h *Handler) BeginShutdown() {
+	h.shuttingDown.Store(true)
+}
+
+// refuseWhileShuttingDown answers 503 once shutdown has begun, for the
+// endpoints that queue jobs. It returns true if it did.
+func (h *Handler) refuseWhileShuttingDown(w http.ResponseWriter) bool {
+	if !h.shuttingDown.Load() {
+		return false
+	}
+	writeError(w, http.StatusServiceUnavailable, "server is shutting down")
+	return true
+}
+
+// CloseStreams ends open SSE and WebSocket streams so the HTTP server can
+// shut down; clients see a "shutdown" event and reconnect later.
+func (h *Handler) CloseStreams() {
+	h.closeOnce.Do(func() { close(h.streamsClosed) })
+}
+
 // response helpers
 
 func writeJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	if err := json.NewEncoder(w).Encode(data); err != nil {
-		log.Printf("[api] Failed to encode JSON response: %v", err)
+		apiLog.Warn("Failed to encode JSON response", "error", err)
 	}
 }
 
@@ -61,23 +124,58 @@ func writeError(w http.ResponseWriter, status int, message string) {
 	writeJSON(w, status, map[string]string{"error": message})
 }
 
-// Browse handles GET /api/browse?path=...
+// Browse handles GET /api/browse?path=...&aggregate=true&preset=...
+// codecs, exclude_codecs (comma-separated), min_height and min_bitrate_mbps
+// hide video files that don't match; directories are always listed.
+// With preset each video gets an estimated output size, and the result an
+// estimate for the listed videos. With aggregate=true each directory gets a
+// recursive rollup (episode count, HEVC/AV1 count, estimated savings for
+// preset, default compress-hevc).
 func (h *Handler) Browse(w http.ResponseWriter, r *http.Request) {
 	path := r.URL.Query().Get("path")
 	if path == "" {
 		path = h.cfg.MediaPath
 	}
 
+	filter, err := parseFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	opts := browse.BrowseOptions{Filter: filter}
+	opts.Aggregate = r.URL.Query().Get("aggregate") == "true"
+	presetID := r.URL.Query().Get("preset")
+	if presetID == "" && opts.Aggregate {
+		presetID = "compress-hevc"
+	}
+	if presetID != "" {
+		preset := ffmpeg.GetPreset(presetID)
+		if preset == nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown preset: %s", presetID))
+			return
+		}
+		opts.Preset = preset
+	}
+
 	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
 	defer cancel()
 
-	result, err := h.browser.Browse(ctx, path)
+	result, err := h.browser.BrowseWithOptions(ctx, path, opts)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
 	processedPaths := h.queue.ProcessedPaths()
+	if h.cfg.FingerprintProcessed {
+		files := make(map[string]int64, len(result.Entries))
+		for _, entry := range result.Entries {
+			if !entry.IsDir {
+				files[entry.Path] = entry.Size
+			}
+		}
+		processedPaths = h.recognizeProcessed(processedPaths, files)
+	}
 	if len(processedPaths) > 0 {
 		for _, entry := range result.Entries {
 			if entry.IsDir {
@@ -106,6 +204,104 @@ func (h *Handler) Browse(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, result)
 }
 
+// parseFilter reads the browse filter query parameters
+func parseFilter(query url.Values) (browse.Filter, error) {
+	var filter browse.Filter
+	split := func(value string) []string {
+		var codecs []string
+		for _, codec := range strings.Split(value, ",") {
+			if codec = strings.TrimSpace(codec); codec != "" {
+				codecs = append(codecs, codec)
+			}
+		}
+		return codecs
+	}
+	filter.Codecs = split(query.Get("codecs"))
+	filter.ExcludeCodecs = split(query.Get("exclude_codecs"))
+
+	if v := query.Get("min_height"); v != "" {
+		height, err := strconv.Atoi(v)
+		if err != nil || height < 0 {
+			return filter, fmt.Errorf("invalid min_height: %s", v)
+		}
+		filter.MinHeight = height
+	}
+	if v := query.Get("min_bitrate_mbps"); v != "" {
+		mbps, err := strconv.ParseFloat(v, 64)
+		if err != nil || mbps < 0 {
+			return filter, fmt.Errorf("invalid min_bitrate_mbps: %s", v)
+		}
+		filter.MinBitrateMbps = mbps
+	}
+	return filter, nil
+}
+
+// Search handles GET /api/search?q=...&limit=...
+// Matches directory and video file names anywhere under the media root.
+func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		writeError(w, http.StatusBadRequest, "q is required")
+		return
+	}
+
+	limit := browse.DefaultSearchLimit
+	if param := r.URL.Query().Get("limit"); param != "" {
+		n, err := strconv.Atoi(param)
+		if err != nil || n < 1 || n > 500 {
+			writeError(w, http.StatusBadRequest, "limit must be between 1 and 500")
+			return
+		}
+		limit = n
+	}
+
+	result, err := h.browser.Search(r.Context(), query, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	pendingPaths := h.queue.PendingPaths()
+	processedPaths := h.queue.ProcessedPaths()
+	if h.cfg.FingerprintProcessed {
+		files := make(map[string]int64, len(result.Results))
+		for _, entry := range result.Results {
+			if !entry.IsDir {
+				files[entry.Path] = entry.Size
+			}
+		}
+		processedPaths = h.recognizeProcessed(processedPaths, files)
+	}
+	for _, entry := range result.Results {
+		if entry.IsDir {
+			entry.ProcessedCount = countProcessedInDir(entry.Path, processedPaths, h.cfg.HideProcessingTmp)
+			entry.Pending = hasPendingInDir(entry.Path, pendingPaths, h.cfg.HideProcessingTmp)
+			continue
+		}
+		_, entry.Processed = processedPaths[entry.Path]
+		_, entry.Pending = pendingPaths[entry.Path]
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// recognizeProcessed adds the files (path → size) whose content matches a
+// processed file's fingerprint to processedPaths, catching processed files
+// that were renamed or moved
+func (h *Handler) recognizeProcessed(processedPaths map[string]struct{}, files map[string]int64) map[string]struct{} {
+	recognized := h.queue.RecognizeProcessed(files)
+	if len(recognized) == 0 {
+		return processedPaths
+	}
+	if processedPaths == nil {
+		processedPaths = make(map[string]struct{}, len(recognized))
+	}
+	for _, path := range recognized {
+		processedPaths[path] = struct{}{}
+	}
+	return processedPaths
+}
+
 func countProcessedInDir(dirPath string, processedPaths map[string]struct{}, hideProcessingTmp bool) int {
 	if len(processedPaths) == 0 {
 		return 0
@@ -145,9 +341,16 @@ func hasPendingInDir(dirPath string, pendingPaths map[string]struct{}, hideProce
 	return false
 }
 
-// Presets handles GET /api/presets
+// Presets handles GET /api/presets. Each preset's auto_quality is whether
+// jobs queued with it get a quality search (auto_quality or its
+// preset_auto_quality entry).
 func (h *Handler) Presets(w http.ResponseWriter, r *http.Request) {
 	presets := ffmpeg.ListPresets()
+	for i, preset := range presets {
+		listed := *preset
+		listed.AutoQuality = jobs.AutoQuality(h.cfg, preset.ID)
+		presets[i] = &listed
+	}
 	writeJSON(w, http.StatusOK, presets)
 }
 
@@ -159,27 +362,61 @@ func (h *Handler) Encoders(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"encoders": encoders,
 		"best":     best,
+		"devices":  ffmpeg.ListDevices(),
+	})
+}
+
+// RedetectEncoders handles POST /api/encoders/redetect
+// Probes ffmpeg's encoders again (e.g. after adding a GPU or fixing drivers),
+// regenerates presets and tells connected UIs to reload them. Jobs already
+// running keep their encoder.
+func (h *Handler) RedetectEncoders(w http.ResponseWriter, r *http.Request) {
+	ffmpeg.RedetectEncoders(h.cfg.FFmpegPath)
+	ffmpeg.InitPresets()
+	h.queue.Notify("encoders_changed")
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"encoders": ffmpeg.ListAvailableEncoders(),
+		"best":     ffmpeg.GetBestEncoder(),
+		"devices":  ffmpeg.ListDevices(),
+		"presets":  ffmpeg.ListPresets(),
 	})
 }
 
 // CreateJobsRequest is the request body for creating jobs
 type CreateJobsRequest struct {
-	Paths             []string `json:"paths"`
-	PresetID          string   `json:"preset_id"`
-	IncludeSubfolders *bool    `json:"include_subfolders,omitempty"` // Default: true (for backwards compatibility)
-	MaxDepth          *int     `json:"max_depth,omitempty"`          // nil = unlimited, 0 = current dir only, 1 = one level, etc.
-	ExcludeProcessed  *bool    `json:"exclude_processed,omitempty"`
+	Paths             []string       `json:"paths"`
+	PresetID          string         `json:"preset_id"`
+	IncludeSubfolders *bool          `json:"include_subfolders,omitempty"` // Default: true (for backwards compatibility)
+	MaxDepth          *int           `json:"max_depth,omitempty"`          // nil = unlimited, 0 = current dir only, 1 = one level, etc.
+	ExcludeProcessed  *bool          `json:"exclude_processed,omitempty"`
+	Filter            *browse.Filter `json:"filter,omitempty"`            // Only queue files matching codec/height/bitrate criteria
+	PreferredEncoder  string         `json:"preferred_encoder,omitempty"` // Pin the jobs to an encoder (e.g. "qsv", "none")
+	TargetSizeMB      int            `json:"target_size_mb,omitempty"`    // Encode each file to about this size
+	Threads           int            `json:"threads,omitempty"`           // Cap software encodes at this many threads
+	AllowDuplicates   bool           `json:"allow_duplicates,omitempty"`  // Queue files that already have an unfinished job
+	IncludeExtras     bool           `json:"include_extras,omitempty"`    // Queue likely samples and extras found in folders too
 }
 
 // MarkProcessedRequest is the request body for marking processed paths.
 type MarkProcessedRequest struct {
-	Paths             []string `json:"paths"`
-	IncludeSubfolders *bool    `json:"include_subfolders,omitempty"`
+	Paths             []string       `json:"paths"`
+	IncludeSubfolders *bool          `json:"include_subfolders,omitempty"`
+	MaxDepth          *int           `json:"max_depth,omitempty"`
+	Filter            *browse.Filter `json:"filter,omitempty"` // Only mark files matching, e.g. codecs: [hevc] for ones already converted
 }
 
+// probeBatchSize is how many probed files CreateJobs queues at a time when
+// it probes up front
+const probeBatchSize = 25
+
 // CreateJobs handles POST /api/jobs
 // Responds immediately and processes files in background to avoid UI freeze
 func (h *Handler) CreateJobs(w http.ResponseWriter, r *http.Request) {
+	if h.refuseWhileShuttingDown(w) {
+		return
+	}
+
 	var req CreateJobsRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeError(w, http.StatusBadRequest, "invalid request body")
@@ -196,20 +433,57 @@ func (h *Handler) CreateJobs(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown preset: %s", req.PresetID))
 		return
 	}
+	if req.PreferredEncoder != "" {
+		if _, ok := ffmpeg.ParseHWAccel(req.PreferredEncoder); !ok {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown encoder: %s", req.PreferredEncoder))
+			return
+		}
+	}
+	if req.TargetSizeMB < 0 {
+		writeError(w, http.StatusBadRequest, "target_size_mb must be 0 or greater")
+		return
+	}
+	if req.Threads < 0 || req.Threads > jobs.MaxJobThreads {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("threads must be between 0 and %d", jobs.MaxJobThreads))
+		return
+	}
+
+	owner := requestUser(r)
+	batch := h.queue.CreateBatch(req.Paths, req.PresetID, owner)
+	addOpts := jobs.AddOptions{CreatedBy: owner, BatchID: batch.ID, AllowDuplicates: req.AllowDuplicates}
+
+	// Files found in the requested folders are checked in the background and
+	// counted in the batch's duplicates; requested files can be reported now
+	duplicates := []string{}
+	if !req.AllowDuplicates {
+		queuedPaths := h.queue.EnqueuedPaths()
+		for _, path := range req.Paths {
+			if absPath, err := filepath.Abs(path); err == nil {
+				if _, ok := queuedPaths[absPath]; ok {
+					duplicates = append(duplicates, path)
+				}
+			}
+		}
+	}
 
 	// Respond immediately - jobs will be added in background and appear via SSE
 	writeJSON(w, http.StatusAccepted, map[string]interface{}{
-		"status":  "processing",
-		"message": fmt.Sprintf("Processing %d paths in background...", len(req.Paths)),
+		"status":     "processing",
+		"message":    fmt.Sprintf("Processing %d paths in background...", len(req.Paths)),
+		"batch_id":   batch.ID,
+		"duplicates": duplicates,
 	})
 
-	log.Printf("[api] CreateJobs: received %d paths, preset=%s", len(req.Paths), req.PresetID)
+	apiLog.Info("Creating jobs", "paths", len(req.Paths), "preset", req.PresetID)
 	for i, p := range req.Paths {
-		log.Printf("[api] CreateJobs: path[%d] = %s", i, p)
+		apiLog.Debug("Creating jobs", "index", i, "path", p)
 	}
 
 	// Process in background goroutine
 	go func() {
+		// Runs last, once every job (and excluded extra) has been added
+		defer h.queue.FinishBatch(batch.ID)
+
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
 		defer cancel()
 
@@ -222,105 +496,134 @@ func (h *Handler) CreateJobs(w http.ResponseWriter, r *http.Request) {
 		if req.IncludeSubfolders != nil {
 			opts.Recursive = *req.IncludeSubfolders
 		}
+		if req.Filter != nil {
+			opts.Filter = *req.Filter
+		}
 
-		log.Printf("[api] CreateJobs background: deferred_probing=%v, recursive=%v, paths=%v",
-			h.cfg.Features.DeferredProbing, opts.Recursive, req.Paths)
+		apiLog.Debug("Creating jobs in the background", "deferred_probing", h.cfg.Features.DeferredProbing,
+			"recursive", opts.Recursive, "paths", req.Paths)
 
 		excludeProcessed := req.ExcludeProcessed != nil && *req.ExcludeProcessed
+		extras := newExtrasFilter(req)
+		defer extras.record(h.queue, batch.ID)
 		var processedPaths map[string]struct{}
 		if excludeProcessed {
 			processedPaths = h.queue.ProcessedPaths()
 		}
-		queuedPaths := h.queue.EnqueuedPaths()
 
-		// Check if deferred probing is enabled
-		if h.cfg.Features.DeferredProbing {
+		// Check if deferred probing is enabled. Filtering needs probe data,
+		// so a filtered request always probes up front.
+		if h.cfg.Features.DeferredProbing && opts.Filter.IsZero() {
 			// Streaming discovery: add jobs immediately without probing
 			// Files are probed by workers when they pick up the job
 			files, err := h.browser.DiscoverVideoFiles(ctx, req.Paths, opts)
 			if err != nil {
-				log.Printf("[api] Error discovering video files: %v", err)
+				apiLog.Warn("Error discovering video files", "error", err)
 				return
 			}
 
-			if excludeProcessed && len(processedPaths) > 0 {
-				filtered := make([]browse.DiscoveredFile, 0, len(files))
+			if excludeProcessed && h.cfg.FingerprintProcessed {
+				sizes := make(map[string]int64, len(files))
 				for _, file := range files {
-					if _, ok := processedPaths[file.Path]; ok {
-						continue
-					}
-					filtered = append(filtered, file)
+					sizes[file.Path] = file.Size
 				}
-				files = filtered
+				processedPaths = h.recognizeProcessed(processedPaths, sizes)
 			}
-			if len(queuedPaths) > 0 {
-				filtered := make([]browse.DiscoveredFile, 0, len(files))
-				for _, file := range files {
-					if _, ok := queuedPaths[file.Path]; ok {
-						continue
-					}
-					filtered = append(filtered, file)
+			filtered := make([]browse.DiscoveredFile, 0, len(files))
+			for _, file := range files {
+				if _, ok := processedPaths[file.Path]; ok {
+					continue
+				}
+				if !extras.keep(file.Path, 0) {
+					continue
 				}
-				files = filtered
+				filtered = append(filtered, file)
 			}
+			files = filtered
 
 			if len(files) == 0 {
-				log.Printf("[api] No video files found in paths: %v (recursive=%v)", req.Paths, opts.Recursive)
+				apiLog.Info("No video files found", "paths", req.Paths, "recursive", opts.Recursive)
 				return
 			}
 
-			log.Printf("[api] Discovered %d video files, adding as pending_probe", len(files))
+			apiLog.Info("Discovered video files, adding as pending_probe", "count", len(files))
 
 			// Convert to FileInfo for queue
 			fileInfos := make([]jobs.FileInfo, len(files))
 			for i, f := range files {
 				fileInfos[i] = jobs.FileInfo{
-					Path: f.Path,
-					Size: f.Size,
+					Path:      f.Path,
+					Size:      f.Size,
+					Hardlinks: f.Hardlinks,
 				}
 			}
 
 			// Add jobs in pending_probe status - SSE will notify frontend
-			h.queue.AddMultipleWithoutProbe(fileInfos, req.PresetID)
+			added := h.queue.AddMultipleWithoutProbeWith(addOpts, fileInfos, req.PresetID)
+			h.applyJobOptions(added, req)
 		} else {
-			// Original behavior: probe all files first (slower but complete info)
-			probes, err := h.browser.GetVideoFilesWithOptions(ctx, req.Paths, opts)
-			if err != nil {
-				log.Printf("[api] Error getting video files: %v", err)
-				return
-			}
-
-			if excludeProcessed && len(processedPaths) > 0 {
+			// Probe files up front (complete info), queueing them in batches
+			// as they're probed so the first jobs start before the last
+			// file is probed
+			err := h.browser.StreamVideoFiles(ctx, req.Paths, opts, probeBatchSize, func(probes []*ffmpeg.ProbeResult) {
+				if excludeProcessed && h.cfg.FingerprintProcessed {
+					sizes := make(map[string]int64, len(probes))
+					for _, probe := range probes {
+						sizes[probe.Path] = probe.Size
+					}
+					processedPaths = h.recognizeProcessed(processedPaths, sizes)
+				}
 				filtered := make([]*ffmpeg.ProbeResult, 0, len(probes))
 				for _, probe := range probes {
 					if _, ok := processedPaths[probe.Path]; ok {
 						continue
 					}
-					filtered = append(filtered, probe)
-				}
-				probes = filtered
-			}
-			if len(queuedPaths) > 0 {
-				filtered := make([]*ffmpeg.ProbeResult, 0, len(probes))
-				for _, probe := range probes {
-					if _, ok := queuedPaths[probe.Path]; ok {
+					if !extras.keep(probe.Path, probe.Duration) {
 						continue
 					}
 					filtered = append(filtered, probe)
 				}
-				probes = filtered
-			}
+				if len(filtered) == 0 {
+					return
+				}
 
-			if len(probes) == 0 {
-				return
+				// Add jobs to queue - SSE will notify frontend of new jobs
+				added, err := h.queue.AddMultipleWith(addOpts, filtered, req.PresetID)
+				if err != nil {
+					apiLog.Warn("Error adding jobs", "error", err)
+				}
+				h.applyJobOptions(added, req)
+			})
+			if err != nil {
+				apiLog.Warn("Error getting video files", "error", err)
 			}
-
-			// Add jobs to queue - SSE will notify frontend of new jobs
-			h.queue.AddMultiple(probes, req.PresetID)
 		}
 	}()
 }
 
+// applyJobOptions sets the request's preferred_encoder, target_size_mb and
+// threads on newly added jobs
+func (h *Handler) applyJobOptions(added []*jobs.Job, req CreateJobsRequest) {
+	var patch jobs.JobPatch
+	if req.PreferredEncoder != "" {
+		patch.PreferredEncoder = &req.PreferredEncoder
+	}
+	if req.TargetSizeMB > 0 {
+		patch.TargetSizeMB = &req.TargetSizeMB
+	}
+	if req.Threads > 0 {
+		patch.Threads = &req.Threads
+	}
+	if patch.PreferredEncoder == nil && patch.TargetSizeMB == nil && patch.Threads == nil {
+		return
+	}
+	for _, job := range added {
+		if _, err := h.queue.UpdateJob(job.ID, patch); err != nil {
+			apiLog.Warn("Could not set options on job", "job", job.ID, "error", err)
+		}
+	}
+}
+
 // MarkProcessed handles POST /api/processed/mark
 func (h *Handler) MarkProcessed(w http.ResponseWriter, r *http.Request) {
 	var req MarkProcessedRequest
@@ -336,32 +639,49 @@ func (h *Handler) MarkProcessed(w http.ResponseWriter, r *http.Request) {
 
 	opts := browse.GetVideoFilesOptions{
 		Recursive: true,
-		MaxDepth:  nil,
+		MaxDepth:  req.MaxDepth,
 	}
 	if req.IncludeSubfolders != nil {
 		opts.Recursive = *req.IncludeSubfolders
 	}
+	if req.Filter != nil {
+		opts.Filter = *req.Filter
+	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Minute)
 	defer cancel()
 
-	files, err := h.browser.DiscoverVideoFiles(ctx, req.Paths, opts)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, err.Error())
-		return
+	// Directories are marked file by file; a filter needs each file probed
+	var paths []string
+	if opts.Filter.IsZero() {
+		files, err := h.browser.DiscoverVideoFiles(ctx, req.Paths, opts)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		for _, file := range files {
+			paths = append(paths, file.Path)
+		}
+	} else {
+		probes, err := h.browser.GetVideoFilesWithOptions(ctx, req.Paths, opts)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		for _, probe := range probes {
+			paths = append(paths, probe.Path)
+		}
 	}
 
-	if len(files) == 0 {
+	if len(paths) == 0 {
 		writeError(w, http.StatusBadRequest, "no video files found")
 		return
 	}
 
-	paths := make([]string, 0, len(files))
-	for _, file := range files {
-		paths = append(paths, file.Path)
-	}
-
 	added := h.queue.MarkProcessedPaths(paths)
+	if h.cfg.FingerprintProcessed {
+		h.queue.RecordFingerprints(paths)
+	}
 	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"processed": added,
 		"total":     len(paths),
@@ -369,14 +689,67 @@ func (h *Handler) MarkProcessed(w http.ResponseWriter, r *http.Request) {
 }
 
 // ListJobs handles GET /api/jobs
+// Optional query: status (comma-separated), preset, sort, page, page_size.
+// Without page every matching job is returned.
 func (h *Handler) ListJobs(w http.ResponseWriter, r *http.Request) {
-	allJobs := h.queue.GetAll()
-	stats := h.queue.Stats()
+	query := r.URL.Query()
+	opts := jobs.ListOptions{
+		PresetID:  query.Get("preset"),
+		Sort:      query.Get("sort"),
+		CreatedBy: h.jobViewer(r),
+	}
+	for _, status := range strings.Split(query.Get("status"), ",") {
+		if status = strings.TrimSpace(status); status != "" {
+			opts.Statuses = append(opts.Statuses, jobs.Status(status))
+		}
+	}
+	if param := query.Get("page"); param != "" {
+		n, err := strconv.Atoi(param)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, "page must be at least 1")
+			return
+		}
+		opts.Page = n
+	}
+	if param := query.Get("page_size"); param != "" {
+		n, err := strconv.Atoi(param)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, "page_size must be positive")
+			return
+		}
+		opts.PageSize = n
+	}
+	if err := opts.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"jobs":  allJobs,
-		"stats": stats,
-	})
+	list, total := h.queue.List(opts)
+	resp := map[string]interface{}{
+		"jobs":  list,
+		"stats": h.queue.Stats(),
+		"total": total,
+	}
+	if opts.Page > 0 {
+		resp["page"] = opts.Page
+		resp["page_size"] = opts.PageSize
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// JobChanges handles GET /api/jobs/changes
+// Optional query: since, the cursor from the previous response.
+func (h *Handler) JobChanges(w http.ResponseWriter, r *http.Request) {
+	var since uint64
+	if param := r.URL.Query().Get("since"); param != "" {
+		n, err := strconv.ParseUint(param, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "since must be a cursor from a previous response")
+			return
+		}
+		since = n
+	}
+	writeJSON(w, http.StatusOK, h.queue.ChangesSince(since, h.jobViewer(r)))
 }
 
 // GetJob handles GET /api/jobs/:id
@@ -397,6 +770,76 @@ func (h *Handler) GetJob(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, job)
 }
 
+// GetJobAttempts handles GET /api/jobs/:id/attempts
+// Returns every try at the job's file, oldest first, ending with the job.
+func (h *Handler) GetJobAttempts(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		writeError(w, http.StatusBadRequest, "job ID required")
+		return
+	}
+
+	attempts, err := h.queue.Attempts(id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "job not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"job_id":   id,
+		"attempts": attempts,
+	})
+}
+
+// GetJobTimeline handles GET /api/jobs/:id/timeline
+// Returns the job's state changes and the time spent queued, probing,
+// encoding and finalizing.
+func (h *Handler) GetJobTimeline(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		writeError(w, http.StatusBadRequest, "job ID required")
+		return
+	}
+
+	timeline, err := h.queue.Timeline(id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "job not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, timeline)
+}
+
+// UpdateJob handles PATCH /api/jobs/:id
+// Accepts any subset of priority, tags, note, preset_id and custom_args.
+// The whole patch is rejected if any field is invalid for the job's status.
+func (h *Handler) UpdateJob(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		writeError(w, http.StatusBadRequest, "job ID required")
+		return
+	}
+
+	var patch jobs.JobPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if h.queue.Get(id) == nil {
+		writeError(w, http.StatusNotFound, "job not found")
+		return
+	}
+
+	job, err := h.queue.UpdateJob(id, patch)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, job)
+}
+
 // CancelJob handles DELETE /api/jobs/:id
 func (h *Handler) CancelJob(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
@@ -411,7 +854,7 @@ func (h *Handler) CancelJob(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if job.Status == jobs.StatusFailed || job.Status == jobs.StatusCancelled {
+	if job.Status == jobs.StatusFailed || job.Status == jobs.StatusCancelled || job.Status == jobs.StatusVerifyFailed {
 		if _, err := h.queue.Remove(id); err != nil {
 			writeError(w, http.StatusInternalServerError, err.Error())
 			return
@@ -582,6 +1025,11 @@ func (h *Handler) ClearQueue(w http.ResponseWriter, r *http.Request) {
 		IncludeCompleted *bool `json:"include_completed"`
 	}
 
+	if h.jobViewer(r) != "" {
+		writeError(w, http.StatusForbidden, "only admins can clear the queue")
+		return
+	}
+
 	includeCompleted := true
 	var req clearQueueRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
@@ -608,35 +1056,151 @@ func (h *Handler) ClearProcessedHistory(w http.ResponseWriter, r *http.Request)
 	})
 }
 
+// ListProcessed handles GET /api/processed
+// Optional query: search, sort (path or processed), page, page_size.
+// Without page every matching path is returned.
+func (h *Handler) ListProcessed(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	opts := jobs.ProcessedListOptions{
+		Search: query.Get("search"),
+		Sort:   query.Get("sort"),
+	}
+	if param := query.Get("page"); param != "" {
+		n, err := strconv.Atoi(param)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, "page must be at least 1")
+			return
+		}
+		opts.Page = n
+	}
+	if param := query.Get("page_size"); param != "" {
+		n, err := strconv.Atoi(param)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, "page_size must be positive")
+			return
+		}
+		opts.PageSize = n
+	}
+	if err := opts.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	entries, total := h.queue.ListProcessed(opts)
+	resp := map[string]interface{}{
+		"entries": entries,
+		"total":   total,
+	}
+	if opts.Page > 0 {
+		resp["page"] = opts.Page
+		resp["page_size"] = opts.PageSize
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// UnmarkProcessed handles DELETE /api/processed?path=
+// A directory path removes every processed file beneath it. path may be
+// repeated.
+func (h *Handler) UnmarkProcessed(w http.ResponseWriter, r *http.Request) {
+	paths := r.URL.Query()["path"]
+	if len(paths) == 0 {
+		writeError(w, http.StatusBadRequest, "path is required")
+		return
+	}
+
+	removed := 0
+	for _, path := range paths {
+		removed += h.queue.UnmarkProcessed(path)
+	}
+	if removed == 0 {
+		writeError(w, http.StatusNotFound, "path is not marked processed")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"removed": removed,
+	})
+}
+
 // GetConfig handles GET /api/config
 func (h *Handler) GetConfig(w http.ResponseWriter, r *http.Request) {
 	// Return a sanitized config (no sensitive paths exposed)
 	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"version":                 shrinkray.Version,
-		"media_path":              h.cfg.MediaPath,
-		"original_handling":       h.cfg.OriginalHandling,
-		"subtitle_handling":       h.cfg.SubtitleHandling,
-		"workers":                 h.cfg.Workers,
-		"has_temp_path":           h.cfg.TempPath != "",
-		"pushover_user_key":       h.cfg.PushoverUserKey,
-		"pushover_app_token":      h.cfg.PushoverAppToken,
-		"pushover_configured":     h.pushover.IsConfigured(),
-		"ntfy_server":             h.cfg.NtfyServer,
-		"ntfy_topic":              h.cfg.NtfyTopic,
-		"ntfy_token":              h.cfg.NtfyToken,
-		"ntfy_configured":         h.ntfy.IsConfigured(),
-		"notify_on_complete":      h.cfg.NotifyOnComplete,
-		"hide_processing_tmp":     h.cfg.HideProcessingTmp,
-		"allow_software_fallback": h.cfg.AllowSoftwareFallback,
-		"quality_hevc":            h.cfg.QualityHEVC,
-		"quality_av1":             h.cfg.QualityAV1,
-		"schedule_enabled":        h.cfg.ScheduleEnabled,
-		"schedule_start_hour":     h.cfg.ScheduleStartHour,
-		"schedule_end_hour":       h.cfg.ScheduleEndHour,
-		"keep_larger_files":       h.cfg.KeepLargerFiles,
-		"layout_design":           h.cfg.LayoutDesign,
-		"auth_enabled":            h.cfg.Auth.Enabled,
-		"auth_provider":           h.cfg.Auth.Provider,
+		"version":                     shrinkray.Version,
+		"media_path":                  h.cfg.MediaPath,
+		"original_handling":           h.cfg.OriginalHandling,
+		"subtitle_handling":           h.cfg.SubtitleHandling,
+		"output_container":            h.cfg.OutputContainer,
+		"verify_output":               h.cfg.VerifyOutput,
+		"preset_containers":           h.cfg.PresetContainers,
+		"preset_encoders":             h.cfg.PresetEncoders,
+		"preset_deinterlace":          h.cfg.PresetDeinterlace,
+		"preset_threads":              h.cfg.PresetThreads,
+		"preset_max_encode_hours":     h.cfg.PresetMaxEncodeHours,
+		"preset_auto_quality":         h.cfg.PresetAutoQuality,
+		"keep_source_container":       h.cfg.KeepSourceContainer,
+		"hdr_handling":                h.cfg.HDRHandling,
+		"hardlink_handling":           h.cfg.HardlinkHandling,
+		"hardlink_handling_paths":     h.cfg.HardlinkHandlingPaths,
+		"hardlink_search_paths":       h.cfg.HardlinkSearchPaths,
+		"workers":                     h.cfg.Workers,
+		"worker_devices":              h.cfg.WorkerDevices,
+		"has_temp_path":               h.cfg.TempPath != "",
+		"pushover_user_key_set":       h.cfg.PushoverUserKey != "",
+		"pushover_app_token_set":      h.cfg.PushoverAppToken != "",
+		"pushover_configured":         h.pushover.IsConfigured(),
+		"ntfy_server":                 h.cfg.NtfyServer,
+		"ntfy_topic":                  h.cfg.NtfyTopic,
+		"ntfy_token_set":              h.cfg.NtfyToken != "",
+		"ntfy_configured":             h.ntfy.IsConfigured(),
+		"managed_secrets":             h.managedSecrets(),
+		"notify_on_complete":          h.cfg.NotifyOnComplete,
+		"notify_on_batch_complete":    h.cfg.NotifyOnBatchComplete,
+		"notify_failure_threshold":    h.cfg.NotifyFailureThreshold,
+		"hide_processing_tmp":         h.cfg.HideProcessingTmp,
+		"fingerprint_processed":       h.cfg.FingerprintProcessed,
+		"allow_software_fallback":     h.cfg.AllowSoftwareFallback,
+		"quality_hevc":                h.cfg.QualityHEVC,
+		"quality_av1":                 h.cfg.QualityAV1,
+		"svt_av1_preset":              h.cfg.SVTAV1Preset,
+		"svt_av1_film_grain":          h.cfg.SVTAV1FilmGrain,
+		"svt_av1_tune":                h.cfg.SVTAV1Tune,
+		"audio_codec":                 h.cfg.AudioCodec,
+		"reencode_above_bpp":          h.cfg.ReencodeAboveBPP,
+		"auto_quality":                h.cfg.AutoQuality,
+		"auto_quality_target_ssim":    h.cfg.AutoQualityTargetSSIM,
+		"auto_quality_target_savings": h.cfg.AutoQualityTargetSavings,
+		"auto_crop":                   h.cfg.AutoCrop,
+		"schedule_enabled":            h.cfg.ScheduleEnabled,
+		"schedule_start_hour":         h.cfg.ScheduleStartHour,
+		"schedule_end_hour":           h.cfg.ScheduleEndHour,
+		"keep_larger_files":           h.cfg.KeepLargerFiles,
+		"min_savings_percent":         h.cfg.MinSavingsPercent,
+		"preserve_ownership":          h.cfg.PreserveOwnership,
+		"preserve_mtime":              h.cfg.PreserveMTime,
+		"min_free_space_mb":           h.cfg.MinFreeSpaceMB,
+		"reserve_temp_space":          h.cfg.ReserveTempSpace,
+		"scan_interval_hours":         h.cfg.ScanIntervalHours,
+		"original_retention_days":     h.cfg.OriginalRetentionDays,
+		"trash_originals":             h.cfg.TrashOriginals,
+		"trash_retention_days":        h.cfg.TrashRetentionDays,
+		"shutdown_grace_seconds":      h.cfg.ShutdownGraceSeconds,
+		"stall_timeout_minutes":       h.cfg.StallTimeoutMinutes,
+		"stall_retries":               h.cfg.StallRetries,
+		"max_encode_hours":            h.cfg.MaxEncodeHours,
+		"chunked_segments":            h.cfg.ChunkedSegments,
+		"chunked_min_minutes":         h.cfg.ChunkedMinMinutes,
+		"preview_interval_seconds":    h.cfg.PreviewIntervalSeconds,
+		"thumbnail_cache_mb":          h.cfg.ThumbnailCacheMB,
+		"extra_video_extensions":      h.cfg.ExtraVideoExtensions,
+		"excluded_video_extensions":   h.cfg.ExcludedVideoExtensions,
+		"video_extensions":            ffmpeg.VideoExtensions(),
+		"layout_design":               h.cfg.LayoutDesign,
+		"auth_enabled":                h.cfg.Auth.Enabled,
+		"auth_provider":               h.cfg.Auth.Provider,
+		"sonarr_configured":           h.cfg.Integrations.Sonarr.URL != "" && h.cfg.Integrations.Sonarr.APIKey != "",
+		"radarr_configured":           h.cfg.Integrations.Radarr.URL != "" && h.cfg.Integrations.Radarr.APIKey != "",
+		"plex_servers":                len(h.cfg.Integrations.Plex),
+		"jellyfin_servers":            len(h.cfg.Integrations.Jellyfin),
 		// Feature flags for frontend
 		"features": map[string]bool{
 			"virtual_scroll":   h.cfg.Features.VirtualScroll,
@@ -648,25 +1212,80 @@ func (h *Handler) GetConfig(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// editableSecrets are the credentials PUT /api/config can change. GET
+// /api/config only reports whether they are set.
+var editableSecrets = []string{"pushover_user_key", "pushover_app_token", "ntfy_token"}
+
+// managedSecrets lists the editable credentials set from the environment or
+// a secret file, which the UI shows as read-only
+func (h *Handler) managedSecrets() []string {
+	managed := []string{}
+	for _, key := range editableSecrets {
+		if h.cfg.SecretSource(key) != config.SecretSourceConfig {
+			managed = append(managed, key)
+		}
+	}
+	return managed
+}
+
 type UpdateConfigRequest struct {
-	OriginalHandling      *string `json:"original_handling,omitempty"`
-	SubtitleHandling      *string `json:"subtitle_handling,omitempty"`
-	Workers               *int    `json:"workers,omitempty"`
-	PushoverUserKey       *string `json:"pushover_user_key,omitempty"`
-	PushoverAppToken      *string `json:"pushover_app_token,omitempty"`
-	NtfyServer            *string `json:"ntfy_server,omitempty"`
-	NtfyTopic             *string `json:"ntfy_topic,omitempty"`
-	NtfyToken             *string `json:"ntfy_token,omitempty"`
-	NotifyOnComplete      *bool   `json:"notify_on_complete,omitempty"`
-	HideProcessingTmp     *bool   `json:"hide_processing_tmp,omitempty"`
-	AllowSoftwareFallback *bool   `json:"allow_software_fallback,omitempty"`
-	QualityHEVC           *int    `json:"quality_hevc,omitempty"`
-	QualityAV1            *int    `json:"quality_av1,omitempty"`
-	ScheduleEnabled       *bool   `json:"schedule_enabled,omitempty"`
-	ScheduleStartHour     *int    `json:"schedule_start_hour,omitempty"`
-	ScheduleEndHour       *int    `json:"schedule_end_hour,omitempty"`
-	KeepLargerFiles       *bool   `json:"keep_larger_files,omitempty"`
-	LayoutDesign          *string `json:"layout_design,omitempty"`
+	OriginalHandling         *string  `json:"original_handling,omitempty"`
+	SubtitleHandling         *string  `json:"subtitle_handling,omitempty"`
+	OutputContainer          *string  `json:"output_container,omitempty"`
+	VerifyOutput             *bool    `json:"verify_output,omitempty"`
+	KeepSourceContainer      *bool    `json:"keep_source_container,omitempty"`
+	HDRHandling              *string  `json:"hdr_handling,omitempty"`
+	HardlinkHandling         *string  `json:"hardlink_handling,omitempty"`
+	Workers                  *int     `json:"workers,omitempty"`
+	PushoverUserKey          *string  `json:"pushover_user_key,omitempty"`
+	PushoverAppToken         *string  `json:"pushover_app_token,omitempty"`
+	NtfyServer               *string  `json:"ntfy_server,omitempty"`
+	NtfyTopic                *string  `json:"ntfy_topic,omitempty"`
+	NtfyToken                *string  `json:"ntfy_token,omitempty"`
+	NotifyOnComplete         *bool    `json:"notify_on_complete,omitempty"`
+	NotifyOnBatchComplete    *bool    `json:"notify_on_batch_complete,omitempty"`
+	NotifyFailureThreshold   *int     `json:"notify_failure_threshold,omitempty"`
+	HideProcessingTmp        *bool    `json:"hide_processing_tmp,omitempty"`
+	FingerprintProcessed     *bool    `json:"fingerprint_processed,omitempty"`
+	AllowSoftwareFallback    *bool    `json:"allow_software_fallback,omitempty"`
+	QualityHEVC              *int     `json:"quality_hevc,omitempty"`
+	QualityAV1               *int     `json:"quality_av1,omitempty"`
+	SVTAV1Preset             *int     `json:"svt_av1_preset,omitempty"`
+	SVTAV1FilmGrain          *int     `json:"svt_av1_film_grain,omitempty"`
+	SVTAV1Tune               *int     `json:"svt_av1_tune,omitempty"`
+	AudioCodec               *string  `json:"audio_codec,omitempty"`
+	ReencodeAboveBPP         *float64 `json:"reencode_above_bpp,omitempty"`
+	AutoQuality              *bool    `json:"auto_quality,omitempty"`
+	AutoQualityTargetSSIM    *float64 `json:"auto_quality_target_ssim,omitempty"`
+	AutoQualityTargetSavings *int     `json:"auto_quality_target_savings,omitempty"`
+	AutoCrop                 *bool    `json:"auto_crop,omitempty"`
+	ScheduleEnabled          *bool    `json:"schedule_enabled,omitempty"`
+	ScheduleStartHour        *int     `json:"schedule_start_hour,omitempty"`
+	ScheduleEndHour          *int     `json:"schedule_end_hour,omitempty"`
+	KeepLargerFiles          *bool    `json:"keep_larger_files,omitempty"`
+	MinSavingsPercent        *int     `json:"min_savings_percent,omitempty"`
+	PreserveOwnership        *bool    `json:"preserve_ownership,omitempty"`
+	PreserveMTime            *bool    `json:"preserve_mtime,omitempty"`
+	MinFreeSpaceMB           *int64   `json:"min_free_space_mb,omitempty"`
+	ReserveTempSpace         *bool    `json:"reserve_temp_space,omitempty"`
+	ScanIntervalHours        *int     `json:"scan_interval_hours,omitempty"`
+	OriginalRetentionDays    *int     `json:"original_retention_days,omitempty"`
+	TrashOriginals           *bool    `json:"trash_originals,omitempty"`
+	TrashRetentionDays       *int     `json:"trash_retention_days,omitempty"`
+	ShutdownGraceSeconds     *int     `json:"shutdown_grace_seconds,omitempty"`
+	StallTimeoutMinutes      *int     `json:"stall_timeout_minutes,omitempty"`
+	StallRetries             *int     `json:"stall_retries,omitempty"`
+	MaxEncodeHours           *int     `json:"max_encode_hours,omitempty"`
+	ChunkedSegments          *int     `json:"chunked_segments,omitempty"`
+	ChunkedMinMinutes        *int     `json:"chunked_min_minutes,omitempty"`
+	PreviewIntervalSeconds   *int     `json:"preview_interval_seconds,omitempty"`
+	ThumbnailCacheMB         *int     `json:"thumbnail_cache_mb,omitempty"`
+	ExtraVideoExtensions     []string `json:"extra_video_extensions,omitempty"`
+	ExcludedVideoExtensions  []string `json:"excluded_video_extensions,omitempty"`
+	LayoutDesign             *string  `json:"layout_design,omitempty"`
+
+	// PresetAutoQuality replaces the per-preset auto_quality overrides
+	PresetAutoQuality map[string]bool `json:"preset_auto_quality,omitempty"`
 }
 
 // UpdateConfig handles PUT /api/config
@@ -677,6 +1296,18 @@ func (h *Handler) UpdateConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	secrets := map[string]*string{
+		"pushover_user_key":  req.PushoverUserKey,
+		"pushover_app_token": req.PushoverAppToken,
+		"ntfy_token":         req.NtfyToken,
+	}
+	for _, key := range editableSecrets {
+		if secrets[key] != nil && h.cfg.SecretSource(key) != config.SecretSourceConfig {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("%s is set from the environment or a secret file", key))
+			return
+		}
+	}
+
 	// Only allow updating certain fields
 	if req.OriginalHandling != nil {
 		if *req.OriginalHandling != "replace" && *req.OriginalHandling != "keep" {
@@ -692,6 +1323,35 @@ func (h *Handler) UpdateConfig(w http.ResponseWriter, r *http.Request) {
 		}
 		h.cfg.SubtitleHandling = *req.SubtitleHandling
 	}
+	if req.OutputContainer != nil {
+		if *req.OutputContainer != "mkv" && *req.OutputContainer != "mp4" {
+			writeError(w, http.StatusBadRequest, "output_container must be 'mkv' or 'mp4'")
+			return
+		}
+		h.cfg.OutputContainer = *req.OutputContainer
+	}
+	if req.VerifyOutput != nil {
+		h.cfg.VerifyOutput = *req.VerifyOutput
+	}
+	if req.KeepSourceContainer != nil {
+		h.cfg.KeepSourceContainer = *req.KeepSourceContainer
+	}
+	if req.HDRHandling != nil {
+		switch *req.HDRHandling {
+		case "preserve", "tonemap", "skip":
+			h.cfg.HDRHandling = *req.HDRHandling
+		default:
+			writeError(w, http.StatusBadRequest, "hdr_handling must be 'preserve', 'tonemap' or 'skip'")
+			return
+		}
+	}
+	if req.HardlinkHandling != nil {
+		if !config.ValidHardlinkHandling(*req.HardlinkHandling) {
+			writeError(w, http.StatusBadRequest, "hardlink_handling must be 'break', 'skip' or 'relink'")
+			return
+		}
+		h.cfg.HardlinkHandling = *req.HardlinkHandling
+	}
 
 	if req.Workers != nil && *req.Workers > 0 {
 		workers := *req.Workers
@@ -726,10 +1386,23 @@ func (h *Handler) UpdateConfig(w http.ResponseWriter, r *http.Request) {
 	if req.NotifyOnComplete != nil {
 		h.cfg.NotifyOnComplete = *req.NotifyOnComplete
 	}
+	if req.NotifyOnBatchComplete != nil {
+		h.cfg.NotifyOnBatchComplete = *req.NotifyOnBatchComplete
+	}
+	if req.NotifyFailureThreshold != nil {
+		if *req.NotifyFailureThreshold < 0 {
+			writeError(w, http.StatusBadRequest, "notify_failure_threshold must be 0 or greater")
+			return
+		}
+		h.cfg.NotifyFailureThreshold = *req.NotifyFailureThreshold
+	}
 	if req.HideProcessingTmp != nil {
 		h.cfg.HideProcessingTmp = *req.HideProcessingTmp
 		h.browser.SetHideProcessingTmp(*req.HideProcessingTmp)
 	}
+	if req.FingerprintProcessed != nil {
+		h.cfg.FingerprintProcessed = *req.FingerprintProcessed
+	}
 	if req.AllowSoftwareFallback != nil {
 		h.cfg.AllowSoftwareFallback = *req.AllowSoftwareFallback
 	}
@@ -739,6 +1412,79 @@ func (h *Handler) UpdateConfig(w http.ResponseWriter, r *http.Request) {
 	if req.QualityAV1 != nil {
 		h.cfg.QualityAV1 = *req.QualityAV1
 	}
+	if req.SVTAV1Preset != nil || req.SVTAV1FilmGrain != nil || req.SVTAV1Tune != nil {
+		if req.SVTAV1Preset != nil && (*req.SVTAV1Preset < 0 || *req.SVTAV1Preset > 13) {
+			writeError(w, http.StatusBadRequest, "svt_av1_preset must be between 0 and 13")
+			return
+		}
+		if req.SVTAV1FilmGrain != nil && (*req.SVTAV1FilmGrain < 0 || *req.SVTAV1FilmGrain > 50) {
+			writeError(w, http.StatusBadRequest, "svt_av1_film_grain must be between 0 and 50")
+			return
+		}
+		if req.SVTAV1Tune != nil && (*req.SVTAV1Tune < 0 || *req.SVTAV1Tune > 2) {
+			writeError(w, http.StatusBadRequest, "svt_av1_tune must be 0, 1 or 2")
+			return
+		}
+		if req.SVTAV1Preset != nil {
+			h.cfg.SVTAV1Preset = *req.SVTAV1Preset
+		}
+		if req.SVTAV1FilmGrain != nil {
+			h.cfg.SVTAV1FilmGrain = *req.SVTAV1FilmGrain
+		}
+		if req.SVTAV1Tune != nil {
+			h.cfg.SVTAV1Tune = *req.SVTAV1Tune
+		}
+		h.applySVTAV1Options(h.cfg)
+	}
+	if req.AudioCodec != nil {
+		if *req.AudioCodec != "eac3" && *req.AudioCodec != "opus" {
+			writeError(w, http.StatusBadRequest, "audio_codec must be eac3 or opus")
+			return
+		}
+		h.cfg.AudioCodec = *req.AudioCodec
+		ffmpeg.SetAudioCodec(h.cfg.AudioCodec)
+		ffmpeg.InitPresets()
+		h.queue.Notify("encoders_changed")
+	}
+	if req.ReencodeAboveBPP != nil {
+		if *req.ReencodeAboveBPP < 0 || *req.ReencodeAboveBPP > 1 {
+			writeError(w, http.StatusBadRequest, "reencode_above_bpp must be between 0 and 1")
+			return
+		}
+		h.cfg.ReencodeAboveBPP = *req.ReencodeAboveBPP
+		ffmpeg.SetReencodeAboveBPP(h.cfg.ReencodeAboveBPP)
+		ffmpeg.InitPresets()
+		h.queue.Notify("encoders_changed")
+	}
+	if req.AutoQuality != nil {
+		h.cfg.AutoQuality = *req.AutoQuality
+	}
+	if req.PresetAutoQuality != nil {
+		for id := range req.PresetAutoQuality {
+			if ffmpeg.GetPreset(id) == nil {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("preset_auto_quality: unknown preset: %s", id))
+				return
+			}
+		}
+		h.cfg.PresetAutoQuality = req.PresetAutoQuality
+	}
+	if req.AutoQualityTargetSSIM != nil {
+		if *req.AutoQualityTargetSSIM <= 0 || *req.AutoQualityTargetSSIM > 1 {
+			writeError(w, http.StatusBadRequest, "auto_quality_target_ssim must be between 0 and 1")
+			return
+		}
+		h.cfg.AutoQualityTargetSSIM = *req.AutoQualityTargetSSIM
+	}
+	if req.AutoQualityTargetSavings != nil {
+		if *req.AutoQualityTargetSavings < 0 || *req.AutoQualityTargetSavings > 99 {
+			writeError(w, http.StatusBadRequest, "auto_quality_target_savings must be between 0 and 99")
+			return
+		}
+		h.cfg.AutoQualityTargetSavings = *req.AutoQualityTargetSavings
+	}
+	if req.AutoCrop != nil {
+		h.cfg.AutoCrop = *req.AutoCrop
+	}
 	if req.ScheduleEnabled != nil {
 		h.cfg.ScheduleEnabled = *req.ScheduleEnabled
 	}
@@ -757,6 +1503,127 @@ func (h *Handler) UpdateConfig(w http.ResponseWriter, r *http.Request) {
 	if req.KeepLargerFiles != nil {
 		h.cfg.KeepLargerFiles = *req.KeepLargerFiles
 	}
+	if req.MinSavingsPercent != nil {
+		if *req.MinSavingsPercent < 0 || *req.MinSavingsPercent > 90 {
+			writeError(w, http.StatusBadRequest, "min_savings_percent must be between 0 and 90")
+			return
+		}
+		h.cfg.MinSavingsPercent = *req.MinSavingsPercent
+	}
+	if req.PreserveOwnership != nil {
+		h.cfg.PreserveOwnership = *req.PreserveOwnership
+	}
+	if req.PreserveMTime != nil {
+		h.cfg.PreserveMTime = *req.PreserveMTime
+	}
+	if req.MinFreeSpaceMB != nil {
+		if *req.MinFreeSpaceMB < 0 {
+			writeError(w, http.StatusBadRequest, "min_free_space_mb must be 0 or greater")
+			return
+		}
+		h.cfg.MinFreeSpaceMB = *req.MinFreeSpaceMB
+	}
+	if req.ReserveTempSpace != nil {
+		h.cfg.ReserveTempSpace = *req.ReserveTempSpace
+	}
+	if req.ScanIntervalHours != nil {
+		if *req.ScanIntervalHours < 0 {
+			writeError(w, http.StatusBadRequest, "scan_interval_hours must be 0 or greater")
+			return
+		}
+		h.cfg.ScanIntervalHours = *req.ScanIntervalHours
+	}
+	if req.OriginalRetentionDays != nil {
+		if *req.OriginalRetentionDays < 0 {
+			writeError(w, http.StatusBadRequest, "original_retention_days must be 0 or greater")
+			return
+		}
+		h.cfg.OriginalRetentionDays = *req.OriginalRetentionDays
+	}
+	if req.TrashOriginals != nil {
+		h.cfg.TrashOriginals = *req.TrashOriginals
+	}
+	if req.TrashRetentionDays != nil {
+		if *req.TrashRetentionDays < 0 {
+			writeError(w, http.StatusBadRequest, "trash_retention_days must be 0 or greater")
+			return
+		}
+		h.cfg.TrashRetentionDays = *req.TrashRetentionDays
+	}
+	if req.ShutdownGraceSeconds != nil {
+		if *req.ShutdownGraceSeconds < 0 {
+			writeError(w, http.StatusBadRequest, "shutdown_grace_seconds must be 0 or greater")
+			return
+		}
+		h.cfg.ShutdownGraceSeconds = *req.ShutdownGraceSeconds
+	}
+	if req.StallTimeoutMinutes != nil {
+		if *req.StallTimeoutMinutes < 0 {
+			writeError(w, http.StatusBadRequest, "stall_timeout_minutes must be 0 or greater")
+			return
+		}
+		h.cfg.StallTimeoutMinutes = *req.StallTimeoutMinutes
+	}
+	if req.StallRetries != nil {
+		if *req.StallRetries < 0 {
+			writeError(w, http.StatusBadRequest, "stall_retries must be 0 or greater")
+			return
+		}
+		h.cfg.StallRetries = *req.StallRetries
+	}
+	if req.MaxEncodeHours != nil {
+		if *req.MaxEncodeHours < 0 {
+			writeError(w, http.StatusBadRequest, "max_encode_hours must be 0 or greater")
+			return
+		}
+		h.cfg.MaxEncodeHours = *req.MaxEncodeHours
+	}
+	if req.ChunkedSegments != nil {
+		if *req.ChunkedSegments != 0 && (*req.ChunkedSegments < 2 || *req.ChunkedSegments > 16) {
+			writeError(w, http.StatusBadRequest, "chunked_segments must be 0 (off) or between 2 and 16")
+			return
+		}
+		h.cfg.ChunkedSegments = *req.ChunkedSegments
+	}
+	if req.ChunkedMinMinutes != nil {
+		if *req.ChunkedMinMinutes < 0 {
+			writeError(w, http.StatusBadRequest, "chunked_min_minutes must be 0 or greater")
+			return
+		}
+		h.cfg.ChunkedMinMinutes = *req.ChunkedMinMinutes
+	}
+	if req.PreviewIntervalSeconds != nil {
+		if *req.PreviewIntervalSeconds < 0 {
+			writeError(w, http.StatusBadRequest, "preview_interval_seconds must be 0 or greater")
+			return
+		}
+		h.cfg.PreviewIntervalSeconds = *req.PreviewIntervalSeconds
+	}
+	if req.ThumbnailCacheMB != nil {
+		if *req.ThumbnailCacheMB < 0 {
+			writeError(w, http.StatusBadRequest, "thumbnail_cache_mb must be 0 or greater")
+			return
+		}
+		h.cfg.ThumbnailCacheMB = *req.ThumbnailCacheMB
+		h.browser.SetThumbnailCacheSize(int64(*req.ThumbnailCacheMB) << 20)
+	}
+	if req.ExtraVideoExtensions != nil || req.ExcludedVideoExtensions != nil {
+		extra, excluded := h.cfg.ExtraVideoExtensions, h.cfg.ExcludedVideoExtensions
+		if req.ExtraVideoExtensions != nil {
+			extra = config.NormalizeExtensions(req.ExtraVideoExtensions)
+		}
+		if req.ExcludedVideoExtensions != nil {
+			excluded = config.NormalizeExtensions(req.ExcludedVideoExtensions)
+		}
+		for _, ext := range extra {
+			if ffmpeg.IsStillExtension(ext) || ffmpeg.NormalizeExtension(ext) == "" {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("%s can't be a video extension", ext))
+				return
+			}
+		}
+		h.cfg.ExtraVideoExtensions, h.cfg.ExcludedVideoExtensions = extra, excluded
+		h.applyVideoExtensions(extra, excluded)
+	}
 	if req.LayoutDesign != nil {
 		if *req.LayoutDesign != "split" && *req.LayoutDesign != "tabs" {
 			writeError(w, http.StatusBadRequest, "layout_design must be 'split' or 'tabs'")
@@ -776,10 +1643,56 @@ func (h *Handler) UpdateConfig(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{"status": "updated"})
 }
 
+// StatsResponse is the response body of GET /api/stats
+type StatsResponse struct {
+	jobs.Stats
+	WorkerRestarts  int                `json:"worker_restarts"`
+	LastWorkerPanic *jobs.WorkerPanic  `json:"last_worker_panic,omitempty"`
+	KeptOriginals   *retention.Summary `json:"kept_originals,omitempty"`
+	EnergyCurrency  string             `json:"energy_currency,omitempty"` // Of energy_cost
+}
+
 // Stats handles GET /api/stats
 func (h *Handler) Stats(w http.ResponseWriter, r *http.Request) {
-	stats := h.queue.Stats()
-	writeJSON(w, http.StatusOK, stats)
+	restarts, lastPanic := h.workerPool.RestartStats()
+	var originals *retention.Summary
+	if h.retention != nil {
+		summary := h.retention.Summary()
+		originals = &summary
+	}
+	writeJSON(w, http.StatusOK, StatsResponse{
+		Stats:           h.queue.Stats(),
+		WorkerRestarts:  restarts,
+		LastWorkerPanic: lastPanic,
+		KeptOriginals:   originals,
+		EnergyCurrency:  h.cfg.Energy.Currency,
+	})
+}
+
+// SimulateQueue handles GET /api/queue/simulate?workers=1,2,3
+// Projects per-job and total completion times for the current queue using
+// historical encode speeds. Defaults to the current worker count.
+func (h *Handler) SimulateQueue(w http.ResponseWriter, r *http.Request) {
+	current := h.workerPool.WorkerCount()
+	workerCounts := []int{current}
+	if param := r.URL.Query().Get("workers"); param != "" {
+		workerCounts = nil
+		for _, part := range strings.Split(param, ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil || n < 1 || n > 6 {
+				writeError(w, http.StatusBadRequest, "workers must be a comma-separated list of values between 1 and 6")
+				return
+			}
+			workerCounts = append(workerCounts, n)
+		}
+	}
+
+	history, simulations := h.queue.Simulate(workerCounts, current)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"current_workers": current,
+		"history":         history,
+		"simulations":     simulations,
+	})
 }
 
 // ClearCache handles POST /api/cache/clear
@@ -788,6 +1701,44 @@ func (h *Handler) ClearCache(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{"status": "cache cleared"})
 }
 
+// CacheStats handles GET /api/cache/stats
+func (h *Handler) CacheStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.browser.CacheStats())
+}
+
+// SetSelfCheck stores the startup self-check report served by /api/selfcheck
+func (h *Handler) SetSelfCheck(report *selfcheck.Report) {
+	h.selfCheck.Store(report)
+}
+
+// SelfCheck handles GET /api/selfcheck?refresh=true
+// Returns the startup report, or re-runs every check when refresh=true.
+func (h *Handler) SelfCheck(w http.ResponseWriter, r *http.Request) {
+	report := h.selfCheck.Load()
+	if report == nil || r.URL.Query().Get("refresh") == "true" {
+		ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+		defer cancel()
+		report = selfcheck.Run(ctx, h.cfg)
+		h.selfCheck.Store(report)
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// Ready handles GET /readyz
+// Readiness probe for orchestrators: runs selfcheck.Ready and returns its
+// report with 200 if nothing failed (warnings are still ready), otherwise 503.
+func (h *Handler) Ready(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	defer cancel()
+
+	report := selfcheck.Ready(ctx, h.cfg)
+	status := http.StatusOK
+	if report.Status == selfcheck.StatusFail {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, report)
+}
+
 // TestPushover handles POST /api/pushover/test
 func (h *Handler) TestPushover(w http.ResponseWriter, r *http.Request) {
 	if !h.pushover.IsConfigured() {
@@ -823,6 +1774,27 @@ func (h *Handler) GetPushover() *pushover.Client {
 	return h.pushover
 }
 
+// applySVTAV1Options regenerates presets with cfg's libsvtav1 settings and
+// tells connected UIs to reload them
+func (h *Handler) applySVTAV1Options(cfg *config.Config) {
+	ffmpeg.SetSVTAV1Options(ffmpeg.SVTAV1Options{
+		Preset:    cfg.SVTAV1Preset,
+		FilmGrain: cfg.SVTAV1FilmGrain,
+		Tune:      cfg.SVTAV1Tune,
+	})
+	ffmpeg.InitPresets()
+	h.queue.Notify("encoders_changed")
+}
+
+// applyVideoExtensions changes which files count as video and re-indexes
+// the media folder to match
+func (h *Handler) applyVideoExtensions(extra, excluded []string) {
+	if ignored := ffmpeg.SetVideoExtensions(extra, excluded); len(ignored) > 0 {
+		apiLog.Warn("Ignoring extra_video_extensions: still image or raw formats", "extensions", strings.Join(ignored, ", "))
+	}
+	h.browser.RefreshIndex()
+}
+
 // ApplyConfig updates runtime configuration from a freshly loaded config.
 func (h *Handler) ApplyConfig(newCfg *config.Config) {
 	if newCfg.Workers != h.cfg.Workers {
@@ -837,10 +1809,75 @@ func (h *Handler) ApplyConfig(newCfg *config.Config) {
 		h.browser.SetMediaRoot(newCfg.MediaPath)
 	}
 
+	if newCfg.ThumbnailCacheMB != h.cfg.ThumbnailCacheMB {
+		h.browser.SetThumbnailCacheSize(int64(newCfg.ThumbnailCacheMB) << 20)
+	}
+
+	if !slices.Equal(newCfg.ExtraVideoExtensions, h.cfg.ExtraVideoExtensions) || !slices.Equal(newCfg.ExcludedVideoExtensions, h.cfg.ExcludedVideoExtensions) {
+		h.applyVideoExtensions(newCfg.ExtraVideoExtensions, newCfg.ExcludedVideoExtensions)
+	}
+
+	if newCfg.SVTAV1Preset != h.cfg.SVTAV1Preset || newCfg.SVTAV1FilmGrain != h.cfg.SVTAV1FilmGrain || newCfg.SVTAV1Tune != h.cfg.SVTAV1Tune {
+		h.applySVTAV1Options(newCfg)
+	}
+
+	if newCfg.AudioCodec != h.cfg.AudioCodec || newCfg.ReencodeAboveBPP != h.cfg.ReencodeAboveBPP {
+		ffmpeg.SetAudioCodec(newCfg.AudioCodec)
+		ffmpeg.SetReencodeAboveBPP(newCfg.ReencodeAboveBPP)
+		ffmpeg.InitPresets()
+		h.queue.Notify("encoders_changed")
+	}
+
+	if !maps.Equal(newCfg.PresetEncoders, h.cfg.PresetEncoders) {
+		ffmpeg.SetPresetEncoders(newCfg.PresetEncoders)
+		ffmpeg.InitPresets()
+		h.queue.Notify("encoders_changed")
+	}
+
+	if newCfg.LogLevel != h.cfg.LogLevel || newCfg.LogFormat != h.cfg.LogFormat || !maps.Equal(newCfg.LogLevels, h.cfg.LogLevels) {
+		logger.Init(newCfg.LogLevel, newCfg.LogFormat, newCfg.LogLevels)
+		h.cfg.LogLevel = newCfg.LogLevel
+		h.cfg.LogFormat = newCfg.LogFormat
+		h.cfg.LogLevels = newCfg.LogLevels
+	}
+
+	if newCfg.LogBufferLines != h.cfg.LogBufferLines {
+		logger.SetBufferSize(newCfg.LogBufferLines)
+		h.cfg.LogBufferLines = newCfg.LogBufferLines
+	}
+
+	if newCfg.ProbeConcurrency != h.cfg.ProbeConcurrency {
+		ffmpeg.SetProbeConcurrency(newCfg.ProbeConcurrency)
+		h.cfg.ProbeConcurrency = newCfg.ProbeConcurrency
+	}
+
+	if newCfg.ProgressEventsPerSecond != h.cfg.ProgressEventsPerSecond {
+		h.queue.SetProgressRate(newCfg.ProgressEventsPerSecond)
+		h.cfg.ProgressEventsPerSecond = newCfg.ProgressEventsPerSecond
+	}
+
 	h.cfg.MediaPath = newCfg.MediaPath
 	h.cfg.TempPath = newCfg.TempPath
 	h.cfg.OriginalHandling = newCfg.OriginalHandling
 	h.cfg.SubtitleHandling = newCfg.SubtitleHandling
+	h.cfg.OutputContainer = newCfg.OutputContainer
+	h.cfg.VerifyOutput = newCfg.VerifyOutput
+	h.cfg.PresetContainers = newCfg.PresetContainers
+	h.cfg.PresetEncoders = newCfg.PresetEncoders
+	h.cfg.PresetDeinterlace = newCfg.PresetDeinterlace
+	h.cfg.PresetThreads = newCfg.PresetThreads
+	h.cfg.PresetMaxEncodeHours = newCfg.PresetMaxEncodeHours
+	h.cfg.PresetAutoQuality = newCfg.PresetAutoQuality
+	h.cfg.SVTAV1Preset = newCfg.SVTAV1Preset
+	h.cfg.SVTAV1FilmGrain = newCfg.SVTAV1FilmGrain
+	h.cfg.SVTAV1Tune = newCfg.SVTAV1Tune
+	h.cfg.AudioCodec = newCfg.AudioCodec
+	h.cfg.ReencodeAboveBPP = newCfg.ReencodeAboveBPP
+	h.cfg.KeepSourceContainer = newCfg.KeepSourceContainer
+	h.cfg.HDRHandling = newCfg.HDRHandling
+	h.cfg.HardlinkHandling = newCfg.HardlinkHandling
+	h.cfg.HardlinkHandlingPaths = newCfg.HardlinkHandlingPaths
+	h.cfg.HardlinkSearchPaths = newCfg.HardlinkSearchPaths
 	h.cfg.Workers = newCfg.Workers
 	h.cfg.FFmpegPath = newCfg.FFmpegPath
 	h.cfg.FFprobePath = newCfg.FFprobePath
@@ -850,19 +1887,62 @@ func (h *Handler) ApplyConfig(newCfg *config.Config) {
 	h.cfg.NtfyTopic = newCfg.NtfyTopic
 	h.cfg.NtfyToken = newCfg.NtfyToken
 	h.cfg.NotifyOnComplete = newCfg.NotifyOnComplete
+	h.cfg.NotifyOnBatchComplete = newCfg.NotifyOnBatchComplete
+	h.cfg.NotifyFailureThreshold = newCfg.NotifyFailureThreshold
 	h.cfg.HideProcessingTmp = newCfg.HideProcessingTmp
+	h.cfg.FingerprintProcessed = newCfg.FingerprintProcessed
+	h.cfg.PreserveOwnership = newCfg.PreserveOwnership
+	h.cfg.PreserveMTime = newCfg.PreserveMTime
 	h.cfg.AllowSoftwareFallback = newCfg.AllowSoftwareFallback
+	h.cfg.MinFreeSpaceMB = newCfg.MinFreeSpaceMB
+	h.cfg.ReserveTempSpace = newCfg.ReserveTempSpace
+	h.cfg.ScanIntervalHours = newCfg.ScanIntervalHours
+	h.cfg.OriginalRetentionDays = newCfg.OriginalRetentionDays
+	h.cfg.TrashOriginals = newCfg.TrashOriginals
+	h.cfg.TrashRetentionDays = newCfg.TrashRetentionDays
+	h.cfg.ShutdownGraceSeconds = newCfg.ShutdownGraceSeconds
+	h.cfg.StallTimeoutMinutes = newCfg.StallTimeoutMinutes
+	h.cfg.StallRetries = newCfg.StallRetries
+	h.cfg.MaxEncodeHours = newCfg.MaxEncodeHours
+	h.cfg.ChunkedSegments = newCfg.ChunkedSegments
+	h.cfg.ChunkedMinMinutes = newCfg.ChunkedMinMinutes
+	h.cfg.MinSavingsPercent = newCfg.MinSavingsPercent
+	h.cfg.PreviewIntervalSeconds = newCfg.PreviewIntervalSeconds
+	h.cfg.ThumbnailCacheMB = newCfg.ThumbnailCacheMB
+	h.cfg.ExtraVideoExtensions = newCfg.ExtraVideoExtensions
+	h.cfg.ExcludedVideoExtensions = newCfg.ExcludedVideoExtensions
+	h.cfg.AutoQuality = newCfg.AutoQuality
+	h.cfg.AutoQualityTargetSSIM = newCfg.AutoQualityTargetSSIM
+	h.cfg.AutoQualityTargetSavings = newCfg.AutoQualityTargetSavings
+	h.cfg.AutoCrop = newCfg.AutoCrop
 	h.cfg.Features = newCfg.Features
+	h.cfg.Rules = newCfg.Rules
+	h.cfg.Integrations = newCfg.Integrations
+	h.cfg.Remote = newCfg.Remote
+	h.cfg.Autoscale = newCfg.Autoscale
+	h.cfg.MountWatch = newCfg.MountWatch
+	h.cfg.Energy = newCfg.Energy
+	h.cfg.FFmpegLimits = newCfg.FFmpegLimits
+	h.cfg.CopySecretSources(newCfg)
 
 	h.pushover.UserKey = newCfg.PushoverUserKey
 	h.pushover.AppToken = newCfg.PushoverAppToken
 	h.ntfy.ServerURL = newCfg.NtfyServer
 	h.ntfy.Topic = newCfg.NtfyTopic
 	h.ntfy.Token = newCfg.NtfyToken
+	if h.arr != nil {
+		h.arr.SetClients(arr.ClientsFromConfig(newCfg.Integrations)...)
+	}
+	if h.mediaServers != nil {
+		h.mediaServers.SetClients(mediaserver.ClientsFromConfig(newCfg.Integrations)...)
+	}
 }
 
 // RetryJob handles POST /api/jobs/:id/retry
 func (h *Handler) RetryJob(w http.ResponseWriter, r *http.Request) {
+	if h.refuseWhileShuttingDown(w) {
+		return
+	}
 	id := r.PathValue("id")
 	if id == "" {
 		writeError(w, http.StatusBadRequest, "job ID required")
@@ -875,7 +1955,7 @@ func (h *Handler) RetryJob(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if job.Status != jobs.StatusFailed {
+	if job.Status != jobs.StatusFailed && job.Status != jobs.StatusVerifyFailed {
 		writeError(w, http.StatusBadRequest, "can only retry failed jobs")
 		return
 	}
@@ -891,7 +1971,11 @@ func (h *Handler) RetryJob(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Add new job with same preset
-	newJob, err := h.queue.Add(job.InputPath, job.PresetID, probe)
+	newJob, err := h.queue.AddWith(jobs.AddOptions{CreatedBy: job.CreatedBy, BatchID: job.BatchID, RetryOf: job, RetriedBy: "retry"}, job.InputPath, job.PresetID, probe)
+	if errors.Is(err, jobs.ErrAlreadyQueued) {
+		writeError(w, http.StatusConflict, "file is already queued")
+		return
+	}
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, fmt.Sprintf("failed to create job: %v", err))
 		return
@@ -899,7 +1983,7 @@ func (h *Handler) RetryJob(w http.ResponseWriter, r *http.Request) {
 
 	// Remove the failed job
 	if _, err := h.queue.Remove(id); err != nil {
-		log.Printf("Failed to remove job %s after retry: %v", id, err)
+		apiLog.Warn("Failed to remove job after retry", "job", id, "error", err)
 	}
 
 	writeJSON(w, http.StatusOK, newJob)
@@ -909,6 +1993,9 @@ func (h *Handler) RetryJob(w http.ResponseWriter, r *http.Request) {
 // This resets a skipped or no_gain job to pending with ForceTranscode enabled,
 // bypassing skip checks and size comparison.
 func (h *Handler) ForceRetryJob(w http.ResponseWriter, r *http.Request) {
+	if h.refuseWhileShuttingDown(w) {
+		return
+	}
 	id := r.PathValue("id")
 	if id == "" {
 		writeError(w, http.StatusBadRequest, "job ID required")
@@ -944,6 +2031,9 @@ type RetryWithPresetRequest struct {
 // RetryWithPreset handles POST /api/jobs/:id/retry-preset
 // This creates a new job with a different preset for skipped or no_gain jobs.
 func (h *Handler) RetryWithPreset(w http.ResponseWriter, r *http.Request) {
+	if h.refuseWhileShuttingDown(w) {
+		return
+	}
 	id := r.PathValue("id")
 	if id == "" {
 		writeError(w, http.StatusBadRequest, "job ID required")
@@ -990,7 +2080,11 @@ func (h *Handler) RetryWithPreset(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Add new job with new preset
-	newJob, err := h.queue.Add(job.InputPath, req.PresetID, probe)
+	newJob, err := h.queue.AddWith(jobs.AddOptions{CreatedBy: job.CreatedBy, BatchID: job.BatchID, RetryOf: job, RetriedBy: "retry_preset"}, job.InputPath, req.PresetID, probe)
+	if errors.Is(err, jobs.ErrAlreadyQueued) {
+		writeError(w, http.StatusConflict, "file is already queued")
+		return
+	}
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, fmt.Sprintf("failed to create job: %v", err))
 		return
@@ -998,7 +2092,7 @@ func (h *Handler) RetryWithPreset(w http.ResponseWriter, r *http.Request) {
 
 	// Remove the old job
 	if _, err := h.queue.Remove(id); err != nil {
-		log.Printf("Failed to remove job %s after retry with preset: %v", id, err)
+		apiLog.Warn("Failed to remove job after retry with preset", "job", id, "error", err)
 	}
 
 	writeJSON(w, http.StatusOK, newJob)
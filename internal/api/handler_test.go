@@ -1,21 +1,31 @@
 package api
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/gwlsn/shrinkray/internal/auth"
+	"github.com/gwlsn/shrinkray/internal/auth/header"
 	"github.com/gwlsn/shrinkray/internal/browse"
 	"github.com/gwlsn/shrinkray/internal/config"
 	"github.com/gwlsn/shrinkray/internal/ffmpeg"
 	"github.com/gwlsn/shrinkray/internal/jobs"
+	"github.com/gwlsn/shrinkray/internal/logger"
 )
 
 func setupTestHandler(t *testing.T) (*Handler, string) {
@@ -126,8 +136,8 @@ func TestPresetsEndpoint(t *testing.T) {
 		t.Fatalf("failed to parse response: %v", err)
 	}
 
-	if len(presets) != 4 {
-		t.Errorf("expected 4 presets, got %d", len(presets))
+	if len(presets) != 6 {
+		t.Errorf("expected 6 presets, got %d", len(presets))
 	}
 
 	t.Logf("Presets: %v", presets)
@@ -155,6 +165,91 @@ func TestJobsEndpoint(t *testing.T) {
 	}
 }
 
+func TestJobsEndpointPagination(t *testing.T) {
+	handler, tmpDir := setupTestHandler(t)
+	for i := 0; i < 5; i++ {
+		path := filepath.Join(tmpDir, fmt.Sprintf("movie%d.mkv", i))
+		if _, err := handler.queue.Add(path, "compress-hevc", &ffmpeg.ProbeResult{Path: path, Size: int64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/api/jobs?sort=-size&page=2&page_size=2", nil)
+	w := httptest.NewRecorder()
+	handler.ListJobs(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Jobs  []*jobs.Job `json:"jobs"`
+		Total int         `json:"total"`
+		Page  int         `json:"page"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if resp.Total != 5 || resp.Page != 2 || len(resp.Jobs) != 2 || resp.Jobs[0].InputSize != 2 {
+		t.Errorf("unexpected page: total=%d page=%d jobs=%d", resp.Total, resp.Page, len(resp.Jobs))
+	}
+
+	req = httptest.NewRequest("GET", "/api/jobs?sort=bogus", nil)
+	w = httptest.NewRecorder()
+	handler.ListJobs(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for unknown sort, got %d", w.Code)
+	}
+}
+
+func TestJobsEndpointETagAndGzip(t *testing.T) {
+	handler, tmpDir := setupTestHandler(t)
+	for i := 0; i < 10; i++ {
+		path := filepath.Join(tmpDir, fmt.Sprintf("movie%d.mkv", i))
+		handler.queue.Add(path, "compress-hevc", &ffmpeg.ProbeResult{Path: path, Size: 1000})
+	}
+	router := NewRouterWithoutStatic(handler, nil)
+
+	req := httptest.NewRequest("GET", "/api/jobs", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatal("expected a gzipped response")
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp map[string]interface{}
+	if err := json.NewDecoder(zr).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode gzipped body: %v", err)
+	}
+
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("expected an ETag")
+	}
+	req = httptest.NewRequest("GET", "/api/jobs", nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("expected empty 304, got %d with %d bytes", w.Code, w.Body.Len())
+	}
+
+	// Any change to the queue changes the tag
+	path := filepath.Join(tmpDir, "new.mkv")
+	handler.queue.Add(path, "compress-hevc", &ffmpeg.ProbeResult{Path: path, Size: 1000})
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Errorf("expected a fresh response after the queue changed, got %d", w.Code)
+	}
+}
+
 func TestCreateJobsEndpoint(t *testing.T) {
 	handler, tmpDir := setupTestHandler(t)
 
@@ -305,9 +400,846 @@ func TestJobStreamEndpoint(t *testing.T) {
 	t.Logf("SSE response: %s", w.Body.String()[:min(200, len(w.Body.String()))])
 }
 
+func TestJobSocketEndpoint(t *testing.T) {
+	handler, tmpDir := setupTestHandler(t)
+	server := httptest.NewServer(http.HandlerFunc(handler.JobSocket))
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// Handshake using the sample key from RFC 6455
+	fmt.Fprintf(conn, "GET /api/jobs/ws?events=cancelled HTTP/1.1\r\nHost: test\r\n"+
+		"Upgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("expected 101, got %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("unexpected accept key %q", got)
+	}
+
+	readEvent := func() map[string]interface{} {
+		t.Helper()
+		var head [2]byte
+		if _, err := io.ReadFull(br, head[:]); err != nil {
+			t.Fatal(err)
+		}
+		length := int(head[1] & 0x7F)
+		if length == 126 {
+			var ext [2]byte
+			io.ReadFull(br, ext[:])
+			length = int(ext[0])<<8 | int(ext[1])
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(br, payload); err != nil {
+			t.Fatal(err)
+		}
+		var msg map[string]interface{}
+		if err := json.Unmarshal(payload, &msg); err != nil {
+			t.Fatalf("bad frame %q: %v", payload, err)
+		}
+		return msg
+	}
+
+	if msg := readEvent(); msg["type"] != "init" {
+		t.Fatalf("expected init message, got %v", msg)
+	}
+
+	// The "added" event is filtered out; only the cancellation arrives
+	path := filepath.Join(tmpDir, "movie.mkv")
+	job, err := handler.queue.Add(path, "compress", &ffmpeg.ProbeResult{Path: path, Size: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler.queue.CancelJob(job.ID)
+	if msg := readEvent(); msg["type"] != "cancelled" {
+		t.Errorf("expected cancelled event, got %v", msg)
+	}
+}
+
+func TestJobSocketRefusesCrossOrigin(t *testing.T) {
+	handler, _ := setupTestHandler(t)
+	handler.cfg.Access.AllowedOrigins = []string{"https://media.example.com/"}
+
+	for _, tc := range []struct {
+		origin  string
+		refused bool
+	}{
+		{"http://evil.example", true},
+		{"null", true},
+		{"http://test", false},
+		{"https://media.example.com", false},
+		{"", false},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "http://test/api/jobs/ws", nil)
+		req.Header.Set("Upgrade", "websocket")
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		req.Header.Set("Sec-WebSocket-Version", "13")
+		if tc.origin != "" {
+			req.Header.Set("Origin", tc.origin)
+		}
+		rec := httptest.NewRecorder()
+		handler.JobSocket(rec, req)
+
+		// The recorder can't be hijacked, so an accepted origin gets as far as 400
+		if refused := rec.Code == http.StatusForbidden; refused != tc.refused {
+			t.Errorf("origin %q: expected refused=%v, got status %d", tc.origin, tc.refused, rec.Code)
+		}
+	}
+}
+
+// clientFrame builds a masked client frame with a payload of up to 64KB
+func clientFrame(fin bool, opcode byte, payload []byte) []byte {
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	frame := []byte{first}
+	if len(payload) < 126 {
+		frame = append(frame, 0x80|byte(len(payload)))
+	} else {
+		frame = append(frame, 0x80|126, byte(len(payload)>>8), byte(len(payload)))
+	}
+	mask := []byte{0x12, 0x34, 0x56, 0x78}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	return frame
+}
+
+func TestWebSocketFraming(t *testing.T) {
+	unmasked := clientFrame(true, wsOpText, []byte("hi"))
+	unmasked[1] &^= 0x80
+
+	tests := []struct {
+		name   string
+		frames [][]byte
+		want   string // Reassembled message, or "" if the connection must fail
+	}{
+		{"single frame", [][]byte{clientFrame(true, wsOpText, []byte("hello"))}, "hello"},
+		{"fragmented with ping", [][]byte{
+			clientFrame(false, wsOpText, []byte("hel")),
+			clientFrame(true, wsOpPing, []byte("p")),
+			clientFrame(false, wsOpContinuation, []byte("l")),
+			clientFrame(true, wsOpContinuation, []byte("o")),
+		}, "hello"},
+		{"fragmented ping", [][]byte{clientFrame(false, wsOpPing, nil)}, ""},
+		{"oversized ping", [][]byte{clientFrame(true, wsOpPing, make([]byte, 126))}, ""},
+		{"fragmented close", [][]byte{clientFrame(false, wsOpClose, nil)}, ""},
+		{"stray continuation", [][]byte{clientFrame(true, wsOpContinuation, []byte("x"))}, ""},
+		{"new message mid-fragment", [][]byte{
+			clientFrame(false, wsOpText, []byte("a")),
+			clientFrame(true, wsOpText, []byte("b")),
+		}, ""},
+		{"reserved bits", [][]byte{append([]byte{0x80 | 0x40 | wsOpText}, clientFrame(true, wsOpText, []byte("x"))[1:]...)}, ""},
+		{"unmasked", [][]byte{unmasked}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := net.Pipe()
+			defer server.Close()
+			defer client.Close()
+			client.SetDeadline(time.Now().Add(5 * time.Second))
+			server.SetDeadline(time.Now().Add(5 * time.Second))
+
+			// Drain pongs so the server never blocks on the pipe
+			go io.Copy(io.Discard, client)
+			go func() {
+				for _, frame := range tt.frames {
+					if _, err := client.Write(frame); err != nil {
+						return
+					}
+				}
+			}()
+
+			conn := &wsConn{conn: server, br: bufio.NewReader(server)}
+			message, err := conn.readMessage()
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("expected the frames to be rejected, got %q", message)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(message) != tt.want {
+				t.Errorf("message = %q, want %q", message, tt.want)
+			}
+		})
+	}
+}
+
 func min(a, b int) int {
 	if a < b {
 		return a
 	}
 	return b
 }
+
+func TestRunRuleEndpoint(t *testing.T) {
+	handler, _ := setupTestHandler(t)
+	handler.cfg.Rules = []config.Rule{
+		{ID: "tv", Path: "TV Shows", Preset: "compress-hevc", MinBitrateMbps: 15},
+		{ID: "bad-preset", Path: "TV Shows", Preset: "nope"},
+	}
+	router := NewRouterWithoutStatic(handler, nil)
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/api/rules/missing/run", http.StatusNotFound},
+		{"/api/rules/bad-preset/run", http.StatusBadRequest},
+		{"/api/rules/tv/run?dry_run=true", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", tt.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d: %s", tt.path, tt.want, w.Code, w.Body.String())
+		}
+	}
+
+	// Fake files can't be probed, so nothing matches and nothing is queued
+	req := httptest.NewRequest("POST", "/api/rules/tv/run", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var result map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if result["queued"] != float64(0) {
+		t.Errorf("expected nothing queued, got %v", result["queued"])
+	}
+	if stats := handler.queue.Stats(); stats.Total != 0 {
+		t.Errorf("expected empty queue, got %d jobs", stats.Total)
+	}
+}
+
+func TestShutdownRefusesNewJobs(t *testing.T) {
+	handler, tmpDir := setupTestHandler(t)
+	handler.cfg.Rules = []config.Rule{{ID: "tv", Path: "TV Shows", Preset: "compress-hevc"}}
+	router := NewRouterWithoutStatic(handler, nil)
+
+	input := filepath.Join(tmpDir, "TV Shows", "Test Show", "Season 1", "episode1.mkv")
+	job, _ := handler.queue.Add(input, "compress-hevc", &ffmpeg.ProbeResult{Path: input, Size: 10, Duration: time.Minute})
+	handler.queue.StartJob(job.ID, "/tmp/temp.mkv", "cpu→cpu")
+	handler.queue.FailJob(job.ID, "boom")
+	handler.BeginShutdown()
+
+	tests := []struct {
+		path string
+		body string
+		want int
+	}{
+		{"/api/jobs", `{"paths": ["TV Shows"], "preset_id": "compress-hevc"}`, http.StatusServiceUnavailable},
+		{"/api/rules/tv/run", "", http.StatusServiceUnavailable},
+		{"/api/rules/tv/run?dry_run=true", "", http.StatusOK},
+		{"/api/jobs/" + job.ID + "/retry", "", http.StatusServiceUnavailable},
+		{"/api/jobs/" + job.ID + "/force", "", http.StatusServiceUnavailable},
+		{"/api/jobs/" + job.ID + "/retry-preset", `{"preset_id": "compress-av1"}`, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d: %s", tt.path, tt.want, w.Code, w.Body.String())
+		}
+	}
+	if stats := handler.queue.Stats(); stats.Total != 1 {
+		t.Errorf("expected no new jobs during shutdown, got %d", stats.Total)
+	}
+}
+
+func TestJobPreviewEndpoint(t *testing.T) {
+	handler, tmpDir := setupTestHandler(t)
+	handler.cfg.PreviewIntervalSeconds = 60
+
+	// Stand-in ffmpeg that counts its runs and writes a fake JPEG
+	calls := filepath.Join(tmpDir, "calls")
+	fakeFFmpeg := filepath.Join(tmpDir, "ffmpeg")
+	script := fmt.Sprintf("#!/bin/sh\necho run >> %q\nprintf 'JPEG'\n", calls)
+	if err := os.WriteFile(fakeFFmpeg, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	handler.cfg.FFmpegPath = fakeFFmpeg
+
+	input := filepath.Join(tmpDir, "movie.mkv")
+	job, _ := handler.queue.Add(input, "compress-hevc", &ffmpeg.ProbeResult{Path: input, Size: 1000, Duration: time.Minute})
+	router := NewRouterWithoutStatic(handler, nil)
+
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/api/jobs/"+job.ID+"/preview", nil))
+		return w
+	}
+
+	if w := get(); w.Code != http.StatusConflict {
+		t.Errorf("expected 409 for a pending job, got %d", w.Code)
+	}
+
+	handler.queue.StartJob(job.ID, filepath.Join(tmpDir, "movie.shrinkray.tmp.mkv"), "cpu→cpu")
+	for i := 0; i < 2; i++ {
+		w := get()
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/jpeg" || w.Body.String() != "JPEG" {
+			t.Fatalf("expected the preview frame, got %d %q", w.Code, w.Body.String())
+		}
+	}
+	data, _ := os.ReadFile(calls)
+	if runs := strings.Count(string(data), "run"); runs != 1 {
+		t.Errorf("expected one ffmpeg run within the interval, got %d", runs)
+	}
+}
+
+func TestTestPresetEndpoint(t *testing.T) {
+	handler, tmpDir := setupTestHandler(t)
+	router := NewRouterWithoutStatic(handler, nil)
+	episode := filepath.Join(tmpDir, "TV Shows", "Test Show", "Season 1", "episode1.mkv")
+
+	tests := []struct {
+		name   string
+		preset string
+		body   string
+		want   int
+	}{
+		{"unknown preset", "nope", fmt.Sprintf(`{"path":%q}`, episode), http.StatusNotFound},
+		{"outside the media root", "compress-hevc", `{"path":"/etc/passwd"}`, http.StatusBadRequest},
+		{"not a video", "compress-hevc", fmt.Sprintf(`{"path":%q}`, filepath.Join(tmpDir, "notes.txt")), http.StatusBadRequest},
+		{"clip too long", "compress-hevc", fmt.Sprintf(`{"path":%q,"duration_seconds":600}`, episode), http.StatusBadRequest},
+		{"negative start", "compress-hevc", fmt.Sprintf(`{"path":%q,"start_seconds":-1}`, episode), http.StatusBadRequest},
+		// Fake files can't be probed
+		{"unprobeable file", "compress-hevc", fmt.Sprintf(`{"path":%q}`, episode), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/api/presets/"+tt.preset+"/test", strings.NewReader(tt.body)))
+		if w.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d: %s", tt.name, tt.want, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestConfigValidateAndReload(t *testing.T) {
+	handler, tmpDir := setupTestHandler(t)
+	router := NewRouterWithoutStatic(handler, nil)
+	post := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", path, nil))
+		return w
+	}
+
+	if w := post("/api/config/reload"); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 without a config loader, got %d", w.Code)
+	}
+
+	// The edited file points at a media path that isn't mounted
+	handler.SetConfigLoader(func() (*config.Config, error) {
+		cfg := config.DefaultConfig()
+		cfg.MediaPath = filepath.Join(tmpDir, "missing")
+		cfg.Workers = 4
+		return cfg, nil
+	})
+
+	w := post("/api/config/validate")
+	var validation struct {
+		Valid  bool `json:"valid"`
+		Report struct {
+			Checks []struct {
+				Name   string `json:"name"`
+				Status string `json:"status"`
+			} `json:"checks"`
+		} `json:"report"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &validation); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("validate: %d %s", w.Code, w.Body.String())
+	}
+	if validation.Valid {
+		t.Error("expected a missing media path to fail validation")
+	}
+	for _, check := range validation.Report.Checks {
+		if check.Name == "media_path" && check.Status != "fail" {
+			t.Errorf("media_path check = %s, want fail", check.Status)
+		}
+	}
+
+	if w := post("/api/config/reload"); w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for a failing config, got %d", w.Code)
+	}
+	if handler.cfg.Workers != 1 || handler.cfg.MediaPath != tmpDir {
+		t.Errorf("failing config was applied: workers=%d media=%s", handler.cfg.Workers, handler.cfg.MediaPath)
+	}
+
+	handler.SetConfigLoader(func() (*config.Config, error) {
+		return nil, fmt.Errorf("yaml: line 3: mapping values are not allowed here")
+	})
+	if w := post("/api/config/validate"); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422 for an unreadable config, got %d", w.Code)
+	}
+}
+
+func TestConfigRedactsSecrets(t *testing.T) {
+	handler, tmpDir := setupTestHandler(t)
+	router := NewRouterWithoutStatic(handler, nil)
+
+	configPath := filepath.Join(tmpDir, "shrinkray.yaml")
+	if err := os.WriteFile(configPath, []byte("ntfy_token: env:TEST_NTFY_TOKEN\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_NTFY_TOKEN", "secret-ntfy-token")
+	loaded, err := config.Load(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler.cfg.NtfyToken = loaded.NtfyToken
+	handler.cfg.CopySecretSources(loaded)
+	handler.cfg.PushoverAppToken = "secret-app-token"
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/config", nil))
+	body := w.Body.String()
+	for _, secret := range []string{"secret-ntfy-token", "secret-app-token"} {
+		if strings.Contains(body, secret) {
+			t.Errorf("GET /api/config returned %q", secret)
+		}
+	}
+	var cfg struct {
+		PushoverAppTokenSet bool     `json:"pushover_app_token_set"`
+		PushoverUserKeySet  bool     `json:"pushover_user_key_set"`
+		NtfyTokenSet        bool     `json:"ntfy_token_set"`
+		ManagedSecrets      []string `json:"managed_secrets"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.PushoverAppTokenSet || cfg.PushoverUserKeySet || !cfg.NtfyTokenSet {
+		t.Errorf("unexpected *_set flags: %+v", cfg)
+	}
+	if len(cfg.ManagedSecrets) != 1 || cfg.ManagedSecrets[0] != "ntfy_token" {
+		t.Errorf("managed_secrets = %v, want [ntfy_token]", cfg.ManagedSecrets)
+	}
+
+	// Credentials from the environment can't be changed through the API
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("PUT", "/api/config", strings.NewReader(`{"ntfy_token":"other"}`)))
+	if w.Code != http.StatusBadRequest || handler.cfg.NtfyToken != "secret-ntfy-token" {
+		t.Errorf("expected 400 and no change, got %d (token %q)", w.Code, handler.cfg.NtfyToken)
+	}
+}
+
+func TestLogLevelToggle(t *testing.T) {
+	handler, _ := setupTestHandler(t)
+	router := NewRouterWithoutStatic(handler, nil)
+	t.Cleanup(func() {
+		logger.SetLevel("info")
+		logger.SetModuleLevel("queue", "")
+	})
+	put := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("PUT", "/api/logs/level", strings.NewReader(body)))
+		return w
+	}
+	var levels struct {
+		Level   string            `json:"level"`
+		Modules map[string]string `json:"modules"`
+	}
+
+	if w := put(`{"module":"queue","level":"debug"}`); w.Code != http.StatusOK {
+		t.Fatalf("set module level: %d %s", w.Code, w.Body.String())
+	}
+	if w := put(`{"level":"warn"}`); w.Code != http.StatusOK {
+		t.Fatalf("set default level: %d %s", w.Code, w.Body.String())
+	}
+	if w := put(`{"level":"loud"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown level, got %d", w.Code)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/logs/level", nil))
+	if err := json.Unmarshal(w.Body.Bytes(), &levels); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if levels.Level != "warn" || levels.Modules["queue"] != "debug" {
+		t.Errorf("levels = %s %v, want warn with queue=debug", levels.Level, levels.Modules)
+	}
+
+	// An empty level puts the module back on the default
+	w = put(`{"module":"queue","level":""}`)
+	levels.Modules = nil
+	json.Unmarshal(w.Body.Bytes(), &levels)
+	if _, ok := levels.Modules["queue"]; ok {
+		t.Errorf("expected queue override to be removed, got %v", levels.Modules)
+	}
+}
+
+func TestGetLogs(t *testing.T) {
+	handler, _ := setupTestHandler(t)
+	router := NewRouterWithoutStatic(handler, nil)
+	get := func(query string) (lines []logger.Entry, next uint64) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/api/logs?module=logtest&"+query, nil))
+		var resp struct {
+			Lines []logger.Entry `json:"lines"`
+			Next  uint64         `json:"next"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("GET /api/logs?%s: %d %s", query, w.Code, w.Body.String())
+		}
+		return resp.Lines, resp.Next
+	}
+
+	log := logger.For("logtest")
+	log.Info("Starting job", "job_id", "abc")
+	log.Warn("Job stalled", "job_id", "abc")
+
+	lines, next := get("")
+	if len(lines) != 2 || lines[0].Message != "Starting job" || lines[0].Attrs["job_id"] != "abc" {
+		t.Fatalf("lines = %+v", lines)
+	}
+	if lines, _ := get("level=warn"); len(lines) != 1 || lines[0].Level != "warn" {
+		t.Errorf("level=warn lines = %+v", lines)
+	}
+
+	log.Info("Job complete")
+	if lines, _ := get(fmt.Sprintf("since=%d", next)); len(lines) != 1 || lines[0].Message != "Job complete" {
+		t.Errorf("since=%d lines = %+v", next, lines)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/logs?level=loud", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown level, got %d", w.Code)
+	}
+}
+
+func TestSessionRevocation(t *testing.T) {
+	handler, tmpDir := setupTestHandler(t)
+	handler.cfg.Auth.AdminUsers = []string{"admin"}
+	provider, err := header.NewProvider([]string{"192.0.2.0/24"}, "", "", nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := NewRouterWithoutStatic(handler, auth.NewMiddleware(provider, nil))
+	do := func(user, method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Remote-User", user)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	listed := func(user string) int {
+		var result struct {
+			Count int `json:"count"`
+		}
+		json.Unmarshal(do(user, "GET", "/api/auth/sessions").Body.Bytes(), &result)
+		return result.Count
+	}
+
+	if w := do("alice", "GET", "/api/auth/sessions"); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 without a session store, got %d", w.Code)
+	}
+
+	storePath := filepath.Join(tmpDir, "sessions.json")
+	store, err := auth.NewSessionStore(storePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler.SetSessionStore(store)
+	login := httptest.NewRequest("POST", "/auth/login", nil)
+	expires := time.Now().Add(time.Hour)
+	laptop, _ := store.Create(&auth.User{ID: "alice"}, "password", expires, login)
+	store.Create(&auth.User{ID: "alice"}, "password", expires, login)
+	bobs, _ := store.Create(&auth.User{ID: "bob"}, "password", expires, login)
+
+	// Users see their own sessions, admins everyone's
+	if n := listed("alice"); n != 2 {
+		t.Errorf("expected alice to see her 2 sessions, got %d", n)
+	}
+	if n := listed("admin"); n != 3 {
+		t.Errorf("expected admin to see all 3 sessions, got %d", n)
+	}
+
+	if w := do("alice", "DELETE", "/api/auth/sessions/"+bobs.ID); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 revoking another user's session, got %d", w.Code)
+	}
+	if !store.Valid(bobs.ID) {
+		t.Error("expected bob's session to be untouched")
+	}
+	if w := do("alice", "DELETE", "/api/auth/sessions/"+laptop.ID); w.Code != http.StatusOK {
+		t.Fatalf("revoke: %d %s", w.Code, w.Body.String())
+	}
+	if store.Valid(laptop.ID) {
+		t.Error("expected the revoked session to be invalid")
+	}
+	if w := do("alice", "DELETE", "/api/auth/sessions/"+laptop.ID); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 revoking twice, got %d", w.Code)
+	}
+
+	w := do("alice", "POST", "/api/auth/sessions/revoke-all")
+	var revoked struct {
+		Revoked int `json:"revoked"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &revoked)
+	if revoked.Revoked != 1 {
+		t.Errorf("expected 1 session revoked, got %s", w.Body.String())
+	}
+	if w := do("admin", "DELETE", "/api/auth/sessions/"+bobs.ID); w.Code != http.StatusOK {
+		t.Errorf("expected an admin to revoke bob's session, got %d", w.Code)
+	}
+
+	// Without a logged-in user nothing is revoked
+	direct := httptest.NewRecorder()
+	handler.RevokeAllSessions(direct, httptest.NewRequest("POST", "/api/auth/sessions/revoke-all", nil))
+	if direct.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 revoking all without a user, got %d", direct.Code)
+	}
+
+	// Revocations are persisted
+	reloaded, err := auth.NewSessionStore(storePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sessions := reloaded.List(); len(sessions) != 0 {
+		t.Errorf("expected no sessions after reload, got %d", len(sessions))
+	}
+}
+
+func TestJobVisibilityOwn(t *testing.T) {
+	handler, _ := setupTestHandler(t)
+	handler.cfg.Auth.JobVisibility = "own"
+	handler.cfg.Auth.AdminUsers = []string{"admin"}
+	provider, err := header.NewProvider([]string{"192.0.2.0/24"}, "", "", nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := NewRouterWithoutStatic(handler, auth.NewMiddleware(provider, nil))
+	do := func(user, method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Remote-User", user)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	listed := func(user string) int {
+		var result struct {
+			Jobs []*jobs.Job `json:"jobs"`
+		}
+		json.Unmarshal(do(user, "GET", "/api/jobs").Body.Bytes(), &result)
+		return len(result.Jobs)
+	}
+
+	aliceJob, _ := handler.queue.AddWith(jobs.AddOptions{CreatedBy: "alice"}, "/media/a.mkv", "compress-hevc", &ffmpeg.ProbeResult{Path: "/media/a.mkv", Size: 1000})
+	bobJob, _ := handler.queue.AddWith(jobs.AddOptions{CreatedBy: "bob"}, "/media/b.mkv", "compress-hevc", &ffmpeg.ProbeResult{Path: "/media/b.mkv", Size: 1000})
+
+	if n := listed("alice"); n != 1 {
+		t.Errorf("expected alice to see 1 job, got %d", n)
+	}
+	if n := listed("admin"); n != 2 {
+		t.Errorf("expected admin to see 2 jobs, got %d", n)
+	}
+	if w := do("alice", "GET", "/api/jobs/"+aliceJob.ID); w.Code != http.StatusOK {
+		t.Errorf("expected alice to get her job, got %d", w.Code)
+	}
+	if w := do("alice", "DELETE", "/api/jobs/"+bobJob.ID); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 cancelling another user's job, got %d", w.Code)
+	}
+	if handler.queue.Get(bobJob.ID).Status != jobs.StatusPending {
+		t.Error("expected bob's job to be untouched")
+	}
+	if w := do("alice", "POST", "/api/jobs/clear"); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 clearing the queue, got %d", w.Code)
+	}
+
+	handler.cfg.Auth.JobVisibility = "all"
+	if n := listed("alice"); n != 2 {
+		t.Errorf("expected every job visible with job_visibility all, got %d", n)
+	}
+}
+
+func TestQueueNotifications(t *testing.T) {
+	handler, _ := setupTestHandler(t)
+	titles := make(chan string, 10)
+	ntfyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		titles <- r.Header.Get("Title")
+	}))
+	defer ntfyServer.Close()
+	handler.ntfy.ServerURL = ntfyServer.URL
+	handler.ntfy.Topic = "shrinkray"
+	handler.cfg.NotifyOnComplete = true
+	handler.cfg.NotifyOnBatchComplete = true
+	handler.cfg.NotifyFailureThreshold = 2
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handler.WatchNotifications(ctx)
+
+	batch := handler.queue.CreateBatch([]string{"/media/Season 1"}, "compress-hevc", "")
+	added, _ := handler.queue.AddMultipleWith(jobs.AddOptions{BatchID: batch.ID}, []*ffmpeg.ProbeResult{
+		{Path: "/media/Season 1/e1.mkv", Size: 1000},
+		{Path: "/media/Season 1/e2.mkv", Size: 1000},
+		{Path: "/media/Season 1/e3.mkv", Size: 1000},
+	}, "compress-hevc")
+	if len(added) != 3 {
+		t.Fatalf("expected 3 jobs, got %d", len(added))
+	}
+
+	expect := func(want string) {
+		t.Helper()
+		select {
+		case title := <-titles:
+			if title != want {
+				t.Fatalf("expected %q notification, got %q", want, title)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("expected %q notification", want)
+		}
+	}
+
+	handler.queue.FailJob(added[0].ID, "encoder crashed")
+	handler.queue.FailJob(added[1].ID, "encoder crashed")
+	expect("Shrinkray Failures")
+
+	events := handler.queue.Subscribe()
+	defer handler.queue.Unsubscribe(events)
+	handler.queue.StartJob(added[2].ID, "/tmp/e3.tmp", "cpu→cpu")
+	handler.queue.CompleteJob(added[2].ID, "/media/Season 1/e3.out.mkv", 400)
+
+	// Neither the batch nor the queue is done while files are still being added
+	select {
+	case title := <-titles:
+		t.Fatalf("unexpected %q notification before the batch finished adding", title)
+	case <-time.After(200 * time.Millisecond):
+	}
+	handler.queue.FinishBatch(batch.ID)
+	expect("Shrinkray Batch Complete")
+	expect("Shrinkray Complete")
+
+	// The UI is told, so it can uncheck "Notify when done"
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case event := <-events:
+			if event.Type == "notify_sent" {
+				return
+			}
+		case <-timeout:
+			t.Fatal("expected a notify_sent event")
+		}
+	}
+}
+
+func TestNotifyWatcherResync(t *testing.T) {
+	handler, _ := setupTestHandler(t)
+	handler.ntfy.ServerURL = "http://ntfy.invalid"
+	handler.ntfy.Topic = "shrinkray"
+	handler.cfg.NotifyOnComplete = true
+	handler.cfg.NotifyOnBatchComplete = true
+	watcher := &notifyWatcher{h: handler, notifiedBatches: make(map[string]bool), sends: make(chan func(), notifyBacklog)}
+
+	batch := handler.queue.CreateBatch([]string{"/media/Season 1"}, "compress-hevc", "")
+	added, _ := handler.queue.AddMultipleWith(jobs.AddOptions{BatchID: batch.ID}, []*ffmpeg.ProbeResult{
+		{Path: "/media/Season 1/e1.mkv", Size: 1000},
+	}, "compress-hevc")
+	handler.queue.FinishBatch(batch.ID)
+	handler.queue.StartJob(added[0].ID, "/tmp/e1.tmp", "cpu→cpu")
+	handler.queue.CompleteJob(added[0].ID, "/media/Season 1/e1.out.mkv", 400)
+
+	// The events above were missed; a resync catches up from the queue
+	watcher.handle(jobs.JobEvent{Type: jobs.EventResync})
+	if len(watcher.sends) != 2 || !watcher.notifiedBatches[batch.ID] {
+		t.Fatalf("expected the batch and queue notifications queued, got %d", len(watcher.sends))
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	handler, _ := setupTestHandler(t)
+	router := NewRouterWithoutStatic(handler, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/openapi.json", nil))
+	var doc struct {
+		OpenAPI    string                               `json:"openapi"`
+		Paths      map[string]map[string]map[string]any `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]map[string]any `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("GET /api/openapi.json: %d %v", w.Code, err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Errorf("openapi = %q", doc.OpenAPI)
+	}
+
+	// Every route registered in the router is documented
+	source, err := os.ReadFile("router.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	routes := regexp.MustCompile(`mux\.Handle\("([A-Z]+) (/[^"]*)"`).FindAllStringSubmatch(string(source), -1)
+	if len(routes) == 0 {
+		t.Fatal("no routes found in router.go")
+	}
+	for _, route := range routes {
+		method, path := strings.ToLower(route[1]), route[2]
+		if path == "/" || path == "/logo.png" || path == "/favicon.png" {
+			continue
+		}
+		if _, ok := doc.Paths[path][method]; !ok {
+			t.Errorf("%s %s is missing from the OpenAPI document", route[1], path)
+		}
+	}
+
+	for _, name := range []string{"Job", "Stats", "Preset", "Error"} {
+		if _, ok := doc.Components.Schemas[name]; !ok {
+			t.Errorf("components are missing %s", name)
+		}
+	}
+	job := doc.Components.Schemas["Job"].Properties
+	if job["input_path"]["type"] != "string" || job["created_at"]["format"] != "date-time" {
+		t.Errorf("Job schema doesn't follow its JSON encoding: %v", job)
+	}
+	if _, ok := doc.Components.Schemas["StatsResponse"].Properties["pending"]; !ok {
+		t.Error("embedded Stats fields should be inlined into StatsResponse")
+	}
+	list := doc.Paths["/api/jobs"]["get"]["responses"].(map[string]any)["200"]
+	if !strings.Contains(fmt.Sprint(list), "#/components/schemas/Job") {
+		t.Errorf("GET /api/jobs response doesn't reference Job: %v", list)
+	}
+}
+
+func TestWithBasePath(t *testing.T) {
+	handler, _ := setupTestHandler(t)
+	server := WithBasePath(NewRouterWithoutStatic(handler, nil), "/shrinkray")
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	if w := get("/shrinkray/api/jobs"); w.Code != http.StatusOK {
+		t.Errorf("GET /shrinkray/api/jobs = %d, want 200", w.Code)
+	}
+	if w := get("/api/jobs"); w.Code != http.StatusNotFound {
+		t.Errorf("GET /api/jobs outside the base path = %d, want 404", w.Code)
+	}
+	if w := get("/shrinkray"); w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/shrinkray/" {
+		t.Errorf("GET /shrinkray = %d to %q, want a redirect to /shrinkray/", w.Code, w.Header().Get("Location"))
+	}
+	if w := get("/healthz"); w.Code != http.StatusOK {
+		t.Errorf("GET /healthz = %d, want 200 at the root for health checks", w.Code)
+	}
+}
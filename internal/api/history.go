@@ -0,0 +1,60 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gwlsn/shrinkray/internal/jobs"
+)
+
+// maxHistoryDays bounds GET /api/stats/history?days=
+const maxHistoryDays = 3650
+
+// SetHistory enables GET /api/stats/history
+func (h *Handler) SetHistory(history *jobs.History) {
+	h.history = history
+}
+
+// StatsHistory handles GET /api/stats/history?days=30
+// Returns one aggregate per day (oldest first, empty days included) plus
+// totals over the range, for charting savings over time.
+func (h *Handler) StatsHistory(w http.ResponseWriter, r *http.Request) {
+	if h.history == nil {
+		writeError(w, http.StatusServiceUnavailable, "stats history is not available")
+		return
+	}
+
+	days := 30
+	if param := r.URL.Query().Get("days"); param != "" {
+		n, err := strconv.Atoi(param)
+		if err != nil || n < 1 || n > maxHistoryDays {
+			writeError(w, http.StatusBadRequest, "days must be between 1 and 3650")
+			return
+		}
+		days = n
+	}
+
+	series := h.history.Days(days)
+	var totals struct {
+		JobsCompleted int                `json:"jobs_completed"`
+		BytesSaved    int64              `json:"bytes_saved"`
+		EncodeHours   map[string]float64 `json:"encode_hours"`
+		EnergyKWh     float64            `json:"energy_kwh"`
+		EnergyCost    float64            `json:"energy_cost"`
+	}
+	totals.EncodeHours = make(map[string]float64)
+	for _, day := range series {
+		totals.JobsCompleted += day.JobsCompleted
+		totals.BytesSaved += day.BytesSaved
+		totals.EnergyKWh += day.EnergyKWh
+		totals.EnergyCost += day.EnergyCost
+		for encoder, hours := range day.EncodeHours {
+			totals.EncodeHours[encoder] += hours
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"days":   series,
+		"totals": totals,
+	})
+}
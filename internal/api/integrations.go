@@ -0,0 +1,86 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/integrations/arr"
+	"github.com/gwlsn/shrinkray/internal/integrations/mediaserver"
+)
+
+// SetArrNotifier enables Sonarr/Radarr refreshes and their test endpoint
+func (h *Handler) SetArrNotifier(notifier *arr.Notifier) {
+	h.arr = notifier
+}
+
+// SetMediaServerNotifier enables Plex/Jellyfin refreshes and their test endpoint
+func (h *Handler) SetMediaServerNotifier(notifier *mediaserver.Notifier) {
+	h.mediaServers = notifier
+}
+
+// TestIntegration handles POST /api/integrations/{name}/test
+// where name is sonarr, radarr, plex or jellyfin. Every configured
+// Plex/Jellyfin server is tested.
+func (h *Handler) TestIntegration(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	name := r.PathValue("name")
+	switch name {
+	case string(arr.KindSonarr), string(arr.KindRadarr):
+		h.testArr(ctx, w, arr.Kind(name))
+	case string(mediaserver.KindPlex), string(mediaserver.KindJellyfin):
+		h.testMediaServers(ctx, w, mediaserver.Kind(name))
+	default:
+		writeError(w, http.StatusNotFound, fmt.Sprintf("unknown integration: %s", name))
+	}
+}
+
+func (h *Handler) testArr(ctx context.Context, w http.ResponseWriter, kind arr.Kind) {
+	if h.arr == nil {
+		writeError(w, http.StatusServiceUnavailable, "integrations are not available")
+		return
+	}
+	client := h.arr.Client(kind)
+	if client == nil || !client.IsConfigured() {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("%s url and api key not configured", kind))
+		return
+	}
+
+	if err := client.Test(ctx); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": fmt.Sprintf("Connected to %s", kind)})
+}
+
+func (h *Handler) testMediaServers(ctx context.Context, w http.ResponseWriter, kind mediaserver.Kind) {
+	if h.mediaServers == nil {
+		writeError(w, http.StatusServiceUnavailable, "integrations are not available")
+		return
+	}
+	clients := h.mediaServers.Clients(kind)
+	if len(clients) == 0 {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("no %s servers configured", kind))
+		return
+	}
+
+	var names, failures []string
+	for _, c := range clients {
+		if err := c.Test(ctx); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", c.Name, err))
+			continue
+		}
+		names = append(names, c.Name)
+	}
+	if len(failures) > 0 {
+		writeError(w, http.StatusBadRequest, strings.Join(failures, "; "))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "Connected to " + strings.Join(names, ", ")})
+}
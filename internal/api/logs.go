@@ -0,0 +1,179 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/logger"
+)
+
+// logFilter is the query of GET /api/logs and /api/logs/stream
+type logFilter struct {
+	since    uint64    // Sequence number the client has already seen
+	after    time.Time // Or a timestamp
+	minLevel slog.Level
+	module   string
+}
+
+// parseLogFilter reads ?since= (a line's seq or an RFC 3339 time),
+// ?level= (minimum level, default debug) and ?module=
+func parseLogFilter(r *http.Request) (logFilter, error) {
+	f := logFilter{minLevel: slog.LevelDebug, module: r.URL.Query().Get("module")}
+	if since := r.URL.Query().Get("since"); since != "" {
+		if seq, err := strconv.ParseUint(since, 10, 64); err == nil {
+			f.since = seq
+		} else if t, err := time.Parse(time.RFC3339, since); err == nil {
+			f.after = t
+		} else {
+			return f, fmt.Errorf("since must be a sequence number or an RFC 3339 time")
+		}
+	}
+	if name := r.URL.Query().Get("level"); name != "" {
+		level, ok := logger.ParseLevel(name)
+		if !ok {
+			return f, fmt.Errorf("unknown log level %q (use debug, info, warn or error)", name)
+		}
+		f.minLevel = level
+	}
+	return f, nil
+}
+
+func (f logFilter) match(e logger.Entry) bool {
+	return e.Seq > f.since && e.Time.After(f.after) && logger.EntryLevel(e) >= f.minLevel &&
+		(f.module == "" || e.Module == f.module)
+}
+
+// GetLogs handles GET /api/logs
+// Returns the recent log lines kept in memory (log_buffer_lines), oldest
+// first. Pass the returned next as ?since= to fetch only newer lines.
+func (h *Handler) GetLogs(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseLogFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	lines := make([]logger.Entry, 0)
+	next := filter.since
+	for _, e := range logger.Recent(filter.since, filter.after, filter.minLevel) {
+		next = e.Seq
+		if filter.match(e) {
+			lines = append(lines, e)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"lines": lines,
+		"next":  next,
+	})
+}
+
+// LogStream handles GET /api/logs/stream (SSE endpoint)
+// Sends the buffered lines matching the filter, then new lines as they are
+// logged.
+func (h *Handler) LogStream(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseLogFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache, no-transform")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.Header().Set("Content-Encoding", "identity")
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	// Subscribe before reading the backlog so no line falls between them
+	lineCh := logger.Subscribe()
+	defer logger.Unsubscribe(lineCh)
+
+	send := func(e logger.Entry) {
+		if !filter.match(e) {
+			return
+		}
+		filter.since = e.Seq
+		data, err := json.Marshal(e)
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(w, "id: %d\ndata: %s\n\n", e.Seq, data)
+	}
+	for _, e := range logger.Recent(filter.since, filter.after, filter.minLevel) {
+		send(e)
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(10 * time.Second)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-h.streamsClosed:
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case e, ok := <-lineCh:
+			if !ok {
+				return
+			}
+			send(e)
+			flusher.Flush()
+		}
+	}
+}
+
+// LogLevelRequest is the request body for PUT /api/logs/level
+type LogLevelRequest struct {
+	Module string `json:"module,omitempty"` // Empty sets the default level
+	Level  string `json:"level"`            // Empty with a module resets it to the default
+}
+
+// GetLogLevel handles GET /api/logs/level
+func (h *Handler) GetLogLevel(w http.ResponseWriter, r *http.Request) {
+	h.writeLogLevels(w)
+}
+
+// SetLogLevel handles PUT /api/logs/level
+// Changes the default level or one module's level until the next restart or
+// config reload that changes log settings; shrinkray.yaml is not touched.
+func (h *Handler) SetLogLevel(w http.ResponseWriter, r *http.Request) {
+	var req LogLevelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	var err error
+	if req.Module != "" {
+		err = logger.SetModuleLevel(req.Module, req.Level)
+	} else {
+		err = logger.SetLevel(req.Level)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	h.writeLogLevels(w)
+}
+
+func (h *Handler) writeLogLevels(w http.ResponseWriter) {
+	level, modules := logger.Levels()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"level":         level,
+		"modules":       modules,
+		"known_modules": logger.Modules(),
+	})
+}
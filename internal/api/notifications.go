@@ -0,0 +1,269 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/ffmpeg"
+	"github.com/gwlsn/shrinkray/internal/jobs"
+	"github.com/gwlsn/shrinkray/internal/logger"
+)
+
+var notifyLog = logger.For("notify")
+
+// WatchNotifications sends notifications about the queue as a whole until
+// ctx is done: the queue draining (notify_on_complete), a batch finishing
+// (notify_on_batch_complete), notify_failure_threshold failures in a row,
+// jobs blocked on disk space, and the queue held and released by the mount
+// watchdog. It runs whether or not a UI is open.
+func (h *Handler) WatchNotifications(ctx context.Context) {
+	events := h.queue.Subscribe()
+	watcher := &notifyWatcher{h: h, notifiedBatches: make(map[string]bool), sends: make(chan func(), notifyBacklog)}
+	// Batches that finished before now were notified, if at all, last run
+	for _, summary := range h.queue.Batches() {
+		if summary.Done {
+			watcher.notifiedBatches[summary.ID] = true
+		}
+	}
+
+	// Providers are slow to answer at times; sending from a goroutine of
+	// its own keeps up with the events meanwhile
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case send := <-watcher.sends:
+				send()
+			}
+		}
+	}()
+
+	go func() {
+		defer h.queue.Unsubscribe(events)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				watcher.handle(event)
+			}
+		}
+	}()
+}
+
+// notifyBacklog is how many notifications can wait to be sent before more
+// are dropped
+const notifyBacklog = 64
+
+// notifyWatcher is the state WatchNotifications keeps between events
+type notifyWatcher struct {
+	h     *Handler
+	sends chan func() // Notifications waiting to be sent, in order
+
+	// Jobs finished since the queue last drained, for its summary
+	runComplete  int
+	runFailed    int
+	runInputSize int64
+	runSaved     int64
+
+	failureStreak   int
+	notifiedBatches map[string]bool // Finished batches already notified
+}
+
+// send queues a notification to be sent after those before it
+func (n *notifyWatcher) send(fn func()) {
+	select {
+	case n.sends <- fn:
+	default:
+		notifyLog.Warn("Too many notifications waiting to be sent, dropping one")
+	}
+}
+
+func (n *notifyWatcher) handle(event jobs.JobEvent) {
+	switch event.Type {
+	case "complete":
+		n.runComplete++
+		if event.Job != nil {
+			n.runInputSize += event.Job.InputSize
+			n.runSaved += event.Job.SpaceSaved
+		}
+		n.failureStreak = 0
+	case "no_gain":
+		n.failureStreak = 0
+	case "failed", "verify_failed":
+		n.runFailed++
+		n.failureStreak++
+		if threshold := n.h.cfg.NotifyFailureThreshold; threshold > 0 && n.failureStreak == threshold {
+			count, job := n.failureStreak, event.Job
+			n.send(func() { n.h.sendFailureStreakNotification(count, job) })
+		}
+	case "waiting_disk":
+		job := event.Job
+		n.send(func() { n.h.sendDiskSpaceNotification(job) })
+		return
+	case "queue_held":
+		reason := event.Reason
+		n.send(func() { n.h.sendNotification("Shrinkray Paused", reason) })
+		return
+	case "queue_released":
+		n.send(func() { n.h.sendNotification("Shrinkray Resumed", "Media is reachable again, the queue has resumed") })
+		return
+	case "cancelled", "skipped":
+	case "batch_updated":
+		// Once a batch's jobs have all been added, it and the queue may
+		// already be done
+		if event.Batch == nil || event.Batch.Adding {
+			return
+		}
+	case jobs.EventResync:
+		// The events in between were dropped, so go by the queue's state:
+		// every batch is checked, and the jobs that finished meanwhile are
+		// missing from the run's counts. A failure streak can't be told.
+		n.failureStreak = 0
+		for _, summary := range n.h.queue.Batches() {
+			n.checkBatchSummary(&summary)
+		}
+	default:
+		return
+	}
+
+	if event.BatchID != "" {
+		n.checkBatch(event.BatchID)
+	}
+	if event.Type == "batch_updated" && n.runComplete == 0 && n.runFailed == 0 {
+		return
+	}
+
+	stats := n.h.queue.Stats()
+	if stats.PendingProbe > 0 || stats.Pending > 0 || stats.Running > 0 || stats.WaitingDisk > 0 || stats.AddingBatches > 0 {
+		return
+	}
+	complete, failed, inputSize, saved := n.runComplete, n.runFailed, n.runInputSize, n.runSaved
+	n.send(func() {
+		if n.h.sendQueueDrainedNotification(complete, failed, inputSize, saved, stats.TotalSaved) {
+			// Tell the UI so it can update the checkbox
+			n.h.queue.Notify("notify_sent")
+		}
+	})
+	n.runComplete, n.runFailed, n.runInputSize, n.runSaved = 0, 0, 0, 0
+}
+
+// checkBatch notifies once when the batch has finished
+func (n *notifyWatcher) checkBatch(id string) {
+	summary, _ := n.h.queue.GetBatch(id)
+	if summary == nil {
+		delete(n.notifiedBatches, id)
+		return
+	}
+	n.checkBatchSummary(summary)
+}
+
+func (n *notifyWatcher) checkBatchSummary(summary *jobs.BatchSummary) {
+	if !summary.Done {
+		// Retried jobs can reopen a finished batch
+		delete(n.notifiedBatches, summary.ID)
+		return
+	}
+	if n.notifiedBatches[summary.ID] || !n.h.cfg.NotifyOnBatchComplete {
+		return
+	}
+	n.notifiedBatches[summary.ID] = true
+
+	failed := summary.Counts[jobs.StatusFailed] + summary.Counts[jobs.StatusVerifyFailed]
+	message := fmt.Sprintf("%s: %d jobs complete, %d failed\nSaved %s",
+		summary.Name, summary.Counts[jobs.StatusComplete], failed, ffmpeg.FormatBytes(summary.SpaceSaved))
+	n.send(func() { n.h.sendNotification("Shrinkray Batch Complete", message) })
+}
+
+// sendQueueDrainedNotification sends the notify_on_complete summary.
+// Returns true if a notification was sent (and notify_on_complete turned off).
+func (h *Handler) sendQueueDrainedNotification(complete, failed int, inputSize, saved, totalSaved int64) bool {
+	// Lock to prevent racing a settings change to notify_on_complete
+	h.notifyMu.Lock()
+	defer h.notifyMu.Unlock()
+
+	if !h.cfg.NotifyOnComplete {
+		return false
+	}
+
+	message := fmt.Sprintf("%d jobs complete, %d failed\nSaved %s", complete, failed, ffmpeg.FormatBytes(saved))
+	if inputSize > 0 {
+		message += fmt.Sprintf(" (%.0f%%)", float64(saved)/float64(inputSize)*100)
+	}
+	message += fmt.Sprintf(", %s in total", ffmpeg.FormatBytes(totalSaved))
+
+	if !h.sendNotification("Shrinkray Complete", message) {
+		// Leave the checkbox checked for retry
+		return false
+	}
+
+	// Notification sent successfully, disable the checkbox
+	h.cfg.NotifyOnComplete = false
+	if h.cfgPath != "" {
+		h.cfg.Save(h.cfgPath)
+	}
+	return true
+}
+
+// sendFailureStreakNotification alerts that count jobs failed in a row,
+// which usually means something is wrong with the setup rather than the files
+func (h *Handler) sendFailureStreakNotification(count int, job *jobs.Job) {
+	message := fmt.Sprintf("%d jobs failed in a row", count)
+	if job != nil {
+		message += fmt.Sprintf("\nLatest: %s: %s", filepath.Base(job.InputPath), job.Error)
+	}
+	h.sendNotification("Shrinkray Failures", message)
+}
+
+// diskNotifyInterval limits how often low-disk-space notifications are sent.
+// Every worker re-checks periodically, so without this we'd spam the user.
+const diskNotifyInterval = time.Hour
+
+// sendDiskSpaceNotification alerts configured providers that a job is blocked
+// on free disk space. Unlike completion notifications this doesn't depend on
+// NotifyOnComplete - a full disk stalls the queue and needs attention.
+func (h *Handler) sendDiskSpaceNotification(job *jobs.Job) {
+	h.notifyMu.Lock()
+	if time.Since(h.lastDiskNotify) < diskNotifyInterval {
+		h.notifyMu.Unlock()
+		return
+	}
+	h.lastDiskNotify = time.Now()
+	h.notifyMu.Unlock()
+
+	message := "Jobs are paused until disk space is freed"
+	if job != nil && job.Error != "" {
+		message = job.Error
+	}
+	h.sendNotification("Shrinkray Low Disk Space", message)
+}
+
+// sendNotification sends to every configured provider. Returns true if at
+// least one is configured and none failed.
+func (h *Handler) sendNotification(title, message string) bool {
+	if !h.pushover.IsConfigured() && !h.ntfy.IsConfigured() {
+		return false
+	}
+
+	allSent := true
+	if h.pushover.IsConfigured() {
+		if err := h.pushover.Send(title, message); err != nil {
+			// Log error but don't crash
+			notifyLog.Warn("Failed to send notification", "provider", "pushover", "error", err)
+			allSent = false
+		}
+	}
+	if h.ntfy.IsConfigured() {
+		if err := h.ntfy.Send(title, message); err != nil {
+			notifyLog.Warn("Failed to send notification", "provider", "ntfy", "error", err)
+			allSent = false
+		}
+	}
+	return allSent
+}
@@ -0,0 +1,436 @@
+package api
+
+import (
+	"maps"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/autoscale"
+	"github.com/gwlsn/shrinkray/internal/browse"
+	"github.com/gwlsn/shrinkray/internal/config"
+	"github.com/gwlsn/shrinkray/internal/ffmpeg"
+	"github.com/gwlsn/shrinkray/internal/jobs"
+	"github.com/gwlsn/shrinkray/internal/logger"
+	"github.com/gwlsn/shrinkray/internal/remote"
+	"github.com/gwlsn/shrinkray/internal/retention"
+	"github.com/gwlsn/shrinkray/internal/scan"
+	"github.com/gwlsn/shrinkray/internal/selfcheck"
+	"github.com/gwlsn/shrinkray/internal/trash"
+)
+
+// apiOperation describes a route for the OpenAPI document. Request and
+// Response are values of the types the handler decodes and writes; their
+// schemas are generated from the types' JSON encoding.
+type apiOperation struct {
+	Method    string
+	Path      string
+	Handler   string // Handler method name, used as the operationId
+	Summary   string
+	Query     map[string]string // Query parameter -> description
+	Request   any               // JSON body, nil for none
+	Response  any               // JSON response, nil for none
+	Status    int               // Success status, default 200
+	MediaType string            // Response media type when not JSON
+}
+
+// fields describes a JSON object built as a map in the handler: each key's
+// schema is generated from its value
+type fields map[string]any
+
+var statusResponse = fields{"status": ""}
+
+// apiOperations lists every route of NewRouter, except the UI's static files
+var apiOperations = []apiOperation{
+	{Method: "GET", Path: "/healthz", Handler: "Healthz", Summary: "Liveness check", MediaType: "text/plain"},
+	{Method: "GET", Path: "/readyz", Handler: "Ready", Summary: "Readiness check; 503 while a self-check fails", Response: selfcheck.Report{}},
+
+	{Method: "GET", Path: "/auth/callback", Handler: "AuthCallback", Summary: "Login callback of the auth provider", Status: http.StatusFound},
+	{Method: "GET", Path: "/auth/login", Handler: "AuthLoginPage", Summary: "Login page or redirect to the auth provider", MediaType: "text/html"},
+	{Method: "POST", Path: "/auth/login", Handler: "AuthLogin", Summary: "Log in with a password form", Status: http.StatusFound},
+	{Method: "GET", Path: "/auth/logout", Handler: "AuthLogoutPage", Summary: "Log out", Status: http.StatusFound},
+	{Method: "POST", Path: "/auth/logout", Handler: "AuthLogout", Summary: "Log out", Status: http.StatusFound},
+
+	{Method: "GET", Path: "/api/openapi.json", Handler: "OpenAPI", Summary: "This document", Response: fields{}},
+	{Method: "GET", Path: "/api/browse", Handler: "Browse", Summary: "List a directory under the media root",
+		Query: map[string]string{
+			"path":             "Directory to list (default: the media root)",
+			"aggregate":        "true adds a recursive rollup to each directory",
+			"preset":           "Preset to estimate output sizes with",
+			"codecs":           "Only list videos with these codecs (comma-separated)",
+			"exclude_codecs":   "Hide videos with these codecs (comma-separated)",
+			"min_height":       "Only list videos at least this tall",
+			"min_bitrate_mbps": "Only list videos at or above this bitrate",
+		},
+		Response: browse.BrowseResult{}},
+	{Method: "GET", Path: "/api/search", Handler: "Search", Summary: "Search the media root by file name",
+		Query: map[string]string{"q": "Search text", "limit": "Maximum results"}, Response: browse.SearchResult{}},
+	{Method: "GET", Path: "/api/thumb", Handler: "Thumbnail", Summary: "Poster frame of a video",
+		Query: map[string]string{"path": "Video file"}, MediaType: "image/jpeg"},
+	{Method: "GET", Path: "/api/presets", Handler: "Presets", Summary: "List presets", Response: []*ffmpeg.Preset{}},
+	{Method: "POST", Path: "/api/presets/{id}/test", Handler: "TestPreset", Summary: "Encode a short clip with a preset",
+		Request: PresetTestRequest{}, Response: ffmpeg.PresetTestResult{}},
+	{Method: "GET", Path: "/api/encoders", Handler: "Encoders", Summary: "List detected encoders",
+		Response: fields{"encoders": []*ffmpeg.HWEncoder{}, "best": &ffmpeg.HWEncoder{}, "devices": []ffmpeg.GPUDevice{}}},
+	{Method: "POST", Path: "/api/encoders/redetect", Handler: "RedetectEncoders", Summary: "Detect encoders again and regenerate presets",
+		Response: fields{"encoders": []*ffmpeg.HWEncoder{}, "best": &ffmpeg.HWEncoder{}, "devices": []ffmpeg.GPUDevice{}, "presets": []*ffmpeg.Preset{}}},
+
+	{Method: "GET", Path: "/api/jobs", Handler: "ListJobs", Summary: "List jobs",
+		Query: map[string]string{
+			"status":    "Only jobs with these statuses (comma-separated)",
+			"preset":    "Only jobs with this preset",
+			"sort":      "Sort order",
+			"page":      "Page number, from 1; without it every job is returned",
+			"page_size": "Jobs per page",
+		},
+		Response: fields{"jobs": []*jobs.Job{}, "stats": jobs.Stats{}, "total": 0, "page": 0, "page_size": 0}},
+	{Method: "POST", Path: "/api/jobs", Handler: "CreateJobs", Summary: "Queue files and folders as a batch",
+		Request: CreateJobsRequest{}, Response: fields{"status": "", "message": "", "batch_id": "", "duplicates": []string{}}, Status: http.StatusAccepted},
+	{Method: "GET", Path: "/api/jobs/stream", Handler: "JobStream", Summary: "Job events (Server-Sent Events)",
+		Query: map[string]string{"last_event_id": "Resume after this event"}, MediaType: "text/event-stream"},
+	{Method: "GET", Path: "/api/jobs/changes", Handler: "JobChanges", Summary: "Jobs changed since a cursor",
+		Query: map[string]string{"since": "Cursor from the previous response"}, Response: jobs.Changes{}},
+	{Method: "GET", Path: "/api/jobs/ws", Handler: "JobSocket", Summary: "Job events (WebSocket)",
+		Query: map[string]string{"events": "Only these event types (comma-separated)"}, Status: http.StatusSwitchingProtocols},
+	{Method: "POST", Path: "/api/jobs/clear", Handler: "ClearQueue", Summary: "Remove jobs that aren't running",
+		Request: fields{"include_completed": true}, Response: fields{"cleared": 0, "message": ""}},
+	{Method: "POST", Path: "/api/jobs/fit", Handler: "FitJobs", Summary: "Queue files to fit a size budget",
+		Request: FitJobsRequest{}, Response: fields{"dry_run": false, "scanned": 0, "queued": 0, "plan": ffmpeg.BudgetPlan{}}},
+	{Method: "GET", Path: "/api/jobs/{id}", Handler: "GetJob", Summary: "Get a job", Response: jobs.Job{}},
+	{Method: "GET", Path: "/api/jobs/{id}/preview", Handler: "JobPreview", Summary: "Frame of the running encode", MediaType: "image/jpeg"},
+	{Method: "GET", Path: "/api/jobs/{id}/attempts", Handler: "GetJobAttempts", Summary: "Every try at the job's file",
+		Response: fields{"job_id": "", "attempts": []jobs.Attempt{}}},
+	{Method: "GET", Path: "/api/jobs/{id}/timeline", Handler: "GetJobTimeline", Summary: "Where a job's time went", Response: jobs.Timeline{}},
+	{Method: "PATCH", Path: "/api/jobs/{id}", Handler: "UpdateJob", Summary: "Change a pending job", Request: jobs.JobPatch{}, Response: jobs.Job{}},
+	{Method: "DELETE", Path: "/api/jobs/{id}", Handler: "CancelJob", Summary: "Cancel or remove a job", Response: statusResponse},
+	{Method: "POST", Path: "/api/jobs/{id}/pause", Handler: "PauseJob", Summary: "Pause a running job", Response: statusResponse},
+	{Method: "POST", Path: "/api/jobs/{id}/resume", Handler: "ResumeJob", Summary: "Resume a paused job", Response: statusResponse},
+	{Method: "POST", Path: "/api/jobs/{id}/retry", Handler: "RetryJob", Summary: "Retry a failed job", Response: jobs.Job{}},
+	{Method: "POST", Path: "/api/jobs/{id}/force", Handler: "ForceRetryJob", Summary: "Encode a skipped job anyway", Response: jobs.Job{}},
+	{Method: "POST", Path: "/api/jobs/{id}/retry-preset", Handler: "RetryWithPreset", Summary: "Retry a job with another preset",
+		Request: RetryWithPresetRequest{}, Response: jobs.Job{}},
+	{Method: "POST", Path: "/api/jobs/{id}/reorder", Handler: "ReorderJob", Summary: "Move a pending job up or down",
+		Request: fields{"direction": ""}, Response: fields{"moved": false}},
+	{Method: "POST", Path: "/api/jobs/{id}/move", Handler: "MoveJob", Summary: "Move a pending job before another",
+		Request: fields{"before_id": ""}, Response: fields{"moved": false}},
+	{Method: "POST", Path: "/api/jobs/{id}/restore", Handler: "RestoreJob", Summary: "Restore a job's original from the trash", Response: trash.Entry{}},
+	{Method: "GET", Path: "/api/batches", Handler: "ListBatches", Summary: "List batches", Response: []jobs.BatchSummary{}},
+	{Method: "GET", Path: "/api/batches/{id}", Handler: "GetBatch", Summary: "Get a batch and its jobs",
+		Response: fields{"batch": jobs.BatchSummary{}, "jobs": []*jobs.Job{}}},
+	{Method: "POST", Path: "/api/batches/{id}/cancel", Handler: "CancelBatch", Summary: "Cancel a batch's unfinished jobs",
+		Response: fields{"status": "", "cancelled": 0}},
+	{Method: "POST", Path: "/api/batches/{id}/pause", Handler: "PauseBatch", Summary: "Pause a batch", Response: statusResponse},
+	{Method: "POST", Path: "/api/batches/{id}/resume", Handler: "ResumeBatch", Summary: "Resume a batch", Response: statusResponse},
+	{Method: "GET", Path: "/api/processed", Handler: "ListProcessed", Summary: "List processed files",
+		Query: map[string]string{
+			"search":    "Only paths containing this text",
+			"sort":      "path or processed; a leading - sorts descending",
+			"page":      "Page number, from 1; without it every path is returned",
+			"page_size": "Paths per page",
+		},
+		Response: fields{"entries": []jobs.ProcessedEntry{}, "total": 0, "page": 0, "page_size": 0}},
+	{Method: "DELETE", Path: "/api/processed", Handler: "UnmarkProcessed", Summary: "Forget a processed file or folder",
+		Query: map[string]string{"path": "File or folder to forget; may be repeated"}, Response: fields{"removed": 0}},
+	{Method: "POST", Path: "/api/processed/clear", Handler: "ClearProcessedHistory", Summary: "Forget processed files",
+		Response: fields{"cleared": 0, "message": ""}},
+	{Method: "POST", Path: "/api/processed/mark", Handler: "MarkProcessed", Summary: "Mark files as processed",
+		Request: MarkProcessedRequest{}, Response: fields{"processed": 0, "total": 0}},
+
+	{Method: "GET", Path: "/api/config", Handler: "GetConfig", Summary: "Current settings", Response: fields{}},
+	{Method: "PUT", Path: "/api/config", Handler: "UpdateConfig", Summary: "Change settings", Request: UpdateConfigRequest{}, Response: statusResponse},
+	{Method: "POST", Path: "/api/config/validate", Handler: "ValidateConfig", Summary: "Check the config file without applying it",
+		Response: fields{"valid": false, "report": selfcheck.Report{}}},
+	{Method: "POST", Path: "/api/config/reload", Handler: "ReloadConfig", Summary: "Re-read and apply the config file",
+		Response: fields{"status": "", "report": selfcheck.Report{}}},
+	{Method: "GET", Path: "/api/auth/sessions", Handler: "ListSessions", Summary: "List active logins",
+		Response: fields{"sessions": []sessionInfo{}, "count": 0}},
+	{Method: "DELETE", Path: "/api/auth/sessions/{id}", Handler: "RevokeSession", Summary: "End a login", Response: statusResponse},
+	{Method: "POST", Path: "/api/auth/sessions/revoke-all", Handler: "RevokeAllSessions", Summary: "End all of the user's logins",
+		Response: fields{"revoked": 0}},
+	{Method: "GET", Path: "/api/logs", Handler: "GetLogs", Summary: "Recent log lines",
+		Query:    map[string]string{"since": "A line's seq or an RFC 3339 time", "level": "Minimum level", "module": "Only this module"},
+		Response: fields{"lines": []logger.Entry{}, "next": uint64(0)}},
+	{Method: "GET", Path: "/api/logs/stream", Handler: "LogStream", Summary: "Log lines (Server-Sent Events)",
+		Query: map[string]string{"since": "A line's seq or an RFC 3339 time", "level": "Minimum level", "module": "Only this module"}, MediaType: "text/event-stream"},
+	{Method: "GET", Path: "/api/logs/level", Handler: "GetLogLevel", Summary: "Log levels",
+		Response: fields{"level": "", "modules": map[string]string{}, "known_modules": []string{}}},
+	{Method: "PUT", Path: "/api/logs/level", Handler: "SetLogLevel", Summary: "Change a log level", Request: LogLevelRequest{},
+		Response: fields{"level": "", "modules": map[string]string{}, "known_modules": []string{}}},
+
+	{Method: "GET", Path: "/api/stats", Handler: "Stats", Summary: "Queue statistics", Response: StatsResponse{}},
+	{Method: "GET", Path: "/api/stats/history", Handler: "StatsHistory", Summary: "Daily totals",
+		Query:    map[string]string{"days": "Number of days, default 30"},
+		Response: fields{"days": []jobs.DailyStats{}, "totals": fields{"jobs_completed": 0, "bytes_saved": int64(0), "encode_hours": map[string]float64{}, "energy_kwh": 0.0, "energy_cost": 0.0}}},
+	{Method: "GET", Path: "/api/stats/presets", Handler: "PresetStats", Summary: "Results by preset", Response: fields{"presets": []jobs.PresetStats{}}},
+	{Method: "GET", Path: "/api/stats/estimates", Handler: "EstimateStats", Summary: "Estimate accuracy and calibration", Response: fields{"estimates": []jobs.EstimateCalibration{}, "min_samples": 0}},
+	{Method: "GET", Path: "/api/queue/simulate", Handler: "SimulateQueue", Summary: "Project completion times",
+		Query:    map[string]string{"workers": "Worker counts to simulate (comma-separated)"},
+		Response: fields{"current_workers": 0, "history": jobs.SpeedHistory{}, "simulations": []*jobs.Simulation{}}},
+	{Method: "GET", Path: "/api/rules", Handler: "ListRules", Summary: "List rules", Response: []config.Rule{}},
+	{Method: "POST", Path: "/api/rules/{id}/run", Handler: "RunRule", Summary: "Queue the files a rule matches",
+		Query: map[string]string{"dry_run": "true only reports the matches"},
+		Response: fields{"rule": config.Rule{}, "dry_run": false, "scanned": 0, "matched": 0, "queued": 0,
+			"matches": []*ffmpeg.ProbeResult{}, "estimate": ffmpeg.BatchEstimate{}}},
+	{Method: "POST", Path: "/api/scan", Handler: "StartScan", Summary: "Start a library scan",
+		Request: fields{"preset": ""}, Response: scan.Status{}, Status: http.StatusAccepted},
+	{Method: "DELETE", Path: "/api/scan", Handler: "CancelScan", Summary: "Stop the library scan", Response: scan.Status{}},
+	{Method: "GET", Path: "/api/scan/status", Handler: "ScanStatus", Summary: "Library scan progress", Response: scan.Status{}},
+	{Method: "GET", Path: "/api/scan/reports", Handler: "ScanReports", Summary: "List scan reports", Response: []scan.ReportInfo{}},
+	{Method: "GET", Path: "/api/scan/report", Handler: "ScanReport", Summary: "Get a scan report",
+		Query: map[string]string{"id": "Report ID (default: the latest)"}, Response: scan.Report{}},
+	{Method: "GET", Path: "/api/originals", Handler: "ListOriginals", Summary: "List kept originals",
+		Response: fields{"originals": []*retention.Original{}, "count": 0, "reclaimable": int64(0), "retention_days": 0}},
+	{Method: "POST", Path: "/api/originals/{id}/verify", Handler: "VerifyOriginal", Summary: "Mark a kept original as verified", Response: retention.Original{}},
+	{Method: "DELETE", Path: "/api/originals/{id}", Handler: "DeleteOriginal", Summary: "Delete a kept original", Response: statusResponse},
+	{Method: "GET", Path: "/api/trash", Handler: "ListTrash", Summary: "List trashed originals",
+		Response: fields{"originals": []*trash.Entry{}, "count": 0, "size": int64(0), "retention_days": 0}},
+	{Method: "GET", Path: "/api/cache/stats", Handler: "CacheStats", Summary: "Probe cache statistics", Response: browse.CacheStats{}},
+	{Method: "GET", Path: "/api/selfcheck", Handler: "SelfCheck", Summary: "Startup self-check",
+		Query: map[string]string{"refresh": "true runs the checks again"}, Response: selfcheck.Report{}},
+	{Method: "POST", Path: "/api/cache/clear", Handler: "ClearCache", Summary: "Clear the probe cache", Response: statusResponse},
+	{Method: "POST", Path: "/api/pushover/test", Handler: "TestPushover", Summary: "Send a test Pushover notification", Response: statusResponse},
+	{Method: "POST", Path: "/api/ntfy/test", Handler: "TestNtfy", Summary: "Send a test ntfy notification", Response: statusResponse},
+	{Method: "POST", Path: "/api/integrations/{name}/test", Handler: "TestIntegration", Summary: "Test an integration's connection", Response: statusResponse},
+	{Method: "GET", Path: "/api/agents", Handler: "ListAgents", Summary: "List remote agents",
+		Response: fields{"enabled": false, "agents": []remote.Agent{}}},
+	{Method: "GET", Path: "/api/workers", Handler: "ListWorkers", Summary: "List local workers",
+		Response: fields{"workers": []jobs.WorkerStatus{}, "autoscale": autoscale.Status{}}},
+	{Method: "POST", Path: "/api/workers/{id}/drain", Handler: "DrainWorker", Summary: "Remove a worker after its current job",
+		Response: statusResponse, Status: http.StatusAccepted},
+
+	{Method: "POST", Path: "/api/remote/register", Handler: "RemoteRegister", Summary: "Register a remote agent",
+		Request: remote.RegisterRequest{}, Response: remote.RegisterResponse{}},
+	{Method: "POST", Path: "/api/remote/claim", Handler: "RemoteClaim", Summary: "Claim a job; 204 when there is none",
+		Request: remote.ClaimRequest{}, Response: remote.Assignment{}},
+	{Method: "GET", Path: "/api/remote/jobs/{id}/source", Handler: "RemoteSource", Summary: "Download a claimed job's source", MediaType: "application/octet-stream"},
+	{Method: "POST", Path: "/api/remote/jobs/{id}/progress", Handler: "RemoteProgress", Summary: "Report a claimed job's progress",
+		Request: remote.ProgressReport{}, Status: http.StatusNoContent},
+	{Method: "PUT", Path: "/api/remote/jobs/{id}/result", Handler: "RemoteResult", Summary: "Upload a claimed job's output", Status: http.StatusNoContent},
+	{Method: "POST", Path: "/api/remote/jobs/{id}/fail", Handler: "RemoteFail", Summary: "Report a claimed job's failure",
+		Request: remote.FailReport{}, Status: http.StatusNoContent},
+}
+
+var (
+	openAPIOnce sync.Once
+	openAPIDoc  map[string]any
+)
+
+// OpenAPI handles GET /api/openapi.json
+func (h *Handler) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	openAPIOnce.Do(func() { openAPIDoc = openAPISpec(apiOperations) })
+	writeJSON(w, http.StatusOK, openAPIDoc)
+}
+
+var pathParam = regexp.MustCompile(`\{(\w+)\}`)
+
+// openAPISpec builds an OpenAPI 3 document for ops. Named struct types
+// become components, so generated clients get one type per Go type.
+func openAPISpec(ops []apiOperation) map[string]any {
+	s := &schemaBuilder{schemas: map[string]any{}, names: map[reflect.Type]string{}}
+	s.schemas["Error"] = s.schema(reflect.TypeOf(fields{"error": ""}), fields{"error": ""})
+	paths := map[string]any{}
+	for _, op := range ops {
+		operation := map[string]any{
+			"operationId": strings.ToLower(op.Handler[:1]) + op.Handler[1:],
+			"summary":     op.Summary,
+			"tags":        []string{operationTag(op.Path)},
+		}
+
+		var params []any
+		for _, m := range pathParam.FindAllStringSubmatch(op.Path, -1) {
+			params = append(params, map[string]any{"name": m[1], "in": "path", "required": true, "schema": map[string]any{"type": "string"}})
+		}
+		for _, name := range slices.Sorted(maps.Keys(op.Query)) {
+			params = append(params, map[string]any{"name": name, "in": "query", "description": op.Query[name], "schema": map[string]any{"type": "string"}})
+		}
+		if params != nil {
+			operation["parameters"] = params
+		}
+
+		if op.Request != nil {
+			operation["requestBody"] = map[string]any{
+				"content": map[string]any{"application/json": map[string]any{"schema": s.value(op.Request)}},
+			}
+		} else if op.Method == "PUT" && op.MediaType == "" && op.Response == nil {
+			operation["requestBody"] = map[string]any{
+				"content": map[string]any{"application/octet-stream": map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}}},
+			}
+		}
+
+		status := op.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		success := map[string]any{"description": http.StatusText(status)}
+		switch {
+		case op.MediaType != "":
+			schema := map[string]any{"type": "string"}
+			if strings.HasPrefix(op.MediaType, "image/") || op.MediaType == "application/octet-stream" {
+				schema["format"] = "binary"
+			}
+			success["content"] = map[string]any{op.MediaType: map[string]any{"schema": schema}}
+		case op.Response != nil:
+			success["content"] = map[string]any{"application/json": map[string]any{"schema": s.value(op.Response)}}
+		}
+		operation["responses"] = map[string]any{
+			strconv.Itoa(status): success,
+			"default": map[string]any{
+				"description": "Error",
+				"content":     map[string]any{"application/json": map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/Error"}}},
+			},
+		}
+
+		item, _ := paths[op.Path].(map[string]any)
+		if item == nil {
+			item = map[string]any{}
+			paths[op.Path] = item
+		}
+		item[strings.ToLower(op.Method)] = operation
+	}
+
+	return map[string]any{
+		"openapi":    "3.0.3",
+		"info":       map[string]any{"title": "Shrinkray API", "version": "1"},
+		"paths":      paths,
+		"components": map[string]any{"schemas": s.schemas},
+	}
+}
+
+// operationTag groups operations by the first path segment after /api
+func operationTag(path string) string {
+	parts := strings.Split(strings.TrimPrefix(strings.TrimPrefix(path, "/api"), "/"), "/")
+	return strings.TrimSuffix(parts[0], ".json")
+}
+
+// schemaBuilder generates JSON schemas from Go types as encoding/json
+// would encode them
+type schemaBuilder struct {
+	schemas map[string]any
+	names   map[reflect.Type]string
+}
+
+// value returns the schema of v, which is a fields or a value of a type
+func (s *schemaBuilder) value(v any) map[string]any {
+	if f, ok := v.(fields); ok {
+		return s.schema(reflect.TypeOf(f), f)
+	}
+	return s.schema(reflect.TypeOf(v), nil)
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (s *schemaBuilder) schema(t reflect.Type, f fields) map[string]any {
+	if t == reflect.TypeOf(fields{}) {
+		// In order, so the same types get the same component names each time
+		props := map[string]any{}
+		for _, name := range slices.Sorted(maps.Keys(f)) {
+			props[name] = s.value(f[name])
+		}
+		if len(props) == 0 {
+			return map[string]any{"type": "object", "additionalProperties": true}
+		}
+		return map[string]any{"type": "object", "properties": props}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return s.schema(t.Elem(), nil)
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return map[string]any{"type": "integer"}
+	case reflect.Int64:
+		if t == reflect.TypeOf(time.Duration(0)) {
+			return map[string]any{"type": "integer", "format": "int64", "description": "Nanoseconds"}
+		}
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": s.schema(t.Elem(), nil)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": s.schema(t.Elem(), nil)}
+	case reflect.Struct:
+		if t == timeType {
+			return map[string]any{"type": "string", "format": "date-time"}
+		}
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + s.component(t)}
+	}
+	return map[string]any{}
+}
+
+// component adds the schema of named struct type t to the components,
+// if it isn't there yet, and returns its name
+func (s *schemaBuilder) component(t reflect.Type) string {
+	if name, ok := s.names[t]; ok {
+		return name
+	}
+	name := strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+	if _, taken := s.schemas[name]; taken {
+		pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+		name = strings.ToUpper(pkg[:1]) + pkg[1:] + name
+	}
+	s.names[t] = name
+	s.schemas[name] = nil // Reserved while the fields are generated
+	s.schemas[name] = s.object(t)
+	return name
+}
+
+// object returns the schema of struct type t
+func (s *schemaBuilder) object(t reflect.Type) map[string]any {
+	props := map[string]any{}
+	s.addFields(t, props)
+	return map[string]any{"type": "object", "properties": props}
+}
+
+// addFields adds the JSON fields of struct type t to props, including
+// those of embedded structs
+func (s *schemaBuilder) addFields(t reflect.Type, props map[string]any) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		ft := field.Type
+		if field.Anonymous && name == "" {
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				s.addFields(ft, props)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if k := ft.Kind(); k == reflect.Func || k == reflect.Chan {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if strings.Contains(opts, "string") {
+			props[name] = map[string]any{"type": "string"}
+			continue
+		}
+		props[name] = s.schema(ft, nil)
+	}
+}
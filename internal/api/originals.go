@@ -0,0 +1,62 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gwlsn/shrinkray/internal/retention"
+)
+
+// SetRetention enables the /api/originals endpoints
+func (h *Handler) SetRetention(store *retention.Store) {
+	h.retention = store
+}
+
+// ListOriginals handles GET /api/originals
+// Lists the .old originals kept by original_handling: keep, oldest first.
+func (h *Handler) ListOriginals(w http.ResponseWriter, r *http.Request) {
+	if h.retention == nil {
+		writeError(w, http.StatusServiceUnavailable, "original retention is not available")
+		return
+	}
+	originals := h.retention.List()
+	summary := h.retention.Summary()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"originals":      originals,
+		"count":          summary.Count,
+		"reclaimable":    summary.Reclaimable,
+		"retention_days": h.cfg.OriginalRetentionDays,
+	})
+}
+
+// VerifyOriginal handles POST /api/originals/{id}/verify
+// Marks the transcode as checked so the original is deleted at the next cleanup.
+func (h *Handler) VerifyOriginal(w http.ResponseWriter, r *http.Request) {
+	if h.retention == nil {
+		writeError(w, http.StatusServiceUnavailable, "original retention is not available")
+		return
+	}
+	original, err := h.retention.Verify(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, original)
+}
+
+// DeleteOriginal handles DELETE /api/originals/{id}
+func (h *Handler) DeleteOriginal(w http.ResponseWriter, r *http.Request) {
+	if h.retention == nil {
+		writeError(w, http.StatusServiceUnavailable, "original retention is not available")
+		return
+	}
+	if err := h.retention.Delete(r.PathValue("id")); err != nil {
+		if errors.Is(err, retention.ErrNotFound) {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/gwlsn/shrinkray/internal/auth"
+	"github.com/gwlsn/shrinkray/internal/jobs"
+)
+
+// requestUser returns the ID of the user making the request, or "" when
+// auth is off
+func requestUser(r *http.Request) string {
+	if user, ok := auth.UserFromContext(r.Context()); ok {
+		return user.ID
+	}
+	return ""
+}
+
+// jobViewer returns the user whose jobs the request is limited to, or ""
+// if it may see every job: auth is off, job_visibility isn't "own", or the
+// user is in admin_users
+func (h *Handler) jobViewer(r *http.Request) string {
+	if h.cfg.Auth.JobVisibility != "own" {
+		return ""
+	}
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok || h.isAdmin(user) {
+		return ""
+	}
+	return user.ID
+}
+
+// isAdmin reports whether user is listed in admin_users, by ID or email
+func (h *Handler) isAdmin(user *auth.User) bool {
+	return slices.Contains(h.cfg.Auth.AdminUsers, user.ID) ||
+		(user.Email != "" && slices.Contains(h.cfg.Auth.AdminUsers, user.Email))
+}
+
+// jobAccess wraps the /api/jobs/{id} handlers so that, with job_visibility
+// "own", users get 404 for jobs they didn't create
+func (h *Handler) jobAccess(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if viewer := h.jobViewer(r); viewer != "" {
+			if job := h.queue.Get(r.PathValue("id")); job != nil && job.CreatedBy != viewer {
+				writeError(w, http.StatusNotFound, "job not found")
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// visibleJobs returns the jobs viewer may see ("" = all of them)
+func visibleJobs(viewer string, all []*jobs.Job) []*jobs.Job {
+	if viewer == "" {
+		return all
+	}
+	visible := make([]*jobs.Job, 0, len(all))
+	for _, job := range all {
+		if job.CreatedBy == viewer {
+			visible = append(visible, job)
+		}
+	}
+	return visible
+}
+
+// visibleEvent narrows event to the jobs viewer may see, reporting false if
+// none are left. Events that aren't about a job pass unchanged.
+func (h *Handler) visibleEvent(viewer string, event jobs.JobEvent) (jobs.JobEvent, bool) {
+	if viewer == "" {
+		return event, true
+	}
+	switch {
+	case event.Job != nil:
+		return event, event.Job.CreatedBy == viewer
+	case event.Batch != nil:
+		return event, event.Batch.CreatedBy == viewer
+	case event.Jobs != nil:
+		event.Jobs = visibleJobs(viewer, event.Jobs)
+		return event, len(event.Jobs) > 0
+	case event.ProgressUpdate != nil:
+		job := h.queue.Get(event.ProgressUpdate.ID)
+		return event, job != nil && job.CreatedBy == viewer
+	case event.ProgressBatch != nil:
+		batch := make([]jobs.ProgressUpdate, 0, len(event.ProgressBatch))
+		for _, update := range event.ProgressBatch {
+			if job := h.queue.Get(update.ID); job != nil && job.CreatedBy == viewer {
+				batch = append(batch, update)
+			}
+		}
+		event.ProgressBatch = batch
+		return event, len(batch) > 0
+	}
+	return event, true
+}
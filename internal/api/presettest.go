@@ -0,0 +1,93 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/browse"
+	"github.com/gwlsn/shrinkray/internal/ffmpeg"
+)
+
+// maxPresetTestLength caps the clip POST /api/presets/{id}/test encodes
+const maxPresetTestLength = 5 * time.Minute
+
+// PresetTestRequest is the body of POST /api/presets/{id}/test
+type PresetTestRequest struct {
+	Path            string   `json:"path"`
+	StartSeconds    *float64 `json:"start_seconds,omitempty"`    // Default: the clip is centred in the file
+	DurationSeconds float64  `json:"duration_seconds,omitempty"` // Default: 30
+}
+
+// TestPreset handles POST /api/presets/{id}/test
+// Encodes a clip of a file with the preset as configured and reports its
+// size, SSIM and encode speed, so a bad preset is caught before a batch
+// uses it. One test runs at a time.
+func (h *Handler) TestPreset(w http.ResponseWriter, r *http.Request) {
+	preset := ffmpeg.GetPreset(r.PathValue("id"))
+	if preset == nil {
+		writeError(w, http.StatusNotFound, "preset not found")
+		return
+	}
+
+	var req PresetTestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	path, err := filepath.Abs(req.Path)
+	if err != nil || req.Path == "" || !browse.Within(h.browser.MediaRoot(), path) || !ffmpeg.IsVideoFile(path) {
+		writeError(w, http.StatusBadRequest, "path must be a video file under the media root")
+		return
+	}
+	length := ffmpeg.DefaultPresetTestLength
+	if req.DurationSeconds != 0 {
+		length = time.Duration(req.DurationSeconds * float64(time.Second))
+	}
+	if length <= 0 || length > maxPresetTestLength {
+		writeError(w, http.StatusBadRequest, "duration_seconds must be between 0 and 300")
+		return
+	}
+	if req.StartSeconds != nil && *req.StartSeconds < 0 {
+		writeError(w, http.StatusBadRequest, "start_seconds must be 0 or greater")
+		return
+	}
+
+	if !h.presetTestBusy.CompareAndSwap(false, true) {
+		writeError(w, http.StatusConflict, "a preset test is already running")
+		return
+	}
+	defer h.presetTestBusy.Store(false)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Minute)
+	defer cancel()
+
+	probe, err := h.browser.ProbeFile(ctx, path)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "failed to probe file: "+err.Error())
+		return
+	}
+
+	// Same adjustments a job with this preset would get
+	testPreset := *preset
+	testPreset.Threads = h.cfg.PresetThreads[preset.ID]
+	if reason := ffmpeg.EncoderIncompatibility(&testPreset, probe.Width, probe.Height, probe.BitDepth); reason != "" {
+		testPreset.Encoder = ffmpeg.HWAccelNone
+	}
+
+	offset := ffmpeg.PresetTestOffset(probe.Duration, length)
+	if req.StartSeconds != nil {
+		offset = time.Duration(*req.StartSeconds * float64(time.Second))
+	}
+
+	transcoder := ffmpeg.NewTranscoder(h.cfg.FFmpegPath)
+	result, err := transcoder.TestPreset(ctx, probe, &testPreset, offset, length,
+		h.cfg.QualityHEVC, h.cfg.QualityAV1, h.cfg.GetTempDir(path))
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/ffmpeg"
+	"github.com/gwlsn/shrinkray/internal/jobs"
+)
+
+// previewLag keeps preview frames behind the encode position, whose last
+// few seconds may not be flushed to the temp file yet
+const previewLag = 5 * time.Second
+
+// previewCache holds the latest preview frame per running job
+type previewCache struct {
+	mu     sync.Mutex // Held while generating, so concurrent viewers share one ffmpeg
+	frames map[string]previewFrame
+}
+
+type previewFrame struct {
+	data []byte
+	at   time.Time
+}
+
+// JobPreview handles GET /api/jobs/{id}/preview
+// Returns a low-res JPEG of the encode in progress, taken from the temp
+// output and regenerated at most every preview_interval_seconds.
+func (h *Handler) JobPreview(w http.ResponseWriter, r *http.Request) {
+	interval := time.Duration(h.cfg.PreviewIntervalSeconds) * time.Second
+	if interval <= 0 {
+		writeError(w, http.StatusNotFound, "previews are disabled")
+		return
+	}
+
+	job := h.queue.Get(r.PathValue("id"))
+	if job == nil {
+		writeError(w, http.StatusNotFound, "job not found")
+		return
+	}
+	if job.Status != jobs.StatusRunning || job.TempPath == "" {
+		writeError(w, http.StatusConflict, "previews are only available for jobs running on this server")
+		return
+	}
+
+	h.previews.mu.Lock()
+	defer h.previews.mu.Unlock()
+	if h.previews.frames == nil {
+		h.previews.frames = make(map[string]previewFrame)
+	}
+
+	frame, ok := h.previews.frames[job.ID]
+	if !ok || time.Since(frame.at) >= interval {
+		position := time.Duration(float64(job.Duration)*job.Progress/100)*time.Millisecond - previewLag
+		ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+		data, err := ffmpeg.ExtractFrame(ctx, h.cfg.FFmpegPath, job.TempPath, max(position, 0), ffmpeg.PreviewWidth)
+		cancel()
+		if err != nil {
+			if ok {
+				// Keep showing the last good frame
+				data = frame.data
+			} else {
+				writeError(w, http.StatusServiceUnavailable, "no preview available yet")
+				return
+			}
+		}
+		frame = previewFrame{data: data, at: time.Now()}
+		h.previews.frames[job.ID] = frame
+
+		// Forget jobs that are no longer being previewed
+		for id, f := range h.previews.frames {
+			if time.Since(f.at) > 10*interval {
+				delete(h.previews.frames, id)
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "private, max-age="+strconv.Itoa(int(interval.Seconds())))
+	w.Write(frame.data)
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/config"
+	"github.com/gwlsn/shrinkray/internal/selfcheck"
+)
+
+// SetConfigLoader enables /api/config/validate and /api/config/reload.
+// load re-reads the config file with the server's command-line overrides.
+func (h *Handler) SetConfigLoader(load func() (*config.Config, error)) {
+	h.loadConfig = load
+}
+
+// checkConfigFile loads the config file and self-checks it: ffmpeg and
+// ffprobe run, the media path is mounted and writable, the temp path is
+// writable with enough free space. Writes an error response and returns nil
+// if the file can't be loaded.
+func (h *Handler) checkConfigFile(w http.ResponseWriter, r *http.Request) (*config.Config, *selfcheck.Report) {
+	if h.loadConfig == nil {
+		writeError(w, http.StatusServiceUnavailable, "config reload is not available")
+		return nil, nil
+	}
+	newCfg, err := h.loadConfig()
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, "failed to load config: "+err.Error())
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+	return newCfg, selfcheck.Run(ctx, newCfg)
+}
+
+// ValidateConfig handles POST /api/config/validate
+// Re-reads the config file and reports whether it would pass the self-check,
+// without applying it.
+func (h *Handler) ValidateConfig(w http.ResponseWriter, r *http.Request) {
+	_, report := h.checkConfigFile(w, r)
+	if report == nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"valid":  report.Status != selfcheck.StatusFail,
+		"report": report,
+	})
+}
+
+// ReloadConfig handles POST /api/config/reload
+// Re-reads the config file and, if no self-check fails, applies it: worker
+// count, notification and integration settings and the rest take effect
+// without a restart. A failing config is rejected with 422 and its report.
+func (h *Handler) ReloadConfig(w http.ResponseWriter, r *http.Request) {
+	newCfg, report := h.checkConfigFile(w, r)
+	if report == nil {
+		return
+	}
+	if report.Status == selfcheck.StatusFail {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+			"error":  "config failed validation; not applied",
+			"report": report,
+		})
+		return
+	}
+
+	h.ApplyConfig(newCfg)
+	h.selfCheck.Store(report)
+	apiLog.Info("Config reloaded", "path", h.cfgPath)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status": "reloaded",
+		"report": report,
+	})
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gwlsn/shrinkray/internal/remote"
+)
+
+// SetRemote enables the /api/remote endpoints for remote agents
+func (h *Handler) SetRemote(coordinator *remote.Coordinator) {
+	h.remote = coordinator
+}
+
+// remoteAuth checks the shared agent token. Remote endpoints bypass the
+// session auth middleware, so this is their only protection.
+func (h *Handler) remoteAuth(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.remote == nil || h.cfg.Remote.Token == "" {
+			writeError(w, http.StatusNotFound, "remote workers are not enabled")
+			return
+		}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(h.cfg.Remote.Token)) != 1 {
+			writeError(w, http.StatusUnauthorized, "invalid remote token")
+			return
+		}
+		next(w, r)
+	})
+}
+
+// writeRemoteError maps coordinator errors to status codes agents act on
+func writeRemoteError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, remote.ErrUnknownAgent):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, remote.ErrLeaseLost):
+		writeError(w, http.StatusGone, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// RemoteRegister handles POST /api/remote/register
+func (h *Handler) RemoteRegister(w http.ResponseWriter, r *http.Request) {
+	var req remote.RegisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	agent := h.remote.Register(req)
+	writeJSON(w, http.StatusOK, remote.RegisterResponse{AgentID: agent.ID})
+}
+
+// RemoteClaim handles POST /api/remote/claim
+// Returns 204 when there is no job to hand out.
+func (h *Handler) RemoteClaim(w http.ResponseWriter, r *http.Request) {
+	var req remote.ClaimRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	assignment, err := h.remote.Claim(req.AgentID)
+	if err != nil {
+		writeRemoteError(w, err)
+		return
+	}
+	if assignment == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, http.StatusOK, assignment)
+}
+
+// RemoteSource handles GET /api/remote/jobs/{id}/source
+// Range requests are supported so agents can resume broken downloads.
+func (h *Handler) RemoteSource(w http.ResponseWriter, r *http.Request) {
+	path, err := h.remote.Source(r.Header.Get(remote.AgentHeader), r.PathValue("id"))
+	if err != nil {
+		writeRemoteError(w, err)
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, filepath.Base(path), info.ModTime(), f)
+}
+
+// RemoteProgress handles POST /api/remote/jobs/{id}/progress
+func (h *Handler) RemoteProgress(w http.ResponseWriter, r *http.Request) {
+	var report remote.ProgressReport
+	if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if err := h.remote.Progress(r.Header.Get(remote.AgentHeader), r.PathValue("id"), report); err != nil {
+		writeRemoteError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RemoteResult handles PUT /api/remote/jobs/{id}/result
+// The body is the transcoded file.
+func (h *Handler) RemoteResult(w http.ResponseWriter, r *http.Request) {
+	if err := h.remote.Complete(r.Header.Get(remote.AgentHeader), r.PathValue("id"), r.Body, r.ContentLength); err != nil {
+		writeRemoteError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RemoteFail handles POST /api/remote/jobs/{id}/fail
+func (h *Handler) RemoteFail(w http.ResponseWriter, r *http.Request) {
+	var report remote.FailReport
+	if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if err := h.remote.Fail(r.Header.Get(remote.AgentHeader), r.PathValue("id"), report); err != nil {
+		writeRemoteError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListAgents handles GET /api/agents
+func (h *Handler) ListAgents(w http.ResponseWriter, r *http.Request) {
+	if h.remote == nil {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"enabled": false, "agents": []remote.Agent{}})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"enabled": true, "agents": h.remote.Agents()})
+}
@@ -25,11 +25,12 @@ func NewRouter(h *Handler, staticFS embed.FS, debugMode bool, authMiddleware *au
 		return authMiddleware.Wrap(handler)
 	}
 
-	// Health check
+	// Health (liveness) and readiness checks
 	mux.Handle("GET /healthz", wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("ok"))
 	})))
+	mux.Handle("GET /readyz", wrap(http.HandlerFunc(h.Ready)))
 
 	// Auth callbacks
 	mux.Handle("GET /auth/callback", wrap(auth.CallbackHandler(provider)))
@@ -39,33 +40,91 @@ func NewRouter(h *Handler, staticFS embed.FS, debugMode bool, authMiddleware *au
 	mux.Handle("POST /auth/logout", wrap(auth.LogoutHandler(provider)))
 
 	// API routes
-	mux.Handle("GET /api/browse", wrap(http.HandlerFunc(h.Browse)))
+	mux.Handle("GET /api/openapi.json", wrap(http.HandlerFunc(h.OpenAPI)))
+	mux.Handle("GET /api/browse", wrap(conditional(http.HandlerFunc(h.Browse))))
+	mux.Handle("GET /api/search", wrap(conditional(http.HandlerFunc(h.Search))))
+	mux.Handle("GET /api/thumb", wrap(http.HandlerFunc(h.Thumbnail)))
 	mux.Handle("GET /api/presets", wrap(http.HandlerFunc(h.Presets)))
+	mux.Handle("POST /api/presets/{id}/test", wrap(http.HandlerFunc(h.TestPreset)))
 	mux.Handle("GET /api/encoders", wrap(http.HandlerFunc(h.Encoders)))
+	mux.Handle("POST /api/encoders/redetect", wrap(http.HandlerFunc(h.RedetectEncoders)))
 
-	mux.Handle("GET /api/jobs", wrap(http.HandlerFunc(h.ListJobs)))
+	mux.Handle("GET /api/jobs", wrap(conditional(http.HandlerFunc(h.ListJobs))))
 	mux.Handle("POST /api/jobs", wrap(http.HandlerFunc(h.CreateJobs)))
 	mux.Handle("GET /api/jobs/stream", wrap(http.HandlerFunc(h.JobStream)))
+	mux.Handle("GET /api/jobs/changes", wrap(http.HandlerFunc(h.JobChanges)))
+	mux.Handle("GET /api/jobs/ws", wrap(http.HandlerFunc(h.JobSocket)))
 	mux.Handle("POST /api/jobs/clear", wrap(http.HandlerFunc(h.ClearQueue)))
-	mux.Handle("GET /api/jobs/{id}", wrap(http.HandlerFunc(h.GetJob)))
-	mux.Handle("DELETE /api/jobs/{id}", wrap(http.HandlerFunc(h.CancelJob)))
-	mux.Handle("POST /api/jobs/{id}/pause", wrap(http.HandlerFunc(h.PauseJob)))
-	mux.Handle("POST /api/jobs/{id}/resume", wrap(http.HandlerFunc(h.ResumeJob)))
-	mux.Handle("POST /api/jobs/{id}/retry", wrap(http.HandlerFunc(h.RetryJob)))
-	mux.Handle("POST /api/jobs/{id}/force", wrap(http.HandlerFunc(h.ForceRetryJob)))
-	mux.Handle("POST /api/jobs/{id}/retry-preset", wrap(http.HandlerFunc(h.RetryWithPreset)))
-	mux.Handle("POST /api/jobs/{id}/reorder", wrap(http.HandlerFunc(h.ReorderJob)))
-	mux.Handle("POST /api/jobs/{id}/move", wrap(http.HandlerFunc(h.MoveJob)))
+	mux.Handle("POST /api/jobs/fit", wrap(http.HandlerFunc(h.FitJobs)))
+	mux.Handle("GET /api/jobs/{id}", wrap(conditional(h.jobAccess(h.GetJob))))
+	mux.Handle("GET /api/jobs/{id}/preview", wrap(h.jobAccess(h.JobPreview)))
+	mux.Handle("GET /api/jobs/{id}/attempts", wrap(h.jobAccess(h.GetJobAttempts)))
+	mux.Handle("GET /api/jobs/{id}/timeline", wrap(h.jobAccess(h.GetJobTimeline)))
+	mux.Handle("PATCH /api/jobs/{id}", wrap(h.jobAccess(h.UpdateJob)))
+	mux.Handle("DELETE /api/jobs/{id}", wrap(h.jobAccess(h.CancelJob)))
+	mux.Handle("POST /api/jobs/{id}/pause", wrap(h.jobAccess(h.PauseJob)))
+	mux.Handle("POST /api/jobs/{id}/resume", wrap(h.jobAccess(h.ResumeJob)))
+	mux.Handle("POST /api/jobs/{id}/retry", wrap(h.jobAccess(h.RetryJob)))
+	mux.Handle("POST /api/jobs/{id}/force", wrap(h.jobAccess(h.ForceRetryJob)))
+	mux.Handle("POST /api/jobs/{id}/retry-preset", wrap(h.jobAccess(h.RetryWithPreset)))
+	mux.Handle("POST /api/jobs/{id}/reorder", wrap(h.jobAccess(h.ReorderJob)))
+	mux.Handle("POST /api/jobs/{id}/move", wrap(h.jobAccess(h.MoveJob)))
+	mux.Handle("GET /api/batches", wrap(http.HandlerFunc(h.ListBatches)))
+	mux.Handle("GET /api/batches/{id}", wrap(http.HandlerFunc(h.GetBatch)))
+	mux.Handle("POST /api/batches/{id}/cancel", wrap(http.HandlerFunc(h.CancelBatch)))
+	mux.Handle("POST /api/batches/{id}/pause", wrap(http.HandlerFunc(h.PauseBatch)))
+	mux.Handle("POST /api/batches/{id}/resume", wrap(http.HandlerFunc(h.ResumeBatch)))
+	mux.Handle("GET /api/processed", wrap(http.HandlerFunc(h.ListProcessed)))
+	mux.Handle("DELETE /api/processed", wrap(http.HandlerFunc(h.UnmarkProcessed)))
 	mux.Handle("POST /api/processed/clear", wrap(http.HandlerFunc(h.ClearProcessedHistory)))
 	mux.Handle("POST /api/processed/mark", wrap(http.HandlerFunc(h.MarkProcessed)))
 
 	mux.Handle("GET /api/config", wrap(http.HandlerFunc(h.GetConfig)))
 	mux.Handle("PUT /api/config", wrap(http.HandlerFunc(h.UpdateConfig)))
+	mux.Handle("POST /api/config/validate", wrap(http.HandlerFunc(h.ValidateConfig)))
+	mux.Handle("POST /api/config/reload", wrap(http.HandlerFunc(h.ReloadConfig)))
+	mux.Handle("GET /api/auth/sessions", wrap(http.HandlerFunc(h.ListSessions)))
+	mux.Handle("DELETE /api/auth/sessions/{id}", wrap(http.HandlerFunc(h.RevokeSession)))
+	mux.Handle("POST /api/auth/sessions/revoke-all", wrap(http.HandlerFunc(h.RevokeAllSessions)))
+	mux.Handle("GET /api/logs", wrap(http.HandlerFunc(h.GetLogs)))
+	mux.Handle("GET /api/logs/stream", wrap(http.HandlerFunc(h.LogStream)))
+	mux.Handle("GET /api/logs/level", wrap(http.HandlerFunc(h.GetLogLevel)))
+	mux.Handle("PUT /api/logs/level", wrap(http.HandlerFunc(h.SetLogLevel)))
 
 	mux.Handle("GET /api/stats", wrap(http.HandlerFunc(h.Stats)))
+	mux.Handle("GET /api/stats/history", wrap(conditional(http.HandlerFunc(h.StatsHistory))))
+	mux.Handle("GET /api/stats/presets", wrap(conditional(http.HandlerFunc(h.PresetStats))))
+	mux.Handle("GET /api/stats/estimates", wrap(conditional(http.HandlerFunc(h.EstimateStats))))
+	mux.Handle("GET /api/queue/simulate", wrap(conditional(http.HandlerFunc(h.SimulateQueue))))
+	mux.Handle("GET /api/rules", wrap(http.HandlerFunc(h.ListRules)))
+	mux.Handle("POST /api/rules/{id}/run", wrap(http.HandlerFunc(h.RunRule)))
+	mux.Handle("POST /api/scan", wrap(http.HandlerFunc(h.StartScan)))
+	mux.Handle("DELETE /api/scan", wrap(http.HandlerFunc(h.CancelScan)))
+	mux.Handle("GET /api/scan/status", wrap(http.HandlerFunc(h.ScanStatus)))
+	mux.Handle("GET /api/scan/reports", wrap(conditional(http.HandlerFunc(h.ScanReports))))
+	mux.Handle("GET /api/scan/report", wrap(conditional(http.HandlerFunc(h.ScanReport))))
+	mux.Handle("GET /api/originals", wrap(http.HandlerFunc(h.ListOriginals)))
+	mux.Handle("POST /api/originals/{id}/verify", wrap(http.HandlerFunc(h.VerifyOriginal)))
+	mux.Handle("DELETE /api/originals/{id}", wrap(http.HandlerFunc(h.DeleteOriginal)))
+	mux.Handle("GET /api/trash", wrap(http.HandlerFunc(h.ListTrash)))
+	mux.Handle("POST /api/jobs/{id}/restore", wrap(h.jobAccess(h.RestoreJob)))
+	mux.Handle("GET /api/cache/stats", wrap(http.HandlerFunc(h.CacheStats)))
+	mux.Handle("GET /api/selfcheck", wrap(http.HandlerFunc(h.SelfCheck)))
 	mux.Handle("POST /api/cache/clear", wrap(http.HandlerFunc(h.ClearCache)))
 	mux.Handle("POST /api/pushover/test", wrap(http.HandlerFunc(h.TestPushover)))
 	mux.Handle("POST /api/ntfy/test", wrap(http.HandlerFunc(h.TestNtfy)))
+	mux.Handle("POST /api/integrations/{name}/test", wrap(http.HandlerFunc(h.TestIntegration)))
+	mux.Handle("GET /api/agents", wrap(http.HandlerFunc(h.ListAgents)))
+	mux.Handle("GET /api/workers", wrap(http.HandlerFunc(h.ListWorkers)))
+	mux.Handle("POST /api/workers/{id}/drain", wrap(http.HandlerFunc(h.DrainWorker)))
+
+	// Remote agents authenticate with the shared token, not a session
+	mux.Handle("POST /api/remote/register", h.remoteAuth(h.RemoteRegister))
+	mux.Handle("POST /api/remote/claim", h.remoteAuth(h.RemoteClaim))
+	mux.Handle("GET /api/remote/jobs/{id}/source", h.remoteAuth(h.RemoteSource))
+	mux.Handle("POST /api/remote/jobs/{id}/progress", h.remoteAuth(h.RemoteProgress))
+	mux.Handle("PUT /api/remote/jobs/{id}/result", h.remoteAuth(h.RemoteResult))
+	mux.Handle("POST /api/remote/jobs/{id}/fail", h.remoteAuth(h.RemoteFail))
 
 	// Determine which UI to serve
 	uiPath := "web/templates"
@@ -124,6 +183,21 @@ func NewRouter(h *Handler, staticFS embed.FS, debugMode bool, authMiddleware *au
 	return mux
 }
 
+// WithBasePath serves h under basePath (e.g. "/shrinkray"), with the
+// prefix stripped before h sees the request. The health checks are also
+// answered at the root, for container health checks. "" returns h.
+func WithBasePath(h http.Handler, basePath string) http.Handler {
+	if basePath == "" {
+		return h
+	}
+	mux := http.NewServeMux()
+	mux.Handle(basePath+"/", http.StripPrefix(basePath, h))
+	mux.Handle(basePath, http.RedirectHandler(basePath+"/", http.StatusMovedPermanently))
+	mux.Handle("GET /healthz", h)
+	mux.Handle("GET /readyz", h)
+	return mux
+}
+
 // NewRouterWithoutStatic creates a router without static file serving (for testing)
 func NewRouterWithoutStatic(h *Handler, authMiddleware *auth.Middleware) *http.ServeMux {
 	mux := http.NewServeMux()
@@ -140,11 +214,12 @@ func NewRouterWithoutStatic(h *Handler, authMiddleware *auth.Middleware) *http.S
 		return authMiddleware.Wrap(handler)
 	}
 
-	// Health check
+	// Health (liveness) and readiness checks
 	mux.Handle("GET /healthz", wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("ok"))
 	})))
+	mux.Handle("GET /readyz", wrap(http.HandlerFunc(h.Ready)))
 
 	// Auth callbacks
 	mux.Handle("GET /auth/callback", wrap(auth.CallbackHandler(provider)))
@@ -154,33 +229,91 @@ func NewRouterWithoutStatic(h *Handler, authMiddleware *auth.Middleware) *http.S
 	mux.Handle("POST /auth/logout", wrap(auth.LogoutHandler(provider)))
 
 	// API routes
-	mux.Handle("GET /api/browse", wrap(http.HandlerFunc(h.Browse)))
+	mux.Handle("GET /api/openapi.json", wrap(http.HandlerFunc(h.OpenAPI)))
+	mux.Handle("GET /api/browse", wrap(conditional(http.HandlerFunc(h.Browse))))
+	mux.Handle("GET /api/search", wrap(conditional(http.HandlerFunc(h.Search))))
+	mux.Handle("GET /api/thumb", wrap(http.HandlerFunc(h.Thumbnail)))
 	mux.Handle("GET /api/presets", wrap(http.HandlerFunc(h.Presets)))
+	mux.Handle("POST /api/presets/{id}/test", wrap(http.HandlerFunc(h.TestPreset)))
 	mux.Handle("GET /api/encoders", wrap(http.HandlerFunc(h.Encoders)))
+	mux.Handle("POST /api/encoders/redetect", wrap(http.HandlerFunc(h.RedetectEncoders)))
 
-	mux.Handle("GET /api/jobs", wrap(http.HandlerFunc(h.ListJobs)))
+	mux.Handle("GET /api/jobs", wrap(conditional(http.HandlerFunc(h.ListJobs))))
 	mux.Handle("POST /api/jobs", wrap(http.HandlerFunc(h.CreateJobs)))
 	mux.Handle("GET /api/jobs/stream", wrap(http.HandlerFunc(h.JobStream)))
+	mux.Handle("GET /api/jobs/changes", wrap(http.HandlerFunc(h.JobChanges)))
+	mux.Handle("GET /api/jobs/ws", wrap(http.HandlerFunc(h.JobSocket)))
 	mux.Handle("POST /api/jobs/clear", wrap(http.HandlerFunc(h.ClearQueue)))
-	mux.Handle("GET /api/jobs/{id}", wrap(http.HandlerFunc(h.GetJob)))
-	mux.Handle("DELETE /api/jobs/{id}", wrap(http.HandlerFunc(h.CancelJob)))
-	mux.Handle("POST /api/jobs/{id}/pause", wrap(http.HandlerFunc(h.PauseJob)))
-	mux.Handle("POST /api/jobs/{id}/resume", wrap(http.HandlerFunc(h.ResumeJob)))
-	mux.Handle("POST /api/jobs/{id}/retry", wrap(http.HandlerFunc(h.RetryJob)))
-	mux.Handle("POST /api/jobs/{id}/force", wrap(http.HandlerFunc(h.ForceRetryJob)))
-	mux.Handle("POST /api/jobs/{id}/retry-preset", wrap(http.HandlerFunc(h.RetryWithPreset)))
-	mux.Handle("POST /api/jobs/{id}/reorder", wrap(http.HandlerFunc(h.ReorderJob)))
-	mux.Handle("POST /api/jobs/{id}/move", wrap(http.HandlerFunc(h.MoveJob)))
+	mux.Handle("POST /api/jobs/fit", wrap(http.HandlerFunc(h.FitJobs)))
+	mux.Handle("GET /api/jobs/{id}", wrap(conditional(h.jobAccess(h.GetJob))))
+	mux.Handle("GET /api/jobs/{id}/preview", wrap(h.jobAccess(h.JobPreview)))
+	mux.Handle("GET /api/jobs/{id}/attempts", wrap(h.jobAccess(h.GetJobAttempts)))
+	mux.Handle("GET /api/jobs/{id}/timeline", wrap(h.jobAccess(h.GetJobTimeline)))
+	mux.Handle("PATCH /api/jobs/{id}", wrap(h.jobAccess(h.UpdateJob)))
+	mux.Handle("DELETE /api/jobs/{id}", wrap(h.jobAccess(h.CancelJob)))
+	mux.Handle("POST /api/jobs/{id}/pause", wrap(h.jobAccess(h.PauseJob)))
+	mux.Handle("POST /api/jobs/{id}/resume", wrap(h.jobAccess(h.ResumeJob)))
+	mux.Handle("POST /api/jobs/{id}/retry", wrap(h.jobAccess(h.RetryJob)))
+	mux.Handle("POST /api/jobs/{id}/force", wrap(h.jobAccess(h.ForceRetryJob)))
+	mux.Handle("POST /api/jobs/{id}/retry-preset", wrap(h.jobAccess(h.RetryWithPreset)))
+	mux.Handle("POST /api/jobs/{id}/reorder", wrap(h.jobAccess(h.ReorderJob)))
+	mux.Handle("POST /api/jobs/{id}/move", wrap(h.jobAccess(h.MoveJob)))
+	mux.Handle("GET /api/batches", wrap(http.HandlerFunc(h.ListBatches)))
+	mux.Handle("GET /api/batches/{id}", wrap(http.HandlerFunc(h.GetBatch)))
+	mux.Handle("POST /api/batches/{id}/cancel", wrap(http.HandlerFunc(h.CancelBatch)))
+	mux.Handle("POST /api/batches/{id}/pause", wrap(http.HandlerFunc(h.PauseBatch)))
+	mux.Handle("POST /api/batches/{id}/resume", wrap(http.HandlerFunc(h.ResumeBatch)))
+	mux.Handle("GET /api/processed", wrap(http.HandlerFunc(h.ListProcessed)))
+	mux.Handle("DELETE /api/processed", wrap(http.HandlerFunc(h.UnmarkProcessed)))
 	mux.Handle("POST /api/processed/clear", wrap(http.HandlerFunc(h.ClearProcessedHistory)))
 	mux.Handle("POST /api/processed/mark", wrap(http.HandlerFunc(h.MarkProcessed)))
 
 	mux.Handle("GET /api/config", wrap(http.HandlerFunc(h.GetConfig)))
 	mux.Handle("PUT /api/config", wrap(http.HandlerFunc(h.UpdateConfig)))
+	mux.Handle("POST /api/config/validate", wrap(http.HandlerFunc(h.ValidateConfig)))
+	mux.Handle("POST /api/config/reload", wrap(http.HandlerFunc(h.ReloadConfig)))
+	mux.Handle("GET /api/auth/sessions", wrap(http.HandlerFunc(h.ListSessions)))
+	mux.Handle("DELETE /api/auth/sessions/{id}", wrap(http.HandlerFunc(h.RevokeSession)))
+	mux.Handle("POST /api/auth/sessions/revoke-all", wrap(http.HandlerFunc(h.RevokeAllSessions)))
+	mux.Handle("GET /api/logs", wrap(http.HandlerFunc(h.GetLogs)))
+	mux.Handle("GET /api/logs/stream", wrap(http.HandlerFunc(h.LogStream)))
+	mux.Handle("GET /api/logs/level", wrap(http.HandlerFunc(h.GetLogLevel)))
+	mux.Handle("PUT /api/logs/level", wrap(http.HandlerFunc(h.SetLogLevel)))
 
 	mux.Handle("GET /api/stats", wrap(http.HandlerFunc(h.Stats)))
+	mux.Handle("GET /api/stats/history", wrap(conditional(http.HandlerFunc(h.StatsHistory))))
+	mux.Handle("GET /api/stats/presets", wrap(conditional(http.HandlerFunc(h.PresetStats))))
+	mux.Handle("GET /api/stats/estimates", wrap(conditional(http.HandlerFunc(h.EstimateStats))))
+	mux.Handle("GET /api/queue/simulate", wrap(conditional(http.HandlerFunc(h.SimulateQueue))))
+	mux.Handle("GET /api/rules", wrap(http.HandlerFunc(h.ListRules)))
+	mux.Handle("POST /api/rules/{id}/run", wrap(http.HandlerFunc(h.RunRule)))
+	mux.Handle("POST /api/scan", wrap(http.HandlerFunc(h.StartScan)))
+	mux.Handle("DELETE /api/scan", wrap(http.HandlerFunc(h.CancelScan)))
+	mux.Handle("GET /api/scan/status", wrap(http.HandlerFunc(h.ScanStatus)))
+	mux.Handle("GET /api/scan/reports", wrap(conditional(http.HandlerFunc(h.ScanReports))))
+	mux.Handle("GET /api/scan/report", wrap(conditional(http.HandlerFunc(h.ScanReport))))
+	mux.Handle("GET /api/originals", wrap(http.HandlerFunc(h.ListOriginals)))
+	mux.Handle("POST /api/originals/{id}/verify", wrap(http.HandlerFunc(h.VerifyOriginal)))
+	mux.Handle("DELETE /api/originals/{id}", wrap(http.HandlerFunc(h.DeleteOriginal)))
+	mux.Handle("GET /api/trash", wrap(http.HandlerFunc(h.ListTrash)))
+	mux.Handle("POST /api/jobs/{id}/restore", wrap(h.jobAccess(h.RestoreJob)))
+	mux.Handle("GET /api/cache/stats", wrap(http.HandlerFunc(h.CacheStats)))
+	mux.Handle("GET /api/selfcheck", wrap(http.HandlerFunc(h.SelfCheck)))
 	mux.Handle("POST /api/cache/clear", wrap(http.HandlerFunc(h.ClearCache)))
 	mux.Handle("POST /api/pushover/test", wrap(http.HandlerFunc(h.TestPushover)))
 	mux.Handle("POST /api/ntfy/test", wrap(http.HandlerFunc(h.TestNtfy)))
+	mux.Handle("POST /api/integrations/{name}/test", wrap(http.HandlerFunc(h.TestIntegration)))
+	mux.Handle("GET /api/agents", wrap(http.HandlerFunc(h.ListAgents)))
+	mux.Handle("GET /api/workers", wrap(http.HandlerFunc(h.ListWorkers)))
+	mux.Handle("POST /api/workers/{id}/drain", wrap(http.HandlerFunc(h.DrainWorker)))
+
+	// Remote agents authenticate with the shared token, not a session
+	mux.Handle("POST /api/remote/register", h.remoteAuth(h.RemoteRegister))
+	mux.Handle("POST /api/remote/claim", h.remoteAuth(h.RemoteClaim))
+	mux.Handle("GET /api/remote/jobs/{id}/source", h.remoteAuth(h.RemoteSource))
+	mux.Handle("POST /api/remote/jobs/{id}/progress", h.remoteAuth(h.RemoteProgress))
+	mux.Handle("PUT /api/remote/jobs/{id}/result", h.remoteAuth(h.RemoteResult))
+	mux.Handle("POST /api/remote/jobs/{id}/fail", h.remoteAuth(h.RemoteFail))
 
 	return mux
 }
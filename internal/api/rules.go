@@ -0,0 +1,115 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/browse"
+	"github.com/gwlsn/shrinkray/internal/config"
+	"github.com/gwlsn/shrinkray/internal/ffmpeg"
+	"github.com/gwlsn/shrinkray/internal/jobs"
+)
+
+// ListRules handles GET /api/rules
+func (h *Handler) ListRules(w http.ResponseWriter, r *http.Request) {
+	rules := h.cfg.Rules
+	if rules == nil {
+		rules = []config.Rule{}
+	}
+	writeJSON(w, http.StatusOK, rules)
+}
+
+// RunRule handles POST /api/rules/{id}/run?dry_run=true
+// Probes the files under the rule's path, filters them by its criteria
+// (skipping already queued files, and processed ones unless the rule opts
+// in), then queues the matches. dry_run=true only reports the matches.
+func (h *Handler) RunRule(w http.ResponseWriter, r *http.Request) {
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+	if !dryRun && h.refuseWhileShuttingDown(w) {
+		return
+	}
+	id := r.PathValue("id")
+	var rule *config.Rule
+	for i := range h.cfg.Rules {
+		if h.cfg.Rules[i].ID == id {
+			rule = &h.cfg.Rules[i]
+			break
+		}
+	}
+	if rule == nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("rule not found: %s", id))
+		return
+	}
+
+	preset := ffmpeg.GetPreset(rule.Preset)
+	if preset == nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("rule %s uses unknown preset: %s", rule.ID, rule.Preset))
+		return
+	}
+
+	path := rule.Path
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(h.cfg.MediaPath, path)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Minute)
+	defer cancel()
+
+	probes, err := h.browser.GetVideoFilesWithOptions(ctx, []string{path}, browse.GetVideoFilesOptions{Recursive: !rule.NoRecurse})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var processedPaths map[string]struct{}
+	if !rule.IncludeProcessed {
+		processedPaths = h.queue.ProcessedPaths()
+		if h.cfg.FingerprintProcessed {
+			sizes := make(map[string]int64, len(probes))
+			for _, probe := range probes {
+				sizes[probe.Path] = probe.Size
+			}
+			processedPaths = h.recognizeProcessed(processedPaths, sizes)
+		}
+	}
+	queuedPaths := h.queue.EnqueuedPaths()
+
+	matches := make([]*ffmpeg.ProbeResult, 0)
+	for _, probe := range jobs.FilterByRule(*rule, probes) {
+		if _, ok := processedPaths[probe.Path]; ok {
+			continue
+		}
+		if _, ok := queuedPaths[probe.Path]; ok {
+			continue
+		}
+		matches = append(matches, probe)
+	}
+
+	queued := 0
+	if !dryRun && len(matches) > 0 {
+		// Shutdown may have begun while the files were probed
+		if h.refuseWhileShuttingDown(w) {
+			return
+		}
+		added, err := h.queue.AddMultiple(matches, rule.Preset)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		queued = len(added)
+		apiLog.Info("Rule queued files", "rule", rule.ID, "queued", queued, "matched", len(probes), "path", path)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"rule":     rule,
+		"dry_run":  dryRun,
+		"scanned":  len(probes),
+		"matched":  len(matches),
+		"queued":   queued,
+		"matches":  matches,
+		"estimate": ffmpeg.EstimateMultiple(matches, preset),
+	})
+}
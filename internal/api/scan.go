@@ -0,0 +1,99 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gwlsn/shrinkray/internal/ffmpeg"
+	"github.com/gwlsn/shrinkray/internal/scan"
+)
+
+// SetScanner enables the /api/scan endpoints
+func (h *Handler) SetScanner(scanner *scan.Scanner) {
+	h.scanner = scanner
+}
+
+// StartScan handles POST /api/scan
+// Body (optional): {"preset": "compress-hevc"} - preset used for savings estimates
+func (h *Handler) StartScan(w http.ResponseWriter, r *http.Request) {
+	if h.scanner == nil {
+		writeError(w, http.StatusServiceUnavailable, "library scanning is not available")
+		return
+	}
+
+	var req struct {
+		Preset string `json:"preset"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+	}
+	if req.Preset == "" {
+		req.Preset = "compress-hevc"
+	}
+	preset := ffmpeg.GetPreset(req.Preset)
+	if preset == nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown preset: %s", req.Preset))
+		return
+	}
+
+	if err := h.scanner.Start(preset); err != nil {
+		if errors.Is(err, scan.ErrScanRunning) {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, h.scanner.Status())
+}
+
+// CancelScan handles DELETE /api/scan
+func (h *Handler) CancelScan(w http.ResponseWriter, r *http.Request) {
+	if h.scanner == nil {
+		writeError(w, http.StatusServiceUnavailable, "library scanning is not available")
+		return
+	}
+	h.scanner.Cancel()
+	writeJSON(w, http.StatusOK, h.scanner.Status())
+}
+
+// ScanStatus handles GET /api/scan/status
+func (h *Handler) ScanStatus(w http.ResponseWriter, r *http.Request) {
+	if h.scanner == nil {
+		writeError(w, http.StatusServiceUnavailable, "library scanning is not available")
+		return
+	}
+	writeJSON(w, http.StatusOK, h.scanner.Status())
+}
+
+// ScanReports handles GET /api/scan/reports
+func (h *Handler) ScanReports(w http.ResponseWriter, r *http.Request) {
+	if h.scanner == nil {
+		writeError(w, http.StatusServiceUnavailable, "library scanning is not available")
+		return
+	}
+	writeJSON(w, http.StatusOK, h.scanner.Reports())
+}
+
+// ScanReport handles GET /api/scan/report?id=... (latest report when id is omitted)
+func (h *Handler) ScanReport(w http.ResponseWriter, r *http.Request) {
+	if h.scanner == nil {
+		writeError(w, http.StatusServiceUnavailable, "library scanning is not available")
+		return
+	}
+	report, err := h.scanner.Report(r.URL.Query().Get("id"))
+	if err != nil {
+		if errors.Is(err, scan.ErrReportNotFound) {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
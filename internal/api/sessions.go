@@ -0,0 +1,91 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gwlsn/shrinkray/internal/auth"
+)
+
+// SetSessionStore enables the /api/auth/sessions endpoints
+func (h *Handler) SetSessionStore(store *auth.SessionStore) {
+	h.sessions = store
+}
+
+// sessionInfo is a stored session, marked if it's the requester's
+type sessionInfo struct {
+	*auth.Session
+	Current bool `json:"current"`
+}
+
+// sessionUser returns the logged-in user managing sessions, writing an
+// error if there is none or sessions aren't stored
+func (h *Handler) sessionUser(w http.ResponseWriter, r *http.Request) (*auth.User, bool) {
+	if h.sessions == nil {
+		writeError(w, http.StatusServiceUnavailable, "server-side sessions are not enabled (auth.session_store)")
+		return nil, false
+	}
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "sessions can only be managed when logged in")
+		return nil, false
+	}
+	return user, true
+}
+
+// ListSessions handles GET /api/auth/sessions
+// Lists the user's active logins, most recently seen first; admin_users see
+// everyone's.
+func (h *Handler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.sessionUser(w, r)
+	if !ok {
+		return
+	}
+	admin := h.isAdmin(user)
+
+	sessions := h.sessions.List()
+	result := make([]sessionInfo, 0, len(sessions))
+	for _, session := range sessions {
+		if admin || session.UserID == user.ID {
+			result = append(result, sessionInfo{Session: session, Current: session.ID == user.SessionID})
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"sessions": result,
+		"count":    len(result),
+	})
+}
+
+// RevokeSession handles DELETE /api/auth/sessions/{id}
+// Ends one of the user's sessions (anyone's, for admin_users); its cookie
+// stops working on the next request.
+func (h *Handler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.sessionUser(w, r)
+	if !ok {
+		return
+	}
+	id := r.PathValue("id")
+	if session, found := h.sessions.Get(id); !found || (session.UserID != user.ID && !h.isAdmin(user)) {
+		writeError(w, http.StatusNotFound, auth.ErrSessionNotFound.Error())
+		return
+	}
+	if err := h.sessions.Revoke(id); err != nil {
+		if errors.Is(err, auth.ErrSessionNotFound) {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "revoked"})
+}
+
+// RevokeAllSessions handles POST /api/auth/sessions/revoke-all
+// Logs the current user out everywhere, including this session.
+func (h *Handler) RevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.sessionUser(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"revoked": h.sessions.RevokeUser(user.ID)})
+}
@@ -4,10 +4,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
+
+	"github.com/gwlsn/shrinkray/internal/jobs"
 )
 
 // JobStream handles GET /api/jobs/stream (SSE endpoint)
+// Each event carries an id. A client reconnecting with Last-Event-ID (or
+// ?last_event_id=, as a new EventSource can't set headers) gets a "resumed"
+// event and the events it missed instead of a fresh "init", if they are
+// still kept.
 func (h *Handler) JobStream(w http.ResponseWriter, r *http.Request) {
 	// Set SSE headers
 	w.Header().Set("Content-Type", "text/event-stream")
@@ -24,18 +31,38 @@ func (h *Handler) JobStream(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Subscribe to job events
-	eventCh := h.queue.Subscribe()
+	viewer := h.jobViewer(r)
+
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id")
+	}
+	var eventCh chan jobs.JobEvent
+	var missed []jobs.JobEvent
+	resumed := false
+	if id, err := strconv.ParseUint(lastID, 10, 64); err == nil {
+		eventCh, missed, resumed = h.queue.SubscribeFrom(id)
+	} else {
+		eventCh = h.queue.Subscribe()
+	}
 	defer h.queue.Unsubscribe(eventCh)
 
-	// Send initial state
-	initialJobs := h.queue.GetAll()
-	initialData, _ := json.Marshal(map[string]interface{}{
-		"type":  "init",
-		"jobs":  initialJobs,
-		"stats": h.queue.Stats(),
-	})
-	fmt.Fprintf(w, "data: %s\n\n", initialData)
+	if resumed {
+		// Replay what the client missed
+		resumedData, _ := json.Marshal(map[string]interface{}{
+			"type":   "resumed",
+			"missed": len(missed),
+		})
+		fmt.Fprintf(w, "data: %s\n\n", resumedData)
+		for _, event := range missed {
+			if visible, ok := h.visibleEvent(viewer, event); ok {
+				writeSSEEvent(w, visible)
+			}
+		}
+	} else {
+		// Send initial state
+		h.writeInit(w, viewer)
+	}
 	flusher.Flush()
 
 	heartbeat := time.NewTicker(10 * time.Second)
@@ -46,6 +73,10 @@ func (h *Handler) JobStream(w http.ResponseWriter, r *http.Request) {
 		select {
 		case <-r.Context().Done():
 			return
+		case <-h.streamsClosed:
+			fmt.Fprint(w, "data: {\"type\":\"shutdown\"}\n\n")
+			flusher.Flush()
+			return
 		case <-heartbeat.C:
 			fmt.Fprint(w, ": ping\n\n")
 			flusher.Flush()
@@ -53,92 +84,51 @@ func (h *Handler) JobStream(w http.ResponseWriter, r *http.Request) {
 			if !ok {
 				return
 			}
-
-			data, err := json.Marshal(event)
-			if err != nil {
+			if event.Type == jobs.EventResync {
+				// This client fell behind; send the full state again
+				h.writeInit(w, viewer)
+				flusher.Flush()
 				continue
 			}
 
-			fmt.Fprintf(w, "data: %s\n\n", data)
-			flusher.Flush()
-
-			// Check if we should send a Pushover notification
-			// This happens when a job completes/fails/cancels and the queue is empty
-			if event.Type == "complete" || event.Type == "failed" || event.Type == "cancelled" {
-				h.checkAndSendNotification(w, flusher)
+			if visible, ok := h.visibleEvent(viewer, event); ok {
+				writeSSEEvent(w, visible)
+				flusher.Flush()
 			}
 		}
 	}
 }
 
-// checkAndSendNotification checks if all jobs are done and sends a Pushover notification if enabled
-func (h *Handler) checkAndSendNotification(w http.ResponseWriter, flusher http.Flusher) {
-	// Lock to prevent multiple concurrent notifications when multiple jobs finish simultaneously
-	h.notifyMu.Lock()
-	defer h.notifyMu.Unlock()
-
-	// Check if notification is enabled and at least one provider is configured
-	if !h.cfg.NotifyOnComplete || (!h.pushover.IsConfigured() && !h.ntfy.IsConfigured()) {
-		return
-	}
-
-	// Check if queue is empty (no pending or running jobs)
-	stats := h.queue.Stats()
-	if stats.Pending > 0 || stats.Running > 0 {
-		return
-	}
-
-	// Queue is empty, send notification
-	message := fmt.Sprintf("%d jobs complete, %d failed\nSaved %s",
-		stats.Complete, stats.Failed, formatBytes(stats.TotalSaved))
-
-	allSent := true
-	if h.pushover.IsConfigured() {
-		if err := h.pushover.Send("Shrinkray Complete", message); err != nil {
-			// Log error but don't crash - leave checkbox checked for retry
-			fmt.Printf("Failed to send Pushover notification: %v\n", err)
-			allSent = false
-		}
-	}
-	if h.ntfy.IsConfigured() {
-		if err := h.ntfy.Send("Shrinkray Complete", message); err != nil {
-			// Log error but don't crash - leave checkbox checked for retry
-			fmt.Printf("Failed to send ntfy notification: %v\n", err)
-			allSent = false
-		}
-	}
+// writeInit writes the init event, with the ID of the latest event
+func (h *Handler) writeInit(w http.ResponseWriter, viewer string) {
+	data, _ := json.Marshal(h.initMessage(viewer))
+	fmt.Fprintf(w, "id: %d\ndata: %s\n\n", h.queue.LastEventID(), data)
+}
 
-	if !allSent {
+// writeSSEEvent writes event with its ID, so the client can resume after it
+func writeSSEEvent(w http.ResponseWriter, event jobs.JobEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
 		return
 	}
-
-	// Notification sent successfully, disable the checkbox
-	h.cfg.NotifyOnComplete = false
-	if h.cfgPath != "" {
-		h.cfg.Save(h.cfgPath)
-	}
-
-	// Broadcast notify_sent event so UI can update the checkbox
-	notifyData, _ := json.Marshal(map[string]interface{}{
-		"type": "notify_sent",
-	})
-	fmt.Fprintf(w, "data: %s\n\n", notifyData)
-	flusher.Flush()
+	fmt.Fprintf(w, "id: %d\ndata: %s\n\n", event.ID, data)
 }
 
-// formatBytes formats bytes into a human-readable string
-func formatBytes(bytes int64) string {
-	if bytes < 0 {
-		bytes = 0
-	}
-	const unit = 1024
-	if bytes < unit {
-		return fmt.Sprintf("%d B", bytes)
+// initMessage builds the init event sent when a stream connects, with the
+// jobs viewer may see. With the paginated_init feature only the first page
+// of jobs is included and the client fetches the rest from /api/jobs.
+func (h *Handler) initMessage(viewer string) map[string]interface{} {
+	msg := map[string]interface{}{
+		"type":  "init",
+		"stats": h.queue.Stats(),
 	}
-	div, exp := int64(unit), 0
-	for n := bytes / unit; n >= unit; n /= unit {
-		div *= unit
-		exp++
+	if h.cfg.Features.PaginatedInit {
+		page, total := h.queue.List(jobs.ListOptions{Page: 1, PageSize: jobs.DefaultPageSize, CreatedBy: viewer})
+		msg["jobs"] = page
+		msg["total"] = total
+		msg["page_size"] = jobs.DefaultPageSize
+	} else {
+		msg["jobs"] = visibleJobs(viewer, h.queue.GetAll())
 	}
-	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+	return msg
 }
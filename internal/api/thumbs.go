@@ -0,0 +1,50 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/browse"
+)
+
+// Thumbnail handles GET /api/thumb?path=
+// Serves a cached poster frame for a video in the file browser.
+func (h *Handler) Thumbnail(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		writeError(w, http.StatusBadRequest, "path is required")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	thumbPath, err := h.browser.Thumbnail(ctx, path)
+	if err != nil {
+		switch {
+		case errors.Is(err, browse.ErrThumbnailsDisabled):
+			writeError(w, http.StatusServiceUnavailable, err.Error())
+		case errors.Is(err, browse.ErrNotVideo), os.IsNotExist(err):
+			writeError(w, http.StatusNotFound, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	f, err := os.Open(thumbPath)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer f.Close()
+
+	// The file's mtime tracks last use, not content, so no Last-Modified;
+	// a replaced source gets a new thumbnail, so a day's caching is safe
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	http.ServeContent(w, r, "", time.Time{}, f)
+}
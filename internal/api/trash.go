@@ -0,0 +1,58 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gwlsn/shrinkray/internal/trash"
+)
+
+// SetTrash enables the /api/trash and /api/jobs/{id}/restore endpoints
+func (h *Handler) SetTrash(store *trash.Store) {
+	h.trash = store
+}
+
+// ListTrash handles GET /api/trash
+// Lists the originals moved to the trash by trash_originals, oldest first.
+func (h *Handler) ListTrash(w http.ResponseWriter, r *http.Request) {
+	if h.trash == nil {
+		writeError(w, http.StatusServiceUnavailable, "trash is not available")
+		return
+	}
+	entries := h.trash.List()
+	var size int64
+	for _, e := range entries {
+		size += e.Size
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"originals":      entries,
+		"count":          len(entries),
+		"size":           size,
+		"retention_days": h.cfg.TrashRetentionDays,
+	})
+}
+
+// RestoreJob handles POST /api/jobs/{id}/restore
+// Undoes a completed transcode whose original is in the trash: the original
+// is moved back and the transcoded file removed.
+func (h *Handler) RestoreJob(w http.ResponseWriter, r *http.Request) {
+	if h.trash == nil {
+		writeError(w, http.StatusServiceUnavailable, "trash is not available")
+		return
+	}
+	entry, err := h.trash.Restore(r.PathValue("id"))
+	if err != nil {
+		if errors.Is(err, trash.ErrNotFound) {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	// The original is back, and isn't to be mistaken for the transcode
+	h.queue.ForgetOutput(entry.OutputPath)
+	h.browser.InvalidateCache(entry.OriginalPath)
+	h.browser.InvalidateCache(entry.OutputPath)
+	writeJSON(w, http.StatusOK, entry)
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gwlsn/shrinkray/internal/autoscale"
+	"github.com/gwlsn/shrinkray/internal/jobs"
+)
+
+// SetAutoscaler reports the autoscaler's state in /api/workers
+func (h *Handler) SetAutoscaler(scaler *autoscale.Scaler) {
+	h.autoscaler = scaler
+}
+
+// ListWorkers handles GET /api/workers
+// Returns each local worker's current job, encoder, decode→encode path,
+// GPU device, fps/speed and uptime, and the autoscaler's latest load sample
+// and decision.
+func (h *Handler) ListWorkers(w http.ResponseWriter, r *http.Request) {
+	resp := map[string]interface{}{
+		"workers": h.workerPool.Workers(),
+	}
+	if h.autoscaler != nil {
+		resp["autoscale"] = h.autoscaler.Status()
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// DrainWorker handles POST /api/workers/{id}/drain
+// The worker finishes its current job and is then removed from the pool.
+func (h *Handler) DrainWorker(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid worker ID")
+		return
+	}
+	if err := h.workerPool.DrainWorker(id); err != nil {
+		if errors.Is(err, jobs.ErrWorkerNotFound) {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "draining"})
+}
@@ -0,0 +1,186 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/jobs"
+	"github.com/gwlsn/shrinkray/internal/logger"
+)
+
+var wsLog = logger.For("ws")
+
+// wsFilter selects which events a WebSocket client receives.
+// Clients update it by sending {"type":"filter", ...} at any time.
+type wsFilter struct {
+	// Events limits delivery to these event types (empty = all)
+	Events []string `json:"events"`
+	// ProgressJobs limits progress events to these job IDs; nil sends
+	// progress for every job, an empty list sends none.
+	ProgressJobs []string `json:"progress_jobs"`
+}
+
+// wsSubscription is the current filter for one connection
+type wsSubscription struct {
+	mu       sync.Mutex
+	events   map[string]bool
+	progress map[string]bool // nil = all jobs
+}
+
+func (s *wsSubscription) set(f wsFilter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.events = nil
+	if len(f.Events) > 0 {
+		s.events = make(map[string]bool, len(f.Events))
+		for _, e := range f.Events {
+			s.events[e] = true
+		}
+	}
+	s.progress = nil
+	if f.ProgressJobs != nil {
+		s.progress = make(map[string]bool, len(f.ProgressJobs))
+		for _, id := range f.ProgressJobs {
+			s.progress[id] = true
+		}
+	}
+}
+
+// filter narrows event to what the client asked for, reporting false if
+// nothing is left. "progress" covers "progress_batch" too.
+func (s *wsSubscription) filter(event jobs.JobEvent) (jobs.JobEvent, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	eventType := event.Type
+	if eventType == "progress_batch" {
+		eventType = "progress"
+	}
+	if s.events != nil && !s.events[eventType] {
+		return event, false
+	}
+	if event.Type == "progress" && s.progress != nil {
+		id := ""
+		if event.ProgressUpdate != nil {
+			id = event.ProgressUpdate.ID
+		} else if event.Job != nil {
+			id = event.Job.ID
+		}
+		return event, s.progress[id]
+	}
+	if event.Type == "progress_batch" && s.progress != nil {
+		batch := make([]jobs.ProgressUpdate, 0, len(event.ProgressBatch))
+		for _, update := range event.ProgressBatch {
+			if s.progress[update.ID] {
+				batch = append(batch, update)
+			}
+		}
+		event.ProgressBatch = batch
+		return event, len(batch) > 0
+	}
+	return event, true
+}
+
+// JobSocket handles GET /api/jobs/ws: the /api/jobs/stream events over a
+// WebSocket, for reverse proxies that buffer SSE. The initial filter can be
+// given as ?events=complete,failed; messages like
+// {"type":"filter","events":["progress"],"progress_jobs":["id"]} change it.
+func (h *Handler) JobSocket(w http.ResponseWriter, r *http.Request) {
+	if !originAllowed(r, h.cfg.Access.AllowedOrigins) {
+		writeError(w, http.StatusForbidden, "cross-origin websocket refused")
+		return
+	}
+	conn, err := upgradeWebSocket(w, r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer conn.close()
+
+	sub := &wsSubscription{}
+	if events := r.URL.Query().Get("events"); events != "" {
+		sub.set(wsFilter{Events: strings.Split(events, ",")})
+	}
+
+	viewer := h.jobViewer(r)
+
+	// Subscribe to job events
+	eventCh := h.queue.Subscribe()
+	defer h.queue.Unsubscribe(eventCh)
+
+	// Send initial state
+	initialData, _ := json.Marshal(h.initMessage(viewer))
+	if err := conn.writeText(initialData); err != nil {
+		return
+	}
+
+	// Read filter updates until the client goes away
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			msg, err := conn.readMessage()
+			if err != nil {
+				return
+			}
+			var req struct {
+				Type string `json:"type"`
+				wsFilter
+			}
+			if err := json.Unmarshal(msg, &req); err != nil || req.Type != "filter" {
+				wsLog.Warn("Ignoring unknown message", "message", string(msg[:min(len(msg), 100)]))
+				continue
+			}
+			sub.set(req.wsFilter)
+		}
+	}()
+
+	heartbeat := time.NewTicker(10 * time.Second)
+	defer heartbeat.Stop()
+
+	// Stream events
+	for {
+		select {
+		case <-done:
+			return
+		case <-h.streamsClosed:
+			conn.writeText([]byte(`{"type":"shutdown"}`))
+			return
+		case <-heartbeat.C:
+			if err := conn.ping(); err != nil {
+				return
+			}
+		case event, ok := <-eventCh:
+			if !ok {
+				return
+			}
+			if event.Type == jobs.EventResync {
+				// This client fell behind; send the full state again
+				data, _ := json.Marshal(h.initMessage(viewer))
+				if err := conn.writeText(data); err != nil {
+					return
+				}
+				continue
+			}
+
+			event, visible := h.visibleEvent(viewer, event)
+			if visible {
+				event, visible = sub.filter(event)
+			}
+			if !visible {
+				continue
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			if err := conn.writeText(data); err != nil {
+				return
+			}
+		}
+	}
+}
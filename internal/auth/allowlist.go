@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// LocalNetworks is the AllowedNetworks keyword for loopback, private and
+// link-local addresses.
+const LocalNetworks = "local"
+
+// Allowlist refuses requests from client addresses outside its networks,
+// either all of them or only those that change something.
+type Allowlist struct {
+	networks     []netip.Prefix
+	local        bool
+	proxies      []netip.Prefix
+	mutatingOnly bool
+	bypassPaths  []string
+}
+
+// NewAllowlist creates an allowlist of networks (CIDRs, addresses or
+// LocalNetworks). X-Forwarded-For is only believed from trustedProxies.
+// With mutatingOnly, GET and HEAD requests are allowed from anywhere.
+// It returns nil, allowing everything, when networks is empty.
+func NewAllowlist(networks, trustedProxies []string, mutatingOnly bool) (*Allowlist, error) {
+	if len(networks) == 0 {
+		return nil, nil
+	}
+	a := &Allowlist{mutatingOnly: mutatingOnly, bypassPaths: []string{"/healthz", "/readyz"}}
+	for _, network := range networks {
+		if strings.EqualFold(strings.TrimSpace(network), LocalNetworks) {
+			a.local = true
+			continue
+		}
+		prefix, err := ParsePrefix(network)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed network %q: expected a CIDR, IP address or %q", network, LocalNetworks)
+		}
+		a.networks = append(a.networks, prefix)
+	}
+	for _, proxy := range trustedProxies {
+		prefix, err := ParsePrefix(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: expected a CIDR or IP address", proxy)
+		}
+		a.proxies = append(a.proxies, prefix)
+	}
+	return a, nil
+}
+
+// ParsePrefix parses a CIDR or a single address (as a one-address prefix).
+func ParsePrefix(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil {
+		addr, addrErr := netip.ParseAddr(s)
+		if addrErr != nil {
+			return netip.Prefix{}, addrErr
+		}
+		addr = addr.Unmap()
+		prefix = netip.PrefixFrom(addr, addr.BitLen())
+	}
+	return prefix.Masked(), nil
+}
+
+// Wrap refuses requests from outside the allowlist with 403 Forbidden.
+// Health checks are always answered.
+func (a *Allowlist) Wrap(next http.Handler) http.Handler {
+	if a == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.mutatingOnly && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		for _, path := range a.bypassPaths {
+			if r.URL.Path == path {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		client, ok := a.ClientAddr(r)
+		if !ok || !a.Allowed(client) {
+			authLog.Warn("Refused request from outside access.allowed_networks", "method", r.Method, "path", r.URL.Path, "client", client)
+			http.Error(w, "access from this address is not allowed", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Allowed reports whether addr is in one of the allowed networks.
+func (a *Allowlist) Allowed(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if a.local && (addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast()) {
+		return true
+	}
+	return containsAddr(a.networks, addr)
+}
+
+// ClientAddr returns the address r came from. When it came through
+// trusted proxies, that is the last X-Forwarded-For entry before them;
+// entries added by the client itself can't be told apart, so aren't used.
+func (a *Allowlist) ClientAddr(r *http.Request) (netip.Addr, bool) {
+	return ForwardedClient(r, func(addr netip.Addr) bool {
+		return containsAddr(a.proxies, addr)
+	})
+}
+
+// ForwardedClient returns the address r came from, walking X-Forwarded-For
+// from the right for as long as the hop it reached is trusted. Only
+// proxies append to the header, so the entries a client sends itself are
+// never reached. It returns false if r's address or a walked entry isn't
+// an IP address.
+func ForwardedClient(r *http.Request, trusted func(netip.Addr) bool) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	addr = addr.Unmap()
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0 && trusted(addr); i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			return netip.Addr{}, false
+		}
+		addr = hop.Unmap()
+	}
+	return addr, true
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestAllowlistClientAddr(t *testing.T) {
+	a, err := NewAllowlist([]string{"192.0.2.0/24"}, []string{"172.18.0.0/16", "10.0.0.1"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded []string
+		want      string
+		ok        bool
+	}{
+		{"direct", "192.0.2.10:5000", nil, "192.0.2.10", true},
+		{"header from untrusted peer ignored", "203.0.113.5:5000", []string{"192.0.2.10"}, "203.0.113.5", true},
+		{"through trusted proxy", "172.18.0.2:5000", []string{"192.0.2.10"}, "192.0.2.10", true},
+		{"through chained proxies", "172.18.0.2:5000", []string{"192.0.2.10, 10.0.0.1"}, "192.0.2.10", true},
+		{"repeated headers", "172.18.0.2:5000", []string{"192.0.2.10", "10.0.0.1"}, "192.0.2.10", true},
+		{"spoofed entry before untrusted hop", "172.18.0.2:5000", []string{"192.0.2.10, 203.0.113.5"}, "203.0.113.5", true},
+		{"spoofed entry not reached", "172.18.0.2:5000", []string{"192.0.2.10, 198.51.100.7, 10.0.0.1"}, "198.51.100.7", true},
+		{"trusted proxy without header", "172.18.0.2:5000", nil, "172.18.0.2", true},
+		{"mapped IPv4", "[::ffff:192.0.2.10]:5000", nil, "192.0.2.10", true},
+		{"malformed hop", "172.18.0.2:5000", []string{"not-an-ip"}, "", false},
+		{"malformed remote", "nowhere", nil, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remote
+			for _, header := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", header)
+			}
+			got, ok := a.ClientAddr(r)
+			if ok != tt.ok {
+				t.Fatalf("ClientAddr() ok = %v, want %v", ok, tt.ok)
+			}
+			if ok && got.String() != tt.want {
+				t.Errorf("ClientAddr() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowlistAllowed(t *testing.T) {
+	tests := []struct {
+		name     string
+		networks []string
+		addr     string
+		want     bool
+	}{
+		{"in CIDR", []string{"192.0.2.0/24"}, "192.0.2.200", true},
+		{"outside CIDR", []string{"192.0.2.0/24"}, "192.0.3.1", false},
+		{"unmasked CIDR", []string{"192.0.2.77/24"}, "192.0.2.1", true},
+		{"single IP", []string{"198.51.100.7"}, "198.51.100.7", true},
+		{"other IP", []string{"198.51.100.7"}, "198.51.100.8", false},
+		{"mapped IPv4", []string{"198.51.100.7"}, "::ffff:198.51.100.7", true},
+		{"IPv6 CIDR", []string{"2001:db8::/32"}, "2001:db8::1", true},
+		{"local private", []string{"local"}, "10.1.2.3", true},
+		{"local loopback", []string{"LOCAL"}, "::1", true},
+		{"local public", []string{"local"}, "203.0.113.5", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := NewAllowlist(tt.networks, nil, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := a.Allowed(netip.MustParseAddr(tt.addr)); got != tt.want {
+				t.Errorf("Allowed(%s) = %v, want %v", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewAllowlist(t *testing.T) {
+	if a, err := NewAllowlist(nil, nil, false); a != nil || err != nil {
+		t.Errorf("expected no allowlist without networks, got %v, %v", a, err)
+	}
+	if _, err := NewAllowlist([]string{"not-a-network"}, nil, false); err == nil {
+		t.Error("expected an invalid network to be rejected")
+	}
+	if _, err := NewAllowlist([]string{"local"}, []string{"proxy.example"}, false); err == nil {
+		t.Error("expected an invalid trusted proxy to be rejected")
+	}
+}
+
+func TestAllowlistWrap(t *testing.T) {
+	tests := []struct {
+		name         string
+		mutatingOnly bool
+		method       string
+		path         string
+		remote       string
+		want         int
+	}{
+		{"allowed GET", false, http.MethodGet, "/api/jobs", "192.0.2.10:5000", http.StatusOK},
+		{"refused GET", false, http.MethodGet, "/api/jobs", "203.0.113.5:5000", http.StatusForbidden},
+		{"refused POST", false, http.MethodPost, "/api/jobs", "203.0.113.5:5000", http.StatusForbidden},
+		{"mutating only GET", true, http.MethodGet, "/api/jobs", "203.0.113.5:5000", http.StatusOK},
+		{"mutating only HEAD", true, http.MethodHead, "/api/jobs", "203.0.113.5:5000", http.StatusOK},
+		{"mutating only POST", true, http.MethodPost, "/api/jobs", "203.0.113.5:5000", http.StatusForbidden},
+		{"mutating only allowed POST", true, http.MethodPost, "/api/jobs", "192.0.2.10:5000", http.StatusOK},
+		{"healthz bypass", false, http.MethodGet, "/healthz", "203.0.113.5:5000", http.StatusOK},
+		{"readyz bypass", false, http.MethodGet, "/readyz", "203.0.113.5:5000", http.StatusOK},
+		{"bypass is exact", false, http.MethodGet, "/healthz/extra", "203.0.113.5:5000", http.StatusForbidden},
+		{"malformed remote", false, http.MethodGet, "/api/jobs", "nowhere", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := NewAllowlist([]string{"192.0.2.0/24"}, nil, tt.mutatingOnly)
+			if err != nil {
+				t.Fatal(err)
+			}
+			handler := a.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			r.RemoteAddr = tt.remote
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("%s %s from %s: status %d, want %d", tt.method, tt.path, tt.remote, w.Code, tt.want)
+			}
+		})
+	}
+
+	// A nil allowlist lets everything through
+	var a *Allowlist
+	handler := a.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/jobs", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("nil allowlist: status %d, want %d", w.Code, http.StatusOK)
+	}
+}
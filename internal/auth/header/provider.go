@@ -0,0 +1,145 @@
+package header
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/gwlsn/shrinkray/internal/auth"
+)
+
+const (
+	defaultUserHeader   = "Remote-User"
+	defaultGroupsHeader = "Remote-Groups"
+	defaultEmailHeader  = "Remote-Email"
+	defaultNameHeader   = "Remote-Name"
+)
+
+var (
+	errUntrustedProxy = errors.New("request did not come from a trusted proxy")
+	errMissingUser    = errors.New("trusted proxy did not send a user")
+	errNotAllowed     = errors.New("user is not in an allowed group")
+)
+
+// Provider trusts the user a forward-auth reverse proxy (Authelia,
+// Authentik, oauth2-proxy, ...) puts in request headers. Headers are only
+// believed when the request comes straight from a trusted proxy address;
+// anyone else could set them.
+type Provider struct {
+	trusted       []netip.Prefix
+	userHeader    string
+	groupsHeader  string
+	allowedGroups map[string]struct{}
+	logoutURL     string
+}
+
+// NewProvider creates a trusted-header provider. trustedProxies are CIDRs
+// or single addresses; empty header names use the Remote-* defaults.
+func NewProvider(trustedProxies []string, userHeader, groupsHeader string, allowedGroups []string, logoutURL string) (*Provider, error) {
+	if len(trustedProxies) == 0 {
+		return nil, errors.New("header auth requires at least one trusted proxy")
+	}
+	trusted := make([]netip.Prefix, 0, len(trustedProxies))
+	for _, proxy := range trustedProxies {
+		prefix, err := auth.ParsePrefix(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: expected a CIDR or IP address", proxy)
+		}
+		trusted = append(trusted, prefix)
+	}
+	if userHeader == "" {
+		userHeader = defaultUserHeader
+	}
+	if groupsHeader == "" {
+		groupsHeader = defaultGroupsHeader
+	}
+	allowed := make(map[string]struct{}, len(allowedGroups))
+	for _, group := range allowedGroups {
+		if group = strings.TrimSpace(group); group != "" {
+			allowed[group] = struct{}{}
+		}
+	}
+	return &Provider{
+		trusted:       trusted,
+		userHeader:    userHeader,
+		groupsHeader:  groupsHeader,
+		allowedGroups: allowed,
+		logoutURL:     logoutURL,
+	}, nil
+}
+
+// Authenticate returns the user named by the trusted proxy's headers.
+func (p *Provider) Authenticate(r *http.Request) (*auth.User, error) {
+	if !p.fromTrustedProxy(r) {
+		return nil, errUntrustedProxy
+	}
+	username := strings.TrimSpace(r.Header.Get(p.userHeader))
+	if username == "" {
+		return nil, errMissingUser
+	}
+	if len(p.allowedGroups) > 0 && !p.inAllowedGroup(r.Header.Get(p.groupsHeader)) {
+		return nil, errNotAllowed
+	}
+
+	name := strings.TrimSpace(r.Header.Get(defaultNameHeader))
+	if name == "" {
+		name = username
+	}
+	return &auth.User{
+		ID:    username,
+		Email: strings.TrimSpace(r.Header.Get(defaultEmailHeader)),
+		Name:  name,
+	}, nil
+}
+
+// LoginURL is empty: logging in is the proxy's job, so unauthenticated
+// requests are refused rather than redirected.
+func (p *Provider) LoginURL(_ *http.Request) (string, error) {
+	return "", nil
+}
+
+// HandleCallback is not used for header auth.
+func (p *Provider) HandleCallback(_ http.ResponseWriter, _ *http.Request) error {
+	return errors.New("header auth does not support callbacks")
+}
+
+// HandleLogout sends the browser to the proxy's logout URL, if configured.
+func (p *Provider) HandleLogout(w http.ResponseWriter, r *http.Request) error {
+	if p.logoutURL == "" {
+		return errors.New("logout is handled by the authentication proxy")
+	}
+	http.Redirect(w, r, p.logoutURL, http.StatusFound)
+	return nil
+}
+
+func (p *Provider) fromTrustedProxy(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range p.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// inAllowedGroup checks a comma-separated group list (Authelia and
+// Authentik both send groups this way)
+func (p *Provider) inAllowedGroup(groups string) bool {
+	for _, group := range strings.Split(groups, ",") {
+		if _, ok := p.allowedGroups[strings.TrimSpace(group)]; ok {
+			return true
+		}
+	}
+	return false
+}
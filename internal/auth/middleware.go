@@ -17,7 +17,7 @@ type Middleware struct {
 
 // DefaultBypassPaths returns default unauthenticated endpoints.
 func DefaultBypassPaths() []string {
-	return []string{"/healthz", "/auth/callback", "/auth/login", "/auth/logout"}
+	return []string{"/healthz", "/readyz", "/auth/callback", "/auth/login", "/auth/logout"}
 }
 
 // NewMiddleware creates an auth middleware.
@@ -37,7 +37,13 @@ func (m *Middleware) Wrap(next http.Handler) http.Handler {
 			return
 		}
 
-		user, err := m.Provider.Authenticate(r)
+		var user *User
+		var err error
+		if refresher, ok := m.Provider.(SessionRefresher); ok {
+			user, err = refresher.AuthenticateAndRefresh(w, r)
+		} else {
+			user, err = m.Provider.Authenticate(r)
+		}
 		if err == nil && user != nil {
 			ctx := context.WithValue(r.Context(), contextKey{}, user)
 			next.ServeHTTP(w, r.WithContext(ctx))
@@ -13,13 +13,17 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/coreos/go-oidc/v3/oidc"
 	"github.com/gwlsn/shrinkray/internal/auth"
+	"github.com/gwlsn/shrinkray/internal/logger"
 	"golang.org/x/oauth2"
 )
 
+var authLog = logger.For("auth")
+
 const (
 	defaultCookieName   = "shrinkray_session"
 	defaultStateCookie  = "shrinkray_oidc_state"
@@ -39,6 +43,12 @@ type Provider struct {
 	groupClaim      string
 	allowedGroups   map[string]struct{}
 	sessionTTL      time.Duration
+	pages           *auth.Pages
+	sessions        *auth.SessionStore
+	basePath        string
+
+	refreshMu sync.Mutex
+	refreshed map[string]refreshResult // Recent refreshes by old refresh token
 }
 
 // NewProvider initializes an OIDC auth provider.
@@ -104,6 +114,7 @@ func NewProvider(ctx context.Context, issuer, clientID, clientSecret, redirectUR
 		groupClaim:      groupClaim,
 		allowedGroups:   allowed,
 		sessionTTL:      defaultSessionTTL,
+		refreshed:       make(map[string]refreshResult),
 	}, nil
 }
 
@@ -114,29 +125,28 @@ func (p *Provider) Authenticate(r *http.Request) (*auth.User, error) {
 		return nil, err
 	}
 
-	payload, err := p.verifySignedValue(cookie.Value)
+	session, err := p.parseSession(cookie.Value)
 	if err != nil {
 		return nil, auth.ErrSessionInvalid
 	}
-
-	var session sessionPayload
-	if err := json.Unmarshal(payload, &session); err != nil {
-		return nil, auth.ErrSessionInvalid
-	}
 	expiry := time.Unix(session.ExpiresAt, 0)
 	if expiry.Before(time.Now()) {
 		return nil, auth.ErrSessionExpired
 	}
+	if p.sessions != nil && (session.SessionID == "" || !p.sessions.Valid(session.SessionID)) {
+		return nil, auth.ErrSessionInvalid
+	}
 	return &auth.User{
-		ID:    session.Subject,
-		Email: session.Email,
-		Name:  session.Name,
+		ID:        session.Subject,
+		Email:     session.Email,
+		Name:      session.Name,
+		SessionID: session.SessionID,
 	}, nil
 }
 
 // LoginURL returns the login endpoint.
 func (p *Provider) LoginURL(_ *http.Request) (string, error) {
-	return "/auth/login", nil
+	return p.basePath + "/auth/login", nil
 }
 
 // HandleLogin initiates the authorization code flow.
@@ -151,8 +161,47 @@ func (p *Provider) HandleLogin(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
+// SetPages sets the renderer for branded callback error pages.
+func (p *Provider) SetPages(pages *auth.Pages) {
+	p.pages = pages
+}
+
+// SetBasePath sets the subpath the app is served under (see
+// config.BasePath), for redirects and the cookie path.
+func (p *Provider) SetBasePath(basePath string) {
+	p.basePath = basePath
+}
+
+// SetSessionStore records logins server-side so they can be revoked.
+// Cookies issued without a stored session stop working.
+func (p *Provider) SetSessionStore(store *auth.SessionStore) {
+	p.sessions = store
+}
+
 // HandleCallback validates the ID token and issues a session cookie.
+// Failures are shown with a generic message, on the branded error page
+// when one is configured; the detail, which may come from the identity
+// provider, is only logged.
 func (p *Provider) HandleCallback(w http.ResponseWriter, r *http.Request) error {
+	err := p.handleCallback(w, r)
+	if err == nil {
+		return nil
+	}
+	authLog.Warn("OIDC sign-in failed", "error", err)
+	if p.pages == nil {
+		return errors.New("sign-in failed")
+	}
+	return p.pages.RenderError(w, r, http.StatusBadRequest, auth.PageError{Message: p.pages.Text(r).Problem})
+}
+
+func (p *Provider) handleCallback(w http.ResponseWriter, r *http.Request) error {
+	if idpErr := r.URL.Query().Get("error"); idpErr != "" {
+		if desc := r.URL.Query().Get("error_description"); desc != "" {
+			return fmt.Errorf("%s: %s", idpErr, desc)
+		}
+		return errors.New(idpErr)
+	}
+
 	code := r.URL.Query().Get("code")
 	state := r.URL.Query().Get("state")
 	if code == "" || state == "" {
@@ -167,7 +216,7 @@ func (p *Provider) HandleCallback(w http.ResponseWriter, r *http.Request) error
 		return errors.New("invalid state")
 	}
 
-	clearStateCookie(w, r, p.stateCookieName)
+	clearStateCookie(w, r, p.stateCookieName, auth.CookiePath(p.basePath))
 
 	token, err := p.oauth2Config.Exchange(r.Context(), code)
 	if err != nil {
@@ -210,41 +259,49 @@ func (p *Provider) HandleCallback(w http.ResponseWriter, r *http.Request) error
 		Name:      name,
 		ExpiresAt: expiry.Unix(),
 	}
-	encoded, err := p.signSessionPayload(session)
-	if err != nil {
+	if token.RefreshToken != "" {
+		if session.RefreshToken, err = p.encryptRefreshToken(token.RefreshToken); err != nil {
+			return err
+		}
+	}
+	if p.sessions != nil {
+		stored, err := p.sessions.Create(&auth.User{ID: subject, Email: email, Name: name}, "oidc", session.cookieExpiry(), r)
+		if err != nil {
+			return err
+		}
+		session.SessionID = stored.ID
+	}
+	if err := p.setSessionCookie(w, r, session); err != nil {
 		return err
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     p.cookieName,
-		Value:    encoded,
-		Path:     "/",
-		HttpOnly: true,
-		SameSite: http.SameSiteLaxMode,
-		Expires:  expiry,
-		Secure:   isSecureRequest(r),
-	})
-
-	http.Redirect(w, r, "/", http.StatusFound)
+	http.Redirect(w, r, p.basePath+"/", http.StatusFound)
 	return nil
 }
 
-// HandleLogout clears the session cookie and triggers provider logout when available.
+// HandleLogout ends the session and triggers provider logout when available.
 func (p *Provider) HandleLogout(w http.ResponseWriter, r *http.Request) error {
+	if p.sessions != nil {
+		if cookie, err := r.Cookie(p.cookieName); err == nil {
+			if session, err := p.parseSession(cookie.Value); err == nil && session.SessionID != "" {
+				p.sessions.Revoke(session.SessionID)
+			}
+		}
+	}
 	p.ClearSession(w, r)
 
 	if p.endSessionURL != "" {
 		endURL, err := url.Parse(p.endSessionURL)
 		if err == nil {
 			query := endURL.Query()
-			query.Set("post_logout_redirect_uri", baseURL(r)+"/")
+			query.Set("post_logout_redirect_uri", baseURL(r)+p.basePath+"/")
 			endURL.RawQuery = query.Encode()
 			http.Redirect(w, r, endURL.String(), http.StatusFound)
 			return nil
 		}
 	}
 
-	http.Redirect(w, r, "/auth/login", http.StatusFound)
+	http.Redirect(w, r, p.basePath+"/auth/login", http.StatusFound)
 	return nil
 }
 
@@ -253,7 +310,7 @@ func (p *Provider) ClearSession(w http.ResponseWriter, r *http.Request) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     p.cookieName,
 		Value:    "",
-		Path:     "/",
+		Path:     auth.CookiePath(p.basePath),
 		MaxAge:   -1,
 		HttpOnly: true,
 		SameSite: http.SameSiteLaxMode,
@@ -284,7 +341,7 @@ func (p *Provider) ensureStateCookie(w http.ResponseWriter, r *http.Request) (st
 	http.SetCookie(w, &http.Cookie{
 		Name:     p.stateCookieName,
 		Value:    encoded,
-		Path:     "/",
+		Path:     auth.CookiePath(p.basePath),
 		HttpOnly: true,
 		SameSite: http.SameSiteLaxMode,
 		Expires:  expires,
@@ -320,6 +377,9 @@ type sessionPayload struct {
 	Email     string `json:"email"`
 	Name      string `json:"name"`
 	ExpiresAt int64  `json:"expires_at"`
+	SessionID string `json:"sid,omitempty"` // Set when a SessionStore is used
+	// RefreshToken is the IdP's refresh token, encrypted (see refresh.go)
+	RefreshToken string `json:"rt,omitempty"`
 }
 
 func (p *Provider) signStatePayload(payload statePayload) (string, error) {
@@ -342,6 +402,37 @@ func (p *Provider) verifyStateCookie(value string) (statePayload, error) {
 	return state, nil
 }
 
+// parseSession verifies and decodes a session cookie value
+func (p *Provider) parseSession(value string) (sessionPayload, error) {
+	payload, err := p.verifySignedValue(value)
+	if err != nil {
+		return sessionPayload{}, err
+	}
+	var session sessionPayload
+	if err := json.Unmarshal(payload, &session); err != nil {
+		return sessionPayload{}, err
+	}
+	return session, nil
+}
+
+// setSessionCookie signs session into the session cookie
+func (p *Provider) setSessionCookie(w http.ResponseWriter, r *http.Request, session sessionPayload) error {
+	encoded, err := p.signSessionPayload(session)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     p.cookieName,
+		Value:    encoded,
+		Path:     auth.CookiePath(p.basePath),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Expires:  session.cookieExpiry(),
+		Secure:   isSecureRequest(r),
+	})
+	return nil
+}
+
 func (p *Provider) signSessionPayload(payload sessionPayload) (string, error) {
 	data, err := json.Marshal(payload)
 	if err != nil {
@@ -493,11 +584,11 @@ func stateCookieSameSite(r *http.Request) http.SameSite {
 	return http.SameSiteLaxMode
 }
 
-func clearStateCookie(w http.ResponseWriter, r *http.Request, name string) {
+func clearStateCookie(w http.ResponseWriter, r *http.Request, name, path string) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     name,
 		Value:    "",
-		Path:     "/",
+		Path:     path,
 		MaxAge:   -1,
 		HttpOnly: true,
 		SameSite: stateCookieSameSite(r),
@@ -0,0 +1,43 @@
+package oidc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gwlsn/shrinkray/internal/auth"
+)
+
+func TestHandleCallbackHidesErrorDetail(t *testing.T) {
+	// The identity provider's error description is attacker-controllable
+	target := "/auth/callback?error=access_denied&error_description=" +
+		"Call+support+at+555-0100+%3Cb%3Enow%3C%2Fb%3E"
+
+	p := &Provider{}
+	err := p.HandleCallback(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	if err == nil || strings.Contains(err.Error(), "support") {
+		t.Errorf("expected a generic error without a page, got %v", err)
+	}
+
+	pages, err := auth.NewPages(os.DirFS("../../.."), auth.Branding{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.SetPages(pages)
+	w := httptest.NewRecorder()
+	if err := p.HandleCallback(w, httptest.NewRequest(http.MethodGet, target, nil)); err != nil {
+		t.Fatal(err)
+	}
+	body := w.Body.String()
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if strings.Contains(body, "support") || strings.Contains(body, "access_denied") {
+		t.Error("the error page shows the identity provider's message")
+	}
+	if !strings.Contains(body, "Something went wrong while signing you in.") {
+		t.Error("expected the generic sign-in error")
+	}
+}
@@ -0,0 +1,197 @@
+package oidc
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/auth"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// refreshWindow is how close to expiry a session is renewed
+	refreshWindow = 5 * time.Minute
+	// refreshCookieMaxAge is how long the cookie of a renewable session is
+	// kept by the browser; renewals extend it
+	refreshCookieMaxAge = 30 * 24 * time.Hour
+	// refreshReuse is how long a renewal's result is handed to other requests
+	// that arrive with the same old cookie, so parallel requests don't spend
+	// a rotating refresh token twice
+	refreshReuse = time.Minute
+)
+
+// refreshResult is a recent renewal, reused for concurrent requests
+type refreshResult struct {
+	session sessionPayload
+	at      time.Time
+}
+
+// cookieExpiry is when the browser should drop the cookie: the session's
+// expiry, or later if it can be renewed
+func (s sessionPayload) cookieExpiry() time.Time {
+	if s.RefreshToken != "" {
+		return time.Now().Add(refreshCookieMaxAge)
+	}
+	return time.Unix(s.ExpiresAt, 0)
+}
+
+// AuthenticateAndRefresh is Authenticate, except that a session within
+// refreshWindow of its expiry (or past it) is renewed with its refresh
+// token and the cookie reissued. If the IdP refuses the refresh, e.g.
+// because the user was disabled or the token revoked, the session ends.
+func (p *Provider) AuthenticateAndRefresh(w http.ResponseWriter, r *http.Request) (*auth.User, error) {
+	cookie, err := r.Cookie(p.cookieName)
+	if err != nil {
+		return nil, err
+	}
+	session, err := p.parseSession(cookie.Value)
+	if err != nil {
+		return nil, auth.ErrSessionInvalid
+	}
+	if session.RefreshToken == "" || time.Until(time.Unix(session.ExpiresAt, 0)) > refreshWindow {
+		return p.Authenticate(r)
+	}
+	if p.sessions != nil && (session.SessionID == "" || !p.sessions.Valid(session.SessionID)) {
+		return nil, auth.ErrSessionInvalid
+	}
+
+	renewed, err := p.refresh(r, session)
+	if err != nil {
+		authLog.Warn("OIDC session renewal failed, signing out", "subject", session.Subject, "error", err)
+		if p.sessions != nil {
+			p.sessions.Revoke(session.SessionID)
+		}
+		return nil, auth.ErrSessionExpired
+	}
+	if err := p.setSessionCookie(w, r, renewed); err != nil {
+		return nil, err
+	}
+	return &auth.User{
+		ID:        renewed.Subject,
+		Email:     renewed.Email,
+		Name:      renewed.Name,
+		SessionID: renewed.SessionID,
+	}, nil
+}
+
+// refresh exchanges session's refresh token for a new session, or returns
+// the result of a renewal of the same token moments ago
+func (p *Provider) refresh(r *http.Request, session sessionPayload) (sessionPayload, error) {
+	p.refreshMu.Lock()
+	defer p.refreshMu.Unlock()
+
+	for token, result := range p.refreshed {
+		if time.Since(result.at) > refreshReuse {
+			delete(p.refreshed, token)
+		}
+	}
+	if result, ok := p.refreshed[session.RefreshToken]; ok {
+		return result.session, nil
+	}
+
+	refreshToken, err := p.decryptRefreshToken(session.RefreshToken)
+	if err != nil {
+		return sessionPayload{}, err
+	}
+	token, err := p.oauth2Config.TokenSource(r.Context(), &oauth2.Token{RefreshToken: refreshToken}).Token()
+	if err != nil {
+		return sessionPayload{}, err
+	}
+
+	renewed := session
+	expiry := token.Expiry
+	if rawIDToken, ok := token.Extra("id_token").(string); ok && rawIDToken != "" {
+		idToken, err := p.verifier.Verify(r.Context(), rawIDToken)
+		if err != nil {
+			return sessionPayload{}, err
+		}
+		if idToken.Subject != session.Subject {
+			return sessionPayload{}, errors.New("refreshed id_token is for a different subject")
+		}
+		var claims map[string]interface{}
+		if err := idToken.Claims(&claims); err != nil {
+			return sessionPayload{}, err
+		}
+		// Group membership may have changed since login
+		if err := p.validateGroups(claims); err != nil {
+			return sessionPayload{}, err
+		}
+		if email, ok := claims["email"].(string); ok {
+			renewed.Email = email
+		}
+		if name, ok := claims["name"].(string); ok {
+			renewed.Name = name
+		}
+		expiry = idToken.Expiry
+	}
+	if expiry.IsZero() {
+		expiry = time.Now().Add(p.sessionTTL)
+	}
+	renewed.ExpiresAt = expiry.Unix()
+	if token.RefreshToken != "" && token.RefreshToken != refreshToken {
+		if renewed.RefreshToken, err = p.encryptRefreshToken(token.RefreshToken); err != nil {
+			return sessionPayload{}, err
+		}
+	}
+	if p.sessions != nil {
+		p.sessions.Extend(renewed.SessionID, renewed.cookieExpiry())
+	}
+
+	p.refreshed[session.RefreshToken] = refreshResult{session: renewed, at: time.Now()}
+	return renewed, nil
+}
+
+// refreshKey derives the refresh token encryption key from the auth secret
+func (p *Provider) refreshKey() []byte {
+	key := sha256.Sum256(append([]byte("shrinkray-oidc-refresh|"), p.secret...))
+	return key[:]
+}
+
+// encryptRefreshToken seals token with AES-GCM so the cookie doesn't carry
+// it in the clear
+func (p *Provider) encryptRefreshToken(token string) (string, error) {
+	block, err := aes.NewCipher(p.refreshKey())
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(token), nil)
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+func (p *Provider) decryptRefreshToken(encrypted string) (string, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(encrypted)
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(p.refreshKey())
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("invalid refresh token")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	token, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", errors.New("invalid refresh token")
+	}
+	return string(token), nil
+}
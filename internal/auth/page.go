@@ -0,0 +1,242 @@
+package auth
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// LoginTemplatePath is the login page template within the web filesystem.
+const LoginTemplatePath = "web/templates/login.html"
+
+var accentColorPattern = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// Branding customizes the login and auth error pages.
+type Branding struct {
+	// Title replaces "Shrinkray" in the page title, header and footer.
+	Title string
+	// LogoURL is the image shown next to the title.
+	LogoURL string
+	// AccentColor is a hex color (#RGB or #RRGGBB) for buttons and links.
+	AccentColor string
+	// Theme is "auto" (follow the UI/system), "light" or "dark".
+	Theme string
+	// Locale forces a page language; empty negotiates from Accept-Language.
+	Locale string
+}
+
+// PageText holds the translatable strings of the auth pages.
+type PageText struct {
+	SignIn   string
+	Subtitle string // %s is the title
+	Username string
+	Password string
+	Login    string
+	Footer   string // %s is the title
+	TryAgain string
+	Invalid  string
+	Locked   string // %s is how long until the next attempt
+	Captcha  string
+	Failed   string
+	Problem  string // Shown for failures whose detail is only logged
+}
+
+var pageTexts = map[string]PageText{
+	"en": {
+		SignIn:   "Sign in",
+		Subtitle: "Use your %s account to continue.",
+		Username: "Username",
+		Password: "Password",
+		Login:    "Login",
+		Footer:   "Protected access for %s administrators.",
+		TryAgain: "Try again",
+		Invalid:  "Invalid username or password.",
+		Locked:   "Too many failed attempts. Try again in %s.",
+		Captcha:  "Please complete the CAPTCHA.",
+		Failed:   "Sign-in failed",
+		Problem:  "Something went wrong while signing you in. Please try again.",
+	},
+	"de": {
+		SignIn:   "Anmelden",
+		Subtitle: "Melde dich mit deinem %s-Konto an.",
+		Username: "Benutzername",
+		Password: "Passwort",
+		Login:    "Anmelden",
+		Footer:   "Geschützter Zugang für %s-Administratoren.",
+		TryAgain: "Erneut versuchen",
+		Invalid:  "Ungültiger Benutzername oder ungültiges Passwort.",
+		Locked:   "Zu viele fehlgeschlagene Versuche. Versuche es in %s erneut.",
+		Captcha:  "Bitte löse das CAPTCHA.",
+		Failed:   "Anmeldung fehlgeschlagen",
+		Problem:  "Bei der Anmeldung ist ein Fehler aufgetreten. Bitte versuche es erneut.",
+	},
+	"fr": {
+		SignIn:   "Connexion",
+		Subtitle: "Utilisez votre compte %s pour continuer.",
+		Username: "Nom d'utilisateur",
+		Password: "Mot de passe",
+		Login:    "Se connecter",
+		Footer:   "Accès protégé pour les administrateurs %s.",
+		TryAgain: "Réessayer",
+		Invalid:  "Nom d'utilisateur ou mot de passe incorrect.",
+		Locked:   "Trop de tentatives échouées. Réessayez dans %s.",
+		Captcha:  "Veuillez compléter le CAPTCHA.",
+		Failed:   "Échec de la connexion",
+		Problem:  "Une erreur s'est produite lors de la connexion. Veuillez réessayer.",
+	},
+	"es": {
+		SignIn:   "Iniciar sesión",
+		Subtitle: "Usa tu cuenta de %s para continuar.",
+		Username: "Usuario",
+		Password: "Contraseña",
+		Login:    "Entrar",
+		Footer:   "Acceso protegido para administradores de %s.",
+		TryAgain: "Reintentar",
+		Invalid:  "Usuario o contraseña incorrectos.",
+		Locked:   "Demasiados intentos fallidos. Vuelve a intentarlo en %s.",
+		Captcha:  "Completa el CAPTCHA.",
+		Failed:   "Error al iniciar sesión",
+		Problem:  "Algo salió mal al iniciar sesión. Inténtalo de nuevo.",
+	},
+}
+
+// PageError describes an auth failure shown in place of the login form.
+type PageError struct {
+	Title   string
+	Message string
+}
+
+type pageData struct {
+	BasePath string
+	Lang     string
+	Title    string
+	LogoURL  string
+	Accent   string
+	Theme    string
+	Text     PageText
+	Username string
+	Message  string
+	Captcha  template.HTML
+	Error    *PageError
+}
+
+// Pages renders the branded login and auth error pages.
+type Pages struct {
+	tmpl     *template.Template
+	branding Branding
+	basePath string
+}
+
+// NewPages parses the login template from fsys and normalizes branding.
+func NewPages(fsys fs.FS, branding Branding) (*Pages, error) {
+	tmpl, err := template.ParseFS(fsys, LoginTemplatePath)
+	if err != nil {
+		return nil, fmt.Errorf("parse login template: %w", err)
+	}
+
+	branding.Title = strings.TrimSpace(branding.Title)
+	if branding.Title == "" {
+		branding.Title = "Shrinkray"
+	}
+	branding.LogoURL = strings.TrimSpace(branding.LogoURL)
+	if branding.AccentColor != "" && !accentColorPattern.MatchString(branding.AccentColor) {
+		authLog.Warn("Ignoring invalid accent color, expected #RGB or #RRGGBB", "value", branding.AccentColor)
+		branding.AccentColor = ""
+	}
+	switch branding.Theme {
+	case "light", "dark":
+	default:
+		branding.Theme = "auto"
+	}
+	branding.Locale = strings.ToLower(strings.TrimSpace(branding.Locale))
+
+	return &Pages{tmpl: tmpl, branding: branding}, nil
+}
+
+// SetBasePath sets the subpath the app is served under (see
+// config.BasePath), for the page's links and form action.
+func (p *Pages) SetBasePath(basePath string) {
+	p.basePath = basePath
+}
+
+// Text returns the page strings for the request's language.
+func (p *Pages) Text(r *http.Request) PageText {
+	_, text := p.locale(r)
+	return text
+}
+
+// RenderLogin writes the login form. message is shown above the form and
+// username pre-fills the username field after a failed attempt.
+func (p *Pages) RenderLogin(w http.ResponseWriter, r *http.Request, status int, username, message string) error {
+	return p.RenderLoginWithCaptcha(w, r, status, username, message, "")
+}
+
+// RenderLoginWithCaptcha is RenderLogin with a CAPTCHA widget in the form.
+func (p *Pages) RenderLoginWithCaptcha(w http.ResponseWriter, r *http.Request, status int, username, message string, captcha template.HTML) error {
+	data := p.data(r)
+	data.Username = username
+	data.Message = message
+	data.Captcha = captcha
+	return p.render(w, status, data)
+}
+
+// RenderError writes an error page with a link back to the login page.
+func (p *Pages) RenderError(w http.ResponseWriter, r *http.Request, status int, pageErr PageError) error {
+	data := p.data(r)
+	if pageErr.Title == "" {
+		pageErr.Title = data.Text.Failed
+	}
+	data.Error = &pageErr
+	return p.render(w, status, data)
+}
+
+func (p *Pages) data(r *http.Request) pageData {
+	lang, text := p.locale(r)
+	logoURL := p.branding.LogoURL
+	if logoURL == "" {
+		logoURL = p.basePath + "/logo.png"
+	}
+	return pageData{
+		BasePath: p.basePath,
+		Lang:     lang,
+		Title:    p.branding.Title,
+		LogoURL:  logoURL,
+		Accent:   p.branding.AccentColor,
+		Theme:    p.branding.Theme,
+		Text:     text,
+	}
+}
+
+func (p *Pages) render(w http.ResponseWriter, status int, data pageData) error {
+	// Render to a buffer so a template error doesn't leave a half-written page
+	var buf bytes.Buffer
+	if err := p.tmpl.Execute(&buf, data); err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// locale picks the configured locale, then the first supported
+// Accept-Language entry, then English.
+func (p *Pages) locale(r *http.Request) (string, PageText) {
+	if text, ok := pageTexts[p.branding.Locale]; ok {
+		return p.branding.Locale, text
+	}
+	if r != nil {
+		for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+			tag := strings.ToLower(strings.TrimSpace(strings.SplitN(part, ";", 2)[0]))
+			tag = strings.SplitN(tag, "-", 2)[0]
+			if text, ok := pageTexts[tag]; ok {
+				return tag, text
+			}
+		}
+	}
+	return "en", pageTexts["en"]
+}
@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// newTestPages loads the real login template from the repository root
+func newTestPages(t *testing.T, branding Branding) *Pages {
+	t.Helper()
+	pages, err := NewPages(os.DirFS("../.."), branding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pages
+}
+
+func TestPagesRenderLogin(t *testing.T) {
+	pages := newTestPages(t, Branding{Title: "  Media Box  ", Theme: "dark"})
+	pages.SetBasePath("/shrinkray")
+
+	r := httptest.NewRequest(http.MethodGet, "/auth/login", nil)
+	w := httptest.NewRecorder()
+	if err := pages.RenderLogin(w, r, http.StatusUnauthorized, `admin"><script>`, "Invalid username or password."); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		`<html lang="en" data-theme="dark">`,
+		`<title>Sign in · Media Box</title>`,
+		`action="/shrinkray/auth/login"`,
+		`src="/shrinkray/logo.png"`,
+		"Use your Media Box account to continue.",
+		"Invalid username or password.",
+		`value="admin&#34;&gt;&lt;script&gt;"`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("login page is missing %q", want)
+		}
+	}
+	if strings.Contains(body, "<script>") {
+		t.Error("username was not escaped")
+	}
+}
+
+func TestPagesRenderError(t *testing.T) {
+	pages := newTestPages(t, Branding{})
+	r := httptest.NewRequest(http.MethodGet, "/auth/callback", nil)
+	w := httptest.NewRecorder()
+	if err := pages.RenderError(w, r, http.StatusBadRequest, PageError{Message: "<b>denied</b>"}); err != nil {
+		t.Fatal(err)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, "<h1>Sign-in failed</h1>") {
+		t.Error("expected the default error title")
+	}
+	if !strings.Contains(body, "&lt;b&gt;denied&lt;/b&gt;") {
+		t.Error("expected the message to be escaped")
+	}
+	if strings.Contains(body, `<form`) {
+		t.Error("error page should not show the login form")
+	}
+}
+
+func TestPagesLocale(t *testing.T) {
+	tests := []struct {
+		name           string
+		locale         string
+		acceptLanguage string
+		want           string
+	}{
+		{"default", "", "", "en"},
+		{"first supported", "", "ja, de-CH;q=0.9, fr;q=0.8", "de"},
+		{"region subtag", "", "fr-CA", "fr"},
+		{"case and spacing", "", "  ES-mx ;q=1", "es"},
+		{"unsupported only", "", "ja, zh-TW", "en"},
+		{"configured locale wins", " FR ", "de", "fr"},
+		{"unknown configured locale", "pt", "es", "es"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pages := newTestPages(t, Branding{Locale: tt.locale})
+			r := httptest.NewRequest(http.MethodGet, "/auth/login", nil)
+			if tt.acceptLanguage != "" {
+				r.Header.Set("Accept-Language", tt.acceptLanguage)
+			}
+			lang, text := pages.locale(r)
+			if lang != tt.want {
+				t.Fatalf("locale = %q, want %q", lang, tt.want)
+			}
+			if text != pageTexts[tt.want] {
+				t.Errorf("text doesn't match the %q strings", tt.want)
+			}
+
+			w := httptest.NewRecorder()
+			if err := pages.RenderLogin(w, r, http.StatusOK, "", ""); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(w.Body.String(), `<html lang="`+tt.want+`"`) {
+				t.Errorf("page isn't marked as %q", tt.want)
+			}
+		})
+	}
+}
+
+func TestPagesTextComplete(t *testing.T) {
+	for lang, text := range pageTexts {
+		if text.SignIn == "" || text.Subtitle == "" || text.Username == "" || text.Password == "" ||
+			text.Login == "" || text.Footer == "" || text.TryAgain == "" || text.Invalid == "" ||
+			text.Locked == "" || text.Captcha == "" || text.Failed == "" || text.Problem == "" {
+			t.Errorf("%s: missing translations: %+v", lang, text)
+		}
+	}
+}
+
+func TestPagesAccentColor(t *testing.T) {
+	tests := []struct {
+		accent string
+		want   string // Accent kept in the <style> block, or "" if dropped
+	}{
+		{"#ff8800", "#ff8800"},
+		{"#F80", "#F80"},
+		{"#ff880", ""},
+		{"red", ""},
+		{"#fff; } body { display: none", ""},
+		{"#fff</style><script>alert(1)</script>", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accent, func(t *testing.T) {
+			pages := newTestPages(t, Branding{AccentColor: tt.accent})
+			if pages.branding.AccentColor != tt.want {
+				t.Errorf("AccentColor = %q, want %q", pages.branding.AccentColor, tt.want)
+			}
+
+			w := httptest.NewRecorder()
+			if err := pages.RenderLogin(w, httptest.NewRequest(http.MethodGet, "/auth/login", nil), http.StatusOK, "", ""); err != nil {
+				t.Fatal(err)
+			}
+			body := w.Body.String()
+			hasAccent := strings.Contains(body, "color-mix(")
+			if hasAccent != (tt.want != "") {
+				t.Errorf("accent override present = %v, want %v", hasAccent, tt.want != "")
+			}
+			if tt.want != "" && !strings.Contains(body, "--accent: "+tt.want+";") {
+				t.Errorf("expected --accent: %s in the page", tt.want)
+			}
+			if strings.Contains(body, "alert(1)") || strings.Contains(body, "display: none") {
+				t.Error("an invalid accent color reached the page")
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package password
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCaptchaVerify(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("secret") != "secret" {
+			t.Errorf("expected the secret to be sent, got %q", r.PostFormValue("secret"))
+		}
+		if r.PostFormValue("response") == "good" {
+			w.Write([]byte(`{"success": true}`))
+			return
+		}
+		w.Write([]byte(`{"success": false, "error-codes": ["invalid-input-response"]}`))
+	}))
+	defer server.Close()
+
+	captcha, err := NewCaptcha("turnstile", `key"><script>`, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := captcha.(*siteVerifyCaptcha)
+	c.verifyURL = server.URL
+	if widget := string(c.Widget()); strings.Contains(widget, `"><script>`) {
+		t.Errorf("expected the site key to be escaped, got %s", widget)
+	}
+
+	post := func(form url.Values) *http.Request {
+		r := httptest.NewRequest("POST", "/auth/login", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return r
+	}
+	if err := c.Verify(post(url.Values{"cf-turnstile-response": {"good"}})); err != nil {
+		t.Errorf("expected a valid response to pass, got %v", err)
+	}
+	if err := c.Verify(post(url.Values{"cf-turnstile-response": {"bad"}})); err == nil {
+		t.Error("expected a rejected response to fail")
+	}
+	if err := c.Verify(post(url.Values{})); err == nil {
+		t.Error("expected a missing response to fail")
+	}
+
+	if _, err := NewCaptcha("recaptcha", "key", "secret"); err == nil {
+		t.Error("expected an unknown service to be refused")
+	}
+}
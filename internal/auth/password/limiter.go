@@ -0,0 +1,192 @@
+package password
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/auth"
+)
+
+// LockoutPolicy configures brute-force protection for password logins.
+type LockoutPolicy struct {
+	// MaxAttempts is how many failed logins an IP or username gets before
+	// it is locked out.
+	MaxAttempts int
+	// Lockout is the first lockout; it doubles with each further failure.
+	Lockout time.Duration
+	// MaxLockout caps the lockout.
+	MaxLockout time.Duration
+	// Window is how long failures are remembered after the last one.
+	Window time.Duration
+	// TrustForwardedFor takes the client IP from X-Forwarded-For, walking it
+	// from the right past TrustedProxies (or, if there are none, past the
+	// address the request came from). Entries the client sent are ignored.
+	TrustForwardedFor bool
+	// TrustedProxies are the reverse proxies whose X-Forwarded-For entries
+	// are believed when TrustForwardedFor is set.
+	TrustedProxies []netip.Prefix
+}
+
+// DefaultLockoutPolicy returns the policy used unless SetLockoutPolicy is called.
+func DefaultLockoutPolicy() LockoutPolicy {
+	return LockoutPolicy{
+		MaxAttempts: 5,
+		Lockout:     30 * time.Second,
+		MaxLockout:  time.Hour,
+		Window:      15 * time.Minute,
+	}
+}
+
+// maxTrackedKeys bounds the limiter's memory. Once it is reached, expired
+// entries are dropped; if none are, new usernames aren't tracked (their
+// client IPs still are) and a new IP replaces the entry that failed
+// longest ago.
+const maxTrackedKeys = 10000
+
+// failures tracks the failed logins of one IP or username.
+type failures struct {
+	count       int
+	last        time.Time
+	lockedUntil time.Time
+}
+
+// limiter counts failed logins per key ("ip:<addr>", "user:<name>") and
+// locks keys out with an exponentially growing lockout.
+type limiter struct {
+	mu      sync.Mutex
+	policy  LockoutPolicy
+	entries map[string]*failures
+	now     func() time.Time
+}
+
+func newLimiter(policy LockoutPolicy) *limiter {
+	return &limiter{policy: policy, entries: make(map[string]*failures), now: time.Now}
+}
+
+// lockedFor returns how much longer the most locked-out of keys stays locked.
+func (l *limiter) lockedFor(keys ...string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	var wait time.Duration
+	for _, key := range keys {
+		if f, ok := l.entries[key]; ok && f.lockedUntil.After(now) {
+			wait = max(wait, f.lockedUntil.Sub(now))
+		}
+	}
+	return wait
+}
+
+// failureCount returns the current failure count of key.
+func (l *limiter) failureCount(key string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if f, ok := l.entries[key]; ok && !l.expired(f, l.now()) {
+		return f.count
+	}
+	return 0
+}
+
+// fail records a failed login for each key and returns the longest lockout
+// it started (0 if none).
+func (l *limiter) fail(keys ...string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if len(l.entries) >= maxTrackedKeys {
+		for key, f := range l.entries {
+			if l.expired(f, now) {
+				delete(l.entries, key)
+			}
+		}
+	}
+
+	var lockout time.Duration
+	for _, key := range keys {
+		f, ok := l.entries[key]
+		if !ok || l.expired(f, now) {
+			if !ok && len(l.entries) >= maxTrackedKeys {
+				// Spraying usernames mustn't push out the lockouts of others
+				if strings.HasPrefix(key, "user:") {
+					continue
+				}
+				l.evictOldest()
+			}
+			f = &failures{}
+			l.entries[key] = f
+		}
+		f.count++
+		f.last = now
+		if f.count < l.policy.MaxAttempts {
+			continue
+		}
+		d := l.policy.Lockout << min(f.count-l.policy.MaxAttempts, 20)
+		if d > l.policy.MaxLockout || d <= 0 {
+			d = l.policy.MaxLockout
+		}
+		f.lockedUntil = now.Add(d)
+		lockout = max(lockout, d)
+	}
+	return lockout
+}
+
+// evictOldest drops the entry whose last failure is the oldest. Must hold l.mu.
+func (l *limiter) evictOldest() {
+	var oldestKey string
+	var oldest time.Time
+	for key, f := range l.entries {
+		if oldestKey == "" || f.last.Before(oldest) {
+			oldestKey, oldest = key, f.last
+		}
+	}
+	delete(l.entries, oldestKey)
+}
+
+// succeed forgets the failures of keys after a successful login.
+func (l *limiter) succeed(keys ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, key := range keys {
+		delete(l.entries, key)
+	}
+}
+
+// expired reports whether f's failures can be forgotten.
+func (l *limiter) expired(f *failures, now time.Time) bool {
+	return now.After(f.lockedUntil) && now.Sub(f.last) > l.policy.Window
+}
+
+// clientIP returns the address login attempts are counted against.
+func (l *limiter) clientIP(r *http.Request) string {
+	if l.policy.TrustForwardedFor {
+		peers := 0
+		trusted := func(addr netip.Addr) bool {
+			if len(l.policy.TrustedProxies) > 0 {
+				for _, proxy := range l.policy.TrustedProxies {
+					if proxy.Contains(addr) {
+						return true
+					}
+				}
+				return false
+			}
+			// Without a list, only the direct peer is taken to be the proxy
+			peers++
+			return peers == 1
+		}
+		if addr, ok := auth.ForwardedClient(r, trusted); ok {
+			return addr.String()
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,121 @@
+package password
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func newTestLimiter(policy LockoutPolicy) (*limiter, *time.Time) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := newLimiter(policy)
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestLimiterBackoff(t *testing.T) {
+	l, now := newTestLimiter(LockoutPolicy{
+		MaxAttempts: 3,
+		Lockout:     10 * time.Second,
+		MaxLockout:  40 * time.Second,
+		Window:      time.Minute,
+	})
+
+	// The lockout starts at MaxAttempts and doubles up to MaxLockout
+	want := []time.Duration{0, 0, 10 * time.Second, 20 * time.Second, 40 * time.Second, 40 * time.Second}
+	for i, expected := range want {
+		if got := l.fail("ip:192.0.2.1", "user:admin"); got != expected {
+			t.Errorf("failure %d: expected a %s lockout, got %s", i+1, expected, got)
+		}
+	}
+	if wait := l.lockedFor("user:admin"); wait != 40*time.Second {
+		t.Errorf("expected admin to be locked for 40s, got %s", wait)
+	}
+	if wait := l.lockedFor("ip:192.0.2.2", "user:other"); wait != 0 {
+		t.Errorf("expected other keys to be unaffected, got %s", wait)
+	}
+
+	// Failures are forgotten a window after the lockout ends
+	*now = now.Add(40 * time.Second)
+	if l.lockedFor("ip:192.0.2.1") != 0 || l.failureCount("ip:192.0.2.1") != 6 {
+		t.Errorf("expected the lockout to end with the failures still counted")
+	}
+	*now = now.Add(2 * time.Minute)
+	if n := l.failureCount("ip:192.0.2.1"); n != 0 {
+		t.Errorf("expected failures to expire, got %d", n)
+	}
+
+	// A successful login forgets them at once
+	l.fail("user:admin")
+	l.succeed("user:admin")
+	if n := l.failureCount("user:admin"); n != 0 {
+		t.Errorf("expected success to reset failures, got %d", n)
+	}
+}
+
+func TestLimiterEviction(t *testing.T) {
+	l, now := newTestLimiter(LockoutPolicy{
+		MaxAttempts: 1,
+		Lockout:     time.Hour,
+		MaxLockout:  time.Hour,
+		Window:      time.Hour,
+	})
+	for i := range maxTrackedKeys {
+		*now = now.Add(time.Millisecond)
+		l.fail(fmt.Sprintf("ip:10.0.%d.%d", i/256, i%256))
+	}
+
+	// New usernames aren't tracked once the limiter is full
+	*now = now.Add(time.Millisecond)
+	l.fail("user:sprayed")
+	if l.failureCount("user:sprayed") != 0 || len(l.entries) != maxTrackedKeys {
+		t.Errorf("expected a new username not to be tracked when full")
+	}
+
+	// A new IP replaces the one that failed longest ago
+	l.fail("ip:192.0.2.1")
+	if len(l.entries) != maxTrackedKeys {
+		t.Errorf("expected %d entries, got %d", maxTrackedKeys, len(l.entries))
+	}
+	if l.lockedFor("ip:10.0.0.0") != 0 {
+		t.Error("expected the oldest IP to be evicted")
+	}
+	if l.lockedFor("ip:10.0.0.1") == 0 || l.lockedFor("ip:192.0.2.1") == 0 {
+		t.Error("expected newer lockouts to be kept")
+	}
+}
+
+func TestLimiterClientIP(t *testing.T) {
+	proxies := []netip.Prefix{netip.MustParsePrefix("172.18.0.0/16")}
+	tests := []struct {
+		name      string
+		trust     bool
+		proxies   []netip.Prefix
+		remote    string
+		forwarded string
+		want      string
+	}{
+		{"untrusted header", false, nil, "203.0.113.5:1234", "198.51.100.7", "203.0.113.5"},
+		{"direct peer is the proxy", true, nil, "172.18.0.2:1234", "198.51.100.7", "198.51.100.7"},
+		{"client-sent entries ignored", true, nil, "172.18.0.2:1234", "1.2.3.4, 198.51.100.7", "198.51.100.7"},
+		{"no header", true, nil, "203.0.113.5:1234", "", "203.0.113.5"},
+		{"walks trusted proxies", true, proxies, "172.18.0.2:1234", "1.2.3.4, 198.51.100.7, 172.18.0.9", "198.51.100.7"},
+		{"untrusted peer", true, proxies, "203.0.113.5:1234", "1.2.3.4", "203.0.113.5"},
+		{"malformed hop", true, proxies, "172.18.0.2:1234", "not-an-ip", "172.18.0.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newLimiter(LockoutPolicy{TrustForwardedFor: tt.trust, TrustedProxies: tt.proxies})
+			r := httptest.NewRequest("POST", "/auth/login", nil)
+			r.RemoteAddr = tt.remote
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if got := l.clientIP(r); got != tt.want {
+				t.Errorf("clientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -8,28 +8,47 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"html/template"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gwlsn/shrinkray/internal/auth"
+	"github.com/gwlsn/shrinkray/internal/logger"
 	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
+var authLog = logger.For("auth")
+
 const (
 	defaultCookieName = "shrinkray_session"
 	defaultSessionTTL = 24 * time.Hour
 )
 
+// Captcha is an optional CAPTCHA check on logins (e.g. hCaptcha or
+// Turnstile), required once an IP has failed to log in.
+type Captcha interface {
+	// Widget returns the HTML added to the login form.
+	Widget() template.HTML
+	// Verify checks the response the widget posted with the form.
+	Verify(r *http.Request) error
+}
+
 // Provider implements password-based authentication.
 type Provider struct {
-	users      map[string]string
-	hashAlgo   string
-	secret     []byte
-	cookieName string
-	sessionTTL time.Duration
+	users        map[string]string
+	hashAlgo     string
+	secret       []byte
+	cookieName   string
+	sessionTTL   time.Duration
+	pages        *auth.Pages
+	sessions     *auth.SessionStore
+	limiter      *limiter
+	captcha      Captcha
+	captchaAfter int // Failed logins from an IP before the CAPTCHA is required
+	basePath     string
 }
 
 // NewProvider creates a new password auth provider.
@@ -55,9 +74,53 @@ func NewProvider(users map[string]string, hashAlgo, secret string) (*Provider, e
 		secret:     []byte(secret),
 		cookieName: defaultCookieName,
 		sessionTTL: defaultSessionTTL,
+		limiter:    newLimiter(DefaultLockoutPolicy()),
 	}, nil
 }
 
+// SetPages sets the renderer for the branded login page.
+func (p *Provider) SetPages(pages *auth.Pages) {
+	p.pages = pages
+}
+
+// SetBasePath sets the subpath the app is served under (see
+// config.BasePath), for redirects and the cookie path.
+func (p *Provider) SetBasePath(basePath string) {
+	p.basePath = basePath
+}
+
+// SetSessionStore records logins server-side so they can be revoked.
+// Cookies issued without a stored session stop working.
+func (p *Provider) SetSessionStore(store *auth.SessionStore) {
+	p.sessions = store
+}
+
+// SetLockoutPolicy replaces the brute-force protection policy. Failures
+// counted so far are forgotten.
+func (p *Provider) SetLockoutPolicy(policy LockoutPolicy) {
+	defaults := DefaultLockoutPolicy()
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = defaults.MaxAttempts
+	}
+	if policy.Lockout <= 0 {
+		policy.Lockout = defaults.Lockout
+	}
+	if policy.MaxLockout < policy.Lockout {
+		policy.MaxLockout = max(defaults.MaxLockout, policy.Lockout)
+	}
+	if policy.Window <= 0 {
+		policy.Window = defaults.Window
+	}
+	p.limiter = newLimiter(policy)
+}
+
+// SetCaptcha requires captcha on logins from IPs with at least afterFailures
+// recent failed logins (0 = always).
+func (p *Provider) SetCaptcha(captcha Captcha, afterFailures int) {
+	p.captcha = captcha
+	p.captchaAfter = afterFailures
+}
+
 // Authenticate verifies the session cookie.
 func (p *Provider) Authenticate(r *http.Request) (*auth.User, error) {
 	cookie, err := r.Cookie(p.cookieName)
@@ -65,7 +128,7 @@ func (p *Provider) Authenticate(r *http.Request) (*auth.User, error) {
 		return nil, err
 	}
 
-	username, expiry, err := p.verifySession(cookie.Value)
+	username, expiry, sessionID, err := p.verifySession(cookie.Value)
 	if err != nil {
 		return nil, auth.ErrSessionInvalid
 	}
@@ -75,13 +138,16 @@ func (p *Provider) Authenticate(r *http.Request) (*auth.User, error) {
 	if _, ok := p.users[username]; !ok {
 		return nil, auth.ErrSessionInvalid
 	}
+	if p.sessions != nil && (sessionID == "" || !p.sessions.Valid(sessionID)) {
+		return nil, auth.ErrSessionInvalid
+	}
 
-	return &auth.User{ID: username, Name: username}, nil
+	return &auth.User{ID: username, Name: username, SessionID: sessionID}, nil
 }
 
 // LoginURL returns the login endpoint.
 func (p *Provider) LoginURL(_ *http.Request) (string, error) {
-	return "/auth/login", nil
+	return p.basePath + "/auth/login", nil
 }
 
 // HandleCallback is not used for password auth.
@@ -93,202 +159,7 @@ func (p *Provider) HandleCallback(_ http.ResponseWriter, _ *http.Request) error
 func (p *Provider) HandleLogin(w http.ResponseWriter, r *http.Request) error {
 	switch r.Method {
 	case http.MethodGet:
-		w.Header().Set("Content-Type", "text/html")
-		w.WriteHeader(http.StatusOK)
-		_, err := w.Write([]byte(`<!doctype html>
-<html lang="en">
-<head>
-    <meta charset="UTF-8">
-    <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>Shrinkray Login</title>
-    <link rel="preconnect" href="https://fonts.googleapis.com">
-    <link rel="preconnect" href="https://fonts.gstatic.com" crossorigin>
-    <link rel="icon" type="image/png" href="/favicon.png">
-    <link href="https://fonts.googleapis.com/css2?family=DM+Sans:ital,opsz,wght@0,9..40,300;0,9..40,400;0,9..40,500;0,9..40,600;0,9..40,700&display=swap" rel="stylesheet">
-    <style>
-        :root {
-            --bg-primary: #FAFAFA;
-            --bg-secondary: #FFFFFF;
-            --bg-tertiary: #F5F5F5;
-            --text-primary: #1A1A1A;
-            --text-secondary: #6B6B6B;
-            --text-tertiary: #9A9A9A;
-            --accent: #2563EB;
-            --accent-hover: #1D4ED8;
-            --accent-light: #EFF6FF;
-            --border: #E5E5E5;
-            --border-hover: #D4D4D4;
-            --shadow-md: 0 4px 12px rgba(0,0,0,0.08);
-            --radius-sm: 8px;
-            --radius-md: 12px;
-            --radius-lg: 16px;
-            --font-sans: 'DM Sans', -apple-system, BlinkMacSystemFont, sans-serif;
-            --transition-fast: 150ms ease;
-        }
-
-        [data-theme="dark"] {
-            --bg-primary: #0F0F0F;
-            --bg-secondary: #1A1A1A;
-            --bg-tertiary: #252525;
-            --text-primary: #F5F5F5;
-            --text-secondary: #A0A0A0;
-            --text-tertiary: #6B6B6B;
-            --accent: #3B82F6;
-            --accent-hover: #60A5FA;
-            --accent-light: #1E3A5F;
-            --border: #2E2E2E;
-            --border-hover: #404040;
-            --shadow-md: 0 4px 12px rgba(0,0,0,0.3);
-        }
-
-        * {
-            box-sizing: border-box;
-            margin: 0;
-            padding: 0;
-        }
-
-        html, body {
-            height: 100%;
-        }
-
-        body {
-            font-family: var(--font-sans);
-            background: var(--bg-primary);
-            color: var(--text-primary);
-            line-height: 1.5;
-        }
-
-        .login-page {
-            min-height: 100vh;
-            display: flex;
-            align-items: center;
-            justify-content: center;
-            padding: 24px;
-            background: radial-gradient(circle at top, var(--accent-light), transparent 55%), var(--bg-primary);
-        }
-
-        .login-card {
-            width: min(420px, 100%);
-            background: var(--bg-secondary);
-            border: 1px solid var(--border);
-            border-radius: var(--radius-lg);
-            box-shadow: var(--shadow-md);
-            padding: 32px;
-            display: flex;
-            flex-direction: column;
-            gap: 24px;
-        }
-
-        .login-header {
-            display: flex;
-            flex-direction: column;
-            gap: 12px;
-            align-items: flex-start;
-        }
-
-        .logo {
-            display: inline-flex;
-            align-items: center;
-            gap: 12px;
-            font-weight: 600;
-            font-size: 1.125rem;
-        }
-
-        .logo img {
-            width: 36px;
-            height: 36px;
-            border-radius: var(--radius-sm);
-        }
-
-        .login-header p {
-            color: var(--text-secondary);
-            font-size: 0.95rem;
-        }
-
-        form {
-            display: flex;
-            flex-direction: column;
-            gap: 16px;
-        }
-
-        label {
-            display: flex;
-            flex-direction: column;
-            gap: 6px;
-            font-size: 0.9rem;
-            color: var(--text-secondary);
-        }
-
-        input {
-            padding: 12px 14px;
-            border-radius: var(--radius-md);
-            border: 1px solid var(--border);
-            background: var(--bg-secondary);
-            color: var(--text-primary);
-            font-size: 1rem;
-            transition: border-color var(--transition-fast), box-shadow var(--transition-fast);
-        }
-
-        input:focus {
-            outline: none;
-            border-color: var(--accent);
-            box-shadow: 0 0 0 3px var(--accent-light);
-        }
-
-        button {
-            padding: 12px 16px;
-            border-radius: var(--radius-md);
-            border: none;
-            background: var(--accent);
-            color: white;
-            font-weight: 600;
-            font-size: 1rem;
-            cursor: pointer;
-            transition: background var(--transition-fast), transform var(--transition-fast);
-        }
-
-        button:hover {
-            background: var(--accent-hover);
-        }
-
-        button:active {
-            transform: translateY(1px);
-        }
-
-        .login-footer {
-            font-size: 0.85rem;
-            color: var(--text-tertiary);
-        }
-    </style>
-</head>
-<body>
-    <div class="login-page">
-        <div class="login-card">
-            <div class="login-header">
-                <div class="logo">
-                    <img src="/logo.png" alt="Shrinkray logo">
-                    <span>Shrinkray</span>
-                </div>
-                <h1>Sign in</h1>
-                <p>Use your Shrinkray account to continue.</p>
-            </div>
-            <form method="POST" action="/auth/login">
-                <label>
-                    Username
-                    <input name="username" autocomplete="username" required>
-                </label>
-                <label>
-                    Password
-                    <input type="password" name="password" autocomplete="current-password" required>
-                </label>
-                <button type="submit">Login</button>
-            </form>
-            <div class="login-footer">Protected access for Shrinkray administrators.</div>
-        </div>
-    </div>
-</body>
-</html>`))
-		return err
+		return p.renderLogin(w, r, http.StatusOK, "", "")
 	case http.MethodPost:
 	default:
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -299,34 +170,77 @@ func (p *Provider) HandleLogin(w http.ResponseWriter, r *http.Request) error {
 	if err != nil {
 		return err
 	}
+
+	// Attempts are counted per IP and per username, so neither spreading
+	// guesses across usernames nor across IPs gets around the lockout
+	ip := p.limiter.clientIP(r)
+	keys := []string{"ip:" + ip, "user:" + strings.ToLower(username)}
+	if wait := p.limiter.lockedFor(keys...); wait > 0 {
+		authLog.Warn("Rejected login: locked out", "user", username, "ip", ip, "wait", wait.Round(time.Second))
+		return p.rejectLocked(w, r, username, wait)
+	}
+	if p.captchaRequired(ip) {
+		if err := p.captcha.Verify(r); err != nil {
+			authLog.Warn("CAPTCHA failed", "user", username, "ip", ip, "error", err)
+			p.limiter.fail(keys...)
+			if p.pages != nil && wantsHTML(r) {
+				return p.renderLogin(w, r, http.StatusUnauthorized, username, p.pages.Text(r).Captcha)
+			}
+			return errors.New("captcha required")
+		}
+	}
 	if ok, err := p.verifyPassword(username, password); err != nil || !ok {
+		lockout := p.limiter.fail(keys...)
+		authLog.Warn("Failed login", "user", username, "ip", ip)
+		if lockout > 0 {
+			authLog.Warn("Locked out after repeated failures", "user", username, "ip", ip, "lockout", lockout)
+		}
+		if p.pages != nil && wantsHTML(r) {
+			return p.renderLogin(w, r, http.StatusUnauthorized, username, p.pages.Text(r).Invalid)
+		}
 		return errors.New("invalid credentials")
 	}
+	p.limiter.succeed(keys...)
 
 	expires := time.Now().Add(p.sessionTTL)
-	sessionValue := p.buildSessionValue(username, expires)
+	sessionID := ""
+	if p.sessions != nil {
+		session, err := p.sessions.Create(&auth.User{ID: username, Name: username}, "password", expires, r)
+		if err != nil {
+			return err
+		}
+		sessionID = session.ID
+	}
+	sessionValue := p.buildSessionValue(username, expires, sessionID)
 	http.SetCookie(w, &http.Cookie{
 		Name:     p.cookieName,
 		Value:    sessionValue,
-		Path:     "/",
+		Path:     auth.CookiePath(p.basePath),
 		HttpOnly: true,
 		SameSite: http.SameSiteLaxMode,
 		Expires:  expires,
 		Secure:   isSecureRequest(r),
 	})
 
-	if strings.Contains(r.Header.Get("Accept"), "text/html") {
-		http.Redirect(w, r, "/", http.StatusFound)
+	if wantsHTML(r) {
+		http.Redirect(w, r, p.basePath+"/", http.StatusFound)
 		return nil
 	}
 	w.WriteHeader(http.StatusNoContent)
 	return nil
 }
 
-// HandleLogout clears the session cookie and redirects to login.
+// HandleLogout ends the session and redirects to login.
 func (p *Provider) HandleLogout(w http.ResponseWriter, r *http.Request) error {
+	if p.sessions != nil {
+		if cookie, err := r.Cookie(p.cookieName); err == nil {
+			if _, _, sessionID, err := p.verifySession(cookie.Value); err == nil && sessionID != "" {
+				p.sessions.Revoke(sessionID)
+			}
+		}
+	}
 	p.ClearSession(w, r)
-	http.Redirect(w, r, "/auth/login", http.StatusFound)
+	http.Redirect(w, r, p.basePath+"/auth/login", http.StatusFound)
 	return nil
 }
 
@@ -335,7 +249,7 @@ func (p *Provider) ClearSession(w http.ResponseWriter, r *http.Request) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     p.cookieName,
 		Value:    "",
-		Path:     "/",
+		Path:     auth.CookiePath(p.basePath),
 		MaxAge:   -1,
 		HttpOnly: true,
 		SameSite: http.SameSiteLaxMode,
@@ -343,6 +257,39 @@ func (p *Provider) ClearSession(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// renderLogin renders the login page, with the CAPTCHA if the client needs one.
+func (p *Provider) renderLogin(w http.ResponseWriter, r *http.Request, status int, username, message string) error {
+	if p.pages == nil {
+		return errors.New("login page not configured")
+	}
+	var widget template.HTML
+	if p.captchaRequired(p.limiter.clientIP(r)) {
+		widget = p.captcha.Widget()
+	}
+	return p.pages.RenderLoginWithCaptcha(w, r, status, username, message, widget)
+}
+
+// rejectLocked answers a login attempt from a locked-out IP or username
+// with 429 and Retry-After. The password isn't checked.
+func (p *Provider) rejectLocked(w http.ResponseWriter, r *http.Request, username string, wait time.Duration) error {
+	wait = wait.Round(time.Second)
+	w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())))
+	if p.pages != nil && wantsHTML(r) {
+		message := fmt.Sprintf(p.pages.Text(r).Locked, wait)
+		return p.renderLogin(w, r, http.StatusTooManyRequests, username, message)
+	}
+	http.Error(w, "too many failed login attempts", http.StatusTooManyRequests)
+	return nil
+}
+
+func (p *Provider) captchaRequired(ip string) bool {
+	return p.captcha != nil && p.limiter.failureCount("ip:"+ip) >= p.captchaAfter
+}
+
+func wantsHTML(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
 func isSecureRequest(r *http.Request) bool {
 	if forwarded := r.Header.Get("X-Forwarded-Proto"); forwarded != "" {
 		parts := strings.Split(forwarded, ",")
@@ -390,8 +337,12 @@ func detectHashAlgo(hash string) string {
 	return "bcrypt"
 }
 
-func (p *Provider) buildSessionValue(username string, expiry time.Time) string {
+// buildSessionValue signs "username|expiry[|session ID]"
+func (p *Provider) buildSessionValue(username string, expiry time.Time, sessionID string) string {
 	payload := fmt.Sprintf("%s|%d", username, expiry.Unix())
+	if sessionID != "" {
+		payload += "|" + sessionID
+	}
 	signature := p.sign(payload)
 	return payload + "|" + signature
 }
@@ -402,27 +353,32 @@ func (p *Provider) sign(payload string) string {
 	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
 }
 
-func (p *Provider) verifySession(value string) (string, time.Time, error) {
+func (p *Provider) verifySession(value string) (string, time.Time, string, error) {
 	parts := strings.Split(value, "|")
-	if len(parts) != 3 {
-		return "", time.Time{}, errors.New("invalid session format")
+	if len(parts) != 3 && len(parts) != 4 {
+		return "", time.Time{}, "", errors.New("invalid session format")
 	}
-	payload := parts[0] + "|" + parts[1]
-	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	last := len(parts) - 1
+	payload := strings.Join(parts[:last], "|")
+	signature, err := base64.RawURLEncoding.DecodeString(parts[last])
 	if err != nil {
-		return "", time.Time{}, errors.New("invalid session signature")
+		return "", time.Time{}, "", errors.New("invalid session signature")
 	}
 	expected := hmac.New(sha256.New, p.secret)
 	expected.Write([]byte(payload))
 	expectedSum := expected.Sum(nil)
 	if subtle.ConstantTimeCompare(signature, expectedSum) != 1 {
-		return "", time.Time{}, errors.New("invalid session signature")
+		return "", time.Time{}, "", errors.New("invalid session signature")
 	}
 	expiryUnix, err := strconv.ParseInt(parts[1], 10, 64)
 	if err != nil {
-		return "", time.Time{}, errors.New("invalid session expiry")
+		return "", time.Time{}, "", errors.New("invalid session expiry")
+	}
+	sessionID := ""
+	if len(parts) == 4 {
+		sessionID = parts[2]
 	}
-	return parts[0], time.Unix(expiryUnix, 0), nil
+	return parts[0], time.Unix(expiryUnix, 0), sessionID, nil
 }
 
 func readCredentials(r *http.Request) (string, string, error) {
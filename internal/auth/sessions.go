@@ -0,0 +1,252 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/logger"
+)
+
+var authLog = logger.For("auth")
+
+// ErrSessionNotFound is returned when revoking an unknown session.
+var ErrSessionNotFound = errors.New("session not found")
+
+// lastSeenSaveInterval limits how often a session's LastSeen alone causes
+// the store to be rewritten.
+const lastSeenSaveInterval = time.Minute
+
+// Session is a login recorded in a SessionStore.
+type Session struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	Name      string    `json:"name,omitempty"`
+	Provider  string    `json:"provider"`
+	IP        string    `json:"ip,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	LastSeen  time.Time `json:"last_seen"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// SessionStore keeps sessions server-side so they can be listed and
+// revoked. Providers put the session ID in their signed cookie and reject
+// cookies whose session is no longer in the store.
+type SessionStore struct {
+	mu        sync.Mutex
+	path      string
+	sessions  map[string]*Session
+	lastSaved time.Time
+}
+
+// NewSessionStore loads the sessions saved at path, or starts empty if
+// there is no file yet.
+func NewSessionStore(path string) (*SessionStore, error) {
+	s := &SessionStore{path: path, sessions: make(map[string]*Session)}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []*Session
+	if err := json.Unmarshal(data, &sessions); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, session := range sessions {
+		if session.ExpiresAt.After(now) {
+			s.sessions[session.ID] = session
+		}
+	}
+	return s, nil
+}
+
+// Create records a new session for user, logged in through provider from r.
+func (s *SessionStore) Create(user *User, provider string, expires time.Time, r *http.Request) (*Session, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := &Session{
+		ID:        base64.RawURLEncoding.EncodeToString(buf),
+		UserID:    user.ID,
+		Name:      user.Name,
+		Provider:  provider,
+		IP:        remoteIP(r),
+		UserAgent: r.UserAgent(),
+		CreatedAt: now,
+		LastSeen:  now,
+		ExpiresAt: expires,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneExpired(now)
+	s.sessions[session.ID] = session
+	s.save()
+	copied := *session
+	return &copied, nil
+}
+
+// Valid reports whether the session id exists and hasn't expired, and
+// marks it as seen.
+func (s *SessionStore) Valid(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	now := time.Now()
+	if !ok || !session.ExpiresAt.After(now) {
+		return false
+	}
+	session.LastSeen = now
+	if now.Sub(s.lastSaved) > lastSeenSaveInterval {
+		s.save()
+	}
+	return true
+}
+
+// Extend moves the expiry of session id, after its provider renewed it.
+func (s *SessionStore) Extend(id string, expires time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if session, ok := s.sessions[id]; ok {
+		session.ExpiresAt = expires
+		s.save()
+	}
+}
+
+// List returns the active sessions, most recently seen first.
+func (s *SessionStore) List() []*Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pruneExpired(time.Now())
+	result := make([]*Session, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		copied := *session
+		result = append(result, &copied)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].LastSeen.After(result[j].LastSeen)
+	})
+	return result
+}
+
+// Get returns the active session id.
+func (s *SessionStore) Get(id string) (*Session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok || !session.ExpiresAt.After(time.Now()) {
+		return nil, false
+	}
+	copied := *session
+	return &copied, true
+}
+
+// Revoke ends the session id; its cookie stops working immediately.
+func (s *SessionStore) Revoke(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return ErrSessionNotFound
+	}
+	delete(s.sessions, id)
+	s.save()
+	authLog.Info("Revoked a session", "user", session.UserID)
+	return nil
+}
+
+// RevokeUser ends every session of userID ("log out everywhere"). Returns
+// how many were revoked.
+func (s *SessionStore) RevokeUser(userID string) int {
+	if userID == "" {
+		return 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	revoked := 0
+	for id, session := range s.sessions {
+		if session.UserID == userID {
+			delete(s.sessions, id)
+			revoked++
+		}
+	}
+	if revoked > 0 {
+		s.save()
+		authLog.Info("Revoked sessions", "user", userID, "count", revoked)
+	}
+	return revoked
+}
+
+// pruneExpired drops expired sessions. Must hold s.mu.
+func (s *SessionStore) pruneExpired(now time.Time) {
+	for id, session := range s.sessions {
+		if !session.ExpiresAt.After(now) {
+			delete(s.sessions, id)
+		}
+	}
+}
+
+// save writes the sessions to disk. Must hold s.mu.
+func (s *SessionStore) save() {
+	s.lastSaved = time.Now()
+	sessions := make([]*Session, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+
+	data, err := json.MarshalIndent(sessions, "", "  ")
+	if err != nil {
+		authLog.Warn("Failed to encode sessions", "error", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		authLog.Warn("Failed to save sessions", "error", err)
+		return
+	}
+
+	// Write to temp file first, then rename (atomic). Session IDs are
+	// credentials, so the file is only readable by its owner.
+	tmpPath := s.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		authLog.Warn("Failed to save sessions", "error", err)
+		return
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		authLog.Warn("Failed to save sessions", "error", err)
+	}
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -10,6 +10,8 @@ type User struct {
 	ID    string
 	Email string
 	Name  string
+	// SessionID identifies the login in the SessionStore, if one is used.
+	SessionID string
 }
 
 var (
@@ -26,6 +28,13 @@ type Provider interface {
 	HandleCallback(w http.ResponseWriter, r *http.Request) error
 }
 
+// SessionRefresher is implemented by providers that can renew a session
+// close to expiry. The middleware calls it instead of Authenticate so the
+// renewed session cookie can be written.
+type SessionRefresher interface {
+	AuthenticateAndRefresh(w http.ResponseWriter, r *http.Request) (*User, error)
+}
+
 // SessionCleaner clears any stored session state (cookies).
 type SessionCleaner interface {
 	ClearSession(w http.ResponseWriter, r *http.Request)
@@ -35,3 +44,12 @@ type SessionCleaner interface {
 type LogoutHandlerProvider interface {
 	HandleLogout(w http.ResponseWriter, r *http.Request) error
 }
+
+// CookiePath returns the Path for cookies of an app served under basePath
+// ("" for the root).
+func CookiePath(basePath string) string {
+	if basePath == "" {
+		return "/"
+	}
+	return basePath
+}
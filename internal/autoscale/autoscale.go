@@ -0,0 +1,182 @@
+// Package autoscale grows and shrinks the worker pool with system load, so
+// the machine stays responsive while it is in use (e.g. Plex streaming) but
+// transcodes at full capacity when it isn't.
+package autoscale
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/config"
+	"github.com/gwlsn/shrinkray/internal/jobs"
+	"github.com/gwlsn/shrinkray/internal/logger"
+)
+
+var autoscaleLog = logger.For("autoscale")
+
+// Pool is the part of jobs.WorkerPool the autoscaler drives
+type Pool interface {
+	Workers() []jobs.WorkerStatus
+	Resize(n int)
+	DrainWorker(id int) error
+}
+
+// Status is the autoscaler's latest sample and decision
+type Status struct {
+	Enabled   bool      `json:"enabled"`
+	Sample    *Sample   `json:"sample,omitempty"`
+	Workers   int       `json:"workers"`
+	Decision  string    `json:"decision,omitempty"` // e.g. "grow: cpu 12% below 50%"
+	CheckedAt time.Time `json:"checked_at,omitempty"`
+}
+
+// Scaler samples load and resizes the pool
+type Scaler struct {
+	pool    Pool
+	queue   *jobs.Queue
+	sampler interface{ Sample() Sample }
+	cfg     func() config.AutoscaleConfig
+
+	mu     sync.Mutex
+	status Status
+}
+
+// New creates a scaler. cfg is re-read every sample so config changes apply
+// without a restart.
+func New(pool Pool, queue *jobs.Queue, cfg func() config.AutoscaleConfig) *Scaler {
+	return &Scaler{pool: pool, queue: queue, sampler: NewSampler(), cfg: cfg}
+}
+
+// Start samples every interval_seconds until ctx is done. While the
+// autoscaler is disabled the pool is left alone.
+func (s *Scaler) Start(ctx context.Context) {
+	go func() {
+		for {
+			interval := time.Duration(s.cfg().IntervalSeconds) * time.Second
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+			}
+			s.Check()
+		}
+	}()
+}
+
+// Status returns the latest sample and decision
+func (s *Scaler) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := s.status
+	status.Enabled = s.cfg().Enabled
+	return status
+}
+
+// Check samples load and adds or drains one worker if called for
+func (s *Scaler) Check() {
+	cfg := s.cfg()
+	if !cfg.Enabled {
+		return
+	}
+	sample := s.sampler.Sample()
+
+	workers := s.pool.Workers()
+	active, draining := 0, false
+	for _, w := range workers {
+		if w.State == "draining" {
+			draining = true
+		} else {
+			active++
+		}
+	}
+	stats := s.queue.Stats()
+	waiting := stats.Pending + stats.PendingProbe
+
+	delta, reason := decide(cfg, sample, active, waiting)
+	switch {
+	case delta > 0 && !draining:
+		// Resize counts draining workers too, so only grow once they're gone
+		s.pool.Resize(len(workers) + 1)
+		autoscaleLog.Info("Adding a worker", "reason", reason, "workers", active+1)
+	case delta < 0 && !draining:
+		// One at a time: the load only drops once a draining worker's job ends
+		if id, ok := drainCandidate(workers); ok {
+			if err := s.pool.DrainWorker(id); err != nil {
+				autoscaleLog.Warn("Could not drain worker", "worker", id, "error", err)
+			} else {
+				autoscaleLog.Info("Draining a worker", "reason", reason, "worker", id, "workers", active-1)
+			}
+		}
+	}
+	s.setStatus(Status{Sample: &sample, Workers: active, Decision: reason, CheckedAt: time.Now()})
+}
+
+func (s *Scaler) setStatus(status Status) {
+	s.mu.Lock()
+	s.status = status
+	s.mu.Unlock()
+}
+
+// decide returns +1 to add a worker, -1 to remove one, or 0, and why
+func decide(cfg config.AutoscaleConfig, sample Sample, workers int, waiting int) (int, string) {
+	switch {
+	case workers > cfg.MaxWorkers:
+		return -1, "shrink: above max_workers"
+	case workers < cfg.MinWorkers:
+		return 1, "grow: below min_workers"
+	}
+
+	over := ""
+	switch {
+	case sample.CPU > cfg.CPUHighPercent:
+		over = percentReason("cpu", sample.CPU, "above", cfg.CPUHighPercent)
+	case sample.GPU > cfg.GPUHighPercent:
+		over = percentReason("gpu", sample.GPU, "above", cfg.GPUHighPercent)
+	case sample.Memory > cfg.MemoryHighPercent:
+		over = percentReason("memory", sample.Memory, "above", cfg.MemoryHighPercent)
+	}
+	if over != "" {
+		if workers <= cfg.MinWorkers {
+			return 0, "hold: " + over + ", at min_workers"
+		}
+		return -1, "shrink: " + over
+	}
+
+	// Only grow on a reading that shows room, and while there's work for it
+	idle := sample.CPU >= 0 && sample.CPU < cfg.CPULowPercent && sample.GPU < cfg.GPULowPercent
+	switch {
+	case !idle:
+		return 0, "hold"
+	case waiting == 0:
+		return 0, "hold: no jobs waiting"
+	case workers >= cfg.MaxWorkers:
+		return 0, "hold: at max_workers"
+	}
+	return 1, percentReason("grow: cpu", sample.CPU, "below", cfg.CPULowPercent)
+}
+
+func percentReason(metric string, value float64, direction string, threshold float64) string {
+	return fmt.Sprintf("%s %.0f%% %s %.0f%%", metric, value, direction, threshold)
+}
+
+// drainCandidate picks the worker to drain: an idle one if any, otherwise
+// the newest busy one, which lets its current job finish
+func drainCandidate(workers []jobs.WorkerStatus) (int, bool) {
+	var best *jobs.WorkerStatus
+	for i := range workers {
+		w := &workers[i]
+		if w.State == "draining" {
+			continue
+		}
+		if best == nil || (w.State == "idle" && best.State != "idle") ||
+			((w.State == "idle") == (best.State == "idle") && w.ID > best.ID) {
+			best = w
+		}
+	}
+	if best == nil {
+		return 0, false
+	}
+	return best.ID, true
+}
@@ -0,0 +1,99 @@
+package autoscale
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gwlsn/shrinkray/internal/config"
+	"github.com/gwlsn/shrinkray/internal/jobs"
+)
+
+func testConfig() config.AutoscaleConfig {
+	return config.AutoscaleConfig{
+		Enabled:           true,
+		MinWorkers:        1,
+		MaxWorkers:        3,
+		CPUHighPercent:    85,
+		CPULowPercent:     50,
+		GPUHighPercent:    90,
+		GPULowPercent:     60,
+		MemoryHighPercent: 90,
+	}
+}
+
+func TestDecide(t *testing.T) {
+	tests := []struct {
+		name    string
+		sample  Sample
+		workers int
+		waiting int
+		want    int
+	}{
+		{"busy cpu shrinks", Sample{CPU: 95, GPU: -1, Memory: 40}, 2, 5, -1},
+		{"busy gpu shrinks", Sample{CPU: 30, GPU: 97, Memory: 40}, 2, 5, -1},
+		{"low memory shrinks", Sample{CPU: 30, GPU: -1, Memory: 95}, 2, 5, -1},
+		{"busy at min holds", Sample{CPU: 95, GPU: -1, Memory: 40}, 1, 5, 0},
+		{"idle with work grows", Sample{CPU: 20, GPU: 10, Memory: 40}, 1, 5, 1},
+		{"idle without work holds", Sample{CPU: 20, GPU: 10, Memory: 40}, 1, 0, 0},
+		{"idle at max holds", Sample{CPU: 20, GPU: -1, Memory: 40}, 3, 5, 0},
+		{"between marks holds", Sample{CPU: 70, GPU: -1, Memory: 40}, 2, 5, 0},
+		{"gpu in use holds", Sample{CPU: 20, GPU: 75, Memory: 40}, 2, 5, 0},
+		{"unknown cpu holds", Sample{CPU: -1, GPU: -1, Memory: -1}, 2, 5, 0},
+		{"above max shrinks", Sample{CPU: 20, GPU: -1, Memory: 40}, 5, 5, -1},
+		{"below min grows", Sample{CPU: 95, GPU: -1, Memory: 40}, 0, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason := decide(testConfig(), tt.sample, tt.workers, tt.waiting)
+			if got != tt.want {
+				t.Errorf("decide() = %d (%s), want %d", got, reason, tt.want)
+			}
+		})
+	}
+}
+
+func TestDrainCandidate(t *testing.T) {
+	workers := []jobs.WorkerStatus{
+		{ID: 0, State: "busy"},
+		{ID: 1, State: "idle"},
+		{ID: 2, State: "busy"},
+		{ID: 3, State: "draining"},
+	}
+	if id, ok := drainCandidate(workers); !ok || id != 1 {
+		t.Errorf("expected the idle worker, got %d", id)
+	}
+	workers[1].State = "busy"
+	if id, ok := drainCandidate(workers); !ok || id != 2 {
+		t.Errorf("expected the newest busy worker, got %d", id)
+	}
+	if _, ok := drainCandidate(workers[3:]); ok {
+		t.Error("expected no candidate when every worker is draining")
+	}
+}
+
+func TestSamplerProc(t *testing.T) {
+	procDir := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(procDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("meminfo", "MemTotal:       16000000 kB\nMemFree:         1000000 kB\nMemAvailable:    4000000 kB\n")
+	write("stat", "cpu  100 0 100 700 100 0 0 0 0 0\ncpu0 100 0 100 700 100 0 0 0 0 0\n")
+
+	s := &Sampler{procPath: procDir, gpu: func() float64 { return -1 }}
+	first := s.Sample()
+	if first.CPU != -1 {
+		t.Errorf("expected no CPU reading on the first sample, got %v", first.CPU)
+	}
+	if first.Memory != 75 {
+		t.Errorf("expected 75%% memory in use, got %v", first.Memory)
+	}
+
+	// 300 more busy and 100 more idle jiffies
+	write("stat", "cpu  250 0 250 800 100 0 0 0 0 0\n")
+	if cpu := s.Sample().CPU; cpu != 75 {
+		t.Errorf("expected 75%% CPU, got %v", cpu)
+	}
+}
@@ -0,0 +1,167 @@
+package autoscale
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sample is whole-system utilization in percent. A metric that can't be
+// read on this system (no /proc outside Linux, no supported GPU) is negative.
+type Sample struct {
+	CPU    float64 `json:"cpu_percent"`
+	GPU    float64 `json:"gpu_percent"`
+	Memory float64 `json:"memory_percent"`
+}
+
+// Sampler reads system load. CPU use is measured between calls, so the
+// first sample has none.
+type Sampler struct {
+	procPath string // /proc, replaced in tests
+	gpu      func() float64
+
+	prevBusy  uint64
+	prevTotal uint64
+}
+
+// NewSampler creates a sampler for this machine. GPU utilization comes from
+// nvidia-smi, or AMD's gpu_busy_percent in sysfs; Intel GPUs don't report
+// it, so the GPU thresholds are ignored for them.
+func NewSampler() *Sampler {
+	s := &Sampler{procPath: "/proc", gpu: func() float64 { return -1 }}
+	if smiPath, err := exec.LookPath("nvidia-smi"); err == nil {
+		s.gpu = func() float64 { return nvidiaUtilization(smiPath) }
+	} else if files, _ := filepath.Glob("/sys/class/drm/card*/device/gpu_busy_percent"); len(files) > 0 {
+		s.gpu = func() float64 { return sysfsUtilization(files) }
+	}
+	return s
+}
+
+// Sample reads the current load
+func (s *Sampler) Sample() Sample {
+	return Sample{
+		CPU:    s.cpu(),
+		GPU:    s.gpu(),
+		Memory: s.memory(),
+	}
+}
+
+// cpu returns the share of CPU time that wasn't idle since the last call
+func (s *Sampler) cpu() float64 {
+	busy, total, err := readCPUTimes(filepath.Join(s.procPath, "stat"))
+	if err != nil {
+		return -1
+	}
+	prevBusy, prevTotal := s.prevBusy, s.prevTotal
+	s.prevBusy, s.prevTotal = busy, total
+	if prevTotal == 0 || total <= prevTotal {
+		return -1
+	}
+	return float64(busy-prevBusy) / float64(total-prevTotal) * 100
+}
+
+// readCPUTimes sums the aggregate "cpu" line of /proc/stat; idle and iowait
+// count as not busy
+func readCPUTimes(path string) (busy, total uint64, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || fields[0] != "cpu" {
+			continue
+		}
+		var idle uint64
+		for i, field := range fields[1:] {
+			v, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return 0, 0, err
+			}
+			// guest and guest_nice (9, 10) are already counted in user time
+			if i >= 8 {
+				break
+			}
+			total += v
+			if i == 3 || i == 4 {
+				idle += v
+			}
+		}
+		return total - idle, total, nil
+	}
+	return 0, 0, fmt.Errorf("no cpu line in %s", path)
+}
+
+// memory returns the share of memory not available to new processes
+func (s *Sampler) memory() float64 {
+	f, err := os.Open(filepath.Join(s.procPath, "meminfo"))
+	if err != nil {
+		return -1
+	}
+	defer f.Close()
+
+	var memTotal, memAvailable float64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		v, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			memTotal = v
+		case "MemAvailable:":
+			memAvailable = v
+		}
+	}
+	if memTotal == 0 {
+		return -1
+	}
+	return (memTotal - memAvailable) / memTotal * 100
+}
+
+// nvidiaUtilization returns the busiest NVIDIA GPU's utilization
+func nvidiaUtilization(smiPath string) float64 {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, smiPath, "--query-gpu=utilization.gpu", "--format=csv,noheader,nounits").Output()
+	if err != nil {
+		return -1
+	}
+	busiest := -1.0
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if v, err := strconv.ParseFloat(strings.TrimSpace(line), 64); err == nil {
+			busiest = max(busiest, v)
+		}
+	}
+	return busiest
+}
+
+// sysfsUtilization returns the busiest GPU's gpu_busy_percent
+func sysfsUtilization(files []string) float64 {
+	busiest := -1.0
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		if v, err := strconv.ParseFloat(strings.TrimSpace(string(data)), 64); err == nil {
+			busiest = max(busiest, v)
+		}
+	}
+	return busiest
+}
@@ -2,7 +2,6 @@ package browse
 
 import (
 	"context"
-	"log"
 	"os"
 	"path/filepath"
 	"sort"
@@ -12,8 +11,11 @@ import (
 	"time"
 
 	"github.com/gwlsn/shrinkray/internal/ffmpeg"
+	"github.com/gwlsn/shrinkray/internal/logger"
 )
 
+var browseLog = logger.For("browse")
+
 // Entry represents a file or directory in the browser
 type Entry struct {
 	Name           string              `json:"name"`
@@ -27,15 +29,49 @@ type Entry struct {
 	Processed      bool                `json:"processed,omitempty"`  // For video files: true if already processed
 	ProcessedCount int                 `json:"processed_count"`      // For directories: number of processed video files
 	Pending        bool                `json:"pending,omitempty"`    // True if queued for processing
+	Aggregate      *Aggregate          `json:"aggregate,omitempty"`  // For directories: recursive rollup (aggregate=true)
+	Estimate       *ffmpeg.Estimate    `json:"estimate,omitempty"`   // For video files: predicted output size for the preset (preset=)
+	Hardlinks      int                 `json:"hardlinks,omitempty"`  // For video files: hard links to the file, when more than one
+	Symlink        bool                `json:"symlink,omitempty"`    // For video files: the entry is a symbolic link
+	Extra          string              `json:"extra,omitempty"`      // For video files: why it looks like a sample or extra (see ExtraReason)
+}
+
+// Aggregate is a recursive rollup of the video files under a directory,
+// used to judge at a glance whether a show or season is worth queuing.
+type Aggregate struct {
+	Episodes  int                   `json:"episodes"`   // Video files found
+	HEVC      int                   `json:"hevc"`       // Already HEVC
+	AV1       int                   `json:"av1"`        // Already AV1
+	TotalSize int64                 `json:"total_size"` // Combined source size
+	Estimate  *ffmpeg.BatchEstimate `json:"estimate"`   // Potential savings for the chosen preset
+}
+
+// BrowseOptions controls optional (slower) work done by BrowseWithOptions
+type BrowseOptions struct {
+	// Aggregate computes a recursive Aggregate for the directory and each
+	// subdirectory. Every video underneath is probed (results are cached).
+	Aggregate bool
+
+	// Filter drops video entries whose probe doesn't match. Directories
+	// are always listed.
+	Filter Filter
+
+	// Preset, when set, adds an output size estimate to each video entry
+	// that the preset would transcode, and is used for Aggregate estimates
+	Preset *ffmpeg.Preset
 }
 
 // BrowseResult contains the result of browsing a directory
 type BrowseResult struct {
-	Path       string   `json:"path"`
-	Parent     string   `json:"parent,omitempty"`
-	Entries    []*Entry `json:"entries"`
-	VideoCount int      `json:"video_count"` // Total video files in this directory and subdirs
-	TotalSize  int64    `json:"total_size"`  // Total size of video files
+	Path       string     `json:"path"`
+	Parent     string     `json:"parent,omitempty"`
+	Entries    []*Entry   `json:"entries"`
+	VideoCount int        `json:"video_count"`         // Total video files in this directory and subdirs
+	TotalSize  int64      `json:"total_size"`          // Total size of video files
+	Aggregate  *Aggregate `json:"aggregate,omitempty"` // Recursive rollup for this directory (aggregate=true)
+
+	// Combined estimate for the video files listed directly in this directory (preset=)
+	Estimate *ffmpeg.BatchEstimate `json:"estimate,omitempty"`
 }
 
 // Browser handles file system browsing with video metadata
@@ -45,9 +81,14 @@ type Browser struct {
 	mediaRootMu       sync.RWMutex
 	hideProcessingTmp atomic.Bool
 
-	// Cache for probe results (path -> result)
-	cacheMu sync.RWMutex
-	cache   map[string]*ffmpeg.ProbeResult
+	// Cache for probe results, keyed by path and validated by size+mtime
+	cache *probeCache
+
+	// Name index of the media tree for Search
+	index searchIndex
+
+	// Poster thumbnail cache, nil until EnableThumbnails
+	thumbs *thumbnailCache
 }
 
 // NewBrowser creates a new Browser with the given prober and media root
@@ -55,7 +96,8 @@ func NewBrowser(prober *ffmpeg.Prober, mediaRoot string) *Browser {
 	return &Browser{
 		prober:    prober,
 		mediaRoot: normalizeMediaRoot(mediaRoot),
-		cache:     make(map[string]*ffmpeg.ProbeResult),
+		cache:     newProbeCache(),
+		index:     searchIndex{refresh: make(chan struct{}, 1)},
 	}
 }
 
@@ -81,6 +123,7 @@ func (b *Browser) SetMediaRoot(mediaRoot string) {
 	b.mediaRoot = normalized
 	b.mediaRootMu.Unlock()
 	b.ClearCache()
+	b.requestIndexRefresh()
 }
 
 // SetHideProcessingTmp controls whether shrinkray.tmp files are hidden from browse results.
@@ -90,6 +133,11 @@ func (b *Browser) SetHideProcessingTmp(enabled bool) {
 
 // Browse returns the contents of a directory
 func (b *Browser) Browse(ctx context.Context, path string) (*BrowseResult, error) {
+	return b.BrowseWithOptions(ctx, path, BrowseOptions{})
+}
+
+// BrowseWithOptions lists a directory like Browse, optionally adding recursive rollups
+func (b *Browser) BrowseWithOptions(ctx context.Context, path string, opts BrowseOptions) (*BrowseResult, error) {
 	// Convert to absolute path for consistent comparisons
 	cleanPath, err := filepath.Abs(path)
 	if err != nil {
@@ -98,7 +146,7 @@ func (b *Browser) Browse(ctx context.Context, path string) (*BrowseResult, error
 	mediaRoot := b.MediaRoot()
 
 	// Ensure path is within media root
-	if !strings.HasPrefix(cleanPath, mediaRoot) {
+	if !Within(mediaRoot, cleanPath) {
 		cleanPath = mediaRoot
 	}
 
@@ -113,7 +161,7 @@ func (b *Browser) Browse(ctx context.Context, path string) (*BrowseResult, error
 	}
 
 	// Set parent path (if not at root)
-	if cleanPath != mediaRoot {
+	if !SamePath(cleanPath, mediaRoot) {
 		result.Parent = filepath.Dir(cleanPath)
 	}
 
@@ -156,22 +204,29 @@ func (b *Browser) Browse(ctx context.Context, path string) (*BrowseResult, error
 				mu.Unlock()
 			}(entry, entryPath)
 		} else if ffmpeg.IsVideoFile(e.Name()) {
+			entry.Symlink = e.Type()&os.ModeSymlink != 0
+			entry.Extra = ExtraReason(entryPath, 0)
+			if links := ffmpeg.LinkCount(info); links > 1 {
+				entry.Hardlinks = links
+			}
+
 			// Probe video files to get codec/resolution info for UI
 			wg.Add(1)
 			go func(entry *Entry) {
 				defer wg.Done()
-				// Use independent context - don't let parent request timeout kill probes
-				probeCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-				defer cancel()
-
-				probeResult := b.getProbeResult(probeCtx, entry.Path)
+				// Gives up waiting for a probe slot when the request ends
+				probeResult := b.getProbeResult(ctx, entry.Path)
 				if probeResult != nil {
 					mu.Lock()
 					entry.VideoInfo = probeResult
 					entry.Size = probeResult.Size
+					entry.Extra = ExtraReason(entry.Path, probeResult.Duration)
+					if opts.Preset != nil && !ffmpeg.WouldSkip(probeResult, opts.Preset) {
+						entry.Estimate = ffmpeg.EstimateTranscode(probeResult, opts.Preset)
+					}
 					mu.Unlock()
 				} else {
-					log.Printf("No probe result for %s", entry.Name)
+					browseLog.Debug("No probe result", "file", entry.Name)
 				}
 			}(entry)
 
@@ -188,6 +243,33 @@ func (b *Browser) Browse(ctx context.Context, path string) (*BrowseResult, error
 
 	wg.Wait()
 
+	if !opts.Filter.IsZero() {
+		kept := result.Entries[:0]
+		for _, entry := range result.Entries {
+			if entry.IsDir || !ffmpeg.IsVideoFile(entry.Name) || opts.Filter.Matches(entry.VideoInfo) {
+				kept = append(kept, entry)
+				continue
+			}
+			result.VideoCount--
+			result.TotalSize -= entry.Size
+		}
+		result.Entries = kept
+	}
+
+	if opts.Preset != nil {
+		var probes []*ffmpeg.ProbeResult
+		for _, entry := range result.Entries {
+			if entry.VideoInfo != nil {
+				probes = append(probes, entry.VideoInfo)
+			}
+		}
+		result.Estimate = ffmpeg.EstimateMultiple(probes, opts.Preset)
+	}
+
+	if opts.Aggregate {
+		b.aggregate(ctx, result, opts.Preset)
+	}
+
 	// Sort entries: directories first, then by name
 	sort.Slice(result.Entries, func(i, j int) bool {
 		if result.Entries[i].IsDir != result.Entries[j].IsDir {
@@ -199,6 +281,52 @@ func (b *Browser) Browse(ctx context.Context, path string) (*BrowseResult, error
 	return result, nil
 }
 
+// aggregate probes every video under the listed directory once and rolls
+// up codec counts and estimated savings for it and for each subdirectory
+// entry. Probe results are cached, so repeat calls are cheap.
+func (b *Browser) aggregate(ctx context.Context, result *BrowseResult, preset *ffmpeg.Preset) {
+	probes, err := b.GetVideoFiles(ctx, []string{result.Path})
+	if err != nil {
+		browseLog.Warn("Aggregate failed", "path", result.Path, "error", err)
+		return
+	}
+
+	// Each file counts toward the subdirectory of the listing it's under
+	bySubdir := make(map[string][]*ffmpeg.ProbeResult)
+	for _, probe := range probes {
+		rel, err := filepath.Rel(result.Path, probe.Path)
+		if err != nil {
+			continue
+		}
+		if dir, _, nested := strings.Cut(filepath.ToSlash(rel), "/"); nested {
+			bySubdir[dir] = append(bySubdir[dir], probe)
+		}
+	}
+
+	result.Aggregate = aggregateProbes(probes, preset)
+	for _, entry := range result.Entries {
+		if entry.IsDir {
+			entry.Aggregate = aggregateProbes(bySubdir[entry.Name], preset)
+		}
+	}
+}
+
+// aggregateProbes builds an Aggregate from probe results
+func aggregateProbes(probes []*ffmpeg.ProbeResult, preset *ffmpeg.Preset) *Aggregate {
+	agg := &Aggregate{Estimate: ffmpeg.EstimateMultiple(probes, preset)}
+	for _, probe := range probes {
+		agg.Episodes++
+		agg.TotalSize += probe.Size
+		if probe.IsHEVC {
+			agg.HEVC++
+		}
+		if probe.IsAV1 {
+			agg.AV1++
+		}
+	}
+	return agg
+}
+
 // countVideos counts video files in a directory recursively
 func (b *Browser) countVideos(dirPath string) (count int, totalSize int64) {
 	filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
@@ -230,27 +358,31 @@ func (b *Browser) countVideos(dirPath string) (count int, totalSize int64) {
 	return count, totalSize
 }
 
-// getProbeResult returns a cached or fresh probe result
+// probeTimeout limits each ffprobe run, counted once it has a probe slot
+// so files waiting behind others in a big folder don't time out
+const probeTimeout = 30 * time.Second
+
+// getProbeResult returns a cached or fresh probe result. Cached results
+// are only used while the file's size and mtime are unchanged.
 func (b *Browser) getProbeResult(ctx context.Context, path string) *ffmpeg.ProbeResult {
-	// Check cache
-	b.cacheMu.RLock()
-	if result, ok := b.cache[path]; ok {
-		b.cacheMu.RUnlock()
-		return result
+	info, statErr := os.Stat(path)
+	if statErr == nil {
+		if result, ok := b.cache.get(path, info); ok {
+			return result
+		}
 	}
-	b.cacheMu.RUnlock()
 
 	// Probe the file
-	result, err := b.prober.Probe(ctx, path)
+	result, err := b.prober.ProbeWithTimeout(ctx, path, probeTimeout)
 	if err != nil {
-		log.Printf("Probe failed for %s: %v", filepath.Base(path), err)
+		browseLog.Warn("Probe failed", "file", filepath.Base(path), "error", err)
 		return nil
 	}
 
 	// Cache the result
-	b.cacheMu.Lock()
-	b.cache[path] = result
-	b.cacheMu.Unlock()
+	if statErr == nil {
+		b.cache.put(path, info, result)
+	}
 
 	return result
 }
@@ -267,6 +399,9 @@ type GetVideoFilesOptions struct {
 	// 1 means current directory plus one level of subdirectories.
 	// Only used when Recursive is true.
 	MaxDepth *int
+
+	// Filter drops files whose probe doesn't match
+	Filter Filter
 }
 
 // GetVideoFiles returns all video files in the given paths (files or directories)
@@ -278,10 +413,86 @@ func (b *Browser) GetVideoFiles(ctx context.Context, paths []string) ([]*ffmpeg.
 
 // GetVideoFilesWithOptions returns all video files in the given paths with recursion control
 func (b *Browser) GetVideoFilesWithOptions(ctx context.Context, paths []string, opts GetVideoFilesOptions) ([]*ffmpeg.ProbeResult, error) {
+	files, err := b.videoFilesIn(paths, opts)
+	if err != nil {
+		return nil, err
+	}
+
 	var results []*ffmpeg.ProbeResult
-	var mu sync.Mutex
-	var wg sync.WaitGroup
+	b.probeEach(ctx, files, opts.Filter, func(result *ffmpeg.ProbeResult) {
+		results = append(results, result)
+	})
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
+	// Sort by path for consistent ordering
+	sortByPath(results)
+
+	return results, nil
+}
+
+// streamFlushInterval is the longest StreamVideoFiles holds probe results
+// back while it waits for a full batch
+const streamFlushInterval = 2 * time.Second
+
+// StreamVideoFiles is GetVideoFilesWithOptions handing results to fn as
+// they're probed rather than all at the end: in batches of up to batchSize,
+// or whatever has been probed every couple of seconds. Each batch is
+// sorted by path; fn is called for one batch at a time. Once ctx is done,
+// probing stops and ctx's error is returned.
+func (b *Browser) StreamVideoFiles(ctx context.Context, paths []string, opts GetVideoFilesOptions, batchSize int, fn func([]*ffmpeg.ProbeResult)) error {
+	files, err := b.videoFilesIn(paths, opts)
+	if err != nil {
+		return err
+	}
+
+	probed := make(chan *ffmpeg.ProbeResult)
+	go func() {
+		b.probeEach(ctx, files, opts.Filter, func(result *ffmpeg.ProbeResult) {
+			select {
+			case probed <- result:
+			case <-ctx.Done():
+			}
+		})
+		close(probed)
+	}()
+
+	ticker := time.NewTicker(streamFlushInterval)
+	defer ticker.Stop()
+
+	var batch []*ffmpeg.ProbeResult
+	flush := func() {
+		if len(batch) > 0 {
+			sortByPath(batch)
+			fn(batch)
+			batch = nil
+		}
+	}
+	for {
+		select {
+		case result, ok := <-probed:
+			if !ok {
+				flush()
+				return ctx.Err()
+			}
+			batch = append(batch, result)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// videoFilesIn lists the video files in paths (files or directories) under
+// the media root. A file reached both directly and through a symlink is
+// listed once.
+func (b *Browser) videoFilesIn(paths []string, opts GetVideoFilesOptions) ([]string, error) {
+	var files []string
 	for _, path := range paths {
 		// Convert to absolute path for consistent comparisons
 		cleanPath, err := filepath.Abs(path)
@@ -290,7 +501,7 @@ func (b *Browser) GetVideoFilesWithOptions(ctx context.Context, paths []string,
 		}
 
 		// Ensure path is within media root
-		if !strings.HasPrefix(cleanPath, b.MediaRoot()) {
+		if !Within(b.MediaRoot(), cleanPath) {
 			continue
 		}
 
@@ -306,65 +517,85 @@ func (b *Browser) GetVideoFilesWithOptions(ctx context.Context, paths []string,
 				return nil, err
 			}
 
-			for _, fp := range videoPaths {
-				wg.Add(1)
-				go func(filePath string) {
-					defer wg.Done()
-					// Use independent context per probe to prevent one hanging probe
-					// from affecting others
-					probeCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-					defer cancel()
-					if result := b.getProbeResult(probeCtx, filePath); result != nil {
-						mu.Lock()
-						results = append(results, result)
-						mu.Unlock()
-					}
-				}(fp)
-			}
+			files = append(files, videoPaths...)
 		} else if ffmpeg.IsVideoFile(cleanPath) {
 			if b.hideProcessingTmp.Load() && isTrickplayTmp(filepath.Base(cleanPath)) {
 				continue
 			}
-			wg.Add(1)
-			go func(fp string) {
-				defer wg.Done()
-				// Use independent context per probe to prevent one hanging probe
-				// from affecting others
-				probeCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-				defer cancel()
-				if result := b.getProbeResult(probeCtx, fp); result != nil {
+			files = append(files, cleanPath)
+		}
+	}
+
+	if duplicates := symlinkDuplicates(files); len(duplicates) > 0 {
+		kept := files[:0]
+		for _, file := range files {
+			if !duplicates[file] {
+				kept = append(kept, file)
+			}
+		}
+		files = kept
+	}
+	return files, nil
+}
+
+// probeEach probes files with as many goroutines as there are probe slots
+// (see ffmpeg.SetProbeConcurrency) and calls fn, one result at a time, with
+// each that probed and matches filter. Each probe gets its own timeout so
+// one hanging probe doesn't affect others; once ctx is done, the files not
+// yet started are left unprobed.
+func (b *Browser) probeEach(ctx context.Context, files []string, filter Filter, fn func(*ffmpeg.ProbeResult)) {
+	next := make(chan string)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for range min(ffmpeg.ProbeConcurrency(), len(files)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range next {
+				if result := b.getProbeResult(ctx, file); result != nil && filter.Matches(result) {
 					mu.Lock()
-					results = append(results, result)
+					fn(result)
 					mu.Unlock()
 				}
-			}(cleanPath)
+			}
+		}()
+	}
+	for _, file := range files {
+		select {
+		case next <- file:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
 		}
 	}
-
+	close(next)
 	wg.Wait()
+}
 
-	// Sort by path for consistent ordering
+func sortByPath(results []*ffmpeg.ProbeResult) {
 	sort.Slice(results, func(i, j int) bool {
 		return results[i].Path < results[j].Path
 	})
-
-	return results, nil
 }
 
 // DiscoveredFile contains minimal file info for deferred probing
 type DiscoveredFile struct {
-	Path string
-	Size int64
+	Path      string
+	Size      int64
+	Hardlinks int    // Hard links to the file, when more than one
+	Extra     string // Why it looks like a sample or extra, from its name and folder (see ExtraReason)
 }
 
 // DiscoverVideoFiles discovers video files without probing them.
 // Returns file paths and sizes quickly - full probe data is obtained later.
 // This is used for deferred probing mode to make job creation instant.
+// opts.Filter is not applied, since it needs probe data.
 func (b *Browser) DiscoverVideoFiles(ctx context.Context, paths []string, opts GetVideoFilesOptions) ([]DiscoveredFile, error) {
 	var results []DiscoveredFile
 
 	mediaRoot := b.MediaRoot()
-	log.Printf("[browse] DiscoverVideoFiles: mediaRoot=%s, paths=%v, recursive=%v", mediaRoot, paths, opts.Recursive)
+	browseLog.Debug("Discovering video files", "media_root", mediaRoot, "paths", paths, "recursive", opts.Recursive)
 
 	for _, path := range paths {
 		// Convert to absolute path for consistent comparisons
@@ -374,8 +605,8 @@ func (b *Browser) DiscoverVideoFiles(ctx context.Context, paths []string, opts G
 		}
 
 		// Ensure path is within media root
-		if !strings.HasPrefix(cleanPath, mediaRoot) {
-			log.Printf("[browse] Path %s is outside media root %s, skipping", cleanPath, mediaRoot)
+		if !Within(mediaRoot, cleanPath) {
+			browseLog.Warn("Skipping path outside the media root", "path", cleanPath, "media_root", mediaRoot)
 			continue
 		}
 
@@ -385,35 +616,44 @@ func (b *Browser) DiscoverVideoFiles(ctx context.Context, paths []string, opts G
 		}
 
 		if info.IsDir() {
-			log.Printf("[browse] Discovering files in directory: %s", cleanPath)
+			browseLog.Info("Discovering files in directory", "path", cleanPath)
 			// Find video files with recursion control
 			videoPaths, err := b.discoverMediaFiles(cleanPath, opts.Recursive, opts.MaxDepth)
 			if err != nil {
-				log.Printf("[browse] Error discovering files in %s: %v", cleanPath, err)
+				browseLog.Warn("Error discovering files", "path", cleanPath, "error", err)
 				return nil, err
 			}
-			log.Printf("[browse] Found %d video files in %s", len(videoPaths), cleanPath)
+			browseLog.Info("Found video files", "path", cleanPath, "count", len(videoPaths))
 
 			// Get file sizes for each discovered file
 			for _, fp := range videoPaths {
 				if finfo, err := os.Stat(fp); err == nil {
-					results = append(results, DiscoveredFile{
-						Path: fp,
-						Size: finfo.Size(),
-					})
+					results = append(results, discoveredFile(fp, finfo))
 				}
 			}
 		} else if ffmpeg.IsVideoFile(cleanPath) {
 			if b.hideProcessingTmp.Load() && isTrickplayTmp(filepath.Base(cleanPath)) {
 				continue
 			}
-			results = append(results, DiscoveredFile{
-				Path: cleanPath,
-				Size: info.Size(),
-			})
+			results = append(results, discoveredFile(cleanPath, info))
 		}
 	}
 
+	// A file reached both directly and through a symlink is queued once
+	found := make([]string, len(results))
+	for i, result := range results {
+		found[i] = result.Path
+	}
+	if duplicates := symlinkDuplicates(found); len(duplicates) > 0 {
+		kept := results[:0]
+		for _, result := range results {
+			if !duplicates[result.Path] {
+				kept = append(kept, result)
+			}
+		}
+		results = kept
+	}
+
 	// Sort by path for consistent ordering
 	sort.Slice(results, func(i, j int) bool {
 		return results[i].Path < results[j].Path
@@ -422,6 +662,39 @@ func (b *Browser) DiscoverVideoFiles(ctx context.Context, paths []string, opts G
 	return results, nil
 }
 
+// discoveredFile describes a discovered video file from its stat info
+func discoveredFile(path string, info os.FileInfo) DiscoveredFile {
+	file := DiscoveredFile{Path: path, Size: info.Size(), Extra: ExtraReason(path, 0)}
+	if links := ffmpeg.LinkCount(info); links > 1 {
+		file.Hardlinks = links
+	}
+	return file
+}
+
+// symlinkDuplicates returns the paths in paths that are symlinks to another
+// of the paths, so the same file isn't processed twice
+func symlinkDuplicates(paths []string) map[string]bool {
+	set := make(map[string]struct{}, len(paths))
+	for _, path := range paths {
+		set[path] = struct{}{}
+	}
+	duplicates := make(map[string]bool)
+	for _, path := range paths {
+		info, err := os.Lstat(path)
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+		target, err := filepath.EvalSymlinks(path)
+		if err != nil || target == path {
+			continue
+		}
+		if _, ok := set[target]; ok {
+			duplicates[path] = true
+		}
+	}
+	return duplicates
+}
+
 // discoverMediaFiles finds all video files in a directory with recursion control.
 // If recursive is false, only files in the immediate directory are returned.
 // If maxDepth is set, it limits how deep to recurse (0 = current only, 1 = one level, nil = unlimited).
@@ -525,16 +798,29 @@ func DiscoverMediaFiles(root string, recursive bool, maxDepth *int) ([]string, e
 
 // ClearCache clears the probe cache (useful after transcoding completes)
 func (b *Browser) ClearCache() {
-	b.cacheMu.Lock()
-	b.cache = make(map[string]*ffmpeg.ProbeResult)
-	b.cacheMu.Unlock()
+	b.cache.clear()
 }
 
 // InvalidateCache removes a specific path from the cache
 func (b *Browser) InvalidateCache(path string) {
-	b.cacheMu.Lock()
-	delete(b.cache, path)
-	b.cacheMu.Unlock()
+	b.cache.remove(path)
+}
+
+// LoadCache loads persisted probe results from path and saves future
+// changes there. Stale entries are dropped as files are looked up and
+// whenever the search index rescans the media root.
+func (b *Browser) LoadCache(path string) error {
+	return b.cache.load(path)
+}
+
+// FlushCache writes pending probe cache changes to disk
+func (b *Browser) FlushCache() error {
+	return b.cache.flush()
+}
+
+// CacheStats returns probe cache counters
+func (b *Browser) CacheStats() CacheStats {
+	return b.cache.stats()
 }
 
 // ProbeFile probes a single file and returns its metadata
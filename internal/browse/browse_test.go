@@ -2,6 +2,7 @@ package browse
 
 import (
 	"context"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -439,3 +440,432 @@ func TestGetVideoFilesWithOptions(t *testing.T) {
 func intPtr(i int) *int {
 	return &i
 }
+
+func TestAggregateProbes(t *testing.T) {
+	preset := &ffmpeg.Preset{ID: "compress-hevc", Codec: ffmpeg.CodecHEVC}
+	probes := []*ffmpeg.ProbeResult{
+		{Path: "/tv/Show/S01E01.mkv", Size: 1000, Duration: time.Minute, Bitrate: 8_000_000, Height: 1080},
+		{Path: "/tv/Show/S01E02.mkv", Size: 400, Duration: time.Minute, Bitrate: 3_000_000, Height: 1080, IsHEVC: true},
+		{Path: "/tv/Show/S01E03.mkv", Size: 300, Duration: time.Minute, Bitrate: 2_000_000, Height: 1080, IsAV1: true},
+	}
+
+	agg := aggregateProbes(probes, preset)
+	if agg.Episodes != 3 || agg.HEVC != 1 || agg.AV1 != 1 {
+		t.Errorf("unexpected counts: %+v", agg)
+	}
+	if agg.TotalSize != 1700 {
+		t.Errorf("expected total size 1700, got %d", agg.TotalSize)
+	}
+	if agg.Estimate == nil || agg.Estimate.Skipped != 1 || agg.Estimate.Estimated != 2 {
+		t.Errorf("unexpected estimate: %+v", agg.Estimate)
+	}
+}
+
+func TestBrowseAggregatesSubdirectories(t *testing.T) {
+	tmpDir := t.TempDir()
+	browser := NewBrowser(ffmpeg.NewProber(filepath.Join(tmpDir, "no-ffprobe")), tmpDir)
+
+	// Seed the probe cache so no ffprobe is needed
+	files := map[string]bool{ // Path → HEVC
+		filepath.Join("Show", "Season 1", "S01E01.mkv"): false,
+		filepath.Join("Show", "Season 2", "S02E01.mkv"): true,
+		filepath.Join("Film", "Film.mkv"):               false,
+		"Loose.mkv":                                     false,
+	}
+	for name, hevc := range files {
+		path := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("fake video"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		info, _ := os.Stat(path)
+		browser.cache.put(path, info, &ffmpeg.ProbeResult{Path: path, Size: 10, IsHEVC: hevc})
+	}
+	os.MkdirAll(filepath.Join(tmpDir, "Empty"), 0755)
+
+	result, err := browser.BrowseWithOptions(context.Background(), tmpDir, BrowseOptions{Aggregate: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Aggregate == nil || result.Aggregate.Episodes != 4 || result.Aggregate.HEVC != 1 {
+		t.Errorf("unexpected root aggregate: %+v", result.Aggregate)
+	}
+	want := map[string]int{"Show": 2, "Film": 1, "Empty": 0}
+	for _, entry := range result.Entries {
+		if !entry.IsDir {
+			continue
+		}
+		if entry.Aggregate == nil || entry.Aggregate.Episodes != want[entry.Name] {
+			t.Errorf("%s: expected %d episodes, got %+v", entry.Name, want[entry.Name], entry.Aggregate)
+		}
+	}
+	for _, entry := range result.Entries {
+		if entry.Name == "Show" && entry.Aggregate.TotalSize != 20 {
+			t.Errorf("expected Show to total 20 bytes, got %d", entry.Aggregate.TotalSize)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	showDir := filepath.Join(tmpDir, "TV", "Breaking Bad", "Season 1")
+	otherDir := filepath.Join(tmpDir, "TV", "Better Call Saul")
+	hiddenDir := filepath.Join(tmpDir, ".trash")
+	for _, dir := range []string{showDir, otherDir, hiddenDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("failed to create test dirs: %v", err)
+		}
+	}
+	for _, f := range []string{
+		filepath.Join(showDir, "Breaking.Bad.S01E01.mkv"),
+		filepath.Join(showDir, "Breaking.Bad.S01E02.mkv"),
+		filepath.Join(showDir, "notes.txt"),
+		filepath.Join(otherDir, "Better_Call_Saul_S01E01.mkv"),
+		filepath.Join(hiddenDir, "Breaking.Bad.S01E03.mkv"),
+	} {
+		if err := os.WriteFile(f, []byte("fake video content"), 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+	}
+
+	browser := NewBrowser(ffmpeg.NewProber("ffprobe"), tmpDir)
+
+	// The first search starts indexing in the background instead of waiting
+	result, err := browser.Search(context.Background(), "breaking BAD", 0)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if !result.Indexing || len(result.Results) != 0 {
+		t.Fatalf("expected an empty indexing result, got %+v", result)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for result.Indexing && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		result, _ = browser.Search(context.Background(), "breaking BAD", 0)
+	}
+	if result.Indexing || result.IndexedAt.IsZero() {
+		t.Fatal("expected the index to be built")
+	}
+
+	if result.Total != 3 {
+		t.Fatalf("expected 3 matches (show dir + 2 episodes), got %d: %+v", result.Total, result.Results)
+	}
+	show := result.Results[0]
+	if !show.IsDir || show.Name != "Breaking Bad" {
+		t.Errorf("expected show directory first, got %+v", show)
+	}
+	if show.FileCount != 2 {
+		t.Errorf("expected show to roll up 2 videos, got %d", show.FileCount)
+	}
+
+	// Limit applies after counting
+	limited, _ := browser.Search(context.Background(), "s01e01", 1)
+	if limited.Total != 2 || len(limited.Results) != 1 {
+		t.Errorf("expected 2 total / 1 returned, got %d / %d", limited.Total, len(limited.Results))
+	}
+
+	empty, _ := browser.Search(context.Background(), "...", 0)
+	if len(empty.Results) != 0 {
+		t.Errorf("expected no results for punctuation-only query, got %d", len(empty.Results))
+	}
+}
+
+func TestNormalizeSearchText(t *testing.T) {
+	tests := map[string]string{
+		"Breaking.Bad.S01E01":        "breaking bad s01e01",
+		"Better_Call_Saul - [1080p]": "better call saul 1080p",
+		"  ":                         "",
+	}
+	for in, want := range tests {
+		if got := normalizeSearchText(in); got != want {
+			t.Errorf("normalizeSearchText(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestProbeCache(t *testing.T) {
+	tmpDir := t.TempDir()
+	video := filepath.Join(tmpDir, "movie.mkv")
+	if err := os.WriteFile(video, []byte("original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, _ := os.Stat(video)
+
+	cacheFile := filepath.Join(tmpDir, "cache", "probe_cache.json")
+	cache := newProbeCache()
+	if err := cache.load(cacheFile); err != nil {
+		t.Fatalf("load of missing file should succeed: %v", err)
+	}
+	cache.put(video, info, &ffmpeg.ProbeResult{Path: video, VideoCodec: "h264"})
+	if err := cache.flush(); err != nil {
+		t.Fatalf("flush failed: %v", err)
+	}
+
+	// A fresh cache loaded from disk serves the result while the file is unchanged
+	reloaded := newProbeCache()
+	if err := reloaded.load(cacheFile); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	t.Cleanup(func() { reloaded.flush() }) // Don't leave a pending save behind
+	if result, ok := reloaded.get(video, info); !ok || result.VideoCodec != "h264" {
+		t.Fatalf("expected persisted hit, got %v %v", result, ok)
+	}
+
+	// Rewriting the file changes size and mtime, so the entry is stale
+	later := info.ModTime().Add(time.Minute)
+	if err := os.WriteFile(video, []byte("re-encoded"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(video, later, later)
+	changed, _ := os.Stat(video)
+	if _, ok := reloaded.get(video, changed); ok {
+		t.Fatal("expected changed file to miss")
+	}
+
+	stats := reloaded.stats()
+	if stats.Entries != 0 || stats.Hits != 1 || stats.Misses != 1 || stats.Invalidations != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	// Prune drops entries for files the index walk no longer sees
+	reloaded.put(video, changed, &ffmpeg.ProbeResult{Path: video})
+	gone := filepath.Join(tmpDir, "deleted.mkv")
+	reloaded.put(gone, changed, &ffmpeg.ProbeResult{Path: gone})
+	files := map[string]probeCacheEntry{
+		video: {Size: changed.Size(), ModTime: changed.ModTime().UnixNano()},
+	}
+	if removed := reloaded.prune(tmpDir, files); removed != 1 {
+		t.Errorf("expected 1 pruned entry, got %d", removed)
+	}
+	if _, ok := reloaded.get(video, changed); !ok {
+		t.Error("expected unchanged file to survive prune")
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	tmpDir := t.TempDir()
+	mediaDir := filepath.Join(tmpDir, "media")
+	thumbDir := filepath.Join(tmpDir, "thumbs")
+	if err := os.MkdirAll(mediaDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	movies := []string{filepath.Join(mediaDir, "a.mkv"), filepath.Join(mediaDir, "b.mkv")}
+	for _, movie := range movies {
+		if err := os.WriteFile(movie, []byte("fake video"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Fake ffmpeg logs each call and writes a 4-byte "JPEG"
+	calls := filepath.Join(tmpDir, "calls")
+	fakeFFmpeg := filepath.Join(tmpDir, "ffmpeg")
+	script := "#!/bin/sh\necho run >> '" + calls + "'\nprintf 'JPEG'\n"
+	if err := os.WriteFile(fakeFFmpeg, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	countCalls := func() int {
+		data, _ := os.ReadFile(calls)
+		return len(data) / len("run\n")
+	}
+
+	browser := NewBrowser(ffmpeg.NewProber(filepath.Join(tmpDir, "no-ffprobe")), mediaDir)
+	ctx := context.Background()
+
+	if _, err := browser.Thumbnail(ctx, movies[0]); err != ErrThumbnailsDisabled {
+		t.Fatalf("Thumbnail before EnableThumbnails error = %v, want ErrThumbnailsDisabled", err)
+	}
+
+	browser.EnableThumbnails(fakeFFmpeg, thumbDir, 1<<20)
+	thumb, err := browser.Thumbnail(ctx, movies[0])
+	if err != nil {
+		t.Fatalf("Thumbnail failed: %v", err)
+	}
+	if data, _ := os.ReadFile(thumb); string(data) != "JPEG" {
+		t.Errorf("thumbnail contents = %q, want JPEG", data)
+	}
+
+	// Served from the cache the second time
+	if _, err := browser.Thumbnail(ctx, movies[0]); err != nil {
+		t.Fatalf("cached Thumbnail failed: %v", err)
+	}
+	if n := countCalls(); n != 1 {
+		t.Errorf("ffmpeg ran %d times, want 1", n)
+	}
+
+	// Paths outside the media root and non-videos are refused
+	outside := filepath.Join(tmpDir, "outside.mkv")
+	os.WriteFile(outside, []byte("x"), 0644)
+	notes := filepath.Join(mediaDir, "notes.txt")
+	os.WriteFile(notes, []byte("x"), 0644)
+	for _, path := range []string{outside, notes} {
+		if _, err := browser.Thumbnail(ctx, path); err != ErrNotVideo {
+			t.Errorf("Thumbnail(%s) error = %v, want ErrNotVideo", filepath.Base(path), err)
+		}
+	}
+
+	// With room for one thumbnail, the least recently used one is evicted
+	browser.SetThumbnailCacheSize(4)
+	past := time.Now().Add(-time.Hour)
+	os.Chtimes(thumb, past, past)
+	if _, err := browser.Thumbnail(ctx, movies[1]); err != nil {
+		t.Fatalf("Thumbnail(b.mkv) failed: %v", err)
+	}
+	if _, err := os.Stat(thumb); !os.IsNotExist(err) {
+		t.Error("expected a.mkv's thumbnail to be evicted")
+	}
+
+	browser.SetThumbnailCacheSize(0)
+	if _, err := browser.Thumbnail(ctx, movies[1]); err != ErrThumbnailsDisabled {
+		t.Errorf("Thumbnail with size 0 error = %v, want ErrThumbnailsDisabled", err)
+	}
+}
+
+func TestBrowseWithPresetEstimates(t *testing.T) {
+	tmpDir := t.TempDir()
+	h264 := filepath.Join(tmpDir, "h264.mkv")
+	hevc := filepath.Join(tmpDir, "hevc.mkv")
+	browser := NewBrowser(ffmpeg.NewProber(filepath.Join(tmpDir, "no-ffprobe")), tmpDir)
+
+	// Seed the probe cache so no ffprobe is needed
+	for _, path := range []string{h264, hevc} {
+		if err := os.WriteFile(path, []byte("fake video"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		info, _ := os.Stat(path)
+		browser.cache.put(path, info, &ffmpeg.ProbeResult{
+			Path:     path,
+			Size:     3_600_000_000,
+			Duration: time.Hour,
+			Bitrate:  8_000_000,
+			IsHEVC:   path == hevc,
+			Height:   1080,
+		})
+	}
+
+	ctx := context.Background()
+	result, err := browser.BrowseWithOptions(ctx, tmpDir, BrowseOptions{Preset: ffmpeg.GetPreset("compress-hevc")})
+	if err != nil {
+		t.Fatalf("BrowseWithOptions failed: %v", err)
+	}
+	for _, entry := range result.Entries {
+		switch entry.Path {
+		case h264:
+			if entry.Estimate == nil || entry.Estimate.MaxSize >= 3_600_000_000 {
+				t.Errorf("h264 estimate = %+v, want a smaller output", entry.Estimate)
+			}
+		case hevc:
+			if entry.Estimate != nil {
+				t.Errorf("hevc estimate = %+v, want none (already HEVC)", entry.Estimate)
+			}
+		}
+	}
+	if result.Estimate == nil || result.Estimate.Files != 2 || result.Estimate.Estimated != 1 || result.Estimate.Skipped != 1 {
+		t.Errorf("directory estimate = %+v, want 2 files, 1 estimated, 1 skipped", result.Estimate)
+	}
+
+	// Without a preset no estimates are made
+	result, err = browser.Browse(ctx, tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Estimate != nil || result.Entries[0].Estimate != nil {
+		t.Error("expected no estimates without a preset")
+	}
+}
+
+func TestStreamVideoFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	browser := NewBrowser(ffmpeg.NewProber(filepath.Join(tmpDir, "no-ffprobe")), tmpDir)
+
+	// Seed the probe cache so no ffprobe is needed; e.mkv isn't cached, so
+	// its probe fails and it's left out
+	for _, name := range []string{"a.mkv", "b.mkv", "c.mkv", "d.mkv", "e.mkv"} {
+		path := filepath.Join(tmpDir, name)
+		if err := os.WriteFile(path, []byte("fake video"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if name != "e.mkv" {
+			info, _ := os.Stat(path)
+			browser.cache.put(path, info, &ffmpeg.ProbeResult{Path: path, VideoCodec: "h264"})
+		}
+	}
+
+	var batches [][]*ffmpeg.ProbeResult
+	err := browser.StreamVideoFiles(context.Background(), []string{tmpDir}, GetVideoFilesOptions{Recursive: true}, 3, func(probes []*ffmpeg.ProbeResult) {
+		batches = append(batches, probes)
+	})
+	if err != nil {
+		t.Fatalf("StreamVideoFiles failed: %v", err)
+	}
+
+	var total int
+	for _, batch := range batches {
+		if len(batch) > 3 {
+			t.Errorf("expected batches of at most 3, got %d", len(batch))
+		}
+		for i := 1; i < len(batch); i++ {
+			if batch[i-1].Path > batch[i].Path {
+				t.Errorf("expected each batch sorted by path, got %s before %s", batch[i-1].Path, batch[i].Path)
+			}
+		}
+		total += len(batch)
+	}
+	if total != 4 {
+		t.Errorf("expected the 4 probed files streamed, got %d", total)
+	}
+
+	// A cancelled request stops probing
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = browser.StreamVideoFiles(ctx, []string{tmpDir}, GetVideoFilesOptions{Recursive: true}, 3, func([]*ffmpeg.ProbeResult) {})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	tmpDir := t.TempDir()
+	browser := NewBrowser(ffmpeg.NewProber(filepath.Join(tmpDir, "no-ffprobe")), tmpDir)
+
+	probes := map[string]*ffmpeg.ProbeResult{
+		"h264-1080p.mkv": {VideoCodec: "h264", Height: 1080, Bitrate: 10_000_000},
+		"h264-2160p.mkv": {VideoCodec: "h264", Height: 2160, Bitrate: 40_000_000},
+		"hevc-2160p.mkv": {VideoCodec: "hevc", Height: 2160, Bitrate: 20_000_000, IsHEVC: true},
+		"h264-low.mkv":   {VideoCodec: "h264", Height: 2160, Bitrate: 2_000_000},
+	}
+	for name, probe := range probes {
+		path := filepath.Join(tmpDir, name)
+		if err := os.WriteFile(path, []byte("fake video"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		info, _ := os.Stat(path)
+		probe.Path = path
+		browser.cache.put(path, info, probe)
+	}
+
+	// Not HEVC, above 1080p, at least 5 Mbps
+	filter := Filter{ExcludeCodecs: []string{"HEVC"}, MinHeight: 1081, MinBitrateMbps: 5}
+	if filter.Matches(nil) || !(Filter{}).Matches(nil) {
+		t.Error("unprobed files should only match the zero filter")
+	}
+
+	ctx := context.Background()
+	result, err := browser.BrowseWithOptions(ctx, tmpDir, BrowseOptions{Filter: filter})
+	if err != nil {
+		t.Fatalf("BrowseWithOptions failed: %v", err)
+	}
+	if len(result.Entries) != 1 || result.Entries[0].Name != "h264-2160p.mkv" || result.VideoCount != 1 {
+		t.Errorf("filtered browse = %d entries (video_count %d), want only h264-2160p.mkv", len(result.Entries), result.VideoCount)
+	}
+
+	files, err := browser.GetVideoFilesWithOptions(ctx, []string{tmpDir}, GetVideoFilesOptions{Recursive: true, Filter: Filter{Codecs: []string{"hevc"}}})
+	if err != nil {
+		t.Fatalf("GetVideoFilesWithOptions failed: %v", err)
+	}
+	if len(files) != 1 || filepath.Base(files[0].Path) != "hevc-2160p.mkv" {
+		t.Errorf("codec-filtered files = %v, want only hevc-2160p.mkv", files)
+	}
+}
@@ -0,0 +1,285 @@
+package browse
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/ffmpeg"
+	"github.com/gwlsn/shrinkray/internal/logger"
+)
+
+var cacheLog = logger.For("cache")
+
+// probeCacheVersion is bumped whenever ProbeResult changes shape, so
+// results persisted by an older build are discarded instead of served.
+//
+//	2: per-stream language, title, layout and disposition
+//	3: stream profiles
+//	4: field order and interlacing
+//	5: chapters and attachments
+const probeCacheVersion = 5
+
+// probeCacheSaveDelay coalesces bursts of probes (a directory listing
+// probes every file) into a single write.
+const probeCacheSaveDelay = 2 * time.Second
+
+// probeCacheEntry is a probe result plus the file identity it was taken from
+type probeCacheEntry struct {
+	Size    int64               `json:"size"`
+	ModTime int64               `json:"mod_time"` // Unix nanoseconds
+	Result  *ffmpeg.ProbeResult `json:"result"`
+}
+
+// matches reports whether the entry still describes the file on disk
+func (e *probeCacheEntry) matches(info os.FileInfo) bool {
+	return e.Size == info.Size() && e.ModTime == info.ModTime().UnixNano()
+}
+
+// probeCacheFile is the structure saved to disk
+type probeCacheFile struct {
+	Version int                         `json:"version"`
+	Entries map[string]*probeCacheEntry `json:"entries"`
+}
+
+// CacheStats describes the probe cache
+type CacheStats struct {
+	Entries       int       `json:"entries"`
+	Hits          int64     `json:"hits"`
+	Misses        int64     `json:"misses"`
+	Invalidations int64     `json:"invalidations"` // Entries dropped because the file changed or disappeared
+	File          string    `json:"file,omitempty"`
+	FileSize      int64     `json:"file_size"`
+	SavedAt       time.Time `json:"saved_at,omitempty"`
+}
+
+// probeCache maps file paths to probe results, keyed by size and mtime so a
+// replaced or re-encoded file is re-probed. It is optionally persisted.
+type probeCache struct {
+	mu      sync.RWMutex
+	entries map[string]*probeCacheEntry
+
+	hits          int64
+	misses        int64
+	invalidations int64
+
+	filePath  string
+	savedAt   time.Time
+	saveMu    sync.Mutex
+	saveTimer *time.Timer
+}
+
+func newProbeCache() *probeCache {
+	return &probeCache{entries: make(map[string]*probeCacheEntry)}
+}
+
+// get returns the cached result for path if it is still fresh
+func (c *probeCache) get(path string, info os.FileInfo) (*ffmpeg.ProbeResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[path]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	if !entry.matches(info) {
+		delete(c.entries, path)
+		c.invalidations++
+		c.misses++
+		c.scheduleSave()
+		return nil, false
+	}
+	c.hits++
+	return entry.Result, true
+}
+
+// put stores a fresh probe result for path
+func (c *probeCache) put(path string, info os.FileInfo, result *ffmpeg.ProbeResult) {
+	c.mu.Lock()
+	c.entries[path] = &probeCacheEntry{
+		Size:    info.Size(),
+		ModTime: info.ModTime().UnixNano(),
+		Result:  result,
+	}
+	c.mu.Unlock()
+	c.scheduleSave()
+}
+
+// remove drops the entry for path
+func (c *probeCache) remove(path string) {
+	c.mu.Lock()
+	_, ok := c.entries[path]
+	delete(c.entries, path)
+	c.mu.Unlock()
+	if ok {
+		c.scheduleSave()
+	}
+}
+
+// clear drops every entry
+func (c *probeCache) clear() {
+	c.mu.Lock()
+	c.entries = make(map[string]*probeCacheEntry)
+	c.mu.Unlock()
+	c.scheduleSave()
+}
+
+// prune drops entries under root whose file is missing from files or has
+// changed since it was probed. files maps path to current size and mtime.
+func (c *probeCache) prune(root string, files map[string]probeCacheEntry) int {
+	prefix := root + string(filepath.Separator)
+
+	c.mu.Lock()
+	removed := 0
+	for path, entry := range c.entries {
+		if !strings.HasPrefix(path, prefix) {
+			continue
+		}
+		current, ok := files[path]
+		if ok && current.Size == entry.Size && current.ModTime == entry.ModTime {
+			continue
+		}
+		delete(c.entries, path)
+		removed++
+	}
+	c.invalidations += int64(removed)
+	c.mu.Unlock()
+
+	if removed > 0 {
+		c.scheduleSave()
+	}
+	return removed
+}
+
+// stats returns a snapshot of the cache counters
+func (c *probeCache) stats() CacheStats {
+	c.mu.RLock()
+	stats := CacheStats{
+		Entries:       len(c.entries),
+		Hits:          c.hits,
+		Misses:        c.misses,
+		Invalidations: c.invalidations,
+		File:          c.filePath,
+		SavedAt:       c.savedAt,
+	}
+	c.mu.RUnlock()
+
+	if stats.File != "" {
+		if info, err := os.Stat(stats.File); err == nil {
+			stats.FileSize = info.Size()
+		}
+	}
+	return stats
+}
+
+// load replaces the cache with the contents of filePath and persists
+// future changes there. A missing file or an old version starts empty.
+func (c *probeCache) load(filePath string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.filePath = filePath
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var pf probeCacheFile
+	if err := json.Unmarshal(data, &pf); err != nil {
+		return err
+	}
+	if pf.Version != probeCacheVersion {
+		cacheLog.Info("Discarding probe cache from an older version", "version", pf.Version)
+		return nil
+	}
+
+	c.entries = make(map[string]*probeCacheEntry, len(pf.Entries))
+	for path, entry := range pf.Entries {
+		if entry != nil && entry.Result != nil {
+			c.entries[path] = entry
+		}
+	}
+	return nil
+}
+
+// scheduleSave schedules a debounced write of the cache to disk
+func (c *probeCache) scheduleSave() {
+	c.saveMu.Lock()
+	defer c.saveMu.Unlock()
+
+	if c.filePath == "" || c.saveTimer != nil {
+		return
+	}
+	c.saveTimer = time.AfterFunc(probeCacheSaveDelay, func() {
+		c.saveMu.Lock()
+		c.saveTimer = nil
+		c.saveMu.Unlock()
+
+		if err := c.save(); err != nil {
+			cacheLog.Warn("Failed to persist probe cache", "error", err)
+		}
+	})
+}
+
+// flush writes any pending changes immediately
+func (c *probeCache) flush() error {
+	c.saveMu.Lock()
+	pending := c.saveTimer != nil
+	if pending {
+		c.saveTimer.Stop()
+		c.saveTimer = nil
+	}
+	c.saveMu.Unlock()
+
+	if !pending {
+		return nil
+	}
+	return c.save()
+}
+
+// save writes the cache to disk
+func (c *probeCache) save() error {
+	c.mu.RLock()
+	filePath := c.filePath
+	pf := probeCacheFile{
+		Version: probeCacheVersion,
+		Entries: make(map[string]*probeCacheEntry, len(c.entries)),
+	}
+	for path, entry := range c.entries {
+		pf.Entries[path] = entry
+	}
+	c.mu.RUnlock()
+
+	if filePath == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(pf)
+	if err != nil {
+		return err
+	}
+
+	// Write to temp file first, then rename (atomic)
+	tmpPath := filePath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.savedAt = time.Now()
+	c.mu.Unlock()
+	return nil
+}
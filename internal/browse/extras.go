@@ -0,0 +1,81 @@
+package browse
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ShortExtraDuration is the length under which a video in a movie folder
+// is taken for an extra rather than the film
+const ShortExtraDuration = 5 * time.Minute
+
+// Extra reasons, as reported in Entry.Extra and DiscoveredFile.Extra
+const (
+	ExtraSample  = "sample"
+	ExtraTrailer = "trailer"
+	ExtraFolder  = "extras"
+	ExtraShort   = "short"
+)
+
+// extraFolders are the folder names Plex, Jellyfin and Kodi keep extras in
+var extraFolders = map[string]string{
+	"sample":            ExtraSample,
+	"samples":           ExtraSample,
+	"trailer":           ExtraTrailer,
+	"trailers":          ExtraTrailer,
+	"extras":            ExtraFolder,
+	"featurettes":       ExtraFolder,
+	"behind the scenes": ExtraFolder,
+	"deleted scenes":    ExtraFolder,
+	"interviews":        ExtraFolder,
+	"scenes":            ExtraFolder,
+	"shorts":            ExtraFolder,
+	"other":             ExtraFolder,
+}
+
+// extraSuffixes are Plex's extra file name suffixes, e.g.
+// "Movie (2010)-featurette.mkv"
+var extraSuffixes = []string{
+	"-behindthescenes", "-deleted", "-featurette", "-interview", "-scene", "-short", "-other",
+}
+
+var (
+	nameWordRegex = regexp.MustCompile(`[a-z0-9]+`)
+	episodeRegex  = regexp.MustCompile(`(?i)s\d{1,2}e\d{1,3}|\b\d{1,2}x\d{2,3}\b|\bseason\s*\d+|\bspecials\b`)
+)
+
+// ExtraReason returns why the video at path looks like a sample or extra
+// rather than a film or episode: ExtraSample or ExtraTrailer from its name,
+// ExtraFolder from its folder, or ExtraShort when it's under
+// ShortExtraDuration in a movie folder. duration is 0 when not known yet.
+// It returns "" for anything else.
+func ExtraReason(path string, duration time.Duration) string {
+	base := strings.ToLower(filepath.Base(path))
+	name := strings.TrimSuffix(base, filepath.Ext(base))
+	for _, word := range nameWordRegex.FindAllString(name, -1) {
+		switch word {
+		case "sample":
+			return ExtraSample
+		case "trailer":
+			return ExtraTrailer
+		}
+	}
+	for _, suffix := range extraSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return ExtraFolder
+		}
+	}
+
+	dir := filepath.Base(filepath.Dir(path))
+	if reason, ok := extraFolders[strings.ToLower(dir)]; ok {
+		return reason
+	}
+
+	// Episodes of a short series are the show, not extras
+	if duration > 0 && duration < ShortExtraDuration && !episodeRegex.MatchString(base) && !episodeRegex.MatchString(dir) {
+		return ExtraShort
+	}
+	return ""
+}
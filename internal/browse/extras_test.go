@@ -0,0 +1,31 @@
+package browse
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExtraReason(t *testing.T) {
+	tests := []struct {
+		path     string
+		duration time.Duration
+		want     string
+	}{
+		{"/media/Movies/Heat (1995)/Heat (1995).mkv", 0, ""},
+		{"/media/Movies/Heat (1995)/heat.1995.sample.mkv", 0, ExtraSample},
+		{"/media/Movies/Heat (1995)/Sample/heat.mkv", 0, ExtraSample},
+		{"/media/Movies/Heat (1995)/Heat (1995) - Trailer.mp4", 0, ExtraTrailer},
+		{"/media/Movies/Heat (1995)/Featurettes/Making Of.mkv", 0, ExtraFolder},
+		{"/media/Movies/Heat (1995)/Heat (1995)-behindthescenes.mkv", 0, ExtraFolder},
+		{"/media/Movies/Heat (1995)/Heat (1995).mkv", 3 * time.Minute, ExtraShort},
+		{"/media/Movies/Heat (1995)/Heat (1995).mkv", 2 * time.Hour, ""},
+		{"/media/TV/Short Show/Season 1/Short Show - S01E01.mkv", 3 * time.Minute, ""},
+		{"/media/TV/Short Show/Season 1/episode 1.mkv", 3 * time.Minute, ""},
+		{"/media/Movies/Samplers (2020)/Samplers (2020).mkv", 0, ""},
+	}
+	for _, tt := range tests {
+		if got := ExtraReason(tt.path, tt.duration); got != tt.want {
+			t.Errorf("ExtraReason(%q, %v) = %q, want %q", tt.path, tt.duration, got, tt.want)
+		}
+	}
+}
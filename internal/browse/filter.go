@@ -0,0 +1,36 @@
+package browse
+
+import "github.com/gwlsn/shrinkray/internal/ffmpeg"
+
+// Filter narrows video files by their probe metadata, e.g. "everything
+// that isn't already HEVC" or "only above 1080p". The zero value matches
+// everything.
+type Filter struct {
+	// Codecs keeps only these source video codecs (ffprobe names, e.g. h264)
+	Codecs []string `json:"codecs,omitempty"`
+	// ExcludeCodecs drops these source video codecs (e.g. hevc, av1)
+	ExcludeCodecs []string `json:"exclude_codecs,omitempty"`
+	// MinHeight drops files shorter than this many pixels
+	MinHeight int `json:"min_height,omitempty"`
+	// MinBitrateMbps drops files below this overall bitrate
+	MinBitrateMbps float64 `json:"min_bitrate_mbps,omitempty"`
+}
+
+// IsZero reports whether the filter matches everything
+func (f Filter) IsZero() bool {
+	return len(f.Codecs) == 0 && len(f.ExcludeCodecs) == 0 && f.MinHeight <= 0 && f.MinBitrateMbps <= 0
+}
+
+// Matches reports whether probe passes every criterion of the filter.
+// Files that couldn't be probed only pass the zero filter.
+func (f Filter) Matches(probe *ffmpeg.ProbeResult) bool {
+	if f.IsZero() {
+		return true
+	}
+	return ffmpeg.ProbeCriteria{
+		Codecs:         f.Codecs,
+		ExcludeCodecs:  f.ExcludeCodecs,
+		MinHeight:      f.MinHeight,
+		MinBitrateMbps: f.MinBitrateMbps,
+	}.Matches(probe)
+}
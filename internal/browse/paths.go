@@ -0,0 +1,45 @@
+package browse
+
+import (
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// foldPathCase is set where the filesystem ignores case, so C:\Media and
+// c:\media (or \\NAS\Share and \\nas\share) are the same folder
+var foldPathCase = runtime.GOOS == "windows"
+
+// Within reports whether path is root or inside it. Both are cleaned
+// first; a path that merely shares a prefix with root, like /media2 for
+// /media, is outside it.
+func Within(root, path string) bool {
+	return pathWithin(filepath.Clean(root), filepath.Clean(path), string(filepath.Separator), foldPathCase)
+}
+
+// SamePath reports whether two cleaned paths name the same location
+func SamePath(a, b string) bool {
+	return samePath(filepath.Clean(a), filepath.Clean(b), foldPathCase)
+}
+
+// pathWithin is Within for paths that are already clean, split by sep
+func pathWithin(root, path, sep string, fold bool) bool {
+	if samePath(root, path, fold) {
+		return true
+	}
+	if fold {
+		root, path = strings.ToLower(root), strings.ToLower(path)
+	}
+	// A root like / or C:\ already ends in a separator
+	if !strings.HasSuffix(root, sep) {
+		root += sep
+	}
+	return strings.HasPrefix(path, root)
+}
+
+func samePath(a, b string, fold bool) bool {
+	if fold {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
@@ -0,0 +1,42 @@
+package browse
+
+import "testing"
+
+func TestPathWithin(t *testing.T) {
+	tests := []struct {
+		name       string
+		root, path string
+		sep        string
+		fold       bool
+		want       bool
+	}{
+		{"root itself", "/media", "/media", "/", false, true},
+		{"child", "/media", "/media/TV/show.mkv", "/", false, true},
+		{"sibling sharing a prefix", "/media", "/media2/show.mkv", "/", false, false},
+		{"filesystem root", "/", "/media", "/", false, true},
+		{"case differs on linux", "/media", "/Media/TV", "/", false, false},
+		{"drive letter case", `C:\Media`, `c:\media\TV\show.mkv`, `\`, true, true},
+		{"drive root", `C:\`, `c:\Media`, `\`, true, true},
+		{"other drive", `C:\Media`, `D:\Media\show.mkv`, `\`, true, false},
+		{"windows sibling sharing a prefix", `C:\Media`, `C:\Media2\show.mkv`, `\`, true, false},
+		{"unc share case", `\\nas\share\Media`, `\\NAS\Share\media\show.mkv`, `\`, true, true},
+		{"unc root itself", `\\nas\share\Media`, `\\NAS\SHARE\MEDIA`, `\`, true, true},
+		{"other unc share", `\\nas\share\Media`, `\\nas\other\Media\show.mkv`, `\`, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pathWithin(tt.root, tt.path, tt.sep, tt.fold); got != tt.want {
+				t.Errorf("pathWithin(%q, %q) = %v, want %v", tt.root, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithinCleansPaths(t *testing.T) {
+	if Within("/media", "/media/../etc/passwd") {
+		t.Error("path escaping the root via .. reported as within it")
+	}
+	if !Within("/media/", "/media/TV/./show.mkv") {
+		t.Error("uncleaned child not reported as within the root")
+	}
+}
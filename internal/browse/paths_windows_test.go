@@ -0,0 +1,24 @@
+package browse
+
+import "testing"
+
+func TestWithinWindows(t *testing.T) {
+	tests := []struct {
+		root, path string
+		want       bool
+	}{
+		{`C:\Media`, `c:\media\TV\show.mkv`, true},
+		{`C:\Media`, `C:/Media/TV/show.mkv`, true},
+		{`C:\Media`, `C:\Media2\show.mkv`, false},
+		{`\\nas\share\Media`, `\\NAS\Share\media\show.mkv`, true},
+		{`\\nas\share\Media`, `\\nas\other\Media`, false},
+	}
+	for _, tt := range tests {
+		if got := Within(tt.root, tt.path); got != tt.want {
+			t.Errorf("Within(%q, %q) = %v, want %v", tt.root, tt.path, got, tt.want)
+		}
+	}
+	if !SamePath(`C:\Media\`, `c:\media`) {
+		t.Error("expected drive paths differing in case to match")
+	}
+}
@@ -0,0 +1,287 @@
+package browse
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"github.com/gwlsn/shrinkray/internal/ffmpeg"
+	"github.com/gwlsn/shrinkray/internal/logger"
+)
+
+var searchLog = logger.For("search")
+
+const (
+	// DefaultSearchLimit caps search results when the caller doesn't specify a limit
+	DefaultSearchLimit = 50
+
+	// DefaultIndexInterval is how often the background indexer rescans the media root
+	DefaultIndexInterval = 15 * time.Minute
+)
+
+// indexEntry is a directory or video file in the search index
+type indexEntry struct {
+	path      string
+	name      string
+	terms     string // Normalized name used for matching
+	isDir     bool
+	size      int64
+	modTime   time.Time
+	fileCount int   // Directories: video files underneath
+	totalSize int64 // Directories: total size of video files underneath
+}
+
+// searchIndex is a flat, periodically rebuilt list of the media tree
+type searchIndex struct {
+	mu      sync.RWMutex
+	root    string
+	entries []*indexEntry
+	builtAt time.Time
+
+	buildMu  sync.Mutex    // Serializes rebuilds
+	building atomic.Bool   // A rebuild is running or about to
+	refresh  chan struct{} // Signals the background indexer to rebuild early
+}
+
+// SearchResult contains the result of a media search
+type SearchResult struct {
+	Query     string    `json:"query"`
+	Results   []*Entry  `json:"results"`
+	Total     int       `json:"total"`      // Matches before the limit was applied
+	IndexedAt time.Time `json:"indexed_at"` // When the index was last rebuilt
+	// Indexing is true while the media root is indexed for the first time.
+	// Results are empty until it's done; search again shortly.
+	Indexing bool `json:"indexing,omitempty"`
+}
+
+// normalizeSearchText lower-cases s and turns separators (dots, underscores,
+// dashes, brackets) into spaces so "Breaking.Bad.S01E01" matches "breaking bad".
+func normalizeSearchText(s string) string {
+	var sb strings.Builder
+	space := true
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			sb.WriteRune(r)
+			space = false
+		} else if !space {
+			sb.WriteByte(' ')
+			space = true
+		}
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// matchesAll reports whether every query term appears in terms
+func matchesAll(terms string, query []string) bool {
+	for _, q := range query {
+		if !strings.Contains(terms, q) {
+			return false
+		}
+	}
+	return true
+}
+
+// StartIndexer builds the search index and keeps it fresh in the background,
+// rebuilding every interval and whenever the media root changes.
+func (b *Browser) StartIndexer(ctx context.Context, interval time.Duration) {
+	go func() {
+		b.RebuildIndex()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-b.index.refresh:
+			}
+			b.RebuildIndex()
+		}
+	}()
+}
+
+// requestIndexRefresh asks the background indexer to rebuild without blocking
+func (b *Browser) requestIndexRefresh() {
+	select {
+	case b.index.refresh <- struct{}{}:
+	default:
+	}
+}
+
+// RefreshIndex asks the background indexer to rebuild, e.g. after the set
+// of video extensions changed
+func (b *Browser) RefreshIndex() {
+	b.requestIndexRefresh()
+}
+
+// rebuildIndexInBackground starts RebuildIndex unless a rebuild is already
+// running
+func (b *Browser) rebuildIndexInBackground() {
+	if !b.index.building.CompareAndSwap(false, true) {
+		return
+	}
+	go b.RebuildIndex()
+}
+
+// RebuildIndex walks the media root and replaces the search index
+func (b *Browser) RebuildIndex() {
+	b.index.buildMu.Lock()
+	defer b.index.buildMu.Unlock()
+	b.index.building.Store(true)
+	defer b.index.building.Store(false)
+
+	start := time.Now()
+	root := b.MediaRoot()
+	hideTmp := b.hideProcessingTmp.Load()
+
+	var entries []*indexEntry
+	dirs := make(map[string]*indexEntry)
+	files := make(map[string]probeCacheEntry)
+	walkErr := false
+
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			walkErr = true
+			return nil // Skip unreadable entries
+		}
+		if path == root {
+			return nil
+		}
+		name := d.Name()
+		if strings.HasPrefix(name, ".") || (hideTmp && isTrickplayTmp(name)) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if d.IsDir() {
+			entry := &indexEntry{path: path, name: name, terms: normalizeSearchText(name), isDir: true}
+			if info, err := d.Info(); err == nil {
+				entry.modTime = info.ModTime()
+			}
+			dirs[path] = entry
+			entries = append(entries, entry)
+			return nil
+		}
+		if !ffmpeg.IsVideoFile(name) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			walkErr = true
+			return nil
+		}
+		files[path] = probeCacheEntry{Size: info.Size(), ModTime: info.ModTime().UnixNano()}
+		entries = append(entries, &indexEntry{
+			path:    path,
+			name:    name,
+			terms:   normalizeSearchText(strings.TrimSuffix(name, filepath.Ext(name))),
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		})
+
+		// Roll the file up into every ancestor directory
+		for dir := filepath.Dir(path); dir != root && len(dir) > len(root); dir = filepath.Dir(dir) {
+			if parent, ok := dirs[dir]; ok {
+				parent.fileCount++
+				parent.totalSize += info.Size()
+			}
+		}
+		return nil
+	})
+
+	b.index.mu.Lock()
+	b.index.root = root
+	b.index.entries = entries
+	b.index.builtAt = time.Now()
+	b.index.mu.Unlock()
+
+	// The walk saw every video file, so drop probe results for files that
+	// changed or vanished. Skip after a partial walk (e.g. a flaky mount).
+	if !walkErr {
+		if removed := b.cache.prune(root, files); removed > 0 {
+			cacheLog.Info("Dropped stale probe results", "count", removed)
+		}
+	}
+
+	searchLog.Info("Indexed library", "entries", len(entries), "root", root, "took", time.Since(start).Round(time.Millisecond))
+}
+
+// Search finds directories and video files whose names contain every word
+// of query. Directories are listed first (queue a whole show at once), then
+// files; file results include probe metadata. Until the media root has been
+// indexed, it starts indexing in the background and returns no results,
+// with Indexing set.
+func (b *Browser) Search(ctx context.Context, query string, limit int) (*SearchResult, error) {
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+
+	terms := strings.Fields(normalizeSearchText(query))
+	result := &SearchResult{Query: query, Results: []*Entry{}}
+
+	b.index.mu.RLock()
+	result.Indexing = b.index.builtAt.IsZero() || b.index.root != b.MediaRoot()
+	var matches []*indexEntry
+	if !result.Indexing && len(terms) > 0 {
+		for _, entry := range b.index.entries {
+			if matchesAll(entry.terms, terms) {
+				matches = append(matches, entry)
+			}
+		}
+	}
+	result.IndexedAt = b.index.builtAt
+	b.index.mu.RUnlock()
+
+	if result.Indexing {
+		// First search, or the media root changed
+		b.rebuildIndexInBackground()
+		return result, nil
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].isDir != matches[j].isDir {
+			return matches[i].isDir
+		}
+		return strings.ToLower(matches[i].path) < strings.ToLower(matches[j].path)
+	})
+
+	result.Total = len(matches)
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	var wg sync.WaitGroup
+	for _, m := range matches {
+		entry := &Entry{
+			Name:      m.name,
+			Path:      m.path,
+			IsDir:     m.isDir,
+			Size:      m.size,
+			ModTime:   m.modTime,
+			FileCount: m.fileCount,
+			TotalSize: m.totalSize,
+		}
+		result.Results = append(result.Results, entry)
+
+		if !m.isDir {
+			wg.Add(1)
+			go func(entry *Entry) {
+				defer wg.Done()
+				// Gives up waiting for a probe slot when the request ends
+				entry.VideoInfo = b.getProbeResult(ctx, entry.Path)
+			}(entry)
+		}
+	}
+	wg.Wait()
+
+	return result, nil
+}
@@ -0,0 +1,207 @@
+package browse
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/ffmpeg"
+	"github.com/gwlsn/shrinkray/internal/logger"
+)
+
+var thumbsLog = logger.For("thumbs")
+
+// thumbnailPosition is how far into a video its poster frame is taken
+const thumbnailPosition = 0.10
+
+// maxThumbnailJobs limits concurrent ffmpeg frame extractions so scrolling
+// through a large folder doesn't start one ffmpeg per file
+const maxThumbnailJobs = 2
+
+var (
+	// ErrThumbnailsDisabled is returned when the thumbnail cache is off
+	ErrThumbnailsDisabled = errors.New("thumbnails are disabled")
+
+	// ErrNotVideo is returned for paths that aren't video files in the media root
+	ErrNotVideo = errors.New("not a video file in the media root")
+)
+
+// thumbnailCache stores poster frames on disk as <dir>/<key>.jpg, where the
+// key covers the source's path, size and mtime so replaced files get a new
+// thumbnail. Least recently used files are evicted above maxBytes.
+type thumbnailCache struct {
+	mu         sync.Mutex
+	dir        string
+	maxBytes   int64
+	ffmpegPath string
+	sem        chan struct{}
+}
+
+// EnableThumbnails turns on poster thumbnails, cached in dir up to maxBytes.
+// maxBytes of 0 leaves thumbnails disabled until SetThumbnailCacheSize.
+func (b *Browser) EnableThumbnails(ffmpegPath, dir string, maxBytes int64) {
+	b.thumbs = &thumbnailCache{
+		dir:        dir,
+		maxBytes:   maxBytes,
+		ffmpegPath: ffmpegPath,
+		sem:        make(chan struct{}, maxThumbnailJobs),
+	}
+}
+
+// SetThumbnailCacheSize changes the cache limit, evicting thumbnails as
+// needed. 0 disables thumbnails and empties the cache.
+func (b *Browser) SetThumbnailCacheSize(maxBytes int64) {
+	if b.thumbs == nil {
+		return
+	}
+	b.thumbs.mu.Lock()
+	defer b.thumbs.mu.Unlock()
+	b.thumbs.maxBytes = maxBytes
+	b.thumbs.evict()
+}
+
+// Thumbnail returns the path of a cached JPEG poster frame for the video at
+// path, generating it from the frame at 10% of the duration if needed.
+func (b *Browser) Thumbnail(ctx context.Context, path string) (string, error) {
+	c := b.thumbs
+	if c == nil {
+		return "", ErrThumbnailsDisabled
+	}
+	c.mu.Lock()
+	enabled := c.maxBytes > 0
+	c.mu.Unlock()
+	if !enabled {
+		return "", ErrThumbnailsDisabled
+	}
+
+	cleanPath, err := filepath.Abs(path)
+	if err != nil {
+		cleanPath = filepath.Clean(path)
+	}
+	if !Within(b.MediaRoot(), cleanPath) || !ffmpeg.IsVideoFile(cleanPath) {
+		return "", ErrNotVideo
+	}
+	info, err := os.Stat(cleanPath)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", ErrNotVideo
+	}
+
+	thumbPath := filepath.Join(c.dir, thumbnailKey(cleanPath, info)+".jpg")
+	if c.touch(thumbPath) {
+		return thumbPath, nil
+	}
+
+	select {
+	case c.sem <- struct{}{}:
+		defer func() { <-c.sem }()
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	// Another request may have generated it while this one waited
+	if c.touch(thumbPath) {
+		return thumbPath, nil
+	}
+
+	var at time.Duration
+	if probe := b.getProbeResult(ctx, cleanPath); probe != nil {
+		at = time.Duration(float64(probe.Duration) * thumbnailPosition)
+	}
+	frame, err := ffmpeg.ExtractFrame(ctx, c.ffmpegPath, cleanPath, at, ffmpeg.PreviewWidth)
+	if err != nil {
+		return "", err
+	}
+	if err := c.store(thumbPath, frame); err != nil {
+		return "", fmt.Errorf("failed to cache thumbnail: %w", err)
+	}
+	return thumbPath, nil
+}
+
+func thumbnailKey(path string, info os.FileInfo) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s|%d|%d", path, info.Size(), info.ModTime().UnixNano())))
+	return hex.EncodeToString(sum[:])
+}
+
+// touch reports whether thumbPath is cached, marking it recently used
+func (c *thumbnailCache) touch(thumbPath string) bool {
+	if _, err := os.Stat(thumbPath); err != nil {
+		return false
+	}
+	now := time.Now()
+	_ = os.Chtimes(thumbPath, now, now)
+	return true
+}
+
+// store writes a thumbnail atomically and evicts old ones over the limit
+func (c *thumbnailCache) store(thumbPath string, frame []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return err
+	}
+	tmpPath := thumbPath + ".tmp"
+	if err := os.WriteFile(tmpPath, frame, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, thumbPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	c.evict()
+	return nil
+}
+
+// evict removes least recently used thumbnails until the cache fits in
+// maxBytes. Must hold c.mu.
+func (c *thumbnailCache) evict() {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return
+	}
+
+	type thumb struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var thumbs []thumb
+	var total int64
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".jpg" {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		thumbs = append(thumbs, thumb{filepath.Join(c.dir, entry.Name()), info.Size(), info.ModTime()})
+		total += info.Size()
+	}
+	if total <= c.maxBytes {
+		return
+	}
+
+	sort.Slice(thumbs, func(i, j int) bool {
+		return thumbs[i].modTime.Before(thumbs[j].modTime)
+	})
+	for _, t := range thumbs {
+		if total <= c.maxBytes {
+			break
+		}
+		if err := os.Remove(t.path); err != nil {
+			thumbsLog.Warn("Failed to evict thumbnail", "path", t.path, "error", err)
+			continue
+		}
+		total -= t.size
+	}
+}
@@ -2,13 +2,19 @@ package config
 
 import (
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 
 	"gopkg.in/yaml.v3"
+
+	"github.com/gwlsn/shrinkray/internal/logger"
 )
 
+var configLog = logger.For("config")
+
 // FeatureFlags controls experimental features for phased rollout
 type FeatureFlags struct {
 	// VirtualScroll enables virtual scrolling in the UI (render only visible jobs)
@@ -38,7 +44,7 @@ func DefaultFeatureFlags() FeatureFlags {
 	return FeatureFlags{
 		VirtualScroll:   true,  // Render only visible items for large queues
 		DeferredProbing: true,  // Add jobs instantly, probe when worker picks up
-		PaginatedInit:   false, // Not implemented yet
+		PaginatedInit:   false, // Send the first page on connect, load the rest in the background
 		BatchedSSE:      true,  // Batch add events to reduce SSE flood
 		DeltaProgress:   true,  // Small progress payloads
 	}
@@ -60,15 +66,84 @@ type Config struct {
 	// Options: "convert" (convert mov_text to SRT) or "drop" (drop unsupported subtitles).
 	SubtitleHandling string `yaml:"subtitle_handling"`
 
+	// HDRHandling controls what happens to HDR (PQ/HLG/Dolby Vision) sources.
+	// Options: "preserve" (keep HDR10 metadata), "tonemap" (convert to SDR) or "skip".
+	HDRHandling string `yaml:"hdr_handling"`
+
+	// HardlinkHandling controls sources with other hard links, such as a
+	// torrent client's seeding copy, which replacing would quietly split
+	// from the library file. Options: "break" (default; replace only this
+	// path, the other links keep the original), "skip", or "relink" (point
+	// the other links found under HardlinkSearchPaths at the new file).
+	HardlinkHandling string `yaml:"hardlink_handling"`
+
+	// HardlinkHandlingPaths overrides HardlinkHandling per folder; the
+	// longest matching folder wins, e.g. {"/media/tv": "skip"}
+	HardlinkHandlingPaths map[string]string `yaml:"hardlink_handling_paths"`
+
+	// HardlinkSearchPaths are the folders searched for a source's other
+	// links with hardlink_handling: relink (default: the media path)
+	HardlinkSearchPaths []string `yaml:"hardlink_search_paths"`
+
+	// VerifyOutput decodes each finished transcode and checks its streams and
+	// duration against the source before the original is replaced. Outputs
+	// that fail are discarded and the job is marked verify_failed.
+	VerifyOutput bool `yaml:"verify_output"`
+
+	// OutputContainer is the container transcodes are written in: "mkv"
+	// (default) or "mp4". MP4 output keeps only text subtitles.
+	OutputContainer string `yaml:"output_container"`
+
+	// PresetContainers overrides OutputContainer per preset ID,
+	// e.g. {"compress-hevc": "mp4"}
+	PresetContainers map[string]string `yaml:"preset_containers"`
+
+	// PresetEncoders pins presets to an encoder instead of the best detected
+	// one, e.g. {"compress-hevc": "qsv", "compress-av1": "none"}. Encoders:
+	// none, videotoolbox, nvenc, qsv, vaapi.
+	PresetEncoders map[string]string `yaml:"preset_encoders"`
+
+	// PresetDeinterlace overrides deinterlacing per preset ID: "auto"
+	// (default; sources probed as interlaced), "on" or "off",
+	// e.g. {"720p": "on"}
+	PresetDeinterlace map[string]string `yaml:"preset_deinterlace"`
+
+	// PresetThreads caps the CPU threads software encodes use per preset ID,
+	// so parallel workers split the cores, e.g. {"compress-hevc": 8}. Jobs
+	// can override it; hardware encodes ignore it.
+	PresetThreads map[string]int `yaml:"preset_threads"`
+
+	// PresetMaxEncodeHours overrides MaxEncodeHours per preset ID, e.g.
+	// {"compress-av1": 12}; 0 removes the limit for that preset
+	PresetMaxEncodeHours map[string]int `yaml:"preset_max_encode_hours"`
+
+	// PresetAutoQuality overrides AutoQuality per preset ID, e.g. searching
+	// for the CRF only for compress-av1.
+	PresetAutoQuality map[string]bool `yaml:"preset_auto_quality"`
+
+	// KeepSourceContainer writes MKV and MP4/M4V sources back in their own
+	// container (and extension) whatever the preset would use
+	KeepSourceContainer bool `yaml:"keep_source_container"`
+
 	// Workers is the number of concurrent transcode jobs (default 1)
 	Workers int `yaml:"workers"`
 
+	// WorkerDevices pins workers to a GPU by worker ID, e.g.
+	// ["/dev/dri/renderD128", "/dev/dri/renderD129"] or ["cuda:0", "cuda:1"].
+	// Workers without an entry (or with "") spread hardware jobs across the
+	// detected GPUs round-robin.
+	WorkerDevices []string `yaml:"worker_devices"`
+
 	// FFmpegPath is the path to ffmpeg binary (default: "ffmpeg")
 	FFmpegPath string `yaml:"ffmpeg_path"`
 
 	// FFprobePath is the path to ffprobe binary (default: "ffprobe")
 	FFprobePath string `yaml:"ffprobe_path"`
 
+	// ProbeConcurrency is how many files are probed at once, across
+	// browsing, queueing and workers (default 8)
+	ProbeConcurrency int `yaml:"probe_concurrency"`
+
 	// QueueFile is where the job queue is persisted (default: config dir + queue.json)
 	QueueFile string `yaml:"queue_file"`
 
@@ -90,9 +165,22 @@ type Config struct {
 	// NotifyOnComplete triggers a notification when all jobs finish
 	NotifyOnComplete bool `yaml:"notify_on_complete"`
 
+	// NotifyOnBatchComplete sends a notification each time a batch (the
+	// jobs queued from one folder) finishes
+	NotifyOnBatchComplete bool `yaml:"notify_on_batch_complete"`
+
+	// NotifyFailureThreshold sends an alert after this many jobs fail in a
+	// row (0 = off)
+	NotifyFailureThreshold int `yaml:"notify_failure_threshold"`
+
 	// HideProcessingTmp controls hiding shrinkray.tmp files from the UI
 	HideProcessingTmp bool `yaml:"hide_processing_tmp"`
 
+	// FingerprintProcessed records a content fingerprint (size plus a hash
+	// of the first and last MiB) of each processed file, so files renamed or
+	// moved by Sonarr/Radarr are still recognized as already processed.
+	FingerprintProcessed bool `yaml:"fingerprint_processed"`
+
 	// AllowSoftwareFallback controls whether GPU encode failures trigger automatic CPU retry.
 	// Default: false (GPU failures fail the job with a clear message).
 	// When enabled, Shrinkray will retry failed GPU encodes using CPU, which is slower but may succeed.
@@ -106,6 +194,41 @@ type Config struct {
 	// 0 = use encoder-specific default
 	QualityAV1 int `yaml:"quality_av1"`
 
+	// SVTAV1Preset is the libsvtav1 speed preset for software AV1, 0 (slowest,
+	// smallest) to 13 (fastest) (default 6)
+	SVTAV1Preset int `yaml:"svt_av1_preset"`
+
+	// SVTAV1FilmGrain is libsvtav1's film grain synthesis level, 0-50
+	// (0 = off). 8-15 suits most grainy film.
+	SVTAV1FilmGrain int `yaml:"svt_av1_film_grain"`
+
+	// SVTAV1Tune is libsvtav1's tune: 0 = visual quality, 1 = PSNR, 2 = SSIM (default 1)
+	SVTAV1Tune int `yaml:"svt_av1_tune"`
+
+	// AudioCodec is what the audio-only preset re-encodes lossless audio
+	// to: eac3 (default, plays almost everywhere) or opus (smaller)
+	AudioCodec string `yaml:"audio_codec"`
+
+	// ReencodeAboveBPP queues HEVC/AV1 sources for HEVC/AV1 presets instead
+	// of skipping them when their video is above this many bits per pixel
+	// per frame (e.g. 0.2 catches bloated remuxes); 0 always skips them
+	ReencodeAboveBPP float64 `yaml:"reencode_above_bpp"`
+
+	// AutoQuality picks the CRF per file by encoding a few short samples and
+	// measuring SSIM before the full encode. Ignored for bitrate-based encoders.
+	AutoQuality bool `yaml:"auto_quality"`
+
+	// AutoQualityTargetSSIM is the minimum SSIM (0-1) auto quality aims for (default 0.98)
+	AutoQualityTargetSSIM float64 `yaml:"auto_quality_target_ssim"`
+
+	// AutoQualityTargetSavings, if > 0, makes auto quality pick the best quality
+	// that saves at least this percentage instead of using the SSIM target
+	AutoQualityTargetSavings int `yaml:"auto_quality_target_savings"`
+
+	// AutoCrop samples each file with cropdetect and crops letterbox or
+	// pillarbox black bars before encoding
+	AutoCrop bool `yaml:"auto_crop"`
+
 	// ScheduleEnabled enables time-based scheduling for transcoding
 	ScheduleEnabled bool `yaml:"schedule_enabled"`
 
@@ -119,9 +242,110 @@ type Config struct {
 	// Useful for users who want codec consistency across their library
 	KeepLargerFiles bool `yaml:"keep_larger_files"`
 
+	// MinSavingsPercent discards outputs that aren't at least this much
+	// smaller than the original (0-90, default 0 = any saving is kept) as
+	// no_gain. Ignored with keep_larger_files.
+	MinSavingsPercent int `yaml:"min_savings_percent"`
+
+	// PreserveOwnership gives the transcoded file the original's owner, group
+	// and permissions (changing owner needs root or a matching user)
+	PreserveOwnership bool `yaml:"preserve_ownership"`
+
+	// PreserveMTime gives the transcoded file the original's modification time
+	PreserveMTime bool `yaml:"preserve_mtime"`
+
+	// MinFreeSpaceMB is the minimum free space (in MB) required on both the temp
+	// and destination filesystems before a job is started. Jobs wait in the
+	// "waiting_disk" state until space is available. 0 disables the check.
+	MinFreeSpaceMB int64 `yaml:"min_free_space_mb"`
+
+	// ReserveTempSpace holds jobs in "waiting_disk" while the outputs still
+	// to be written by running jobs, plus theirs (estimated from the source),
+	// wouldn't fit in the temp filesystem's free space
+	ReserveTempSpace bool `yaml:"reserve_temp_space"`
+
+	// ScanIntervalHours runs a full library scan (see /api/scan) every N hours.
+	// 0 disables scheduled scans; scans can still be started on demand.
+	ScanIntervalHours int `yaml:"scan_interval_hours"`
+
+	// OriginalRetentionDays deletes .old originals kept by original_handling
+	// "keep" after N days. 0 keeps them until verified or deleted via
+	// /api/originals.
+	OriginalRetentionDays int `yaml:"original_retention_days"`
+
+	// TrashOriginals moves originals replaced by original_handling "replace"
+	// into <media_path>/.shrinkray-trash instead of deleting them, so a
+	// transcode can be undone via /api/jobs/{id}/restore.
+	TrashOriginals bool `yaml:"trash_originals"`
+
+	// TrashRetentionDays purges trashed originals after N days.
+	// 0 keeps them until restored.
+	TrashRetentionDays int `yaml:"trash_retention_days"`
+
+	// ShutdownGraceSeconds is how long shutdown waits for running jobs to
+	// finish. Jobs still running after that are stopped and requeued.
+	// 0 requeues them immediately.
+	ShutdownGraceSeconds int `yaml:"shutdown_grace_seconds"`
+
+	// StallTimeoutMinutes kills ffmpeg when a running (unpaused) encode's
+	// progress hasn't advanced for this long, e.g. a deadlocked hardware
+	// session. 0 disables the watchdog.
+	StallTimeoutMinutes int `yaml:"stall_timeout_minutes"`
+
+	// StallRetries is how many times a stalled job is put back in the queue
+	// before it is marked failed
+	StallRetries int `yaml:"stall_retries"`
+
+	// MaxEncodeHours aborts an encode that has run (unpaused) for longer,
+	// so one pathological file can't tie up a worker for days. 0 = no limit.
+	MaxEncodeHours int `yaml:"max_encode_hours"`
+
+	// ChunkedSegments splits videos at least ChunkedMinMinutes long into
+	// this many keyframe-aligned segments that are encoded in parallel and
+	// joined (2-16). 0 encodes every file in one go.
+	ChunkedSegments int `yaml:"chunked_segments"`
+
+	// ChunkedMinMinutes is the shortest video ChunkedSegments applies to
+	// (default 30)
+	ChunkedMinMinutes int `yaml:"chunked_min_minutes"`
+
+	// PreviewIntervalSeconds is how often GET /api/jobs/{id}/preview may
+	// extract a new frame from a running encode. 0 disables previews.
+	PreviewIntervalSeconds int `yaml:"preview_interval_seconds"`
+
+	// ThumbnailCacheMB caps the on-disk cache of file browser poster
+	// thumbnails. 0 disables thumbnails.
+	ThumbnailCacheMB int `yaml:"thumbnail_cache_mb"`
+
+	// ExtraVideoExtensions are file extensions treated as video on top of
+	// the built-in list, e.g. [.m2v, .vob, .3gp]. Still image and camera raw
+	// formats are ignored; a folder of them is an image sequence.
+	ExtraVideoExtensions []string `yaml:"extra_video_extensions"`
+
+	// ExcludedVideoExtensions are built-in video extensions to leave alone,
+	// e.g. [.ts] where .ts files are recordings that shouldn't be touched
+	ExcludedVideoExtensions []string `yaml:"excluded_video_extensions"`
+
 	// LogLevel controls logging verbosity: debug, info, warn, error (default: info)
 	LogLevel string `yaml:"log_level"`
 
+	// LogFormat is "text" (default) or "json", one object per line for
+	// container log collectors
+	LogFormat string `yaml:"log_format"`
+
+	// LogLevels overrides LogLevel per module (the module= tag in log lines),
+	// e.g. {queue: debug, browse: warn}
+	LogLevels map[string]string `yaml:"log_levels"`
+
+	// LogBufferLines is how many recent log lines are kept in memory for
+	// GET /api/logs (default: 5000)
+	LogBufferLines int `yaml:"log_buffer_lines"`
+
+	// ProgressEventsPerSecond caps job progress events: updates from all
+	// running jobs are combined into at most this many "progress_batch"
+	// events a second (default: 2). 0 sends every update as it happens.
+	ProgressEventsPerSecond int `yaml:"progress_events_per_second"`
+
 	// LayoutDesign controls the UI layout design.
 	// Options: "split" (default) or "tabs".
 	LayoutDesign string `yaml:"layout_design"`
@@ -129,8 +353,240 @@ type Config struct {
 	// Features contains feature flags for phased rollout of new functionality
 	Features FeatureFlags `yaml:"features"`
 
+	// Rules are saved queue filters run via POST /api/rules/{id}/run
+	Rules []Rule `yaml:"rules"`
+
 	// Auth contains authentication configuration.
 	Auth AuthConfig `yaml:"auth"`
+
+	// Integrations configures apps notified after a transcode completes.
+	Integrations IntegrationsConfig `yaml:"integrations"`
+
+	// Remote lets agents on other machines pull and transcode jobs.
+	Remote RemoteConfig `yaml:"remote"`
+
+	// TLS serves HTTPS directly, without a reverse proxy in front.
+	TLS TLSConfig `yaml:"tls"`
+
+	// Access limits which client addresses can use the UI and API, for LAN-only
+	// control without setting up auth.
+	Access AccessConfig `yaml:"access"`
+
+	// BasePath serves the UI and API under a subpath (e.g. "/shrinkray")
+	// for reverse proxies that pass it through. Applied at startup.
+	BasePath string `yaml:"base_path"`
+
+	// Autoscale grows and shrinks the worker pool with system load.
+	Autoscale AutoscaleConfig `yaml:"autoscale"`
+
+	// FFmpegLimits lowers the priority of, and caps the resources used by,
+	// local transcodes.
+	FFmpegLimits FFmpegLimitsConfig `yaml:"ffmpeg_limits"`
+
+	// MountWatch pauses the queue while a media root (e.g. an NFS or SMB
+	// mount) is unreachable.
+	MountWatch MountWatchConfig `yaml:"mount_watch"`
+
+	// Energy estimates the power and cost of each transcode.
+	Energy EnergyConfig `yaml:"energy"`
+
+	// secrets records credentials resolved from the environment or secret
+	// files (see resolveSecrets)
+	secrets map[string]secretRef
+}
+
+// AutoscaleConfig adjusts the number of workers between MinWorkers and
+// MaxWorkers: one fewer while CPU, GPU or memory use is above its high mark,
+// one more while CPU and GPU are below their low marks and jobs are waiting.
+type AutoscaleConfig struct {
+	// Enabled turns the autoscaler on; workers is then only the starting count.
+	Enabled bool `yaml:"enabled" json:"enabled"`
+
+	MinWorkers int `yaml:"min_workers" json:"min_workers"`
+	MaxWorkers int `yaml:"max_workers" json:"max_workers"`
+
+	// IntervalSeconds is how often load is sampled; the pool changes by at
+	// most one worker per sample.
+	IntervalSeconds int `yaml:"interval_seconds" json:"interval_seconds"`
+
+	// Whole-system utilization thresholds, in percent
+	CPUHighPercent    float64 `yaml:"cpu_high_percent" json:"cpu_high_percent"`
+	CPULowPercent     float64 `yaml:"cpu_low_percent" json:"cpu_low_percent"`
+	GPUHighPercent    float64 `yaml:"gpu_high_percent" json:"gpu_high_percent"`
+	GPULowPercent     float64 `yaml:"gpu_low_percent" json:"gpu_low_percent"`
+	MemoryHighPercent float64 `yaml:"memory_high_percent" json:"memory_high_percent"`
+}
+
+// cpuListPattern matches a CPU list such as "0-3,6", or nothing
+var cpuListPattern = regexp.MustCompile(`^(\d+(-\d+)?(,\d+(-\d+)?)*)?$`)
+
+// MountWatchConfig checks the media roots every IntervalSeconds. A root
+// that can't be listed within TimeoutSeconds, or a mount point that has
+// been unmounted, holds the queue and pauses running jobs until it is back.
+type MountWatchConfig struct {
+	Enabled bool `yaml:"enabled" json:"enabled"`
+
+	// Paths are the roots to check; empty checks media_path
+	Paths []string `yaml:"paths" json:"paths"`
+
+	IntervalSeconds int `yaml:"interval_seconds" json:"interval_seconds"`
+	TimeoutSeconds  int `yaml:"timeout_seconds" json:"timeout_seconds"`
+}
+
+// EnergyConfig estimates each local transcode's energy use from Watts, the
+// extra power an encoder draws while encoding, or with Measure from the
+// machine's RAPL and nvidia-smi energy counters where it has them.
+type EnergyConfig struct {
+	Enabled bool `yaml:"enabled" json:"enabled"`
+
+	// Watts by encoder: none (software), vaapi, qsv, nvenc, videotoolbox
+	Watts map[string]float64 `yaml:"watts" json:"watts"`
+
+	Measure bool `yaml:"measure" json:"measure"`
+
+	// CostPerKWh is the electricity price, in Currency (e.g. EUR)
+	CostPerKWh float64 `yaml:"cost_per_kwh" json:"cost_per_kwh"`
+	Currency   string  `yaml:"currency" json:"currency"`
+}
+
+// FFmpegLimitsConfig restricts the ffmpeg processes local workers run, so
+// software encodes don't starve the host's other services. Nice, ionice and
+// CPU affinity use the nice, ionice and taskset tools.
+type FFmpegLimitsConfig struct {
+	// Nice is the CPU niceness, 1-19 (0 = unchanged).
+	Nice int `yaml:"nice" json:"nice"`
+
+	// IOClass is the ionice class: "best-effort" or "idle" ("" = unchanged).
+	IOClass string `yaml:"ionice_class" json:"ionice_class"`
+
+	// IOLevel is the best-effort priority, 0 (highest) to 7.
+	IOLevel int `yaml:"ionice_level" json:"ionice_level"`
+
+	// CPUAffinity lists the CPUs ffmpeg may use, e.g. "0-3,6" ("" = all).
+	CPUAffinity string `yaml:"cpu_affinity" json:"cpu_affinity"`
+
+	// MemoryLimitMB caps each ffmpeg process's memory (0 = no limit). It
+	// needs CgroupDir: a writable cgroup v2 directory with the memory
+	// controller enabled for its children, where a cgroup per process is made.
+	MemoryLimitMB int    `yaml:"memory_limit_mb" json:"memory_limit_mb"`
+	CgroupDir     string `yaml:"cgroup_dir" json:"cgroup_dir"`
+}
+
+// TLSConfig configures built-in HTTPS. Set either CertFile and KeyFile, or
+// ACMEDomains to get certificates from Let's Encrypt.
+type TLSConfig struct {
+	// CertFile and KeyFile are a PEM certificate (chain) and key. They are
+	// re-read when changed, so renewals don't need a restart.
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// ACMEDomains are the hostnames to get certificates for.
+	ACMEDomains []string `yaml:"acme_domains"`
+	// ACMEEmail is the contact address given to Let's Encrypt (optional).
+	ACMEEmail string `yaml:"acme_email"`
+	// ACMECacheDir stores ACME account keys and certificates (default:
+	// "acme" next to the queue file).
+	ACMECacheDir string `yaml:"acme_cache_dir"`
+	// RedirectAddr, e.g. ":80", serves plain HTTP that redirects to HTTPS
+	// and answers ACME HTTP challenges. Empty = no HTTP listener.
+	RedirectAddr string `yaml:"redirect_addr"`
+}
+
+// AccessConfig restricts access by client address.
+type AccessConfig struct {
+	// AllowedNetworks are the CIDRs or addresses that may use Shrinkray;
+	// "local" covers loopback, private and link-local addresses. Empty
+	// allows everyone.
+	AllowedNetworks []string `yaml:"allowed_networks"`
+	// MutatingOnly lets anyone view, and only allowed networks change
+	// anything (requests other than GET and HEAD).
+	MutatingOnly bool `yaml:"mutating_only"`
+	// TrustedProxies are reverse proxies whose X-Forwarded-For is believed
+	// when working out the client address.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	// AllowedOrigins are the browser origins (e.g. "https://media.example.com")
+	// allowed to open the job WebSocket besides Shrinkray's own host, for
+	// proxies that rewrite the Host header.
+	AllowedOrigins []string `yaml:"allowed_origins"`
+}
+
+// Enabled reports whether HTTPS is configured
+func (t TLSConfig) Enabled() bool {
+	return len(t.ACMEDomains) > 0 || (t.CertFile != "" && t.KeyFile != "")
+}
+
+// RemoteConfig configures the remote worker (agent) API.
+type RemoteConfig struct {
+	// Token is the shared secret agents send as a bearer token.
+	// Empty disables the remote API.
+	Token string `yaml:"token"`
+}
+
+// IntegrationsConfig configures apps refreshed after transcodes.
+type IntegrationsConfig struct {
+	// Sonarr is rescanned when a TV episode is replaced.
+	Sonarr ArrConfig `yaml:"sonarr" json:"sonarr"`
+	// Radarr is rescanned when a movie is replaced.
+	Radarr ArrConfig `yaml:"radarr" json:"radarr"`
+	// Plex servers get a partial scan of the replaced file's folder.
+	Plex []MediaServerConfig `yaml:"plex" json:"plex,omitempty"`
+	// Jellyfin servers are told about the replaced file.
+	Jellyfin []MediaServerConfig `yaml:"jellyfin" json:"jellyfin,omitempty"`
+}
+
+// MediaServerConfig configures one Plex or Jellyfin server.
+type MediaServerConfig struct {
+	// Name labels the server in logs and the test endpoint (default: its URL).
+	Name string `yaml:"name" json:"name,omitempty"`
+	// URL is the base URL, e.g. http://plex:32400.
+	URL string `yaml:"url" json:"url"`
+	// Token is the X-Plex-Token or Jellyfin API key.
+	Token string `yaml:"token" json:"token"`
+	// Root limits the server to files under this Shrinkray path (empty = all).
+	Root string `yaml:"root" json:"root,omitempty"`
+	// RemoteRoot is Root as the server sees it, when mounted elsewhere.
+	RemoteRoot string `yaml:"remote_root" json:"remote_root,omitempty"`
+}
+
+// ArrConfig configures one Sonarr or Radarr instance.
+type ArrConfig struct {
+	// URL is the base URL, e.g. http://sonarr:8989 (empty disables).
+	URL string `yaml:"url" json:"url"`
+	// APIKey is found under Settings > General in the *arr UI.
+	APIKey string `yaml:"api_key" json:"api_key"`
+	// Rename also triggers a rename so file names reflect the new codec.
+	Rename bool `yaml:"rename" json:"rename"`
+	// LocalPath and RemotePath map Shrinkray's media path to the *arr's
+	// when the two containers mount the library at different paths.
+	LocalPath  string `yaml:"local_path" json:"local_path,omitempty"`
+	RemotePath string `yaml:"remote_path" json:"remote_path,omitempty"`
+}
+
+// Rule selects video files under a path by probe criteria and queues the
+// matches with a preset, e.g. "everything over 15 Mbps in TV -> 1080p".
+// Zero-valued criteria are ignored.
+type Rule struct {
+	// ID identifies the rule in the API (required, unique)
+	ID string `yaml:"id" json:"id"`
+	// Name is a human-readable label
+	Name string `yaml:"name" json:"name,omitempty"`
+	// Path is the directory to search; relative paths are under media_path
+	Path string `yaml:"path" json:"path"`
+	// Preset is the preset ID matches are queued with
+	Preset string `yaml:"preset" json:"preset"`
+	// NoRecurse limits the search to Path itself (subfolders are included by default)
+	NoRecurse bool `yaml:"no_recurse" json:"no_recurse,omitempty"`
+	// MinBitrateMbps / MaxBitrateMbps bound the overall bitrate
+	MinBitrateMbps float64 `yaml:"min_bitrate_mbps" json:"min_bitrate_mbps,omitempty"`
+	MaxBitrateMbps float64 `yaml:"max_bitrate_mbps" json:"max_bitrate_mbps,omitempty"`
+	// MinHeight / MaxHeight bound the video height in pixels
+	MinHeight int `yaml:"min_height" json:"min_height,omitempty"`
+	MaxHeight int `yaml:"max_height" json:"max_height,omitempty"`
+	// MinSizeMB skips files smaller than this
+	MinSizeMB int64 `yaml:"min_size_mb" json:"min_size_mb,omitempty"`
+	// Codecs limits matches to these source video codecs (ffprobe names, e.g. h264)
+	Codecs []string `yaml:"codecs" json:"codecs,omitempty"`
+	// IncludeProcessed also matches files Shrinkray has already transcoded
+	IncludeProcessed bool `yaml:"include_processed" json:"include_processed,omitempty"`
 }
 
 // AuthConfig configures authentication providers.
@@ -143,10 +599,38 @@ type AuthConfig struct {
 	Secret string `yaml:"secret"`
 	// BypassPaths lists endpoints that bypass auth enforcement.
 	BypassPaths []string `yaml:"bypass_paths"`
+	// SessionStore is "" for stateless signed session cookies, or "file" to
+	// also keep sessions in sessions.json next to the queue file so they can
+	// be listed and revoked.
+	SessionStore string `yaml:"session_store"`
+	// JobVisibility is "all" (default: every user sees every job) or "own"
+	// (users who aren't admins only see and manage jobs they created).
+	JobVisibility string `yaml:"job_visibility"`
+	// AdminUsers lists the user IDs or emails that see every job when
+	// job_visibility is "own".
+	AdminUsers []string `yaml:"admin_users"`
 	// Password configures password-based auth.
 	Password PasswordAuthConfig `yaml:"password"`
 	// OIDC configures OpenID Connect auth.
 	OIDC OIDCAuthConfig `yaml:"oidc"`
+	// Header configures trusted-header auth behind a forward-auth proxy.
+	Header HeaderAuthConfig `yaml:"header"`
+	// Branding customizes the login and auth error pages.
+	Branding AuthBrandingConfig `yaml:"branding"`
+}
+
+// AuthBrandingConfig customizes the login and auth error pages.
+type AuthBrandingConfig struct {
+	// Title replaces "Shrinkray" on the login page.
+	Title string `yaml:"title"`
+	// LogoURL is the image shown next to the title (default /logo.png).
+	LogoURL string `yaml:"logo_url"`
+	// AccentColor is a hex color (#RGB or #RRGGBB) for buttons and links.
+	AccentColor string `yaml:"accent_color"`
+	// Theme is "auto" (follow the UI/system), "light" or "dark".
+	Theme string `yaml:"theme"`
+	// Locale forces the page language (en, de, fr, es); empty uses the browser's.
+	Locale string `yaml:"locale"`
 }
 
 // PasswordAuthConfig configures password auth.
@@ -155,6 +639,34 @@ type PasswordAuthConfig struct {
 	Users map[string]string `yaml:"users"`
 	// HashAlgo specifies the expected password hash algorithm.
 	HashAlgo string `yaml:"hash_algo"`
+	// MaxAttempts is how many failed logins an IP or username gets before
+	// it is locked out (default 5).
+	MaxAttempts int `yaml:"max_attempts"`
+	// LockoutSeconds is the first lockout; it doubles with each further
+	// failure, up to an hour (default 30).
+	LockoutSeconds int `yaml:"lockout_seconds"`
+	// TrustForwardedFor counts attempts against the X-Forwarded-For client
+	// IP. Enable only behind a reverse proxy that sets it.
+	TrustForwardedFor bool `yaml:"trust_forwarded_for"`
+	// TrustedProxies are the CIDRs or addresses of the reverse proxies
+	// whose X-Forwarded-For entries are believed. Empty trusts only the
+	// proxy the request came from directly.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	// Captcha adds a CAPTCHA to the login form after failed logins.
+	Captcha CaptchaConfig `yaml:"captcha"`
+}
+
+// CaptchaConfig configures the login CAPTCHA.
+type CaptchaConfig struct {
+	// Service is "hcaptcha" or "turnstile"; empty disables the CAPTCHA.
+	Service string `yaml:"service"`
+	// SiteKey is the widget's public site key.
+	SiteKey string `yaml:"site_key"`
+	// Secret is the key used to verify responses.
+	Secret string `yaml:"secret"`
+	// AfterFailures is how many recent failed logins an IP needs before it
+	// must solve the CAPTCHA (0 = always).
+	AfterFailures int `yaml:"after_failures"`
 }
 
 // OIDCAuthConfig configures OpenID Connect auth.
@@ -175,34 +687,88 @@ type OIDCAuthConfig struct {
 	AllowedGroups []string `yaml:"allowed_groups"`
 }
 
+// HeaderAuthConfig configures trusted-header auth.
+type HeaderAuthConfig struct {
+	// TrustedProxies are the CIDRs or addresses of the reverse proxy; user
+	// headers from anywhere else are ignored.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	// UserHeader carries the username (default Remote-User).
+	UserHeader string `yaml:"user_header"`
+	// GroupsHeader carries comma-separated groups (default Remote-Groups).
+	GroupsHeader string `yaml:"groups_header"`
+	// AllowedGroups restricts access to users in one of these groups.
+	AllowedGroups []string `yaml:"allowed_groups"`
+	// LogoutURL is where /auth/logout sends the browser (the proxy's logout).
+	LogoutURL string `yaml:"logout_url"`
+}
+
 // DefaultConfig returns a config with sensible defaults
 func DefaultConfig() *Config {
 	return &Config{
-		MediaPath:         "/media",
-		TempPath:          "",
-		OriginalHandling:  "replace",
-		SubtitleHandling:  "convert",
-		Workers:           1,
-		FFmpegPath:        "ffmpeg",
-		FFprobePath:       "ffprobe",
-		QueueFile:         "",
-		NtfyServer:        "https://ntfy.sh",
-		QualityHEVC:       0,
-		QualityAV1:        0,
-		ScheduleEnabled:   false,
-		ScheduleStartHour: 22,
-		ScheduleEndHour:   6,
-		KeepLargerFiles:   false,
-		LogLevel:          "info",
-		LayoutDesign:      "split",
-		Features:          DefaultFeatureFlags(),
+		MediaPath:               "/media",
+		TempPath:                "",
+		OriginalHandling:        "replace",
+		SubtitleHandling:        "convert",
+		HDRHandling:             "preserve",
+		HardlinkHandling:        "break",
+		OutputContainer:         "mkv",
+		VerifyOutput:            true,
+		Workers:                 1,
+		FFmpegPath:              "ffmpeg",
+		FFprobePath:             "ffprobe",
+		ProbeConcurrency:        8,
+		QueueFile:               "",
+		NtfyServer:              "https://ntfy.sh",
+		QualityHEVC:             0,
+		QualityAV1:              0,
+		SVTAV1Preset:            6,
+		SVTAV1Tune:              1,
+		AudioCodec:              "eac3",
+		AutoQualityTargetSSIM:   0.98,
+		ScheduleEnabled:         false,
+		ScheduleStartHour:       22,
+		ScheduleEndHour:         6,
+		KeepLargerFiles:         false,
+		PreserveOwnership:       true,
+		PreserveMTime:           true,
+		MinFreeSpaceMB:          1024,
+		ReserveTempSpace:        true,
+		TrashRetentionDays:      30,
+		ShutdownGraceSeconds:    300,
+		StallTimeoutMinutes:     10,
+		StallRetries:            1,
+		ChunkedMinMinutes:       30,
+		PreviewIntervalSeconds:  10,
+		ThumbnailCacheMB:        200,
+		LogLevel:                "info",
+		LogFormat:               "text",
+		LogBufferLines:          5000,
+		ProgressEventsPerSecond: 2,
+		LayoutDesign:            "split",
+		Features:                DefaultFeatureFlags(),
+		Autoscale: AutoscaleConfig{
+			MinWorkers:        1,
+			MaxWorkers:        4,
+			IntervalSeconds:   30,
+			CPUHighPercent:    85,
+			CPULowPercent:     50,
+			GPUHighPercent:    90,
+			GPULowPercent:     60,
+			MemoryHighPercent: 90,
+		},
+		MountWatch: MountWatchConfig{
+			Enabled:         true,
+			IntervalSeconds: 30,
+			TimeoutSeconds:  10,
+		},
 		Auth: AuthConfig{
 			Enabled:  false,
 			Provider: "noop",
-			Password: PasswordAuthConfig{HashAlgo: "auto"},
+			Password: PasswordAuthConfig{HashAlgo: "auto", MaxAttempts: 5, LockoutSeconds: 30},
 			OIDC: OIDCAuthConfig{
 				Scopes: []string{"openid", "profile", "email"},
 			},
+			Branding: AuthBrandingConfig{Theme: "auto"},
 		},
 	}
 }
@@ -217,6 +783,12 @@ func Load(path string) (*Config, error) {
 			// No config file - use defaults
 			applyFeatureFlagEnvOverrides(cfg)
 			applyAuthEnvOverrides(cfg)
+			applyIntegrationEnvOverrides(cfg)
+			applyLogEnvOverrides(cfg)
+			applyTLSEnvOverrides(cfg)
+			applyAccessEnvOverrides(cfg)
+			applyBasePath(cfg)
+			resolveSecrets(cfg)
 			return cfg, nil
 		}
 		return nil, err
@@ -233,29 +805,252 @@ func Load(path string) (*Config, error) {
 	if cfg.FFprobePath == "" {
 		cfg.FFprobePath = "ffprobe"
 	}
+	if cfg.ProbeConcurrency < 1 {
+		cfg.ProbeConcurrency = 8
+	}
 	if cfg.Workers < 1 {
 		cfg.Workers = 1
 	}
+	for i, device := range cfg.WorkerDevices {
+		if device != "" && !strings.HasPrefix(device, "/dev/dri/") && !isCUDADevice(device) {
+			configLog.Warn("Ignoring worker device: not a /dev/dri render node or cuda:N", "setting", "worker_devices", "index", i, "value", device)
+			cfg.WorkerDevices[i] = ""
+		}
+	}
 	if cfg.SubtitleHandling == "" {
 		cfg.SubtitleHandling = "convert"
 	} else if cfg.SubtitleHandling != "convert" && cfg.SubtitleHandling != "drop" {
 		cfg.SubtitleHandling = "convert"
 	}
+	switch cfg.HDRHandling {
+	case "preserve", "tonemap", "skip":
+	default:
+		cfg.HDRHandling = "preserve"
+	}
+	if !ValidHardlinkHandling(cfg.HardlinkHandling) {
+		cfg.HardlinkHandling = "break"
+	}
+	for dir, mode := range cfg.HardlinkHandlingPaths {
+		if !ValidHardlinkHandling(mode) {
+			configLog.Warn("Ignoring hardlink handling: not break, skip or relink", "setting", "hardlink_handling_paths."+dir, "value", mode)
+			delete(cfg.HardlinkHandlingPaths, dir)
+		}
+	}
+	if cfg.OutputContainer != "mkv" && cfg.OutputContainer != "mp4" {
+		cfg.OutputContainer = "mkv"
+	}
+	for id, container := range cfg.PresetContainers {
+		if container != "mkv" && container != "mp4" {
+			configLog.Warn("Ignoring preset container: not mkv or mp4", "setting", "preset_containers."+id, "value", container)
+			delete(cfg.PresetContainers, id)
+		}
+	}
+	for id, mode := range cfg.PresetDeinterlace {
+		if mode != "auto" && mode != "on" && mode != "off" {
+			configLog.Warn("Ignoring preset deinterlace: not auto, on or off", "setting", "preset_deinterlace."+id, "value", mode)
+			delete(cfg.PresetDeinterlace, id)
+		}
+	}
+	for id, threads := range cfg.PresetThreads {
+		if threads < 0 || threads > 256 {
+			configLog.Warn("Ignoring preset threads: not between 0 and 256", "setting", "preset_threads."+id, "value", threads)
+			delete(cfg.PresetThreads, id)
+		}
+	}
+	for id, hours := range cfg.PresetMaxEncodeHours {
+		if hours < 0 {
+			configLog.Warn("Ignoring preset max encode hours: negative", "setting", "preset_max_encode_hours."+id, "value", hours)
+			delete(cfg.PresetMaxEncodeHours, id)
+		}
+	}
+	for id, encoder := range cfg.PresetEncoders {
+		switch encoder {
+		case "none", "videotoolbox", "nvenc", "qsv", "vaapi":
+		default:
+			configLog.Warn("Ignoring preset encoder: unknown encoder", "setting", "preset_encoders."+id, "value", encoder)
+			delete(cfg.PresetEncoders, id)
+		}
+	}
 	if cfg.LayoutDesign != "split" && cfg.LayoutDesign != "tabs" {
 		cfg.LayoutDesign = "split"
 	}
 	if cfg.LogLevel == "" {
 		cfg.LogLevel = "info"
 	}
+	if cfg.LogFormat != "text" && cfg.LogFormat != "json" {
+		cfg.LogFormat = "text"
+	}
+	if cfg.LogBufferLines <= 0 {
+		cfg.LogBufferLines = 5000
+	}
+	if cfg.ProgressEventsPerSecond < 0 {
+		cfg.ProgressEventsPerSecond = 0
+	}
+	if cfg.NotifyFailureThreshold < 0 {
+		cfg.NotifyFailureThreshold = 0
+	}
+	// The worker pool allows 1-6 workers
+	cfg.Autoscale.MinWorkers = min(max(cfg.Autoscale.MinWorkers, 1), 6)
+	cfg.Autoscale.MaxWorkers = min(cfg.Autoscale.MaxWorkers, 6)
+	if cfg.Autoscale.MaxWorkers < cfg.Autoscale.MinWorkers {
+		cfg.Autoscale.MaxWorkers = cfg.Autoscale.MinWorkers
+	}
+	if cfg.Autoscale.IntervalSeconds < 5 {
+		cfg.Autoscale.IntervalSeconds = 5
+	}
+	cfg.FFmpegLimits.Nice = min(max(cfg.FFmpegLimits.Nice, 0), 19)
+	cfg.FFmpegLimits.IOLevel = min(max(cfg.FFmpegLimits.IOLevel, 0), 7)
+	if cfg.FFmpegLimits.IOClass != "best-effort" && cfg.FFmpegLimits.IOClass != "idle" {
+		cfg.FFmpegLimits.IOClass = ""
+	}
+	if cfg.FFmpegLimits.MemoryLimitMB < 0 {
+		cfg.FFmpegLimits.MemoryLimitMB = 0
+	}
+	if !cpuListPattern.MatchString(cfg.FFmpegLimits.CPUAffinity) {
+		cfg.FFmpegLimits.CPUAffinity = ""
+	}
+	if cfg.MountWatch.IntervalSeconds < 5 {
+		cfg.MountWatch.IntervalSeconds = 5
+	}
+	if cfg.MountWatch.TimeoutSeconds < 1 {
+		cfg.MountWatch.TimeoutSeconds = 1
+	}
+	for encoder, watts := range cfg.Energy.Watts {
+		if watts < 0 {
+			delete(cfg.Energy.Watts, encoder)
+		}
+	}
+	if cfg.Energy.CostPerKWh < 0 {
+		cfg.Energy.CostPerKWh = 0
+	}
+	if cfg.MinFreeSpaceMB < 0 {
+		cfg.MinFreeSpaceMB = 0
+	}
+	if cfg.ScanIntervalHours < 0 {
+		cfg.ScanIntervalHours = 0
+	}
+	if cfg.OriginalRetentionDays < 0 {
+		cfg.OriginalRetentionDays = 0
+	}
+	if cfg.TrashRetentionDays < 0 {
+		cfg.TrashRetentionDays = 0
+	}
+	if cfg.ShutdownGraceSeconds < 0 {
+		cfg.ShutdownGraceSeconds = 0
+	}
+	if cfg.StallTimeoutMinutes < 0 {
+		cfg.StallTimeoutMinutes = 0
+	}
+	if cfg.StallRetries < 0 {
+		cfg.StallRetries = 0
+	}
+	if cfg.MaxEncodeHours < 0 {
+		cfg.MaxEncodeHours = 0
+	}
+	if cfg.PreviewIntervalSeconds < 0 {
+		cfg.PreviewIntervalSeconds = 0
+	}
+	if cfg.ThumbnailCacheMB < 0 {
+		cfg.ThumbnailCacheMB = 0
+	}
+	cfg.ExtraVideoExtensions = NormalizeExtensions(cfg.ExtraVideoExtensions)
+	cfg.ExcludedVideoExtensions = NormalizeExtensions(cfg.ExcludedVideoExtensions)
+	if cfg.Auth.SessionStore != "" && cfg.Auth.SessionStore != "file" {
+		configLog.Warn("Unknown session store, using stateless sessions", "setting", "auth.session_store", "value", cfg.Auth.SessionStore)
+		cfg.Auth.SessionStore = ""
+	}
+	if cfg.Auth.JobVisibility != "" && cfg.Auth.JobVisibility != "all" && cfg.Auth.JobVisibility != "own" {
+		configLog.Warn("Unknown job visibility, showing all jobs", "setting", "auth.job_visibility", "value", cfg.Auth.JobVisibility)
+		cfg.Auth.JobVisibility = ""
+	}
+	if cfg.Auth.Password.MaxAttempts <= 0 {
+		cfg.Auth.Password.MaxAttempts = 5
+	}
+	if cfg.Auth.Password.LockoutSeconds <= 0 {
+		cfg.Auth.Password.LockoutSeconds = 30
+	}
+	if cfg.Auth.Password.Captcha.AfterFailures < 0 {
+		cfg.Auth.Password.Captcha.AfterFailures = 0
+	}
+	if cfg.SVTAV1Preset < 0 || cfg.SVTAV1Preset > 13 {
+		cfg.SVTAV1Preset = 6
+	}
+	if cfg.SVTAV1FilmGrain < 0 || cfg.SVTAV1FilmGrain > 50 {
+		cfg.SVTAV1FilmGrain = 0
+	}
+	if cfg.SVTAV1Tune < 0 || cfg.SVTAV1Tune > 2 {
+		cfg.SVTAV1Tune = 1
+	}
+	if cfg.AudioCodec != "eac3" && cfg.AudioCodec != "opus" {
+		cfg.AudioCodec = "eac3"
+	}
+	if cfg.ReencodeAboveBPP < 0 || cfg.ReencodeAboveBPP > 1 {
+		cfg.ReencodeAboveBPP = 0
+	}
+	if cfg.MinSavingsPercent < 0 || cfg.MinSavingsPercent > 90 {
+		cfg.MinSavingsPercent = 0
+	}
+	if cfg.ChunkedSegments == 1 || cfg.ChunkedSegments < 0 {
+		cfg.ChunkedSegments = 0
+	}
+	if cfg.ChunkedSegments > 16 {
+		cfg.ChunkedSegments = 16
+	}
+	if cfg.ChunkedMinMinutes < 0 {
+		cfg.ChunkedMinMinutes = 30
+	}
+	if cfg.AutoQualityTargetSSIM <= 0 || cfg.AutoQualityTargetSSIM > 1 {
+		cfg.AutoQualityTargetSSIM = 0.98
+	}
+	if cfg.AutoQualityTargetSavings < 0 || cfg.AutoQualityTargetSavings > 99 {
+		cfg.AutoQualityTargetSavings = 0
+	}
+	cfg.Rules = normalizeRules(cfg.Rules)
 
 	// Apply environment variable overrides for feature flags
 	// This allows toggling features without modifying config files
 	applyFeatureFlagEnvOverrides(cfg)
 	applyAuthEnvOverrides(cfg)
+	applyIntegrationEnvOverrides(cfg)
+	applyLogEnvOverrides(cfg)
+	applyTLSEnvOverrides(cfg)
+	applyAccessEnvOverrides(cfg)
+	applyBasePath(cfg)
+	resolveSecrets(cfg)
 
 	return cfg, nil
 }
 
+// isCUDADevice reports whether device is a CUDA device like cuda:0
+func isCUDADevice(device string) bool {
+	index, ok := strings.CutPrefix(device, "cuda:")
+	n, err := strconv.Atoi(index)
+	return ok && err == nil && n >= 0
+}
+
+// normalizeRules drops rules without an id, path or preset, and duplicate ids
+func normalizeRules(rules []Rule) []Rule {
+	seen := make(map[string]struct{}, len(rules))
+	valid := make([]Rule, 0, len(rules))
+	for _, rule := range rules {
+		rule.ID = strings.TrimSpace(rule.ID)
+		if rule.ID == "" || strings.TrimSpace(rule.Path) == "" || strings.TrimSpace(rule.Preset) == "" {
+			configLog.Warn("Ignoring rule: id, path and preset are required", "rule", rule.ID)
+			continue
+		}
+		if _, dup := seen[rule.ID]; dup {
+			configLog.Warn("Ignoring duplicate rule id", "rule", rule.ID)
+			continue
+		}
+		seen[rule.ID] = struct{}{}
+		for i, codec := range rule.Codecs {
+			rule.Codecs[i] = strings.ToLower(strings.TrimSpace(codec))
+		}
+		valid = append(valid, rule)
+	}
+	return valid
+}
+
 func applyAuthEnvOverrides(cfg *Config) {
 	if v := os.Getenv("SHRINKRAY_AUTH_ENABLED"); v != "" {
 		cfg.Auth.Enabled = envBool(v)
@@ -263,12 +1058,18 @@ func applyAuthEnvOverrides(cfg *Config) {
 	if v := os.Getenv("SHRINKRAY_AUTH_PROVIDER"); v != "" {
 		cfg.Auth.Provider = v
 	}
-	if v := os.Getenv("SHRINKRAY_AUTH_SECRET"); v != "" {
-		cfg.Auth.Secret = v
-	}
 	if v := os.Getenv("SHRINKRAY_AUTH_BYPASS_PATHS"); v != "" {
 		cfg.Auth.BypassPaths = splitCommaList(v)
 	}
+	if v := os.Getenv("SHRINKRAY_AUTH_SESSION_STORE"); v != "" {
+		cfg.Auth.SessionStore = v
+	}
+	if v := os.Getenv("SHRINKRAY_AUTH_JOB_VISIBILITY"); v != "" {
+		cfg.Auth.JobVisibility = v
+	}
+	if v := os.Getenv("SHRINKRAY_AUTH_ADMIN_USERS"); v != "" {
+		cfg.Auth.AdminUsers = splitCommaList(v)
+	}
 	if v := os.Getenv("SHRINKRAY_AUTH_HASH_ALGO"); v != "" {
 		cfg.Auth.Password.HashAlgo = v
 	}
@@ -281,9 +1082,6 @@ func applyAuthEnvOverrides(cfg *Config) {
 	if v := os.Getenv("SHRINKRAY_AUTH_OIDC_CLIENT_ID"); v != "" {
 		cfg.Auth.OIDC.ClientID = v
 	}
-	if v := os.Getenv("SHRINKRAY_AUTH_OIDC_CLIENT_SECRET"); v != "" {
-		cfg.Auth.OIDC.ClientSecret = v
-	}
 	if v := os.Getenv("SHRINKRAY_AUTH_OIDC_REDIRECT_URL"); v != "" {
 		cfg.Auth.OIDC.RedirectURL = v
 	}
@@ -296,6 +1094,87 @@ func applyAuthEnvOverrides(cfg *Config) {
 	if v := os.Getenv("SHRINKRAY_AUTH_OIDC_ALLOWED_GROUPS"); v != "" {
 		cfg.Auth.OIDC.AllowedGroups = splitCommaList(v)
 	}
+	if v := os.Getenv("SHRINKRAY_AUTH_HEADER_TRUSTED_PROXIES"); v != "" {
+		cfg.Auth.Header.TrustedProxies = splitCommaList(v)
+	}
+	if v := os.Getenv("SHRINKRAY_AUTH_HEADER_ALLOWED_GROUPS"); v != "" {
+		cfg.Auth.Header.AllowedGroups = splitCommaList(v)
+	}
+	if v := os.Getenv("SHRINKRAY_AUTH_BRANDING_TITLE"); v != "" {
+		cfg.Auth.Branding.Title = v
+	}
+	if v := os.Getenv("SHRINKRAY_AUTH_BRANDING_LOGO_URL"); v != "" {
+		cfg.Auth.Branding.LogoURL = v
+	}
+	if v := os.Getenv("SHRINKRAY_AUTH_BRANDING_ACCENT_COLOR"); v != "" {
+		cfg.Auth.Branding.AccentColor = v
+	}
+	if v := os.Getenv("SHRINKRAY_AUTH_BRANDING_THEME"); v != "" {
+		cfg.Auth.Branding.Theme = v
+	}
+	if v := os.Getenv("SHRINKRAY_AUTH_BRANDING_LOCALE"); v != "" {
+		cfg.Auth.Branding.Locale = v
+	}
+}
+
+func applyIntegrationEnvOverrides(cfg *Config) {
+	if v := os.Getenv("SHRINKRAY_SONARR_URL"); v != "" {
+		cfg.Integrations.Sonarr.URL = v
+	}
+	if v := os.Getenv("SHRINKRAY_RADARR_URL"); v != "" {
+		cfg.Integrations.Radarr.URL = v
+	}
+}
+
+func applyAccessEnvOverrides(cfg *Config) {
+	if v := os.Getenv("SHRINKRAY_ACCESS_ALLOWED_NETWORKS"); v != "" {
+		cfg.Access.AllowedNetworks = splitCommaList(v)
+	}
+	if v := os.Getenv("SHRINKRAY_ACCESS_TRUSTED_PROXIES"); v != "" {
+		cfg.Access.TrustedProxies = splitCommaList(v)
+	}
+	if v := os.Getenv("SHRINKRAY_ACCESS_ALLOWED_ORIGINS"); v != "" {
+		cfg.Access.AllowedOrigins = splitCommaList(v)
+	}
+}
+
+func applyTLSEnvOverrides(cfg *Config) {
+	if v := os.Getenv("SHRINKRAY_TLS_CERT_FILE"); v != "" {
+		cfg.TLS.CertFile = v
+	}
+	if v := os.Getenv("SHRINKRAY_TLS_KEY_FILE"); v != "" {
+		cfg.TLS.KeyFile = v
+	}
+	if v := os.Getenv("SHRINKRAY_TLS_ACME_DOMAINS"); v != "" {
+		cfg.TLS.ACMEDomains = splitCommaList(v)
+	}
+	if v := os.Getenv("SHRINKRAY_TLS_ACME_EMAIL"); v != "" {
+		cfg.TLS.ACMEEmail = v
+	}
+	if v := os.Getenv("SHRINKRAY_TLS_REDIRECT_ADDR"); v != "" {
+		cfg.TLS.RedirectAddr = v
+	}
+}
+
+// applyBasePath applies SHRINKRAY_BASE_PATH and normalizes base_path to
+// "" or a path with a leading slash and no trailing one
+func applyBasePath(cfg *Config) {
+	if v, ok := os.LookupEnv("SHRINKRAY_BASE_PATH"); ok {
+		cfg.BasePath = v
+	}
+	cfg.BasePath = strings.Trim(strings.TrimSpace(cfg.BasePath), "/")
+	if cfg.BasePath != "" {
+		cfg.BasePath = path.Clean("/" + cfg.BasePath)
+	}
+}
+
+func applyLogEnvOverrides(cfg *Config) {
+	if v := os.Getenv("SHRINKRAY_LOG_LEVEL"); v != "" {
+		cfg.LogLevel = v
+	}
+	if v := os.Getenv("SHRINKRAY_LOG_FORMAT"); v == "text" || v == "json" {
+		cfg.LogFormat = v
+	}
 }
 
 func splitCommaList(value string) []string {
@@ -367,7 +1246,7 @@ func (c *Config) Save(path string) error {
 		return err
 	}
 
-	data, err := yaml.Marshal(c)
+	data, err := yaml.Marshal(c.withSecretRefs())
 	if err != nil {
 		return err
 	}
@@ -375,6 +1254,14 @@ func (c *Config) Save(path string) error {
 	return os.WriteFile(path, data, 0644)
 }
 
+// MountWatchPaths returns the roots the mount watchdog checks
+func (c *Config) MountWatchPaths() []string {
+	if len(c.MountWatch.Paths) > 0 {
+		return c.MountWatch.Paths
+	}
+	return []string{c.MediaPath}
+}
+
 // GetTempDir returns the directory for temp files
 // If TempPath is set, returns that; otherwise returns the directory of the source file
 func (c *Config) GetTempDir(sourcePath string) string {
@@ -383,3 +1270,54 @@ func (c *Config) GetTempDir(sourcePath string) string {
 	}
 	return filepath.Dir(sourcePath)
 }
+
+// ValidHardlinkHandling reports whether mode is a hardlink_handling option
+func ValidHardlinkHandling(mode string) bool {
+	return mode == "break" || mode == "skip" || mode == "relink"
+}
+
+// HardlinkHandlingFor returns the hardlink handling for a source: the
+// entry in HardlinkHandlingPaths for its closest folder, otherwise
+// HardlinkHandling
+func (c *Config) HardlinkHandlingFor(sourcePath string) string {
+	mode, longest := c.HardlinkHandling, -1
+	for dir, dirMode := range c.HardlinkHandlingPaths {
+		dir = filepath.Clean(dir)
+		if (sourcePath == dir || strings.HasPrefix(sourcePath, dir+string(filepath.Separator))) && len(dir) > longest {
+			mode, longest = dirMode, len(dir)
+		}
+	}
+	if mode == "" {
+		return "break"
+	}
+	return mode
+}
+
+// HardlinkSearchDirs returns where relink looks for a source's other links
+func (c *Config) HardlinkSearchDirs() []string {
+	if len(c.HardlinkSearchPaths) > 0 {
+		return c.HardlinkSearchPaths
+	}
+	return []string{c.MediaPath}
+}
+
+// NormalizeExtensions lowercases a list of file extensions and gives each a
+// leading dot, dropping blanks and repeats
+func NormalizeExtensions(exts []string) []string {
+	var normalized []string
+	seen := make(map[string]bool, len(exts))
+	for _, ext := range exts {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" || ext == "." {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		if !seen[ext] {
+			seen[ext] = true
+			normalized = append(normalized, ext)
+		}
+	}
+	return normalized
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -118,3 +119,104 @@ workers: 4`
 		t.Errorf("expected default ffmpeg path, got %s", cfg.FFmpegPath)
 	}
 }
+
+func TestLoadResolvesSecrets(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	secretPath := filepath.Join(tmpDir, "app_token")
+	if err := os.WriteFile(secretPath, []byte("token-from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	yaml := "pushover_user_key: env:TEST_PUSHOVER_USER\n" +
+		"pushover_app_token: file:" + secretPath + "\n" +
+		"ntfy_token: plain-token\n" +
+		"integrations:\n  plex:\n    - url: http://plex:32400\n      token: env:TEST_PLEX_TOKEN\n"
+	if err := os.WriteFile(configPath, []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_PUSHOVER_USER", "user-from-env")
+	t.Setenv("TEST_PLEX_TOKEN", "plex-from-env")
+	t.Setenv("SHRINKRAY_REMOTE_TOKEN_FILE", secretPath)
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.PushoverUserKey != "user-from-env" || cfg.PushoverAppToken != "token-from-file" ||
+		cfg.NtfyToken != "plain-token" || cfg.Remote.Token != "token-from-file" ||
+		cfg.Integrations.Plex[0].Token != "plex-from-env" {
+		t.Fatalf("secrets not resolved: %+v", cfg)
+	}
+	if cfg.SecretSource("pushover_user_key") != SecretSourceEnv ||
+		cfg.SecretSource("pushover_app_token") != SecretSourceFile ||
+		cfg.SecretSource("ntfy_token") != SecretSourceConfig {
+		t.Error("unexpected secret sources")
+	}
+
+	// Saving writes the references back, never the resolved values
+	cfg.Workers = 3
+	if err := cfg.Save(configPath); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(configPath)
+	for _, leaked := range []string{"user-from-env", "token-from-file", "plex-from-env"} {
+		if strings.Contains(string(data), leaked) {
+			t.Errorf("saved config contains resolved secret %q", leaked)
+		}
+	}
+	if !strings.Contains(string(data), "env:TEST_PUSHOVER_USER") || !strings.Contains(string(data), "env:TEST_PLEX_TOKEN") {
+		t.Errorf("saved config lost its references:\n%s", data)
+	}
+
+	// A value changed after loading is saved as is
+	cfg.PushoverUserKey = "typed-in"
+	if cfg.SecretSource("pushover_user_key") != SecretSourceConfig {
+		t.Error("changed secret should no longer count as from the environment")
+	}
+	if err := cfg.Save(configPath); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(configPath); !strings.Contains(string(data), "typed-in") {
+		t.Error("changed secret was not saved")
+	}
+}
+
+func TestLoadNormalizesBasePath(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	for value, want := range map[string]string{"": "", "/": "", "shrinkray/": "/shrinkray", " /tools//shrinkray/ ": "/tools/shrinkray"} {
+		if err := os.WriteFile(configPath, []byte("base_path: \""+value+"\"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := Load(configPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.BasePath != want {
+			t.Errorf("base_path %q loaded as %q, want %q", value, cfg.BasePath, want)
+		}
+	}
+
+	t.Setenv("SHRINKRAY_BASE_PATH", "/from-env/")
+	if cfg, _ := Load(configPath); cfg.BasePath != "/from-env" {
+		t.Errorf("SHRINKRAY_BASE_PATH not applied, got %q", cfg.BasePath)
+	}
+}
+
+func TestHardlinkHandlingFor(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.HardlinkHandlingPaths = map[string]string{
+		"/media/tv":          "skip",
+		"/media/tv/Seeding/": "relink",
+	}
+	for path, want := range map[string]string{
+		"/media/movies/Film.mkv":         "break",
+		"/media/tv/Show/S01E01.mkv":      "skip",
+		"/media/tv/Seeding/Show/E01.mkv": "relink",
+		"/media/tv-archive/Show/E01.mkv": "break",
+	} {
+		if got := cfg.HardlinkHandlingFor(path); got != want {
+			t.Errorf("HardlinkHandlingFor(%s) = %s, want %s", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Credentials can be kept out of shrinkray.yaml. Each is resolved in order:
+//
+//  1. the environment variable named in secretFields (e.g. SHRINKRAY_NTFY_TOKEN)
+//  2. a file named by that variable plus _FILE (e.g. Docker secrets:
+//     SHRINKRAY_NTFY_TOKEN_FILE=/run/secrets/ntfy_token)
+//  3. the YAML value, which may itself be a reference: "env:VAR" or
+//     "file:/path/to/secret"
+//
+// Save writes back what the file had, so resolved values never end up in it.
+
+// Secret sources reported by SecretSource
+const (
+	SecretSourceConfig = "config" // Plain value in the config file
+	SecretSourceEnv    = "env"
+	SecretSourceFile   = "file"
+)
+
+// secretRef records where a credential came from
+type secretRef struct {
+	raw      string // The config file's value, written back by Save
+	resolved string // The value it resolved to
+	source   string // SecretSourceEnv or SecretSourceFile
+}
+
+// secretField is one credential in the config
+type secretField struct {
+	key   string // YAML path, used in logs and by SecretSource
+	env   string // Environment variable that overrides it (empty = refs only)
+	value *string
+}
+
+// secretFields lists every credential in cfg
+func secretFields(cfg *Config) []secretField {
+	fields := []secretField{
+		{"pushover_user_key", "SHRINKRAY_PUSHOVER_USER_KEY", &cfg.PushoverUserKey},
+		{"pushover_app_token", "SHRINKRAY_PUSHOVER_APP_TOKEN", &cfg.PushoverAppToken},
+		{"ntfy_token", "SHRINKRAY_NTFY_TOKEN", &cfg.NtfyToken},
+		{"auth.secret", "SHRINKRAY_AUTH_SECRET", &cfg.Auth.Secret},
+		{"auth.oidc.client_secret", "SHRINKRAY_AUTH_OIDC_CLIENT_SECRET", &cfg.Auth.OIDC.ClientSecret},
+		{"auth.password.captcha.secret", "SHRINKRAY_AUTH_CAPTCHA_SECRET", &cfg.Auth.Password.Captcha.Secret},
+		{"remote.token", "SHRINKRAY_REMOTE_TOKEN", &cfg.Remote.Token},
+		{"integrations.sonarr.api_key", "SHRINKRAY_SONARR_API_KEY", &cfg.Integrations.Sonarr.APIKey},
+		{"integrations.radarr.api_key", "SHRINKRAY_RADARR_API_KEY", &cfg.Integrations.Radarr.APIKey},
+	}
+	for i := range cfg.Integrations.Plex {
+		fields = append(fields, secretField{key: fmt.Sprintf("integrations.plex[%d].token", i), value: &cfg.Integrations.Plex[i].Token})
+	}
+	for i := range cfg.Integrations.Jellyfin {
+		fields = append(fields, secretField{key: fmt.Sprintf("integrations.jellyfin[%d].token", i), value: &cfg.Integrations.Jellyfin[i].Token})
+	}
+	return fields
+}
+
+// resolveSecrets replaces credentials with their environment, secret file
+// or referenced values, remembering the config file's values for Save
+func resolveSecrets(cfg *Config) {
+	cfg.secrets = make(map[string]secretRef)
+	for _, field := range secretFields(cfg) {
+		raw := *field.value
+		value, source, err := lookupSecret(field.env, raw)
+		if err != nil {
+			configLog.Warn("Could not read secret", "setting", field.key, "error", err)
+		}
+		if source == "" {
+			continue
+		}
+		*field.value = value
+		cfg.secrets[field.key] = secretRef{raw: raw, resolved: value, source: source}
+	}
+}
+
+// lookupSecret returns a credential's value and source ("" = the plain
+// config value, unchanged)
+func lookupSecret(envName, raw string) (value, source string, err error) {
+	if envName != "" {
+		if v := os.Getenv(envName); v != "" {
+			return v, SecretSourceEnv, nil
+		}
+		if path := os.Getenv(envName + "_FILE"); path != "" {
+			v, err := readSecretFile(path)
+			return v, SecretSourceFile, err
+		}
+	}
+	if name, ok := strings.CutPrefix(raw, "env:"); ok {
+		v := os.Getenv(name)
+		if v == "" {
+			err = fmt.Errorf("environment variable %s is not set", name)
+		}
+		return v, SecretSourceEnv, err
+	}
+	if path, ok := strings.CutPrefix(raw, "file:"); ok {
+		v, err := readSecretFile(path)
+		return v, SecretSourceFile, err
+	}
+	return raw, "", nil
+}
+
+// readSecretFile reads a secret, ignoring the trailing newline most editors add
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// SecretSource reports where the credential at key (e.g. "ntfy_token") came
+// from: SecretSourceEnv, SecretSourceFile, or SecretSourceConfig. Values
+// changed since loading count as config.
+func (c *Config) SecretSource(key string) string {
+	for _, field := range secretFields(c) {
+		if field.key != key {
+			continue
+		}
+		if ref, ok := c.secrets[key]; ok && ref.resolved == *field.value {
+			return ref.source
+		}
+		break
+	}
+	return SecretSourceConfig
+}
+
+// CopySecretSources takes from's record of where its credentials came from,
+// after its values were copied in (see Handler.ApplyConfig)
+func (c *Config) CopySecretSources(from *Config) {
+	c.secrets = from.secrets
+}
+
+// withSecretRefs returns a copy of c for saving, with credentials that
+// still have their resolved value put back to the config file's value
+func (c *Config) withSecretRefs() *Config {
+	out := *c
+	out.Integrations.Plex = append([]MediaServerConfig(nil), c.Integrations.Plex...)
+	out.Integrations.Jellyfin = append([]MediaServerConfig(nil), c.Integrations.Jellyfin...)
+	for _, field := range secretFields(&out) {
+		if ref, ok := c.secrets[field.key]; ok && ref.resolved == *field.value {
+			*field.value = ref.raw
+		}
+	}
+	return &out
+}
@@ -0,0 +1,21 @@
+package diskspace
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// existingParent walks up from path until it finds something that exists.
+func existingParent(path string) string {
+	current := filepath.Clean(path)
+	for {
+		if _, err := os.Stat(current); err == nil {
+			return current
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			return current
+		}
+		current = parent
+	}
+}
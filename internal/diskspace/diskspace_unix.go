@@ -0,0 +1,29 @@
+//go:build !windows
+
+package diskspace
+
+import "syscall"
+
+// Free returns the number of bytes available to unprivileged users on the
+// filesystem containing path. If path does not exist yet (e.g. a temp dir
+// that will be created later), the nearest existing parent is used.
+func Free(path string) (uint64, error) {
+	dir := existingParent(path)
+
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, err
+	}
+	return stat.Bavail * uint64(stat.Bsize), nil
+}
+
+// Device returns the ID of the filesystem containing path, so callers can
+// tell whether two directories share free space. Like Free, a path that
+// doesn't exist yet uses its nearest existing parent.
+func Device(path string) (uint64, error) {
+	var stat syscall.Stat_t
+	if err := syscall.Stat(existingParent(path), &stat); err != nil {
+		return 0, err
+	}
+	return uint64(stat.Dev), nil
+}
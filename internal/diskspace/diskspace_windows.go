@@ -0,0 +1,40 @@
+package diskspace
+
+import (
+	"hash/fnv"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+var getDiskFreeSpaceEx = syscall.NewLazyDLL("kernel32.dll").NewProc("GetDiskFreeSpaceExW")
+
+// Free returns the number of bytes available to the current user on the
+// volume containing path. If path does not exist yet (e.g. a temp dir that
+// will be created later), the nearest existing parent is used.
+func Free(path string) (uint64, error) {
+	dir, err := syscall.UTF16PtrFromString(existingParent(path))
+	if err != nil {
+		return 0, err
+	}
+
+	var available uint64
+	ok, _, err := getDiskFreeSpaceEx.Call(uintptr(unsafe.Pointer(dir)), uintptr(unsafe.Pointer(&available)), 0, 0)
+	if ok == 0 {
+		return 0, err
+	}
+	return available, nil
+}
+
+// Device returns an ID for the volume containing path (its drive letter or
+// UNC share), so callers can tell whether two directories share free space
+func Device(path string) (uint64, error) {
+	abs, err := filepath.Abs(existingParent(path))
+	if err != nil {
+		return 0, err
+	}
+	h := fnv.New64a()
+	h.Write([]byte(strings.ToLower(filepath.VolumeName(abs))))
+	return h.Sum64(), nil
+}
@@ -0,0 +1,270 @@
+// Package energy measures or models the power transcodes use, so encoders
+// can be compared on kWh and cost as well as speed and savings.
+package energy
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Source is the energy counter that covers an encoder
+type Source string
+
+const (
+	SourceNone Source = ""       // Modeled from watts only
+	SourceCPU  Source = "cpu"    // RAPL package counters, which include integrated GPUs
+	SourceGPU  Source = "nvidia" // nvidia-smi's total energy consumption
+)
+
+// SourceFor returns the counter that measures encoder ("none", "vaapi",
+// "nvenc", ...)
+func SourceFor(encoder string) Source {
+	switch encoder {
+	case "nvenc":
+		return SourceGPU
+	case "videotoolbox":
+		return SourceNone
+	default:
+		return SourceCPU
+	}
+}
+
+// sampleInterval is how often running jobs' counters are read, often
+// enough that a RAPL counter can't wrap twice between reads
+const sampleInterval = 30 * time.Second
+
+// Counter is a cumulative energy counter
+type Counter interface {
+	// Read returns the energy used so far in joules and the value it wraps
+	// at (0 if it doesn't)
+	Read() (joules, wrap float64, ok bool)
+}
+
+// Usage is the energy a job used
+type Usage struct {
+	Joules   float64
+	Elapsed  time.Duration
+	Measured bool // Joules came from counters rather than being 0
+}
+
+// KWh returns u's energy, or watts over its elapsed time when it wasn't
+// measured
+func (u Usage) KWh(watts float64) float64 {
+	if u.Measured {
+		return u.Joules / 3.6e6
+	}
+	return watts * u.Elapsed.Hours() / 1000
+}
+
+type tracked struct {
+	source  Source
+	started time.Time
+	joules  float64
+}
+
+type reading struct {
+	joules float64
+	ok     bool
+}
+
+// Tracker attributes measured energy to running jobs. Each interval's use
+// on a counter is split evenly between the jobs running on it, since a
+// package or GPU counter can't tell them apart.
+type Tracker struct {
+	mu       sync.Mutex
+	counters map[Source][]Counter
+	last     map[Counter]reading
+	jobs     map[string]*tracked
+}
+
+// NewTracker returns a tracker reading whichever counters this machine has
+func NewTracker() *Tracker {
+	counters := make(map[Source][]Counter)
+	if rapl := raplCounters(); len(rapl) > 0 {
+		counters[SourceCPU] = rapl
+	}
+	if gpu := (nvidiaCounter{}); nvidiaAvailable() {
+		counters[SourceGPU] = []Counter{gpu}
+	}
+	return newTracker(counters)
+}
+
+func newTracker(counters map[Source][]Counter) *Tracker {
+	return &Tracker{
+		counters: counters,
+		last:     make(map[Counter]reading),
+		jobs:     make(map[string]*tracked),
+	}
+}
+
+// Sources returns the counters available, for the startup banner
+func (t *Tracker) Sources() []Source {
+	var sources []Source
+	for _, s := range []Source{SourceCPU, SourceGPU} {
+		if len(t.counters[s]) > 0 {
+			sources = append(sources, s)
+		}
+	}
+	return sources
+}
+
+// Run samples the counters of running jobs until ctx is done
+func (t *Tracker) Run(ctx context.Context) {
+	ticker := time.NewTicker(sampleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.mu.Lock()
+			t.sampleLocked()
+			t.mu.Unlock()
+		}
+	}
+}
+
+// Start begins tracking a job on source; with SourceNone, or where source
+// has no counter, only its time is tracked
+func (t *Tracker) Start(jobID string, source Source) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Energy used until now belongs to the jobs already running
+	t.sampleLocked()
+	if len(t.counters[source]) == 0 {
+		source = SourceNone
+	}
+	t.jobs[jobID] = &tracked{source: source, started: time.Now()}
+}
+
+// Stop ends tracking a job and returns what it used. ok is false if the
+// job wasn't being tracked.
+func (t *Tracker) Stop(jobID string) (usage Usage, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.sampleLocked()
+	job, ok := t.jobs[jobID]
+	if !ok {
+		return Usage{}, false
+	}
+	delete(t.jobs, jobID)
+	return Usage{
+		Joules:   job.joules,
+		Elapsed:  time.Since(job.started),
+		Measured: job.source != SourceNone,
+	}, true
+}
+
+// sampleLocked reads the counters with jobs on them and splits what was
+// used since the last read between those jobs. Must hold t.mu.
+func (t *Tracker) sampleLocked() {
+	running := make(map[Source][]*tracked)
+	for _, job := range t.jobs {
+		if job.source != SourceNone {
+			running[job.source] = append(running[job.source], job)
+		}
+	}
+
+	for source, counters := range t.counters {
+		jobs := running[source]
+		var used float64
+		for _, c := range counters {
+			joules, wrap, ok := c.Read()
+			prev := t.last[c]
+			t.last[c] = reading{joules: joules, ok: ok}
+			if !ok || !prev.ok || len(jobs) == 0 {
+				continue
+			}
+			delta := joules - prev.joules
+			if delta < 0 {
+				delta += wrap
+			}
+			if delta > 0 {
+				used += delta
+			}
+		}
+		for _, job := range jobs {
+			job.joules += used / float64(len(jobs))
+		}
+	}
+}
+
+// raplRoot is where Linux exposes Intel/AMD RAPL counters
+var raplRoot = "/sys/class/powercap"
+
+// raplCounter is one CPU package's RAPL energy counter
+type raplCounter struct {
+	dir string
+}
+
+// raplCounters finds the readable package counters, e.g. intel-rapl:0.
+// Subzones like intel-rapl:0:0 are already counted in their package.
+func raplCounters() []Counter {
+	dirs, _ := filepath.Glob(filepath.Join(raplRoot, "intel-rapl:*"))
+	var counters []Counter
+	for _, dir := range dirs {
+		if strings.Count(filepath.Base(dir), ":") != 1 {
+			continue
+		}
+		c := raplCounter{dir: dir}
+		if _, _, ok := c.Read(); ok {
+			counters = append(counters, c)
+		}
+	}
+	return counters
+}
+
+func (c raplCounter) Read() (joules, wrap float64, ok bool) {
+	uj, err := readMicrojoules(filepath.Join(c.dir, "energy_uj"))
+	if err != nil {
+		return 0, 0, false
+	}
+	rangeUJ, _ := readMicrojoules(filepath.Join(c.dir, "max_energy_range_uj"))
+	return uj / 1e6, rangeUJ / 1e6, true
+}
+
+func readMicrojoules(path string) (float64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(strings.TrimSpace(string(data)), 64)
+}
+
+// nvidiaCounter reads the energy NVIDIA GPUs have used since the driver
+// loaded (Volta and newer)
+type nvidiaCounter struct{}
+
+func nvidiaAvailable() bool {
+	if _, err := exec.LookPath("nvidia-smi"); err != nil {
+		return false
+	}
+	_, _, ok := nvidiaCounter{}.Read()
+	return ok
+}
+
+func (nvidiaCounter) Read() (joules, wrap float64, ok bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "nvidia-smi", "--query-gpu=total_energy_consumption", "--format=csv,noheader,nounits").Output()
+	if err != nil {
+		return 0, 0, false
+	}
+	// One line per GPU, in millijoules
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		mj, err := strconv.ParseFloat(strings.TrimSpace(line), 64)
+		if err != nil {
+			return 0, 0, false
+		}
+		joules += mj / 1000
+	}
+	return joules, 0, true
+}
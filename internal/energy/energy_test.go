@@ -0,0 +1,104 @@
+package energy
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeCounter is a counter the test advances by hand
+type fakeCounter struct {
+	joules, wrap float64
+}
+
+func (c *fakeCounter) Read() (float64, float64, bool) {
+	return c.joules, c.wrap, true
+}
+
+func TestTrackerSplitsSharedCounter(t *testing.T) {
+	cpu := &fakeCounter{joules: 1000}
+	tracker := newTracker(map[Source][]Counter{SourceCPU: {cpu}})
+
+	tracker.Start("a", SourceCPU)
+	cpu.joules += 100 // a alone
+	tracker.Start("b", SourceCPU)
+	cpu.joules += 200 // a and b together
+	tracker.Start("c", SourceNone)
+
+	a, ok := tracker.Stop("a")
+	if !ok || !a.Measured || a.Joules != 200 {
+		t.Errorf("a = %+v, want 100 J alone plus half of 200 J", a)
+	}
+	cpu.joules += 50 // b alone
+	b, _ := tracker.Stop("b")
+	if b.Joules != 150 {
+		t.Errorf("b = %+v, want half of 200 J plus 50 J", b)
+	}
+
+	c, _ := tracker.Stop("c")
+	if c.Measured || c.Joules != 0 {
+		t.Errorf("c = %+v, want unmeasured", c)
+	}
+	if _, ok := tracker.Stop("c"); ok {
+		t.Error("expected a stopped job to be untracked")
+	}
+}
+
+func TestTrackerCounterWrap(t *testing.T) {
+	cpu := &fakeCounter{joules: 990, wrap: 1000}
+	tracker := newTracker(map[Source][]Counter{SourceCPU: {cpu}})
+
+	tracker.Start("a", SourceCPU)
+	cpu.joules = 15 // Wrapped past 1000
+	if usage, _ := tracker.Stop("a"); usage.Joules != 25 {
+		t.Errorf("expected 25 J across the wrap, got %v", usage.Joules)
+	}
+}
+
+func TestTrackerWithoutCounterFallsBackToModel(t *testing.T) {
+	tracker := newTracker(nil)
+	tracker.Start("a", SourceGPU)
+	usage, _ := tracker.Stop("a")
+	if usage.Measured {
+		t.Fatal("expected an unmeasured job without a GPU counter")
+	}
+
+	usage.Elapsed = 30 * time.Minute
+	if kwh := usage.KWh(120); math.Abs(kwh-0.06) > 1e-9 {
+		t.Errorf("expected 120 W for half an hour to be 0.06 kWh, got %v", kwh)
+	}
+	if kwh := (Usage{Joules: 7.2e6, Measured: true}).KWh(120); kwh != 2 {
+		t.Errorf("expected measured 7.2 MJ to be 2 kWh, got %v", kwh)
+	}
+}
+
+func TestRAPLCounters(t *testing.T) {
+	root := t.TempDir()
+	old := raplRoot
+	raplRoot = root
+	t.Cleanup(func() { raplRoot = old })
+
+	write := func(zone, name, value string) {
+		dir := filepath.Join(root, zone)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(value+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("intel-rapl:0", "energy_uj", "5000000")
+	write("intel-rapl:0", "max_energy_range_uj", "262143328850")
+	write("intel-rapl:0:0", "energy_uj", "1000000") // Core subzone, part of package 0
+
+	counters := raplCounters()
+	if len(counters) != 1 {
+		t.Fatalf("expected the package counter only, got %d", len(counters))
+	}
+	joules, wrap, ok := counters[0].Read()
+	if !ok || joules != 5 || wrap != 262143.32885 {
+		t.Errorf("Read() = %v, %v, %v", joules, wrap, ok)
+	}
+}
@@ -0,0 +1,115 @@
+package ffmpeg
+
+import (
+	"fmt"
+	"sort"
+)
+
+// BudgetTarget is the size one file is encoded to so a batch fits a budget
+type BudgetTarget struct {
+	Path       string `json:"path"`
+	InputSize  int64  `json:"input_size"`
+	Estimate   int64  `json:"estimate"`    // Expected size at the preset's normal quality
+	TargetSize int64  `json:"target_size"` // Size the file is encoded to, in whole MiB
+}
+
+// BudgetPlan splits a total size budget across a batch of files
+type BudgetPlan struct {
+	Budget    int64          `json:"budget"`
+	Estimate  *BatchEstimate `json:"estimate"` // The batch at the preset's normal quality
+	Targets   []BudgetTarget `json:"targets"`
+	Kept      []string       `json:"kept"`       // Files the preset skips or that can't be estimated, counted at their current size
+	KeptSize  int64          `json:"kept_size"`  // Combined size of Kept
+	TotalSize int64          `json:"total_size"` // Planned size of the whole batch: targets plus kept files
+}
+
+// PlanBudget allocates budget bytes across probes for a batch encode with
+// preset. Files the preset would skip, and files without the duration or
+// bitrate needed to estimate them, keep their size. The rest of the budget
+// is shared in proportion to each file's estimated output, so complex or
+// long titles get more than simple or short ones, and no file is given
+// more than its source size. Returns an error if the budget can't fit the
+// kept files, or leaves some file below the minimum bitrate.
+func PlanBudget(probes []*ProbeResult, preset *Preset, budget int64) (*BudgetPlan, error) {
+	plan := &BudgetPlan{
+		Budget:   budget,
+		Estimate: EstimateMultiple(probes, preset),
+		Targets:  []BudgetTarget{},
+		Kept:     []string{},
+	}
+
+	for _, probe := range probes {
+		if probe == nil {
+			continue
+		}
+		var est *Estimate
+		if !WouldSkip(probe, preset) {
+			est = EstimateTranscode(probe, preset)
+		}
+		if est == nil {
+			plan.Kept = append(plan.Kept, probe.Path)
+			plan.KeptSize += probe.Size
+			continue
+		}
+		plan.Targets = append(plan.Targets, BudgetTarget{
+			Path:      probe.Path,
+			InputSize: probe.Size,
+			Estimate:  (est.MinSize + est.MaxSize) / 2,
+		})
+	}
+
+	available := budget - plan.KeptSize
+	if available <= 0 && len(plan.Targets) > 0 {
+		return nil, fmt.Errorf("budget of %s doesn't fit the %d files kept as they are (%s)",
+			FormatBytes(budget), len(plan.Kept), FormatBytes(plan.KeptSize))
+	}
+	allocate(plan.Targets, available)
+
+	byPath := make(map[string]*ProbeResult, len(probes))
+	for _, probe := range probes {
+		if probe != nil {
+			byPath[probe.Path] = probe
+		}
+	}
+	plan.TotalSize = plan.KeptSize
+	for _, target := range plan.Targets {
+		probe := byPath[target.Path]
+		if TargetVideoBitrate(target.TargetSize, probe.Duration, AudioBitrate(probe.AudioTracks)) == 0 {
+			return nil, fmt.Errorf("budget of %s is too small: %s would get %s, below the minimum bitrate",
+				FormatBytes(budget), target.Path, FormatBytes(target.TargetSize))
+		}
+		plan.TotalSize += target.TargetSize
+	}
+	return plan, nil
+}
+
+// allocate shares available bytes across targets in proportion to their
+// estimates, capping each at its input size and sharing what the capped
+// ones don't use among the rest. Targets are whole MiB, as jobs take them.
+func allocate(targets []BudgetTarget, available int64) {
+	order := make([]int, len(targets))
+	for i := range order {
+		order[i] = i
+	}
+	// Visit the files most likely to hit their cap first: the ones with the
+	// largest estimate relative to their source
+	sort.Slice(order, func(a, b int) bool {
+		ta, tb := targets[order[a]], targets[order[b]]
+		return float64(ta.Estimate)*float64(tb.InputSize) > float64(tb.Estimate)*float64(ta.InputSize)
+	})
+
+	var weight int64
+	for _, t := range targets {
+		weight += t.Estimate
+	}
+	for _, i := range order {
+		t := &targets[i]
+		if weight <= 0 {
+			break
+		}
+		share := int64(float64(available) * float64(t.Estimate) / float64(weight))
+		t.TargetSize = min(share, t.InputSize) &^ (1<<20 - 1)
+		available -= t.TargetSize
+		weight -= t.Estimate
+	}
+}
@@ -0,0 +1,81 @@
+package ffmpeg
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlanBudget(t *testing.T) {
+	preset := &Preset{ID: "compress-hevc", Codec: CodecHEVC}
+	video := func(path string, minutes int, bitrate int64) *ProbeResult {
+		duration := time.Duration(minutes) * time.Minute
+		return &ProbeResult{
+			Path:     path,
+			Size:     int64(duration.Seconds() * float64(bitrate) / 8),
+			Duration: duration,
+			Bitrate:  bitrate,
+			Height:   1080,
+			Streams:  []ProbeStream{{Type: "video", Codec: "h264"}},
+		}
+	}
+	movie := video("/media/movie.mkv", 120, 10_000_000)   // ~8.4 GiB
+	episode := video("/media/episode.mkv", 40, 5_000_000) // ~1.4 GiB
+	hevc := video("/media/done.mkv", 60, 4_000_000)
+	hevc.IsHEVC = true
+
+	budget := int64(4 << 30)
+	plan, err := PlanBudget([]*ProbeResult{movie, episode, hevc}, preset, budget)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Kept) != 1 || plan.Kept[0] != hevc.Path || plan.KeptSize != hevc.Size {
+		t.Errorf("expected the HEVC file to be kept as is, got %v (%d bytes)", plan.Kept, plan.KeptSize)
+	}
+	if len(plan.Targets) != 2 {
+		t.Fatalf("expected 2 targets, got %d", len(plan.Targets))
+	}
+	if plan.TotalSize > budget {
+		t.Errorf("plan totals %d, over the %d budget", plan.TotalSize, budget)
+	}
+	movieTarget, episodeTarget := plan.Targets[0].TargetSize, plan.Targets[1].TargetSize
+	if movieTarget <= episodeTarget {
+		t.Errorf("expected the movie to get more than the episode, got %d and %d", movieTarget, episodeTarget)
+	}
+	if movieTarget%(1<<20) != 0 || episodeTarget%(1<<20) != 0 {
+		t.Errorf("expected whole MiB targets, got %d and %d", movieTarget, episodeTarget)
+	}
+
+	// A generous budget never targets more than a file's source size
+	plan, err = PlanBudget([]*ProbeResult{movie, episode}, preset, 1<<40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, target := range plan.Targets {
+		if target.TargetSize > target.InputSize {
+			t.Errorf("%s: target %d exceeds source size %d", target.Path, target.TargetSize, target.InputSize)
+		}
+	}
+
+	if _, err := PlanBudget([]*ProbeResult{movie, hevc}, preset, hevc.Size); err == nil || !strings.Contains(err.Error(), "kept") {
+		t.Errorf("expected an error when kept files use the whole budget, got %v", err)
+	}
+	if _, err := PlanBudget([]*ProbeResult{movie}, preset, 100<<20); err == nil || !strings.Contains(err.Error(), "minimum bitrate") {
+		t.Errorf("expected an error for a budget below the minimum bitrate, got %v", err)
+	}
+}
+
+func TestAllocateRedistributesCappedShares(t *testing.T) {
+	targets := []BudgetTarget{
+		{Path: "small", InputSize: 100 << 20, Estimate: 90 << 20},
+		{Path: "large", InputSize: 10 << 30, Estimate: 900 << 20},
+	}
+	// Proportional shares would give "small" ~181 MiB, over its source size
+	allocate(targets, 2000<<20)
+	if targets[0].TargetSize != 100<<20 {
+		t.Errorf("small: got %d, want its source size", targets[0].TargetSize)
+	}
+	if targets[1].TargetSize != 1900<<20 {
+		t.Errorf("large: got %d MiB, want the remaining 1900 MiB", targets[1].TargetSize>>20)
+	}
+}
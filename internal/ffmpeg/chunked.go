@@ -0,0 +1,223 @@
+package ffmpeg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Share of a chunked encode's progress given to splitting the video and to
+// muxing the encoded segments; encoding gets the rest
+const (
+	chunkSplitPercent = 5.0
+	chunkMuxPercent   = 5.0
+)
+
+// SupportsChunking reports whether preset can be encoded as parallel
+// segments. Size-targeted encodes need rate control over the whole file,
+// and stream copies have nothing to encode.
+func SupportsChunking(preset *Preset) bool {
+	return preset.Codec != CodecCopy && preset.TargetBitrate == 0
+}
+
+// transcodeChunked encodes inputPath's main video stream as segments, up to
+// chunks of them at a time, and muxes the result with the source's other
+// streams into outputPath. The video is first split by stream copy, so
+// every segment starts on a keyframe and they join without gaps.
+// inputArgs and outputArgs are those of the single encode (see
+// BuildPresetArgs); the segments are kept in a directory next to
+// outputPath, removed when done.
+func (t *Transcoder) transcodeChunked(ctx context.Context, inputArgs []string, inputPath string, outputArgs []string, outputPath string, chunks int, duration time.Duration, report func(Progress)) error {
+	if duration <= 0 {
+		return fmt.Errorf("a chunked encode needs the video's duration, which is unknown")
+	}
+	workDir := outputPath + ".chunks"
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		return fmt.Errorf("failed to create chunk directory: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	// Split at the first keyframe after each segment_time boundary
+	splitArgs := append(inputFormatArgs(inputPath),
+		"-i", inputPath,
+		"-y",
+		"-progress", "pipe:1",
+		"-map", "0:v:0",
+		"-c", "copy",
+		"-f", "segment",
+		"-segment_time", fmt.Sprintf("%.3f", duration.Seconds()/float64(chunks)),
+		"-segment_format", "matroska",
+		"-reset_timestamps", "1",
+		filepath.Join(workDir, "source%03d.mkv"),
+	)
+	if err := t.runFFmpeg(ctx, splitArgs, duration, func(p Progress) {
+		report(Progress{Percent: p.Percent * chunkSplitPercent / 100})
+	}); err != nil {
+		return err
+	}
+	sources, _ := filepath.Glob(filepath.Join(workDir, "source*.mkv"))
+	if len(sources) == 0 {
+		return fmt.Errorf("splitting the video produced no segments")
+	}
+	sort.Strings(sources)
+	transcodeLog.Info("Chunked encode", "segments", len(sources), "parallel", chunks)
+
+	encoded, err := t.encodeChunks(ctx, inputArgs, chunkEncodeArgs(outputArgs), sources, chunks, duration, report)
+	if err != nil {
+		return err
+	}
+
+	// Join the encoded segments and take everything else from the source
+	list := filepath.Join(workDir, "segments.txt")
+	var entries strings.Builder
+	for _, path := range encoded {
+		fmt.Fprintf(&entries, "file '%s'\n", filepath.Base(path))
+	}
+	if err := os.WriteFile(list, []byte(entries.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write segment list: %w", err)
+	}
+	muxArgs := []string{"-f", "concat", "-safe", "0", "-i", list}
+	muxArgs = append(muxArgs, inputFormatArgs(inputPath)...)
+	muxArgs = append(muxArgs, "-i", inputPath, "-y", "-progress", "pipe:1")
+	muxArgs = append(muxArgs, chunkMuxArgs(outputArgs)...)
+	muxArgs = append(muxArgs, outputPath)
+	return t.runFFmpeg(ctx, muxArgs, duration, func(p Progress) {
+		report(Progress{Percent: 100 - chunkMuxPercent + p.Percent*chunkMuxPercent/100})
+	})
+}
+
+// encodeChunks encodes sources, up to parallel at a time, reporting their
+// combined progress. The first failure stops the rest.
+func (t *Transcoder) encodeChunks(ctx context.Context, inputArgs, encodeArgs, sources []string, parallel int, duration time.Duration, report func(Progress)) ([]string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu       sync.Mutex
+		times    = make([]time.Duration, len(sources))
+		speeds   = make([]float64, len(sources))
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	encoded := make([]string, len(sources))
+	slots := make(chan struct{}, parallel)
+	for i, source := range sources {
+		encoded[i] = filepath.Join(filepath.Dir(source), fmt.Sprintf("encoded%03d.mkv", i))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-slots }()
+			if ctx.Err() != nil {
+				return
+			}
+
+			args := append(append([]string{}, inputArgs...), "-i", source, "-y", "-progress", "pipe:1")
+			args = append(args, encodeArgs...)
+			args = append(args, encoded[i])
+			err := t.runFFmpeg(ctx, args, duration, func(p Progress) {
+				mu.Lock()
+				defer mu.Unlock()
+				times[i], speeds[i] = p.Time, p.Speed
+				report(chunkProgress(times, speeds, duration))
+			})
+
+			mu.Lock()
+			defer mu.Unlock()
+			speeds[i] = 0
+			if err != nil && firstErr == nil {
+				firstErr = err
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return encoded, nil
+}
+
+// chunkProgress combines the positions and speeds of the segment encodes
+// into the job's progress
+func chunkProgress(times []time.Duration, speeds []float64, duration time.Duration) Progress {
+	var p Progress
+	for i := range times {
+		p.Time += times[i]
+		p.Speed += speeds[i]
+	}
+	p.Percent = min(float64(p.Time)/float64(duration), 1)*(100-chunkSplitPercent-chunkMuxPercent) + chunkSplitPercent
+	if p.Speed > 0 && p.Time < duration {
+		p.ETA = time.Duration(float64(duration-p.Time) / p.Speed)
+	}
+	return p
+}
+
+// chunkEncodeArgs turns a single encode's output args into a segment's:
+// only the main video stream, and none of the muxing options, which the
+// final mux applies (see chunkMuxArgs)
+func chunkEncodeArgs(outputArgs []string) []string {
+	var args []string
+	for i := 0; i < len(outputArgs); i++ {
+		switch outputArgs[i] {
+		case "-map":
+			if i+1 < len(outputArgs) && outputArgs[i+1] == "0:v:0" {
+				args = append(args, outputArgs[i], outputArgs[i+1])
+			}
+			i++
+		case "-map_chapters", "-c:s", "-c:t", "-tag:v:0", "-movflags", "-f":
+			i++
+		case "-sn":
+		default:
+			args = append(args, outputArgs[i])
+		}
+	}
+	return append(args, "-f", "matroska")
+}
+
+// chunkMuxArgs turns a single encode's output args into those of the final
+// mux of a chunked encode: the joined video is input 0 and the source
+// input 1, whose other streams, chapters and metadata are copied with the
+// single encode's subtitle and container handling
+func chunkMuxArgs(outputArgs []string) []string {
+	args := []string{"-map_metadata", "1", "-c", "copy"}
+	for i := 0; i < len(outputArgs); i++ {
+		arg := outputArgs[i]
+		if arg == "-sn" {
+			args = append(args, arg)
+			continue
+		}
+		if i+1 == len(outputArgs) {
+			break
+		}
+		switch arg {
+		case "-map":
+			stream := outputArgs[i+1]
+			if stream != "0:v:0" {
+				stream = "1" + strings.TrimPrefix(stream, "0")
+			}
+			args = append(args, arg, stream)
+			i++
+		case "-map_chapters":
+			args = append(args, arg, "1")
+			i++
+		case "-c:s", "-tag:v:0", "-movflags", "-f":
+			args = append(args, arg, outputArgs[i+1])
+			i++
+		}
+	}
+	return args
+}
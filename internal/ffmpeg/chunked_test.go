@@ -0,0 +1,118 @@
+package ffmpeg
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChunkArgs(t *testing.T) {
+	hevc := &Preset{ID: "compress-hevc", Encoder: HWAccelNone, Codec: CodecHEVC, Container: ContainerMP4}
+	_, outputArgs := BuildPresetArgs(hevc, 0, []string{"subrip", "hdmv_pgs_subtitle"}, "convert", 8, "yuv420p", "h264", 0, 0)
+
+	encode := strings.Join(chunkEncodeArgs(outputArgs), " ")
+	if !strings.Contains(encode, "-map 0:v:0") || !strings.Contains(encode, "-c:v:0 libx265") {
+		t.Errorf("segment encode lost the video encode: %s", encode)
+	}
+	for _, arg := range []string{"0:a?", "0:s:0", "-map_chapters", "-movflags", "mov_text", "hvc1"} {
+		if strings.Contains(encode, arg) {
+			t.Errorf("segment encode has muxing option %s: %s", arg, encode)
+		}
+	}
+	if !strings.HasSuffix(encode, "-f matroska") {
+		t.Errorf("segment encode should write MKV: %s", encode)
+	}
+
+	mux := strings.Join(chunkMuxArgs(outputArgs), " ")
+	for _, arg := range []string{"-map 0:v:0", "-map 1:v:1?", "-map 1:a?", "-map 1:s:0", "-map_chapters 1", "-c copy", "-c:s mov_text", "-tag:v:0 hvc1", "-f mp4"} {
+		if !strings.Contains(mux, arg) {
+			t.Errorf("final mux is missing %s: %s", arg, mux)
+		}
+	}
+	if strings.Contains(mux, "libx265") {
+		t.Errorf("final mux re-encodes: %s", mux)
+	}
+
+	if SupportsChunking(&Preset{Codec: CodecHEVC, TargetBitrate: 4_000_000}) {
+		t.Error("size-targeted encodes shouldn't be chunked")
+	}
+	if SupportsChunking(&Preset{Codec: CodecCopy}) {
+		t.Error("stream copies shouldn't be chunked")
+	}
+}
+
+func TestChunkProgress(t *testing.T) {
+	p := chunkProgress([]time.Duration{30 * time.Second, 30 * time.Second, 0}, []float64{1, 2, 0}, 2*time.Minute)
+	if p.Percent != 50 {
+		t.Errorf("Percent = %v, want 50 (halfway through the encoding share)", p.Percent)
+	}
+	if p.Speed != 3 || p.ETA != 20*time.Second {
+		t.Errorf("Speed = %v, ETA = %v, want the combined 3x and 20s", p.Speed, p.ETA)
+	}
+}
+
+func TestTranscodeChunked(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in.mkv")
+	output := filepath.Join(dir, "out.mkv")
+	calls := filepath.Join(dir, "calls")
+	if err := os.WriteFile(input, []byte("source"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Records each invocation; the split leaves three segments next to its
+	// output pattern, the rest write their last argument (the output)
+	ffmpegPath := filepath.Join(dir, "ffmpeg")
+	writeScript(t, ffmpegPath, `echo "$@" >> `+calls+`
+for last; do :; done
+case "$*" in
+*"-f segment"*)
+	for i in 000 001 002; do echo video > "$(dirname "$last")/source$i.mkv"; done ;;
+*) echo encoded > "$last" ;;
+esac
+echo out_time_us=30000000
+echo progress=continue
+`)
+
+	preset := &Preset{ID: "compress-hevc", Encoder: HWAccelNone, Codec: CodecHEVC, Chunks: 2}
+	progressCh := make(chan Progress, 20)
+	result, err := NewTranscoder(ffmpegPath).Transcode(context.Background(), input, output, preset, time.Minute,
+		0, nil, "convert", 8, "yuv420p", "h264", 0, 0, nil, HDRHandlingPreserve, progressCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.OutputSize == 0 {
+		t.Error("expected muxed output")
+	}
+	for p := range progressCh {
+		if p.Percent > 100 {
+			t.Errorf("progress went past 100%%: %v", p.Percent)
+		}
+	}
+
+	data, err := os.ReadFile(calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("expected a split, 3 segment encodes and a mux, got %d runs", len(lines))
+	}
+	encodes := 0
+	for _, line := range lines[1:4] {
+		if strings.Contains(line, "libx265") && strings.Contains(line, ".chunks/source") {
+			encodes++
+		}
+	}
+	if encodes != 3 {
+		t.Errorf("expected each segment encoded once:\n%s", strings.Join(lines[1:4], "\n"))
+	}
+	if mux := lines[4]; !strings.Contains(mux, "-f concat") || !strings.Contains(mux, "-map 1:a?") || !strings.HasSuffix(mux, output) {
+		t.Errorf("last run isn't the final mux: %s", mux)
+	}
+	if _, err := os.Stat(output + ".chunks"); !os.IsNotExist(err) {
+		t.Error("chunk directory left behind")
+	}
+}
@@ -0,0 +1,325 @@
+package ffmpeg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/logger"
+)
+
+var crfsearchLog = logger.For("crfsearch")
+
+// Defaults for the sampled quality search
+const (
+	defaultSampleCount    = 3
+	defaultSampleDuration = 10 * time.Second
+	defaultTargetSSIM     = 0.98
+	qualitySearchStep     = 2 // Distance between candidate CRF values
+	qualitySearchSpread   = 2 // Candidates on each side of the encoder default
+)
+
+// QualitySearchOptions controls how SearchQuality picks a quality value
+type QualitySearchOptions struct {
+	SampleCount    int           // Number of samples spread across the file
+	SampleDuration time.Duration // Length of each sample
+	TargetSSIM     float64       // Minimum mean SSIM (0-1) the chosen value must reach
+	TargetSavings  float64       // If > 0, pick the best quality that saves at least this fraction (0-1) instead
+	TempDir        string        // Where sample encodes are written
+
+	// SourceVideoBitrate is the bitrate of the source's video stream (see
+	// SourceVideoBitrate), which the video-only samples are compared with.
+	// 0 compares them with the whole file, audio included.
+	SourceVideoBitrate int64
+}
+
+// QualitySample is the measured outcome of encoding the samples at one quality value
+type QualitySample struct {
+	Quality   int     `json:"quality"`
+	SSIM      float64 `json:"ssim"`       // Mean SSIM across samples
+	SizeRatio float64 `json:"size_ratio"` // Encoded size / source video size for the sampled spans
+}
+
+// QualitySearchResult is the outcome of SearchQuality
+type QualitySearchResult struct {
+	Quality  int             `json:"quality"`  // Chosen CRF/CQ/QP value
+	Samples  []QualitySample `json:"samples"`  // Measurements for every candidate tried
+	Duration time.Duration   `json:"duration"` // Time spent searching
+}
+
+var ssimAllRegex = regexp.MustCompile(`All:([0-9.]+)`)
+
+// CanSearchQuality reports whether the preset's encoder takes a constant
+// quality value (CRF, CQ, QP). Bitrate-driven encoders (VideoToolbox) and
+// size-targeted encodes can't be searched, and remuxes don't encode.
+func CanSearchQuality(preset *Preset) bool {
+	if preset.TargetBitrate > 0 || preset.Codec == CodecCopy {
+		return false
+	}
+	config, ok := encoderConfigs[EncoderKey{preset.Encoder, preset.Codec}]
+	if !ok {
+		config = encoderConfigs[EncoderKey{HWAccelNone, preset.Codec}]
+	}
+	return !config.usesBitrate
+}
+
+// qualityCandidates returns CRF values around center, ordered best quality first
+func qualityCandidates(center int, codec Codec) []int {
+	maxQuality := 51
+	if codec == CodecAV1 {
+		maxQuality = 63
+	}
+
+	var candidates []int
+	for i := -qualitySearchSpread; i <= qualitySearchSpread; i++ {
+		q := center + i*qualitySearchStep
+		if q >= 1 && q <= maxQuality {
+			candidates = append(candidates, q)
+		}
+	}
+	return candidates
+}
+
+// sampleOffsets spreads count samples of length across duration, avoiding the
+// very start and end (intros and credits are rarely representative).
+func sampleOffsets(duration, length time.Duration, count int) []time.Duration {
+	if duration <= length*time.Duration(count) {
+		return []time.Duration{0}
+	}
+
+	offsets := make([]time.Duration, count)
+	for i := range offsets {
+		// Centre each sample in its slice of the file
+		center := duration * time.Duration(2*i+1) / time.Duration(2*count)
+		offsets[i] = center - length/2
+	}
+	return offsets
+}
+
+// pickQuality chooses a value from measured samples. In savings mode it picks the
+// best quality that still meets the savings target; otherwise the most compressed
+// value that stays above the SSIM target. If nothing qualifies it falls back to
+// the closest candidate.
+func pickQuality(samples []QualitySample, opts QualitySearchOptions) int {
+	sorted := append([]QualitySample(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Quality < sorted[j].Quality })
+
+	if opts.TargetSavings > 0 {
+		for _, s := range sorted {
+			if 1-s.SizeRatio >= opts.TargetSavings {
+				return s.Quality
+			}
+		}
+		return sorted[len(sorted)-1].Quality
+	}
+
+	for i := len(sorted) - 1; i >= 0; i-- {
+		if sorted[i].SSIM >= opts.TargetSSIM {
+			return sorted[i].Quality
+		}
+	}
+	return sorted[0].Quality
+}
+
+// parseSSIM extracts the overall SSIM score from ffmpeg's ssim filter output
+func parseSSIM(stderr string) (float64, bool) {
+	matches := ssimAllRegex.FindAllStringSubmatch(stderr, -1)
+	if len(matches) == 0 {
+		return 0, false
+	}
+	// The summary line is printed last
+	v, err := strconv.ParseFloat(matches[len(matches)-1][1], 64)
+	if err != nil {
+		return 0, false
+	}
+	return v, true
+}
+
+// defaultQuality returns the quality value the preset would use without a search
+func defaultQuality(preset *Preset, qualityHEVC, qualityAV1 int) int {
+	if preset.Codec == CodecHEVC && qualityHEVC > 0 {
+		return qualityHEVC
+	}
+	if preset.Codec == CodecAV1 && qualityAV1 > 0 {
+		return qualityAV1
+	}
+	config, ok := encoderConfigs[EncoderKey{preset.Encoder, preset.Codec}]
+	if !ok {
+		config = encoderConfigs[EncoderKey{HWAccelNone, preset.Codec}]
+	}
+	q, _ := strconv.Atoi(config.quality)
+	return q
+}
+
+// SearchQuality encodes a few short samples of the source at several quality
+// values, measures their size and SSIM against the original, and returns the
+// value that best meets the target. The full encode should then be run with
+// the result passed as the quality override.
+func (t *Transcoder) SearchQuality(
+	ctx context.Context,
+	inputPath string,
+	preset *Preset,
+	duration time.Duration,
+	inputSize int64,
+	bitDepth int,
+	pixFmt string,
+	videoCodec string,
+	qualityHEVC int,
+	qualityAV1 int,
+	opts QualitySearchOptions,
+) (*QualitySearchResult, error) {
+	if !CanSearchQuality(preset) {
+		return nil, fmt.Errorf("encoder %s does not support constant quality", preset.Encoder)
+	}
+	if duration <= 0 || inputSize <= 0 {
+		return nil, fmt.Errorf("source duration and size are required for a quality search")
+	}
+	if opts.SampleCount <= 0 {
+		opts.SampleCount = defaultSampleCount
+	}
+	if opts.SampleDuration <= 0 {
+		opts.SampleDuration = defaultSampleDuration
+	}
+	if opts.TargetSSIM <= 0 {
+		opts.TargetSSIM = defaultTargetSSIM
+	}
+
+	startTime := time.Now()
+
+	workDir, err := os.MkdirTemp(opts.TempDir, "shrinkray-crf-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sample directory: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	offsets := sampleOffsets(duration, opts.SampleDuration, opts.SampleCount)
+	sampleLength := opts.SampleDuration
+	if sampleLength > duration {
+		sampleLength = duration
+	}
+
+	sourceBytes := sampledSourceBytes(inputSize, duration, sampleLength*time.Duration(len(offsets)), opts.SourceVideoBitrate)
+
+	candidates := qualityCandidates(defaultQuality(preset, qualityHEVC, qualityAV1), preset.Codec)
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no valid quality values to search for %s", preset.Codec)
+	}
+
+	result := &QualitySearchResult{}
+	for _, quality := range candidates {
+		var totalSize int64
+		var totalSSIM float64
+		for i, offset := range offsets {
+			samplePath := filepath.Join(workDir, fmt.Sprintf("q%d_%d.mkv", quality, i))
+			size, err := t.encodeSample(ctx, inputPath, samplePath, preset, offset, sampleLength, bitDepth, pixFmt, videoCodec, quality)
+			if err != nil {
+				return nil, err
+			}
+			ssim, err := t.measureSSIM(ctx, inputPath, samplePath, offset, sampleLength)
+			if err != nil {
+				return nil, err
+			}
+			os.Remove(samplePath)
+			totalSize += size
+			totalSSIM += ssim
+		}
+
+		sample := QualitySample{
+			Quality:   quality,
+			SSIM:      totalSSIM / float64(len(offsets)),
+			SizeRatio: float64(totalSize) / sourceBytes,
+		}
+		crfsearchLog.Info("Sampled quality", "file", filepath.Base(inputPath), "quality", quality,
+			"ssim", fmt.Sprintf("%.4f", sample.SSIM), "size", fmt.Sprintf("%.0f%%", sample.SizeRatio*100))
+		result.Samples = append(result.Samples, sample)
+	}
+
+	result.Quality = pickQuality(result.Samples, opts)
+	result.Duration = time.Since(startTime)
+	return result, nil
+}
+
+// sampledSourceBytes approximates the source video bytes covered by the
+// samples, assuming a constant bitrate. The samples are encoded without
+// audio, so they're compared with the video stream's bitrate when known.
+func sampledSourceBytes(inputSize int64, duration, sampled time.Duration, videoBitrate int64) float64 {
+	if videoBitrate > 0 {
+		return float64(videoBitrate) / 8 * sampled.Seconds()
+	}
+	return float64(inputSize) * float64(sampled) / float64(duration)
+}
+
+// encodeSample encodes length of the first video stream starting at offset
+func (t *Transcoder) encodeSample(
+	ctx context.Context,
+	inputPath, samplePath string,
+	preset *Preset,
+	offset, length time.Duration,
+	bitDepth int,
+	pixFmt, videoCodec string,
+	quality int,
+) (int64, error) {
+	inputArgs, outputArgs := BuildPresetArgs(preset, 0, nil, string(SubtitleHandlingDrop), bitDepth, pixFmt, videoCodec, quality, quality)
+
+	args := append([]string{}, inputArgs...)
+	args = append(args,
+		"-ss", formatSeconds(offset),
+		"-t", formatSeconds(length),
+		"-i", inputPath,
+		"-y",
+	)
+	args = append(args, outputArgs...)
+	args = append(args, "-an", "-sn", "-dn", "-f", "matroska", samplePath)
+
+	cmd := exec.CommandContext(ctx, t.ffmpegPath, args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return 0, fmt.Errorf("sample encode at quality %d failed: %w: %s", quality, err, lastLine(string(output)))
+	}
+
+	info, err := os.Stat(samplePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat sample: %w", err)
+	}
+	return info.Size(), nil
+}
+
+// measureSSIM compares a sample against the same span of the source. The
+// reference is scaled to the sample's size so downscaling presets compare fairly.
+func (t *Transcoder) measureSSIM(ctx context.Context, inputPath, samplePath string, offset, length time.Duration) (float64, error) {
+	cmd := exec.CommandContext(ctx, t.ffmpegPath,
+		"-i", samplePath,
+		"-ss", formatSeconds(offset),
+		"-t", formatSeconds(length),
+		"-i", inputPath,
+		"-lavfi", "[1:v:0][0:v:0]scale2ref[ref][dist];[dist][ref]ssim",
+		"-f", "null", "-",
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return 0, fmt.Errorf("ssim measurement failed: %w: %s", err, lastLine(string(output)))
+	}
+
+	ssim, ok := parseSSIM(string(output))
+	if !ok {
+		return 0, fmt.Errorf("ssim measurement produced no score")
+	}
+	return ssim, nil
+}
+
+// formatSeconds formats a duration for ffmpeg's -ss/-t options
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
+
+// lastLine returns the last non-empty line of ffmpeg output for error messages
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
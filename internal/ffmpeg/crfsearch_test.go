@@ -0,0 +1,104 @@
+package ffmpeg
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQualityCandidates(t *testing.T) {
+	got := qualityCandidates(26, CodecHEVC)
+	want := []int{22, 24, 26, 28, 30}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("expected %v, got %v", want, got)
+		}
+	}
+
+	// Clamped to the codec's range
+	if got := qualityCandidates(50, CodecHEVC); got[len(got)-1] != 50 {
+		t.Errorf("expected HEVC candidates capped at 51, got %v", got)
+	}
+	if got := qualityCandidates(62, CodecAV1); got[len(got)-1] != 62 {
+		t.Errorf("expected AV1 candidates capped at 63, got %v", got)
+	}
+}
+
+func TestSampleOffsets(t *testing.T) {
+	offsets := sampleOffsets(60*time.Minute, 10*time.Second, 3)
+	if len(offsets) != 3 {
+		t.Fatalf("expected 3 offsets, got %d", len(offsets))
+	}
+	if offsets[0] != 10*time.Minute-5*time.Second || offsets[1] != 30*time.Minute-5*time.Second {
+		t.Errorf("unexpected offsets: %v", offsets)
+	}
+
+	// Short clips are sampled once from the start
+	if offsets := sampleOffsets(20*time.Second, 10*time.Second, 3); len(offsets) != 1 || offsets[0] != 0 {
+		t.Errorf("expected single offset for short file, got %v", offsets)
+	}
+}
+
+func TestSampledSourceBytes(t *testing.T) {
+	// A 1 GB hour-long file, 30 s sampled: 1/120 of it
+	if got := sampledSourceBytes(1_200_000_000, time.Hour, 30*time.Second, 0); got != 10_000_000 {
+		t.Errorf("expected 10 MB of the file, got %.0f", got)
+	}
+	// Its 2 Mb/s video alone, which the samples are encoded from
+	if got := sampledSourceBytes(1_200_000_000, time.Hour, 30*time.Second, 2_000_000); got != 7_500_000 {
+		t.Errorf("expected 7.5 MB of video, got %.0f", got)
+	}
+}
+
+func TestPickQuality(t *testing.T) {
+	samples := []QualitySample{
+		{Quality: 30, SSIM: 0.960, SizeRatio: 0.20},
+		{Quality: 22, SSIM: 0.990, SizeRatio: 0.55},
+		{Quality: 26, SSIM: 0.982, SizeRatio: 0.35},
+		{Quality: 28, SSIM: 0.975, SizeRatio: 0.28},
+	}
+
+	tests := []struct {
+		name string
+		opts QualitySearchOptions
+		want int
+	}{
+		{"ssim target", QualitySearchOptions{TargetSSIM: 0.98}, 26},
+		{"ssim unreachable", QualitySearchOptions{TargetSSIM: 0.999}, 22},
+		{"savings target", QualitySearchOptions{TargetSavings: 0.70}, 28},
+		{"savings unreachable", QualitySearchOptions{TargetSavings: 0.95}, 30},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pickQuality(samples, tt.opts); got != tt.want {
+				t.Errorf("pickQuality = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSSIM(t *testing.T) {
+	stderr := "frame=  240 fps=120 q=-0.0 Lsize=N/A time=00:00:10.00\n" +
+		"[Parsed_ssim_1 @ 0x55d] SSIM Y:0.985421 (18.362) U:0.991002 (20.458) V:0.990117 (20.046) All:0.987402 (18.997)\n"
+
+	got, ok := parseSSIM(stderr)
+	if !ok || got != 0.987402 {
+		t.Errorf("parseSSIM = %v, %v", got, ok)
+	}
+
+	if _, ok := parseSSIM("no score here"); ok {
+		t.Error("expected no score")
+	}
+}
+
+func TestCanSearchQuality(t *testing.T) {
+	if !CanSearchQuality(&Preset{Encoder: HWAccelNone, Codec: CodecHEVC}) {
+		t.Error("expected libx265 to support quality search")
+	}
+	if CanSearchQuality(&Preset{Encoder: HWAccelVideoToolbox, Codec: CodecHEVC}) {
+		t.Error("expected bitrate-based VideoToolbox to be excluded")
+	}
+}
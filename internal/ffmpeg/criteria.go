@@ -0,0 +1,61 @@
+package ffmpeg
+
+import "strings"
+
+// ProbeCriteria selects video files by their probe metadata. It backs both
+// browse filters and rules. Zero fields don't restrict anything.
+type ProbeCriteria struct {
+	Codecs         []string // Keep only these source video codecs (ffprobe names, any case)
+	ExcludeCodecs  []string // Drop these source video codecs
+	MinSize        int64    // Bytes
+	MinHeight      int
+	MaxHeight      int
+	MinBitrateMbps float64 // Overall bitrate, see ProbeResult.OverallBitrate
+	MaxBitrateMbps float64
+}
+
+// Matches reports whether probe meets every criterion. A file that wasn't
+// probed, or whose bitrate isn't known when a bitrate is asked for, doesn't.
+func (c ProbeCriteria) Matches(probe *ProbeResult) bool {
+	if probe == nil {
+		return false
+	}
+	if len(c.Codecs) > 0 && !containsCodec(c.Codecs, probe.VideoCodec) {
+		return false
+	}
+	if containsCodec(c.ExcludeCodecs, probe.VideoCodec) {
+		return false
+	}
+	if c.MinSize > 0 && probe.Size < c.MinSize {
+		return false
+	}
+	if c.MinHeight > 0 && probe.Height < c.MinHeight {
+		return false
+	}
+	if c.MaxHeight > 0 && probe.Height > c.MaxHeight {
+		return false
+	}
+
+	if c.MinBitrateMbps > 0 || c.MaxBitrateMbps > 0 {
+		mbps := float64(probe.OverallBitrate()) / 1_000_000
+		if mbps <= 0 {
+			return false // Can't judge bitrate without it
+		}
+		if c.MinBitrateMbps > 0 && mbps < c.MinBitrateMbps {
+			return false
+		}
+		if c.MaxBitrateMbps > 0 && mbps > c.MaxBitrateMbps {
+			return false
+		}
+	}
+	return true
+}
+
+func containsCodec(codecs []string, codec string) bool {
+	for _, c := range codecs {
+		if strings.EqualFold(c, codec) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,38 @@
+package ffmpeg
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProbeCriteriaMatches(t *testing.T) {
+	// 20 Mbps 4K HEVC; 1080p H.264 at 3 Mbps derived from its size
+	uhd := &ProbeResult{VideoCodec: "hevc", Height: 2160, Bitrate: 20_000_000, Size: 9 << 30}
+	hd := &ProbeResult{VideoCodec: "h264", Height: 1080, Size: 1_350_000_000, Duration: time.Hour}
+	unknownBitrate := &ProbeResult{VideoCodec: "h264", Height: 1080}
+
+	tests := []struct {
+		name     string
+		criteria ProbeCriteria
+		probe    *ProbeResult
+		want     bool
+	}{
+		{"zero", ProbeCriteria{}, hd, true},
+		{"not probed", ProbeCriteria{}, nil, false},
+		{"codec any case", ProbeCriteria{Codecs: []string{"HEVC"}}, uhd, true},
+		{"other codec", ProbeCriteria{Codecs: []string{"hevc", "av1"}}, hd, false},
+		{"excluded codec", ProbeCriteria{ExcludeCodecs: []string{"hevc"}}, uhd, false},
+		{"min size", ProbeCriteria{MinSize: 2 << 30}, hd, false},
+		{"min height", ProbeCriteria{MinHeight: 1081}, uhd, true},
+		{"max height", ProbeCriteria{MaxHeight: 1080}, uhd, false},
+		{"min bitrate", ProbeCriteria{MinBitrateMbps: 15}, uhd, true},
+		{"derived bitrate", ProbeCriteria{MaxBitrateMbps: 5}, hd, true},
+		{"max bitrate", ProbeCriteria{MaxBitrateMbps: 5}, uhd, false},
+		{"unknown bitrate", ProbeCriteria{MaxBitrateMbps: 5}, unknownBitrate, false},
+	}
+	for _, tt := range tests {
+		if got := tt.criteria.Matches(tt.probe); got != tt.want {
+			t.Errorf("%s: Matches() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
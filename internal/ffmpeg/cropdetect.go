@@ -0,0 +1,121 @@
+package ffmpeg
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Defaults for crop detection
+const (
+	cropSampleCount    = 6
+	cropSampleDuration = 2 * time.Second
+
+	// minCropFraction is the least a crop must remove from the width or
+	// height to be applied; thinner borders aren't worth filtering
+	minCropFraction = 0.02
+
+	// cropDetectFilter treats anything darker than ~24/255 as black, as a
+	// fraction so it holds for 10-bit sources too. reset=0 accumulates over
+	// the whole sample, and round=2 keeps dimensions even for 4:2:0.
+	cropDetectFilter = "cropdetect=limit=0.094:round=2:reset=0"
+)
+
+// Crop is a rectangle kept from each frame, in ffmpeg crop filter terms
+type Crop struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	X      int `json:"x"`
+	Y      int `json:"y"`
+}
+
+// Filter returns the crop as an ffmpeg filter
+func (c *Crop) Filter() string {
+	return fmt.Sprintf("crop=%d:%d:%d:%d", c.Width, c.Height, c.X, c.Y)
+}
+
+func (c *Crop) String() string {
+	return fmt.Sprintf("%dx%d+%d+%d", c.Width, c.Height, c.X, c.Y)
+}
+
+var cropRegex = regexp.MustCompile(`crop=(\d+):(\d+):(\d+):(\d+)`)
+
+// parseCropDetect returns the last crop cropdetect printed; with reset=0
+// it covers every frame of the sample
+func parseCropDetect(stderr string) (*Crop, bool) {
+	matches := cropRegex.FindAllStringSubmatch(stderr, -1)
+	if len(matches) == 0 {
+		return nil, false
+	}
+	m := matches[len(matches)-1]
+	var values [4]int
+	for i := range values {
+		v, err := strconv.Atoi(m[i+1])
+		if err != nil {
+			return nil, false
+		}
+		values[i] = v
+	}
+	return &Crop{Width: values[0], Height: values[1], X: values[2], Y: values[3]}, true
+}
+
+// stableCrop combines per-sample crops into the smallest crop that keeps
+// the picture of every sample, so a dark scene can't cut into a bright one.
+// Returns nil if the crop removes too little of a width x height frame to
+// matter, or doesn't fit it (e.g. a rotated source).
+func stableCrop(crops []*Crop, width, height int) *Crop {
+	if len(crops) == 0 {
+		return nil
+	}
+	left, top := crops[0].X, crops[0].Y
+	right, bottom := crops[0].X+crops[0].Width, crops[0].Y+crops[0].Height
+	for _, c := range crops[1:] {
+		left, top = min(left, c.X), min(top, c.Y)
+		right, bottom = max(right, c.X+c.Width), max(bottom, c.Y+c.Height)
+	}
+	crop := &Crop{Width: right - left, Height: bottom - top, X: left, Y: top}
+
+	if crop.Width <= 0 || crop.Height <= 0 || right > width || bottom > height {
+		return nil
+	}
+	if float64(width-crop.Width) < float64(width)*minCropFraction &&
+		float64(height-crop.Height) < float64(height)*minCropFraction {
+		return nil
+	}
+	return crop
+}
+
+// DetectCrop samples the first video stream of a width x height source with
+// cropdetect and returns a crop that removes black bars, or nil if there are
+// none worth removing.
+func (t *Transcoder) DetectCrop(ctx context.Context, inputPath string, width, height int, duration time.Duration) (*Crop, error) {
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("source dimensions are required for crop detection")
+	}
+
+	var crops []*Crop
+	for _, offset := range sampleOffsets(duration, cropSampleDuration, cropSampleCount) {
+		cmd := exec.CommandContext(ctx, t.ffmpegPath,
+			"-nostdin",
+			"-ss", formatSeconds(offset),
+			"-t", formatSeconds(cropSampleDuration),
+			"-i", inputPath,
+			"-map", "0:v:0",
+			"-vf", cropDetectFilter,
+			"-an", "-sn", "-dn",
+			"-f", "null", "-",
+		)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			return nil, fmt.Errorf("crop detection failed: %w: %s", err, lastLine(string(output)))
+		}
+		// Samples past the end of a short file produce no frames
+		if crop, ok := parseCropDetect(string(output)); ok {
+			crops = append(crops, crop)
+		}
+	}
+	return stableCrop(crops, width, height), nil
+}
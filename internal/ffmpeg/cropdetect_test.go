@@ -0,0 +1,72 @@
+package ffmpeg
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseCropDetect(t *testing.T) {
+	stderr := `[Parsed_cropdetect_0 @ 0x5581] x1:0 x2:1919 y1:142 y2:937 w:1920 h:784 x:0 y:148 pts:1001 t:0.041708 crop=1920:784:0:148
+[Parsed_cropdetect_0 @ 0x5581] x1:0 x2:1919 y1:138 y2:941 w:1920 h:800 x:0 y:140 pts:2002 t:0.083417 crop=1920:800:0:140
+`
+	crop, ok := parseCropDetect(stderr)
+	if !ok {
+		t.Fatal("expected a crop")
+	}
+	if want := (Crop{Width: 1920, Height: 800, X: 0, Y: 140}); *crop != want {
+		t.Errorf("got %+v, want the last crop %+v", *crop, want)
+	}
+	if crop.Filter() != "crop=1920:800:0:140" {
+		t.Errorf("unexpected filter %q", crop.Filter())
+	}
+
+	if _, ok := parseCropDetect("Output #0, null, to 'pipe:':\n"); ok {
+		t.Error("expected no crop without cropdetect output")
+	}
+}
+
+func TestStableCrop(t *testing.T) {
+	letterbox := &Crop{Width: 1920, Height: 800, X: 0, Y: 140}
+	darkScene := &Crop{Width: 1600, Height: 640, X: 160, Y: 220}
+	tests := []struct {
+		name  string
+		crops []*Crop
+		want  *Crop
+	}{
+		{"no samples", nil, nil},
+		{"letterbox", []*Crop{letterbox, letterbox}, letterbox},
+		{"dark scene doesn't over-crop", []*Crop{letterbox, darkScene}, letterbox},
+		{"full frame", []*Crop{{Width: 1920, Height: 1080}}, nil},
+		{"thin border ignored", []*Crop{{Width: 1912, Height: 1072, X: 4, Y: 4}}, nil},
+		{"larger than source", []*Crop{{Width: 1080, Height: 1920}}, nil},
+	}
+	for _, tt := range tests {
+		got := stableCrop(tt.crops, 1920, 1080)
+		if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDetectCrop(t *testing.T) {
+	dir := t.TempDir()
+	ffmpegPath := filepath.Join(dir, "ffmpeg")
+	writeScript(t, ffmpegPath, `echo "[Parsed_cropdetect_0 @ 0x1] x1:0 x2:1919 y1:140 y2:939 w:1920 h:800 x:0 y:140 pts:1 t:0.04 crop=1920:800:0:140" >&2
+exit 0
+`)
+
+	transcoder := NewTranscoder(ffmpegPath)
+	crop, err := transcoder.DetectCrop(context.Background(), "/media/movie.mkv", 1920, 1080, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if crop == nil || crop.Height != 800 || crop.Y != 140 {
+		t.Errorf("expected the letterbox to be cropped, got %+v", crop)
+	}
+
+	if _, err := transcoder.DetectCrop(context.Background(), "/media/movie.mkv", 0, 0, time.Hour); err == nil {
+		t.Error("expected an error without source dimensions")
+	}
+}
@@ -0,0 +1,112 @@
+package ffmpeg
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxCustomArgs caps the per-job custom args
+const maxCustomArgs = 32
+
+var (
+	customWordRe     = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._+-]{0,31}$`)
+	customBitrateRe  = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?[kKmMgG]?$`)
+	customStreamRe   = regexp.MustCompile(`^([vV](:[0-9]+)?|[0-9]+)$`)
+	customParamKeyRe = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+	customParamValRe = regexp.MustCompile(`^[A-Za-z0-9.,+()-]*$`)
+)
+
+// customArgOptions are the encoder tuning options allowed in per-job custom
+// args, each with the check its value must pass. Every option takes a
+// value; anything not listed (inputs, outputs, filters, stream selection,
+// logs and stats files) is rejected.
+var customArgOptions = map[string]func(string) bool{
+	"-preset": isCustomWord, "-tune": isCustomWord, "-profile": isCustomWord, "-level": isCustomWord,
+	"-pix_fmt": isCustomWord, "-rc": isCustomWord, "-usage": isCustomWord, "-deadline": isCustomWord,
+	"-quality": isCustomWord, "-multipass": isCustomWord, "-b_ref_mode": isCustomWord,
+
+	"-crf": isCustomNumber, "-qp": isCustomNumber, "-cq": isCustomNumber, "-q": isCustomNumber,
+	"-global_quality": isCustomNumber, "-qmin": isCustomNumber, "-qmax": isCustomNumber,
+	"-g": isCustomNumber, "-keyint_min": isCustomNumber, "-bf": isCustomNumber, "-refs": isCustomNumber,
+	"-rc-lookahead": isCustomNumber, "-lookahead_depth": isCustomNumber, "-look_ahead": isCustomNumber,
+	"-spatial-aq": isCustomNumber, "-temporal-aq": isCustomNumber, "-aq-strength": isCustomNumber,
+	"-cpu-used": isCustomNumber, "-row-mt": isCustomNumber, "-tile-columns": isCustomNumber,
+	"-tile-rows": isCustomNumber, "-async_depth": isCustomNumber,
+
+	"-b": isCustomBitrate, "-maxrate": isCustomBitrate, "-minrate": isCustomBitrate, "-bufsize": isCustomBitrate,
+
+	"-x265-params": isCustomEncoderParams, "-x264-params": isCustomEncoderParams,
+	"-svtav1-params": isCustomEncoderParams,
+}
+
+// customParamFileKeys mark encoder params (x265-params and the like) that
+// read or write files, e.g. csv=, stats=, analysis-save=, qpfile=
+var customParamFileKeys = []string{
+	"file", "csv", "stat", "save", "load", "dump", "recon", "zone", "dhdr10", "lambda", "scaling-list", "fgs-table", "cqm",
+}
+
+// ValidateCustomArgs checks per-job encoder options: pairs of an allowed
+// tuning option (see customArgOptions), optionally with a video stream
+// specifier like -preset:v, and a value that option accepts. Custom args
+// also reach remote agents, and the output may replace the original, so
+// anything else is rejected rather than passed to ffmpeg.
+func ValidateCustomArgs(args []string) error {
+	if len(args) > maxCustomArgs {
+		return fmt.Errorf("too many custom args (max %d)", maxCustomArgs)
+	}
+	for i := 0; i < len(args); i += 2 {
+		option := args[i]
+		if !strings.HasPrefix(option, "-") {
+			return fmt.Errorf("expected an option in custom args, got %q", option)
+		}
+		// -x265-params:v:0 → -x265-params
+		name, spec, hasSpec := strings.Cut(option, ":")
+		valid, ok := customArgOptions[name]
+		if !ok || (hasSpec && !customStreamRe.MatchString(spec)) {
+			return fmt.Errorf("option %s is not allowed in custom args", option)
+		}
+		if i+1 >= len(args) {
+			return fmt.Errorf("option %s needs a value", option)
+		}
+		if value := args[i+1]; !valid(value) {
+			return fmt.Errorf("invalid value %q for %s", value, option)
+		}
+	}
+	return nil
+}
+
+func isCustomWord(value string) bool {
+	return customWordRe.MatchString(value)
+}
+
+func isCustomNumber(value string) bool {
+	_, err := strconv.ParseFloat(value, 64)
+	return err == nil && len(value) <= 16
+}
+
+func isCustomBitrate(value string) bool {
+	return customBitrateRe.MatchString(value)
+}
+
+// isCustomEncoderParams checks a colon-separated key=value list, e.g.
+// "aq-mode=3:psy-rd=1.0", for keys that take files and for values that
+// could be paths
+func isCustomEncoderParams(value string) bool {
+	if value == "" || len(value) > 512 {
+		return false
+	}
+	for _, param := range strings.Split(value, ":") {
+		key, val, _ := strings.Cut(param, "=")
+		if !customParamKeyRe.MatchString(key) || !customParamValRe.MatchString(val) {
+			return false
+		}
+		for _, fileKey := range customParamFileKeys {
+			if strings.Contains(key, fileKey) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,50 @@
+package ffmpeg
+
+// DeinterlaceMode controls whether a preset deinterlaces its sources
+type DeinterlaceMode string
+
+const (
+	DeinterlaceAuto DeinterlaceMode = "auto" // Sources probed as interlaced (default)
+	DeinterlaceOn   DeinterlaceMode = "on"   // Every source, for interlaced files flagged progressive
+	DeinterlaceOff  DeinterlaceMode = "off"
+)
+
+// ParseDeinterlaceMode returns the mode named by value, or false if it isn't one
+func ParseDeinterlaceMode(value string) (DeinterlaceMode, bool) {
+	switch DeinterlaceMode(value) {
+	case DeinterlaceAuto, DeinterlaceOn, DeinterlaceOff:
+		return DeinterlaceMode(value), true
+	}
+	return "", false
+}
+
+// ShouldDeinterlace reports whether a source with the given interlacing
+// is deinterlaced in mode
+func (m DeinterlaceMode) ShouldDeinterlace(interlaced bool) bool {
+	switch m {
+	case DeinterlaceOn:
+		return true
+	case DeinterlaceOff:
+		return false
+	default:
+		return interlaced
+	}
+}
+
+// isInterlacedFieldOrder reports whether an ffprobe field_order is
+// interlaced: tt/bb (top/bottom field first) or tb/bt (swapped coding order)
+func isInterlacedFieldOrder(fieldOrder string) bool {
+	switch fieldOrder {
+	case "tt", "bb", "tb", "bt":
+		return true
+	}
+	return false
+}
+
+// Deinterlace filters by where decoded frames are. All output one frame
+// per frame, keeping the source frame rate.
+const (
+	deinterlaceFilterSoftware = "bwdif=mode=send_frame"
+	deinterlaceFilterVAAPI    = "deinterlace_vaapi"
+	deinterlaceFilterCUDA     = "yadif_cuda=mode=send_frame"
+)
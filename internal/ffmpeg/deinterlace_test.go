@@ -0,0 +1,67 @@
+package ffmpeg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDeinterlaceMode(t *testing.T) {
+	tests := []struct {
+		fieldOrder string
+		mode       DeinterlaceMode
+		want       bool
+	}{
+		{"tt", DeinterlaceAuto, true},
+		{"bb", DeinterlaceAuto, true},
+		{"progressive", DeinterlaceAuto, false},
+		{"", DeinterlaceAuto, false},
+		{"progressive", DeinterlaceOn, true},
+		{"tt", DeinterlaceOff, false},
+	}
+	for _, tt := range tests {
+		if got := tt.mode.ShouldDeinterlace(isInterlacedFieldOrder(tt.fieldOrder)); got != tt.want {
+			t.Errorf("%s with field order %q = %v, want %v", tt.mode, tt.fieldOrder, got, tt.want)
+		}
+	}
+
+	if _, ok := ParseDeinterlaceMode("sometimes"); ok {
+		t.Error("expected unknown mode to be rejected")
+	}
+}
+
+func TestBuildPresetArgsDeinterlace(t *testing.T) {
+	tests := []struct {
+		name   string
+		preset Preset
+		want   string
+	}{
+		{"software", Preset{Encoder: HWAccelNone, Codec: CodecHEVC},
+			"bwdif=mode=send_frame"},
+		{"software scaled", Preset{Encoder: HWAccelNone, Codec: CodecHEVC, MaxHeight: 720},
+			"bwdif=mode=send_frame,scale=-2:'min(ih,720)'"},
+		{"nvenc", Preset{Encoder: HWAccelNVENC, Codec: CodecHEVC},
+			"yadif_cuda=mode=send_frame"},
+		{"nvenc cropped", Preset{Encoder: HWAccelNVENC, Codec: CodecHEVC, Crop: &Crop{Width: 704, Height: 480}},
+			"bwdif=mode=send_frame,crop=704:480:0:0"},
+		{"qsv", Preset{Encoder: HWAccelQSV, Codec: CodecHEVC},
+			"bwdif=mode=send_frame"},
+		{"vaapi", Preset{Encoder: HWAccelVAAPI, Codec: CodecHEVC},
+			"deinterlace_vaapi,scale_vaapi=format=nv12:" +
+				"out_range=tv:out_color_matrix=bt709:out_color_primaries=bt709:out_color_transfer=bt709"},
+	}
+	for _, tt := range tests {
+		tt.preset.ID = "test"
+		tt.preset.Deinterlace = true
+		_, outputArgs := BuildPresetArgs(&tt.preset, 0, nil, "convert", 8, "yuv420p", "h264", 0, 0)
+		if got := argAfter(outputArgs, "-filter:v:0"); got != tt.want {
+			t.Errorf("%s: filter = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// Software-decoded VAAPI frames are uploaded before deinterlacing
+	vaapi := &Preset{ID: "test", Encoder: HWAccelVAAPI, Codec: CodecHEVC, Deinterlace: true}
+	_, outputArgs := BuildPresetArgs(vaapi, 0, nil, "convert", 8, "yuv444p", "h264", 0, 0)
+	if got := argAfter(outputArgs, "-filter:v:0"); !strings.HasPrefix(got, "format=nv12,hwupload,deinterlace_vaapi,scale_vaapi=") {
+		t.Errorf("vaapi software decode filter = %q", got)
+	}
+}
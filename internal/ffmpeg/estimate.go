@@ -0,0 +1,344 @@
+package ffmpeg
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Estimate is a rough prediction of the output size of a transcode.
+// Video is modeled as a ratio range of the source video bitrate; audio is
+// modeled per track since multi-track files can carry a lot of audio that
+// the video encoder has no influence on.
+type Estimate struct {
+	MinSize      int64 `json:"min_size"`      // Optimistic output size in bytes
+	MaxSize      int64 `json:"max_size"`      // Pessimistic output size in bytes
+	AudioTracks  int   `json:"audio_tracks"`  // Number of audio tracks in the output
+	AudioBitrate int64 `json:"audio_bitrate"` // Combined output audio bitrate (bits/s)
+	AudioSavings int64 `json:"audio_savings"` // Bytes saved on audio (negative = overhead)
+
+	// Calibration is the factor past jobs' actual sizes scaled the model's
+	// prediction by; 0 when there's no history for the file's source codec,
+	// encoder and preset (see SetEstimateCalibration)
+	Calibration float64 `json:"calibration,omitempty"`
+}
+
+// CalibrationKey is what estimate errors are tracked by
+type CalibrationKey struct {
+	SourceCodec string // e.g. h264
+	Encoder     string // e.g. vaapi, none
+	PresetID    string
+}
+
+var (
+	calibrationMu sync.RWMutex
+	calibration   map[CalibrationKey]float64
+)
+
+// SetEstimateCalibration sets the factors EstimateTranscode scales its
+// prediction by, measured from finished jobs as actual / estimated size
+func SetEstimateCalibration(factors map[CalibrationKey]float64) {
+	calibrationMu.Lock()
+	calibration = factors
+	calibrationMu.Unlock()
+}
+
+func calibrationFor(probe *ProbeResult, preset *Preset) float64 {
+	calibrationMu.RLock()
+	defer calibrationMu.RUnlock()
+	return calibration[CalibrationKey{SourceCodec: probe.VideoCodec, Encoder: string(preset.Encoder), PresetID: preset.ID}]
+}
+
+// videoRatio is the expected output/input video bitrate range for a codec.
+type videoRatio struct {
+	min, max float64
+}
+
+// Output/input ratios observed for the default quality settings. Sources that
+// are already HEVC/AV1 compress far less, so they get their own range.
+var (
+	videoRatios = map[Codec]videoRatio{
+		CodecHEVC: {0.35, 0.60},
+		CodecAV1:  {0.25, 0.50},
+		CodecCopy: {1.00, 1.00},
+	}
+	efficientSourceRatio = videoRatio{0.70, 1.00}
+)
+
+// containerOverhead approximates Matroska muxing overhead as a fraction of size.
+const containerOverhead = 0.005
+
+// EstimateTranscode predicts the output size range for transcoding probe with
+// preset, corrected by what similar jobs actually produced. Returns nil if
+// the probe lacks the duration or bitrate needed.
+func EstimateTranscode(probe *ProbeResult, preset *Preset) *Estimate {
+	est := UncalibratedEstimate(probe, preset)
+	if est == nil {
+		return nil
+	}
+	if factor := calibrationFor(probe, preset); factor > 0 {
+		est.MinSize = int64(float64(est.MinSize) * factor)
+		est.MaxSize = int64(float64(est.MaxSize) * factor)
+		est.Calibration = factor
+	}
+	return est
+}
+
+// UncalibratedEstimate is EstimateTranscode from the model alone, which is
+// what past jobs' errors are measured against
+func UncalibratedEstimate(probe *ProbeResult, preset *Preset) *Estimate {
+	if probe == nil || preset == nil || probe.Duration <= 0 {
+		return nil
+	}
+	seconds := probe.Duration.Seconds()
+
+	totalBitrate := probe.OverallBitrate()
+	if totalBitrate <= 0 {
+		return nil
+	}
+
+	est := &Estimate{}
+
+	// Audio is currently stream-copied, so output audio matches the source.
+	// Modeling each track individually keeps the video share accurate for
+	// files with several surround/commentary tracks.
+	var srcAudio, otherBitrate int64
+	for _, s := range probe.Streams {
+		switch s.Type {
+		case "audio":
+			in := audioStreamBitrate(s)
+			srcAudio += in
+			est.AudioBitrate += audioOutputBitrate(preset, s, in)
+			est.AudioTracks++
+		case "subtitle", "attachment", "data":
+			otherBitrate += s.Bitrate
+		}
+	}
+
+	srcVideo := totalBitrate - srcAudio - otherBitrate
+	if srcVideo < 0 {
+		// Stream bitrates overshoot the container total; trust the total
+		srcVideo = totalBitrate / 2
+	}
+
+	ratio, ok := videoRatios[preset.Codec]
+	if !ok {
+		ratio = videoRatios[CodecHEVC]
+	}
+	if (probe.IsHEVC || probe.IsAV1) && preset.Codec != CodecCopy {
+		ratio = efficientSourceRatio
+	}
+
+	// Downscaling reduces pixel count roughly quadratically with height
+	scale := 1.0
+	if preset.MaxHeight > 0 && probe.Height > preset.MaxHeight {
+		h := float64(preset.MaxHeight) / float64(probe.Height)
+		scale = h * h
+	}
+
+	bytesFor := func(bitrate float64) int64 {
+		return int64(bitrate * seconds / 8)
+	}
+	audioBytes := bytesFor(float64(est.AudioBitrate))
+	otherBytes := bytesFor(float64(otherBitrate))
+	est.AudioSavings = bytesFor(float64(srcAudio)) - audioBytes
+
+	minVideo := bytesFor(float64(srcVideo) * ratio.min * scale)
+	maxVideo := bytesFor(float64(srcVideo) * ratio.max * scale)
+	est.MinSize = int64(float64(minVideo+audioBytes+otherBytes) * (1 + containerOverhead))
+	est.MaxSize = int64(float64(maxVideo+audioBytes+otherBytes) * (1 + containerOverhead))
+
+	return est
+}
+
+// BatchEstimate is the combined estimate for a set of files
+type BatchEstimate struct {
+	Files      int   `json:"files"`       // Files considered
+	Estimated  int   `json:"estimated"`   // Files that would be transcoded and could be estimated
+	Skipped    int   `json:"skipped"`     // Files already in the target codec/resolution
+	InputSize  int64 `json:"input_size"`  // Source size of the estimated files
+	MinSize    int64 `json:"min_size"`    // Optimistic combined output size
+	MaxSize    int64 `json:"max_size"`    // Pessimistic combined output size
+	SavingsMin int64 `json:"savings_min"` // InputSize - MaxSize
+	SavingsMax int64 `json:"savings_max"` // InputSize - MinSize
+}
+
+// EstimateMultiple sums EstimateTranscode over probes. Files the queue would
+// skip (already in the target codec, or already at/below the target height)
+// are counted but contribute no savings.
+func EstimateMultiple(probes []*ProbeResult, preset *Preset) *BatchEstimate {
+	batch := &BatchEstimate{}
+	if preset == nil {
+		return batch
+	}
+
+	for _, probe := range probes {
+		if probe == nil {
+			continue
+		}
+		batch.Files++
+
+		if WouldSkip(probe, preset) {
+			batch.Skipped++
+			continue
+		}
+		est := EstimateTranscode(probe, preset)
+		if est == nil {
+			continue
+		}
+		batch.Estimated++
+		batch.InputSize += probe.Size
+		batch.MinSize += est.MinSize
+		batch.MaxSize += est.MaxSize
+	}
+
+	batch.SavingsMin = batch.InputSize - batch.MaxSize
+	batch.SavingsMax = batch.InputSize - batch.MinSize
+	return batch
+}
+
+// SkipReason returns why the queue skips probe for preset: it's already in
+// preset's codec (unless ExcessiveBitrate) or at/below its target height,
+// or a remux or audio-only preset has nothing to do (see RemuxSkipReason and
+// AudioSkipReason). "" if it should be transcoded.
+func SkipReason(probe *ProbeResult, preset *Preset) string {
+	if preset.AudioCodec != "" {
+		return AudioSkipReason(probe)
+	}
+	if preset.Codec == CodecCopy {
+		return RemuxSkipReason(probe)
+	}
+
+	// For downscale presets, check if file already meets resolution target
+	if preset.MaxHeight > 0 && probe.Height <= preset.MaxHeight {
+		return fmt.Sprintf("File is already %dp or smaller", preset.MaxHeight)
+	}
+
+	// Check if file is already in target codec
+	var isAlreadyTarget bool
+	var codecName string
+
+	switch preset.Codec {
+	case CodecHEVC:
+		isAlreadyTarget = probe.IsHEVC
+		codecName = "HEVC"
+	case CodecAV1:
+		isAlreadyTarget = probe.IsAV1
+		codecName = "AV1"
+	}
+
+	if isAlreadyTarget && !ExcessiveBitrate(probe, preset) {
+		return fmt.Sprintf("File is already encoded in %s", codecName)
+	}
+
+	return "" // Proceed with transcode
+}
+
+// WouldSkip reports whether the queue would skip probe for preset (see
+// SkipReason), for estimating purposes
+func WouldSkip(probe *ProbeResult, preset *Preset) bool {
+	return SkipReason(probe, preset) != ""
+}
+
+// ExcessiveBitrate reports whether probe's video is above preset's
+// ReencodeAboveBPP, so a source already in the target codec (say a 60 Mbps
+// HEVC remux) is still worth compressing.
+func ExcessiveBitrate(probe *ProbeResult, preset *Preset) bool {
+	return preset.ReencodeAboveBPP > 0 && VideoBitsPerPixel(probe) > preset.ReencodeAboveBPP
+}
+
+// VideoBitsPerPixel returns the source video's bits per pixel per frame, a
+// resolution- and frame-rate-neutral measure of how generously it's
+// encoded. 0 if the bitrate, size or frame rate is unknown.
+func VideoBitsPerPixel(probe *ProbeResult) float64 {
+	pixels := float64(probe.Width) * float64(probe.Height) * probe.FrameRate
+	if pixels <= 0 {
+		return 0
+	}
+	bitrate := SourceVideoBitrate(probe)
+	if bitrate <= 0 {
+		return 0
+	}
+	return float64(bitrate) / pixels
+}
+
+// SourceVideoBitrate returns the video stream's bitrate, or the container
+// bitrate less the other streams when the video's isn't reported (as in
+// most MKVs).
+func SourceVideoBitrate(probe *ProbeResult) int64 {
+	total := probe.OverallBitrate()
+	for _, s := range probe.Streams {
+		switch s.Type {
+		case "video":
+			if s.Bitrate > 0 {
+				return s.Bitrate
+			}
+		case "audio":
+			total -= audioStreamBitrate(s)
+		case "subtitle", "attachment", "data":
+			total -= s.Bitrate
+		}
+	}
+	return max(total, 0)
+}
+
+// audioStreamBitrate returns the source bitrate of an audio stream, guessing
+// from codec and channel count when the container doesn't report it.
+func audioStreamBitrate(s ProbeStream) int64 {
+	if s.Bitrate > 0 {
+		return s.Bitrate
+	}
+
+	channels := int64(s.Channels)
+	if channels <= 0 {
+		channels = 2
+	}
+
+	switch strings.ToLower(s.Codec) {
+	case "truehd", "mlp":
+		return channels * 600_000
+	case "flac", "alac":
+		return channels * 450_000
+	case "dts":
+		// Can't tell core from DTS-HD MA here; assume the larger
+		return channels * 500_000
+	case "eac3":
+		return channels * 128_000
+	case "ac3":
+		return channels * 96_000
+	case "opus":
+		return channels * 64_000
+	}
+	if strings.HasPrefix(strings.ToLower(s.Codec), "pcm_") {
+		return channels * 48_000 * 24
+	}
+	// AAC, MP3 and anything else lossy
+	return channels * 80_000
+}
+
+// audioOutputBitrate returns the bitrate an audio stream will have in the
+// output: the source bitrate when copied, or the encode bitrate when an
+// audio-only preset re-encodes a lossless track.
+func audioOutputBitrate(preset *Preset, s ProbeStream, sourceBitrate int64) int64 {
+	if preset.AudioCodec != "" && IsLosslessAudio(s.Codec, s.Profile) {
+		return min(AudioEncodeBitrate(preset.AudioCodec, s.Channels), sourceBitrate)
+	}
+	return sourceBitrate
+}
+
+// FormatBytes formats a size in bytes for people, e.g. "1.5 GB"
+func FormatBytes(bytes int64) string {
+	if bytes < 0 {
+		bytes = 0
+	}
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
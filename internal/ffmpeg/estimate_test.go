@@ -0,0 +1,196 @@
+package ffmpeg
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEstimateTranscodeAudioTracks(t *testing.T) {
+	preset := &Preset{ID: "compress-hevc", Codec: CodecHEVC}
+
+	videoOnly := &ProbeResult{
+		Duration: 100 * time.Second,
+		Bitrate:  10_000_000,
+		Height:   1080,
+		Streams:  []ProbeStream{{Type: "video", Codec: "h264"}},
+	}
+	multiTrack := &ProbeResult{
+		Duration: 100 * time.Second,
+		Bitrate:  10_000_000,
+		Height:   1080,
+		Streams: []ProbeStream{
+			{Type: "video", Codec: "h264"},
+			{Type: "audio", Codec: "truehd", Channels: 8, Bitrate: 3_000_000},
+			{Type: "audio", Codec: "ac3", Channels: 2}, // no reported bitrate
+		},
+	}
+
+	base := EstimateTranscode(videoOnly, preset)
+	est := EstimateTranscode(multiTrack, preset)
+	if base == nil || est == nil {
+		t.Fatal("expected estimates")
+	}
+
+	if est.AudioTracks != 2 {
+		t.Errorf("expected 2 audio tracks, got %d", est.AudioTracks)
+	}
+	wantAudio := int64(3_000_000 + 2*96_000)
+	if est.AudioBitrate != wantAudio {
+		t.Errorf("expected audio bitrate %d, got %d", wantAudio, est.AudioBitrate)
+	}
+	if est.AudioSavings != 0 {
+		t.Errorf("expected no audio savings for copied audio, got %d", est.AudioSavings)
+	}
+
+	// Copied audio can't shrink, so the multi-track file compresses less overall
+	if est.MinSize <= base.MinSize {
+		t.Errorf("expected audio to raise min size: %d <= %d", est.MinSize, base.MinSize)
+	}
+	if est.MinSize > est.MaxSize {
+		t.Errorf("min %d > max %d", est.MinSize, est.MaxSize)
+	}
+	inputBytes := int64(10_000_000 * 100 / 8)
+	if est.MaxSize >= inputBytes {
+		t.Errorf("expected max %d below input %d", est.MaxSize, inputBytes)
+	}
+}
+
+func TestEstimateTranscodeScaling(t *testing.T) {
+	probe := &ProbeResult{
+		Duration: time.Minute,
+		Bitrate:  20_000_000,
+		Height:   2160,
+	}
+
+	full := EstimateTranscode(probe, &Preset{Codec: CodecHEVC})
+	scaled := EstimateTranscode(probe, &Preset{Codec: CodecHEVC, MaxHeight: 1080})
+	if scaled.MaxSize >= full.MaxSize/2 {
+		t.Errorf("expected 4K->1080p estimate well below full size: %d vs %d", scaled.MaxSize, full.MaxSize)
+	}
+}
+
+func TestEstimateTranscodeRemux(t *testing.T) {
+	probe := &ProbeResult{
+		Duration: time.Minute,
+		Size:     60_000_000,
+		IsHEVC:   true,
+	}
+
+	est := EstimateTranscode(probe, &Preset{Codec: CodecCopy})
+	if est.MinSize < probe.Size || est.MaxSize > probe.Size*101/100 {
+		t.Errorf("expected a remux to stay about the source size, got %d-%d", est.MinSize, est.MaxSize)
+	}
+}
+
+func TestEstimateTranscodeAudioOnly(t *testing.T) {
+	probe := &ProbeResult{
+		Duration: time.Minute,
+		Size:     60_000_000,
+		IsHEVC:   true,
+		Streams: []ProbeStream{
+			{Type: "video", Codec: "hevc"},
+			{Type: "audio", Codec: "truehd", Channels: 8, Bitrate: 4_000_000},
+		},
+	}
+
+	est := EstimateTranscode(probe, &Preset{Codec: CodecCopy, AudioCodec: "eac3"})
+	if est.AudioBitrate != 640_000 {
+		t.Errorf("AudioBitrate = %d, want 640000", est.AudioBitrate)
+	}
+	if est.MaxSize >= probe.Size {
+		t.Errorf("expected re-encoding TrueHD to shrink the file, got up to %d", est.MaxSize)
+	}
+}
+
+func TestWouldSkipExcessiveBitrate(t *testing.T) {
+	remux := &ProbeResult{Width: 3840, Height: 2160, FrameRate: 24, Bitrate: 60_000_000, IsHEVC: true,
+		Streams: []ProbeStream{{Type: "video", Codec: "hevc"}, {Type: "audio", Codec: "truehd", Bitrate: 4_000_000}}}
+	web := &ProbeResult{Width: 1920, Height: 1080, FrameRate: 24, Bitrate: 4_000_000, IsHEVC: true}
+	preset := &Preset{Codec: CodecHEVC, ReencodeAboveBPP: 0.2}
+
+	if bpp := VideoBitsPerPixel(remux); bpp < 0.27 || bpp > 0.29 {
+		t.Errorf("VideoBitsPerPixel(remux) = %.3f, want about 0.28 without the audio", bpp)
+	}
+	if WouldSkip(remux, preset) {
+		t.Error("expected a 60 Mbps HEVC remux to be re-encoded")
+	}
+	if !WouldSkip(web, preset) {
+		t.Error("expected a 4 Mbps HEVC file to stay skipped")
+	}
+	if !WouldSkip(remux, &Preset{Codec: CodecHEVC}) {
+		t.Error("expected HEVC sources skipped with the override off")
+	}
+	if WouldSkip(&ProbeResult{IsHEVC: true, Bitrate: 60_000_000}, preset) != true {
+		t.Error("expected a skip when the resolution is unknown")
+	}
+}
+
+func TestEstimateTranscodeMissingData(t *testing.T) {
+	if EstimateTranscode(&ProbeResult{Bitrate: 1000}, &Preset{Codec: CodecHEVC}) != nil {
+		t.Error("expected nil estimate without duration")
+	}
+	if EstimateTranscode(nil, &Preset{Codec: CodecHEVC}) != nil {
+		t.Error("expected nil estimate for nil probe")
+	}
+}
+
+func TestAudioStreamBitrate(t *testing.T) {
+	tests := []struct {
+		stream ProbeStream
+		want   int64
+	}{
+		{ProbeStream{Type: "audio", Codec: "aac", Bitrate: 128_000}, 128_000},
+		{ProbeStream{Type: "audio", Codec: "aac"}, 160_000},
+		{ProbeStream{Type: "audio", Codec: "eac3", Channels: 6}, 768_000},
+		{ProbeStream{Type: "audio", Codec: "pcm_s24le", Channels: 2}, 2_304_000},
+	}
+
+	for _, tt := range tests {
+		if got := audioStreamBitrate(tt.stream); got != tt.want {
+			t.Errorf("audioStreamBitrate(%s/%d) = %d, want %d", tt.stream.Codec, tt.stream.Channels, got, tt.want)
+		}
+	}
+}
+
+func TestEstimateMultiple(t *testing.T) {
+	preset := &Preset{ID: "compress-hevc", Codec: CodecHEVC}
+	h264 := &ProbeResult{Size: 1_250_000_000, Duration: 1000 * time.Second, Bitrate: 10_000_000, Height: 1080}
+	hevc := &ProbeResult{Size: 500_000_000, Duration: 1000 * time.Second, Bitrate: 4_000_000, Height: 1080, IsHEVC: true}
+	unknown := &ProbeResult{Size: 1000, Height: 1080} // no duration
+
+	batch := EstimateMultiple([]*ProbeResult{h264, hevc, unknown, nil}, preset)
+	if batch.Files != 3 || batch.Estimated != 1 || batch.Skipped != 1 {
+		t.Fatalf("unexpected counts: %+v", batch)
+	}
+	if batch.InputSize != h264.Size {
+		t.Errorf("expected input size %d, got %d", h264.Size, batch.InputSize)
+	}
+	single := EstimateTranscode(h264, preset)
+	if batch.MinSize != single.MinSize || batch.MaxSize != single.MaxSize {
+		t.Errorf("expected batch to match single estimate: %+v vs %+v", batch, single)
+	}
+	if batch.SavingsMax != h264.Size-single.MinSize || batch.SavingsMin > batch.SavingsMax {
+		t.Errorf("unexpected savings range: %d-%d", batch.SavingsMin, batch.SavingsMax)
+	}
+}
+
+func TestEstimateTranscodeCalibration(t *testing.T) {
+	t.Cleanup(func() { SetEstimateCalibration(nil) })
+	preset := &Preset{ID: "compress-hevc", Encoder: HWAccelVAAPI, Codec: CodecHEVC}
+	probe := &ProbeResult{Duration: 100 * time.Second, Bitrate: 10_000_000, VideoCodec: "h264"}
+
+	raw := UncalibratedEstimate(probe, preset)
+	SetEstimateCalibration(map[CalibrationKey]float64{
+		{SourceCodec: "h264", Encoder: "vaapi", PresetID: "compress-hevc"}: 1.5,
+	})
+	est := EstimateTranscode(probe, preset)
+	if est.Calibration != 1.5 || est.MinSize != int64(float64(raw.MinSize)*1.5) || est.MaxSize != int64(float64(raw.MaxSize)*1.5) {
+		t.Errorf("expected the estimate scaled by 1.5, got %+v from %+v", est, raw)
+	}
+
+	// Other source codecs keep the model's estimate
+	mpeg2 := &ProbeResult{Duration: 100 * time.Second, Bitrate: 10_000_000, VideoCodec: "mpeg2video"}
+	if est := EstimateTranscode(mpeg2, preset); est.Calibration != 0 || est.MaxSize != raw.MaxSize {
+		t.Errorf("expected no calibration for mpeg2video, got %+v", est)
+	}
+}
@@ -0,0 +1,101 @@
+package ffmpeg
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultVideoExtensions are the file extensions treated as video unless
+// changed by SetVideoExtensions
+var DefaultVideoExtensions = []string{
+	".mkv", ".mp4", ".avi", ".mov", ".wmv", ".flv",
+	".webm", ".m4v", ".mpeg", ".mpg", ".m2ts", ".ts",
+}
+
+// stillExtensions are still images, camera raw photos and raw video
+// formats ffmpeg can't decode. A folder of them is an image sequence, not
+// something to transcode file by file, so they're never video.
+var stillExtensions = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".bmp": true, ".tif": true,
+	".tiff": true, ".webp": true, ".heic": true, ".exr": true, ".dpx": true,
+	".tga": true, ".dng": true, ".cr2": true, ".cr3": true, ".nef": true,
+	".arw": true, ".raf": true, ".orf": true, ".rw2": true, ".r3d": true,
+	".braw": true, ".ari": true,
+}
+
+var (
+	videoExtMu sync.RWMutex
+	videoExts  = extensionSet(DefaultVideoExtensions, nil)
+)
+
+// NormalizeExtension lowercases ext and adds the leading dot, returning ""
+// for something that isn't an extension
+func NormalizeExtension(ext string) string {
+	ext = strings.ToLower(strings.TrimSpace(ext))
+	if ext == "" || ext == "." || strings.ContainsAny(ext, `/\ `) {
+		return ""
+	}
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	if strings.Count(ext, ".") > 1 {
+		return ""
+	}
+	return ext
+}
+
+// IsStillExtension reports whether ext is a still image or raw format that
+// can't be made a video extension
+func IsStillExtension(ext string) bool {
+	return stillExtensions[NormalizeExtension(ext)]
+}
+
+// SetVideoExtensions sets which files are video: the defaults plus extra,
+// minus excluded. Still image and raw formats in extra are left out and
+// returned.
+func SetVideoExtensions(extra, excluded []string) (ignored []string) {
+	for _, ext := range extra {
+		if IsStillExtension(ext) {
+			ignored = append(ignored, NormalizeExtension(ext))
+		}
+	}
+	exts := extensionSet(append(append([]string{}, DefaultVideoExtensions...), extra...), excluded)
+	videoExtMu.Lock()
+	videoExts = exts
+	videoExtMu.Unlock()
+	return ignored
+}
+
+// VideoExtensions returns the extensions currently treated as video, sorted
+func VideoExtensions() []string {
+	videoExtMu.RLock()
+	defer videoExtMu.RUnlock()
+	exts := make([]string, 0, len(videoExts))
+	for ext := range videoExts {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	return exts
+}
+
+func extensionSet(include, exclude []string) map[string]bool {
+	set := make(map[string]bool, len(include))
+	for _, ext := range include {
+		if ext = NormalizeExtension(ext); ext != "" && !stillExtensions[ext] {
+			set[ext] = true
+		}
+	}
+	for _, ext := range exclude {
+		delete(set, NormalizeExtension(ext))
+	}
+	return set
+}
+
+func isVideoExtension(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	videoExtMu.RLock()
+	defer videoExtMu.RUnlock()
+	return videoExts[ext]
+}
@@ -0,0 +1,60 @@
+package ffmpeg
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSetVideoExtensions(t *testing.T) {
+	t.Cleanup(func() { SetVideoExtensions(nil, nil) })
+
+	ignored := SetVideoExtensions([]string{"m2v", ".VOB", ".3gp", ".dng", "png"}, []string{".ts"})
+	if !slices.Equal(ignored, []string{".dng", ".png"}) {
+		t.Errorf("expected still formats ignored, got %v", ignored)
+	}
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/media/clip.m2v", true},
+		{"/media/DVD/VTS_01_1.VOB", true},
+		{"/media/phone.3gp", true},
+		{"/media/movie.mkv", true},
+		{"/media/recording.ts", false},
+		{"/media/frames/frame0001.dng", false},
+		{"/media/frames/frame0001.png", false},
+	}
+	for _, tt := range tests {
+		if got := IsVideoFile(tt.path); got != tt.want {
+			t.Errorf("IsVideoFile(%s) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+
+	SetVideoExtensions(nil, nil)
+	if !slices.Equal(VideoExtensions(), extensionsSorted(DefaultVideoExtensions)) {
+		t.Errorf("expected the defaults back, got %v", VideoExtensions())
+	}
+}
+
+func TestNormalizeExtension(t *testing.T) {
+	tests := map[string]string{
+		"mkv":     ".mkv",
+		" .M2V ":  ".m2v",
+		"":        "",
+		".":       "",
+		"a/b":     "",
+		".tar.gz": "",
+	}
+	for in, want := range tests {
+		if got := NormalizeExtension(in); got != want {
+			t.Errorf("NormalizeExtension(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func extensionsSorted(exts []string) []string {
+	sorted := slices.Clone(exts)
+	slices.Sort(sorted)
+	return sorted
+}
@@ -0,0 +1,309 @@
+package ffmpeg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gwlsn/shrinkray/internal/logger"
+)
+
+var finalizeLog = logger.For("finalize")
+
+// Finalizing swaps the transcoded file in for the original in steps that can
+// each be redone after a crash:
+//
+//  1. the temp output is moved (or copied) to a hidden staged file next to
+//     the original and fsynced
+//  2. a journal describing the swap is written next to it
+//  3. the original is renamed to .old (keep mode) or moved into the trash
+//     (replace mode with TrashPath, copied if the trash is on another
+//     filesystem), the staged file is renamed over the final path,
+//     and otherwise in replace mode an original with a different extension
+//     is removed
+//  4. the journal is removed
+//
+// A crash before the journal exists leaves the original untouched; after it,
+// RecoverFinalize rolls the swap forward from the staged copy.
+
+// finalizeJournal records an in-progress swap
+type finalizeJournal struct {
+	Input  string `json:"input"`
+	Staged string `json:"staged"`
+	Final  string `json:"final"`
+	Old    string `json:"old,omitempty"` // Set in keep mode, or to the trash path
+}
+
+// FinalizeOptions controls how the transcoded file replaces the original
+type FinalizeOptions struct {
+	// Replace deletes the original; otherwise it is kept as <name>.old
+	Replace bool
+	// PreserveOwnership copies the original's owner, group and permissions
+	PreserveOwnership bool
+	// PreserveMTime copies the original's modification time
+	PreserveMTime bool
+	// Ext is the finished file's extension (see OutputExt); empty = .mkv
+	Ext string
+	// TrashPath, with Replace, is where the original is moved instead of
+	// being deleted
+	TrashPath string
+}
+
+// finalizePaths returns the final, staged and journal paths for an input
+func finalizePaths(inputPath, ext string) (finalPath, stagedPath, journalPath string) {
+	if ext == "" {
+		ext = ".mkv"
+	}
+	dir := filepath.Dir(inputPath)
+	base := filepath.Base(inputPath)
+	name := strings.TrimSuffix(base, filepath.Ext(base))
+	return filepath.Join(dir, name+ext),
+		filepath.Join(dir, "."+name+".shrinkray.staged"),
+		filepath.Join(dir, "."+name+".shrinkray.journal")
+}
+
+// FinalizeTranscode handles the original file based on the configured behavior
+// If opts.Replace, the output replaces the original (a different-extension original is deleted)
+// Otherwise (keep), renames original to .old and moves the output to the final location
+// The output is staged and fsynced next to the original before anything is
+// removed, so a crash at any point leaves either the original or the new
+// file in place. Ownership, permissions and mtime are copied per opts.
+func FinalizeTranscode(inputPath, tempPath string, opts FinalizeOptions) (finalPath string, err error) {
+	finalPath, stagedPath, journalPath := finalizePaths(inputPath, opts.Ext)
+
+	inputInfo, err := os.Stat(inputPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat input file: %w", err)
+	}
+
+	if err := stageFile(tempPath, stagedPath); err != nil {
+		os.Remove(stagedPath)
+		return "", fmt.Errorf("failed to copy temp to final location: %w", err)
+	}
+	if opts.PreserveOwnership {
+		if err := os.Chmod(stagedPath, inputInfo.Mode().Perm()); err != nil {
+			finalizeLog.Warn("Could not copy permissions", "path", finalPath, "error", err)
+		}
+		if err := copyOwner(stagedPath, inputInfo); err != nil {
+			finalizeLog.Warn("Could not copy owner", "path", finalPath, "error", err)
+		}
+	}
+	if opts.PreserveMTime {
+		_ = os.Chtimes(stagedPath, inputInfo.ModTime(), inputInfo.ModTime())
+	}
+
+	journal := finalizeJournal{Input: inputPath, Staged: stagedPath, Final: finalPath}
+	if !opts.Replace {
+		journal.Old = inputPath + ".old"
+	} else if opts.TrashPath != "" {
+		if err := os.MkdirAll(filepath.Dir(opts.TrashPath), 0755); err != nil {
+			os.Remove(stagedPath)
+			return "", fmt.Errorf("failed to create trash folder: %w", err)
+		}
+		journal.Old = opts.TrashPath
+	}
+	if err := writeJournal(journalPath, journal); err != nil {
+		os.Remove(stagedPath)
+		return "", fmt.Errorf("failed to write finalize journal: %w", err)
+	}
+
+	if err := journal.apply(); err != nil {
+		journal.rollback()
+		os.Remove(journalPath)
+		return "", err
+	}
+
+	os.Remove(journalPath)
+	syncDir(filepath.Dir(finalPath))
+	os.Remove(tempPath)
+	return finalPath, nil
+}
+
+// RecoverFinalize completes a swap interrupted by a crash. It returns the
+// final path if the job's output was put in place, or "" if there was
+// nothing to recover (a leftover staged file is removed).
+func RecoverFinalize(inputPath string) (string, error) {
+	_, stagedPath, journalPath := finalizePaths(inputPath, "")
+
+	data, err := os.ReadFile(journalPath)
+	if os.IsNotExist(err) {
+		// Crashed while staging: the original was never touched
+		os.Remove(stagedPath)
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var journal finalizeJournal
+	if err := json.Unmarshal(data, &journal); err != nil {
+		os.Remove(journalPath)
+		os.Remove(stagedPath)
+		return "", fmt.Errorf("discarding unreadable finalize journal %s: %w", journalPath, err)
+	}
+
+	if _, err := os.Stat(journal.Staged); os.IsNotExist(err) {
+		if _, err := os.Stat(journal.Final); err != nil {
+			os.Remove(journalPath)
+			return "", fmt.Errorf("finalize journal %s has neither staged nor final file", journalPath)
+		}
+	}
+
+	if err := journal.apply(); err != nil {
+		return "", err
+	}
+	os.Remove(journalPath)
+	syncDir(filepath.Dir(journal.Final))
+	return journal.Final, nil
+}
+
+// apply performs the swap. It is safe to run again after a partial run.
+func (j finalizeJournal) apply() error {
+	if _, err := os.Stat(j.Staged); err == nil {
+		if j.Old != "" {
+			if _, err := os.Stat(j.Input); err == nil {
+				if err := MoveFile(j.Input, j.Old); err != nil {
+					return fmt.Errorf("failed to move original aside: %w", err)
+				}
+			}
+		}
+		if err := os.Rename(j.Staged, j.Final); err != nil {
+			return fmt.Errorf("failed to move output to final location: %w", err)
+		}
+	}
+
+	if j.Old == "" && j.Input != j.Final {
+		if err := os.Remove(j.Input); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove original file: %w", err)
+		}
+	}
+	return nil
+}
+
+// rollback undoes a failed apply, restoring the original
+func (j finalizeJournal) rollback() {
+	if j.Old != "" {
+		if _, err := os.Stat(j.Input); os.IsNotExist(err) {
+			_ = MoveFile(j.Old, j.Input)
+		}
+	}
+	os.Remove(j.Staged)
+}
+
+// stageFile moves src to dst, copying when they're on different filesystems,
+// and fsyncs the result
+func stageFile(src, dst string) error {
+	if err := os.Rename(src, dst); err != nil {
+		return copyFile(src, dst)
+	}
+
+	f, err := os.Open(dst)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
+
+// MoveFile renames src to dst. When they are on different filesystems, e.g.
+// a trash folder on another mount than the media, it copies src instead and
+// then deletes it, keeping its permissions, owner and modification time.
+func MoveFile(src, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil || !crossDevice(err) {
+		return err
+	}
+	return copyAndRemove(src, dst)
+}
+
+// copyAndRemove is MoveFile's cross-filesystem fallback. src is only
+// removed once dst is fully written, so a crash leaves both.
+func copyAndRemove(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if err := copyFile(src, dst); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	if err := os.Chmod(dst, info.Mode().Perm()); err != nil {
+		finalizeLog.Warn("Could not copy permissions", "path", dst, "error", err)
+	}
+	if err := copyOwner(dst, info); err != nil {
+		finalizeLog.Warn("Could not copy owner", "path", dst, "error", err)
+	}
+	_ = os.Chtimes(dst, info.ModTime(), info.ModTime())
+	syncDir(filepath.Dir(dst))
+	return os.Remove(src)
+}
+
+// copyFile copies a file from src to dst and fsyncs it.
+// Works across filesystems unlike os.Rename.
+func copyFile(src, dst string) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	dstFile, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer dstFile.Close()
+
+	if _, err := io.Copy(dstFile, srcFile); err != nil {
+		return err
+	}
+	if err := dstFile.Sync(); err != nil {
+		return err
+	}
+
+	return dstFile.Close()
+}
+
+// writeJournal durably writes the journal before any original is touched
+func writeJournal(path string, journal finalizeJournal) error {
+	data, err := json.Marshal(journal)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	syncDir(filepath.Dir(path))
+	return nil
+}
+
+// syncDir flushes directory entries (renames) to disk where supported
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
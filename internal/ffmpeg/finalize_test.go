@@ -0,0 +1,52 @@
+package ffmpeg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMoveFileCopyFallback(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "media", "Film.mkv")
+	dst := filepath.Join(dir, "trash", "job-1", "Film.mkv")
+	for _, d := range []string{filepath.Dir(src), filepath.Dir(dst)} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(src, []byte("original"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(src, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	// The path taken when src and dst are on different filesystems
+	if err := copyAndRemove(src, dst); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Error("expected the source to be removed after copying")
+	}
+	info, err := os.Stat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := os.ReadFile(dst); string(content) != "original" {
+		t.Errorf("copied content = %q", content)
+	}
+	if info.Mode().Perm() != 0600 || !info.ModTime().Equal(mtime) {
+		t.Errorf("expected mode 0600 and mtime %v, got %v and %v", mtime, info.Mode().Perm(), info.ModTime())
+	}
+
+	// Same filesystem: a plain rename
+	if err := MoveFile(dst, src); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(src); err != nil {
+		t.Errorf("expected the file back at %s: %v", src, err)
+	}
+}
@@ -0,0 +1,30 @@
+//go:build !windows
+
+package ffmpeg
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// copyOwner gives path the uid and gid of the file described by src. Without
+// root the owner usually can't change, but the group can if we're a member.
+func copyOwner(path string, src os.FileInfo) error {
+	stat, ok := src.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	if err := os.Lchown(path, int(stat.Uid), int(stat.Gid)); err != nil {
+		if os.Lchown(path, -1, int(stat.Gid)) != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// crossDevice reports whether a rename failed because source and
+// destination are on different filesystems
+func crossDevice(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
@@ -0,0 +1,22 @@
+package ffmpeg
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// errorNotSameDevice is ERROR_NOT_SAME_DEVICE, returned when moving a file
+// to another volume
+const errorNotSameDevice = syscall.Errno(17)
+
+// copyOwner does nothing: Windows files have ACLs rather than a uid and gid
+func copyOwner(path string, src os.FileInfo) error {
+	return nil
+}
+
+// crossDevice reports whether a rename failed because source and
+// destination are on different volumes
+func crossDevice(err error) bool {
+	return errors.Is(err, errorNotSameDevice)
+}
@@ -0,0 +1,293 @@
+package ffmpeg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// HDRFormat identifies the kind of high dynamic range signal in a video stream
+type HDRFormat string
+
+const (
+	HDRFormatHDR10       HDRFormat = "hdr10"
+	HDRFormatHDR10Plus   HDRFormat = "hdr10plus"
+	HDRFormatHLG         HDRFormat = "hlg"
+	HDRFormatDolbyVision HDRFormat = "dolby_vision"
+)
+
+// HDRHandling is the policy applied to HDR sources
+type HDRHandling string
+
+const (
+	HDRHandlingPreserve HDRHandling = "preserve" // Keep HDR10 signalling and static metadata
+	HDRHandlingTonemap  HDRHandling = "tonemap"  // Convert to SDR BT.709 (software encode)
+	HDRHandlingSkip     HDRHandling = "skip"     // Leave HDR files untouched
+)
+
+// NormalizeHDRHandling maps a config value to a known policy, defaulting to preserve
+func NormalizeHDRHandling(value string) HDRHandling {
+	switch HDRHandling(strings.ToLower(value)) {
+	case HDRHandlingTonemap:
+		return HDRHandlingTonemap
+	case HDRHandlingSkip:
+		return HDRHandlingSkip
+	default:
+		return HDRHandlingPreserve
+	}
+}
+
+// MasteringDisplay holds SMPTE ST 2086 mastering display metadata.
+// Chromaticities are CIE 1931 xy coordinates, luminance is in cd/m².
+type MasteringDisplay struct {
+	RedX, RedY     float64
+	GreenX, GreenY float64
+	BlueX, BlueY   float64
+	WhiteX, WhiteY float64
+	MaxLuminance   float64
+	MinLuminance   float64
+}
+
+// HDRInfo describes the HDR characteristics of the primary video stream
+type HDRInfo struct {
+	Format           HDRFormat         `json:"format"`
+	Transfer         string            `json:"transfer"`                    // color_transfer (smpte2084, arib-std-b67)
+	DVProfile        int               `json:"dv_profile,omitempty"`        // Dolby Vision profile (5, 7, 8...)
+	DVCompatibility  int               `json:"dv_compatibility,omitempty"`  // dv_bl_signal_compatibility_id
+	HDR10Plus        bool              `json:"hdr10plus,omitempty"`         // SMPTE 2094-40 dynamic metadata present
+	MasteringDisplay *MasteringDisplay `json:"mastering_display,omitempty"` // Static mastering display metadata
+	MaxCLL           int               `json:"max_cll,omitempty"`           // Maximum content light level
+	MaxFALL          int               `json:"max_fall,omitempty"`          // Maximum frame-average light level
+}
+
+// HasHDR10Fallback reports whether the base layer can be decoded as plain
+// HDR10/HLG. Dolby Vision profile 5 uses a proprietary IPT-PQ colour space
+// with no fallback, so re-encoding it produces purple/green garbage.
+func (h *HDRInfo) HasHDR10Fallback() bool {
+	if h.Format != HDRFormatDolbyVision {
+		return true
+	}
+	if h.DVProfile == 5 {
+		return false
+	}
+	if h.DVProfile == 0 {
+		// No configuration record; trust the stream's transfer tag
+		return isHDRTransfer(h.Transfer)
+	}
+	return h.DVCompatibility != 0
+}
+
+// ffprobeSideData is a single entry in ffprobe's side_data_list
+type ffprobeSideData struct {
+	SideDataType string `json:"side_data_type"`
+
+	// DOVI configuration record
+	DVProfile        int `json:"dv_profile"`
+	DVBLSignalCompat int `json:"dv_bl_signal_compatibility_id"`
+
+	// Mastering display metadata (rationals like "34000/50000")
+	RedX         string `json:"red_x"`
+	RedY         string `json:"red_y"`
+	GreenX       string `json:"green_x"`
+	GreenY       string `json:"green_y"`
+	BlueX        string `json:"blue_x"`
+	BlueY        string `json:"blue_y"`
+	WhitePointX  string `json:"white_point_x"`
+	WhitePointY  string `json:"white_point_y"`
+	MinLuminance string `json:"min_luminance"`
+	MaxLuminance string `json:"max_luminance"`
+
+	// Content light level metadata
+	MaxContent int `json:"max_content"`
+	MaxAverage int `json:"max_average"`
+}
+
+// isHDRTransfer returns true for PQ and HLG transfer characteristics
+func isHDRTransfer(transfer string) bool {
+	return transfer == "smpte2084" || transfer == "arib-std-b67"
+}
+
+// detectHDR builds HDRInfo from stream-level fields. Returns nil for SDR.
+func detectHDR(transfer string, sideData []ffprobeSideData) *HDRInfo {
+	info := &HDRInfo{Transfer: transfer}
+	switch transfer {
+	case "smpte2084":
+		info.Format = HDRFormatHDR10
+	case "arib-std-b67":
+		info.Format = HDRFormatHLG
+	}
+
+	applySideData(info, sideData)
+
+	if info.Format == "" {
+		return nil
+	}
+	return info
+}
+
+// applySideData merges stream or frame side data into info
+func applySideData(info *HDRInfo, sideData []ffprobeSideData) {
+	for _, sd := range sideData {
+		switch {
+		case strings.Contains(sd.SideDataType, "DOVI"), strings.Contains(sd.SideDataType, "Dolby Vision"):
+			info.Format = HDRFormatDolbyVision
+			if sd.DVProfile > 0 {
+				info.DVProfile = sd.DVProfile
+				info.DVCompatibility = sd.DVBLSignalCompat
+			}
+		case strings.Contains(sd.SideDataType, "2094-40"), strings.Contains(sd.SideDataType, "HDR10+"):
+			info.HDR10Plus = true
+			if info.Format == HDRFormatHDR10 {
+				info.Format = HDRFormatHDR10Plus
+			}
+		case strings.Contains(sd.SideDataType, "Mastering display"):
+			info.MasteringDisplay = &MasteringDisplay{
+				RedX: parseRational(sd.RedX), RedY: parseRational(sd.RedY),
+				GreenX: parseRational(sd.GreenX), GreenY: parseRational(sd.GreenY),
+				BlueX: parseRational(sd.BlueX), BlueY: parseRational(sd.BlueY),
+				WhiteX: parseRational(sd.WhitePointX), WhiteY: parseRational(sd.WhitePointY),
+				MaxLuminance: parseRational(sd.MaxLuminance),
+				MinLuminance: parseRational(sd.MinLuminance),
+			}
+		case strings.Contains(sd.SideDataType, "Content light level"):
+			info.MaxCLL = sd.MaxContent
+			info.MaxFALL = sd.MaxAverage
+		}
+	}
+}
+
+// parseRational parses "num/den" or a plain number
+func parseRational(s string) float64 {
+	if num, den, ok := strings.Cut(s, "/"); ok {
+		n, _ := strconv.ParseFloat(num, 64)
+		d, _ := strconv.ParseFloat(den, 64)
+		if d == 0 {
+			return 0
+		}
+		return n / d
+	}
+	f, _ := strconv.ParseFloat(s, 64)
+	return f
+}
+
+// probeHDRFrameData reads side data from the first video frame. Mastering
+// display, content light level and HDR10+ metadata are only exposed per
+// frame, so this is a separate (cheap, single-frame) ffprobe call.
+func (p *Prober) probeHDRFrameData(ctx context.Context, path string, info *HDRInfo) {
+	cmd := exec.CommandContext(ctx, p.ffprobePath,
+		"-v", "quiet",
+		"-print_format", "json",
+		"-select_streams", "v:0",
+		"-read_intervals", "%+#1",
+		"-show_frames",
+		"-show_entries", "frame=side_data_list",
+		path,
+	)
+
+	output, err := cmd.Output()
+	if err != nil {
+		return
+	}
+
+	var frames struct {
+		Frames []struct {
+			SideDataList []ffprobeSideData `json:"side_data_list"`
+		} `json:"frames"`
+	}
+	if err := json.Unmarshal(output, &frames); err != nil {
+		return
+	}
+	for _, frame := range frames.Frames {
+		applySideData(info, frame.SideDataList)
+	}
+}
+
+// x265MasterDisplay formats mastering display metadata for x265's
+// master-display option (chromaticity in 0.00002 units, luminance in 0.0001).
+func (m *MasteringDisplay) x265MasterDisplay() string {
+	c := func(v float64) int { return int(v*50000 + 0.5) }
+	l := func(v float64) int { return int(v*10000 + 0.5) }
+	return fmt.Sprintf("G(%d,%d)B(%d,%d)R(%d,%d)WP(%d,%d)L(%d,%d)",
+		c(m.GreenX), c(m.GreenY), c(m.BlueX), c(m.BlueY), c(m.RedX), c(m.RedY),
+		c(m.WhiteX), c(m.WhiteY), l(m.MaxLuminance), l(m.MinLuminance))
+}
+
+// svtMasterDisplay formats mastering display metadata for SVT-AV1
+func (m *MasteringDisplay) svtMasterDisplay() string {
+	return fmt.Sprintf("G(%.4f,%.4f)B(%.4f,%.4f)R(%.4f,%.4f)WP(%.4f,%.4f)L(%.4f,%.4f)",
+		m.GreenX, m.GreenY, m.BlueX, m.BlueY, m.RedX, m.RedY,
+		m.WhiteX, m.WhiteY, m.MaxLuminance, m.MinLuminance)
+}
+
+// tonemapFilter converts PQ/HLG BT.2020 to SDR BT.709 using zscale + tonemap
+const tonemapFilter = "zscale=t=linear:npl=100,format=gbrpf32le,zscale=p=bt709," +
+	"tonemap=tonemap=hable:desat=0,zscale=t=bt709:m=bt709:r=tv,format=yuv420p"
+
+// ApplyHDRArgs adjusts output args built by BuildPresetArgs for an HDR source.
+// For preserve it adds colour signalling and static metadata for the encoder
+// (10-bit output itself comes from BuildPresetArgs via the source bit depth);
+// for tonemap it prepends the tone-mapping chain to the video filter.
+// Tone mapping runs on the CPU, so callers should use a software preset.
+func ApplyHDRArgs(outputArgs []string, preset *Preset, hdr *HDRInfo, handling HDRHandling) []string {
+	// A remux copies the video, HDR metadata included
+	if hdr == nil || preset.Codec == CodecCopy {
+		return outputArgs
+	}
+
+	if handling == HDRHandlingTonemap {
+		for i, arg := range outputArgs {
+			if arg == "-filter:v:0" && i+1 < len(outputArgs) {
+				outputArgs[i+1] = tonemapFilter + "," + outputArgs[i+1]
+				return append(outputArgs,
+					"-color_primaries:v:0", "bt709", "-color_trc:v:0", "bt709", "-colorspace:v:0", "bt709")
+			}
+		}
+		return append(outputArgs,
+			"-filter:v:0", tonemapFilter,
+			"-color_primaries:v:0", "bt709", "-color_trc:v:0", "bt709", "-colorspace:v:0", "bt709")
+	}
+
+	transfer := hdr.Transfer
+	if !isHDRTransfer(transfer) {
+		transfer = "smpte2084"
+	}
+
+	// Container/bitstream colour tags - understood by every encoder
+	outputArgs = append(outputArgs,
+		"-color_primaries:v:0", "bt2020",
+		"-color_trc:v:0", transfer,
+		"-colorspace:v:0", "bt2020nc",
+	)
+
+	key := EncoderKey{preset.Encoder, preset.Codec}
+	config, ok := encoderConfigs[key]
+	if !ok {
+		config = encoderConfigs[EncoderKey{HWAccelNone, preset.Codec}]
+	}
+
+	switch config.encoder {
+	case "libx265":
+		params := []string{"hdr-opt=1", "repeat-headers=1", "colorprim=bt2020", "transfer=" + transfer, "colormatrix=bt2020nc"}
+		if hdr.MasteringDisplay != nil {
+			params = append(params, "master-display="+hdr.MasteringDisplay.x265MasterDisplay())
+		}
+		if hdr.MaxCLL > 0 || hdr.MaxFALL > 0 {
+			params = append(params, fmt.Sprintf("max-cll=%d,%d", hdr.MaxCLL, hdr.MaxFALL))
+		}
+		outputArgs = appendEncoderParams(outputArgs, "-x265-params", params...)
+	case "libsvtav1":
+		var params []string
+		if hdr.MasteringDisplay != nil {
+			params = append(params, "mastering-display="+hdr.MasteringDisplay.svtMasterDisplay())
+		}
+		if hdr.MaxCLL > 0 || hdr.MaxFALL > 0 {
+			params = append(params, fmt.Sprintf("content-light=%d,%d", hdr.MaxCLL, hdr.MaxFALL))
+		}
+		outputArgs = appendEncoderParams(outputArgs, "-svtav1-params", params...)
+	}
+
+	return outputArgs
+}
@@ -0,0 +1,139 @@
+package ffmpeg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDetectHDR(t *testing.T) {
+	tests := []struct {
+		name     string
+		transfer string
+		sideData []ffprobeSideData
+		want     HDRFormat
+	}{
+		{"sdr", "bt709", nil, ""},
+		{"untagged", "", nil, ""},
+		{"hdr10", "smpte2084", nil, HDRFormatHDR10},
+		{"hlg", "arib-std-b67", nil, HDRFormatHLG},
+		{"dolby vision", "smpte2084", []ffprobeSideData{{SideDataType: "DOVI configuration record", DVProfile: 8, DVBLSignalCompat: 1}}, HDRFormatDolbyVision},
+		{"dolby vision p5 untagged", "", []ffprobeSideData{{SideDataType: "DOVI configuration record", DVProfile: 5}}, HDRFormatDolbyVision},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := detectHDR(tt.transfer, tt.sideData)
+			if tt.want == "" {
+				if got != nil {
+					t.Errorf("expected SDR, got %+v", got)
+				}
+				return
+			}
+			if got == nil || got.Format != tt.want {
+				t.Errorf("expected %s, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestApplySideDataFrameMetadata(t *testing.T) {
+	info := detectHDR("smpte2084", nil)
+	applySideData(info, []ffprobeSideData{
+		{
+			SideDataType: "Mastering display metadata",
+			RedX:         "34000/50000", RedY: "16000/50000",
+			GreenX: "13250/50000", GreenY: "34500/50000",
+			BlueX: "7500/50000", BlueY: "3000/50000",
+			WhitePointX: "15635/50000", WhitePointY: "16450/50000",
+			MinLuminance: "50/10000", MaxLuminance: "10000000/10000",
+		},
+		{SideDataType: "Content light level metadata", MaxContent: 1000, MaxAverage: 400},
+		{SideDataType: "HDR Dynamic Metadata SMPTE2094-40 (HDR10+)"},
+	})
+
+	if info.Format != HDRFormatHDR10Plus || !info.HDR10Plus {
+		t.Errorf("expected HDR10+, got %s", info.Format)
+	}
+	if info.MaxCLL != 1000 || info.MaxFALL != 400 {
+		t.Errorf("unexpected light levels: %d/%d", info.MaxCLL, info.MaxFALL)
+	}
+
+	want := "G(13250,34500)B(7500,3000)R(34000,16000)WP(15635,16450)L(10000000,50)"
+	if got := info.MasteringDisplay.x265MasterDisplay(); got != want {
+		t.Errorf("x265 master-display = %s, want %s", got, want)
+	}
+}
+
+func TestHasHDR10Fallback(t *testing.T) {
+	tests := []struct {
+		info HDRInfo
+		want bool
+	}{
+		{HDRInfo{Format: HDRFormatHDR10}, true},
+		{HDRInfo{Format: HDRFormatDolbyVision, DVProfile: 5}, false},
+		{HDRInfo{Format: HDRFormatDolbyVision, DVProfile: 8, DVCompatibility: 1}, true},
+		{HDRInfo{Format: HDRFormatDolbyVision, Transfer: "smpte2084"}, true},
+		{HDRInfo{Format: HDRFormatDolbyVision}, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.info.HasHDR10Fallback(); got != tt.want {
+			t.Errorf("HasHDR10Fallback(%+v) = %v, want %v", tt.info, got, tt.want)
+		}
+	}
+}
+
+func TestApplyHDRArgsPreserveX265(t *testing.T) {
+	preset := &Preset{ID: "compress-hevc", Encoder: HWAccelNone, Codec: CodecHEVC}
+	hdr := &HDRInfo{Format: HDRFormatHDR10, Transfer: "smpte2084", MaxCLL: 1000, MaxFALL: 400}
+
+	_, outputArgs := BuildPresetArgs(preset, 0, nil, "convert", 10, "yuv420p10le", "hevc", 0, 0)
+	outputArgs = ApplyHDRArgs(outputArgs, preset, hdr, HDRHandlingPreserve)
+	args := strings.Join(outputArgs, " ")
+
+	for _, want := range []string{
+		"-color_trc:v:0 smpte2084",
+		"-color_primaries:v:0 bt2020",
+		"-pix_fmt:v:0 yuv420p10le",
+		"hdr-opt=1",
+		"max-cll=1000,400",
+	} {
+		if !strings.Contains(args, want) {
+			t.Errorf("expected %q in args: %s", want, args)
+		}
+	}
+}
+
+func TestApplyHDRArgsTonemap(t *testing.T) {
+	preset := &Preset{ID: "1080p", Encoder: HWAccelNone, Codec: CodecHEVC, MaxHeight: 1080}
+	hdr := &HDRInfo{Format: HDRFormatHDR10, Transfer: "smpte2084"}
+
+	_, outputArgs := BuildPresetArgs(preset, 0, nil, "convert", 10, "yuv420p10le", "hevc", 0, 0)
+	outputArgs = ApplyHDRArgs(outputArgs, preset, hdr, HDRHandlingTonemap)
+
+	filters := 0
+	for i, arg := range outputArgs {
+		if arg == "-filter:v:0" {
+			filters++
+			filter := outputArgs[i+1]
+			if !strings.HasPrefix(filter, "zscale=t=linear") || !strings.Contains(filter, "scale=-2") {
+				t.Errorf("expected tonemap chain followed by scale, got %s", filter)
+			}
+		}
+	}
+	if filters != 1 {
+		t.Errorf("expected exactly one video filter, got %d", filters)
+	}
+	if !strings.Contains(strings.Join(outputArgs, " "), "-color_trc:v:0 bt709") {
+		t.Error("expected SDR colour tags after tone mapping")
+	}
+}
+
+func TestApplyHDRArgsSDRUnchanged(t *testing.T) {
+	preset := &Preset{ID: "compress-hevc", Encoder: HWAccelNone, Codec: CodecHEVC}
+	_, outputArgs := BuildPresetArgs(preset, 0, nil, "convert", 8, "yuv420p", "h264", 0, 0)
+	before := len(outputArgs)
+	if got := ApplyHDRArgs(outputArgs, preset, nil, HDRHandlingTonemap); len(got) != before {
+		t.Errorf("expected SDR args unchanged, got %v", got)
+	}
+}
@@ -2,14 +2,23 @@ package ffmpeg
 
 import (
 	"context"
-	"log"
+	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/gwlsn/shrinkray/internal/logger"
+)
+
+var (
+	detectLog = logger.For("encoder-detect")
+	vaapiLog  = logger.For("vaapi-health")
 )
 
 // HWAccel represents a hardware acceleration method
@@ -23,12 +32,25 @@ const (
 	HWAccelVAAPI        HWAccel = "vaapi"        // Linux VA-API (Intel/AMD)
 )
 
+// ParseHWAccel returns the encoder named by value, or false if it isn't one
+func ParseHWAccel(value string) (HWAccel, bool) {
+	switch accel := HWAccel(strings.ToLower(strings.TrimSpace(value))); accel {
+	case HWAccelNone, HWAccelVideoToolbox, HWAccelNVENC, HWAccelQSV, HWAccelVAAPI:
+		return accel, true
+	}
+	return "", false
+}
+
 // Codec represents the target video codec
 type Codec string
 
 const (
 	CodecHEVC Codec = "hevc"
 	CodecAV1  Codec = "av1"
+
+	// CodecCopy keeps the source video: the preset only rewraps the streams
+	// into a new container (see IsRemuxPreset)
+	CodecCopy Codec = "copy"
 )
 
 // HWEncoder contains info about a hardware encoder
@@ -39,6 +61,9 @@ type HWEncoder struct {
 	Description string  `json:"description"`
 	Encoder     string  `json:"encoder"` // FFmpeg encoder name (e.g., hevc_videotoolbox)
 	Available   bool    `json:"available"`
+	// Supports10Bit is true if the encoder accepted a 10-bit (P010) test frame.
+	// Older GPUs (e.g. pre-Pascal NVENC, pre-Kaby Lake QSV) are 8-bit only.
+	Supports10Bit bool `json:"supports_10bit"`
 }
 
 // EncoderKey uniquely identifies an encoder by accel + codec
@@ -51,8 +76,16 @@ type EncoderKey struct {
 type AvailableEncoders struct {
 	mu          sync.RWMutex
 	encoders    map[EncoderKey]*HWEncoder
-	detected    bool
-	vaapiDevice string // Auto-detected VAAPI device path (e.g., /dev/dri/renderD128)
+	detected    atomic.Bool // Set once detection finishes; read without mu
+	vaapiDevice string      // Auto-detected VAAPI device path (e.g., /dev/dri/renderD128)
+	devices     []GPUDevice
+}
+
+// GPUDevice is a GPU hardware encoders can run on
+type GPUDevice struct {
+	ID    string     `json:"id"`              // Render node (e.g. /dev/dri/renderD128) or CUDA device (e.g. cuda:0)
+	Accel HWAccel    `json:"accel"`           // vaapi (render nodes, also used by Quick Sync) or nvenc
+	VAAPI *VAAPIInfo `json:"vaapi,omitempty"` // Driver and encode profiles of a render node, if vainfo is installed
 }
 
 // Global encoder detection cache
@@ -138,17 +171,53 @@ var allEncoderDefs = []*HWEncoder{
 	},
 }
 
-// DetectEncoders probes FFmpeg to detect available hardware encoders
+// DetectEncoders probes FFmpeg to detect available hardware encoders.
+// Results are cached; use RedetectEncoders to probe again.
 func DetectEncoders(ffmpegPath string) map[EncoderKey]*HWEncoder {
 	availableEncoders.mu.Lock()
 	defer availableEncoders.mu.Unlock()
 
 	// Return cached results if already detected
-	if availableEncoders.detected {
+	if availableEncoders.detected.Load() {
 		return copyEncoders(availableEncoders.encoders)
 	}
 
-	log.Println("[encoder-detect] Starting hardware encoder detection...")
+	availableEncoders.encoders, availableEncoders.vaapiDevice = detectEncoders(ffmpegPath)
+	availableEncoders.devices = detectDevices()
+	availableEncoders.detected.Store(true)
+	return copyEncoders(availableEncoders.encoders)
+}
+
+// redetectMu serializes RedetectEncoders calls
+var redetectMu sync.Mutex
+
+// RedetectEncoders discards the cached detection and probes FFmpeg again,
+// e.g. after a GPU is added or drivers are fixed. The previous results stay
+// in use until the new ones are ready. Call InitPresets afterwards so
+// presets pick up the change.
+func RedetectEncoders(ffmpegPath string) map[EncoderKey]*HWEncoder {
+	redetectMu.Lock()
+	defer redetectMu.Unlock()
+
+	encoders, vaapiDevice := detectEncoders(ffmpegPath)
+	devices := detectDevices()
+
+	availableEncoders.mu.Lock()
+	defer availableEncoders.mu.Unlock()
+	availableEncoders.encoders = encoders
+	availableEncoders.vaapiDevice = vaapiDevice
+	availableEncoders.devices = devices
+	availableEncoders.detected.Store(true)
+	return copyEncoders(encoders)
+}
+
+// detectEncoders lists ffmpeg's encoders and test-encodes with each hardware
+// one. Returns the encoders and the VAAPI render node they were tested on.
+func detectEncoders(ffmpegPath string) (map[EncoderKey]*HWEncoder, string) {
+	encoders := make(map[EncoderKey]*HWEncoder)
+	vaapiDevice := detectVAAPIDevice()
+
+	detectLog.Info("Starting hardware encoder detection")
 
 	// Get list of available encoders from ffmpeg
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -157,18 +226,18 @@ func DetectEncoders(ffmpegPath string) map[EncoderKey]*HWEncoder {
 	cmd := exec.CommandContext(ctx, ffmpegPath, "-encoders", "-hide_banner")
 	output, err := cmd.Output()
 	if err != nil {
-		log.Printf("[encoder-detect] Failed to query ffmpeg encoders: %v", err)
+		detectLog.Warn("Failed to query ffmpeg encoders", "error", err)
 		// Fallback to software only
-		availableEncoders.encoders[EncoderKey{HWAccelNone, CodecHEVC}] = &HWEncoder{
-			Accel:       HWAccelNone,
-			Codec:       CodecHEVC,
-			Name:        "Software HEVC",
-			Description: "CPU-based HEVC encoding",
-			Encoder:     "libx265",
-			Available:   true,
+		encoders[EncoderKey{HWAccelNone, CodecHEVC}] = &HWEncoder{
+			Accel:         HWAccelNone,
+			Codec:         CodecHEVC,
+			Name:          "Software HEVC",
+			Description:   "CPU-based HEVC encoding",
+			Encoder:       "libx265",
+			Available:     true,
+			Supports10Bit: true,
 		}
-		availableEncoders.detected = true
-		return copyEncoders(availableEncoders.encoders)
+		return encoders, vaapiDevice
 	}
 
 	encoderList := string(output)
@@ -180,48 +249,60 @@ func DetectEncoders(ffmpegPath string) map[EncoderKey]*HWEncoder {
 
 		// First check if encoder exists in ffmpeg
 		if !strings.Contains(encoderList, enc.Encoder) {
-			log.Printf("[encoder-detect] %s: not listed in ffmpeg", enc.Encoder)
+			detectLog.Info("Encoder not listed in ffmpeg", "encoder", enc.Encoder)
 			encCopy.Available = false
-			availableEncoders.encoders[key] = &encCopy
+			encoders[key] = &encCopy
 			continue
 		}
 
 		if enc.Accel == HWAccelNone {
 			// Software encoders - just check if listed in ffmpeg
-			log.Printf("[encoder-detect] %s: available (software)", enc.Encoder)
+			detectLog.Info("Encoder available (software)", "encoder", enc.Encoder)
 			encCopy.Available = true
+			encCopy.Supports10Bit = true
 		} else {
 			// Hardware encoders - actually test if they work
-			available := testEncoder(ffmpegPath, enc.Encoder)
+			available := testEncoder(ffmpegPath, enc.Encoder, vaapiDevice, false)
 			if available {
-				log.Printf("[encoder-detect] %s: AVAILABLE (test encode passed)", enc.Encoder)
+				detectLog.Info("Encoder available (test encode passed)", "encoder", enc.Encoder)
+				encCopy.Supports10Bit = testEncoder(ffmpegPath, enc.Encoder, vaapiDevice, true)
+				if !encCopy.Supports10Bit {
+					detectLog.Info("Encoder is 8-bit only (10-bit test encode failed)", "encoder", enc.Encoder)
+				}
 			} else {
-				log.Printf("[encoder-detect] %s: not available (test encode failed)", enc.Encoder)
+				detectLog.Info("Encoder not available (test encode failed)", "encoder", enc.Encoder)
 			}
 			encCopy.Available = available
 		}
-		availableEncoders.encoders[key] = &encCopy
+		encoders[key] = &encCopy
 	}
 
 	// Log summary of detected encoders
-	log.Println("[encoder-detect] Detection complete. Available encoders:")
+	var best []any
 	for _, codec := range []Codec{CodecHEVC, CodecAV1} {
-		best := getBestEncoderForCodecInternal(availableEncoders.encoders, codec)
-		if best != nil {
-			log.Printf("[encoder-detect]   %s: %s (%s)", codec, best.Name, best.Encoder)
+		if enc := getBestEncoderForCodecInternal(encoders, codec); enc != nil {
+			best = append(best, string(codec), enc.Encoder)
 		}
 	}
+	detectLog.Info("Detection complete", best...)
 
-	availableEncoders.detected = true
-	return copyEncoders(availableEncoders.encoders)
+	return encoders, vaapiDevice
 }
 
 // detectVAAPIDevice finds the first available VAAPI render device
 func detectVAAPIDevice() string {
+	if devices := detectVAAPIDevices(); len(devices) > 0 {
+		return devices[0]
+	}
+	return ""
+}
+
+// detectVAAPIDevices lists the VAAPI render devices, in order
+func detectVAAPIDevices() []string {
 	driPath := "/dev/dri"
 	entries, err := os.ReadDir(driPath)
 	if err != nil {
-		return ""
+		return nil
 	}
 
 	// Collect all renderD* devices
@@ -234,16 +315,86 @@ func detectVAAPIDevice() string {
 
 	// Sort to get consistent ordering (renderD128, renderD129, etc.)
 	sort.Strings(devices)
+	return devices
+}
 
-	// Return the first one found
+// detectNVIDIADevices lists the CUDA devices (cuda:0, cuda:1, ...) from the
+// /dev/nvidiaN device files, falling back to counting nvidia-smi's GPUs
+func detectNVIDIADevices() []string {
+	var devices []string
+	entries, err := os.ReadDir("/dev")
+	if err == nil {
+		var indexes []int
+		for _, entry := range entries {
+			// nvidia0, nvidia1, ...; skips nvidiactl, nvidia-uvm and the like
+			suffix, ok := strings.CutPrefix(entry.Name(), "nvidia")
+			if index, err := strconv.Atoi(suffix); ok && err == nil && index >= 0 {
+				indexes = append(indexes, index)
+			}
+		}
+		sort.Ints(indexes)
+		for _, index := range indexes {
+			devices = append(devices, fmt.Sprintf("cuda:%d", index))
+		}
+	}
 	if len(devices) > 0 {
-		return devices[0]
+		return devices
 	}
-	return ""
+
+	smiPath, err := exec.LookPath("nvidia-smi")
+	if err != nil {
+		return nil
+	}
+	output, err := exec.Command(smiPath, "-L").Output()
+	if err != nil {
+		return nil
+	}
+	// nvidia-smi -L outputs lines like "GPU 0: NVIDIA GeForce RTX 3080 (UUID: ...)"
+	for _, line := range strings.Split(string(output), "\n") {
+		var index int
+		if _, err := fmt.Sscanf(strings.TrimSpace(line), "GPU %d:", &index); err == nil {
+			devices = append(devices, fmt.Sprintf("cuda:%d", index))
+		}
+	}
+	return devices
+}
+
+// vaapiSupport describes a driver's support for codec for logging
+func vaapiSupport(info *VAAPIInfo, codec Codec) string {
+	switch {
+	case info.CanEncode(codec, true):
+		return "8/10-bit"
+	case info.CanEncode(codec, false):
+		return "8-bit only"
+	}
+	return "no"
+}
+
+// detectDevices lists the GPUs hardware encoders can be spread across
+func detectDevices() []GPUDevice {
+	var devices []GPUDevice
+	for _, id := range detectVAAPIDevices() {
+		device := GPUDevice{ID: id, Accel: HWAccelVAAPI, VAAPI: queryVAAPIInfo(id)}
+		if info := device.VAAPI; info != nil {
+			detectLog.Info("Found VAAPI device", "device", id, "driver", info.Driver,
+				"hevc", vaapiSupport(info, CodecHEVC), "av1", vaapiSupport(info, CodecAV1),
+				"max", fmt.Sprintf("%dx%d", info.MaxWidth, info.MaxHeight))
+		}
+		devices = append(devices, device)
+	}
+	for _, id := range detectNVIDIADevices() {
+		devices = append(devices, GPUDevice{ID: id, Accel: HWAccelNVENC})
+	}
+	if len(devices) > 1 {
+		detectLog.Info("Found GPU devices", "count", len(devices))
+	}
+	return devices
 }
 
-// testEncoder tries a quick test encode to verify hardware encoder actually works
-func testEncoder(ffmpegPath string, encoder string) bool {
+// testEncoder tries a quick test encode to verify hardware encoder actually works.
+// VAAPI encoders are tested on vaapiDevice. If tenBit is set the test frame
+// is 10-bit (P010) to check for main10 support.
+func testEncoder(ffmpegPath string, encoder string, vaapiDevice string, tenBit bool) bool {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -251,21 +402,24 @@ func testEncoder(ffmpegPath string, encoder string) bool {
 	// This prevents false positives when CUDA libraries are installed but no GPU exists
 	if strings.Contains(encoder, "nvenc") {
 		if !hasNVIDIADevice() {
-			log.Printf("[encoder-detect] %s: skipped (no NVIDIA device found)", encoder)
+			detectLog.Info("Encoder skipped (no NVIDIA device found)", "encoder", encoder)
 			return false
 		}
 	}
 
 	var args []string
 
+	vaapiFormat, swFormat := "nv12", "yuv420p"
+	if tenBit {
+		vaapiFormat, swFormat = "p010", "p010le"
+	}
+
 	// For VAAPI encoders, we need to specify the device and upload frames to VAAPI memory
 	if strings.Contains(encoder, "vaapi") {
-		device := detectVAAPIDevice()
+		device := vaapiDevice
 		if device == "" {
 			return false // No VAAPI device found
 		}
-		// Store the detected device for later use
-		availableEncoders.vaapiDevice = device
 		// Build VAAPI-specific test command with hardware frame upload
 		// The filter chain converts to nv12 and uploads to VAAPI memory
 		args = []string{
@@ -273,7 +427,7 @@ func testEncoder(ffmpegPath string, encoder string) bool {
 			"-f", "lavfi",
 			"-i", "color=c=black:s=256x256:d=0.1",
 			"-frames:v", "1",
-			"-vf", "format=nv12,hwupload",
+			"-vf", "format=" + vaapiFormat + ",hwupload",
 			"-c:v", encoder,
 			"-f", "null",
 			"-",
@@ -284,6 +438,7 @@ func testEncoder(ffmpegPath string, encoder string) bool {
 			"-f", "lavfi",
 			"-i", "color=c=black:s=256x256:d=0.1",
 			"-frames:v", "1",
+			"-pix_fmt", swFormat,
 			"-c:v", encoder,
 			"-f", "null",
 			"-",
@@ -299,8 +454,8 @@ func testEncoder(ffmpegPath string, encoder string) bool {
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		// Log the failure reason for debugging
-		log.Printf("[encoder-detect] %s test failed: %v (output: %s)",
-			encoder, err, truncateOutput(string(output), 200))
+		detectLog.Info("Encoder test failed", "encoder", encoder, "error", err,
+			"output", truncateOutput(string(output), 200))
 		return false
 	}
 	return true
@@ -310,7 +465,7 @@ func testEncoder(ffmpegPath string, encoder string) bool {
 func hasNVIDIADevice() bool {
 	// Check for NVIDIA device files - this is the most reliable check
 	if _, err := os.Stat("/dev/nvidia0"); err == nil {
-		log.Println("[encoder-detect] Found /dev/nvidia0 - NVIDIA GPU present")
+		detectLog.Info("Found /dev/nvidia0, NVIDIA GPU present")
 		return true
 	}
 
@@ -319,21 +474,21 @@ func hasNVIDIADevice() bool {
 		cmd := exec.Command(smiPath, "-L")
 		output, err := cmd.Output()
 		if err != nil {
-			log.Printf("[encoder-detect] nvidia-smi -L failed: %v", err)
+			detectLog.Info("nvidia-smi -L failed", "error", err)
 			return false
 		}
 		// nvidia-smi -L outputs lines like "GPU 0: NVIDIA GeForce RTX 3080 (UUID: ...)"
 		// If no GPU, it outputs nothing or an error message
 		outputStr := strings.TrimSpace(string(output))
 		if outputStr == "" || !strings.Contains(strings.ToLower(outputStr), "gpu") {
-			log.Printf("[encoder-detect] nvidia-smi found but no GPU listed: %q", outputStr)
+			detectLog.Info("nvidia-smi found but no GPU listed", "output", outputStr)
 			return false
 		}
-		log.Printf("[encoder-detect] nvidia-smi found GPU: %s", strings.Split(outputStr, "\n")[0])
+		detectLog.Info("nvidia-smi found GPU", "gpu", strings.Split(outputStr, "\n")[0])
 		return true
 	}
 
-	log.Println("[encoder-detect] No NVIDIA device or nvidia-smi found")
+	detectLog.Info("No NVIDIA device or nvidia-smi found")
 	return false
 }
 
@@ -346,6 +501,13 @@ func truncateOutput(s string, maxLen int) string {
 	return s
 }
 
+// EncodersDetected reports whether encoder detection has finished. It is
+// false while the first DetectEncoders call is still probing, and stays true
+// while RedetectEncoders probes again.
+func EncodersDetected() bool {
+	return availableEncoders.detected.Load()
+}
+
 // GetAvailableEncoders returns all detected encoders (must call DetectEncoders first)
 func GetAvailableEncoders() map[EncoderKey]*HWEncoder {
 	availableEncoders.mu.RLock()
@@ -364,6 +526,81 @@ func GetVAAPIDevice() string {
 	return "/dev/dri/renderD128"
 }
 
+// ListDevices returns the detected GPU devices (must call DetectEncoders first)
+func ListDevices() []GPUDevice {
+	availableEncoders.mu.RLock()
+	defer availableEncoders.mu.RUnlock()
+	return append([]GPUDevice{}, availableEncoders.devices...)
+}
+
+// DevicesFor returns the devices an encoder can run on, in order. VAAPI and
+// Quick Sync share the render nodes. Falls back to the default device when
+// none were detected, and returns nil for encoders without a GPU device.
+func DevicesFor(accel HWAccel) []string {
+	family := deviceFamily(accel)
+	if family == "" {
+		return nil
+	}
+	var devices []string
+	for _, d := range ListDevices() {
+		if d.Accel == family {
+			devices = append(devices, d.ID)
+		}
+	}
+	if len(devices) == 0 {
+		devices = []string{DeviceFor(accel)}
+	}
+	return devices
+}
+
+// DeviceMatches reports whether device (a render node or cuda:N) is usable by accel
+func DeviceMatches(accel HWAccel, device string) bool {
+	switch deviceFamily(accel) {
+	case HWAccelVAAPI:
+		return strings.HasPrefix(device, "/dev/dri/")
+	case HWAccelNVENC:
+		_, ok := cudaIndex(device)
+		return ok
+	}
+	return false
+}
+
+// deviceFamily returns which kind of device accel runs on: vaapi for VAAPI
+// and Quick Sync, nvenc for NVENC, "" for encoders without a GPU device
+func deviceFamily(accel HWAccel) HWAccel {
+	switch accel {
+	case HWAccelVAAPI, HWAccelQSV:
+		return HWAccelVAAPI
+	case HWAccelNVENC:
+		return HWAccelNVENC
+	}
+	return ""
+}
+
+// cudaIndex returns N from a "cuda:N" device
+func cudaIndex(device string) (string, bool) {
+	index, ok := strings.CutPrefix(device, "cuda:")
+	if !ok {
+		return "", false
+	}
+	if n, err := strconv.Atoi(index); err != nil || n < 0 {
+		return "", false
+	}
+	return index, true
+}
+
+// DeviceFor returns the GPU device an encoder runs on: the render node for
+// VAAPI and Quick Sync, the default CUDA device for NVENC, "" otherwise
+func DeviceFor(accel HWAccel) string {
+	switch accel {
+	case HWAccelVAAPI, HWAccelQSV:
+		return GetVAAPIDevice()
+	case HWAccelNVENC:
+		return "cuda:0"
+	}
+	return ""
+}
+
 // GetEncoderByKey returns a specific encoder by accel type and codec
 func GetEncoderByKey(accel HWAccel, codec Codec) *HWEncoder {
 	availableEncoders.mu.RLock()
@@ -376,6 +613,20 @@ func GetEncoderByKey(accel HWAccel, codec Codec) *HWEncoder {
 	return nil
 }
 
+// Supports10Bit reports whether an encoder can produce 10-bit output.
+// Encoders that haven't been detected are assumed capable so behaviour is
+// unchanged before detection runs.
+func Supports10Bit(accel HWAccel, codec Codec) bool {
+	if accel == HWAccelNone {
+		return true
+	}
+	enc := GetEncoderByKey(accel, codec)
+	if enc == nil || !enc.Available {
+		return true
+	}
+	return enc.Supports10Bit
+}
+
 // IsEncoderAvailableForCodec checks if a specific encoder is available for a codec
 func IsEncoderAvailableForCodec(accel HWAccel, codec Codec) bool {
 	enc := GetEncoderByKey(accel, codec)
@@ -414,21 +665,23 @@ func GetBestEncoderForCodec(codec Codec) *HWEncoder {
 	// Fallback to software
 	if codec == CodecAV1 {
 		return &HWEncoder{
-			Accel:       HWAccelNone,
-			Codec:       CodecAV1,
-			Name:        "Software AV1",
-			Description: "CPU-based AV1 encoding",
-			Encoder:     "libsvtav1",
-			Available:   true,
+			Accel:         HWAccelNone,
+			Codec:         CodecAV1,
+			Name:          "Software AV1",
+			Description:   "CPU-based AV1 encoding",
+			Encoder:       "libsvtav1",
+			Available:     true,
+			Supports10Bit: true,
 		}
 	}
 	return &HWEncoder{
-		Accel:       HWAccelNone,
-		Codec:       CodecHEVC,
-		Name:        "Software HEVC",
-		Description: "CPU-based HEVC encoding",
-		Encoder:     "libx265",
-		Available:   true,
+		Accel:         HWAccelNone,
+		Codec:         CodecHEVC,
+		Name:          "Software HEVC",
+		Description:   "CPU-based HEVC encoding",
+		Encoder:       "libx265",
+		Available:     true,
+		Supports10Bit: true,
 	}
 }
 
@@ -576,21 +829,21 @@ func CheckVAAPIHealth(ffmpegPath string) *VAAPIHealthCheck {
 
 // LogVAAPIHealth logs VAAPI health check results for diagnostics
 func LogVAAPIHealth(health *VAAPIHealthCheck) {
-	log.Println("[vaapi-health] VAAPI Health Check:")
-	log.Printf("[vaapi-health]   Available: %v", health.Available)
+	attrs := []any{"available", health.Available}
 	if health.DevicePath != "" {
-		log.Printf("[vaapi-health]   Device: %s", health.DevicePath)
+		attrs = append(attrs, "device", health.DevicePath)
 	}
 	if health.Driver != "" {
-		log.Printf("[vaapi-health]   Driver: %s", health.Driver)
+		attrs = append(attrs, "driver", health.Driver)
 	}
 	if len(health.RenderDevices) > 0 {
-		log.Printf("[vaapi-health]   Render devices: %v", health.RenderDevices)
+		attrs = append(attrs, "render_devices", strings.Join(health.RenderDevices, ","))
 	}
+	vaapiLog.Info("VAAPI health check", attrs...)
 	for _, warning := range health.Warnings {
-		log.Printf("[vaapi-health]   WARNING: %s", warning)
+		vaapiLog.Warn(warning)
 	}
 	for _, err := range health.Errors {
-		log.Printf("[vaapi-health]   ERROR: %s", err)
+		vaapiLog.Error(err)
 	}
 }
@@ -0,0 +1,112 @@
+package ffmpeg
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// ProcessLimits restrict the ffmpeg processes a Transcoder runs, so software
+// encodes don't starve the host's other services. The zero value applies none.
+type ProcessLimits struct {
+	Nice        int    // 1-19; 0 leaves the priority unchanged
+	IOClass     string // "best-effort" or "idle"; "" leaves it unchanged
+	IOLevel     int    // 0 (highest) to 7, for the best-effort class
+	CPUAffinity string // CPUs ffmpeg may run on, in taskset list form, e.g. "0-3,6"
+
+	// MemoryLimitMB caps each ffmpeg process's memory through a cgroup v2
+	// created under CgroupDir, which must be writable with the memory
+	// controller enabled for its children
+	MemoryLimitMB int
+	CgroupDir     string
+}
+
+// ioClasses maps IOClass to ionice's class numbers
+var ioClasses = map[string]string{
+	"best-effort": "2",
+	"idle":        "3",
+}
+
+// warnedTools records missing limit tools already logged, so a missing
+// ionice is reported once rather than for every job
+var warnedTools sync.Map
+
+// command returns the program and arguments that run ffmpeg with args under
+// the nice, ionice and taskset limits. The tools exec ffmpeg in place, so the
+// process ID (used for pause/resume and the cgroup) is ffmpeg's own, and the
+// limits are set before ffmpeg starts any threads.
+func (l ProcessLimits) command(ffmpegPath string, args []string) (string, []string) {
+	var prefix []string
+	wrap := func(tool string, toolArgs ...string) {
+		path, err := exec.LookPath(tool)
+		if err != nil {
+			if _, warned := warnedTools.LoadOrStore(tool, true); !warned {
+				transcodeLog.Warn("Limit tool not found, ffmpeg runs without its limit", "tool", tool)
+			}
+			return
+		}
+		prefix = append(prefix, path)
+		prefix = append(prefix, toolArgs...)
+	}
+
+	if l.CPUAffinity != "" {
+		wrap("taskset", "--cpu-list", l.CPUAffinity)
+	}
+	if class, ok := ioClasses[l.IOClass]; ok {
+		if l.IOClass == "best-effort" {
+			wrap("ionice", "-c", class, "-n", strconv.Itoa(l.IOLevel))
+		} else {
+			wrap("ionice", "-c", class)
+		}
+	}
+	if l.Nice > 0 {
+		wrap("nice", "-n", strconv.Itoa(l.Nice))
+	}
+
+	if len(prefix) == 0 {
+		return ffmpegPath, args
+	}
+	return prefix[0], append(append(prefix[1:], ffmpegPath), args...)
+}
+
+// joinCgroup moves the process into a new cgroup with the memory limit and
+// returns a function that removes the cgroup once the process has exited
+func (l ProcessLimits) joinCgroup(pid int) (func(), error) {
+	if l.MemoryLimitMB <= 0 {
+		return func() {}, nil
+	}
+	if l.CgroupDir == "" {
+		return func() {}, fmt.Errorf("memory_limit_mb needs cgroup_dir")
+	}
+
+	dir := filepath.Join(l.CgroupDir, fmt.Sprintf("ffmpeg-%d", pid))
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return func() {}, fmt.Errorf("create cgroup: %w", err)
+	}
+	cleanup := func() {
+		if err := os.Remove(dir); err != nil {
+			transcodeLog.Warn("Failed to remove cgroup", "path", dir, "error", err)
+		}
+	}
+
+	limit := strconv.FormatInt(int64(l.MemoryLimitMB)*1024*1024, 10)
+	if err := os.WriteFile(filepath.Join(dir, "memory.max"), []byte(limit), 0644); err != nil {
+		cleanup()
+		return func() {}, fmt.Errorf("set cgroup memory limit: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0644); err != nil {
+		cleanup()
+		return func() {}, fmt.Errorf("move ffmpeg into cgroup: %w", err)
+	}
+	return cleanup, nil
+}
+
+// SetLimits sets the limits for ffmpeg processes started after the call
+func (t *Transcoder) SetLimits(limits ProcessLimits) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.limits = limits
+}
@@ -0,0 +1,70 @@
+package ffmpeg
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProcessLimitsCommand(t *testing.T) {
+	name, args := ProcessLimits{}.command("ffmpeg", []string{"-i", "in.mkv"})
+	if name != "ffmpeg" || strings.Join(args, " ") != "-i in.mkv" {
+		t.Errorf("expected ffmpeg unwrapped without limits, got %s %v", name, args)
+	}
+
+	for _, tool := range []string{"nice", "ionice", "taskset"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s not installed", tool)
+		}
+	}
+	limits := ProcessLimits{Nice: 10, IOClass: "best-effort", IOLevel: 7, CPUAffinity: "0-1"}
+	name, args = limits.command("ffmpeg", []string{"-i", "in.mkv"})
+	// Tool paths vary, so compare base names
+	for i, arg := range args {
+		if filepath.IsAbs(arg) {
+			args[i] = filepath.Base(arg)
+		}
+	}
+	got := filepath.Base(name) + " " + strings.Join(args, " ")
+	want := "taskset --cpu-list 0-1 ionice -c 2 -n 7 nice -n 10 ffmpeg -i in.mkv"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	_, args = ProcessLimits{IOClass: "idle"}.command("ffmpeg", nil)
+	if strings.Join(args, " ") != "-c 3 ffmpeg" {
+		t.Errorf("expected the idle class without a level, got %v", args)
+	}
+}
+
+func TestProcessLimitsCgroup(t *testing.T) {
+	// A plain directory stands in for the cgroup v2 filesystem
+	cgroupDir := t.TempDir()
+	limits := ProcessLimits{MemoryLimitMB: 512, CgroupDir: cgroupDir}
+
+	cleanup, err := limits.joinCgroup(1234)
+	if err != nil {
+		t.Fatalf("joinCgroup: %v", err)
+	}
+	dir := filepath.Join(cgroupDir, "ffmpeg-1234")
+	if data, _ := os.ReadFile(filepath.Join(dir, "memory.max")); string(data) != "536870912" {
+		t.Errorf("expected a 512 MiB memory.max, got %q", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "cgroup.procs")); string(data) != "1234" {
+		t.Errorf("expected the PID in cgroup.procs, got %q", data)
+	}
+
+	// A real cgroup's files vanish with it; clear them so Remove works
+	os.Remove(filepath.Join(dir, "memory.max"))
+	os.Remove(filepath.Join(dir, "cgroup.procs"))
+	cleanup()
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Error("expected the cgroup to be removed")
+	}
+
+	if _, err := (ProcessLimits{MemoryLimitMB: 512}).joinCgroup(1234); err == nil {
+		t.Error("expected an error without cgroup_dir")
+	}
+}
@@ -0,0 +1,94 @@
+package ffmpeg
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FindHardlinks returns the other paths under dirs that are hard links to
+// path, e.g. a torrent client's seeding copy of a library file. The search
+// stops once every link is accounted for.
+func FindHardlinks(path string, dirs []string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	want := LinkCount(info) - 1
+	if want == 0 {
+		return nil, nil
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		absPath = path
+	}
+
+	var links []string
+	seen := make(map[string]struct{})
+	for _, dir := range dirs {
+		if abs, err := filepath.Abs(dir); err == nil {
+			dir = abs
+		}
+		err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				// Unreadable folders are passed over
+				return nil
+			}
+			if len(links) == want {
+				return filepath.SkipAll
+			}
+			if !d.Type().IsRegular() || p == absPath {
+				return nil
+			}
+			if _, ok := seen[p]; ok {
+				return nil
+			}
+			candidate, err := d.Info()
+			if err != nil || candidate.Size() != info.Size() || !os.SameFile(candidate, info) {
+				return nil
+			}
+			seen[p] = struct{}{}
+			links = append(links, p)
+			return nil
+		})
+		if err != nil {
+			return links, err
+		}
+	}
+	return links, nil
+}
+
+// Relink replaces each of links with a hard link to target, renamed to
+// target's extension if that changed. It returns the new paths of the links
+// it replaced; a link on another filesystem can't be and is left as it was.
+func Relink(target string, links []string) ([]string, error) {
+	ext := filepath.Ext(target)
+	var relinked []string
+	var errs []string
+	for _, link := range links {
+		newPath := strings.TrimSuffix(link, filepath.Ext(link)) + ext
+		tmpPath := filepath.Join(filepath.Dir(link), "."+filepath.Base(newPath)+".shrinkray.link")
+		os.Remove(tmpPath)
+		if err := os.Link(target, tmpPath); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", link, err))
+			continue
+		}
+		if err := os.Rename(tmpPath, newPath); err != nil {
+			os.Remove(tmpPath)
+			errs = append(errs, fmt.Sprintf("%s: %v", link, err))
+			continue
+		}
+		if newPath != link {
+			if err := os.Remove(link); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, fmt.Sprintf("%s: %v", link, err))
+			}
+		}
+		relinked = append(relinked, newPath)
+	}
+	if len(errs) > 0 {
+		return relinked, fmt.Errorf("could not relink %s", strings.Join(errs, "; "))
+	}
+	return relinked, nil
+}
@@ -0,0 +1,55 @@
+package ffmpeg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindHardlinksAndRelink(t *testing.T) {
+	dir := t.TempDir()
+	library := filepath.Join(dir, "media", "Film.mkv")
+	seed := filepath.Join(dir, "downloads", "Film.mkv")
+	other := filepath.Join(dir, "downloads", "Other.mkv")
+	for _, p := range []string{library, other} {
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte("original"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Link(library, seed); err != nil {
+		t.Skipf("hard links not supported: %v", err)
+	}
+
+	links, err := FindHardlinks(library, []string{filepath.Join(dir, "media"), filepath.Join(dir, "downloads")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 1 || links[0] != seed {
+		t.Fatalf("expected only the seed, got %v", links)
+	}
+
+	// The library file is replaced by an MP4
+	output := filepath.Join(dir, "media", "Film.mp4")
+	if err := os.WriteFile(output, []byte("transcoded"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	relinked, err := Relink(output, links)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newSeed := filepath.Join(dir, "downloads", "Film.mp4")
+	if len(relinked) != 1 || relinked[0] != newSeed {
+		t.Fatalf("expected the seed renamed to the new extension, got %v", relinked)
+	}
+	if _, err := os.Stat(seed); !os.IsNotExist(err) {
+		t.Error("old seed name left behind")
+	}
+	outputInfo, _ := os.Stat(output)
+	seedInfo, err := os.Stat(newSeed)
+	if err != nil || !os.SameFile(outputInfo, seedInfo) || LinkCount(outputInfo) != 2 {
+		t.Errorf("seed isn't a hard link to the output")
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package ffmpeg
+
+import (
+	"os"
+	"syscall"
+)
+
+// LinkCount returns the number of hard links to the file described by
+// info, or 1 where the platform doesn't say
+func LinkCount(info os.FileInfo) int {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && stat.Nlink > 1 {
+		return int(stat.Nlink)
+	}
+	return 1
+}
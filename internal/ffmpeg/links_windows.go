@@ -0,0 +1,9 @@
+package ffmpeg
+
+import "os"
+
+// LinkCount returns 1: os.FileInfo doesn't carry a link count on Windows,
+// so hard links are never searched for there
+func LinkCount(info os.FileInfo) int {
+	return 1
+}
@@ -0,0 +1,84 @@
+package ffmpeg
+
+import "fmt"
+
+// maxEncodeSize is the largest picture each hardware encoder takes. VAAPI
+// limits come from the driver (see VAAPIInfo); VideoToolbox doesn't
+// publish one.
+var maxEncodeSize = map[EncoderKey][2]int{
+	{HWAccelNVENC, CodecHEVC}: {8192, 8192},
+	{HWAccelNVENC, CodecAV1}:  {8192, 8192},
+	{HWAccelQSV, CodecHEVC}:   {8192, 8192},
+	{HWAccelQSV, CodecAV1}:    {8192, 8192},
+}
+
+// OutputSize returns the frame size preset encodes a width×height source
+// at, after any downscale to MaxHeight
+func OutputSize(preset *Preset, width, height int) (int, int) {
+	if preset.MaxHeight > 0 && height > preset.MaxHeight {
+		width = (width*preset.MaxHeight/height + 1) &^ 1
+		height = preset.MaxHeight
+	}
+	return width, height
+}
+
+// EncoderIncompatibility reports why preset's hardware encoder can't encode
+// a width×height source of bitDepth, or "" if it can (or the encoder's
+// limits aren't known). Checked before starting so an unsupported source
+// goes straight to software instead of failing on the GPU first.
+func EncoderIncompatibility(preset *Preset, width, height, bitDepth int) string {
+	if preset.Encoder == HWAccelNone {
+		return ""
+	}
+	var vaapi []*VAAPIInfo
+	if preset.Encoder == HWAccelVAAPI {
+		for _, d := range ListDevices() {
+			if d.VAAPI != nil {
+				vaapi = append(vaapi, d.VAAPI)
+			}
+		}
+	}
+	return encoderIncompatibility(preset, width, height, bitDepth, Supports10Bit(preset.Encoder, preset.Codec), vaapi)
+}
+
+// encoderIncompatibility is EncoderIncompatibility given whether the encoder
+// passed the 10-bit test encode and what the VAAPI render nodes report.
+// VAAPI is compatible if any node is, since jobs can run on each.
+func encoderIncompatibility(preset *Preset, width, height, bitDepth int, tenBit bool, vaapi []*VAAPIInfo) string {
+	if preset.Encoder == HWAccelNone {
+		return ""
+	}
+	name := fmt.Sprintf("%s %s", preset.Encoder, preset.Codec)
+	if bitDepth >= 10 && !tenBit {
+		return fmt.Sprintf("%d-bit source but the %s encoder is 8-bit only", bitDepth, name)
+	}
+
+	outWidth, outHeight := OutputSize(preset, width, height)
+	if limit, ok := maxEncodeSize[EncoderKey{preset.Encoder, preset.Codec}]; ok && outWidth > 0 {
+		if outWidth > limit[0] || outHeight > limit[1] {
+			return fmt.Sprintf("%dx%d is larger than the %s encoder's %dx%d limit",
+				outWidth, outHeight, name, limit[0], limit[1])
+		}
+	}
+
+	if len(vaapi) == 0 {
+		return ""
+	}
+	reason := ""
+	for _, info := range vaapi {
+		switch {
+		case !info.CanEncode(preset.Codec, bitDepth >= 10):
+			depth := "8-bit"
+			if bitDepth >= 10 {
+				depth = "10-bit"
+			}
+			reason = fmt.Sprintf("the VAAPI driver has no %s %s encode profile", depth, preset.Codec)
+		case info.MaxWidth > 0 && outWidth > 0 && (outWidth > info.MaxWidth || outHeight > info.MaxHeight):
+			reason = fmt.Sprintf("%dx%d is larger than the VAAPI driver's %dx%d limit",
+				outWidth, outHeight, info.MaxWidth, info.MaxHeight)
+		default:
+			return ""
+		}
+	}
+	return reason
+}
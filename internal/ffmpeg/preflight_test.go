@@ -0,0 +1,56 @@
+package ffmpeg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEncoderIncompatibility(t *testing.T) {
+	nvenc := &Preset{Encoder: HWAccelNVENC, Codec: CodecHEVC}
+	vaapiAV1 := &Preset{Encoder: HWAccelVAAPI, Codec: CodecAV1}
+	hevcOnly := &VAAPIInfo{HEVC: true, HEVCTenBit: true, MaxWidth: 4096, MaxHeight: 4096}
+	av1 := &VAAPIInfo{AV1: true, AV1TenBit: true, MaxWidth: 8192, MaxHeight: 8192}
+
+	tests := []struct {
+		name     string
+		preset   *Preset
+		width    int
+		height   int
+		bitDepth int
+		tenBit   bool
+		vaapi    []*VAAPIInfo
+		want     string // Substring of the reason, "" for compatible
+	}{
+		{"software", &Preset{Encoder: HWAccelNone, Codec: CodecHEVC}, 15360, 8640, 10, false, nil, ""},
+		{"4K on NVENC", nvenc, 3840, 2160, 10, true, nil, ""},
+		{"10-bit on 8-bit NVENC", nvenc, 1920, 1080, 10, false, nil, "8-bit only"},
+		{"16K on NVENC", nvenc, 15360, 8640, 8, true, nil, "15360x8640 is larger"},
+		{"16K downscaled to 1080p", &Preset{Encoder: HWAccelNVENC, Codec: CodecHEVC, MaxHeight: 1080}, 15360, 8640, 8, true, nil, ""},
+		{"unknown size", nvenc, 0, 0, 8, true, nil, ""},
+		{"VAAPI without AV1 encode", vaapiAV1, 1920, 1080, 10, true, []*VAAPIInfo{hevcOnly}, "no 10-bit av1 encode profile"},
+		{"VAAPI over the driver limit", &Preset{Encoder: HWAccelVAAPI, Codec: CodecHEVC}, 7680, 4320, 8, true, []*VAAPIInfo{hevcOnly}, "driver's 4096x4096 limit"},
+		{"VAAPI with one capable node", vaapiAV1, 1920, 1080, 10, true, []*VAAPIInfo{hevcOnly, av1}, ""},
+		{"VAAPI without vainfo", vaapiAV1, 1920, 1080, 10, true, nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := encoderIncompatibility(tt.preset, tt.width, tt.height, tt.bitDepth, tt.tenBit, tt.vaapi)
+			if tt.want == "" && got != "" {
+				t.Errorf("expected compatible, got %q", got)
+			}
+			if tt.want != "" && !strings.Contains(got, tt.want) {
+				t.Errorf("reason = %q, want it to contain %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutputSize(t *testing.T) {
+	if w, h := OutputSize(&Preset{MaxHeight: 1080}, 3840, 1600); w != 2592 || h != 1080 {
+		t.Errorf("OutputSize = %dx%d, want 2592x1080", w, h)
+	}
+	if w, h := OutputSize(&Preset{MaxHeight: 1080}, 1280, 720); w != 1280 || h != 720 {
+		t.Errorf("OutputSize = %dx%d, want 1280x720 (no upscale)", w, h)
+	}
+}
@@ -2,17 +2,138 @@ package ffmpeg
 
 import (
 	"fmt"
+	"path/filepath"
 	"strings"
+	"sync"
+
+	"github.com/gwlsn/shrinkray/internal/logger"
 )
 
+var presetsLog = logger.For("presets")
+
 // Preset defines a transcoding preset with its FFmpeg parameters
 type Preset struct {
 	ID          string  `json:"id"`
 	Name        string  `json:"name"`
 	Description string  `json:"description"`
-	Encoder     HWAccel `json:"encoder"`    // Which encoder to use
-	Codec       Codec   `json:"codec"`      // Target codec (HEVC or AV1)
-	MaxHeight   int     `json:"max_height"` // 0 = no scaling, 1080, 720, etc.
+	Encoder     HWAccel `json:"encoder"`      // Which encoder to use
+	Codec       Codec   `json:"codec"`        // Target codec (HEVC or AV1)
+	MaxHeight   int     `json:"max_height"`   // 0 = no scaling, 1080, 720, etc.
+	AutoQuality bool    `json:"auto_quality"` // Pick CRF per title with a sampled search (see SearchQuality)
+	AutoCrop    bool    `json:"auto_crop"`    // Detect and remove black bars per title (see DetectCrop)
+
+	// Container is the output container; empty means MKV
+	Container Container `json:"container,omitempty"`
+
+	// ExtraArgs are per-job encoder options appended after the preset's own
+	// video encoder args (validated with ValidateCustomArgs). Never set on shared presets.
+	ExtraArgs []string `json:"extra_args,omitempty"`
+
+	// Device is the GPU a hardware encode runs on (a render node for VAAPI
+	// and Quick Sync, cuda:N for NVENC); empty uses the default device.
+	// Set per job by the worker pool, never on shared presets.
+	Device string `json:"device,omitempty"`
+
+	// SVTAV1 tunes software AV1 encodes; set on AV1 presets that use libsvtav1
+	SVTAV1 *SVTAV1Options `json:"svt_av1,omitempty"`
+
+	// TargetBitrate is the video bitrate (bits/s) of a size-targeted encode,
+	// replacing the quality setting; see TargetVideoBitrate. Set per job,
+	// never on shared presets. Software encoders run two passes.
+	TargetBitrate int64 `json:"target_bitrate,omitempty"`
+
+	// Deinterlace inserts a deinterlace filter ahead of cropping and scaling
+	// (deinterlace_vaapi or yadif_cuda for GPU frames, bwdif otherwise). Set
+	// per job from the source's field order and the preset's DeinterlaceMode.
+	Deinterlace bool `json:"deinterlace,omitempty"`
+
+	// Crop is applied before scaling; set per job from DetectCrop, never on
+	// shared presets. Cropping needs frames in system memory, so hardware
+	// jobs decode to the CPU and upload again.
+	Crop *Crop `json:"crop,omitempty"`
+
+	// Threads caps the CPU threads a software encode uses, so parallel
+	// workers split the cores instead of contending for all of them; 0 lets
+	// the encoder use every core. Set per job, never on shared presets.
+	Threads int `json:"threads,omitempty"`
+
+	// AudioCodec (eac3 or opus) is what an audio-only preset (CodecCopy)
+	// re-encodes lossless audio tracks to; other tracks are copied
+	AudioCodec string `json:"audio_codec,omitempty"`
+
+	// AudioEncode lists the tracks AudioCodec applies to (see
+	// LosslessAudioTracks). Set per job, never on shared presets.
+	AudioEncode []AudioTrack `json:"audio_encode,omitempty"`
+
+	// Chunks is how many segments a chunked encode splits the video into
+	// and encodes in parallel (see transcodeChunked); 0 or 1 encodes the
+	// file in one go. Set per job, never on shared presets.
+	Chunks int `json:"chunks,omitempty"`
+
+	// ReencodeAboveBPP queues sources already in the target codec when their
+	// video exceeds this many bits per pixel per frame (see
+	// ExcessiveBitrate); 0 always skips them
+	ReencodeAboveBPP float64 `json:"reencode_above_bpp,omitempty"`
+}
+
+// SVTAV1Options are libsvtav1-specific encoder settings
+type SVTAV1Options struct {
+	Preset    int `json:"preset"`     // Speed preset, 0 (slowest, best) to 13 (fastest)
+	FilmGrain int `json:"film_grain"` // Film grain synthesis level 0-50; 0 = off
+	Tune      int `json:"tune"`       // 0 = visual quality, 1 = PSNR (SVT-AV1's default), 2 = SSIM
+}
+
+// DefaultSVTAV1Options match the previously hard-coded -preset 6
+var DefaultSVTAV1Options = SVTAV1Options{Preset: 6, Tune: 1}
+
+// appendArgs adds the libsvtav1 options to outputArgs, replacing the preset's
+// default -preset. Film grain synthesis lets grainy film compress far better:
+// the grain is denoised before encoding and re-synthesized on playback.
+func (o SVTAV1Options) appendArgs(outputArgs []string) []string {
+	outputArgs = append(outputArgs, "-preset", fmt.Sprintf("%d", o.Preset))
+	var params []string
+	if o.Tune != DefaultSVTAV1Options.Tune {
+		params = append(params, fmt.Sprintf("tune=%d", o.Tune))
+	}
+	if o.FilmGrain > 0 {
+		params = append(params, fmt.Sprintf("film-grain=%d", o.FilmGrain))
+	}
+	return appendEncoderParams(outputArgs, "-svtav1-params", params...)
+}
+
+// appendThreadArgs limits a software encoder to threads CPU threads: x265
+// sizes its worker pool with pools and SVT-AV1 with lp (logical processors),
+// on top of ffmpeg's own -threads. Hardware encoders barely use the CPU and
+// are left alone.
+func appendThreadArgs(outputArgs []string, encoder string, threads int) []string {
+	n := fmt.Sprintf("%d", threads)
+	switch encoder {
+	case "libx265":
+		outputArgs = append(outputArgs, "-threads", n)
+		return appendEncoderParams(outputArgs, "-x265-params", "pools="+n)
+	case "libsvtav1":
+		outputArgs = append(outputArgs, "-threads", n)
+		return appendEncoderParams(outputArgs, "-svtav1-params", "lp="+n)
+	}
+	return outputArgs
+}
+
+// appendEncoderParams adds key=value params to the video encoder's params
+// option (-x265-params, -svtav1-params), merging them into one already in
+// outputArgs since ffmpeg only keeps the last
+func appendEncoderParams(outputArgs []string, flag string, params ...string) []string {
+	if len(params) == 0 {
+		return outputArgs
+	}
+	joined := strings.Join(params, ":")
+	for i := 0; i+1 < len(outputArgs); i++ {
+		if outputArgs[i] == flag || outputArgs[i] == flag+":v:0" {
+			merged := append([]string(nil), outputArgs...)
+			merged[i+1] += ":" + joined
+			return merged
+		}
+	}
+	return append(outputArgs, flag+":v:0", joined)
 }
 
 // encoderSettings defines FFmpeg settings for each encoder
@@ -24,6 +145,56 @@ type encoderSettings struct {
 	usesBitrate bool     // If true, quality value is a bitrate modifier (0.0-1.0)
 	hwaccelArgs []string // Args to prepend before -i for hardware decoding
 	scaleFilter string   // Hardware-specific scale filter (e.g., "scale_qsv", "scale_cuda")
+	tenBitArgs  []string // Args for 10-bit sources (main10 profile / 10-bit pixel format)
+}
+
+// Container is an output container format
+type Container string
+
+const (
+	ContainerMKV Container = "mkv"
+	ContainerMP4 Container = "mp4"
+)
+
+// ParseContainer returns the container named by value, or false if it isn't one
+func ParseContainer(value string) (Container, bool) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "mkv", "matroska":
+		return ContainerMKV, true
+	case "mp4":
+		return ContainerMP4, true
+	}
+	return "", false
+}
+
+// SourceContainer returns the container of a source file by extension,
+// or "" if it isn't one we write
+func SourceContainer(inputPath string) Container {
+	switch strings.ToLower(filepath.Ext(inputPath)) {
+	case ".mkv":
+		return ContainerMKV
+	case ".mp4", ".m4v":
+		return ContainerMP4
+	}
+	return ""
+}
+
+// OutputExt returns the extension of the finished file for a source written
+// in container c. MP4 output keeps an .m4v source's extension.
+func OutputExt(inputPath string, c Container) string {
+	if c == ContainerMP4 {
+		if strings.EqualFold(filepath.Ext(inputPath), ".m4v") {
+			return filepath.Ext(inputPath)
+		}
+		return ".mp4"
+	}
+	return ".mkv"
+}
+
+// textSubtitleCodecs can be converted to mov_text for MP4 output; bitmap
+// subtitles (PGS, DVD) have no MP4 equivalent and are dropped
+var textSubtitleCodecs = map[string]bool{
+	"subrip": true, "srt": true, "ass": true, "ssa": true, "mov_text": true, "text": true,
 }
 
 // SubtitleHandling determines how to handle subtitle streams when transcoding to MKV.
@@ -57,6 +228,7 @@ var encoderConfigs = map[EncoderKey]encoderSettings{
 		quality:     "26",
 		extraArgs:   []string{"-preset", "medium"},
 		scaleFilter: "scale",
+		tenBitArgs:  []string{"-pix_fmt:v:0", "yuv420p10le", "-profile:v:0", "main10"},
 	},
 	{HWAccelVideoToolbox, CodecHEVC}: {
 		// VideoToolbox uses bitrate control (-b:v) with dynamic calculation
@@ -68,6 +240,7 @@ var encoderConfigs = map[EncoderKey]encoderSettings{
 		usesBitrate: true,
 		hwaccelArgs: []string{"-hwaccel", "videotoolbox"},
 		scaleFilter: "scale", // VideoToolbox doesn't have a HW scaler, use CPU
+		tenBitArgs:  []string{"-pix_fmt:v:0", "p010le", "-profile:v:0", "main10"},
 	},
 	{HWAccelNVENC, CodecHEVC}: {
 		encoder:     "hevc_nvenc",
@@ -76,6 +249,8 @@ var encoderConfigs = map[EncoderKey]encoderSettings{
 		extraArgs:   []string{"-preset", "p4", "-tune", "hq", "-rc", "vbr"},
 		hwaccelArgs: []string{"-hwaccel", "cuda", "-hwaccel_output_format", "cuda"},
 		scaleFilter: "scale_cuda",
+		// CUDA frames are already P010 for 10-bit sources; only the profile is needed
+		tenBitArgs: []string{"-profile:v:0", "main10"},
 	},
 	{HWAccelQSV, CodecHEVC}: {
 		encoder:     "hevc_qsv",
@@ -86,6 +261,7 @@ var encoderConfigs = map[EncoderKey]encoderSettings{
 		// Some CPU overhead but reliable - full GPU pipeline didn't work
 		hwaccelArgs: []string{"-hwaccel", "vaapi", "-hwaccel_device", ""},
 		scaleFilter: "scale",
+		tenBitArgs:  []string{"-pix_fmt:v:0", "p010le", "-profile:v:0", "main10"},
 	},
 	{HWAccelVAAPI, CodecHEVC}: {
 		encoder:     "hevc_vaapi",
@@ -104,6 +280,7 @@ var encoderConfigs = map[EncoderKey]encoderSettings{
 		quality:     "35",
 		extraArgs:   []string{"-preset", "6"},
 		scaleFilter: "scale",
+		tenBitArgs:  []string{"-pix_fmt:v:0", "yuv420p10le"},
 	},
 	{HWAccelVideoToolbox, CodecAV1}: {
 		// VideoToolbox AV1 (M3+ chips) uses bitrate control
@@ -114,6 +291,7 @@ var encoderConfigs = map[EncoderKey]encoderSettings{
 		usesBitrate: true,
 		hwaccelArgs: []string{"-hwaccel", "videotoolbox"},
 		scaleFilter: "scale", // VideoToolbox doesn't have a HW scaler, use CPU
+		tenBitArgs:  []string{"-pix_fmt:v:0", "p010le"},
 	},
 	{HWAccelNVENC, CodecAV1}: {
 		encoder:     "av1_nvenc",
@@ -132,6 +310,7 @@ var encoderConfigs = map[EncoderKey]encoderSettings{
 		// Some CPU overhead but reliable - full GPU pipeline didn't work
 		hwaccelArgs: []string{"-hwaccel", "vaapi", "-hwaccel_device", ""},
 		scaleFilter: "scale",
+		tenBitArgs:  []string{"-pix_fmt:v:0", "p010le"},
 	},
 	{HWAccelVAAPI, CodecAV1}: {
 		encoder:     "av1_vaapi",
@@ -150,25 +329,47 @@ var BasePresets = []struct {
 	Description string
 	Codec       Codec
 	MaxHeight   int
+	AudioCodec  string
 }{
-	{"compress-hevc", "Smaller files — HEVC", "Widely compatible, works almost everywhere", CodecHEVC, 0},
-	{"compress-av1", "Smaller files — AV1", "Best quality per MB, newer devices", CodecAV1, 0},
-	{"1080p", "Reduce to 1080p — HEVC", "Downscale to Full HD for big savings", CodecHEVC, 1080},
-	{"720p", "Reduce to 720p — HEVC", "Maximum compatibility, smallest files", CodecHEVC, 720},
+	{"compress-hevc", "Smaller files — HEVC", "Widely compatible, works almost everywhere", CodecHEVC, 0, ""},
+	{"compress-av1", "Smaller files — AV1", "Best quality per MB, newer devices", CodecAV1, 0, ""},
+	{"1080p", "Reduce to 1080p — HEVC", "Downscale to Full HD for big savings", CodecHEVC, 1080, ""},
+	{"720p", "Reduce to 720p — HEVC", "Maximum compatibility, smallest files", CodecHEVC, 720, ""},
+	{"remux-mkv", "Remux to MKV", "Rewrap HEVC/AV1 from AVI, TS or WMV into MKV without re-encoding", CodecCopy, 0, ""},
+	{"compress-audio", "Compress audio only", "Keep the video, re-encode lossless TrueHD/DTS-HD/FLAC/PCM audio to EAC3 or Opus", CodecCopy, 0, "eac3"},
 }
 
 // hasVAAPIOutputFormat checks if hwaccelArgs specify -hwaccel_output_format vaapi,
 // meaning decoded frames are in VAAPI GPU memory (not downloaded to CPU).
 // This is used to determine whether frames need hwupload or are already on GPU.
 func hasVAAPIOutputFormat(hwaccelArgs []string) bool {
+	return hasHWOutputFormat(hwaccelArgs, "vaapi")
+}
+
+// hasHWOutputFormat checks if hwaccelArgs keep decoded frames in format's GPU memory
+func hasHWOutputFormat(hwaccelArgs []string, format string) bool {
 	for i, arg := range hwaccelArgs {
-		if arg == "-hwaccel_output_format" && i+1 < len(hwaccelArgs) && hwaccelArgs[i+1] == "vaapi" {
+		if arg == "-hwaccel_output_format" && i+1 < len(hwaccelArgs) && hwaccelArgs[i+1] == format {
 			return true
 		}
 	}
 	return false
 }
 
+// withoutHWOutputFormat drops -hwaccel_output_format from hwaccelArgs, so
+// hardware-decoded frames are downloaded to system memory
+func withoutHWOutputFormat(hwaccelArgs []string) []string {
+	var args []string
+	for i := 0; i < len(hwaccelArgs); i++ {
+		if hwaccelArgs[i] == "-hwaccel_output_format" {
+			i++
+			continue
+		}
+		args = append(args, hwaccelArgs[i])
+	}
+	return args
+}
+
 // isVAAPIIncompatiblePixFmt returns true if the pixel format cannot be hardware decoded by VAAPI.
 // These formats require software decode + hwupload to VAAPI for encoding.
 func isVAAPIIncompatiblePixFmt(pixFmt string) bool {
@@ -235,12 +436,16 @@ func isVAAPIIncompatibleCodec(codec string) bool {
 
 // BuildPresetArgs builds FFmpeg arguments for a preset with the specified encoder
 // sourceBitrate is the source video bitrate in bits/second (used for dynamic bitrate calculation)
-// bitDepth is the source video bit depth (8, 10, 12) - used for VAAPI format selection
+// bitDepth is the source video bit depth (8, 10, 12) - used for 10-bit profile and VAAPI format selection
 // pixFmt is the source pixel format - used to detect formats requiring software decode
 // videoCodec is the source video codec - used to detect codecs requiring software decode (e.g., mpeg4/xvid)
 // qualityHEVC/qualityAV1 are user-configured CRF values (0 = use preset defaults)
 // Returns (inputArgs, outputArgs) - inputArgs go before -i, outputArgs go after
 func BuildPresetArgs(preset *Preset, sourceBitrate int64, subtitleCodecs []string, subtitleHandling string, bitDepth int, pixFmt string, videoCodec string, qualityHEVC int, qualityAV1 int) (inputArgs []string, outputArgs []string) {
+	if preset.Codec == CodecCopy {
+		return buildRemuxArgs(preset, subtitleCodecs, subtitleHandling)
+	}
+
 	key := EncoderKey{preset.Encoder, preset.Codec}
 	config, ok := encoderConfigs[key]
 	if !ok {
@@ -262,21 +467,35 @@ func BuildPresetArgs(preset *Preset, sourceBitrate int64, subtitleCodecs []strin
 	// These require software decode → format conversion → hwupload → VAAPI encode
 	vaapiIncompatible := isVAAPIIncompatiblePixFmt(pixFmt) || isVAAPIIncompatibleCodec(videoCodec)
 	useHWAccelDecode := !vaapiIncompatible || preset.Encoder != HWAccelVAAPI
+	hwaccelArgs := config.hwaccelArgs
+	if preset.Crop != nil {
+		hwaccelArgs = withoutHWOutputFormat(hwaccelArgs)
+	}
+	vaapiDevice := preset.Device
+	if !strings.HasPrefix(vaapiDevice, "/dev/") {
+		vaapiDevice = GetVAAPIDevice()
+	}
+	cudaDevice, onCUDADevice := cudaIndex(preset.Device)
+	onCUDADevice = onCUDADevice && preset.Encoder == HWAccelNVENC
 	if useHWAccelDecode {
-		for _, arg := range config.hwaccelArgs {
+		for _, arg := range hwaccelArgs {
 			// Fill in VAAPI device path dynamically
 			if arg == "" && len(inputArgs) > 0 {
 				lastArg := inputArgs[len(inputArgs)-1]
 				if lastArg == "-vaapi_device" || lastArg == "-hwaccel_device" {
-					arg = GetVAAPIDevice()
+					arg = vaapiDevice
 				}
 			}
 			inputArgs = append(inputArgs, arg)
 		}
+		// Decode on the same GPU the job encodes on
+		if onCUDADevice {
+			inputArgs = append(inputArgs, "-hwaccel_device", cudaDevice)
+		}
 	} else {
 		// For VAAPI with incompatible pixel format, we still need -vaapi_device for encoding
 		// but NOT -hwaccel vaapi (which would fail for yuv444p)
-		inputArgs = append(inputArgs, "-vaapi_device", GetVAAPIDevice())
+		inputArgs = append(inputArgs, "-vaapi_device", vaapiDevice)
 	}
 
 	// VAAPI: Add -reinit_filter 0 to INPUT args to prevent mid-stream filter reconfiguration.
@@ -317,7 +536,7 @@ func BuildPresetArgs(preset *Preset, sourceBitrate int64, subtitleCodecs []strin
 		// QSV uses VAAPI decode but without -hwaccel_output_format, so frames
 		// download to CPU. This check ensures correct filter chain selection.
 		// Also force CPU path for incompatible pixel formats (yuv444p) or codecs (mpeg4/xvid)
-		framesOnGPU := hasVAAPIOutputFormat(config.hwaccelArgs) && !vaapiIncompatible
+		framesOnGPU := hasVAAPIOutputFormat(hwaccelArgs) && !vaapiIncompatible
 
 		// Select output pixel format and color parameters based on source bit depth:
 		// - 8-bit content: nv12 with bt709 color (standard SDR)
@@ -335,6 +554,16 @@ func BuildPresetArgs(preset *Preset, sourceBitrate int64, subtitleCodecs []strin
 			// For 10-bit/HDR content, use bt2020 color space with PQ transfer (HDR10)
 			colorParams = "out_range=tv:out_color_matrix=bt2020nc:out_color_primaries=bt2020:out_color_transfer=smpte2084"
 		}
+		// Software frames are uploaded first, cropped in system memory before
+		// that; interlaced frames are deinterlaced in hardware once on the GPU
+		uploadFilter := fmt.Sprintf("format=%s,hwupload,", swFormat)
+		if preset.Crop != nil {
+			uploadFilter = preset.Crop.Filter() + "," + uploadFilter
+		}
+		gpuFilter := ""
+		if preset.Deinterlace {
+			gpuFilter = deinterlaceFilterVAAPI + ","
+		}
 
 		// Use -filter:v:0 instead of -vf to apply filter only to the first video output stream.
 		// This prevents filter from being applied to cover art/attached pictures which are copied.
@@ -343,12 +572,12 @@ func BuildPresetArgs(preset *Preset, sourceBitrate int64, subtitleCodecs []strin
 			if framesOnGPU {
 				// HW decode → frames already on GPU → HW scale with explicit color handling
 				outputArgs = append(outputArgs,
-					"-filter:v:0", fmt.Sprintf("scale_vaapi=w=-2:h='min(ih,%d)':format=%s:%s", preset.MaxHeight, vaapiFormat, colorParams),
+					"-filter:v:0", fmt.Sprintf("%sscale_vaapi=w=-2:h='min(ih,%d)':format=%s:%s", gpuFilter, preset.MaxHeight, vaapiFormat, colorParams),
 				)
 			} else {
 				// SW/CPU decode → upload to GPU → HW scale with explicit color handling
 				outputArgs = append(outputArgs,
-					"-filter:v:0", fmt.Sprintf("format=%s,hwupload,scale_vaapi=w=-2:h='min(ih,%d)':format=%s:%s", swFormat, preset.MaxHeight, vaapiFormat, colorParams),
+					"-filter:v:0", fmt.Sprintf("%s%sscale_vaapi=w=-2:h='min(ih,%d)':format=%s:%s", uploadFilter, gpuFilter, preset.MaxHeight, vaapiFormat, colorParams),
 				)
 			}
 		} else {
@@ -356,36 +585,56 @@ func BuildPresetArgs(preset *Preset, sourceBitrate int64, subtitleCodecs []strin
 			if framesOnGPU {
 				// HW decode → ensure format and color compatibility for encoder
 				outputArgs = append(outputArgs,
-					"-filter:v:0", fmt.Sprintf("scale_vaapi=format=%s:%s", vaapiFormat, colorParams),
+					"-filter:v:0", fmt.Sprintf("%sscale_vaapi=format=%s:%s", gpuFilter, vaapiFormat, colorParams),
 				)
 			} else {
 				// SW/CPU decode → upload and format for encoder with color handling
 				outputArgs = append(outputArgs,
-					"-filter:v:0", fmt.Sprintf("format=%s,hwupload,scale_vaapi=format=%s:%s", swFormat, vaapiFormat, colorParams),
+					"-filter:v:0", fmt.Sprintf("%s%sscale_vaapi=format=%s:%s", uploadFilter, gpuFilter, vaapiFormat, colorParams),
 				)
 			}
 		}
-	} else if preset.MaxHeight > 0 {
+	} else if preset.MaxHeight > 0 || preset.Crop != nil || preset.Deinterlace {
 		// Non-VAAPI paths: QSV, NVENC, Software, VideoToolbox - unchanged
 		// Use -filter:v:0 to apply filter only to the first video output stream
+		var filters []string
 		scaleFilter := config.scaleFilter
 		if scaleFilter == "" {
 			scaleFilter = "scale"
 		}
-		outputArgs = append(outputArgs,
-			"-filter:v:0", fmt.Sprintf("%s=-2:'min(ih,%d)'", scaleFilter, preset.MaxHeight),
-		)
+		if preset.Deinterlace {
+			// NVENC frames stay in CUDA memory unless cropping; QSV decodes
+			// to system memory, so only CUDA deinterlaces in hardware
+			if hasHWOutputFormat(hwaccelArgs, "cuda") {
+				filters = append(filters, deinterlaceFilterCUDA)
+			} else {
+				filters = append(filters, deinterlaceFilterSoftware)
+			}
+		}
+		if preset.Crop != nil {
+			// Cropped frames are in system memory, so scale on the CPU too
+			filters = append(filters, preset.Crop.Filter())
+			scaleFilter = "scale"
+		}
+		if preset.MaxHeight > 0 {
+			filters = append(filters, fmt.Sprintf("%s=-2:'min(ih,%d)'", scaleFilter, preset.MaxHeight))
+		}
+		outputArgs = append(outputArgs, "-filter:v:0", strings.Join(filters, ","))
 	}
 	// No filter for non-VAAPI paths without scaling (correct)
 
 	qualityStr := config.quality
+	qualityFlag := config.qualityFlag
 	if preset.Codec == CodecHEVC && qualityHEVC > 0 {
 		qualityStr = fmt.Sprintf("%d", qualityHEVC)
 	} else if preset.Codec == CodecAV1 && qualityAV1 > 0 {
 		qualityStr = fmt.Sprintf("%d", qualityAV1)
 	}
 
-	if config.usesBitrate && sourceBitrate > 0 {
+	if preset.TargetBitrate > 0 {
+		// Size-targeted encode: average bitrate instead of constant quality
+		qualityFlag, qualityStr = "-b:v", fmt.Sprintf("%dk", preset.TargetBitrate/1000)
+	} else if config.usesBitrate && sourceBitrate > 0 {
 		// Parse modifier (e.g., "0.5" = 50% of source bitrate)
 		modifier := 0.5 // default
 		fmt.Sscanf(qualityStr, "%f", &modifier)
@@ -413,17 +662,61 @@ func BuildPresetArgs(preset *Preset, sourceBitrate int64, subtitleCodecs []strin
 	// so options after -c:v:1 would try to apply to the copy stream (which ignores them).
 	// See: https://ffmpeg.org/ffmpeg.html (stream specifiers section)
 	outputArgs = append(outputArgs,
-		"-map", "0:v:0",          // First video stream (for transcoding)
-		"-map", "0:v:1?",         // Second video stream if exists (cover art) - ? means optional
-		"-map", "0:a?",           // All audio streams
-		"-map", "0:s?",           // All subtitle streams
-		"-c:v:0", config.encoder, // Transcode first video stream
+		"-map", "0:v:0", // First video stream (for transcoding)
+		"-map", "0:v:1?", // Second video stream if exists (cover art) - ? means optional
+		"-map", "0:a?", // All audio streams
 	)
+	mp4 := preset.Container == ContainerMP4
+	if mp4 {
+		// MP4 only holds text subtitles; map those individually
+		if normalizeSubtitleHandling(subtitleHandling) != SubtitleHandlingDrop {
+			for i, codec := range subtitleCodecs {
+				if textSubtitleCodecs[strings.ToLower(codec)] {
+					outputArgs = append(outputArgs, "-map", fmt.Sprintf("0:s:%d", i))
+				}
+			}
+		}
+	} else {
+		outputArgs = append(outputArgs,
+			"-map", "0:s?", // All subtitle streams
+			"-map", "0:t?", // Attachments (fonts for styled subtitles); MP4 can't hold them
+		)
+	}
+	outputArgs = append(outputArgs, "-map_chapters", "0")
+	outputArgs = append(outputArgs, "-c:v:0", config.encoder) // Transcode first video stream
 
 	// Add quality and encoder-specific args immediately after -c:v:0 encoder selection
 	// These must come before -c:v:1 to be associated with stream v:0
-	outputArgs = append(outputArgs, config.qualityFlag, qualityStr)
-	outputArgs = append(outputArgs, config.extraArgs...)
+	outputArgs = append(outputArgs, qualityFlag, qualityStr)
+	if config.encoder == "libsvtav1" {
+		// Presets switched to software after generation (fallbacks, pins)
+		// don't carry options; use the configured ones
+		options := preset.SVTAV1
+		if options == nil {
+			presetsMu.RLock()
+			configured := svtAV1Options
+			presetsMu.RUnlock()
+			options = &configured
+		}
+		outputArgs = options.appendArgs(outputArgs)
+	} else {
+		outputArgs = append(outputArgs, config.extraArgs...)
+	}
+	if preset.Threads > 0 {
+		outputArgs = appendThreadArgs(outputArgs, config.encoder, preset.Threads)
+	}
+	if onCUDADevice {
+		outputArgs = append(outputArgs, "-gpu", cudaDevice)
+	}
+
+	// 10-bit sources: keep the extra precision with a main10 profile / 10-bit pixel format.
+	// VAAPI selects p010 in its filter chain above, so it has no tenBitArgs.
+	if bitDepth >= 10 {
+		outputArgs = append(outputArgs, config.tenBitArgs...)
+	}
+
+	// Per-job custom encoder options go last so they override preset defaults
+	outputArgs = append(outputArgs, preset.ExtraArgs...)
 
 	// Now add the copy codec for cover art (second video stream if present)
 	outputArgs = append(outputArgs, "-c:v:1", "copy")
@@ -431,27 +724,125 @@ func BuildPresetArgs(preset *Preset, sourceBitrate int64, subtitleCodecs []strin
 	// Copy audio and handle subtitle codecs.
 	outputArgs = append(outputArgs, "-c:a", "copy")
 
-	// Handle subtitle codecs based on compatibility:
-	// - mov_text: MP4 subtitle format, convert to srt for MKV output
-	// - Unknown/unsupported (none, empty, webvtt): drop to prevent muxer errors
-	// - Everything else: copy as-is
+	if mp4 {
+		// hvc1 tagging lets Apple devices play HEVC; faststart moves the
+		// index to the front so clients can start playback before download ends
+		if preset.Codec == CodecHEVC {
+			outputArgs = append(outputArgs, "-tag:v:0", "hvc1")
+		}
+		outputArgs = append(outputArgs, "-c:s", "mov_text", "-movflags", "+faststart", "-f", "mp4")
+		return inputArgs, outputArgs
+	}
+
+	outputArgs = appendMKVSubtitleArgs(outputArgs, subtitleCodecs, subtitleHandling)
+	outputArgs = append(outputArgs, "-c:t", "copy")
+
+	return inputArgs, outputArgs
+}
+
+// buildRemuxArgs copies every stream into MKV without re-encoding. AVI
+// sources often lack presentation timestamps, so they're generated. For an
+// audio-only preset the tracks in preset.AudioEncode are re-encoded to
+// preset.AudioCodec and everything else is still copied.
+func buildRemuxArgs(preset *Preset, subtitleCodecs []string, subtitleHandling string) (inputArgs []string, outputArgs []string) {
+	if preset.AudioCodec == "" {
+		inputArgs = []string{"-fflags", "+genpts"}
+	}
+	outputArgs = []string{
+		"-map", "0:v",
+		"-map", "0:a?",
+		"-map", "0:s?",
+		"-map", "0:t?",
+		"-map_chapters", "0",
+		"-c:v", "copy",
+		"-c:a", "copy",
+	}
+	for _, track := range preset.AudioEncode {
+		outputArgs = append(outputArgs, audioEncodeArgs(preset.AudioCodec, track.Index, track.Channels)...)
+	}
+	outputArgs = appendMKVSubtitleArgs(outputArgs, subtitleCodecs, subtitleHandling)
+	outputArgs = append(outputArgs, "-c:t", "copy")
+	return inputArgs, outputArgs
+}
+
+// audioEncodeArgs re-encodes audio track index (audio-relative) to codec.
+// Opus needs mapping family 1 to carry more than two channels.
+func audioEncodeArgs(codec string, index, channels int) []string {
+	bitrate := fmt.Sprintf("%dk", AudioEncodeBitrate(codec, channels)/1000)
+	switch codec {
+	case "opus":
+		args := []string{fmt.Sprintf("-c:a:%d", index), "libopus", fmt.Sprintf("-b:a:%d", index), bitrate}
+		if channels > 2 {
+			args = append(args, fmt.Sprintf("-mapping_family:a:%d", index), "1")
+		}
+		return args
+	default:
+		return []string{fmt.Sprintf("-c:a:%d", index), "eac3", fmt.Sprintf("-b:a:%d", index), bitrate}
+	}
+}
+
+// AudioEncodeBitrate is the bitrate an audio-only preset encodes a track
+// with channels to, in bits/second: EAC3 at 640k for surround and 224k for
+// stereo, Opus at 64k per channel.
+func AudioEncodeBitrate(codec string, channels int) int64 {
+	if channels <= 0 {
+		channels = 2
+	}
+	if codec == "opus" {
+		return int64(channels) * 64_000
+	}
+	if channels > 2 {
+		return 640_000
+	}
+	return 224_000
+}
+
+// IsLosslessAudio reports whether an audio codec (with its ffprobe profile,
+// which tells DTS-HD MA from lossy DTS) is lossless and worth compressing.
+func IsLosslessAudio(codec, profile string) bool {
+	codec = strings.ToLower(codec)
+	switch {
+	case codec == "truehd", codec == "mlp", codec == "flac", codec == "alac":
+		return true
+	case strings.HasPrefix(codec, "pcm_"):
+		return true
+	case codec == "dts":
+		return strings.EqualFold(profile, "DTS-HD MA")
+	}
+	return false
+}
+
+// LosslessAudioTracks returns the tracks an audio-only preset re-encodes
+func LosslessAudioTracks(tracks []AudioTrack) []AudioTrack {
+	var lossless []AudioTrack
+	for _, track := range tracks {
+		if IsLosslessAudio(track.Codec, track.Profile) {
+			lossless = append(lossless, track)
+		}
+	}
+	return lossless
+}
+
+// appendMKVSubtitleArgs handles subtitle codecs based on compatibility:
+// - mov_text: MP4 subtitle format, convert to srt for MKV output
+// - Unknown/unsupported (none, empty, webvtt): drop to prevent muxer errors
+// - Everything else: copy as-is
+func appendMKVSubtitleArgs(outputArgs []string, subtitleCodecs []string, subtitleHandling string) []string {
 	if containsSubtitleCodec(subtitleCodecs, "mov_text") {
 		switch normalizeSubtitleHandling(subtitleHandling) {
 		case SubtitleHandlingDrop:
-			outputArgs = append(outputArgs, "-sn")
+			return append(outputArgs, "-sn")
 		default:
-			outputArgs = append(outputArgs, "-c:s", "srt")
+			return append(outputArgs, "-c:s", "srt")
 		}
 	} else if hasUnsupportedSubtitleCodec(subtitleCodecs) {
 		// Drop unsupported subtitle streams to prevent muxer errors.
-		// This includes WebVTT (which FFmpeg can't properly parse in MKV) and
+		// This includes WebVTT (which FFmpeg can't properly parse in MKV),
+		// DVB teletext (common in TS recordings, which MKV can't hold) and
 		// unknown codecs that show as empty/none.
-		outputArgs = append(outputArgs, "-sn")
-	} else {
-		outputArgs = append(outputArgs, "-c:s", "copy")
+		return append(outputArgs, "-sn")
 	}
-
-	return inputArgs, outputArgs
+	return append(outputArgs, "-c:s", "copy")
 }
 
 func containsSubtitleCodec(codecs []string, target string) bool {
@@ -467,50 +858,131 @@ func containsSubtitleCodec(codecs []string, target string) bool {
 // Unsupported codecs include:
 // - Empty/none: FFmpeg couldn't parse the codec (e.g., WebVTT in MKV source)
 // - webvtt: WebVTT format which MKV muxer doesn't support
+// - dvb_teletext: teletext from TS recordings, which MKV can't hold
 func hasUnsupportedSubtitleCodec(codecs []string) bool {
 	for _, codec := range codecs {
 		codec = strings.ToLower(strings.TrimSpace(codec))
-		if codec == "" || codec == "none" || codec == "webvtt" {
+		if codec == "" || codec == "none" || codec == "webvtt" || codec == "dvb_teletext" {
 			return true
 		}
 	}
 	return false
 }
 
-// GeneratePresets creates presets using the best available encoder for each codec
+// GeneratePresets creates presets using the best available encoder for each
+// codec, or the encoder a preset is pinned to by SetPresetEncoders
 func GeneratePresets() map[string]*Preset {
 	presets := make(map[string]*Preset)
 
+	presetsMu.RLock()
+	pins := presetEncoders
+	svtAV1 := svtAV1Options
+	audio := audioCodec
+	reencodeBPP := reencodeAboveBPP
+	presetsMu.RUnlock()
+
 	for _, base := range BasePresets {
 		// Get the best available encoder for this preset's target codec
-		bestEncoder := GetBestEncoderForCodec(base.Codec)
+		encoder := GetBestEncoderForCodec(base.Codec).Accel
+		if pin, ok := pins[base.ID]; ok && pin != encoder {
+			if IsEncoderAvailableForCodec(pin, base.Codec) {
+				encoder = pin
+			} else {
+				presetsLog.Warn("Pinned encoder isn't available for the preset's codec",
+					"preset", base.ID, "pinned", pin, "codec", base.Codec, "using", encoder)
+			}
+		}
 
 		presets[base.ID] = &Preset{
 			ID:          base.ID,
 			Name:        base.Name,
 			Description: base.Description,
-			Encoder:     bestEncoder.Accel,
+			Encoder:     encoder,
 			Codec:       base.Codec,
 			MaxHeight:   base.MaxHeight,
+			AudioCodec:  base.AudioCodec,
+		}
+		if encoder == HWAccelNone && base.Codec == CodecAV1 {
+			options := svtAV1
+			presets[base.ID].SVTAV1 = &options
+		}
+		if base.AudioCodec != "" {
+			presets[base.ID].AudioCodec = audio
+		}
+		if base.Codec != CodecCopy {
+			presets[base.ID].ReencodeAboveBPP = reencodeBPP
 		}
 	}
 
 	return presets
 }
 
-// Presets cache - populated after encoder detection
-var generatedPresets map[string]*Preset
-var presetsInitialized bool
+// Presets cache - populated after encoder detection, regenerated after
+// RedetectEncoders
+var (
+	presetsMu          sync.RWMutex
+	generatedPresets   map[string]*Preset
+	presetsInitialized bool
+	presetEncoders     map[string]HWAccel // Pins set by SetPresetEncoders
+	svtAV1Options      = DefaultSVTAV1Options
+	audioCodec         = "eac3"
+	reencodeAboveBPP   float64
+)
+
+// SetReencodeAboveBPP sets the bits per pixel above which sources already in
+// a preset's codec are re-encoded instead of skipped; 0 turns it off. Takes
+// effect at the next InitPresets.
+func SetReencodeAboveBPP(bpp float64) {
+	presetsMu.Lock()
+	reencodeAboveBPP = bpp
+	presetsMu.Unlock()
+}
+
+// SetAudioCodec sets what the audio-only preset encodes lossless audio to,
+// eac3 or opus. Takes effect at the next InitPresets.
+func SetAudioCodec(codec string) {
+	presetsMu.Lock()
+	audioCodec = codec
+	presetsMu.Unlock()
+}
+
+// SetSVTAV1Options sets the libsvtav1 settings of software AV1 presets.
+// Takes effect at the next InitPresets.
+func SetSVTAV1Options(options SVTAV1Options) {
+	presetsMu.Lock()
+	svtAV1Options = options
+	presetsMu.Unlock()
+}
+
+// SetPresetEncoders pins presets to encoders by preset ID, e.g.
+// {"compress-hevc": "qsv"}, instead of the best detected one. Unknown
+// encoder names are ignored. Takes effect at the next InitPresets.
+func SetPresetEncoders(pins map[string]string) {
+	parsed := make(map[string]HWAccel, len(pins))
+	for id, name := range pins {
+		if accel, ok := ParseHWAccel(name); ok {
+			parsed[id] = accel
+		}
+	}
+	presetsMu.Lock()
+	presetEncoders = parsed
+	presetsMu.Unlock()
+}
 
 // InitPresets initializes presets based on available encoders
-// Must be called after DetectEncoders
+// Must be called after DetectEncoders (and again after RedetectEncoders)
 func InitPresets() {
-	generatedPresets = GeneratePresets()
+	presets := GeneratePresets()
+	presetsMu.Lock()
+	generatedPresets = presets
 	presetsInitialized = true
+	presetsMu.Unlock()
 }
 
 // GetPreset returns a preset by ID
 func GetPreset(id string) *Preset {
+	presetsMu.RLock()
+	defer presetsMu.RUnlock()
 	if !presetsInitialized {
 		// Fallback to software-only presets
 		return getSoftwarePreset(id)
@@ -518,6 +990,44 @@ func GetPreset(id string) *Preset {
 	return generatedPresets[id]
 }
 
+// IsRemuxPreset reports whether the preset only rewraps streams into MKV
+// (CodecCopy). Remuxes always write MKV and aren't held to the no-gain
+// size check, since the point is the container, not the size.
+func IsRemuxPreset(id string) bool {
+	preset := GetPreset(id)
+	return preset != nil && preset.Codec == CodecCopy && preset.AudioCodec == ""
+}
+
+// IsAudioPreset reports whether the preset keeps the video and only
+// re-encodes lossless audio. These write MKV too, since MP4 can't hold
+// the TrueHD or PGS streams they copy.
+func IsAudioPreset(id string) bool {
+	preset := GetPreset(id)
+	return preset != nil && preset.Codec == CodecCopy && preset.AudioCodec != ""
+}
+
+// AudioSkipReason returns why an audio-only preset would skip probe: it
+// has no lossless audio to compress. "" if it should be processed.
+func AudioSkipReason(probe *ProbeResult) string {
+	if len(LosslessAudioTracks(probe.AudioTracks)) == 0 {
+		return "No lossless audio tracks to compress"
+	}
+	return ""
+}
+
+// RemuxSkipReason returns why a remux preset would skip probe: it's
+// already in MKV or MP4, or its video isn't HEVC or AV1 (older codecs are
+// worth re-encoding instead). "" if it should be remuxed.
+func RemuxSkipReason(probe *ProbeResult) string {
+	if c := SourceContainer(probe.Path); c != "" {
+		return fmt.Sprintf("File is already in %s", strings.ToUpper(string(c)))
+	}
+	if !probe.IsHEVC && !probe.IsAV1 {
+		return fmt.Sprintf("Remux keeps HEVC or AV1 video only; this file is %s", probe.VideoCodec)
+	}
+	return ""
+}
+
 // getSoftwarePreset returns a software-only preset (fallback)
 func getSoftwarePreset(id string) *Preset {
 	for _, base := range BasePresets {
@@ -529,6 +1039,7 @@ func getSoftwarePreset(id string) *Preset {
 				Encoder:     HWAccelNone,
 				Codec:       base.Codec,
 				MaxHeight:   base.MaxHeight,
+				AudioCodec:  base.AudioCodec,
 			}
 		}
 	}
@@ -537,6 +1048,8 @@ func getSoftwarePreset(id string) *Preset {
 
 // ListPresets returns all available presets
 func ListPresets() []*Preset {
+	presetsMu.RLock()
+	defer presetsMu.RUnlock()
 	if !presetsInitialized {
 		// Return software-only presets as fallback
 		var presets []*Preset
@@ -548,6 +1061,7 @@ func ListPresets() []*Preset {
 				Encoder:     HWAccelNone,
 				Codec:       base.Codec,
 				MaxHeight:   base.MaxHeight,
+				AudioCodec:  base.AudioCodec,
 			})
 		}
 		return presets
@@ -1,6 +1,7 @@
 package ffmpeg
 
 import (
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -207,6 +208,75 @@ func TestBuildPresetArgsSubtitleHandling(t *testing.T) {
 	}
 }
 
+func TestBuildPresetArgsMP4Container(t *testing.T) {
+	preset := &Preset{
+		ID:        "test-hevc",
+		Encoder:   HWAccelNone,
+		Codec:     CodecHEVC,
+		Container: ContainerMP4,
+	}
+
+	_, outputArgs := BuildPresetArgs(preset, 0, []string{"hdmv_pgs_subtitle", "subrip"}, "convert", 8, "yuv420p", "h264", 0, 0)
+	if !containsArgPair(outputArgs, "-movflags", "+faststart") || !containsArgPair(outputArgs, "-f", "mp4") {
+		t.Errorf("expected faststart mp4 output, got %v", outputArgs)
+	}
+	if !containsArgPair(outputArgs, "-tag:v:0", "hvc1") {
+		t.Errorf("expected hvc1 tag for HEVC in mp4, got %v", outputArgs)
+	}
+	if !containsArgPair(outputArgs, "-c:s", "mov_text") {
+		t.Errorf("expected mov_text subtitles, got %v", outputArgs)
+	}
+	if !containsArgPair(outputArgs, "-map", "0:s:1") || containsArgPair(outputArgs, "-map", "0:s:0") || containsArgPair(outputArgs, "-map", "0:s?") {
+		t.Errorf("expected only the text subtitle to be mapped, got %v", outputArgs)
+	}
+
+	if !containsArgPair(outputArgs, "-map_chapters", "0") || containsArgPair(outputArgs, "-map", "0:t?") {
+		t.Errorf("expected chapters but no attachments in mp4, got %v", outputArgs)
+	}
+
+	_, outputArgs = BuildPresetArgs(preset, 0, []string{"subrip"}, "drop", 8, "yuv420p", "h264", 0, 0)
+	if containsArgPair(outputArgs, "-map", "0:s:0") {
+		t.Errorf("expected no subtitles mapped when dropping, got %v", outputArgs)
+	}
+}
+
+func TestBuildPresetArgsChaptersAndAttachments(t *testing.T) {
+	preset := &Preset{
+		ID:      "test-hevc",
+		Encoder: HWAccelNone,
+		Codec:   CodecHEVC,
+	}
+
+	// Attachments are kept even when unsupported subtitles are dropped
+	for _, subs := range [][]string{{"ass"}, {"webvtt"}, {"mov_text"}} {
+		_, outputArgs := BuildPresetArgs(preset, 0, subs, "drop", 8, "yuv420p", "h264", 0, 0)
+		if !containsArgPair(outputArgs, "-map", "0:t?") || !containsArgPair(outputArgs, "-c:t", "copy") {
+			t.Errorf("subtitles %v: expected attachments mapped and copied, got %v", subs, outputArgs)
+		}
+		if !containsArgPair(outputArgs, "-map_chapters", "0") {
+			t.Errorf("subtitles %v: expected chapters mapped, got %v", subs, outputArgs)
+		}
+	}
+}
+
+func TestOutputExt(t *testing.T) {
+	tests := []struct {
+		input     string
+		container Container
+		want      string
+	}{
+		{"/media/a.avi", ContainerMKV, ".mkv"},
+		{"/media/a.avi", "", ".mkv"},
+		{"/media/a.mkv", ContainerMP4, ".mp4"},
+		{"/media/a.m4v", ContainerMP4, ".m4v"},
+	}
+	for _, tt := range tests {
+		if got := OutputExt(tt.input, tt.container); got != tt.want {
+			t.Errorf("OutputExt(%q, %q) = %q, want %q", tt.input, tt.container, got, tt.want)
+		}
+	}
+}
+
 func containsArg(args []string, target string) bool {
 	for _, arg := range args {
 		if arg == target {
@@ -871,3 +941,430 @@ func TestGetHardwarePath(t *testing.T) {
 		}
 	}
 }
+
+func TestBuildPresetArgs10BitProfiles(t *testing.T) {
+	tests := []struct {
+		name     string
+		encoder  HWAccel
+		codec    Codec
+		bitDepth int
+		want     []string // pairs that must appear in order
+		absent   string
+	}{
+		{"x265 10-bit", HWAccelNone, CodecHEVC, 10, []string{"-pix_fmt:v:0", "yuv420p10le", "-profile:v:0", "main10"}, ""},
+		{"x265 8-bit", HWAccelNone, CodecHEVC, 8, nil, "main10"},
+		{"svtav1 10-bit", HWAccelNone, CodecAV1, 10, []string{"-pix_fmt:v:0", "yuv420p10le"}, ""},
+		{"nvenc 10-bit", HWAccelNVENC, CodecHEVC, 10, []string{"-profile:v:0", "main10"}, "-pix_fmt:v:0"},
+		{"qsv 10-bit", HWAccelQSV, CodecHEVC, 10, []string{"-pix_fmt:v:0", "p010le", "-profile:v:0", "main10"}, ""},
+		{"vaapi 10-bit uses filter", HWAccelVAAPI, CodecHEVC, 10, nil, "-pix_fmt:v:0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			preset := &Preset{ID: "test", Encoder: tt.encoder, Codec: tt.codec}
+			_, outputArgs := BuildPresetArgs(preset, 0, nil, "convert", tt.bitDepth, "yuv420p10le", "hevc", 0, 0)
+			args := strings.Join(outputArgs, " ")
+
+			if len(tt.want) > 0 && !strings.Contains(args, strings.Join(tt.want, " ")) {
+				t.Errorf("expected %v in args: %s", tt.want, args)
+			}
+			if tt.absent != "" && strings.Contains(args, tt.absent) {
+				t.Errorf("did not expect %q in args: %s", tt.absent, args)
+			}
+
+			// 10-bit options must stay attached to the transcoded stream, before the cover art copy
+			if idx := strings.Index(args, "-c:v:1 copy"); len(tt.want) > 0 && idx < strings.Index(args, tt.want[0]) {
+				t.Errorf("10-bit args placed after -c:v:1: %s", args)
+			}
+		})
+	}
+}
+
+func TestSupports10BitUndetected(t *testing.T) {
+	// Before detection, encoders are assumed capable so nothing changes
+	if !Supports10Bit(HWAccelNVENC, CodecHEVC) {
+		t.Error("expected undetected encoder to be treated as 10-bit capable")
+	}
+	if !Supports10Bit(HWAccelNone, CodecAV1) {
+		t.Error("software encoders always support 10-bit")
+	}
+}
+
+func TestValidateCustomArgs(t *testing.T) {
+	valid := [][]string{
+		nil,
+		{"-preset", "slow"},
+		{"-x265-params:v:0", "aq-mode=3", "-tune", "grain"},
+		{"-b:v", "5M", "-maxrate", "8M", "-svtav1-params", "tune=0:film-grain=8"},
+	}
+	for _, args := range valid {
+		if err := ValidateCustomArgs(args); err != nil {
+			t.Errorf("expected %v to be valid: %v", args, err)
+		}
+	}
+
+	invalid := [][]string{
+		{"slow"},
+		{"-i", "/etc/passwd"},
+		{"-c:v:0", "libx264"},
+		{"-t", "10"},
+		{"-map", "0:a"},
+		{"-an", "/config/shrinkray.yaml"},
+		{"-preset", "slow", "/tmp/out.mkv"},
+		{"-preset"},
+		{"-preset", "../slow"},
+		{"-vstats_file", "/tmp/vstats"},
+		{"-passlogfile", "/tmp/pass"},
+		{"-filter_script", "/tmp/filters"},
+		{"-sdp_file", "/tmp/out.sdp"},
+		{"-vf", "movie=/etc/passwd"},
+		{"-x265-params", "csv=/config/x265.csv"},
+		{"-x265-params", "stats=pass.log"},
+		{"-preset:a", "slow"},
+	}
+	for _, args := range invalid {
+		if err := ValidateCustomArgs(args); err == nil {
+			t.Errorf("expected %v to be rejected", args)
+		}
+	}
+}
+
+func TestBuildPresetArgsExtraArgs(t *testing.T) {
+	preset := &Preset{ID: "compress-hevc", Encoder: HWAccelNone, Codec: CodecHEVC, ExtraArgs: []string{"-tune", "grain"}}
+	_, outputArgs := BuildPresetArgs(preset, 0, nil, "convert", 8, "yuv420p", "h264", 0, 0)
+
+	tuneIdx, copyIdx := -1, -1
+	for i, arg := range outputArgs {
+		switch arg {
+		case "-tune":
+			tuneIdx = i
+		case "-c:v:1":
+			copyIdx = i
+		}
+	}
+	if tuneIdx == -1 || tuneIdx > copyIdx {
+		t.Errorf("expected extra args before -c:v:1, got %v", outputArgs)
+	}
+}
+
+func TestRedetectEncodersRegeneratesPresets(t *testing.T) {
+	// Restore the undetected state other tests rely on
+	t.Cleanup(func() {
+		availableEncoders.mu.Lock()
+		availableEncoders.encoders = make(map[EncoderKey]*HWEncoder)
+		availableEncoders.detected.Store(false)
+		availableEncoders.vaapiDevice = ""
+		availableEncoders.mu.Unlock()
+		presetsMu.Lock()
+		generatedPresets, presetsInitialized = nil, false
+		presetsMu.Unlock()
+	})
+
+	dir := t.TempDir()
+	ffmpegPath := filepath.Join(dir, "ffmpeg")
+	writeScript(t, ffmpegPath, "echo ' V....D libx265  libx265 H.265 / HEVC'\n")
+	DetectEncoders(ffmpegPath)
+	InitPresets()
+	if enc := GetEncoderByKey(HWAccelNone, CodecAV1); enc != nil && enc.Available {
+		t.Fatal("software AV1 should be unavailable before redetection")
+	}
+
+	// A redetect holding the lock doesn't make detection look unfinished
+	availableEncoders.mu.Lock()
+	detected := EncodersDetected()
+	availableEncoders.mu.Unlock()
+	if !detected {
+		t.Error("EncodersDetected should stay true while encoders are redetected")
+	}
+
+	// A newer ffmpeg adds SVT-AV1; DetectEncoders keeps the cached result
+	writeScript(t, ffmpegPath, "echo ' V....D libx265  libx265 H.265 / HEVC'\necho ' V....D libsvtav1  SVT-AV1'\n")
+	DetectEncoders(ffmpegPath)
+	if enc := GetEncoderByKey(HWAccelNone, CodecAV1); enc != nil && enc.Available {
+		t.Fatal("DetectEncoders should return cached results")
+	}
+
+	RedetectEncoders(ffmpegPath)
+	InitPresets()
+	if enc := GetEncoderByKey(HWAccelNone, CodecAV1); enc == nil || !enc.Available {
+		t.Fatal("software AV1 should be available after redetection")
+	}
+	if preset := GetPreset("compress-av1"); preset == nil || preset.Encoder != HWAccelNone {
+		t.Errorf("compress-av1 preset = %+v, want software encoder", preset)
+	}
+}
+
+func TestSetPresetEncodersPinsPresets(t *testing.T) {
+	t.Cleanup(func() {
+		availableEncoders.mu.Lock()
+		availableEncoders.encoders = make(map[EncoderKey]*HWEncoder)
+		availableEncoders.detected.Store(false)
+		availableEncoders.mu.Unlock()
+		SetPresetEncoders(nil)
+		presetsMu.Lock()
+		generatedPresets, presetsInitialized = nil, false
+		presetsMu.Unlock()
+	})
+
+	// VAAPI HEVC and software HEVC/AV1 are available
+	availableEncoders.mu.Lock()
+	availableEncoders.encoders = map[EncoderKey]*HWEncoder{
+		{HWAccelVAAPI, CodecHEVC}: {Accel: HWAccelVAAPI, Codec: CodecHEVC, Available: true},
+		{HWAccelNone, CodecHEVC}:  {Accel: HWAccelNone, Codec: CodecHEVC, Available: true},
+		{HWAccelNone, CodecAV1}:   {Accel: HWAccelNone, Codec: CodecAV1, Available: true},
+	}
+	availableEncoders.detected.Store(true)
+	availableEncoders.mu.Unlock()
+
+	SetPresetEncoders(map[string]string{
+		"compress-hevc": "none",  // Available: pinned
+		"compress-av1":  "qsv",   // Unavailable: best encoder instead
+		"1080p":         "bogus", // Unknown: ignored
+	})
+	InitPresets()
+
+	want := map[string]HWAccel{
+		"compress-hevc": HWAccelNone,
+		"compress-av1":  HWAccelNone,
+		"1080p":         HWAccelVAAPI,
+		"720p":          HWAccelVAAPI,
+	}
+	for id, encoder := range want {
+		if preset := GetPreset(id); preset == nil || preset.Encoder != encoder {
+			t.Errorf("%s encoder = %v, want %s", id, preset, encoder)
+		}
+	}
+}
+
+func TestBuildPresetArgsDevice(t *testing.T) {
+	vaapi := &Preset{ID: "compress-hevc", Encoder: HWAccelVAAPI, Codec: CodecHEVC, Device: "/dev/dri/renderD129"}
+	inputArgs, _ := BuildPresetArgs(vaapi, 0, nil, "convert", 8, "yuv420p", "h264", 0, 0)
+	if got := argAfter(inputArgs, "-vaapi_device"); got != "/dev/dri/renderD129" {
+		t.Errorf("-vaapi_device = %q, want /dev/dri/renderD129", got)
+	}
+
+	nvenc := &Preset{ID: "compress-hevc", Encoder: HWAccelNVENC, Codec: CodecHEVC, Device: "cuda:1"}
+	inputArgs, outputArgs := BuildPresetArgs(nvenc, 0, nil, "convert", 8, "yuv420p", "h264", 0, 0)
+	if got := argAfter(inputArgs, "-hwaccel_device"); got != "1" {
+		t.Errorf("-hwaccel_device = %q, want 1", got)
+	}
+	if got := argAfter(outputArgs, "-gpu"); got != "1" {
+		t.Errorf("-gpu = %q, want 1", got)
+	}
+
+	nvenc.Device = ""
+	_, outputArgs = BuildPresetArgs(nvenc, 0, nil, "convert", 8, "yuv420p", "h264", 0, 0)
+	if got := argAfter(outputArgs, "-gpu"); got != "" {
+		t.Errorf("unexpected -gpu %q without a device", got)
+	}
+}
+
+// argAfter returns the value following flag in args, or ""
+func argAfter(args []string, flag string) string {
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] == flag {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+func TestBuildPresetArgsSVTAV1Options(t *testing.T) {
+	preset := &Preset{ID: "compress-av1", Encoder: HWAccelNone, Codec: CodecAV1}
+	_, outputArgs := BuildPresetArgs(preset, 0, nil, "convert", 8, "yuv420p", "h264", 0, 0)
+	if got := argAfter(outputArgs, "-preset"); got != "6" {
+		t.Errorf("default -preset = %q, want 6", got)
+	}
+	if got := argAfter(outputArgs, "-svtav1-params:v:0"); got != "" {
+		t.Errorf("unexpected -svtav1-params %q with default options", got)
+	}
+
+	preset.SVTAV1 = &SVTAV1Options{Preset: 4, FilmGrain: 10, Tune: 0}
+	_, outputArgs = BuildPresetArgs(preset, 0, nil, "convert", 8, "yuv420p", "h264", 0, 0)
+	if got := argAfter(outputArgs, "-preset"); got != "4" {
+		t.Errorf("-preset = %q, want 4", got)
+	}
+	if got := argAfter(outputArgs, "-svtav1-params:v:0"); got != "tune=0:film-grain=10" {
+		t.Errorf("-svtav1-params = %q, want tune=0:film-grain=10", got)
+	}
+
+	// Options only apply to libsvtav1
+	preset.Encoder = HWAccelNVENC
+	_, outputArgs = BuildPresetArgs(preset, 0, nil, "convert", 8, "yuv420p", "h264", 0, 0)
+	if got := argAfter(outputArgs, "-preset"); got != "p4" {
+		t.Errorf("NVENC -preset = %q, want p4", got)
+	}
+}
+
+func TestBuildPresetArgsCrop(t *testing.T) {
+	crop := &Crop{Width: 1920, Height: 800, X: 0, Y: 140}
+
+	software := &Preset{ID: "1080p", Encoder: HWAccelNone, Codec: CodecHEVC, MaxHeight: 1080, Crop: crop}
+	_, outputArgs := BuildPresetArgs(software, 0, nil, "convert", 8, "yuv420p", "h264", 0, 0)
+	if got := argAfter(outputArgs, "-filter:v:0"); got != "crop=1920:800:0:140,scale=-2:'min(ih,1080)'" {
+		t.Errorf("software filter = %q, want crop before scale", got)
+	}
+
+	// NVENC frames must come off the GPU to be cropped, and scale on the CPU
+	nvenc := &Preset{ID: "compress-hevc", Encoder: HWAccelNVENC, Codec: CodecHEVC, MaxHeight: 720, Crop: crop}
+	inputArgs, outputArgs := BuildPresetArgs(nvenc, 0, nil, "convert", 8, "yuv420p", "h264", 0, 0)
+	if containsArg(inputArgs, "-hwaccel_output_format") || !containsArgPair(inputArgs, "-hwaccel", "cuda") {
+		t.Errorf("expected CUDA decode to system memory, got %v", inputArgs)
+	}
+	if got := argAfter(outputArgs, "-filter:v:0"); got != "crop=1920:800:0:140,scale=-2:'min(ih,720)'" {
+		t.Errorf("nvenc filter = %q", got)
+	}
+
+	vaapi := &Preset{ID: "compress-hevc", Encoder: HWAccelVAAPI, Codec: CodecHEVC, Crop: crop}
+	inputArgs, outputArgs = BuildPresetArgs(vaapi, 0, nil, "convert", 8, "yuv420p", "h264", 0, 0)
+	if containsArg(inputArgs, "-hwaccel_output_format") {
+		t.Errorf("expected VAAPI decode to system memory, got %v", inputArgs)
+	}
+	if got := argAfter(outputArgs, "-filter:v:0"); !strings.HasPrefix(got, "crop=1920:800:0:140,format=nv12,hwupload,scale_vaapi=") {
+		t.Errorf("vaapi filter = %q, want crop before upload", got)
+	}
+
+	software.Crop, software.MaxHeight = nil, 0
+	_, outputArgs = BuildPresetArgs(software, 0, nil, "convert", 8, "yuv420p", "h264", 0, 0)
+	if containsArg(outputArgs, "-filter:v:0") {
+		t.Errorf("unexpected filter without crop or scaling: %v", outputArgs)
+	}
+}
+
+func TestBuildPresetArgsThreads(t *testing.T) {
+	x265 := &Preset{ID: "compress-hevc", Encoder: HWAccelNone, Codec: CodecHEVC, Threads: 8}
+	_, outputArgs := BuildPresetArgs(x265, 0, nil, "convert", 8, "yuv420p", "h264", 0, 0)
+	if got := argAfter(outputArgs, "-threads"); got != "8" {
+		t.Errorf("-threads = %q, want 8", got)
+	}
+	if got := argAfter(outputArgs, "-x265-params:v:0"); got != "pools=8" {
+		t.Errorf("-x265-params = %q, want pools=8", got)
+	}
+
+	svt := &Preset{ID: "compress-av1", Encoder: HWAccelNone, Codec: CodecAV1, Threads: 4,
+		SVTAV1: &SVTAV1Options{Preset: 6, FilmGrain: 8, Tune: 1}}
+	_, outputArgs = BuildPresetArgs(svt, 0, nil, "convert", 8, "yuv420p", "h264", 0, 0)
+	if got := argAfter(outputArgs, "-svtav1-params:v:0"); got != "film-grain=8:lp=4" {
+		t.Errorf("-svtav1-params = %q, want film-grain=8:lp=4", got)
+	}
+
+	// Hardware encoders ignore the limit
+	nvenc := &Preset{ID: "compress-hevc", Encoder: HWAccelNVENC, Codec: CodecHEVC, Threads: 8}
+	_, outputArgs = BuildPresetArgs(nvenc, 0, nil, "convert", 8, "yuv420p", "h264", 0, 0)
+	if containsArg(outputArgs, "-threads") {
+		t.Errorf("unexpected -threads for NVENC: %v", outputArgs)
+	}
+
+	x265.Threads = 0
+	_, outputArgs = BuildPresetArgs(x265, 0, nil, "convert", 8, "yuv420p", "h264", 0, 0)
+	if containsArg(outputArgs, "-threads") || containsArg(outputArgs, "-x265-params:v:0") {
+		t.Errorf("unexpected thread args without a limit: %v", outputArgs)
+	}
+}
+
+func TestBuildPresetArgsRemux(t *testing.T) {
+	remux := &Preset{ID: "remux-mkv", Encoder: HWAccelNone, Codec: CodecCopy, Crop: &Crop{Width: 1920, Height: 800}}
+	inputArgs, outputArgs := BuildPresetArgs(remux, 8_000_000, []string{"subrip"}, "convert", 10, "yuv420p10le", "hevc", 22, 30)
+	if got := argAfter(inputArgs, "-fflags"); got != "+genpts" {
+		t.Errorf("-fflags = %q, want +genpts", got)
+	}
+	if got := argAfter(outputArgs, "-c:v"); got != "copy" {
+		t.Errorf("-c:v = %q, want copy", got)
+	}
+	for _, arg := range []string{"-crf", "-filter:v:0", "-vf", "-b:v", "-profile:v:0"} {
+		if containsArg(outputArgs, arg) {
+			t.Errorf("unexpected %s in a remux: %v", arg, outputArgs)
+		}
+	}
+	if got := argAfter(outputArgs, "-c:s"); got != "copy" {
+		t.Errorf("-c:s = %q, want copy", got)
+	}
+
+	// MKV can't hold teletext from TS recordings
+	_, outputArgs = BuildPresetArgs(remux, 0, []string{"dvb_subtitle", "dvb_teletext"}, "convert", 8, "yuv420p", "hevc", 0, 0)
+	if !containsArg(outputArgs, "-sn") {
+		t.Errorf("expected subtitles dropped for teletext: %v", outputArgs)
+	}
+}
+
+func TestRemuxSkipReason(t *testing.T) {
+	tests := []struct {
+		probe *ProbeResult
+		skip  bool
+	}{
+		{&ProbeResult{Path: "/media/show.avi", VideoCodec: "hevc", IsHEVC: true}, false},
+		{&ProbeResult{Path: "/media/show.ts", VideoCodec: "av1", IsAV1: true}, false},
+		{&ProbeResult{Path: "/media/show.mkv", VideoCodec: "hevc", IsHEVC: true}, true},
+		{&ProbeResult{Path: "/media/show.mp4", VideoCodec: "hevc", IsHEVC: true}, true},
+		{&ProbeResult{Path: "/media/show.avi", VideoCodec: "mpeg4"}, true},
+	}
+	for _, tt := range tests {
+		reason := RemuxSkipReason(tt.probe)
+		if (reason != "") != tt.skip {
+			t.Errorf("RemuxSkipReason(%s, %s) = %q, want skip=%v", tt.probe.Path, tt.probe.VideoCodec, reason, tt.skip)
+		}
+		if WouldSkip(tt.probe, &Preset{Codec: CodecCopy}) != tt.skip {
+			t.Errorf("WouldSkip(%s, %s) disagrees with RemuxSkipReason", tt.probe.Path, tt.probe.VideoCodec)
+		}
+	}
+}
+
+func TestBuildPresetArgsAudioOnly(t *testing.T) {
+	audio := &Preset{ID: "compress-audio", Encoder: HWAccelNone, Codec: CodecCopy, AudioCodec: "eac3",
+		AudioEncode: []AudioTrack{{Index: 1, Codec: "truehd", Channels: 8}}}
+	inputArgs, outputArgs := BuildPresetArgs(audio, 8_000_000, []string{"hdmv_pgs_subtitle"}, "convert", 10, "yuv420p10le", "hevc", 22, 30)
+	if containsArg(inputArgs, "-fflags") {
+		t.Errorf("unexpected -fflags outside a remux: %v", inputArgs)
+	}
+	if got := argAfter(outputArgs, "-c:v"); got != "copy" {
+		t.Errorf("-c:v = %q, want copy", got)
+	}
+	if got := argAfter(outputArgs, "-c:a"); got != "copy" {
+		t.Errorf("-c:a = %q, want copy for the other tracks", got)
+	}
+	if got := argAfter(outputArgs, "-c:a:1"); got != "eac3" {
+		t.Errorf("-c:a:1 = %q, want eac3", got)
+	}
+	if got := argAfter(outputArgs, "-b:a:1"); got != "640k" {
+		t.Errorf("-b:a:1 = %q, want 640k", got)
+	}
+
+	audio.AudioCodec = "opus"
+	_, outputArgs = BuildPresetArgs(audio, 8_000_000, nil, "convert", 10, "yuv420p10le", "hevc", 22, 30)
+	if got := argAfter(outputArgs, "-c:a:1"); got != "libopus" {
+		t.Errorf("-c:a:1 = %q, want libopus", got)
+	}
+	if got := argAfter(outputArgs, "-mapping_family:a:1"); got != "1" {
+		t.Errorf("-mapping_family:a:1 = %q, want 1 for 7.1", got)
+	}
+}
+
+func TestIsLosslessAudio(t *testing.T) {
+	tests := []struct {
+		codec, profile string
+		want           bool
+	}{
+		{"truehd", "", true},
+		{"dts", "DTS-HD MA", true},
+		{"dts", "DTS", false},
+		{"dts", "DTS-HD HRA", false},
+		{"flac", "", true},
+		{"pcm_s24le", "", true},
+		{"eac3", "", false},
+		{"aac", "LC", false},
+	}
+	for _, tt := range tests {
+		if got := IsLosslessAudio(tt.codec, tt.profile); got != tt.want {
+			t.Errorf("IsLosslessAudio(%q, %q) = %v, want %v", tt.codec, tt.profile, got, tt.want)
+		}
+	}
+
+	tracks := []AudioTrack{{Index: 0, Codec: "truehd"}, {Index: 1, Codec: "ac3"}, {Index: 2, Codec: "dts", Profile: "DTS-HD MA"}}
+	lossless := LosslessAudioTracks(tracks)
+	if len(lossless) != 2 || lossless[0].Index != 0 || lossless[1].Index != 2 {
+		t.Errorf("LosslessAudioTracks = %+v, want tracks 0 and 2", lossless)
+	}
+	if AudioSkipReason(&ProbeResult{AudioTracks: tracks[1:2]}) == "" {
+		t.Error("expected a skip for a file without lossless audio")
+	}
+}
@@ -0,0 +1,115 @@
+package ffmpeg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// DefaultPresetTestLength is how much of the source TestPreset encodes
+const DefaultPresetTestLength = 30 * time.Second
+
+// PresetTestResult is the outcome of TestPreset. Sizes cover the video
+// stream only; audio and subtitles are copied as-is in a real encode.
+type PresetTestResult struct {
+	PresetID        string  `json:"preset_id"`
+	Encoder         HWAccel `json:"encoder"`
+	Codec           Codec   `json:"codec"`
+	StartSeconds    float64 `json:"start_seconds"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	SourceBytes     int64   `json:"source_bytes"`    // Estimated source bytes for the clip, assuming a constant bitrate
+	OutputBytes     int64   `json:"output_bytes"`    // Encoded clip size
+	SizeRatio       float64 `json:"size_ratio"`      // OutputBytes / SourceBytes
+	ProjectedBytes  int64   `json:"projected_bytes"` // Whole file at the clip's ratio
+	SSIM            float64 `json:"ssim"`            // Clip vs the same span of the source (0-1)
+	EncodeSeconds   float64 `json:"encode_seconds"`
+	Speed           float64 `json:"speed"` // Clip length / encode time, 1.0 = realtime
+}
+
+// PresetTestOffset centres a test clip of length in the source, or starts
+// at 0 if the source is shorter
+func PresetTestOffset(duration, length time.Duration) time.Duration {
+	if duration <= length {
+		return 0
+	}
+	return (duration - length) / 2
+}
+
+// TestPreset encodes length of probe's file from offset with preset, and
+// measures the clip's size, SSIM against the source and encode speed, so a
+// preset can be checked before a batch uses it. Quality is the configured
+// (or encoder default) value; no search is run.
+func (t *Transcoder) TestPreset(
+	ctx context.Context,
+	probe *ProbeResult,
+	preset *Preset,
+	offset, length time.Duration,
+	qualityHEVC, qualityAV1 int,
+	tempDir string,
+) (*PresetTestResult, error) {
+	if probe.Duration <= 0 || probe.Size <= 0 {
+		return nil, fmt.Errorf("source duration and size are required for a test encode")
+	}
+	if offset >= probe.Duration {
+		return nil, fmt.Errorf("start %s is past the end of the %s source", formatSeconds(offset), formatSeconds(probe.Duration))
+	}
+	length = min(length, probe.Duration-offset)
+
+	workDir, err := os.MkdirTemp(tempDir, "shrinkray-test-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sample directory: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+	samplePath := filepath.Join(workDir, "sample.mkv")
+
+	inputArgs, outputArgs := BuildPresetArgs(preset, probe.Bitrate, nil, string(SubtitleHandlingDrop),
+		probe.BitDepth, probe.PixFmt, probe.VideoCodec, qualityHEVC, qualityAV1)
+	args := append([]string{}, inputArgs...)
+	args = append(args,
+		"-ss", formatSeconds(offset),
+		"-t", formatSeconds(length),
+		"-i", probe.Path,
+		"-y",
+	)
+	args = append(args, outputArgs...)
+	args = append(args, "-an", "-sn", "-dn", "-f", "matroska", samplePath)
+
+	start := time.Now()
+	cmd := exec.CommandContext(ctx, t.ffmpegPath, args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("test encode failed: %w: %s", err, lastLine(string(output)))
+	}
+	elapsed := time.Since(start)
+
+	info, err := os.Stat(samplePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat sample: %w", err)
+	}
+	ssim, err := t.measureSSIM(ctx, probe.Path, samplePath, offset, length)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PresetTestResult{
+		PresetID:        preset.ID,
+		Encoder:         preset.Encoder,
+		Codec:           preset.Codec,
+		StartSeconds:    offset.Seconds(),
+		DurationSeconds: length.Seconds(),
+		SourceBytes:     int64(float64(probe.Size) * float64(length) / float64(probe.Duration)),
+		OutputBytes:     info.Size(),
+		SSIM:            ssim,
+		EncodeSeconds:   elapsed.Seconds(),
+	}
+	if result.SourceBytes > 0 {
+		result.SizeRatio = float64(result.OutputBytes) / float64(result.SourceBytes)
+		result.ProjectedBytes = int64(result.SizeRatio * float64(probe.Size))
+	}
+	if elapsed > 0 {
+		result.Speed = length.Seconds() / elapsed.Seconds()
+	}
+	return result, nil
+}
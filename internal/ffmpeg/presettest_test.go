@@ -0,0 +1,31 @@
+package ffmpeg
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPresetTestOffset(t *testing.T) {
+	if got := PresetTestOffset(10*time.Minute, 30*time.Second); got != 285*time.Second {
+		t.Errorf("PresetTestOffset = %v, want 4m45s (centred)", got)
+	}
+	if got := PresetTestOffset(20*time.Second, 30*time.Second); got != 0 {
+		t.Errorf("PresetTestOffset = %v, want 0 for a short source", got)
+	}
+}
+
+func TestTestPresetRejectsBadInput(t *testing.T) {
+	transcoder := NewTranscoder("ffmpeg")
+	preset := &Preset{ID: "compress-hevc", Encoder: HWAccelNone, Codec: CodecHEVC}
+
+	if _, err := transcoder.TestPreset(context.Background(), &ProbeResult{Path: "/media/a.mkv"}, preset,
+		0, DefaultPresetTestLength, 0, 0, t.TempDir()); err == nil {
+		t.Error("expected an error without a duration")
+	}
+	probe := &ProbeResult{Path: "/media/a.mkv", Size: 1 << 20, Duration: time.Minute}
+	if _, err := transcoder.TestPreset(context.Background(), probe, preset,
+		2*time.Minute, DefaultPresetTestLength, 0, 0, t.TempDir()); err == nil {
+		t.Error("expected an error for a start past the end")
+	}
+}
@@ -0,0 +1,45 @@
+package ffmpeg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// PreviewWidth is the width of preview frames; height keeps the aspect ratio
+const PreviewWidth = 320
+
+// ExtractFrame decodes one frame at position at from path and returns it as
+// a JPEG scaled to width. It works on an MKV that is still being written,
+// so it can show what a running encode looks like so far.
+func ExtractFrame(ctx context.Context, ffmpegPath, path string, at time.Duration, width int) ([]byte, error) {
+	args := []string{"-nostdin", "-v", "error"}
+	if at > 0 {
+		args = append(args, "-ss", fmt.Sprintf("%.3f", at.Seconds()))
+	}
+	args = append(args,
+		"-i", path,
+		"-map", "0:v:0",
+		"-frames:v", "1",
+		"-vf", fmt.Sprintf("scale=%d:-2", width),
+		"-q:v", "5",
+		"-f", "mjpeg",
+		"pipe:1",
+	)
+
+	cmd := exec.CommandContext(ctx, ffmpegPath, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("frame extraction failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if stdout.Len() == 0 {
+		return nil, errors.New("no frame decoded yet")
+	}
+	return stdout.Bytes(), nil
+}
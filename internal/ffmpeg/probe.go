@@ -28,22 +28,75 @@ type ProbeResult struct {
 	PixFmt         string        `json:"pix_fmt"`    // pixel format (e.g., yuv420p, yuv420p10le)
 	BitDepth       int           `json:"bit_depth"`  // color bit depth (8, 10, 12)
 	ColorRange     string        `json:"color_range"` // tv (limited) or pc (full)
+	ColorPrimaries string        `json:"color_primaries,omitempty"` // e.g., bt709, bt2020
+	ColorTransfer  string        `json:"color_transfer,omitempty"`  // e.g., bt709, smpte2084 (PQ), arib-std-b67 (HLG)
+	ColorSpace     string        `json:"color_space,omitempty"`     // matrix coefficients, e.g., bt2020nc
+	FieldOrder     string        `json:"field_order,omitempty"`     // progressive, tt, bb, tb, bt
+	Interlaced     bool          `json:"interlaced,omitempty"`      // true if the field order is interlaced
+	HDR            *HDRInfo      `json:"hdr,omitempty"`             // nil for SDR sources
 	Streams        []ProbeStream `json:"streams,omitempty"`
+	AudioTracks    []AudioTrack    `json:"audio_tracks,omitempty"`    // Every audio stream, in file order
+	SubtitleTracks []SubtitleTrack `json:"subtitle_tracks,omitempty"` // Every subtitle stream, in file order
+	Chapters       int             `json:"chapters,omitempty"`
+	Attachments    int             `json:"attachments,omitempty"` // Attached files such as fonts for styled subtitles
 }
 
 // ProbeStream contains metadata about a media stream.
 type ProbeStream struct {
-	Type      string  `json:"type"`
-	Codec     string  `json:"codec"`
-	Width     int     `json:"width,omitempty"`
-	Height    int     `json:"height,omitempty"`
-	FrameRate float64 `json:"frame_rate,omitempty"`
+	Type          string  `json:"type"`
+	Codec         string  `json:"codec"`
+	Profile       string  `json:"profile,omitempty"` // e.g. DTS-HD MA, Main 10
+	Width         int     `json:"width,omitempty"`
+	Height        int     `json:"height,omitempty"`
+	FrameRate     float64 `json:"frame_rate,omitempty"`
+	Bitrate       int64   `json:"bitrate,omitempty"`        // bits per second, 0 if unknown
+	Channels      int     `json:"channels,omitempty"`       // audio channel count
+	ChannelLayout string  `json:"channel_layout,omitempty"` // audio layout, e.g. stereo, 5.1(side)
+	Language      string  `json:"language,omitempty"`       // ISO 639-2 tag, empty if untagged
+	Title         string  `json:"title,omitempty"`
+	Default       bool    `json:"default,omitempty"`
+	Forced        bool    `json:"forced,omitempty"`
+}
+
+// AudioTrack describes one audio stream. Index is the audio-relative
+// position, so the stream is addressed as 0:a:<Index> in ffmpeg maps.
+type AudioTrack struct {
+	Index         int    `json:"index"`
+	Codec         string `json:"codec"`
+	Profile       string `json:"profile,omitempty"`        // e.g. DTS-HD MA; tells lossless DTS from the lossy core
+	Language      string `json:"language,omitempty"`       // ISO 639-2 tag (eng, jpn), empty if untagged
+	Title         string `json:"title,omitempty"`          // e.g. "Director's Commentary"
+	Channels      int    `json:"channels,omitempty"`
+	ChannelLayout string `json:"channel_layout,omitempty"` // e.g. stereo, 5.1(side)
+	SampleRate    int    `json:"sample_rate,omitempty"`
+	Bitrate       int64  `json:"bitrate,omitempty"` // bits per second, 0 if unknown
+	Default       bool   `json:"default,omitempty"`
+	Forced        bool   `json:"forced,omitempty"`
+	Commentary    bool   `json:"commentary,omitempty"`  // Flagged as a commentary track
+	Descriptive   bool   `json:"descriptive,omitempty"` // Audio description for the visually impaired
+}
+
+// SubtitleTrack describes one subtitle stream. Index is subtitle-relative (0:s:<Index>).
+type SubtitleTrack struct {
+	Index           int    `json:"index"`
+	Codec           string `json:"codec"`
+	Language        string `json:"language,omitempty"`
+	Title           string `json:"title,omitempty"`
+	Default         bool   `json:"default,omitempty"`
+	Forced          bool   `json:"forced,omitempty"`
+	HearingImpaired bool   `json:"hearing_impaired,omitempty"` // SDH: includes sound descriptions
 }
 
 // ffprobeOutput represents the JSON output from ffprobe
 type ffprobeOutput struct {
-	Format  ffprobeFormat   `json:"format"`
-	Streams []ffprobeStream `json:"streams"`
+	Format   ffprobeFormat    `json:"format"`
+	Streams  []ffprobeStream  `json:"streams"`
+	Chapters []ffprobeChapter `json:"chapters"`
+}
+
+// ffprobeChapter is one chapter; only the count is used
+type ffprobeChapter struct {
+	ID int64 `json:"id"`
 }
 
 type ffprobeFormat struct {
@@ -57,14 +110,25 @@ type ffprobeFormat struct {
 type ffprobeStream struct {
 	CodecType        string            `json:"codec_type"`
 	CodecName        string            `json:"codec_name"`
+	Profile          string            `json:"profile"`
 	Width            int               `json:"width"`
 	Height           int               `json:"height"`
 	PixFmt           string            `json:"pix_fmt"`
 	BitsPerRawSample string            `json:"bits_per_raw_sample"`
 	ColorRange       string            `json:"color_range"`
+	ColorPrimaries   string            `json:"color_primaries"`
+	ColorTransfer    string            `json:"color_transfer"`
+	ColorSpace       string            `json:"color_space"`
+	FieldOrder       string            `json:"field_order"`
+	SideDataList     []ffprobeSideData `json:"side_data_list"`
 	RFrameRate       string            `json:"r_frame_rate"`
 	AvgFrameRate     string            `json:"avg_frame_rate"`
 	Duration         string            `json:"duration"`
+	BitRate          string            `json:"bit_rate"`
+	Channels         int               `json:"channels"`
+	ChannelLayout    string            `json:"channel_layout"`
+	SampleRate       string            `json:"sample_rate"`
+	Disposition      map[string]int    `json:"disposition"`
 	Tags             map[string]string `json:"tags"`
 }
 
@@ -78,13 +142,14 @@ func NewProber(ffprobePath string) *Prober {
 	return &Prober{ffprobePath: ffprobePath}
 }
 
-// Probe returns metadata about a video file
-func (p *Prober) Probe(ctx context.Context, path string) (*ProbeResult, error) {
+// probe runs ffprobe on a file, for Probe once it has a probe slot
+func (p *Prober) probe(ctx context.Context, path string) (*ProbeResult, error) {
 	cmd := exec.CommandContext(ctx, p.ffprobePath,
 		"-v", "quiet",
 		"-print_format", "json",
 		"-show_format",
 		"-show_streams",
+		"-show_chapters",
 		path,
 	)
 
@@ -102,8 +167,9 @@ func (p *Prober) Probe(ctx context.Context, path string) (*ProbeResult, error) {
 	}
 
 	result := &ProbeResult{
-		Path:   path,
-		Format: probeOutput.Format.FormatName,
+		Path:     path,
+		Format:   probeOutput.Format.FormatName,
+		Chapters: len(probeOutput.Chapters),
 	}
 
 	// Parse format-level metadata
@@ -130,8 +196,13 @@ func (p *Prober) Probe(ctx context.Context, path string) (*ProbeResult, error) {
 		}
 
 		probeStream := ProbeStream{
-			Type:  stream.CodecType,
-			Codec: stream.CodecName,
+			Type:     stream.CodecType,
+			Codec:    stream.CodecName,
+			Profile:  stream.Profile,
+			Language: streamLanguage(stream.Tags),
+			Title:    streamTag(stream.Tags, "title"),
+			Default:  stream.Disposition["default"] == 1,
+			Forced:   stream.Disposition["forced"] == 1,
 		}
 		if stream.Width > 0 {
 			probeStream.Width = stream.Width
@@ -139,6 +210,11 @@ func (p *Prober) Probe(ctx context.Context, path string) (*ProbeResult, error) {
 		if stream.Height > 0 {
 			probeStream.Height = stream.Height
 		}
+		probeStream.Bitrate = parseStreamBitrate(stream)
+		if stream.CodecType == "audio" {
+			probeStream.Channels = stream.Channels
+			probeStream.ChannelLayout = stream.ChannelLayout
+		}
 		if stream.CodecType == "video" {
 			frameRate := parseFrameRate(stream.RFrameRate)
 			if frameRate == 0 {
@@ -160,6 +236,12 @@ func (p *Prober) Probe(ctx context.Context, path string) (*ProbeResult, error) {
 				result.PixFmt = stream.PixFmt
 				result.ColorRange = stream.ColorRange
 				result.BitDepth = detectBitDepth(stream.PixFmt, stream.BitsPerRawSample)
+				result.ColorPrimaries = stream.ColorPrimaries
+				result.ColorTransfer = stream.ColorTransfer
+				result.ColorSpace = stream.ColorSpace
+				result.HDR = detectHDR(stream.ColorTransfer, stream.SideDataList)
+				result.FieldOrder = stream.FieldOrder
+				result.Interlaced = isInterlacedFieldOrder(stream.FieldOrder)
 			}
 			if streamDuration, ok := parseDurationValue(stream.Duration); ok && streamDuration > maxVideoDuration {
 				maxVideoDuration = streamDuration
@@ -171,13 +253,22 @@ func (p *Prober) Probe(ctx context.Context, path string) (*ProbeResult, error) {
 			if result.AudioCodec == "" { // Take first audio stream
 				result.AudioCodec = stream.CodecName
 			}
+			result.AudioTracks = append(result.AudioTracks, newAudioTrack(len(result.AudioTracks), stream))
 		case "subtitle":
 			if stream.CodecName != "" {
 				result.SubtitleCodecs = append(result.SubtitleCodecs, strings.ToLower(stream.CodecName))
 			}
+			result.SubtitleTracks = append(result.SubtitleTracks, newSubtitleTrack(len(result.SubtitleTracks), stream))
+		case "attachment":
+			result.Attachments++
 		}
 	}
 
+	// Static HDR metadata and HDR10+ are only visible on frames
+	if result.HDR != nil {
+		p.probeHDRFrameData(ctx, path, result.HDR)
+	}
+
 	if result.Duration == 0 {
 		if maxVideoDuration > 0 {
 			result.Duration = maxVideoDuration
@@ -235,6 +326,18 @@ func (p *ProbeResult) Is10Bit() bool {
 	return p.BitDepth >= 10
 }
 
+// OverallBitrate is the container bitrate in bits/s, derived from size and
+// duration when the container doesn't report one. 0 if unknown.
+func (p *ProbeResult) OverallBitrate() int64 {
+	if p.Bitrate > 0 {
+		return p.Bitrate
+	}
+	if p.Duration > 0 {
+		return int64(float64(p.Size*8) / p.Duration.Seconds())
+	}
+	return 0
+}
+
 // parseFrameRate parses a frame rate string like "30000/1001" or "30/1"
 func parseFrameRate(s string) float64 {
 	if s == "" || s == "0/0" {
@@ -253,6 +356,76 @@ func parseFrameRate(s string) float64 {
 	return num / den
 }
 
+// parseStreamBitrate returns a stream's bitrate in bits per second. Matroska
+// files usually omit bit_rate on streams, so fall back to the BPS statistics tag
+// written by mkvmerge/ffmpeg.
+func parseStreamBitrate(stream ffprobeStream) int64 {
+	for _, value := range []string{stream.BitRate, stream.Tags["BPS"], stream.Tags["BPS-eng"]} {
+		if value == "" || value == "N/A" {
+			continue
+		}
+		if bitrate, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64); err == nil && bitrate > 0 {
+			return bitrate
+		}
+	}
+	return 0
+}
+
+// newAudioTrack builds the AudioTrack for the index-th audio stream
+func newAudioTrack(index int, stream ffprobeStream) AudioTrack {
+	sampleRate, _ := strconv.Atoi(stream.SampleRate)
+	return AudioTrack{
+		Index:         index,
+		Codec:         stream.CodecName,
+		Profile:       stream.Profile,
+		Language:      streamLanguage(stream.Tags),
+		Title:         streamTag(stream.Tags, "title"),
+		Channels:      stream.Channels,
+		ChannelLayout: stream.ChannelLayout,
+		SampleRate:    sampleRate,
+		Bitrate:       parseStreamBitrate(stream),
+		Default:       stream.Disposition["default"] == 1,
+		Forced:        stream.Disposition["forced"] == 1,
+		Commentary:    stream.Disposition["comment"] == 1,
+		Descriptive:   stream.Disposition["visual_impaired"] == 1 || stream.Disposition["descriptions"] == 1,
+	}
+}
+
+// newSubtitleTrack builds the SubtitleTrack for the index-th subtitle stream
+func newSubtitleTrack(index int, stream ffprobeStream) SubtitleTrack {
+	return SubtitleTrack{
+		Index:           index,
+		Codec:           strings.ToLower(stream.CodecName),
+		Language:        streamLanguage(stream.Tags),
+		Title:           streamTag(stream.Tags, "title"),
+		Default:         stream.Disposition["default"] == 1,
+		Forced:          stream.Disposition["forced"] == 1,
+		HearingImpaired: stream.Disposition["hearing_impaired"] == 1,
+	}
+}
+
+// streamTag looks up a tag case-insensitively (MKV tags are often upper-case)
+func streamTag(tags map[string]string, key string) string {
+	if v, ok := tags[key]; ok {
+		return strings.TrimSpace(v)
+	}
+	for k, v := range tags {
+		if strings.EqualFold(k, key) {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+// streamLanguage returns the lower-cased language tag, treating "und" as untagged
+func streamLanguage(tags map[string]string) string {
+	lang := strings.ToLower(streamTag(tags, "language"))
+	if lang == "und" {
+		return ""
+	}
+	return lang
+}
+
 func parseDurationValue(value string) (time.Duration, bool) {
 	value = strings.TrimSpace(value)
 	if value == "" || value == "N/A" {
@@ -303,17 +476,8 @@ func parseDurationValue(value string) (time.Duration, bool) {
 	return time.Duration(seconds * float64(time.Second)), true
 }
 
-// IsVideoFile returns true if the file extension suggests a video file
+// IsVideoFile returns true if the file extension suggests a video file. See
+// SetVideoExtensions.
 func IsVideoFile(path string) bool {
-	ext := strings.ToLower(path)
-	videoExtensions := []string{
-		".mkv", ".mp4", ".avi", ".mov", ".wmv", ".flv",
-		".webm", ".m4v", ".mpeg", ".mpg", ".m2ts", ".ts",
-	}
-	for _, ve := range videoExtensions {
-		if strings.HasSuffix(ext, ve) {
-			return true
-		}
-	}
-	return false
+	return isVideoExtension(path)
 }
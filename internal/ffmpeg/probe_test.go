@@ -156,3 +156,43 @@ func TestIsVideoFile(t *testing.T) {
 		}
 	}
 }
+
+func TestNewAudioTrack(t *testing.T) {
+	stream := ffprobeStream{
+		CodecType:     "audio",
+		CodecName:     "eac3",
+		Channels:      6,
+		ChannelLayout: "5.1(side)",
+		SampleRate:    "48000",
+		Disposition:   map[string]int{"default": 1, "comment": 1},
+		Tags:          map[string]string{"LANGUAGE": "ENG", "title": "Surround", "BPS": "640000"},
+	}
+
+	track := newAudioTrack(1, stream)
+	if track.Index != 1 || track.Language != "eng" || track.Title != "Surround" {
+		t.Errorf("unexpected track identity: %+v", track)
+	}
+	if track.Channels != 6 || track.ChannelLayout != "5.1(side)" || track.SampleRate != 48000 {
+		t.Errorf("unexpected channel info: %+v", track)
+	}
+	if track.Bitrate != 640000 || !track.Default {
+		t.Errorf("unexpected bitrate/default: %+v", track)
+	}
+	if !track.Commentary || track.Descriptive || track.Forced {
+		t.Errorf("unexpected flags: %+v", track)
+	}
+}
+
+func TestNewSubtitleTrack(t *testing.T) {
+	stream := ffprobeStream{
+		CodecType:   "subtitle",
+		CodecName:   "SUBRIP",
+		Disposition: map[string]int{"forced": 1, "hearing_impaired": 1},
+		Tags:        map[string]string{"language": "und"},
+	}
+
+	track := newSubtitleTrack(0, stream)
+	if track.Codec != "subrip" || track.Language != "" || !track.Forced || track.Default || !track.HearingImpaired {
+		t.Errorf("unexpected subtitle track: %+v", track)
+	}
+}
@@ -0,0 +1,118 @@
+package ffmpeg
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultProbeConcurrency is how many ffprobe runs are allowed at once
+// unless SetProbeConcurrency says otherwise
+const DefaultProbeConcurrency = 8
+
+// probeSlots bounds the ffprobe runs of every Prober, so browsing or
+// queueing a folder of thousands of files doesn't start thousands of
+// ffprobe processes. Callers queue for a slot in the order they ask.
+var probeSlots = newSlotLimiter(DefaultProbeConcurrency)
+
+// SetProbeConcurrency sets how many files can be probed at once (at least 1).
+// Probes already running finish; waiting ones start as slots free up.
+func SetProbeConcurrency(n int) {
+	probeSlots.setLimit(max(n, 1))
+}
+
+// ProbeConcurrency returns how many files can be probed at once
+func ProbeConcurrency() int {
+	probeSlots.mu.Lock()
+	defer probeSlots.mu.Unlock()
+	return probeSlots.limit
+}
+
+// Probe returns metadata about a video file, waiting for a probe slot
+// first (see SetProbeConcurrency)
+func (p *Prober) Probe(ctx context.Context, path string) (*ProbeResult, error) {
+	return p.ProbeWithTimeout(ctx, path, 0)
+}
+
+// ProbeWithTimeout is Probe with a time limit, counted from when the probe
+// gets a slot rather than from the call. 0 means no limit.
+func (p *Prober) ProbeWithTimeout(ctx context.Context, path string, timeout time.Duration) (*ProbeResult, error) {
+	if err := probeSlots.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer probeSlots.release()
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return p.probe(ctx, path)
+}
+
+// slotLimiter is a semaphore whose size can change while in use
+type slotLimiter struct {
+	mu      sync.Mutex
+	limit   int
+	active  int
+	waiters []chan struct{}
+}
+
+func newSlotLimiter(limit int) *slotLimiter {
+	return &slotLimiter{limit: limit}
+}
+
+// acquire waits for a free slot, or until ctx is done
+func (l *slotLimiter) acquire(ctx context.Context) error {
+	l.mu.Lock()
+	if l.active < l.limit && len(l.waiters) == 0 {
+		l.active++
+		l.mu.Unlock()
+		return nil
+	}
+	ready := make(chan struct{})
+	l.waiters = append(l.waiters, ready)
+	l.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		for i, waiter := range l.waiters {
+			if waiter == ready {
+				l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+				return ctx.Err()
+			}
+		}
+		// Granted a slot as ctx ended; hand it on
+		l.active--
+		l.grantLocked()
+		return ctx.Err()
+	}
+}
+
+// release frees a slot taken by acquire
+func (l *slotLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+	l.grantLocked()
+}
+
+func (l *slotLimiter) setLimit(limit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = limit
+	l.grantLocked()
+}
+
+// grantLocked wakes waiters, oldest first, while slots are free
+func (l *slotLimiter) grantLocked() {
+	for l.active < l.limit && len(l.waiters) > 0 {
+		l.active++
+		close(l.waiters[0])
+		l.waiters = l.waiters[1:]
+	}
+}
@@ -0,0 +1,63 @@
+package ffmpeg
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSlotLimiter(t *testing.T) {
+	l := newSlotLimiter(2)
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if err := l.acquire(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A third caller waits for a slot
+	acquired := make(chan error, 1)
+	go func() { acquired <- l.acquire(ctx) }()
+	select {
+	case <-acquired:
+		t.Fatal("expected the third acquire to wait")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// A caller that gives up leaves the queue
+	cancelled, cancel := context.WithCancel(ctx)
+	gaveUp := make(chan error, 1)
+	go func() { gaveUp <- l.acquire(cancelled) }()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	if err := <-gaveUp; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	l.release()
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the waiting caller to get the freed slot")
+	}
+
+	// Raising the limit frees slots for waiters at once
+	go func() { acquired <- l.acquire(ctx) }()
+	time.Sleep(10 * time.Millisecond)
+	l.setLimit(3)
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("expected a raised limit to wake the waiter")
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active != 3 || len(l.waiters) != 0 {
+		t.Errorf("expected 3 slots in use and no waiters, got %d and %d", l.active, len(l.waiters))
+	}
+}
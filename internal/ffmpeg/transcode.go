@@ -4,18 +4,19 @@ import (
 	"bufio"
 	"context"
 	"fmt"
-	"io"
-	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
-	"syscall"
 	"time"
+
+	"github.com/gwlsn/shrinkray/internal/logger"
 )
 
+var transcodeLog = logger.For("transcode")
+
 // Progress represents the current transcoding progress
 type Progress struct {
 	Frame   int64         `json:"frame"`
@@ -356,10 +357,13 @@ func (b *boundedBuffer) String() string {
 type Transcoder struct {
 	ffmpegPath string
 
-	// Process control for pause/resume
-	mu      sync.Mutex
-	process *os.Process
-	paused  bool
+	// Process control for pause/resume. A chunked encode runs several
+	// ffmpeg processes at once, keyed by PID.
+	mu        sync.Mutex
+	processes map[int]*os.Process
+	paused    bool
+
+	limits ProcessLimits // Applied to each ffmpeg process (see SetLimits)
 }
 
 // NewTranscoder creates a new Transcoder with the given ffmpeg path
@@ -367,43 +371,47 @@ func NewTranscoder(ffmpegPath string) *Transcoder {
 	return &Transcoder{ffmpegPath: ffmpegPath}
 }
 
-// Pause sends SIGSTOP to the ffmpeg process to pause transcoding.
-// Returns true if the process was paused, false if there's no process running.
+// Pause sends SIGSTOP to the ffmpeg processes to pause transcoding.
+// Returns true if they were paused, false if there's no process running.
 func (t *Transcoder) Pause() bool {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	if t.process == nil || t.paused {
+	if len(t.processes) == 0 || t.paused {
 		return false
 	}
 
-	if err := t.process.Signal(syscall.SIGSTOP); err != nil {
-		log.Printf("[transcode] Failed to pause process: %v", err)
-		return false
+	for pid, process := range t.processes {
+		if err := stopProcess(process); err != nil {
+			transcodeLog.Warn("Failed to pause process", "error", err)
+			return false
+		}
+		transcodeLog.Info("Process paused", "pid", pid)
 	}
 
 	t.paused = true
-	log.Printf("[transcode] Process paused (PID %d)", t.process.Pid)
 	return true
 }
 
-// Resume sends SIGCONT to the ffmpeg process to resume transcoding.
-// Returns true if the process was resumed, false if there's no process paused.
+// Resume sends SIGCONT to the ffmpeg processes to resume transcoding.
+// Returns true if they were resumed, false if there's no process paused.
 func (t *Transcoder) Resume() bool {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	if t.process == nil || !t.paused {
+	if len(t.processes) == 0 || !t.paused {
 		return false
 	}
 
-	if err := t.process.Signal(syscall.SIGCONT); err != nil {
-		log.Printf("[transcode] Failed to resume process: %v", err)
-		return false
+	for pid, process := range t.processes {
+		if err := continueProcess(process); err != nil {
+			transcodeLog.Warn("Failed to resume process", "error", err)
+			return false
+		}
+		transcodeLog.Info("Process resumed", "pid", pid)
 	}
 
 	t.paused = false
-	log.Printf("[transcode] Process resumed (PID %d)", t.process.Pid)
 	return true
 }
 
@@ -418,6 +426,7 @@ func (t *Transcoder) IsPaused() bool {
 // It sends progress updates to the progress channel and returns the result
 // sourceBitrate is the source video bitrate in bits/second (for dynamic bitrate calculation)
 // bitDepth is the source video bit depth (8, 10, 12) - used for VAAPI format selection
+// hdr/hdrHandling control HDR signalling or tone mapping (hdr is nil for SDR sources)
 func (t *Transcoder) Transcode(
 	ctx context.Context,
 	inputPath string,
@@ -432,9 +441,12 @@ func (t *Transcoder) Transcode(
 	videoCodec string,
 	qualityHEVC int,
 	qualityAV1 int,
+	hdr *HDRInfo,
+	hdrHandling HDRHandling,
 	progressCh chan<- Progress,
 ) (*TranscodeResult, error) {
 	startTime := time.Now()
+	defer close(progressCh)
 
 	// Get input file size
 	inputInfo, err := os.Stat(inputPath)
@@ -444,76 +456,173 @@ func (t *Transcoder) Transcode(
 	inputSize := inputInfo.Size()
 
 	inputArgs, outputArgs := BuildPresetArgs(preset, sourceBitrate, subtitleCodecs, subtitleHandling, bitDepth, pixFmt, videoCodec, qualityHEVC, qualityAV1)
+	outputArgs = ApplyHDRArgs(outputArgs, preset, hdr, hdrHandling)
 
 	// Build ffmpeg command
 	// Structure: ffmpeg [inputArgs] -f format -i input [outputArgs] output
 	args := []string{}
 	args = append(args, inputArgs...)
 
-	// Force format detection for container files to prevent misdetection
-	// FFmpeg sometimes misdetects MKV files as EAC3 audio when probing fails
-	ext := strings.ToLower(filepath.Ext(inputPath))
-	switch ext {
-	case ".mkv", ".mka", ".mks":
-		args = append(args, "-f", "matroska")
-	case ".mp4", ".m4v", ".m4a":
-		args = append(args, "-f", "mp4")
-	case ".avi":
-		args = append(args, "-f", "avi")
-	case ".mov":
-		args = append(args, "-f", "mov")
-	case ".ts", ".m2ts", ".mts":
-		args = append(args, "-f", "mpegts")
-	}
+	args = append(args, inputFormatArgs(inputPath)...)
 
 	args = append(args,
 		"-i", inputPath,
 		"-y",                  // Overwrite output without asking
 		"-progress", "pipe:1", // Output progress to stdout
 	)
-	args = append(args, outputArgs...)
-	args = append(args, outputPath)
 
+	report := func(p Progress) {
+		// Send progress update (non-blocking)
+		select {
+		case progressCh <- p:
+		default:
+			// Channel full, skip this update
+		}
+	}
+
+	// Chunked: segments of the video are encoded in parallel, then joined
+	// (see transcodeChunked). Two-pass: an analysis pass writes rate control
+	// stats that the encode pass uses to hit the target bitrate. Each pass
+	// is half the progress.
+	if preset.Chunks > 1 && SupportsChunking(preset) {
+		if err := t.transcodeChunked(ctx, inputArgs, inputPath, outputArgs, outputPath, preset.Chunks, duration, report); err != nil {
+			os.Remove(outputPath)
+			return nil, err
+		}
+	} else if preset.TargetBitrate > 0 && SupportsTwoPass(preset) {
+		passLog := outputPath + ".passlog"
+		defer removePassLogs(passLog)
+
+		analysisArgs := append(append([]string{}, args...), analysisPassArgs(twoPassArgs(outputArgs, preset, 1, passLog))...)
+		analysisArgs = append(analysisArgs, os.DevNull)
+		transcodeLog.Info("Two-pass encode: running analysis pass", "bitrate_kbps", preset.TargetBitrate/1000)
+		if err := t.runFFmpeg(ctx, analysisArgs, duration, func(p Progress) {
+			report(scalePassProgress(p, 1, duration))
+		}); err != nil {
+			return nil, err
+		}
+
+		outputArgs = twoPassArgs(outputArgs, preset, 2, passLog)
+		args = append(args, outputArgs...)
+		args = append(args, outputPath)
+		if err := t.runFFmpeg(ctx, args, duration, func(p Progress) {
+			report(scalePassProgress(p, 2, duration))
+		}); err != nil {
+			// Clean up partial output file
+			os.Remove(outputPath)
+			return nil, err
+		}
+	} else {
+		args = append(args, outputArgs...)
+		args = append(args, outputPath)
+		if err := t.runFFmpeg(ctx, args, duration, report); err != nil {
+			// Clean up partial output file
+			os.Remove(outputPath)
+			return nil, err
+		}
+	}
+
+	// Get output file size
+	outputInfo, err := os.Stat(outputPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat output file: %w", err)
+	}
+	outputSize := outputInfo.Size()
+
+	return &TranscodeResult{
+		InputPath:  inputPath,
+		OutputPath: outputPath,
+		InputSize:  inputSize,
+		OutputSize: outputSize,
+		SpaceSaved: inputSize - outputSize,
+		Duration:   time.Since(startTime),
+	}, nil
+}
+
+// inputFormatArgs forces the demuxer for container files to prevent
+// misdetection. FFmpeg sometimes misdetects MKV files as EAC3 audio when
+// probing fails.
+func inputFormatArgs(inputPath string) []string {
+	switch strings.ToLower(filepath.Ext(inputPath)) {
+	case ".mkv", ".mka", ".mks":
+		return []string{"-f", "matroska"}
+	case ".mp4", ".m4v", ".m4a":
+		return []string{"-f", "mp4"}
+	case ".avi":
+		return []string{"-f", "avi"}
+	case ".mov":
+		return []string{"-f", "mov"}
+	case ".ts", ".m2ts", ".mts":
+		return []string{"-f", "mpegts"}
+	}
+	return nil
+}
+
+// runFFmpeg runs ffmpeg with args, which must include -progress pipe:1,
+// passing progress to report. Returns a *TranscodeError if ffmpeg fails.
+func (t *Transcoder) runFFmpeg(ctx context.Context, args []string, duration time.Duration, report func(Progress)) error {
 	// Log the ffmpeg command for debugging
-	log.Printf("[transcode] Running: ffmpeg %s", strings.Join(args, " "))
+	transcodeLog.Info("Running ffmpeg", "args", strings.Join(args, " "))
 
-	cmd := exec.CommandContext(ctx, t.ffmpegPath, args...)
+	t.mu.Lock()
+	limits := t.limits
+	t.mu.Unlock()
+	name, cmdArgs := limits.command(t.ffmpegPath, args)
+	cmd := exec.CommandContext(ctx, name, cmdArgs...)
 
 	// Capture stdout for progress
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create stdout pipe: %w", err)
+		return fmt.Errorf("failed to create stdout pipe: %w", err)
 	}
 
 	// Capture stderr for error diagnostics (bounded to prevent memory issues)
 	stderrBuf := newBoundedBuffer(maxStderrSize)
 	stderr, err := cmd.StderrPipe()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create stderr pipe: %w", err)
+		return fmt.Errorf("failed to create stderr pipe: %w", err)
 	}
 
 	// Start the command
 	if err := cmd.Start(); err != nil {
-		return nil, fmt.Errorf("failed to start ffmpeg: %w", err)
+		return fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+
+	// Cap memory; the cgroup can only be removed once ffmpeg has exited
+	removeCgroup, err := limits.joinCgroup(cmd.Process.Pid)
+	if err != nil {
+		transcodeLog.Warn("Running ffmpeg without its memory limit", "error", err)
 	}
+	defer removeCgroup()
 
-	// Store process reference for pause/resume
+	// Store process reference for pause/resume. A chunk that starts while
+	// the others are paused is paused with them.
+	pid := cmd.Process.Pid
 	t.mu.Lock()
-	t.process = cmd.Process
-	t.paused = false
+	if t.processes == nil {
+		t.processes = make(map[int]*os.Process)
+	}
+	t.processes[pid] = cmd.Process
+	if t.paused {
+		stopProcess(cmd.Process)
+	}
 	t.mu.Unlock()
 
 	// Ensure we clear the process reference when done
 	defer func() {
 		t.mu.Lock()
-		t.process = nil
-		t.paused = false
+		delete(t.processes, pid)
+		if len(t.processes) == 0 {
+			t.paused = false
+		}
 		t.mu.Unlock()
 	}()
 
 	// Parse progress from stdout
+	var readers sync.WaitGroup
+	readers.Add(2)
 	go func() {
-		defer close(progressCh)
+		defer readers.Done()
 		scanner := bufio.NewScanner(stdout)
 		var currentProgress Progress
 		progressUpdateCount := 0
@@ -581,28 +690,24 @@ func (t *Transcoder) Transcode(
 						} else {
 							// Log when duration is 0 - this would cause 0% progress
 							if progressUpdateCount == 1 {
-								log.Printf("[transcode] Warning: duration is 0, progress will always be 0%%")
+								transcodeLog.Warn("Duration is 0, progress will always be 0%")
 							}
 						}
 
-						// Send progress update (non-blocking)
-						select {
-						case progressCh <- currentProgress:
-						default:
-							// Channel full, skip this update
-						}
+						report(currentProgress)
 						sawOutTimeUS = false
 					}
 				}
 			}
 		}
 		if err := scanner.Err(); err != nil {
-			log.Printf("[transcode] Scanner error: %v", err)
+			transcodeLog.Warn("Progress scanner error", "error", err)
 		}
 	}()
 
 	// Parse stderr stats output as a fallback (some ffmpeg builds don't emit -progress)
 	go func() {
+		defer readers.Done()
 		scanner := bufio.NewScanner(stderr)
 		scanner.Split(scanCRLF)
 		var lastStatsTime time.Duration
@@ -636,22 +741,29 @@ func (t *Transcoder) Transcode(
 
 			lastStatsTime = statsTime
 
-			select {
-			case progressCh <- progress:
-			default:
-			}
+			report(progress)
 		}
 
 		if err := scanner.Err(); err != nil {
-			log.Printf("[transcode] Stderr scanner error: %v", err)
+			transcodeLog.Warn("Stderr scanner error", "error", err)
 		}
 	}()
 
-	// Wait for ffmpeg to complete
-	if err := cmd.Wait(); err != nil {
-		// Clean up partial output file
-		os.Remove(outputPath)
-
+	// Wait for ffmpeg to complete, after reading all of its output. When
+	// cancelled, don't wait for EOF: a killed ffmpeg's children could hold
+	// the pipes open. Wait closes them, which ends the readers.
+	readersDone := make(chan struct{})
+	go func() {
+		readers.Wait()
+		close(readersDone)
+	}()
+	select {
+	case <-readersDone:
+	case <-ctx.Done():
+	}
+	err = cmd.Wait()
+	<-readersDone
+	if err != nil {
 		// Extract exit code if available
 		exitCode := 1
 		if exitErr, ok := err.(*exec.ExitError); ok {
@@ -659,29 +771,14 @@ func (t *Transcoder) Transcode(
 		}
 
 		// Return detailed error for diagnostics
-		return nil, &TranscodeError{
+		return &TranscodeError{
 			Message:  fmt.Sprintf("ffmpeg failed: %v", err),
 			Stderr:   stderrBuf.String(),
 			ExitCode: exitCode,
 			Args:     args,
 		}
 	}
-
-	// Get output file size
-	outputInfo, err := os.Stat(outputPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to stat output file: %w", err)
-	}
-	outputSize := outputInfo.Size()
-
-	return &TranscodeResult{
-		InputPath:  inputPath,
-		OutputPath: outputPath,
-		InputSize:  inputSize,
-		OutputSize: outputSize,
-		SpaceSaved: inputSize - outputSize,
-		Duration:   time.Since(startTime),
-	}, nil
+	return nil
 }
 
 // BuildTempPath generates a temporary output path for transcoding
@@ -692,74 +789,3 @@ func BuildTempPath(inputPath, tempDir string) string {
 	tempName := fmt.Sprintf("%s.shrinkray.tmp.mkv", name)
 	return filepath.Join(tempDir, tempName)
 }
-
-// copyFile copies a file from src to dst.
-// Works across filesystems unlike os.Rename.
-func copyFile(src, dst string) error {
-	srcFile, err := os.Open(src)
-	if err != nil {
-		return err
-	}
-	defer srcFile.Close()
-
-	dstFile, err := os.Create(dst)
-	if err != nil {
-		return err
-	}
-	defer dstFile.Close()
-
-	if _, err := io.Copy(dstFile, srcFile); err != nil {
-		return err
-	}
-
-	return dstFile.Close()
-}
-
-// FinalizeTranscode handles the original file based on the configured behavior
-// If replace=true, deletes original and copies temp to final location
-// If replace=false (keep), renames original to .old and copies temp to final location
-// Uses copy-then-delete instead of rename to support cross-filesystem moves.
-// Preserves the original file's modification time on the output.
-func FinalizeTranscode(inputPath, tempPath string, replace bool) (finalPath string, err error) {
-	dir := filepath.Dir(inputPath)
-	base := filepath.Base(inputPath)
-	ext := filepath.Ext(base)
-	name := strings.TrimSuffix(base, ext)
-	finalPath = filepath.Join(dir, name+".mkv")
-
-	inputInfo, err := os.Stat(inputPath)
-	if err != nil {
-		return "", fmt.Errorf("failed to stat input file: %w", err)
-	}
-	originalModTime := inputInfo.ModTime()
-
-	if replace {
-		if err := os.Remove(inputPath); err != nil {
-			return "", fmt.Errorf("failed to remove original file: %w", err)
-		}
-
-		if err := copyFile(tempPath, finalPath); err != nil {
-			return "", fmt.Errorf("failed to copy temp to final location: %w", err)
-		}
-
-		_ = os.Chtimes(finalPath, originalModTime, originalModTime)
-
-		os.Remove(tempPath)
-		return finalPath, nil
-	}
-
-	oldPath := inputPath + ".old"
-	if err := os.Rename(inputPath, oldPath); err != nil {
-		return "", fmt.Errorf("failed to rename original to .old: %w", err)
-	}
-
-	if err := copyFile(tempPath, finalPath); err != nil {
-		_ = os.Rename(oldPath, inputPath)
-		return "", fmt.Errorf("failed to copy temp to final location: %w", err)
-	}
-
-	_ = os.Chtimes(finalPath, originalModTime, originalModTime)
-
-	os.Remove(tempPath)
-	return finalPath, nil
-}
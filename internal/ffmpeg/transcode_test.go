@@ -83,7 +83,7 @@ func TestTranscode(t *testing.T) {
 		close(done)
 	}()
 
-	result, err := transcoder.Transcode(ctx, testFile, outputPath, preset, probeResult.Duration, probeResult.Bitrate, probeResult.SubtitleCodecs, "convert", probeResult.BitDepth, probeResult.PixFmt, probeResult.VideoCodec, progressCh)
+	result, err := transcoder.Transcode(ctx, testFile, outputPath, preset, probeResult.Duration, probeResult.Bitrate, probeResult.SubtitleCodecs, "convert", probeResult.BitDepth, probeResult.PixFmt, probeResult.VideoCodec, 0, 0, probeResult.HDR, HDRHandlingPreserve, progressCh)
 	<-done
 
 	if err != nil {
@@ -141,7 +141,7 @@ func TestFinalizeTranscodeReplace(t *testing.T) {
 	}
 
 	// Finalize with replace=true
-	finalPath, err := FinalizeTranscode(originalPath, tempPath, true)
+	finalPath, err := FinalizeTranscode(originalPath, tempPath, FinalizeOptions{Replace: true})
 	if err != nil {
 		t.Fatalf("FinalizeTranscode failed: %v", err)
 	}
@@ -191,7 +191,7 @@ func TestFinalizeTranscodeReplaceDifferentExt(t *testing.T) {
 	}
 
 	// Finalize with replace=true
-	finalPath, err := FinalizeTranscode(originalPath, tempPath, true)
+	finalPath, err := FinalizeTranscode(originalPath, tempPath, FinalizeOptions{Replace: true})
 	if err != nil {
 		t.Fatalf("FinalizeTranscode failed: %v", err)
 	}
@@ -218,6 +218,37 @@ func TestFinalizeTranscodeReplaceDifferentExt(t *testing.T) {
 	t.Logf("Replace mode (mp4→mkv): original deleted, final=%s", finalPath)
 }
 
+func TestFinalizeTranscodeReplaceToTrash(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalPath := filepath.Join(tmpDir, "video.mkv")
+	if err := os.WriteFile(originalPath, []byte("original content"), 0644); err != nil {
+		t.Fatalf("failed to create original: %v", err)
+	}
+	tempPath := filepath.Join(tmpDir, "video.shrinkray.tmp.mkv")
+	if err := os.WriteFile(tempPath, []byte("transcoded content"), 0644); err != nil {
+		t.Fatalf("failed to create temp: %v", err)
+	}
+
+	trashPath := filepath.Join(tmpDir, ".shrinkray-trash", "job-1", "video.mkv")
+	finalPath, err := FinalizeTranscode(originalPath, tempPath, FinalizeOptions{Replace: true, TrashPath: trashPath})
+	if err != nil {
+		t.Fatalf("FinalizeTranscode failed: %v", err)
+	}
+
+	content, err := os.ReadFile(finalPath)
+	if err != nil || string(content) != "transcoded content" {
+		t.Errorf("final file = %q, %v; want the transcoded content", content, err)
+	}
+	content, err = os.ReadFile(trashPath)
+	if err != nil || string(content) != "original content" {
+		t.Errorf("trashed file = %q, %v; want the original content", content, err)
+	}
+	if _, err := os.Stat(originalPath + ".old"); !os.IsNotExist(err) {
+		t.Error(".old file exists, but the original should be in the trash")
+	}
+}
+
 func TestFinalizeTranscodeKeep(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -234,7 +265,7 @@ func TestFinalizeTranscodeKeep(t *testing.T) {
 	}
 
 	// Finalize with replace=false (keep original as .old)
-	finalPath, err := FinalizeTranscode(originalPath, tempPath, false)
+	finalPath, err := FinalizeTranscode(originalPath, tempPath, FinalizeOptions{})
 	if err != nil {
 		t.Fatalf("FinalizeTranscode failed: %v", err)
 	}
@@ -328,3 +359,80 @@ func TestTranscodeErrorIsHardwareEncoderFailure(t *testing.T) {
 		})
 	}
 }
+
+func TestRecoverFinalize(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalPath := filepath.Join(tmpDir, "video.mp4")
+	if err := os.WriteFile(originalPath, []byte("original content"), 0644); err != nil {
+		t.Fatalf("failed to create original: %v", err)
+	}
+	finalPath, stagedPath, journalPath := finalizePaths(originalPath, "")
+
+	// Crash while staging: no journal, so the partial copy is discarded
+	if err := os.WriteFile(stagedPath, []byte("partial"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := RecoverFinalize(originalPath); err != nil || got != "" {
+		t.Fatalf("expected nothing to recover, got %q %v", got, err)
+	}
+	if _, err := os.Stat(stagedPath); !os.IsNotExist(err) {
+		t.Error("partial staged file should have been removed")
+	}
+
+	// Crash after the journal was written: the swap is rolled forward
+	if err := os.WriteFile(stagedPath, []byte("transcoded content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	journal := finalizeJournal{Input: originalPath, Staged: stagedPath, Final: finalPath}
+	if err := writeJournal(journalPath, journal); err != nil {
+		t.Fatal(err)
+	}
+	got, err := RecoverFinalize(originalPath)
+	if err != nil || got != finalPath {
+		t.Fatalf("expected recovery to %s, got %q %v", finalPath, got, err)
+	}
+	if content, _ := os.ReadFile(finalPath); string(content) != "transcoded content" {
+		t.Errorf("final file has wrong content: %q", content)
+	}
+	for _, path := range []string{originalPath, stagedPath, journalPath} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s should be gone after recovery", filepath.Base(path))
+		}
+	}
+}
+
+func TestFinalizeTranscodePreservesAttributes(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalPath := filepath.Join(tmpDir, "video.mp4")
+	if err := os.WriteFile(originalPath, []byte("original content"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	oldTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(originalPath, oldTime, oldTime); err != nil {
+		t.Fatal(err)
+	}
+	tempPath := filepath.Join(tmpDir, "video.shrinkray.tmp.mkv")
+	if err := os.WriteFile(tempPath, []byte("transcoded content"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	finalPath, err := FinalizeTranscode(originalPath, tempPath, FinalizeOptions{
+		Replace:           true,
+		PreserveOwnership: true,
+		PreserveMTime:     true,
+	})
+	if err != nil {
+		t.Fatalf("FinalizeTranscode failed: %v", err)
+	}
+
+	info, err := os.Stat(finalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("expected mode 0640, got %o", info.Mode().Perm())
+	}
+	if !info.ModTime().Equal(oldTime) {
+		t.Errorf("expected mtime %v, got %v", oldTime, info.ModTime())
+	}
+}
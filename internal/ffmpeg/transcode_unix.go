@@ -0,0 +1,18 @@
+//go:build !windows
+
+package ffmpeg
+
+import (
+	"os"
+	"syscall"
+)
+
+// stopProcess suspends p (SIGSTOP)
+func stopProcess(p *os.Process) error {
+	return p.Signal(syscall.SIGSTOP)
+}
+
+// continueProcess resumes a process suspended by stopProcess (SIGCONT)
+func continueProcess(p *os.Process) error {
+	return p.Signal(syscall.SIGCONT)
+}
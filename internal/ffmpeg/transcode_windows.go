@@ -0,0 +1,19 @@
+package ffmpeg
+
+import (
+	"errors"
+	"os"
+)
+
+// errNoPause is returned on Windows, which has no SIGSTOP
+var errNoPause = errors.New("pausing ffmpeg is not supported on Windows")
+
+// stopProcess suspends p; unsupported on Windows
+func stopProcess(p *os.Process) error {
+	return errNoPause
+}
+
+// continueProcess resumes a process suspended by stopProcess; unsupported on Windows
+func continueProcess(p *os.Process) error {
+	return errNoPause
+}
@@ -0,0 +1,103 @@
+package ffmpeg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// targetSizeMargin is the share of a size target held back for container
+// overhead and rate control overshoot
+const targetSizeMargin = 0.02
+
+// TargetVideoBitrate returns the video bitrate (bits/s) that makes an encode
+// of duration come out at about targetBytes, leaving room for the audio
+// streams (copied as-is) and container overhead. Returns 0 if the target
+// can't be met above the minimum bitrate.
+func TargetVideoBitrate(targetBytes int64, duration time.Duration, audioBitrate int64) int64 {
+	if targetBytes <= 0 || duration <= 0 {
+		return 0
+	}
+	totalBitrate := float64(targetBytes) * 8 * (1 - targetSizeMargin) / duration.Seconds()
+	videoBitrate := int64(totalBitrate) - audioBitrate
+	if videoBitrate < minBitrateKbps*1000 {
+		return 0
+	}
+	return videoBitrate
+}
+
+// SupportsTwoPass reports whether preset's encoder can do a two-pass encode.
+// Only the software encoders keep rate control stats between passes;
+// hardware encoders encode once at the target bitrate.
+func SupportsTwoPass(preset *Preset) bool {
+	switch encoderFor(preset) {
+	case "libx265", "libsvtav1":
+		return true
+	}
+	return false
+}
+
+// encoderFor returns the ffmpeg encoder BuildPresetArgs uses for preset
+func encoderFor(preset *Preset) string {
+	config, ok := encoderConfigs[EncoderKey{preset.Encoder, preset.Codec}]
+	if !ok {
+		config = encoderConfigs[EncoderKey{HWAccelNone, preset.Codec}]
+	}
+	return config.encoder
+}
+
+// twoPassArgs adds the options for pass (1 or 2) of a two-pass encode,
+// with rate control stats kept under logPrefix
+func twoPassArgs(outputArgs []string, preset *Preset, pass int, logPrefix string) []string {
+	if encoderFor(preset) == "libx265" {
+		// libx265 takes its pass settings through x265-params
+		return appendEncoderParams(outputArgs, "-x265-params",
+			fmt.Sprintf("pass=%d", pass), "stats="+logPrefix+".log")
+	}
+	return append(append([]string{}, outputArgs...), "-pass", fmt.Sprintf("%d", pass), "-passlogfile", logPrefix)
+}
+
+// analysisPassArgs turns a pass 1 encode's output args into an analysis run
+// that only encodes video and discards the result
+func analysisPassArgs(outputArgs []string) []string {
+	var args []string
+	for i := 0; i < len(outputArgs); i++ {
+		// Muxer options don't apply to the null muxer
+		if outputArgs[i] == "-movflags" {
+			i++
+			continue
+		}
+		args = append(args, outputArgs[i])
+	}
+	return append(args, "-an", "-sn", "-dn", "-f", "null")
+}
+
+// removePassLogs deletes the stats files a two-pass encode left under logPrefix
+func removePassLogs(logPrefix string) {
+	matches, _ := filepath.Glob(logPrefix + "*")
+	for _, path := range matches {
+		os.Remove(path)
+	}
+}
+
+// scalePassProgress maps one pass's progress onto the whole two-pass encode:
+// the analysis pass is the first half, the encode pass the second. The ETA
+// assumes the remaining pass runs as fast as the current one.
+func scalePassProgress(p Progress, pass int, duration time.Duration) Progress {
+	p.Percent = float64(pass-1)*50 + p.Percent/2
+	if pass == 1 && p.Speed > 0 {
+		p.ETA += time.Duration(float64(duration) / p.Speed)
+	}
+	return p
+}
+
+// AudioBitrate is the combined bitrate (bits/s) of audio tracks, guessing
+// from codec and channels for tracks that don't report one
+func AudioBitrate(tracks []AudioTrack) int64 {
+	var total int64
+	for _, track := range tracks {
+		total += audioStreamBitrate(ProbeStream{Type: "audio", Codec: track.Codec, Bitrate: track.Bitrate, Channels: track.Channels})
+	}
+	return total
+}
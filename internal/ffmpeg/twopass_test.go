@@ -0,0 +1,121 @@
+package ffmpeg
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTargetVideoBitrate(t *testing.T) {
+	// 1 GiB over an hour with 640 kb/s of audio
+	got := TargetVideoBitrate(1<<30, time.Hour, 640_000)
+	if want := int64(2_338_371 - 640_000); got != want {
+		t.Errorf("TargetVideoBitrate = %d, want %d", got, want)
+	}
+
+	if got := TargetVideoBitrate(10<<20, time.Hour, 640_000); got != 0 {
+		t.Errorf("unreachable target gave %d, want 0", got)
+	}
+	if got := TargetVideoBitrate(1<<30, 0, 0); got != 0 {
+		t.Errorf("unknown duration gave %d, want 0", got)
+	}
+}
+
+func TestTwoPassArgs(t *testing.T) {
+	hevc := &Preset{ID: "compress-hevc", Encoder: HWAccelNone, Codec: CodecHEVC, TargetBitrate: 4_000_000}
+	_, outputArgs := BuildPresetArgs(hevc, 0, nil, "convert", 10, "yuv420p10le", "hevc", 0, 0)
+	if got := argAfter(outputArgs, "-b:v"); got != "4000k" {
+		t.Errorf("-b:v = %q, want 4000k", got)
+	}
+	if got := argAfter(outputArgs, "-crf"); got != "" {
+		t.Errorf("unexpected -crf %q on a size-targeted encode", got)
+	}
+
+	// libx265 pass settings merge into the HDR x265-params
+	outputArgs = ApplyHDRArgs(outputArgs, hevc, &HDRInfo{Transfer: "smpte2084"}, HDRHandlingPreserve)
+	pass1 := twoPassArgs(outputArgs, hevc, 1, "/tmp/out.passlog")
+	params := argAfter(pass1, "-x265-params:v:0")
+	if !strings.Contains(params, "hdr-opt=1") || !strings.HasSuffix(params, ":pass=1:stats=/tmp/out.passlog.log") {
+		t.Errorf("-x265-params = %q, want HDR params then pass 1", params)
+	}
+	if strings.Contains(argAfter(outputArgs, "-x265-params:v:0"), "pass=") {
+		t.Error("twoPassArgs modified its input")
+	}
+
+	av1 := &Preset{ID: "compress-av1", Encoder: HWAccelNone, Codec: CodecAV1, TargetBitrate: 2_000_000}
+	pass2 := twoPassArgs(nil, av1, 2, "/tmp/out.passlog")
+	if argAfter(pass2, "-pass") != "2" || argAfter(pass2, "-passlogfile") != "/tmp/out.passlog" {
+		t.Errorf("libsvtav1 pass args = %v", pass2)
+	}
+
+	if SupportsTwoPass(&Preset{Encoder: HWAccelVAAPI, Codec: CodecHEVC}) {
+		t.Error("hardware encoders should encode in one pass")
+	}
+
+	analysis := analysisPassArgs([]string{"-c:v:0", "libx265", "-movflags", "+faststart", "-c:a", "copy"})
+	if got := strings.Join(analysis, " "); got != "-c:v:0 libx265 -c:a copy -an -sn -dn -f null" {
+		t.Errorf("analysisPassArgs = %q", got)
+	}
+}
+
+func TestTranscodeTwoPass(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in.mkv")
+	output := filepath.Join(dir, "out.mkv")
+	calls := filepath.Join(dir, "calls")
+	if err := os.WriteFile(input, []byte("source"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Records each invocation, leaves a stats file like a real pass 1, and
+	// writes its last argument (the output) on the encode pass
+	ffmpegPath := filepath.Join(dir, "ffmpeg")
+	writeScript(t, ffmpegPath, `echo "$@" >> `+calls+`
+for last; do :; done
+case "$*" in
+*pass=1*) touch `+output+`.passlog.log ;;
+*) echo encoded > "$last" ;;
+esac
+echo out_time_us=30000000
+echo progress=continue
+`)
+
+	preset := &Preset{ID: "compress-hevc", Encoder: HWAccelNone, Codec: CodecHEVC, TargetBitrate: 4_000_000}
+	progressCh := make(chan Progress, 10)
+	result, err := NewTranscoder(ffmpegPath).Transcode(context.Background(), input, output, preset, time.Minute,
+		0, nil, "convert", 8, "yuv420p", "h264", 0, 0, nil, HDRHandlingPreserve, progressCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.OutputSize == 0 {
+		t.Error("expected encoded output")
+	}
+
+	var percents []float64
+	for p := range progressCh {
+		percents = append(percents, p.Percent)
+	}
+	if len(percents) != 2 || percents[0] != 25 || percents[1] != 75 {
+		t.Errorf("progress = %v, want [25 75] (halfway through each pass)", percents)
+	}
+
+	data, err := os.ReadFile(calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 ffmpeg runs, got %d", len(lines))
+	}
+	if !strings.Contains(lines[0], "pass=1") || !strings.Contains(lines[0], "-f null") {
+		t.Errorf("first run isn't the analysis pass: %s", lines[0])
+	}
+	if !strings.Contains(lines[1], "pass=2") || !strings.HasSuffix(lines[1], output) {
+		t.Errorf("second run isn't the encode pass: %s", lines[1])
+	}
+	if matches, _ := filepath.Glob(output + ".passlog*"); len(matches) > 0 {
+		t.Errorf("pass logs left behind: %v", matches)
+	}
+}
@@ -0,0 +1,145 @@
+package ffmpeg
+
+import (
+	"bufio"
+	"context"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// VAAPIInfo is what a render node's VAAPI driver reports, as listed by vainfo
+type VAAPIInfo struct {
+	Driver    string   `json:"driver"`               // e.g. "Intel iHD driver for Intel(R) Gen Graphics - 23.1.1"
+	Profiles  []string `json:"encode_profiles"`      // Profiles with an encode entrypoint, e.g. VAProfileHEVCMain10
+	MaxWidth  int      `json:"max_width,omitempty"`  // Largest encodable picture, 0 if unknown
+	MaxHeight int      `json:"max_height,omitempty"` // Largest encodable picture, 0 if unknown
+
+	HEVC       bool `json:"hevc"`
+	HEVCTenBit bool `json:"hevc_10bit"`
+	AV1        bool `json:"av1"`
+	AV1TenBit  bool `json:"av1_10bit"`
+}
+
+// vaapiEncodeProfiles maps the VAAPI profiles shrinkray encodes with to
+// the capability they provide. AV1 Profile 0 covers 8- and 10-bit 4:2:0.
+var vaapiEncodeProfiles = map[string]func(*VAAPIInfo){
+	"VAProfileHEVCMain":    func(i *VAAPIInfo) { i.HEVC = true },
+	"VAProfileHEVCMain10":  func(i *VAAPIInfo) { i.HEVCTenBit = true },
+	"VAProfileAV1Profile0": func(i *VAAPIInfo) { i.AV1, i.AV1TenBit = true, true },
+}
+
+// CanEncode reports whether the driver lists an encode profile for codec,
+// so unsupported 10-bit or AV1 encodes can be predicted before they fail
+func (i *VAAPIInfo) CanEncode(codec Codec, tenBit bool) bool {
+	switch codec {
+	case CodecHEVC:
+		if tenBit {
+			return i.HEVCTenBit
+		}
+		return i.HEVC
+	case CodecAV1:
+		if tenBit {
+			return i.AV1TenBit
+		}
+		return i.AV1
+	}
+	return false
+}
+
+// queryVAAPIInfo runs vainfo against device. Returns nil if vainfo isn't
+// installed or can't open the device.
+func queryVAAPIInfo(device string) *VAAPIInfo {
+	vainfoPath, err := exec.LookPath("vainfo")
+	if err != nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// -a adds per-profile attributes such as the max picture size; older
+	// vainfo builds don't have it, so retry without
+	output, err := exec.CommandContext(ctx, vainfoPath, "--display", "drm", "--device", device, "-a").Output()
+	if err != nil {
+		output, err = exec.CommandContext(ctx, vainfoPath, "--display", "drm", "--device", device).Output()
+		if err != nil {
+			return nil
+		}
+	}
+	return parseVAInfo(string(output))
+}
+
+// parseVAInfo reads the driver, encode profiles and max picture size from
+// vainfo output, in either the default "profile : entrypoint" listing or
+// the -a "profile/entrypoint" blocks
+func parseVAInfo(output string) *VAAPIInfo {
+	info := &VAAPIInfo{}
+	profiles := make(map[string]bool)
+	encodeBlock := false
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if _, driver, ok := strings.Cut(line, "Driver version:"); ok {
+			info.Driver = strings.TrimSuffix(strings.TrimSpace(driver), " ()")
+			continue
+		}
+
+		// Default listing: "VAProfileHEVCMain10 : VAEntrypointEncSlice"
+		if profile, entrypoint, ok := strings.Cut(line, ":"); ok && strings.HasPrefix(line, "VAProfile") {
+			if isEncodeEntrypoint(strings.TrimSpace(entrypoint)) {
+				profiles[strings.TrimSpace(profile)] = true
+			}
+			continue
+		}
+
+		// -a listing: a "VAProfileHEVCMain10/VAEntrypointEncSlice" header
+		// followed by indented attributes
+		if profile, entrypoint, ok := strings.Cut(line, "/"); ok && strings.HasPrefix(line, "VAProfile") {
+			encodeBlock = isEncodeEntrypoint(entrypoint)
+			if encodeBlock {
+				profiles[profile] = true
+			}
+			continue
+		}
+		if !encodeBlock {
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			continue
+		}
+		switch strings.TrimSpace(name) {
+		case "VAConfigAttribMaxPictureWidth":
+			info.MaxWidth = max(info.MaxWidth, size)
+		case "VAConfigAttribMaxPictureHeight":
+			info.MaxHeight = max(info.MaxHeight, size)
+		}
+	}
+
+	for profile := range profiles {
+		info.Profiles = append(info.Profiles, profile)
+		if set, ok := vaapiEncodeProfiles[profile]; ok {
+			set(info)
+		}
+	}
+	sort.Strings(info.Profiles)
+	if info.Profiles == nil {
+		info.Profiles = []string{}
+	}
+	return info
+}
+
+// isEncodeEntrypoint reports whether a VAAPI entrypoint encodes
+// (VAEntrypointEncSlice, VAEntrypointEncSliceLP, ...)
+func isEncodeEntrypoint(entrypoint string) bool {
+	return strings.HasPrefix(entrypoint, "VAEntrypointEnc")
+}
@@ -0,0 +1,54 @@
+package ffmpeg
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseVAInfo(t *testing.T) {
+	listing := `Trying display: drm
+libva info: VA-API version 1.20.0
+vainfo: VA-API version: 1.20 (libva 2.20.1)
+vainfo: Driver version: Intel iHD driver for Intel(R) Gen Graphics - 24.1.0 ()
+vainfo: Supported profile and entrypoints
+      VAProfileNone                   :	VAEntrypointVideoProc
+      VAProfileH264Main               :	VAEntrypointVLD
+      VAProfileH264Main               :	VAEntrypointEncSliceLP
+      VAProfileHEVCMain               :	VAEntrypointVLD
+      VAProfileHEVCMain               :	VAEntrypointEncSliceLP
+      VAProfileHEVCMain10             :	VAEntrypointVLD
+      VAProfileAV1Profile0            :	VAEntrypointVLD
+`
+	info := parseVAInfo(listing)
+	if info.Driver != "Intel iHD driver for Intel(R) Gen Graphics - 24.1.0" {
+		t.Errorf("Driver = %q", info.Driver)
+	}
+	if want := []string{"VAProfileH264Main", "VAProfileHEVCMain"}; !reflect.DeepEqual(info.Profiles, want) {
+		t.Errorf("Profiles = %v, want %v", info.Profiles, want)
+	}
+	// HEVC Main10 and AV1 decode only: 10-bit HEVC and AV1 encodes would fail
+	if !info.CanEncode(CodecHEVC, false) || info.CanEncode(CodecHEVC, true) || info.CanEncode(CodecAV1, false) {
+		t.Errorf("unexpected capabilities %+v", info)
+	}
+
+	attributes := `vainfo: Driver version: Mesa Gallium driver 24.0.5 for AMD Radeon RX 7600 (radeonsi, navi33, LLVM 17.0.6, DRM 3.57, 6.8.0)
+vainfo: Supported config attributes per profile/entrypoint pair
+VAProfileHEVCMain10/VAEntrypointVLD
+    VAConfigAttribMaxPictureWidth          : 16384
+    VAConfigAttribMaxPictureHeight         : 16384
+VAProfileHEVCMain10/VAEntrypointEncSlice
+    VAConfigAttribRTFormat                 : VA_RT_FORMAT_YUV420_10
+    VAConfigAttribMaxPictureWidth          : 4096
+    VAConfigAttribMaxPictureHeight         : 2304
+VAProfileAV1Profile0/VAEntrypointEncSlice
+    VAConfigAttribMaxPictureWidth          : 8192
+    VAConfigAttribMaxPictureHeight         : 4352
+`
+	info = parseVAInfo(attributes)
+	if info.MaxWidth != 8192 || info.MaxHeight != 4352 {
+		t.Errorf("max picture = %dx%d, want 8192x4352 (decode limits ignored)", info.MaxWidth, info.MaxHeight)
+	}
+	if !info.CanEncode(CodecHEVC, true) || !info.CanEncode(CodecAV1, true) || info.CanEncode(CodecHEVC, false) {
+		t.Errorf("unexpected capabilities %+v", info)
+	}
+}
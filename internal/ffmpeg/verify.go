@@ -0,0 +1,80 @@
+package ffmpeg
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// minDurationTolerance is the smallest allowed gap between source and
+// output duration; containers round stream durations differently
+const minDurationTolerance = 2 * time.Second
+
+// VerifyExpectation is what a finished transcode is checked against,
+// taken from the source's probe
+type VerifyExpectation struct {
+	Duration    time.Duration // 0 skips the duration check
+	AudioTracks int
+	Chapters    int
+	Attachments int // Only for containers that can hold attachments (MKV)
+}
+
+// VerifyError describes an output that failed verification
+type VerifyError struct {
+	Reason string
+	Stderr string // Decoder errors, if the decode pass found any
+}
+
+func (e *VerifyError) Error() string {
+	return "output verification failed: " + e.Reason
+}
+
+// VerifyOutput checks a finished transcode before it replaces the original:
+// the output must have a video stream, every source audio stream, chapter
+// and attachment, and a duration within 1% (at least 2s) of the source, and
+// must decode without
+// errors (ffmpeg -v error -i output -f null -). Returns a *VerifyError when
+// the output is truncated or corrupt.
+func VerifyOutput(ctx context.Context, ffmpegPath, ffprobePath, outputPath string, expect VerifyExpectation) error {
+	probe, err := NewProber(ffprobePath).Probe(ctx, outputPath)
+	if err != nil {
+		return &VerifyError{Reason: err.Error()}
+	}
+	if probe.VideoCodec == "" {
+		return &VerifyError{Reason: "output has no video stream"}
+	}
+	if len(probe.AudioTracks) < expect.AudioTracks {
+		return &VerifyError{Reason: fmt.Sprintf("output has %d audio streams, source has %d",
+			len(probe.AudioTracks), expect.AudioTracks)}
+	}
+	if probe.Chapters < expect.Chapters {
+		return &VerifyError{Reason: fmt.Sprintf("output has %d chapters, source has %d",
+			probe.Chapters, expect.Chapters)}
+	}
+	if probe.Attachments < expect.Attachments {
+		return &VerifyError{Reason: fmt.Sprintf("output has %d attachments, source has %d",
+			probe.Attachments, expect.Attachments)}
+	}
+	if expect.Duration > 0 {
+		tolerance := max(expect.Duration/100, minDurationTolerance)
+		if probe.Duration < expect.Duration-tolerance {
+			return &VerifyError{Reason: fmt.Sprintf("output is %s long, source is %s (truncated?)",
+				probe.Duration.Round(time.Second), expect.Duration.Round(time.Second))}
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, ffmpegPath, "-nostdin", "-v", "error", "-i", outputPath, "-f", "null", "-")
+	stderr := newBoundedBuffer(maxStderrSize)
+	cmd.Stderr = stderr
+	err = cmd.Run()
+	errors := strings.TrimSpace(stderr.String())
+	if err != nil {
+		return &VerifyError{Reason: fmt.Sprintf("decode check failed: %v", err), Stderr: errors}
+	}
+	if errors != "" {
+		return &VerifyError{Reason: "decode check reported errors", Stderr: errors}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package ffmpeg
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeScript writes an executable shell script standing in for ffmpeg/ffprobe
+func writeScript(t *testing.T, path, body string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyOutput(t *testing.T) {
+	dir := t.TempDir()
+	output := filepath.Join(dir, "out.mkv")
+	if err := os.WriteFile(output, []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ffprobe := filepath.Join(dir, "ffprobe")
+	writeScript(t, ffprobe, `cat <<'JSON'
+{"format":{"format_name":"matroska","duration":"600.0"},
+ "streams":[{"codec_type":"video","codec_name":"hevc"},{"codec_type":"audio","codec_name":"aac"},
+  {"codec_type":"attachment","codec_name":"ttf"}],
+ "chapters":[{"id":0},{"id":1}]}
+JSON
+`)
+	cleanFFmpeg := filepath.Join(dir, "ffmpeg-clean")
+	writeScript(t, cleanFFmpeg, "exit 0\n")
+	corruptFFmpeg := filepath.Join(dir, "ffmpeg-corrupt")
+	writeScript(t, corruptFFmpeg, "echo '[hevc] Invalid NAL unit size' >&2\nexit 0\n")
+
+	ctx := context.Background()
+	ok := VerifyExpectation{Duration: 601 * time.Second, AudioTracks: 1, Chapters: 2, Attachments: 1}
+	if err := VerifyOutput(ctx, cleanFFmpeg, ffprobe, output, ok); err != nil {
+		t.Errorf("expected clean output to verify, got %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		ffmpeg string
+		expect VerifyExpectation
+		reason string
+	}{
+		{"truncated", cleanFFmpeg, VerifyExpectation{Duration: 20 * time.Minute, AudioTracks: 1}, "truncated"},
+		{"missing audio", cleanFFmpeg, VerifyExpectation{Duration: 10 * time.Minute, AudioTracks: 2}, "audio streams"},
+		{"missing chapters", cleanFFmpeg, VerifyExpectation{AudioTracks: 1, Chapters: 3}, "chapters"},
+		{"missing attachments", cleanFFmpeg, VerifyExpectation{AudioTracks: 1, Attachments: 2}, "attachments"},
+		{"decode errors", corruptFFmpeg, ok, "decode check"},
+	}
+	for _, tt := range tests {
+		err := VerifyOutput(ctx, tt.ffmpeg, ffprobe, output, tt.expect)
+		var verr *VerifyError
+		if !errors.As(err, &verr) || !strings.Contains(verr.Reason, tt.reason) {
+			t.Errorf("%s: expected VerifyError mentioning %q, got %v", tt.name, tt.reason, err)
+		}
+	}
+}
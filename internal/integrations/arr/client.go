@@ -0,0 +1,177 @@
+// Package arr tells Sonarr and Radarr to rescan (and optionally rename)
+// a series or movie after Shrinkray replaces one of its files.
+package arr
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/config"
+	"github.com/gwlsn/shrinkray/internal/integrations"
+)
+
+// httpClient is a shared HTTP client with timeout for all *arr requests
+var httpClient = &http.Client{
+	Timeout: 30 * time.Second,
+}
+
+// Kind identifies which *arr application a client talks to
+type Kind string
+
+const (
+	KindSonarr Kind = "sonarr"
+	KindRadarr Kind = "radarr"
+)
+
+// ErrNotManaged is returned by Lookup when no series/movie contains the path
+var ErrNotManaged = errors.New("path is not managed by this instance")
+
+// Client calls the Sonarr or Radarr v3 API
+type Client struct {
+	Kind   Kind
+	URL    string
+	APIKey string
+	// Rename also asks the *arr to rename files after the rescan
+	Rename bool
+	// LocalPath/RemotePath translate Shrinkray paths into the *arr's view
+	// of the filesystem when the containers mount media differently.
+	LocalPath  string
+	RemotePath string
+}
+
+// NewClient creates a new Sonarr/Radarr client
+func NewClient(kind Kind, url, apiKey string) *Client {
+	return &Client{Kind: kind, URL: url, APIKey: apiKey}
+}
+
+// ClientsFromConfig builds the Sonarr and Radarr clients from the config
+func ClientsFromConfig(cfg config.IntegrationsConfig) []*Client {
+	clients := make([]*Client, 0, 2)
+	for kind, c := range map[Kind]config.ArrConfig{KindSonarr: cfg.Sonarr, KindRadarr: cfg.Radarr} {
+		client := NewClient(kind, c.URL, c.APIKey)
+		client.Rename = c.Rename
+		client.LocalPath = c.LocalPath
+		client.RemotePath = c.RemotePath
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+// IsConfigured returns true if the URL and API key are set
+func (c *Client) IsConfigured() bool {
+	return c.URL != "" && c.APIKey != ""
+}
+
+// Test checks the URL and API key against the system status endpoint
+func (c *Client) Test(ctx context.Context) error {
+	if !c.IsConfigured() {
+		return fmt.Errorf("%s url and api key not configured", c.Kind)
+	}
+	return c.do(ctx, http.MethodGet, "/api/v3/system/status", nil, nil)
+}
+
+// item is the subset of a series/movie resource we need
+type item struct {
+	ID    int    `json:"id"`
+	Title string `json:"title"`
+	Path  string `json:"path"`
+}
+
+// Lookup finds the series (Sonarr) or movie (Radarr) whose folder contains
+// path. Returns ErrNotManaged if none does.
+func (c *Client) Lookup(ctx context.Context, path string) (int, string, error) {
+	endpoint := "/api/v3/series"
+	if c.Kind == KindRadarr {
+		endpoint = "/api/v3/movie"
+	}
+
+	var items []item
+	if err := c.do(ctx, http.MethodGet, endpoint, nil, &items); err != nil {
+		return 0, "", err
+	}
+
+	remote := integrations.MapPath(path, c.LocalPath, c.RemotePath)
+	best := -1
+	for i, it := range items {
+		if !integrations.PathWithin(remote, it.Path) {
+			continue
+		}
+		// Prefer the deepest folder if libraries are nested
+		if best < 0 || len(it.Path) > len(items[best].Path) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return 0, "", ErrNotManaged
+	}
+	return items[best].ID, items[best].Title, nil
+}
+
+// Refresh queues a rescan of the series/movie, then a rename if enabled.
+// Both are queued *arr commands; this doesn't wait for them to finish.
+func (c *Client) Refresh(ctx context.Context, id int) error {
+	rescan := map[string]interface{}{"name": "RescanSeries", "seriesId": id}
+	rename := map[string]interface{}{"name": "RenameSeries", "seriesIds": []int{id}}
+	if c.Kind == KindRadarr {
+		rescan = map[string]interface{}{"name": "RescanMovie", "movieId": id}
+		rename = map[string]interface{}{"name": "RenameMovie", "movieIds": []int{id}}
+	}
+
+	if err := c.do(ctx, http.MethodPost, "/api/v3/command", rescan, nil); err != nil {
+		return err
+	}
+	if c.Rename {
+		return c.do(ctx, http.MethodPost, "/api/v3/command", rename, nil)
+	}
+	return nil
+}
+
+// do sends a JSON request and decodes a JSON response into out (if non-nil)
+func (c *Client) do(ctx context.Context, method, endpoint string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	url := strings.TrimRight(c.URL, "/") + endpoint
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return fmt.Errorf("failed to build %s request: %w", c.Kind, err)
+	}
+	req.Header.Set("X-Api-Key", c.APIKey)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach %s: %w", c.Kind, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		io.Copy(io.Discard, resp.Body)
+		return fmt.Errorf("%s returned status %d", c.Kind, resp.StatusCode)
+	}
+	if out == nil {
+		// Drain response body to allow connection reuse
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("invalid %s response: %w", c.Kind, err)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package arr
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLookupAndRefresh(t *testing.T) {
+	var commands []map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/v3/series":
+			json.NewEncoder(w).Encode([]item{
+				{ID: 1, Title: "Show", Path: "/tv/Show"},
+				{ID: 2, Title: "Show Extended", Path: "/tv/Show Extended"},
+			})
+		case "/api/v3/command":
+			var cmd map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&cmd)
+			commands = append(commands, cmd)
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	c := NewClient(KindSonarr, srv.URL, "key")
+	c.LocalPath = "/media/tv"
+	c.RemotePath = "/tv"
+	c.Rename = true
+	ctx := context.Background()
+
+	id, title, err := c.Lookup(ctx, "/media/tv/Show Extended/Season 1/e01.mkv")
+	if err != nil || id != 2 || title != "Show Extended" {
+		t.Fatalf("expected Show Extended (2), got %d %q %v", id, title, err)
+	}
+	if _, _, err := c.Lookup(ctx, "/media/movies/Film/film.mkv"); err != ErrNotManaged {
+		t.Fatalf("expected ErrNotManaged, got %v", err)
+	}
+
+	if err := c.Refresh(ctx, id); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	if len(commands) != 2 || commands[0]["name"] != "RescanSeries" || commands[1]["name"] != "RenameSeries" {
+		t.Errorf("unexpected commands: %v", commands)
+	}
+
+	c.APIKey = "wrong"
+	if err := c.Test(ctx); err == nil {
+		t.Error("expected test with a bad api key to fail")
+	}
+}
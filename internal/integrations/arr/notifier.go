@@ -0,0 +1,124 @@
+package arr
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/logger"
+)
+
+var arrLog = logger.For("arr")
+
+// DefaultDelay batches refreshes so finishing a whole season triggers one
+// rescan of the series instead of one per episode.
+const DefaultDelay = 30 * time.Second
+
+// target is a pending refresh of one series/movie on one client
+type target struct {
+	client *Client
+	id     int
+}
+
+// Notifier refreshes Sonarr/Radarr after completed transcodes
+type Notifier struct {
+	mu      sync.Mutex
+	clients []*Client
+	delay   time.Duration
+	pending map[target]string // -> title, for logging
+	timer   *time.Timer
+}
+
+// NewNotifier creates a notifier for the given clients; unconfigured
+// clients are ignored.
+func NewNotifier(delay time.Duration, clients ...*Client) *Notifier {
+	return &Notifier{
+		clients: clients,
+		delay:   delay,
+		pending: make(map[target]string),
+	}
+}
+
+// SetClients replaces the clients (used when the config is reloaded)
+func (n *Notifier) SetClients(clients ...*Client) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.clients = clients
+}
+
+// Client returns the configured client of the given kind, if any
+func (n *Notifier) Client(kind Kind) *Client {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, c := range n.clients {
+		if c.Kind == kind {
+			return c
+		}
+	}
+	return nil
+}
+
+// OnComplete is called after a transcode replaces or adds outputPath.
+// It looks up the owning series/movie in every configured instance and
+// schedules a refresh. It never blocks the caller.
+func (n *Notifier) OnComplete(inputPath, outputPath string) {
+	n.mu.Lock()
+	clients := make([]*Client, 0, len(n.clients))
+	for _, c := range n.clients {
+		if c.IsConfigured() {
+			clients = append(clients, c)
+		}
+	}
+	n.mu.Unlock()
+	if len(clients) == 0 {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		for _, c := range clients {
+			id, title, err := c.Lookup(ctx, outputPath)
+			if errors.Is(err, ErrNotManaged) {
+				continue
+			}
+			if err != nil {
+				arrLog.Warn("Lookup failed", "kind", c.Kind, "path", outputPath, "error", err)
+				continue
+			}
+			n.schedule(target{client: c, id: id}, title)
+		}
+	}()
+}
+
+// schedule adds t to the pending batch and starts the flush timer
+func (n *Notifier) schedule(t target, title string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.pending[t] = title
+	if n.timer == nil {
+		n.timer = time.AfterFunc(n.delay, n.flush)
+	}
+}
+
+// flush refreshes every pending series/movie
+func (n *Notifier) flush() {
+	n.mu.Lock()
+	pending := n.pending
+	n.pending = make(map[target]string)
+	n.timer = nil
+	n.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	for t, title := range pending {
+		if err := t.client.Refresh(ctx, t.id); err != nil {
+			arrLog.Warn("Refresh failed", "kind", t.client.Kind, "title", title, "error", err)
+			continue
+		}
+		arrLog.Info("Asked to rescan", "kind", t.client.Kind, "title", title)
+	}
+}
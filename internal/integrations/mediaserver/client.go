@@ -0,0 +1,217 @@
+// Package mediaserver asks Plex or Jellyfin to refresh just the folder or
+// file Shrinkray replaced, instead of waiting for a scheduled library scan.
+package mediaserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/config"
+	"github.com/gwlsn/shrinkray/internal/integrations"
+)
+
+// httpClient is a shared HTTP client with timeout for all media server requests
+var httpClient = &http.Client{
+	Timeout: 30 * time.Second,
+}
+
+// Kind identifies the media server software
+type Kind string
+
+const (
+	KindPlex     Kind = "plex"
+	KindJellyfin Kind = "jellyfin"
+)
+
+// Update types reported to Jellyfin
+const (
+	UpdateCreated  = "Created"
+	UpdateModified = "Modified"
+	UpdateDeleted  = "Deleted"
+)
+
+// Client refreshes one Plex or Jellyfin server
+type Client struct {
+	Kind  Kind
+	Name  string
+	URL   string
+	Token string
+	// Root limits the client to files under this local path (empty = all)
+	Root string
+	// RemoteRoot is Root as the server sees it
+	RemoteRoot string
+}
+
+// NewClient creates a new media server client
+func NewClient(kind Kind, name, url, token string) *Client {
+	if name == "" {
+		name = url
+	}
+	return &Client{Kind: kind, Name: name, URL: url, Token: token}
+}
+
+// ClientsFromConfig builds clients for every configured Plex and Jellyfin server
+func ClientsFromConfig(cfg config.IntegrationsConfig) []*Client {
+	var clients []*Client
+	add := func(kind Kind, servers []config.MediaServerConfig) {
+		for _, s := range servers {
+			c := NewClient(kind, s.Name, s.URL, s.Token)
+			c.Root = s.Root
+			c.RemoteRoot = s.RemoteRoot
+			clients = append(clients, c)
+		}
+	}
+	add(KindPlex, cfg.Plex)
+	add(KindJellyfin, cfg.Jellyfin)
+	return clients
+}
+
+// IsConfigured returns true if the URL and token are set
+func (c *Client) IsConfigured() bool {
+	return c.URL != "" && c.Token != ""
+}
+
+// Covers reports whether the client should be told about path
+func (c *Client) Covers(path string) bool {
+	return c.Root == "" || integrations.PathWithin(path, c.Root)
+}
+
+// Test checks the URL and token
+func (c *Client) Test(ctx context.Context) error {
+	if !c.IsConfigured() {
+		return fmt.Errorf("%s url and token not configured", c.Kind)
+	}
+	if c.Kind == KindPlex {
+		return c.do(ctx, http.MethodGet, "/library/sections", nil, nil)
+	}
+	return c.do(ctx, http.MethodGet, "/System/Info", nil, nil)
+}
+
+// Refresh tells the server about changed files, given as local path ->
+// update type (UpdateCreated, UpdateModified or UpdateDeleted).
+// Plex gets one partial scan per affected folder; Jellyfin gets the files.
+func (c *Client) Refresh(ctx context.Context, updates map[string]string) error {
+	if c.Kind == KindPlex {
+		return c.refreshPlex(ctx, updates)
+	}
+	return c.refreshJellyfin(ctx, updates)
+}
+
+// remote maps a local path into the server's filesystem
+func (c *Client) remote(p string) string {
+	return integrations.MapPath(p, c.Root, c.RemoteRoot)
+}
+
+// plexSections is the subset of GET /library/sections we need
+type plexSections struct {
+	MediaContainer struct {
+		Directory []struct {
+			Key      string `json:"key"`
+			Title    string `json:"title"`
+			Location []struct {
+				Path string `json:"path"`
+			} `json:"Location"`
+		} `json:"Directory"`
+	} `json:"MediaContainer"`
+}
+
+func (c *Client) refreshPlex(ctx context.Context, updates map[string]string) error {
+	var sections plexSections
+	if err := c.do(ctx, http.MethodGet, "/library/sections", nil, &sections); err != nil {
+		return err
+	}
+
+	dirs := make(map[string]bool)
+	for p := range updates {
+		dirs[path.Dir(c.remote(p))] = true
+	}
+
+	for dir := range dirs {
+		// Pick the section with the deepest location containing the folder
+		key, best := "", -1
+		for _, d := range sections.MediaContainer.Directory {
+			for _, loc := range d.Location {
+				if integrations.PathWithin(dir, loc.Path) && len(loc.Path) > best {
+					key, best = d.Key, len(loc.Path)
+				}
+			}
+		}
+		if key == "" {
+			return fmt.Errorf("no plex library contains %s", dir)
+		}
+
+		endpoint := "/library/sections/" + url.PathEscape(key) + "/refresh?path=" + url.QueryEscape(dir)
+		if err := c.do(ctx, http.MethodGet, endpoint, nil, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Client) refreshJellyfin(ctx context.Context, updates map[string]string) error {
+	type update struct {
+		Path       string `json:"Path"`
+		UpdateType string `json:"UpdateType"`
+	}
+	body := struct {
+		Updates []update `json:"Updates"`
+	}{}
+	for p, kind := range updates {
+		body.Updates = append(body.Updates, update{Path: c.remote(p), UpdateType: kind})
+	}
+	return c.do(ctx, http.MethodPost, "/Library/Media/Updated", body, nil)
+}
+
+// do sends a request and decodes a JSON response into out (if non-nil)
+func (c *Client) do(ctx context.Context, method, endpoint string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(c.URL, "/")+endpoint, reader)
+	if err != nil {
+		return fmt.Errorf("failed to build %s request: %w", c.Kind, err)
+	}
+	if c.Kind == KindPlex {
+		req.Header.Set("X-Plex-Token", c.Token)
+	} else {
+		req.Header.Set("Authorization", fmt.Sprintf("MediaBrowser Token=%q", c.Token))
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach %s: %w", c.Name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		io.Copy(io.Discard, resp.Body)
+		return fmt.Errorf("%s returned status %d", c.Name, resp.StatusCode)
+	}
+	if out == nil {
+		// Drain response body to allow connection reuse
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("invalid %s response: %w", c.Name, err)
+	}
+	return nil
+}
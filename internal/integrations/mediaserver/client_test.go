@@ -0,0 +1,75 @@
+package mediaserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPlexPartialScan(t *testing.T) {
+	var refreshed []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Plex-Token") != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/library/sections":
+			w.Write([]byte(`{"MediaContainer":{"Directory":[
+				{"key":"1","title":"Movies","Location":[{"path":"/data/movies"}]},
+				{"key":"2","title":"TV","Location":[{"path":"/data/tv"}]}]}}`))
+		case "/library/sections/2/refresh":
+			refreshed = append(refreshed, r.URL.Query().Get("path"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	c := NewClient(KindPlex, "", srv.URL, "token")
+	c.Root = "/media/tv"
+	c.RemoteRoot = "/data/tv"
+
+	if !c.Covers("/media/tv/Show/e01.mkv") || c.Covers("/media/movies/Film.mkv") {
+		t.Fatal("unexpected Covers result")
+	}
+
+	err := c.Refresh(context.Background(), map[string]string{
+		"/media/tv/Show/Season 1/e01.mkv": UpdateCreated,
+		"/media/tv/Show/Season 1/e01.avi": UpdateDeleted,
+	})
+	if err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	if len(refreshed) != 1 || refreshed[0] != "/data/tv/Show/Season 1" {
+		t.Errorf("expected one scan of the season folder, got %v", refreshed)
+	}
+}
+
+func TestJellyfinMediaUpdated(t *testing.T) {
+	var body struct {
+		Updates []struct {
+			Path       string
+			UpdateType string
+		}
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/Library/Media/Updated" || r.Header.Get("Authorization") != `MediaBrowser Token="key"` {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	c := NewClient(KindJellyfin, "jf", srv.URL, "key")
+	if err := c.Refresh(context.Background(), map[string]string{"/media/movies/Film.mkv": UpdateModified}); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	if len(body.Updates) != 1 || body.Updates[0].Path != "/media/movies/Film.mkv" || body.Updates[0].UpdateType != UpdateModified {
+		t.Errorf("unexpected updates: %+v", body.Updates)
+	}
+}
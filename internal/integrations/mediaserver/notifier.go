@@ -0,0 +1,105 @@
+package mediaserver
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/logger"
+)
+
+var mediaserverLog = logger.For("mediaserver")
+
+// DefaultDelay batches refreshes so a run of completed episodes in one
+// folder triggers a single partial scan.
+const DefaultDelay = 10 * time.Second
+
+// Notifier refreshes media servers after completed transcodes
+type Notifier struct {
+	mu      sync.Mutex
+	clients []*Client
+	delay   time.Duration
+	pending map[*Client]map[string]string // local path -> update type
+	timer   *time.Timer
+}
+
+// NewNotifier creates a notifier for the given clients; unconfigured
+// clients are ignored.
+func NewNotifier(delay time.Duration, clients ...*Client) *Notifier {
+	return &Notifier{
+		clients: clients,
+		delay:   delay,
+		pending: make(map[*Client]map[string]string),
+	}
+}
+
+// SetClients replaces the clients (used when the config is reloaded)
+func (n *Notifier) SetClients(clients ...*Client) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.clients = clients
+}
+
+// Clients returns the configured clients of the given kind
+func (n *Notifier) Clients(kind Kind) []*Client {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var clients []*Client
+	for _, c := range n.clients {
+		if c.Kind == kind {
+			clients = append(clients, c)
+		}
+	}
+	return clients
+}
+
+// OnComplete is called after a transcode replaces or adds outputPath.
+// If the original is gone under a different name (e.g. .avi -> .mkv) it
+// is reported as deleted. It never blocks the caller.
+func (n *Notifier) OnComplete(inputPath, outputPath string) {
+	updates := map[string]string{outputPath: UpdateModified}
+	if inputPath != outputPath {
+		updates[outputPath] = UpdateCreated
+		if _, err := os.Stat(inputPath); os.IsNotExist(err) {
+			updates[inputPath] = UpdateDeleted
+		}
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, c := range n.clients {
+		if !c.IsConfigured() || !c.Covers(outputPath) {
+			continue
+		}
+		if n.pending[c] == nil {
+			n.pending[c] = make(map[string]string)
+		}
+		for p, kind := range updates {
+			n.pending[c][p] = kind
+		}
+	}
+	if len(n.pending) > 0 && n.timer == nil {
+		n.timer = time.AfterFunc(n.delay, n.flush)
+	}
+}
+
+// flush sends every pending refresh
+func (n *Notifier) flush() {
+	n.mu.Lock()
+	pending := n.pending
+	n.pending = make(map[*Client]map[string]string)
+	n.timer = nil
+	n.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	for c, updates := range pending {
+		if err := c.Refresh(ctx, updates); err != nil {
+			mediaserverLog.Warn("Refresh failed", "server", c.Name, "error", err)
+			continue
+		}
+		mediaserverLog.Info("Asked to refresh files", "server", c.Name, "files", len(updates))
+	}
+}
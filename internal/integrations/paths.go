@@ -0,0 +1,29 @@
+// Package integrations holds helpers shared by the clients that notify
+// other apps (Sonarr/Radarr, Plex/Jellyfin) about replaced files.
+package integrations
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// PathWithin reports whether path is dir or inside it
+func PathWithin(path, dir string) bool {
+	dir = strings.TrimRight(filepath.ToSlash(dir), "/")
+	if dir == "" {
+		return false
+	}
+	path = filepath.ToSlash(path)
+	return path == dir || strings.HasPrefix(path, dir+"/")
+}
+
+// MapPath translates a local path into another app's view of the
+// filesystem by swapping the local prefix for the remote one. Paths outside
+// local (or an empty mapping) are returned unchanged.
+func MapPath(path, local, remote string) string {
+	if local == "" || remote == "" || !PathWithin(path, local) {
+		return path
+	}
+	rel := strings.TrimPrefix(filepath.ToSlash(path), strings.TrimRight(filepath.ToSlash(local), "/"))
+	return strings.TrimRight(remote, "/") + rel
+}
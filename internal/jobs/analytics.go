@@ -0,0 +1,232 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/gwlsn/shrinkray/internal/logger"
+)
+
+var analyticsLog = logger.For("analytics")
+
+// outcomeCounts accumulates finished jobs for one preset or preset+encoder
+type outcomeCounts struct {
+	Completed    int     `json:"completed"`
+	Failed       int     `json:"failed"` // Includes outputs that failed verification
+	NoGain       int     `json:"no_gain"`
+	SavingsSum   float64 `json:"savings_sum"` // Sum of savings % over completed jobs
+	SpeedSum     float64 `json:"speed_sum"`   // Sum of realtime multiples over timed completed jobs
+	SpeedSamples int     `json:"speed_samples"`
+	EnergySum    float64 `json:"energy_sum"` // kWh over completed jobs with a known energy use
+	EnergyJobs   int     `json:"energy_jobs"`
+}
+
+// presetCounts is a preset's outcomes, overall and by encoder
+type presetCounts struct {
+	outcomeCounts
+	Encoders map[string]*outcomeCounts `json:"encoders"`
+}
+
+// OutcomeStats summarizes finished jobs for a preset, or a preset on one encoder
+type OutcomeStats struct {
+	Jobs              int     `json:"jobs"` // Completed + failed + no gain
+	Completed         int     `json:"completed"`
+	Failed            int     `json:"failed"`
+	NoGain            int     `json:"no_gain"`
+	FailureRate       float64 `json:"failure_rate"`        // Failed / jobs, 0-1
+	AvgSavingsPercent float64 `json:"avg_savings_percent"` // Over completed jobs
+	AvgSpeed          float64 `json:"avg_speed"`           // Realtime multiple over completed jobs; 0 if unknown
+	AvgEnergyKWh      float64 `json:"avg_energy_kwh"`      // Per completed job with energy tracked; 0 if unknown
+}
+
+// PresetStats is one preset's outcomes, overall and by encoder
+type PresetStats struct {
+	PresetID string `json:"preset_id"`
+	OutcomeStats
+	Encoders map[string]OutcomeStats `json:"encoders"` // By encoder ("vaapi", "none", ...)
+}
+
+// Analytics persists per-preset and per-encoder job outcomes, so encoders
+// can be compared on savings, reliability and speed
+type Analytics struct {
+	mu       sync.Mutex
+	presets  map[string]*presetCounts // By preset ID
+	filePath string
+}
+
+// NewAnalytics loads analytics from filePath, or starts empty if it doesn't exist
+func NewAnalytics(filePath string) (*Analytics, error) {
+	a := &Analytics{
+		presets:  make(map[string]*presetCounts),
+		filePath: filePath,
+	}
+
+	data, err := os.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return a, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &a.presets); err != nil {
+		return nil, err
+	}
+	for _, p := range a.presets {
+		if p.Encoders == nil {
+			p.Encoders = make(map[string]*outcomeCounts)
+		}
+	}
+	return a, nil
+}
+
+// Backfill records the finished jobs in jobs if there are no analytics yet
+func (a *Analytics) Backfill(jobs []*Job) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if len(a.presets) > 0 {
+		return
+	}
+	for _, job := range jobs {
+		a.recordLocked(job)
+	}
+	if len(a.presets) > 0 {
+		a.save()
+	}
+}
+
+// Record adds a finished job's outcome. Jobs that aren't complete, failed,
+// no gain or verify failed are ignored.
+func (a *Analytics) Record(job *Job) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.recordLocked(job) {
+		a.save()
+	}
+}
+
+// recordLocked adds job to its preset's and encoder's counts, reporting
+// whether it was counted. Must hold a.mu.
+func (a *Analytics) recordLocked(job *Job) bool {
+	switch job.Status {
+	case StatusComplete, StatusFailed, StatusVerifyFailed, StatusNoGain:
+	default:
+		return false
+	}
+
+	preset, ok := a.presets[job.PresetID]
+	if !ok {
+		preset = &presetCounts{Encoders: make(map[string]*outcomeCounts)}
+		a.presets[job.PresetID] = preset
+	}
+	encoder := job.Encoder
+	if encoder == "" {
+		encoder = "unknown"
+	}
+	byEncoder, ok := preset.Encoders[encoder]
+	if !ok {
+		byEncoder = &outcomeCounts{}
+		preset.Encoders[encoder] = byEncoder
+	}
+
+	for _, counts := range []*outcomeCounts{&preset.outcomeCounts, byEncoder} {
+		switch job.Status {
+		case StatusComplete:
+			counts.Completed++
+			if job.InputSize > 0 {
+				counts.SavingsSum += float64(job.SpaceSaved) / float64(job.InputSize) * 100
+			}
+			if job.Duration > 0 && job.TranscodeTime > 0 {
+				counts.SpeedSum += float64(job.Duration) / 1000 / float64(job.TranscodeTime)
+				counts.SpeedSamples++
+			}
+			if job.EnergyKWh > 0 {
+				counts.EnergySum += job.EnergyKWh
+				counts.EnergyJobs++
+			}
+		case StatusFailed, StatusVerifyFailed:
+			counts.Failed++
+		case StatusNoGain:
+			counts.NoGain++
+		}
+	}
+	return true
+}
+
+// stats derives averages and rates from the raw counts
+func (c *outcomeCounts) stats() OutcomeStats {
+	s := OutcomeStats{
+		Jobs:      c.Completed + c.Failed + c.NoGain,
+		Completed: c.Completed,
+		Failed:    c.Failed,
+		NoGain:    c.NoGain,
+	}
+	if s.Jobs > 0 {
+		s.FailureRate = float64(c.Failed) / float64(s.Jobs)
+	}
+	if c.Completed > 0 {
+		s.AvgSavingsPercent = c.SavingsSum / float64(c.Completed)
+	}
+	if c.SpeedSamples > 0 {
+		s.AvgSpeed = c.SpeedSum / float64(c.SpeedSamples)
+	}
+	if c.EnergyJobs > 0 {
+		s.AvgEnergyKWh = c.EnergySum / float64(c.EnergyJobs)
+	}
+	return s
+}
+
+// Presets returns the outcomes of each preset, sorted by preset ID
+func (a *Analytics) Presets() []PresetStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	result := make([]PresetStats, 0, len(a.presets))
+	for id, preset := range a.presets {
+		stats := PresetStats{
+			PresetID:     id,
+			OutcomeStats: preset.stats(),
+			Encoders:     make(map[string]OutcomeStats, len(preset.Encoders)),
+		}
+		for encoder, counts := range preset.Encoders {
+			stats.Encoders[encoder] = counts.stats()
+		}
+		result = append(result, stats)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].PresetID < result[j].PresetID
+	})
+	return result
+}
+
+// Watch records jobs as the queue finishes them until ctx is done
+func (a *Analytics) Watch(ctx context.Context, q *Queue) {
+	events := q.Subscribe()
+	go func() {
+		defer q.Unsubscribe(events)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event := <-events:
+				switch event.Type {
+				case "complete", "failed", "no_gain", "verify_failed":
+					if event.Job != nil {
+						a.Record(event.Job)
+					}
+				}
+			}
+		}
+	}()
+}
+
+// save writes the analytics to disk. Must hold a.mu.
+func (a *Analytics) save() {
+	if err := saveJSON(a.filePath, a.presets); err != nil {
+		analyticsLog.Warn("Failed to save analytics", "error", err)
+	}
+}
@@ -0,0 +1,52 @@
+package jobs
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestAnalyticsByPresetAndEncoder(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "analytics.json")
+	analytics, err := NewAnalytics(filePath)
+	if err != nil {
+		t.Fatalf("NewAnalytics: %v", err)
+	}
+
+	analytics.Backfill([]*Job{
+		// VAAPI: 60% savings at 4x, plus one failure
+		{PresetID: "compress-hevc", Encoder: "vaapi", Status: StatusComplete, InputSize: 1000, SpaceSaved: 600, Duration: 3_600_000, TranscodeTime: 900},
+		{PresetID: "compress-hevc", Encoder: "vaapi", Status: StatusFailed},
+		{PresetID: "compress-hevc", Encoder: "vaapi", Status: StatusPending}, // Not finished: ignored
+	})
+	// Software: 40% and 50% savings, one no-gain
+	analytics.Record(&Job{PresetID: "compress-hevc", Encoder: "none", Status: StatusComplete, InputSize: 1000, SpaceSaved: 400})
+	analytics.Record(&Job{PresetID: "compress-hevc", Encoder: "none", Status: StatusComplete, InputSize: 1000, SpaceSaved: 500})
+	analytics.Record(&Job{PresetID: "compress-hevc", Encoder: "none", Status: StatusNoGain})
+	analytics.Record(&Job{PresetID: "compress-av1", Encoder: "none", Status: StatusVerifyFailed})
+
+	// Reloading keeps the counts
+	analytics, err = NewAnalytics(filePath)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	presets := analytics.Presets()
+	if len(presets) != 2 || presets[0].PresetID != "compress-av1" || presets[1].PresetID != "compress-hevc" {
+		t.Fatalf("Presets() = %+v, want compress-av1 then compress-hevc", presets)
+	}
+	if av1 := presets[0]; av1.Jobs != 1 || av1.FailureRate != 1 {
+		t.Errorf("av1 = %+v, want 1 job, all failed", av1.OutcomeStats)
+	}
+
+	hevc := presets[1]
+	if hevc.Jobs != 5 || hevc.Completed != 3 || hevc.Failed != 1 || hevc.NoGain != 1 || hevc.FailureRate != 0.2 || hevc.AvgSavingsPercent != 50 {
+		t.Errorf("hevc = %+v, want 5 jobs / 3 complete / 20%% failures / 50%% savings", hevc.OutcomeStats)
+	}
+	vaapi := hevc.Encoders["vaapi"]
+	if vaapi.Jobs != 2 || vaapi.FailureRate != 0.5 || vaapi.AvgSavingsPercent != 60 || vaapi.AvgSpeed != 4 {
+		t.Errorf("vaapi = %+v, want 2 jobs / 50%% failures / 60%% savings / 4x", vaapi)
+	}
+	software := hevc.Encoders["none"]
+	if software.Jobs != 3 || software.FailureRate != 0 || software.AvgSavingsPercent != 45 || software.AvgSpeed != 0 {
+		t.Errorf("software = %+v, want 3 jobs / no failures / 45%% savings / unknown speed", software)
+	}
+}
@@ -0,0 +1,77 @@
+package jobs
+
+import (
+	"fmt"
+	"time"
+)
+
+// Attempt is an earlier try at a job's file, kept on the job that replaced
+// it so failures stay traceable across retries and fallbacks
+type Attempt struct {
+	JobID       string    `json:"job_id"`
+	PresetID    string    `json:"preset_id"`
+	Encoder     string    `json:"encoder"`
+	Status      Status    `json:"status"`
+	Error       string    `json:"error,omitempty"`
+	ExitCode    int       `json:"exit_code,omitempty"`
+	StartedAt   time.Time `json:"started_at,omitempty"`
+	CompletedAt time.Time `json:"completed_at,omitempty"`
+
+	// RetriedBy is how the next attempt came about: "retry", "retry_preset",
+	// "force", "fallback" (software after a hardware failure) or "stalled"
+	RetriedBy string `json:"retried_by,omitempty"`
+}
+
+// attemptOf records job as it stands
+func attemptOf(job *Job, retriedBy string) Attempt {
+	return Attempt{
+		JobID:       job.ID,
+		PresetID:    job.PresetID,
+		Encoder:     job.Encoder,
+		Status:      job.Status,
+		Error:       job.Error,
+		ExitCode:    job.ExitCode,
+		StartedAt:   job.StartedAt,
+		CompletedAt: job.CompletedAt,
+		RetriedBy:   retriedBy,
+	}
+}
+
+// withAttempt returns job's attempts followed by job itself
+func withAttempt(job *Job, retriedBy string) []Attempt {
+	attempts := make([]Attempt, 0, len(job.Attempts)+1)
+	attempts = append(attempts, job.Attempts...)
+	return append(attempts, attemptOf(job, retriedBy))
+}
+
+// settleAttemptsLocked updates the attempts recorded for job, which is
+// leaving the queue, to how it ended
+func (q *Queue) settleAttemptsLocked(job *Job) {
+	for _, other := range q.jobs {
+		for i, attempt := range other.Attempts {
+			if attempt.JobID == job.ID {
+				other.Attempts[i] = attemptOf(job, attempt.RetriedBy)
+			}
+		}
+	}
+}
+
+// Attempts returns every try at the job's file, oldest first, ending with
+// the job itself. Earlier attempts still in the queue are reported as they
+// are now, e.g. a hardware job that failed after its fallback was queued.
+func (q *Queue) Attempts(id string) ([]Attempt, error) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return nil, fmt.Errorf("job not found: %s", id)
+	}
+	attempts := withAttempt(job, "")
+	for i, attempt := range attempts[:len(attempts)-1] {
+		if live, ok := q.jobs[attempt.JobID]; ok && live != job {
+			attempts[i] = attemptOf(live, attempt.RetriedBy)
+		}
+	}
+	return attempts, nil
+}
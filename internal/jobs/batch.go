@@ -0,0 +1,293 @@
+package jobs
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Batch groups the jobs queued by one request, e.g. a folder, so they can be
+// followed and managed together
+type Batch struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"` // The queued folders or files, for display
+	Paths     []string  `json:"paths"`
+	PresetID  string    `json:"preset_id"`
+	CreatedBy string    `json:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Paused batches' pending jobs aren't started until the batch is resumed
+	Paused bool `json:"paused,omitempty"`
+
+	// Adding is set while files are still being found and probed for the
+	// batch; it isn't done until FinishBatch clears it
+	Adding bool `json:"adding,omitempty"`
+
+	// Duplicates counts the files left out because they were already queued
+	Duplicates int `json:"duplicates,omitempty"`
+
+	// Excluded are the files found that looked like samples or extras and
+	// were left out; queuing one by path adds it
+	Excluded []ExcludedFile `json:"excluded,omitempty"`
+}
+
+// ExcludedFile is a file left out of a batch and why
+type ExcludedFile struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// BatchSummary is a batch with totals over its jobs
+type BatchSummary struct {
+	Batch
+	Jobs       int            `json:"jobs"`
+	Counts     map[Status]int `json:"counts"`                // Jobs per status
+	Progress   float64        `json:"progress"`              // 0-100, weighted by input size
+	ETASeconds int64          `json:"eta_seconds,omitempty"` // From the running jobs' speed; 0 if unknown
+	InputSize  int64          `json:"input_size"`            // Of all jobs
+	SpaceSaved int64          `json:"space_saved"`           // By completed jobs
+	Done       bool           `json:"done"`                  // Every job has finished
+	FinishedAt time.Time      `json:"finished_at,omitempty"` // When the last job finished, once done
+}
+
+// CreateBatch starts a batch for the jobs about to be added from paths; pass
+// its ID in AddOptions and call FinishBatch once they're all added. A batch
+// without jobs is dropped when the queue is next cleared or a job removed.
+func (q *Queue) CreateBatch(paths []string, presetID string, createdBy string) *Batch {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	batch := &Batch{
+		ID:        generateID(),
+		Name:      batchName(paths),
+		Paths:     append([]string(nil), paths...),
+		PresetID:  presetID,
+		CreatedBy: createdBy,
+		CreatedAt: time.Now(),
+		Adding:    true,
+	}
+	q.batches[batch.ID] = batch
+	return batch
+}
+
+// FinishBatch records that every job of the batch has been added, so it
+// (and the queue) can be reported done once they finish
+func (q *Queue) FinishBatch(id string) {
+	q.mu.Lock()
+	batch, ok := q.batches[id]
+	if !ok || !batch.Adding {
+		q.mu.Unlock()
+		return
+	}
+	batch.Adding = false
+	if err := q.save(); err != nil {
+		queueLog.Warn("Failed to persist queue", "error", err)
+	}
+	copied := *batch
+	q.mu.Unlock()
+
+	q.broadcast(JobEvent{Type: "batch_updated", BatchID: id, Batch: &copied})
+}
+
+// addingBatchesLocked counts the batches still having jobs added. Must hold
+// q.mu.
+func (q *Queue) addingBatchesLocked() int {
+	n := 0
+	for _, batch := range q.batches {
+		if batch.Adding {
+			n++
+		}
+	}
+	return n
+}
+
+// countDuplicatesLocked records files left out of a batch as already
+// queued. Must be called with q.mu held.
+func (q *Queue) countDuplicatesLocked(batchID string, n int) {
+	if batch, ok := q.batches[batchID]; ok && n > 0 {
+		batch.Duplicates += n
+	}
+}
+
+// ExcludeFromBatch records files left out of a batch, e.g. samples
+func (q *Queue) ExcludeFromBatch(batchID string, files []ExcludedFile) {
+	if len(files) == 0 {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if batch, ok := q.batches[batchID]; ok {
+		batch.Excluded = append(batch.Excluded, files...)
+	}
+}
+
+// batchName describes paths, e.g. "Season 1" or "Season 1 and 2 more"
+func batchName(paths []string) string {
+	if len(paths) == 0 {
+		return ""
+	}
+	name := filepath.Base(strings.TrimRight(paths[0], "/"))
+	if len(paths) > 1 {
+		name = fmt.Sprintf("%s and %d more", name, len(paths)-1)
+	}
+	return name
+}
+
+// Batches returns the batches that still have jobs, newest first
+func (q *Queue) Batches() []BatchSummary {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	jobsByBatch := q.jobsByBatchLocked()
+	result := make([]BatchSummary, 0, len(jobsByBatch))
+	for id, batchJobs := range jobsByBatch {
+		if batch, ok := q.batches[id]; ok {
+			result = append(result, summarizeBatch(batch, batchJobs))
+		}
+	}
+	sortBatches(result)
+	return result
+}
+
+// GetBatch returns a batch's summary and jobs, in queue order
+func (q *Queue) GetBatch(id string) (*BatchSummary, []*Job) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	batch, ok := q.batches[id]
+	if !ok {
+		return nil, nil
+	}
+	batchJobs := q.jobsByBatchLocked()[id]
+	if len(batchJobs) == 0 {
+		return nil, nil
+	}
+	summary := summarizeBatch(batch, batchJobs)
+	return &summary, batchJobs
+}
+
+// SetBatchPaused holds (or releases) a batch's pending jobs. Running jobs
+// are not affected; pause those through the worker pool.
+func (q *Queue) SetBatchPaused(id string, paused bool) error {
+	q.mu.Lock()
+	batch, ok := q.batches[id]
+	if !ok {
+		q.mu.Unlock()
+		return fmt.Errorf("batch not found: %s", id)
+	}
+	batch.Paused = paused
+	if err := q.save(); err != nil {
+		queueLog.Warn("Failed to persist queue", "error", err)
+	}
+	copied := *batch
+	q.mu.Unlock()
+
+	q.broadcast(JobEvent{Type: "batch_updated", Batch: &copied})
+	return nil
+}
+
+// batchHeldLocked reports whether job belongs to a paused batch. Must hold q.mu.
+func (q *Queue) batchHeldLocked(job *Job) bool {
+	if job.BatchID == "" {
+		return false
+	}
+	batch, ok := q.batches[job.BatchID]
+	return ok && batch.Paused
+}
+
+// jobsByBatchLocked groups the jobs in queue order by batch. Must hold q.mu.
+func (q *Queue) jobsByBatchLocked() map[string][]*Job {
+	result := make(map[string][]*Job)
+	for _, id := range q.order {
+		if job, ok := q.jobs[id]; ok && job.BatchID != "" {
+			result[job.BatchID] = append(result[job.BatchID], job)
+		}
+	}
+	return result
+}
+
+// pruneBatchesLocked drops batches that no longer have jobs. Must hold q.mu
+// for writing.
+func (q *Queue) pruneBatchesLocked() {
+	if len(q.batches) == 0 {
+		return
+	}
+	jobsByBatch := q.jobsByBatchLocked()
+	for id := range q.batches {
+		if len(jobsByBatch[id]) == 0 {
+			delete(q.batches, id)
+		}
+	}
+}
+
+// batchesSnapshotLocked copies the batches that have jobs, for saving. Must
+// hold q.mu.
+func (q *Queue) batchesSnapshotLocked() []*Batch {
+	jobsByBatch := q.jobsByBatchLocked()
+	result := make([]*Batch, 0, len(jobsByBatch))
+	for id := range jobsByBatch {
+		if batch, ok := q.batches[id]; ok {
+			copied := *batch
+			result = append(result, &copied)
+		}
+	}
+	return result
+}
+
+func summarizeBatch(batch *Batch, batchJobs []*Job) BatchSummary {
+	summary := BatchSummary{
+		Batch:  *batch,
+		Jobs:   len(batchJobs),
+		Counts: make(map[Status]int),
+		Done:   !batch.Adding,
+	}
+
+	var done, remainingMs float64
+	var speed float64
+	for _, job := range batchJobs {
+		summary.Counts[job.Status]++
+		summary.InputSize += job.InputSize
+		if job.Status == StatusComplete {
+			summary.SpaceSaved += job.SpaceSaved
+		}
+
+		switch {
+		case job.IsTerminal():
+			done += float64(job.InputSize)
+			if job.CompletedAt.After(summary.FinishedAt) {
+				summary.FinishedAt = job.CompletedAt
+			}
+		case job.Status == StatusRunning:
+			summary.Done = false
+			done += float64(job.InputSize) * job.Progress / 100
+			remainingMs += float64(job.Duration) * (100 - job.Progress) / 100
+			speed += job.Speed
+		default:
+			summary.Done = false
+			remainingMs += float64(job.Duration)
+		}
+	}
+
+	if summary.InputSize > 0 {
+		summary.Progress = done / float64(summary.InputSize) * 100
+	} else if summary.Done {
+		summary.Progress = 100
+	}
+	if speed > 0 {
+		summary.ETASeconds = int64(remainingMs / speed / 1000)
+	}
+	if !summary.Done {
+		summary.FinishedAt = time.Time{}
+	}
+	return summary
+}
+
+// sortBatches orders summaries newest first
+func sortBatches(summaries []BatchSummary) {
+	for i := 1; i < len(summaries); i++ {
+		for j := i; j > 0 && summaries[j].CreatedAt.After(summaries[j-1].CreatedAt); j-- {
+			summaries[j], summaries[j-1] = summaries[j-1], summaries[j]
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package jobs
+
+import (
+	"sync"
+	"time"
+)
+
+// maxTombstones is how many removed jobs are remembered for ChangesSince.
+// A cursor older than the oldest one forgotten gets a full reset.
+const maxTombstones = 1000
+
+// Changes is what changed in the queue since a polling client's cursor
+type Changes struct {
+	Cursor  uint64   `json:"cursor"`            // Pass as since on the next poll
+	Reset   bool     `json:"reset,omitempty"`   // since was unknown or too old; Jobs is the whole queue
+	Jobs    []*Job   `json:"jobs"`              // Jobs changed since the cursor, in queue order
+	Removed []string `json:"removed,omitempty"` // IDs of jobs removed since the cursor
+	Order   []string `json:"order,omitempty"`   // Every job ID in queue order, when the order changed
+}
+
+// changeLog tracks when each job last changed, for clients that poll
+// instead of holding an event stream open. Revisions are values of a
+// queue-wide counter, so one cursor covers every job.
+type changeLog struct {
+	mu        sync.Mutex
+	seq       uint64
+	floor     uint64            // Cursors below this may have missed a removal
+	orderRev  uint64            // When jobs were last added, removed or reordered
+	revisions map[string]uint64 // Job ID -> revision of its last change
+	removed   []tombstone       // Oldest first
+}
+
+// tombstone records a removed job
+type tombstone struct {
+	id        string
+	createdBy string
+	rev       uint64
+}
+
+// newChangeLog starts revisions at the current time, so a cursor from
+// before a restart is never taken for a current one
+func newChangeLog() *changeLog {
+	seq := uint64(time.Now().UnixMicro())
+	return &changeLog{seq: seq, floor: seq, orderRev: seq, revisions: make(map[string]uint64)}
+}
+
+// touch records a change to the jobs with ids
+func (c *changeLog) touch(ids ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seq++
+	for _, id := range ids {
+		c.revisions[id] = c.seq
+	}
+}
+
+// reorder records that the queue order changed
+func (c *changeLog) reorder() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seq++
+	c.orderRev = c.seq
+}
+
+// remove records that jobs were removed from the queue
+func (c *changeLog) remove(jobs ...*Job) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seq++
+	c.orderRev = c.seq
+	for _, job := range jobs {
+		delete(c.revisions, job.ID)
+		c.removed = append(c.removed, tombstone{id: job.ID, createdBy: job.CreatedBy, rev: c.seq})
+	}
+	if over := len(c.removed) - maxTombstones; over > 0 {
+		c.floor = c.removed[over-1].rev
+		c.removed = c.removed[over:]
+	}
+}
+
+// recordEvent updates revisions for the jobs an event is about
+func (c *changeLog) recordEvent(event JobEvent) {
+	var ids []string
+	if event.Job != nil {
+		ids = append(ids, event.Job.ID)
+	}
+	for _, job := range event.Jobs {
+		ids = append(ids, job.ID)
+	}
+	if event.ProgressUpdate != nil {
+		ids = append(ids, event.ProgressUpdate.ID)
+	}
+	for _, update := range event.ProgressBatch {
+		ids = append(ids, update.ID)
+	}
+
+	switch event.Type {
+	case "removed":
+		if event.Job != nil {
+			c.remove(event.Job)
+		}
+		return
+	case "added", "batch_added", "reordered":
+		c.reorder()
+	}
+	if len(ids) > 0 {
+		c.touch(ids...)
+	}
+}
+
+// ChangesSince returns the jobs that changed after cursor since, as
+// returned by a previous call (0 on the first), limited to those created
+// by createdBy unless it's "". An unknown or too old cursor gets the whole
+// queue with Reset set.
+func (q *Queue) ChangesSince(since uint64, createdBy string) *Changes {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	c := q.changes
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	changes := &Changes{Cursor: c.seq, Jobs: []*Job{}}
+	changes.Reset = since < c.floor || since > c.seq
+	orderChanged := changes.Reset || c.orderRev > since
+	for _, id := range q.order {
+		job, ok := q.jobs[id]
+		if !ok || (createdBy != "" && job.CreatedBy != createdBy) {
+			continue
+		}
+		if changes.Reset || c.revisions[id] > since {
+			changes.Jobs = append(changes.Jobs, job)
+		}
+		if orderChanged {
+			changes.Order = append(changes.Order, id)
+		}
+	}
+	if changes.Reset {
+		return changes
+	}
+	for _, removed := range c.removed {
+		if removed.rev > since && (createdBy == "" || removed.createdBy == createdBy) {
+			changes.Removed = append(changes.Removed, removed.id)
+		}
+	}
+	return changes
+}
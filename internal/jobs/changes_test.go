@@ -0,0 +1,75 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/ffmpeg"
+)
+
+func TestChangesSince(t *testing.T) {
+	queue, _ := NewQueue("")
+	first, _ := queue.Add("/media/a.mkv", "compress-hevc", &ffmpeg.ProbeResult{Path: "/media/a.mkv", Size: 1000, Duration: time.Minute})
+	second, _ := queue.Add("/media/b.mkv", "compress-hevc", &ffmpeg.ProbeResult{Path: "/media/b.mkv", Size: 1000, Duration: time.Minute})
+
+	initial := queue.ChangesSince(0, "")
+	if !initial.Reset || len(initial.Jobs) != 2 || len(initial.Order) != 2 {
+		t.Fatalf("first poll should reset with every job, got reset=%v jobs=%d order=%v", initial.Reset, len(initial.Jobs), initial.Order)
+	}
+
+	if got := queue.ChangesSince(initial.Cursor, ""); got.Reset || len(got.Jobs) != 0 || got.Order != nil || got.Cursor != initial.Cursor {
+		t.Errorf("nothing changed, got %+v", got)
+	}
+
+	if err := queue.StartJob(first.ID, "/tmp/a.tmp.mkv", "cpu→cpu"); err != nil {
+		t.Fatal(err)
+	}
+	started := queue.ChangesSince(initial.Cursor, "")
+	if started.Reset || len(started.Jobs) != 1 || started.Jobs[0].ID != first.ID {
+		t.Fatalf("expected only the started job, got %+v", started)
+	}
+	if started.Order != nil {
+		t.Errorf("starting a job doesn't change the order, got %v", started.Order)
+	}
+
+	if _, err := queue.Remove(second.ID); err != nil {
+		t.Fatal(err)
+	}
+	removed := queue.ChangesSince(started.Cursor, "")
+	if len(removed.Removed) != 1 || removed.Removed[0] != second.ID {
+		t.Errorf("expected %s removed, got %v", second.ID, removed.Removed)
+	}
+	if len(removed.Order) != 1 || removed.Order[0] != first.ID {
+		t.Errorf("expected the new order, got %v", removed.Order)
+	}
+
+	// An older cursor still sees both changes
+	if got := queue.ChangesSince(initial.Cursor, ""); len(got.Jobs) != 1 || len(got.Removed) != 1 {
+		t.Errorf("expected the start and the removal since the first poll, got %+v", got)
+	}
+
+	// A cursor the queue never handed out, e.g. from before a restart
+	if got := queue.ChangesSince(removed.Cursor+1000, ""); !got.Reset || len(got.Jobs) != 1 || got.Removed != nil {
+		t.Errorf("unknown cursor should reset, got %+v", got)
+	}
+}
+
+func TestChangesSinceForgetsOldRemovals(t *testing.T) {
+	c := newChangeLog()
+	start := c.seq
+	for i := 0; i < maxTombstones+1; i++ {
+		c.remove(&Job{ID: "job"})
+	}
+	if len(c.removed) != maxTombstones {
+		t.Errorf("kept %d tombstones, want %d", len(c.removed), maxTombstones)
+	}
+
+	queue, _ := NewQueue("")
+	queue.changes = c
+	if got := queue.ChangesSince(start, ""); !got.Reset {
+		t.Error("a cursor from before the forgotten removals should reset")
+	}
+	if got := queue.ChangesSince(c.floor, ""); got.Reset || len(got.Removed) != maxTombstones {
+		t.Errorf("a cursor after them should see the kept removals, got reset=%v removed=%d", got.Reset, len(got.Removed))
+	}
+}
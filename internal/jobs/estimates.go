@@ -0,0 +1,244 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/gwlsn/shrinkray/internal/ffmpeg"
+	"github.com/gwlsn/shrinkray/internal/logger"
+)
+
+var estimatesLog = logger.For("estimates")
+
+// Calibration limits. A factor isn't applied until enough jobs back it, and
+// a handful of odd files can't scale estimates by more than 4x either way.
+const (
+	MinCalibrationSamples = 3
+	maxCalibrationFactor  = 4.0
+)
+
+// estimateCounts accumulates estimated and actual output sizes for one
+// source codec, encoder and preset
+type estimateCounts struct {
+	SourceCodec  string  `json:"source_codec"`
+	Encoder      string  `json:"encoder"`
+	PresetID     string  `json:"preset_id"`
+	Samples      int     `json:"samples"`
+	EstimatedSum int64   `json:"estimated_sum"`
+	ActualSum    int64   `json:"actual_sum"`
+	ErrorPctSum  float64 `json:"error_pct_sum"` // Sum of |actual - estimate| / estimate * 100
+	BiasPctSum   float64 `json:"bias_pct_sum"`  // Sum of (actual - estimate) / estimate * 100
+}
+
+// EstimateCalibration is how far estimates were off for one source codec,
+// encoder and preset, and the factor applied to correct them
+type EstimateCalibration struct {
+	SourceCodec     string  `json:"source_codec"`
+	Encoder         string  `json:"encoder"`
+	PresetID        string  `json:"preset_id"`
+	Samples         int     `json:"samples"`           // Finished jobs with an estimate
+	AvgErrorPercent float64 `json:"avg_error_percent"` // Mean absolute error of the uncalibrated estimate
+	AvgBiasPercent  float64 `json:"avg_bias_percent"`  // Mean signed error; positive = outputs came out larger
+	Factor          float64 `json:"factor"`            // Actual / estimated size over all samples
+	Applied         bool    `json:"applied"`           // Factor is used by new estimates (MinCalibrationSamples reached)
+}
+
+// EstimateStats persists how finished jobs' output sizes compared with
+// their estimates, and calibrates ffmpeg.EstimateTranscode from them
+type EstimateStats struct {
+	mu       sync.Mutex
+	counts   map[ffmpeg.CalibrationKey]*estimateCounts
+	filePath string
+}
+
+// NewEstimateStats loads estimate stats from filePath, or starts empty if it
+// doesn't exist, and applies their calibration
+func NewEstimateStats(filePath string) (*EstimateStats, error) {
+	e := &EstimateStats{
+		counts:   make(map[ffmpeg.CalibrationKey]*estimateCounts),
+		filePath: filePath,
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		var list []*estimateCounts
+		if err := json.Unmarshal(data, &list); err != nil {
+			return nil, err
+		}
+		for _, c := range list {
+			e.counts[c.key()] = c
+		}
+	}
+	e.applyLocked()
+	return e, nil
+}
+
+func (c *estimateCounts) key() ffmpeg.CalibrationKey {
+	return ffmpeg.CalibrationKey{SourceCodec: c.SourceCodec, Encoder: c.Encoder, PresetID: c.PresetID}
+}
+
+// Backfill records the finished jobs in jobs if there are no stats yet
+func (e *EstimateStats) Backfill(jobs []*Job) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if len(e.counts) > 0 {
+		return
+	}
+	for _, job := range jobs {
+		e.recordLocked(job)
+	}
+	if len(e.counts) > 0 {
+		e.applyLocked()
+		e.save()
+	}
+}
+
+// Record adds a finished job's actual output size. Jobs without an
+// estimate, or encoded to a target size, are ignored.
+func (e *EstimateStats) Record(job *Job) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.recordLocked(job) {
+		e.applyLocked()
+		e.save()
+	}
+}
+
+// recordLocked adds job to its counts, reporting whether it was counted.
+// Must hold e.mu.
+func (e *EstimateStats) recordLocked(job *Job) bool {
+	var actual int64
+	switch job.Status {
+	case StatusComplete:
+		actual = job.OutputSize
+	case StatusNoGain:
+		actual = job.AttemptedSize
+	}
+	if actual <= 0 || job.EstimatedSize <= 0 || job.TargetSizeMB > 0 {
+		return false
+	}
+
+	key := ffmpeg.CalibrationKey{SourceCodec: job.VideoCodec, Encoder: job.Encoder, PresetID: job.PresetID}
+	c, ok := e.counts[key]
+	if !ok {
+		c = &estimateCounts{SourceCodec: key.SourceCodec, Encoder: key.Encoder, PresetID: key.PresetID}
+		e.counts[key] = c
+	}
+	diff := float64(actual-job.EstimatedSize) / float64(job.EstimatedSize) * 100
+	c.Samples++
+	c.EstimatedSum += job.EstimatedSize
+	c.ActualSum += actual
+	c.ErrorPctSum += math.Abs(diff)
+	c.BiasPctSum += diff
+	return true
+}
+
+// factor is the calibration factor c supports, or 0 if too few jobs do
+func (c *estimateCounts) factor() float64 {
+	if c.Samples < MinCalibrationSamples || c.EstimatedSum <= 0 {
+		return 0
+	}
+	return math.Max(1/maxCalibrationFactor, math.Min(maxCalibrationFactor, float64(c.ActualSum)/float64(c.EstimatedSum)))
+}
+
+// applyLocked hands the current factors to ffmpeg. Must hold e.mu.
+func (e *EstimateStats) applyLocked() {
+	factors := make(map[ffmpeg.CalibrationKey]float64, len(e.counts))
+	for key, c := range e.counts {
+		if f := c.factor(); f > 0 {
+			factors[key] = f
+		}
+	}
+	ffmpeg.SetEstimateCalibration(factors)
+}
+
+// Calibration returns the estimate error and factor of each source codec,
+// encoder and preset seen, sorted by preset, encoder and codec
+func (e *EstimateStats) Calibration() []EstimateCalibration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	result := make([]EstimateCalibration, 0, len(e.counts))
+	for _, c := range e.counts {
+		cal := EstimateCalibration{
+			SourceCodec: c.SourceCodec,
+			Encoder:     c.Encoder,
+			PresetID:    c.PresetID,
+			Samples:     c.Samples,
+		}
+		if c.Samples > 0 {
+			cal.AvgErrorPercent = c.ErrorPctSum / float64(c.Samples)
+			cal.AvgBiasPercent = c.BiasPctSum / float64(c.Samples)
+		}
+		if c.EstimatedSum > 0 {
+			cal.Factor = float64(c.ActualSum) / float64(c.EstimatedSum)
+		}
+		cal.Applied = c.factor() > 0
+		result = append(result, cal)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.PresetID != b.PresetID {
+			return a.PresetID < b.PresetID
+		}
+		if a.Encoder != b.Encoder {
+			return a.Encoder < b.Encoder
+		}
+		return a.SourceCodec < b.SourceCodec
+	})
+	return result
+}
+
+// Watch records jobs as the queue finishes them until ctx is done
+func (e *EstimateStats) Watch(ctx context.Context, q *Queue) {
+	events := q.Subscribe()
+	go func() {
+		defer q.Unsubscribe(events)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event := <-events:
+				switch event.Type {
+				case "complete", "no_gain":
+					if event.Job != nil {
+						e.Record(event.Job)
+					}
+				}
+			}
+		}
+	}()
+}
+
+// save writes the stats to disk. Must hold e.mu.
+func (e *EstimateStats) save() {
+	list := make([]*estimateCounts, 0, len(e.counts))
+	for _, c := range e.counts {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].PresetID+list[i].Encoder+list[i].SourceCodec < list[j].PresetID+list[j].Encoder+list[j].SourceCodec
+	})
+	if err := saveJSON(e.filePath, list); err != nil {
+		estimatesLog.Warn("Failed to save estimate stats", "error", err)
+	}
+}
+
+// estimatedSize is the midpoint of the uncalibrated estimate for encoding
+// probe with preset, or 0 if it can't be estimated
+func estimatedSize(probe *ffmpeg.ProbeResult, preset *ffmpeg.Preset) int64 {
+	est := ffmpeg.UncalibratedEstimate(probe, preset)
+	if est == nil {
+		return 0
+	}
+	return (est.MinSize + est.MaxSize) / 2
+}
@@ -0,0 +1,53 @@
+package jobs
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/ffmpeg"
+)
+
+func TestEstimateStatsCalibration(t *testing.T) {
+	t.Cleanup(func() { ffmpeg.SetEstimateCalibration(nil) })
+	filePath := filepath.Join(t.TempDir(), "estimates.json")
+	stats, err := NewEstimateStats(filePath)
+	if err != nil {
+		t.Fatalf("NewEstimateStats: %v", err)
+	}
+
+	job := func(status Status, estimated, actual int64) *Job {
+		j := &Job{PresetID: "compress-hevc", Encoder: "vaapi", VideoCodec: "h264", Status: status, EstimatedSize: estimated, OutputSize: actual}
+		if status == StatusNoGain {
+			j.OutputSize, j.AttemptedSize = 0, actual
+		}
+		return j
+	}
+	stats.Record(job(StatusComplete, 1000, 1200))
+	stats.Record(job(StatusComplete, 1000, 1400))
+	stats.Record(job(StatusFailed, 1000, 0))                                                                 // Ignored
+	stats.Record(&Job{PresetID: "compress-hevc", Encoder: "vaapi", Status: StatusComplete, OutputSize: 500}) // No estimate
+
+	cal := stats.Calibration()
+	if len(cal) != 1 || cal[0].Samples != 2 || cal[0].Applied {
+		t.Fatalf("expected 2 samples not yet applied, got %+v", cal)
+	}
+
+	stats.Record(job(StatusNoGain, 1000, 1600))
+
+	// Reloading keeps the counts and applies them
+	ffmpeg.SetEstimateCalibration(nil)
+	if stats, err = NewEstimateStats(filePath); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	cal = stats.Calibration()
+	if len(cal) != 1 || cal[0].Samples != 3 || !cal[0].Applied || cal[0].Factor != 1.4 || cal[0].AvgErrorPercent != 40 || cal[0].AvgBiasPercent != 40 {
+		t.Fatalf("expected 3 samples, applied with factor 1.4 and 40%% error, got %+v", cal)
+	}
+
+	preset := &ffmpeg.Preset{ID: "compress-hevc", Encoder: ffmpeg.HWAccelVAAPI, Codec: ffmpeg.CodecHEVC}
+	probe := &ffmpeg.ProbeResult{Duration: 100 * time.Second, Bitrate: 10_000_000, VideoCodec: "h264"}
+	if est := ffmpeg.EstimateTranscode(probe, preset); est == nil || est.Calibration != 1.4 {
+		t.Errorf("expected estimates calibrated by 1.4, got %+v", est)
+	}
+}
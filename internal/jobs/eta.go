@@ -0,0 +1,236 @@
+package jobs
+
+import (
+	"strings"
+	"time"
+)
+
+// speedWindow is how many recent completed jobs per encoder (and per
+// encoder and resolution) the average encode speed is taken over
+const speedWindow = 20
+
+// defaultSpeed is assumed with no speed history at all (1.0 = realtime)
+const defaultSpeed = 1.0
+
+// speedSettleProgress is the progress percentage from which a running
+// encode's own speed is trusted alone. Before that it's blended with the
+// encoder's history, since ffmpeg's speed swings widely as an encode starts.
+const speedSettleProgress = 15.0
+
+// encodeSpeeds keeps the encode speeds (video seconds per wall-clock
+// second) of recently completed jobs, keyed by encoder and by encoder and
+// resolution (see speedKey), guarded by q.mu
+type encodeSpeeds map[string][]float64
+
+// speedKey keys speeds by encoder and resolution class, e.g. "vaapi@1080";
+// it returns "" when the height isn't known
+func speedKey(encoder string, height int) string {
+	var class string
+	switch {
+	case height <= 0:
+		return ""
+	case height <= 576:
+		class = "sd"
+	case height <= 720:
+		class = "720"
+	case height <= 1080:
+		class = "1080"
+	case height <= 1440:
+		class = "1440"
+	default:
+		class = "2160"
+	}
+	return encoder + "@" + class
+}
+
+// record adds a completed job's speed
+func (s encodeSpeeds) record(job *Job) {
+	elapsed := job.CompletedAt.Sub(job.StartedAt).Seconds()
+	if job.Duration <= 0 || elapsed <= 0 || job.StartedAt.IsZero() {
+		return
+	}
+	speed := float64(job.Duration) / 1000 / elapsed
+	s.add(job.Encoder, speed)
+	if key := speedKey(job.Encoder, job.Height); key != "" {
+		s.add(key, speed)
+	}
+}
+
+// clone copies s for saving
+func (s encodeSpeeds) clone() encodeSpeeds {
+	c := make(encodeSpeeds, len(s))
+	for key, speeds := range s {
+		c[key] = append([]float64(nil), speeds...)
+	}
+	return c
+}
+
+func (s encodeSpeeds) add(key string, speed float64) {
+	speeds := append(s[key], speed)
+	if len(speeds) > speedWindow {
+		speeds = speeds[len(speeds)-speedWindow:]
+	}
+	s[key] = speeds
+}
+
+// lookup returns the rolling average speed of encoder at height and what
+// it's based on: "history" for the encoder at that resolution, falling back
+// to "encoder" at any resolution and then to "any" encoder. basis is ""
+// with no history at all.
+func (s encodeSpeeds) lookup(encoder string, height int) (speed float64, basis string) {
+	if speeds := s[speedKey(encoder, height)]; len(speeds) > 0 {
+		return mean(speeds), "history"
+	}
+	if speeds := s[encoder]; len(speeds) > 0 {
+		return mean(speeds), "encoder"
+	}
+	var all []float64
+	for key, speeds := range s {
+		if !strings.Contains(key, "@") {
+			all = append(all, speeds...)
+		}
+	}
+	if len(all) > 0 {
+		return mean(all), "any"
+	}
+	return 0, ""
+}
+
+// blendedSpeed is the speed a running job is expected to keep up: its own
+// reported speed, weighted against its encoder's history until it reaches
+// speedSettleProgress. Must hold q.mu.
+func (q *Queue) blendedSpeed(job *Job) float64 {
+	history, basis := q.speeds.lookup(job.Encoder, job.Height)
+	if job.Speed <= 0 {
+		if basis == "" {
+			return defaultSpeed
+		}
+		return history
+	}
+	if basis == "" {
+		return job.Speed
+	}
+	weight := min(1, job.Progress/speedSettleProgress)
+	return weight*job.Speed + (1-weight)*history
+}
+
+// remainingSeconds is how long a running job should take to finish at its
+// blended speed, or 0 if its duration isn't known. Must hold q.mu.
+func (q *Queue) remainingSeconds(job *Job) float64 {
+	if job.Duration <= 0 {
+		return 0
+	}
+	return float64(job.Duration) / 1000 * (100 - job.Progress) / 100 / q.blendedSpeed(job)
+}
+
+// jobSeconds is how long job should still take to encode, and what that's
+// based on: "running" for a running job at its blended speed, otherwise
+// the basis of its encoder's speed from lookup, or "default". Jobs not
+// probed yet are assumed to be avgDuration milliseconds long. Must hold q.mu.
+func (q *Queue) jobSeconds(job *Job, avgDuration float64) (float64, string) {
+	if job.Status == StatusRunning {
+		return q.remainingSeconds(job), "running"
+	}
+	duration := float64(job.Duration)
+	if duration <= 0 {
+		duration = avgDuration
+	}
+	speed, basis := q.speeds.lookup(job.Encoder, job.Height)
+	if basis == "" {
+		speed, basis = defaultSpeed, "default"
+	}
+	return duration / 1000 / speed, basis
+}
+
+// averageDuration is the mean duration in milliseconds of the probed jobs
+// in the queue, or 0 if there are none. Must hold q.mu.
+func (q *Queue) averageDuration() float64 {
+	var total, known int64
+	for _, job := range q.jobs {
+		if job.Duration > 0 {
+			total += job.Duration
+			known++
+		}
+	}
+	if known == 0 {
+		return 0
+	}
+	return float64(total) / float64(known)
+}
+
+func mean(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// SetWorkers tells the queue how many local workers run jobs, for the ETA
+// in Stats. The worker pool keeps it up to date.
+func (q *Queue) SetWorkers(n int) {
+	q.workers.Store(int64(n))
+}
+
+// estimateRemaining returns how long until every queued and running job is
+// done, in seconds: running jobs finish at their current speed, and waiting
+// jobs are handed in queue order to whichever worker frees up first,
+// taking as long as jobSeconds says. Must hold q.mu.
+func (q *Queue) estimateRemaining() float64 {
+	var running []float64
+	var waiting []*Job
+	for _, id := range q.order {
+		job, ok := q.jobs[id]
+		if !ok {
+			continue
+		}
+		switch job.Status {
+		case StatusRunning:
+			running = append(running, q.remainingSeconds(job))
+		case StatusPendingProbe, StatusPending, StatusWaitingDisk:
+			waiting = append(waiting, job)
+		}
+	}
+	if len(running) == 0 && len(waiting) == 0 {
+		return 0
+	}
+
+	// Each lane is a worker, busy until the time it holds. Remote agents'
+	// jobs get lanes of their own but take no new work here.
+	workers := int(q.workers.Load())
+	if workers < 1 {
+		workers = 1
+	}
+	lanes := make([]float64, max(workers, len(running)))
+	copy(lanes, running)
+
+	avgDuration := q.averageDuration()
+	for _, job := range waiting {
+		encode, _ := q.jobSeconds(job, avgDuration)
+
+		free := 0
+		for i := range lanes[:workers] {
+			if lanes[i] < lanes[free] {
+				free = i
+			}
+		}
+		lanes[free] += encode
+	}
+
+	var longest float64
+	for _, t := range lanes {
+		longest = max(longest, t)
+	}
+	return longest
+}
+
+// setETA fills in the stats' ETA from estimateRemaining. Must hold q.mu.
+func (q *Queue) setETA(stats *Stats) {
+	remaining := q.estimateRemaining()
+	if remaining <= 0 {
+		return
+	}
+	stats.ETASeconds = int64(remaining)
+	completion := time.Now().Add(time.Duration(remaining * float64(time.Second)))
+	stats.EstimatedCompletion = &completion
+}
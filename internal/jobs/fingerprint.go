@@ -0,0 +1,148 @@
+package jobs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fingerprintChunk is how much of each end of a file is hashed
+const fingerprintChunk = 1 << 20
+
+// Fingerprint identifies a file's content without reading all of it: its
+// size and a SHA-256 of its first and last MiB. It survives the renames and
+// moves Sonarr/Radarr make, so a processed file is still recognized at its
+// new path.
+func Fingerprint(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	size := info.Size()
+
+	h := sha256.New()
+	if _, err := io.CopyN(h, f, min(size, fingerprintChunk)); err != nil {
+		return "", err
+	}
+	if size > 2*fingerprintChunk {
+		if _, err := f.Seek(-fingerprintChunk, io.SeekEnd); err != nil {
+			return "", err
+		}
+		if _, err := io.CopyN(h, f, fingerprintChunk); err != nil {
+			return "", err
+		}
+	} else if size > fingerprintChunk {
+		if _, err := io.Copy(h, f); err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("%d:%s", size, hex.EncodeToString(h.Sum(nil))), nil
+}
+
+// fingerprintSize returns the size recorded in a fingerprint
+func fingerprintSize(fingerprint string) int64 {
+	sizeStr, _, _ := strings.Cut(fingerprint, ":")
+	size, _ := strconv.ParseInt(sizeStr, 10, 64)
+	return size
+}
+
+// RecordFingerprints fingerprints paths and remembers them as processed, so
+// RecognizeProcessed finds them after a rename. Files are read outside the
+// queue lock.
+func (q *Queue) RecordFingerprints(paths []string) {
+	fingerprints := make([]string, 0, len(paths))
+	for _, path := range paths {
+		fp, err := Fingerprint(path)
+		if err != nil {
+			queueLog.Warn("Could not fingerprint", "path", path, "error", err)
+			continue
+		}
+		fingerprints = append(fingerprints, fp)
+	}
+	if len(fingerprints) == 0 {
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	for _, fp := range fingerprints {
+		q.processedFingerprints[fp] = now
+	}
+	if err := q.save(); err != nil {
+		queueLog.Warn("Failed to persist queue", "error", err)
+	}
+}
+
+// RecognizeProcessed checks files (path → size) that aren't processed paths
+// against the recorded fingerprints and records the matches as processed.
+// Only files whose size matches a fingerprint are read. Returns the paths
+// recognized.
+func (q *Queue) RecognizeProcessed(files map[string]int64) []string {
+	q.mu.RLock()
+	sizes := make(map[int64]struct{}, len(q.processedFingerprints))
+	for fp := range q.processedFingerprints {
+		sizes[fingerprintSize(fp)] = struct{}{}
+	}
+	candidates := make([]string, 0)
+	for path, size := range files {
+		if _, ok := sizes[size]; !ok {
+			continue
+		}
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			absPath = path
+		}
+		if _, ok := q.processedPaths[absPath]; ok {
+			continue
+		}
+		candidates = append(candidates, path)
+	}
+	q.mu.RUnlock()
+
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	matches := make(map[string]string, len(candidates))
+	for _, path := range candidates {
+		fp, err := Fingerprint(path)
+		if err != nil {
+			continue
+		}
+		matches[path] = fp
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	recognized := make([]string, 0, len(matches))
+	for path, fp := range matches {
+		processedAt, ok := q.processedFingerprints[fp]
+		if !ok {
+			continue
+		}
+		q.recordProcessedPathLocked(path, processedAt)
+		recognized = append(recognized, path)
+		queueLog.Info("Recognized as already processed by its content", "path", path)
+	}
+	if len(recognized) > 0 {
+		if err := q.save(); err != nil {
+			queueLog.Warn("Failed to persist queue", "error", err)
+		}
+	}
+	return recognized
+}
@@ -0,0 +1,92 @@
+package jobs
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// Large enough that the middle isn't hashed
+	content := bytes.Repeat([]byte("a"), 3*fingerprintChunk)
+	original := filepath.Join(tmpDir, "a.mkv")
+	if err := os.WriteFile(original, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	fp, err := Fingerprint(original)
+	if err != nil {
+		t.Fatalf("Fingerprint: %v", err)
+	}
+	if fingerprintSize(fp) != int64(len(content)) {
+		t.Errorf("fingerprint %s doesn't record the size %d", fp, len(content))
+	}
+
+	// Same head and tail: same fingerprint
+	middle := bytes.Clone(content)
+	middle[len(middle)/2] = 'b'
+	changedMiddle := filepath.Join(tmpDir, "b.mkv")
+	if err := os.WriteFile(changedMiddle, middle, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if other, _ := Fingerprint(changedMiddle); other != fp {
+		t.Errorf("fingerprint changed with only the middle: %s vs %s", other, fp)
+	}
+
+	// Different tail: different fingerprint
+	tail := bytes.Clone(content)
+	tail[len(tail)-1] = 'b'
+	changedTail := filepath.Join(tmpDir, "c.mkv")
+	if err := os.WriteFile(changedTail, tail, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if other, _ := Fingerprint(changedTail); other == fp {
+		t.Error("expected a different fingerprint when the end of the file differs")
+	}
+}
+
+func TestQueueRecognizesRenamedProcessedFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	queueFile := filepath.Join(tmpDir, "queue.json")
+	outputPath := filepath.Join(tmpDir, "Show.S01E01.mkv")
+	if err := os.WriteFile(outputPath, []byte("transcoded episode"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	other := filepath.Join(tmpDir, "Other.mkv")
+	if err := os.WriteFile(other, []byte("unrelated episode!"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	queue, _ := NewQueue(queueFile)
+	queue.MarkProcessedPaths([]string{outputPath})
+	queue.RecordFingerprints([]string{outputPath})
+
+	// Sonarr renames the file
+	renamed := filepath.Join(tmpDir, "Show - S01E01 - Pilot.mkv")
+	if err := os.Rename(outputPath, renamed); err != nil {
+		t.Fatal(err)
+	}
+
+	// Fingerprints survive a restart
+	queue, err := NewQueue(queueFile)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if _, ok := queue.ProcessedPaths()[renamed]; ok {
+		t.Fatal("renamed file shouldn't be processed by path")
+	}
+
+	recognized := queue.RecognizeProcessed(map[string]int64{renamed: 18, other: 18})
+	if len(recognized) != 1 || recognized[0] != renamed {
+		t.Fatalf("RecognizeProcessed = %v, want only %s", recognized, renamed)
+	}
+	if _, ok := queue.ProcessedPaths()[renamed]; !ok {
+		t.Error("recognized file should now be processed by path")
+	}
+
+	if queue.ClearProcessedHistory(); len(queue.RecognizeProcessed(map[string]int64{renamed: 18})) != 0 {
+		t.Error("clearing the processed history should forget fingerprints")
+	}
+}
@@ -0,0 +1,201 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/logger"
+)
+
+var historyLog = logger.For("history")
+
+// historyDateFormat keys daily aggregates by local calendar day
+const historyDateFormat = "2006-01-02"
+
+// DailyStats aggregates the jobs completed on one day
+type DailyStats struct {
+	Date             string             `json:"date"` // YYYY-MM-DD, local time
+	JobsCompleted    int                `json:"jobs_completed"`
+	InputBytes       int64              `json:"input_bytes"`
+	OutputBytes      int64              `json:"output_bytes"`
+	BytesSaved       int64              `json:"bytes_saved"`
+	CompressionRatio float64            `json:"compression_ratio"` // OutputBytes / InputBytes, 0 if nothing completed
+	EncodeHours      map[string]float64 `json:"encode_hours"`      // By encoder ("vaapi", "none", ...)
+	EnergyKWh        float64            `json:"energy_kwh,omitempty"`
+	EnergyCost       float64            `json:"energy_cost,omitempty"`
+}
+
+// History persists daily aggregates of completed jobs, so savings over time
+// survive the queue being cleared
+type History struct {
+	mu       sync.Mutex
+	days     map[string]*DailyStats // By date
+	filePath string
+}
+
+// NewHistory loads the history from filePath, or starts empty if it doesn't exist
+func NewHistory(filePath string) (*History, error) {
+	h := &History{
+		days:     make(map[string]*DailyStats),
+		filePath: filePath,
+	}
+
+	data, err := os.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var days []*DailyStats
+	if err := json.Unmarshal(data, &days); err != nil {
+		return nil, err
+	}
+	for _, d := range days {
+		if d.EncodeHours == nil {
+			d.EncodeHours = make(map[string]float64)
+		}
+		h.days[d.Date] = d
+	}
+	return h, nil
+}
+
+// Backfill records the completed jobs in jobs if the history is empty, so
+// upgrading doesn't start the charts from zero
+func (h *History) Backfill(jobs []*Job) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.days) > 0 {
+		return
+	}
+	for _, job := range jobs {
+		if job.Status == StatusComplete {
+			h.recordLocked(job)
+		}
+	}
+	if len(h.days) > 0 {
+		h.save()
+	}
+}
+
+// Record adds a completed job to its day's aggregate
+func (h *History) Record(job *Job) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.recordLocked(job)
+	h.save()
+}
+
+// recordLocked adds job to the aggregate for its completion day. Must hold h.mu.
+func (h *History) recordLocked(job *Job) {
+	completedAt := job.CompletedAt
+	if completedAt.IsZero() {
+		completedAt = time.Now()
+	}
+	date := completedAt.Local().Format(historyDateFormat)
+	day, ok := h.days[date]
+	if !ok {
+		day = &DailyStats{Date: date, EncodeHours: make(map[string]float64)}
+		h.days[date] = day
+	}
+
+	day.JobsCompleted++
+	day.InputBytes += job.InputSize
+	day.OutputBytes += job.OutputSize
+	day.BytesSaved += job.SpaceSaved
+	day.EnergyKWh += job.EnergyKWh
+	day.EnergyCost += job.EnergyCost
+	if day.InputBytes > 0 {
+		day.CompressionRatio = float64(day.OutputBytes) / float64(day.InputBytes)
+	}
+	if job.TranscodeTime > 0 {
+		encoder := job.Encoder
+		if encoder == "" {
+			encoder = "unknown"
+		}
+		day.EncodeHours[encoder] += float64(job.TranscodeTime) / 3600
+	}
+}
+
+// Days returns the aggregates for the last n days up to today, oldest
+// first. Days without completed jobs are included with zero values so the
+// series can be charted directly.
+func (h *History) Days(n int) []DailyStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	today := time.Now()
+	result := make([]DailyStats, 0, n)
+	for i := n - 1; i >= 0; i-- {
+		date := today.AddDate(0, 0, -i).Format(historyDateFormat)
+		day, ok := h.days[date]
+		if !ok {
+			result = append(result, DailyStats{Date: date, EncodeHours: map[string]float64{}})
+			continue
+		}
+		copied := *day
+		copied.EncodeHours = make(map[string]float64, len(day.EncodeHours))
+		for encoder, hours := range day.EncodeHours {
+			copied.EncodeHours[encoder] = hours
+		}
+		result = append(result, copied)
+	}
+	return result
+}
+
+// Watch records jobs as the queue completes them until ctx is done
+func (h *History) Watch(ctx context.Context, q *Queue) {
+	events := q.Subscribe()
+	go func() {
+		defer q.Unsubscribe(events)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event := <-events:
+				if event.Type == "complete" && event.Job != nil {
+					h.Record(event.Job)
+				}
+			}
+		}
+	}()
+}
+
+// save writes the history to disk. Must hold h.mu.
+func (h *History) save() {
+	days := make([]*DailyStats, 0, len(h.days))
+	for _, d := range h.days {
+		days = append(days, d)
+	}
+	sort.Slice(days, func(i, j int) bool {
+		return days[i].Date < days[j].Date
+	})
+
+	if err := saveJSON(h.filePath, days); err != nil {
+		historyLog.Warn("Failed to save stats history", "error", err)
+	}
+}
+
+// saveJSON writes v to path as indented JSON, via a temp file and rename
+func saveJSON(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
@@ -0,0 +1,83 @@
+package jobs
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHistoryRecordsDailyAggregates(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "stats_history.json")
+	history, err := NewHistory(filePath)
+	if err != nil {
+		t.Fatalf("NewHistory: %v", err)
+	}
+
+	now := time.Now()
+	yesterday := now.AddDate(0, 0, -1)
+	history.Backfill([]*Job{
+		{Status: StatusComplete, Encoder: "vaapi", InputSize: 1000, OutputSize: 400, SpaceSaved: 600, TranscodeTime: 1800, CompletedAt: yesterday},
+		{Status: StatusFailed, Encoder: "vaapi", InputSize: 1000, CompletedAt: yesterday},
+	})
+	history.Record(&Job{Status: StatusComplete, Encoder: "none", InputSize: 1000, OutputSize: 600, SpaceSaved: 400, TranscodeTime: 3600, CompletedAt: now})
+	history.Record(&Job{Status: StatusComplete, Encoder: "none", InputSize: 1000, OutputSize: 400, SpaceSaved: 600, TranscodeTime: 3600, CompletedAt: now})
+
+	// A second backfill is ignored once there is history
+	history.Backfill([]*Job{{Status: StatusComplete, InputSize: 1, CompletedAt: now}})
+
+	// Reloading keeps the aggregates
+	history, err = NewHistory(filePath)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	days := history.Days(3)
+	if len(days) != 3 {
+		t.Fatalf("Days(3) returned %d days, want 3", len(days))
+	}
+	if days[0].JobsCompleted != 0 || days[0].EncodeHours == nil {
+		t.Errorf("empty day = %+v, want zero values", days[0])
+	}
+	if days[1].JobsCompleted != 1 || days[1].BytesSaved != 600 || days[1].EncodeHours["vaapi"] != 0.5 {
+		t.Errorf("yesterday = %+v, want 1 job / 600 bytes / 0.5 vaapi hours", days[1])
+	}
+	today := days[2]
+	if today.JobsCompleted != 2 || today.BytesSaved != 1000 || today.CompressionRatio != 0.5 || today.EncodeHours["none"] != 2 {
+		t.Errorf("today = %+v, want 2 jobs / 1000 bytes / ratio 0.5 / 2 software hours", today)
+	}
+}
+
+func TestHistoryWatchRecordsCompletions(t *testing.T) {
+	dir := t.TempDir()
+	queue, err := NewQueue(filepath.Join(dir, "queue.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	history, err := NewHistory(filepath.Join(dir, "stats_history.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	history.Watch(ctx, queue)
+
+	job, err := queue.AddWithoutProbe(filepath.Join(dir, "movie.mkv"), "compress-hevc", 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue.StartJob(job.ID, "", "")
+	queue.CompleteJob(job.ID, filepath.Join(dir, "movie.mkv"), 300)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if days := history.Days(1); days[0].JobsCompleted == 1 {
+			if days[0].BytesSaved != 700 {
+				t.Errorf("bytes saved = %d, want 700", days[0].BytesSaved)
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("completion was not recorded")
+}
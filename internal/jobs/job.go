@@ -2,6 +2,8 @@ package jobs
 
 import (
 	"time"
+
+	"github.com/gwlsn/shrinkray/internal/ffmpeg"
 )
 
 // Status represents the current state of a job
@@ -14,44 +16,80 @@ const (
 	StatusComplete     Status = "complete"
 	StatusFailed       Status = "failed"
 	StatusCancelled    Status = "cancelled"
-	StatusSkipped      Status = "skipped"  // File already in target format or meets criteria
-	StatusNoGain       Status = "no_gain"  // Transcoded file was larger than original
+	StatusSkipped      Status = "skipped"       // File already in target format or meets criteria
+	StatusNoGain       Status = "no_gain"       // Transcoded file was larger than original
+	StatusWaitingDisk  Status = "waiting_disk"  // Not enough free disk space to start
+	StatusVerifyFailed Status = "verify_failed" // Output was truncated or corrupt; original kept
 )
 
 // Job represents a transcoding job
 type Job struct {
-	ID             string    `json:"id"`
-	InputPath      string    `json:"input_path"`
-	OutputPath     string    `json:"output_path,omitempty"` // Set after completion
-	TempPath       string    `json:"temp_path,omitempty"`   // Temp file during transcode
-	PresetID       string    `json:"preset_id"`
-	Encoder        string    `json:"encoder"`     // "videotoolbox", "nvenc", "none", etc.
-	IsHardware     bool      `json:"is_hardware"` // True if using hardware acceleration
-	Status         Status    `json:"status"`
-	Progress       float64   `json:"progress"` // 0-100
-	Speed          float64   `json:"speed"`    // Encoding speed (1.0 = realtime)
-	ETA            string    `json:"eta"`      // Human-readable ETA
-	Error          string    `json:"error,omitempty"`
-	Stderr         string    `json:"stderr,omitempty"`      // Last ~64KB of ffmpeg stderr for diagnostics
-	ExitCode       int       `json:"exit_code,omitempty"`   // FFmpeg exit code (0 = success)
-	FFmpegArgs     []string  `json:"ffmpeg_args,omitempty"` // FFmpeg command arguments used
-	InputSize      int64     `json:"input_size"`
-	OutputSize     int64     `json:"output_size,omitempty"`    // Populated after completion
-	SpaceSaved     int64     `json:"space_saved,omitempty"`    // InputSize - OutputSize
-	Duration       int64     `json:"duration_ms,omitempty"`    // Video duration in ms
-	Bitrate        int64     `json:"bitrate,omitempty"`        // Source video bitrate in bits/s
-	BitDepth       int       `json:"bit_depth,omitempty"`      // Color bit depth (8, 10, 12)
-	PixFmt         string    `json:"pix_fmt,omitempty"`        // Pixel format (e.g., yuv420p, yuv444p)
-	VideoCodec     string    `json:"video_codec,omitempty"`    // Source video codec (e.g., h264, mpeg4, hevc)
-	TranscodeTime  int64     `json:"transcode_secs,omitempty"` // Time to transcode in seconds
-	CreatedAt      time.Time `json:"created_at"`
-	StartedAt      time.Time `json:"started_at,omitempty"`
-	CompletedAt    time.Time `json:"completed_at,omitempty"`
-	SubtitleCodecs []string  `json:"subtitle_codecs,omitempty"`
+	ID             string          `json:"id"`
+	InputPath      string          `json:"input_path"`
+	OutputPath     string          `json:"output_path,omitempty"` // Set after completion
+	TempPath       string          `json:"temp_path,omitempty"`   // Temp file during transcode
+	PresetID       string          `json:"preset_id"`
+	Encoder        string          `json:"encoder"`     // "videotoolbox", "nvenc", "none", etc.
+	IsHardware     bool            `json:"is_hardware"` // True if using hardware acceleration
+	Status         Status          `json:"status"`
+	Progress       float64         `json:"progress"` // 0-100
+	Speed          float64         `json:"speed"`    // Encoding speed (1.0 = realtime)
+	ETA            string          `json:"eta"`      // Human-readable ETA
+	Error          string          `json:"error,omitempty"`
+	Stderr         string          `json:"stderr,omitempty"`      // Last ~64KB of ffmpeg stderr for diagnostics
+	ExitCode       int             `json:"exit_code,omitempty"`   // FFmpeg exit code (0 = success)
+	FFmpegArgs     []string        `json:"ffmpeg_args,omitempty"` // FFmpeg command arguments used
+	InputSize      int64           `json:"input_size"`
+	InputModTime   time.Time       `json:"input_mod_time,omitempty"` // Source modification time when probed
+	EstimatedSize  int64           `json:"estimated_size,omitempty"` // Output size the uncalibrated estimate predicted, for calibration
+	Hardlinks      int             `json:"hardlinks,omitempty"`      // Hard links to the source when it has more than one
+	OutputSize     int64           `json:"output_size,omitempty"`    // Populated after completion
+	SpaceSaved     int64           `json:"space_saved,omitempty"`    // InputSize - OutputSize
+	AttemptedSize  int64           `json:"attempted_size,omitempty"` // Size of the output a no_gain job discarded
+	Duration       int64           `json:"duration_ms,omitempty"`    // Video duration in ms
+	Bitrate        int64           `json:"bitrate,omitempty"`        // Source video bitrate in bits/s
+	VideoBitrate   int64           `json:"video_bitrate,omitempty"`  // Of the video stream alone (see ffmpeg.SourceVideoBitrate)
+	BitDepth       int             `json:"bit_depth,omitempty"`      // Color bit depth (8, 10, 12)
+	Width          int             `json:"width,omitempty"`          // Source video width in pixels
+	Height         int             `json:"height,omitempty"`         // Source video height in pixels
+	Interlaced     bool            `json:"interlaced,omitempty"`     // Source field order is interlaced
+	PixFmt         string          `json:"pix_fmt,omitempty"`        // Pixel format (e.g., yuv420p, yuv444p)
+	VideoCodec     string          `json:"video_codec,omitempty"`    // Source video codec (e.g., h264, mpeg4, hevc)
+	HDR            *ffmpeg.HDRInfo `json:"hdr,omitempty"`            // HDR metadata, nil for SDR sources
+	TranscodeTime  int64           `json:"transcode_secs,omitempty"` // Time to transcode in seconds
+	CreatedAt      time.Time       `json:"created_at"`
+	StartedAt      time.Time       `json:"started_at,omitempty"`
+	CompletedAt    time.Time       `json:"completed_at,omitempty"`
+	SubtitleCodecs []string        `json:"subtitle_codecs,omitempty"`
+
+	// Per-track metadata from probe - languages, channel layouts and bitrates
+	AudioTracks    []ffmpeg.AudioTrack    `json:"audio_tracks,omitempty"`
+	SubtitleTracks []ffmpeg.SubtitleTrack `json:"subtitle_tracks,omitempty"`
+
+	// Chapters and attachments (e.g. subtitle fonts) in the source, checked
+	// against the output by verification
+	Chapters    int `json:"chapters,omitempty"`
+	Attachments int `json:"attachments,omitempty"`
+
+	// Energy the encode used and what it cost (energy.enabled), measured
+	// from the machine's counters or modeled from energy.watts
+	EnergyKWh      float64 `json:"energy_kwh,omitempty"`
+	EnergyCost     float64 `json:"energy_cost,omitempty"`
+	EnergyMeasured bool    `json:"energy_measured,omitempty"`
 
 	// Hardware path tracking - records decode → encode pipeline
 	HardwarePath string `json:"hardware_path,omitempty"` // e.g., "vaapi→vaapi", "cpu→vaapi", "cpu→cpu"
 
+	// CreatedBy is the ID of the user who queued the job (empty when auth is
+	// off or the job was queued automatically, e.g. by a scan or rule)
+	CreatedBy string `json:"created_by,omitempty"`
+
+	// BatchID groups the jobs queued by one request (see Batch)
+	BatchID string `json:"batch_id,omitempty"`
+
+	// Agent is the remote worker running the job (empty for local workers)
+	Agent string `json:"agent,omitempty"`
+
 	// Software fallback fields - populated when HW encoding fails and retries with SW
 	IsSoftwareFallback bool   `json:"is_software_fallback,omitempty"` // True if this job is a SW retry
 	OriginalJobID      string `json:"original_job_id,omitempty"`      // ID of the failed HW job
@@ -59,17 +97,50 @@ type Job struct {
 
 	// Force transcode fields - used when user wants to bypass skip/size checks
 	ForceTranscode bool `json:"force_transcode,omitempty"` // Bypass skip checks and size comparison
+
+	// User-editable fields - set via PATCH /api/jobs/{id}
+	Priority   int      `json:"priority,omitempty"`    // Higher runs first; ties keep queue order
+	Tags       []string `json:"tags,omitempty"`        // Free-form labels
+	Note       string   `json:"note,omitempty"`        // Free-form note
+	CustomArgs []string `json:"custom_args,omitempty"` // Extra video encoder options
+
+	// PreferredEncoder pins the job to an encoder instead of its preset's,
+	// if that encoder is available where the job runs
+	PreferredEncoder ffmpeg.HWAccel `json:"preferred_encoder,omitempty"`
+
+	// TargetSizeMB, if set, encodes at the bitrate that makes the output
+	// about this size instead of at a constant quality (two passes in software)
+	TargetSizeMB int `json:"target_size_mb,omitempty"`
+
+	// Threads caps the CPU threads a software encode uses, overriding the
+	// preset's preset_threads entry; 0 uses that
+	Threads int `json:"threads,omitempty"`
+
+	// Stalls counts the times the stall watchdog killed this job's encode
+	Stalls int `json:"stalls,omitempty"`
+
+	// Attempts are the earlier tries at this file that led to this job,
+	// oldest first (see Queue.Attempts)
+	Attempts []Attempt `json:"attempts,omitempty"`
+
+	// Timeline records the job's state changes, oldest first (see
+	// Queue.Timeline)
+	Timeline []TimelineEvent `json:"timeline,omitempty"`
+
+	// probe is the job's latest probe, kept in memory to re-check the skip
+	// rules and size estimate when its preset changes. nil after a restart.
+	probe *ffmpeg.ProbeResult
 }
 
 // IsTerminal returns true if the job is in a terminal state
 func (j *Job) IsTerminal() bool {
 	return j.Status == StatusComplete || j.Status == StatusFailed || j.Status == StatusCancelled ||
-		j.Status == StatusSkipped || j.Status == StatusNoGain
+		j.Status == StatusSkipped || j.Status == StatusNoGain || j.Status == StatusVerifyFailed
 }
 
 // IsWorkable returns true if the job can be picked up by a worker
 func (j *Job) IsWorkable() bool {
-	return j.Status == StatusPendingProbe || j.Status == StatusPending
+	return j.Status == StatusPendingProbe || j.Status == StatusPending || j.Status == StatusWaitingDisk
 }
 
 // NeedsProbe returns true if the job needs to be probed before processing
@@ -79,9 +150,20 @@ func (j *Job) NeedsProbe() bool {
 
 // JobEvent represents an event for SSE streaming
 type JobEvent struct {
-	Type string `json:"type"` // "added", "batch_added", "probed", "started", "progress", "complete", "failed", "cancelled", "removed", "skipped", "no_gain"
+	Type string `json:"type"` // "added", "batch_added", "probed", "started", "progress", "complete", "failed", "cancelled", "removed", "skipped", "no_gain", "verify_failed", "updated", "reordered", "encoders_changed", "batch_updated", "queue_held", "queue_released", "stalled"
 	Job  *Job   `json:"job,omitempty"`
 
+	// Reason is why the queue is held, for "queue_held" events
+	Reason string `json:"reason,omitempty"`
+
+	// ID increases with each event; a reconnecting stream resumes after it
+	ID uint64 `json:"id,omitempty"`
+
+	// BatchID is the batch of the event's job, if any; Batch is the batch
+	// itself for "batch_updated" events
+	BatchID string `json:"batch_id,omitempty"`
+	Batch   *Batch `json:"batch,omitempty"`
+
 	// Batch of jobs - used for "batch_added" event to reduce SSE event flood
 	// When adding many jobs at once, they are collected and sent in a single event
 	Jobs []*Job `json:"jobs,omitempty"`
@@ -89,6 +171,10 @@ type JobEvent struct {
 	// Lightweight progress update - used for "progress" event
 	// Avoids sending the full Job struct for every progress update
 	ProgressUpdate *ProgressUpdate `json:"progress_update,omitempty"`
+
+	// Latest progress of each running job that changed - used for
+	// "progress_batch" events (see Queue.SetProgressRate)
+	ProgressBatch []ProgressUpdate `json:"progress_batch,omitempty"`
 }
 
 // ProgressUpdate contains only the fields that change during transcoding.
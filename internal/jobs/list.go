@@ -0,0 +1,119 @@
+package jobs
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultPageSize is used when a page is requested without a size
+const DefaultPageSize = 100
+
+// MaxPageSize caps page_size on the jobs API
+const MaxPageSize = 1000
+
+// ListOptions filters, sorts and pages the job list
+type ListOptions struct {
+	Statuses []Status // Empty = any status
+	PresetID string   // Empty = any preset
+
+	// CreatedBy restricts the list to one user's jobs; empty = anyone's
+	CreatedBy string
+
+	// Sort is one of queue (default), created, name, size, saved, status or
+	// priority; a leading "-" sorts descending.
+	Sort string
+
+	// Page is 1-based; 0 returns every match
+	Page     int
+	PageSize int
+}
+
+// jobSorts are the supported sort keys, each comparing in ascending order
+var jobSorts = map[string]func(a, b *Job) bool{
+	"created": func(a, b *Job) bool { return a.CreatedAt.Before(b.CreatedAt) },
+	"name": func(a, b *Job) bool {
+		return strings.ToLower(filepath.Base(a.InputPath)) < strings.ToLower(filepath.Base(b.InputPath))
+	},
+	"size":     func(a, b *Job) bool { return a.InputSize < b.InputSize },
+	"saved":    func(a, b *Job) bool { return a.SpaceSaved < b.SpaceSaved },
+	"status":   func(a, b *Job) bool { return a.Status < b.Status },
+	"priority": func(a, b *Job) bool { return a.Priority < b.Priority },
+}
+
+// Validate checks the sort key and normalizes paging
+func (o *ListOptions) Validate() error {
+	key := strings.TrimPrefix(o.Sort, "-")
+	if key != "" && key != "queue" {
+		if _, ok := jobSorts[key]; !ok {
+			return fmt.Errorf("unknown sort %q", o.Sort)
+		}
+	}
+	if o.Page < 0 {
+		return fmt.Errorf("page must be at least 1")
+	}
+	if o.PageSize < 0 {
+		return fmt.Errorf("page_size must be positive")
+	}
+	if o.Page > 0 && o.PageSize == 0 {
+		o.PageSize = DefaultPageSize
+	}
+	if o.PageSize > MaxPageSize {
+		o.PageSize = MaxPageSize
+	}
+	return nil
+}
+
+// List returns the jobs matching opts and the number of matches before paging.
+// Options are expected to have been validated; an unknown sort keeps queue order.
+func (q *Queue) List(opts ListOptions) ([]*Job, int) {
+	all := q.GetAll()
+
+	statuses := make(map[Status]bool, len(opts.Statuses))
+	for _, s := range opts.Statuses {
+		statuses[s] = true
+	}
+
+	matched := make([]*Job, 0, len(all))
+	for _, job := range all {
+		if len(statuses) > 0 && !statuses[job.Status] {
+			continue
+		}
+		if opts.PresetID != "" && job.PresetID != opts.PresetID {
+			continue
+		}
+		if opts.CreatedBy != "" && job.CreatedBy != opts.CreatedBy {
+			continue
+		}
+		matched = append(matched, job)
+	}
+
+	desc := strings.HasPrefix(opts.Sort, "-")
+	if less, ok := jobSorts[strings.TrimPrefix(opts.Sort, "-")]; ok {
+		sort.SliceStable(matched, func(i, j int) bool {
+			if desc {
+				return less(matched[j], matched[i])
+			}
+			return less(matched[i], matched[j])
+		})
+	} else if desc {
+		for i, j := 0, len(matched)-1; i < j; i, j = i+1, j-1 {
+			matched[i], matched[j] = matched[j], matched[i]
+		}
+	}
+
+	total := len(matched)
+	if opts.Page > 0 && opts.PageSize > 0 {
+		start := (opts.Page - 1) * opts.PageSize
+		if start > total {
+			start = total
+		}
+		end := start + opts.PageSize
+		if end > total {
+			end = total
+		}
+		matched = matched[start:end]
+	}
+	return matched, total
+}
@@ -0,0 +1,150 @@
+package jobs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ProcessedEntry is one path in the processed history
+type ProcessedEntry struct {
+	Path        string    `json:"path"`
+	ProcessedAt time.Time `json:"processed_at"`
+}
+
+// ProcessedListOptions filters, sorts and pages the processed history
+type ProcessedListOptions struct {
+	// Search keeps paths containing this text, ignoring case
+	Search string
+
+	// Sort is path (default) or processed; a leading "-" sorts descending
+	Sort string
+
+	// Page is 1-based; 0 returns every match
+	Page     int
+	PageSize int
+}
+
+// processedSorts are the supported sort keys, each comparing in ascending order
+var processedSorts = map[string]func(a, b ProcessedEntry) bool{
+	"path":      func(a, b ProcessedEntry) bool { return a.Path < b.Path },
+	"processed": func(a, b ProcessedEntry) bool { return a.ProcessedAt.Before(b.ProcessedAt) },
+}
+
+// Validate checks the sort key and normalizes paging
+func (o *ProcessedListOptions) Validate() error {
+	if key := strings.TrimPrefix(o.Sort, "-"); key != "" {
+		if _, ok := processedSorts[key]; !ok {
+			return fmt.Errorf("unknown sort %q", o.Sort)
+		}
+	}
+	if o.Page < 0 {
+		return fmt.Errorf("page must be at least 1")
+	}
+	if o.PageSize < 0 {
+		return fmt.Errorf("page_size must be positive")
+	}
+	if o.Page > 0 && o.PageSize == 0 {
+		o.PageSize = DefaultPageSize
+	}
+	if o.PageSize > MaxPageSize {
+		o.PageSize = MaxPageSize
+	}
+	return nil
+}
+
+// ListProcessed returns the processed paths matching opts and the number of
+// matches before paging. Options are expected to have been validated.
+func (q *Queue) ListProcessed(opts ProcessedListOptions) ([]ProcessedEntry, int) {
+	search := strings.ToLower(opts.Search)
+
+	q.mu.RLock()
+	matched := make([]ProcessedEntry, 0, len(q.processedPaths))
+	for path, processedAt := range q.processedPaths {
+		if search != "" && !strings.Contains(strings.ToLower(path), search) {
+			continue
+		}
+		matched = append(matched, ProcessedEntry{Path: path, ProcessedAt: processedAt})
+	}
+	q.mu.RUnlock()
+
+	key := strings.TrimPrefix(opts.Sort, "-")
+	if key == "" {
+		key = "path"
+	}
+	less := processedSorts[key]
+	desc := strings.HasPrefix(opts.Sort, "-")
+	sort.Slice(matched, func(i, j int) bool {
+		if desc {
+			return less(matched[j], matched[i])
+		}
+		return less(matched[i], matched[j])
+	})
+
+	total := len(matched)
+	if opts.Page > 0 && opts.PageSize > 0 {
+		start := min((opts.Page-1)*opts.PageSize, total)
+		end := min(start+opts.PageSize, total)
+		matched = matched[start:end]
+	}
+	return matched, total
+}
+
+// UnmarkProcessed removes path, or every processed path under it when it's
+// a directory, from the processed history so the files can be queued
+// again. Their fingerprints are forgotten too, so they aren't recognized
+// by content. Returns the number of paths removed.
+func (q *Queue) UnmarkProcessed(path string) int {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		absPath = filepath.Clean(path)
+	}
+	dirPrefix := strings.TrimSuffix(absPath, string(filepath.Separator)) + string(filepath.Separator)
+
+	q.mu.RLock()
+	var matched []string
+	for processed := range q.processedPaths {
+		if processed == absPath || strings.HasPrefix(processed, dirPrefix) {
+			matched = append(matched, processed)
+		}
+	}
+	hasFingerprints := len(q.processedFingerprints) > 0
+	q.mu.RUnlock()
+
+	if len(matched) == 0 {
+		return 0
+	}
+
+	// Files are read outside the queue lock
+	var fingerprints []string
+	if hasFingerprints {
+		for _, processed := range matched {
+			if fp, err := Fingerprint(processed); err == nil {
+				fingerprints = append(fingerprints, fp)
+			} else if !os.IsNotExist(err) {
+				queueLog.Warn("Could not fingerprint", "path", processed, "error", err)
+			}
+		}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	removed := 0
+	for _, processed := range matched {
+		if _, ok := q.processedPaths[processed]; ok {
+			delete(q.processedPaths, processed)
+			removed++
+		}
+	}
+	for _, fp := range fingerprints {
+		delete(q.processedFingerprints, fp)
+	}
+	if err := q.save(); err != nil {
+		queueLog.Warn("Failed to persist queue", "error", err)
+	}
+	return removed
+}
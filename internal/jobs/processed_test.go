@@ -0,0 +1,57 @@
+package jobs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListProcessed(t *testing.T) {
+	queue, _ := NewQueue("")
+	queue.MarkProcessedPaths([]string{"/media/TV/Show/S01E02.mkv", "/media/Movies/Film.mkv", "/media/TV/Show/S01E01.mkv"})
+
+	all, total := queue.ListProcessed(ProcessedListOptions{})
+	if total != 3 || all[0].Path != "/media/Movies/Film.mkv" || all[2].Path != "/media/TV/Show/S01E02.mkv" {
+		t.Errorf("expected every path sorted, got %+v", all)
+	}
+
+	page, total := queue.ListProcessed(ProcessedListOptions{Search: "show", Sort: "-path", Page: 2, PageSize: 1})
+	if total != 2 || len(page) != 1 || page[0].Path != "/media/TV/Show/S01E01.mkv" {
+		t.Errorf("expected the second of two matches, got %d total %+v", total, page)
+	}
+
+	opts := ProcessedListOptions{Sort: "size"}
+	if err := opts.Validate(); err == nil {
+		t.Error("expected an unknown sort to be rejected")
+	}
+}
+
+func TestUnmarkProcessed(t *testing.T) {
+	tmpDir := t.TempDir()
+	show := filepath.Join(tmpDir, "Show")
+	if err := os.Mkdir(show, 0755); err != nil {
+		t.Fatal(err)
+	}
+	episode := filepath.Join(show, "S01E01.mkv")
+	if err := os.WriteFile(episode, []byte("episode"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sibling := filepath.Join(tmpDir, "Show 2", "S01E01.mkv")
+
+	queue, _ := NewQueue("")
+	queue.MarkProcessedPaths([]string{episode, filepath.Join(show, "S01E02.mkv"), sibling})
+	queue.RecordFingerprints([]string{episode})
+
+	if removed := queue.UnmarkProcessed(show + "/"); removed != 2 {
+		t.Errorf("expected both episodes under the folder removed, got %d", removed)
+	}
+	if _, total := queue.ListProcessed(ProcessedListOptions{}); total != 1 {
+		t.Errorf("a folder that only shares the prefix should be kept, %d left", total)
+	}
+	if recognized := queue.RecognizeProcessed(map[string]int64{episode: 7}); len(recognized) != 0 {
+		t.Errorf("unmarked file was recognized by its fingerprint: %v", recognized)
+	}
+	if removed := queue.UnmarkProcessed(episode); removed != 0 {
+		t.Errorf("expected nothing left to remove, got %d", removed)
+	}
+}
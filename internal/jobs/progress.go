@@ -0,0 +1,76 @@
+package jobs
+
+import (
+	"sync"
+	"time"
+)
+
+// progressBatcher collects progress updates and sends them as one
+// "progress_batch" event per interval, instead of an event per ffmpeg
+// progress line for every running job.
+type progressBatcher struct {
+	mu       sync.Mutex
+	interval time.Duration // 0 = send each update as a "progress" event
+	pending  map[string]ProgressUpdate
+	order    []string // Job IDs in pending, in the order first updated
+	timer    *time.Timer
+}
+
+// SetProgressRate limits progress to perSecond "progress_batch" events a
+// second across all jobs, each with the latest progress of every job that
+// changed. 0 or less sends every update as its own "progress" event.
+func (q *Queue) SetProgressRate(perSecond int) {
+	q.progress.mu.Lock()
+	defer q.progress.mu.Unlock()
+
+	if perSecond <= 0 {
+		q.progress.interval = 0
+		return
+	}
+	q.progress.interval = time.Second / time.Duration(perSecond)
+}
+
+// batchProgress queues update for the next batch, reporting false if
+// batching is off. Called with q.mu held.
+func (q *Queue) batchProgress(update ProgressUpdate) bool {
+	b := &q.progress
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.interval == 0 {
+		return false
+	}
+	if b.pending == nil {
+		b.pending = make(map[string]ProgressUpdate)
+	}
+	if _, ok := b.pending[update.ID]; !ok {
+		b.order = append(b.order, update.ID)
+	}
+	b.pending[update.ID] = update
+	if b.timer == nil {
+		b.timer = time.AfterFunc(b.interval, q.flushProgress)
+	}
+	return true
+}
+
+// flushProgress broadcasts the pending updates of jobs that are still running
+func (q *Queue) flushProgress() {
+	b := &q.progress
+	b.mu.Lock()
+	pending, order := b.pending, b.order
+	b.pending, b.order, b.timer = nil, nil, nil
+	b.mu.Unlock()
+
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	batch := make([]ProgressUpdate, 0, len(order))
+	for _, id := range order {
+		if job, ok := q.jobs[id]; ok && job.Status == StatusRunning {
+			batch = append(batch, pending[id])
+		}
+	}
+	if len(batch) > 0 {
+		q.broadcast(JobEvent{Type: "progress_batch", ProgressBatch: batch})
+	}
+}
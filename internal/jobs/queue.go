@@ -2,16 +2,25 @@ package jobs
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gwlsn/shrinkray/internal/ffmpeg"
+	"github.com/gwlsn/shrinkray/internal/logger"
 )
 
+var queueLog = logger.For("queue")
+
+// ErrAlreadyQueued is returned when adding a path that already has an
+// unfinished job
+var ErrAlreadyQueued = errors.New("already queued")
+
 // Queue manages the job queue with persistence
 type Queue struct {
 	mu             sync.RWMutex
@@ -19,15 +28,44 @@ type Queue struct {
 	order          []string             // Job IDs in order of creation
 	filePath       string               // Path to persistence file
 	processedPaths map[string]time.Time // All successfully processed input paths
+	outputs        map[string]output    // Output paths written by shrinkray (see checkReencodeLocked)
 	totalSaved     int64                // Total bytes saved across completed job history
 
+	// Content fingerprints of processed files (see Fingerprint), so they are
+	// recognized after being renamed
+	processedFingerprints map[string]time.Time
+
+	// Batches of jobs queued together, by ID (see Batch)
+	batches map[string]*Batch
+
+	// Recent encode speeds and the local worker count, for the ETA in Stats
+	speeds  encodeSpeeds
+	workers atomic.Int64
+
+	// holdReason, while set, keeps jobs from starting (see Hold)
+	holdReason string
+
 	// Subscribers for job events
 	subsMu      sync.RWMutex
-	subscribers map[chan JobEvent]struct{}
+	subscribers map[chan JobEvent]*subscriber
+
+	// Event IDs and the recent events kept for SubscribeFrom, guarded by subsMu
+	eventSeq     uint64
+	replay       []JobEvent
+	replayMissed uint64 // Highest event ID no longer in replay
+
+	// Job revisions for polling clients (see ChangesSince)
+	changes *changeLog
+
+	// Progress updates waiting to be sent as a batch (see SetProgressRate)
+	progress progressBatcher
 
 	// Rate limiting for hardware fallbacks to prevent queue explosion
 	fallbackTimes []time.Time // Timestamps of recent fallback creations
 
+	// Jobs that were running when the queue was last saved (see RecoverInterrupted)
+	interrupted []string
+
 	// Debounced save mechanism to reduce lock contention
 	saveMu    sync.Mutex
 	saveTimer *time.Timer
@@ -41,9 +79,19 @@ func NewQueue(filePath string) (*Queue, error) {
 		order:          make([]string, 0),
 		filePath:       filePath,
 		processedPaths: make(map[string]time.Time),
-		subscribers:    make(map[chan JobEvent]struct{}),
+		outputs:        make(map[string]output),
+		subscribers:    make(map[chan JobEvent]*subscriber),
 		fallbackTimes:  make([]time.Time, 0),
+
+		processedFingerprints: make(map[string]time.Time),
+		batches:               make(map[string]*Batch),
+		speeds:                make(encodeSpeeds),
+		changes:               newChangeLog(),
 	}
+	// Event IDs start at the current time, so an ID from before a restart is
+	// never taken for a current one
+	q.eventSeq = uint64(time.Now().UnixMicro())
+	q.replayMissed = q.eventSeq
 
 	// Try to load existing queue
 	if filePath != "" {
@@ -60,7 +108,13 @@ type persistenceData struct {
 	Jobs           []*Job               `json:"jobs"`
 	Order          []string             `json:"order"`
 	ProcessedPaths map[string]time.Time `json:"processed_paths,omitempty"`
+	Outputs        map[string]output    `json:"outputs,omitempty"`
+	OutputPresets  map[string]string    `json:"output_presets,omitempty"` // Outputs before their size and mtime were kept
 	TotalSaved     *int64               `json:"total_saved,omitempty"`
+
+	ProcessedFingerprints map[string]time.Time `json:"processed_fingerprints,omitempty"`
+	Batches               []*Batch             `json:"batches,omitempty"`
+	Speeds                encodeSpeeds         `json:"speeds,omitempty"` // Kept so ETAs survive clearing finished jobs
 }
 
 // load reads the queue from disk
@@ -94,6 +148,37 @@ func (q *Queue) load() error {
 			}
 		}
 	}
+	if pd.ProcessedFingerprints != nil {
+		q.processedFingerprints = pd.ProcessedFingerprints
+	}
+	for _, batch := range pd.Batches {
+		// Whatever was adding jobs didn't survive the restart
+		batch.Adding = false
+		q.batches[batch.ID] = batch
+	}
+	if pd.Speeds != nil {
+		q.speeds = pd.Speeds
+	} else {
+		for _, id := range q.order {
+			if job, ok := q.jobs[id]; ok && job.Status == StatusComplete {
+				q.speeds.record(job)
+			}
+		}
+	}
+	switch {
+	case pd.Outputs != nil:
+		q.outputs = pd.Outputs
+	case pd.OutputPresets != nil:
+		for path, presetID := range pd.OutputPresets {
+			q.recordOutputLocked(path, presetID)
+		}
+	default:
+		for _, job := range q.jobs {
+			if job.Status == StatusComplete && job.OutputPath != "" {
+				q.recordOutputLocked(job.OutputPath, job.PresetID)
+			}
+		}
+	}
 	if pd.TotalSaved != nil {
 		q.totalSaved = *pd.TotalSaved
 	} else {
@@ -107,10 +192,13 @@ func (q *Queue) load() error {
 	// Reset any running jobs to pending (they were interrupted)
 	for _, job := range q.jobs {
 		if job.Status == StatusRunning {
+			q.interrupted = append(q.interrupted, job.ID)
+			job.recordEvent(EventRequeued, "interrupted")
 			job.Status = StatusPending
 			job.Progress = 0
 			job.Speed = 0
 			job.ETA = ""
+			job.Agent = ""
 		}
 	}
 
@@ -142,11 +230,26 @@ func (q *Queue) save() error {
 		processedCopy[k] = v
 	}
 
+	outputsCopy := make(map[string]output, len(q.outputs))
+	for k, v := range q.outputs {
+		outputsCopy[k] = v
+	}
+
+	fingerprintsCopy := make(map[string]time.Time, len(q.processedFingerprints))
+	for k, v := range q.processedFingerprints {
+		fingerprintsCopy[k] = v
+	}
+
 	pd := persistenceData{
 		Jobs:           jobs,
 		Order:          orderCopy,
 		ProcessedPaths: processedCopy,
+		Outputs:        outputsCopy,
 		TotalSaved:     &totalSaved,
+
+		ProcessedFingerprints: fingerprintsCopy,
+		Batches:               q.batchesSnapshotLocked(),
+		Speeds:                q.speeds.clone(),
 	}
 
 	// Do the actual I/O (this is still blocking, but data is copied)
@@ -202,12 +305,28 @@ func (q *Queue) scheduleSave() {
 			err := q.saveSnapshot()
 			q.mu.RUnlock()
 			if err != nil {
-				log.Printf("[queue] Warning: failed to persist queue: %v", err)
+				queueLog.Warn("Failed to persist queue", "error", err)
 			}
 		}
 	})
 }
 
+// Flush writes the queue to disk now, skipping any pending debounced save.
+// Called on shutdown so the last changes aren't lost.
+func (q *Queue) Flush() error {
+	q.saveMu.Lock()
+	if q.saveTimer != nil {
+		q.saveTimer.Stop()
+		q.saveTimer = nil
+	}
+	q.saveDirty = false
+	q.saveMu.Unlock()
+
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return q.saveSnapshot()
+}
+
 // saveSnapshot captures a snapshot and writes to disk (must be called with q.mu held for reading)
 func (q *Queue) saveSnapshot() error {
 	if q.filePath == "" {
@@ -232,11 +351,26 @@ func (q *Queue) saveSnapshot() error {
 		processedCopy[k] = v
 	}
 
+	outputsCopy := make(map[string]output, len(q.outputs))
+	for k, v := range q.outputs {
+		outputsCopy[k] = v
+	}
+
+	fingerprintsCopy := make(map[string]time.Time, len(q.processedFingerprints))
+	for k, v := range q.processedFingerprints {
+		fingerprintsCopy[k] = v
+	}
+
 	pd := persistenceData{
 		Jobs:           jobs,
 		Order:          orderCopy,
 		ProcessedPaths: processedCopy,
+		Outputs:        outputsCopy,
 		TotalSaved:     &totalSaved,
+
+		ProcessedFingerprints: fingerprintsCopy,
+		Batches:               q.batchesSnapshotLocked(),
+		Speeds:                q.speeds.clone(),
 	}
 
 	return q.writeToFile(pd)
@@ -244,9 +378,38 @@ func (q *Queue) saveSnapshot() error {
 
 // Add adds a new job to the queue
 func (q *Queue) Add(inputPath string, presetID string, probe *ffmpeg.ProbeResult) (*Job, error) {
+	return q.AddWith(AddOptions{}, inputPath, presetID, probe)
+}
+
+// AddOptions are recorded on jobs as they are added
+type AddOptions struct {
+	CreatedBy string // ID of the user queueing the jobs
+	BatchID   string // Batch the jobs belong to (see CreateBatch)
+
+	// RetryOf is the job this one retries, recorded in its Attempts with
+	// RetriedBy ("retry" or "retry_preset")
+	RetryOf   *Job
+	RetriedBy string
+
+	// AllowDuplicates queues paths that already have an unfinished job.
+	// Otherwise AddWith returns ErrAlreadyQueued for them, and adding
+	// several leaves them out and counts them on the batch.
+	AllowDuplicates bool
+}
+
+// AddWith is Add with options
+func (q *Queue) AddWith(opts AddOptions, inputPath string, presetID string, probe *ffmpeg.ProbeResult) (*Job, error) {
+	source := statSource(inputPath)
+
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
+	if !opts.AllowDuplicates {
+		if _, ok := q.enqueuedPathsLocked()[absInputPath(inputPath)]; ok {
+			return nil, fmt.Errorf("%w: %s", ErrAlreadyQueued, inputPath)
+		}
+	}
+
 	// Look up preset to get encoder info
 	preset := ffmpeg.GetPreset(presetID)
 	encoder := string(ffmpeg.HWAccelNone)
@@ -259,7 +422,10 @@ func (q *Queue) Add(inputPath string, presetID string, probe *ffmpeg.ProbeResult
 	// Check if file should be skipped
 	var skipReason string
 	if preset != nil {
-		skipReason = checkSkipReason(probe, preset)
+		skipReason = ffmpeg.SkipReason(probe, preset)
+	}
+	if skipReason == "" {
+		skipReason = q.checkReencodeLocked(inputPath, presetID)
 	}
 
 	status := StatusPending
@@ -276,10 +442,31 @@ func (q *Queue) Add(inputPath string, presetID string, probe *ffmpeg.ProbeResult
 		Status:         status,
 		Error:          skipReason,
 		InputSize:      probe.Size,
+		EstimatedSize:  estimatedSize(probe, preset),
+		InputModTime:   source.modTime,
+		Hardlinks:      source.hardlinks,
 		Duration:       probe.Duration.Milliseconds(),
 		Bitrate:        probe.Bitrate,
+		VideoBitrate:   ffmpeg.SourceVideoBitrate(probe),
+		BitDepth:       probe.BitDepth,
+		Width:          probe.Width,
+		Height:         probe.Height,
+		Interlaced:     probe.Interlaced,
+		PixFmt:         probe.PixFmt,
+		VideoCodec:     probe.VideoCodec,
+		HDR:            probe.HDR,
 		CreatedAt:      time.Now(),
 		SubtitleCodecs: probe.SubtitleCodecs,
+		AudioTracks:    probe.AudioTracks,
+		SubtitleTracks: probe.SubtitleTracks,
+		Chapters:       probe.Chapters,
+		Attachments:    probe.Attachments,
+		CreatedBy:      opts.CreatedBy,
+		BatchID:        opts.BatchID,
+		probe:          probe,
+	}
+	if opts.RetryOf != nil {
+		job.Attempts = withAttempt(opts.RetryOf, opts.RetriedBy)
 	}
 
 	q.jobs[job.ID] = job
@@ -287,7 +474,7 @@ func (q *Queue) Add(inputPath string, presetID string, probe *ffmpeg.ProbeResult
 
 	if err := q.save(); err != nil {
 		// Log error but don't fail - queue still works in memory
-		log.Printf("[queue] Warning: failed to persist queue: %v", err)
+		queueLog.Warn("Failed to persist queue", "error", err)
 	}
 
 	// Broadcast appropriate event based on status
@@ -305,11 +492,23 @@ func (q *Queue) Add(inputPath string, presetID string, probe *ffmpeg.ProbeResult
 // we broadcast a single "batch_added" event containing all jobs.
 // Jobs that fail skip-reason checks are broadcast separately as "failed" events.
 func (q *Queue) AddMultiple(probes []*ffmpeg.ProbeResult, presetID string) ([]*Job, error) {
+	return q.AddMultipleWith(AddOptions{}, probes, presetID)
+}
+
+// AddMultipleWith is AddMultiple with options
+func (q *Queue) AddMultipleWith(opts AddOptions, probes []*ffmpeg.ProbeResult, presetID string) ([]*Job, error) {
+	sources := make([]sourceStat, len(probes))
+	for i, probe := range probes {
+		sources[i] = statSource(probe.Path)
+	}
+
 	q.mu.Lock()
 
 	allJobs := make([]*Job, 0, len(probes))
 	addedJobs := make([]*Job, 0, len(probes)) // Jobs successfully added (pending)
 	skippedJobs := make([]*Job, 0)            // Jobs that failed skip-reason check
+	enqueued := q.enqueuedPathsLocked()
+	duplicates := 0
 
 	preset := ffmpeg.GetPreset(presetID)
 	encoder := string(ffmpeg.HWAccelNone)
@@ -319,11 +518,20 @@ func (q *Queue) AddMultiple(probes []*ffmpeg.ProbeResult, presetID string) ([]*J
 		isHardware = preset.Encoder != ffmpeg.HWAccelNone
 	}
 
-	for _, probe := range probes {
+	for i, probe := range probes {
+		absPath := absInputPath(probe.Path)
+		if _, ok := enqueued[absPath]; ok && !opts.AllowDuplicates {
+			duplicates++
+			continue
+		}
+
 		// Check if file should be skipped
 		var skipReason string
 		if preset != nil {
-			skipReason = checkSkipReason(probe, preset)
+			skipReason = ffmpeg.SkipReason(probe, preset)
+		}
+		if skipReason == "" {
+			skipReason = q.checkReencodeLocked(probe.Path, presetID)
 		}
 
 		status := StatusPending
@@ -340,10 +548,28 @@ func (q *Queue) AddMultiple(probes []*ffmpeg.ProbeResult, presetID string) ([]*J
 			Status:         status,
 			Error:          skipReason,
 			InputSize:      probe.Size,
+			EstimatedSize:  estimatedSize(probe, preset),
+			InputModTime:   sources[i].modTime,
+			Hardlinks:      sources[i].hardlinks,
 			Duration:       probe.Duration.Milliseconds(),
 			Bitrate:        probe.Bitrate,
+			VideoBitrate:   ffmpeg.SourceVideoBitrate(probe),
+			BitDepth:       probe.BitDepth,
+			Width:          probe.Width,
+			Height:         probe.Height,
+			Interlaced:     probe.Interlaced,
+			PixFmt:         probe.PixFmt,
+			VideoCodec:     probe.VideoCodec,
+			HDR:            probe.HDR,
 			CreatedAt:      time.Now(),
 			SubtitleCodecs: probe.SubtitleCodecs,
+			AudioTracks:    probe.AudioTracks,
+			SubtitleTracks: probe.SubtitleTracks,
+			Chapters:       probe.Chapters,
+			Attachments:    probe.Attachments,
+			CreatedBy:      opts.CreatedBy,
+			BatchID:        opts.BatchID,
+			probe:          probe,
 		}
 
 		q.jobs[job.ID] = job
@@ -354,8 +580,10 @@ func (q *Queue) AddMultiple(probes []*ffmpeg.ProbeResult, presetID string) ([]*J
 			skippedJobs = append(skippedJobs, job)
 		} else {
 			addedJobs = append(addedJobs, job)
+			enqueued[absPath] = struct{}{}
 		}
 	}
+	q.countDuplicatesLocked(opts.BatchID, duplicates)
 
 	q.mu.Unlock()
 
@@ -383,6 +611,10 @@ func (q *Queue) AddWithoutProbe(inputPath string, presetID string, fileSize int6
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
+	if _, ok := q.enqueuedPathsLocked()[absInputPath(inputPath)]; ok {
+		return nil, fmt.Errorf("%w: %s", ErrAlreadyQueued, inputPath)
+	}
+
 	// Look up preset to get encoder info
 	preset := ffmpeg.GetPreset(presetID)
 	encoder := string(ffmpeg.HWAccelNone)
@@ -409,7 +641,7 @@ func (q *Queue) AddWithoutProbe(inputPath string, presetID string, fileSize int6
 	q.order = append(q.order, job.ID)
 
 	if err := q.save(); err != nil {
-		log.Printf("[queue] Warning: failed to persist queue: %v", err)
+		queueLog.Warn("Failed to persist queue", "error", err)
 	}
 
 	q.broadcast(JobEvent{Type: "added", Job: job})
@@ -421,6 +653,11 @@ func (q *Queue) AddWithoutProbe(inputPath string, presetID string, fileSize int6
 // Files are added immediately without waiting for ffprobe - probing happens when
 // workers pick them up. Returns the created jobs.
 func (q *Queue) AddMultipleWithoutProbe(files []FileInfo, presetID string) []*Job {
+	return q.AddMultipleWithoutProbeWith(AddOptions{}, files, presetID)
+}
+
+// AddMultipleWithoutProbeWith is AddMultipleWithoutProbe with options
+func (q *Queue) AddMultipleWithoutProbeWith(opts AddOptions, files []FileInfo, presetID string) []*Job {
 	q.mu.Lock()
 
 	preset := ffmpeg.GetPreset(presetID)
@@ -432,7 +669,16 @@ func (q *Queue) AddMultipleWithoutProbe(files []FileInfo, presetID string) []*Jo
 	}
 
 	jobs := make([]*Job, 0, len(files))
+	enqueued := q.enqueuedPathsLocked()
+	duplicates := 0
 	for _, f := range files {
+		absPath := absInputPath(f.Path)
+		if _, ok := enqueued[absPath]; ok && !opts.AllowDuplicates {
+			duplicates++
+			continue
+		}
+		enqueued[absPath] = struct{}{}
+
 		job := &Job{
 			ID:         generateID(),
 			InputPath:  f.Path,
@@ -441,15 +687,19 @@ func (q *Queue) AddMultipleWithoutProbe(files []FileInfo, presetID string) []*Jo
 			IsHardware: isHardware,
 			Status:     StatusPendingProbe,
 			InputSize:  f.Size,
+			Hardlinks:  f.Hardlinks,
 			Duration:   0,
 			Bitrate:    0,
 			CreatedAt:  time.Now(),
+			CreatedBy:  opts.CreatedBy,
+			BatchID:    opts.BatchID,
 		}
 
 		q.jobs[job.ID] = job
 		q.order = append(q.order, job.ID)
 		jobs = append(jobs, job)
 	}
+	q.countDuplicatesLocked(opts.BatchID, duplicates)
 
 	q.mu.Unlock()
 
@@ -466,13 +716,16 @@ func (q *Queue) AddMultipleWithoutProbe(files []FileInfo, presetID string) []*Jo
 
 // FileInfo contains minimal info for deferred probing
 type FileInfo struct {
-	Path string
-	Size int64
+	Path      string
+	Size      int64
+	Hardlinks int // Hard links to the file, when more than one
 }
 
 // UpdateJobAfterProbe updates a pending_probe job with probe results.
 // Called by worker after probing the file. Changes status to pending (or failed if skip).
 func (q *Queue) UpdateJobAfterProbe(id string, probe *ffmpeg.ProbeResult) error {
+	source := statSource(probe.Path)
+
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
@@ -485,32 +738,57 @@ func (q *Queue) UpdateJobAfterProbe(id string, probe *ffmpeg.ProbeResult) error
 		return fmt.Errorf("job not in pending_probe status: %s", job.Status)
 	}
 
-	// Update job with probe results
+	q.applyProbeLocked(job, probe, source)
+	return nil
+}
+
+// applyProbeLocked records probe results on a job, re-checks whether it
+// should be skipped and saves and broadcasts the result. Must be called
+// with q.mu held.
+func (q *Queue) applyProbeLocked(job *Job, probe *ffmpeg.ProbeResult, source sourceStat) {
 	job.Duration = probe.Duration.Milliseconds()
 	job.Bitrate = probe.Bitrate
+	job.VideoBitrate = ffmpeg.SourceVideoBitrate(probe)
 	job.InputSize = probe.Size
 	job.SubtitleCodecs = probe.SubtitleCodecs
+	job.AudioTracks = probe.AudioTracks
+	job.SubtitleTracks = probe.SubtitleTracks
+	job.Chapters = probe.Chapters
+	job.Attachments = probe.Attachments
 	job.BitDepth = probe.BitDepth
+	job.Width = probe.Width
+	job.Height = probe.Height
+	job.Interlaced = probe.Interlaced
 	job.PixFmt = probe.PixFmt
 	job.VideoCodec = probe.VideoCodec
+	job.HDR = probe.HDR
+	job.InputModTime = source.modTime
+	job.Hardlinks = source.hardlinks
+	job.probe = probe
 
 	// Check if file should be skipped
 	preset := ffmpeg.GetPreset(job.PresetID)
+	job.EstimatedSize = estimatedSize(probe, preset)
 	var skipReason string
-	if preset != nil {
-		skipReason = checkSkipReason(probe, preset)
+	if preset != nil && !job.ForceTranscode {
+		skipReason = ffmpeg.SkipReason(probe, preset)
+	}
+	if skipReason == "" && !job.ForceTranscode {
+		skipReason = q.checkReencodeLocked(job.InputPath, job.PresetID)
 	}
 
+	job.recordEvent(EventProbed, "")
 	if skipReason != "" {
 		job.Status = StatusSkipped
 		job.Error = skipReason
 		job.CompletedAt = time.Now()
+		job.recordEvent(string(StatusSkipped), skipReason)
 	} else {
 		job.Status = StatusPending
 	}
 
 	if err := q.save(); err != nil {
-		log.Printf("[queue] Warning: failed to persist queue: %v", err)
+		queueLog.Warn("Failed to persist queue", "error", err)
 	}
 
 	// Broadcast appropriate event
@@ -520,8 +798,6 @@ func (q *Queue) UpdateJobAfterProbe(id string, probe *ffmpeg.ProbeResult) error
 		// Use a "probed" event type so frontend can update job details
 		q.broadcast(JobEvent{Type: "probed", Job: job})
 	}
-
-	return nil
 }
 
 // Fallback rate limit constants
@@ -550,8 +826,8 @@ func (q *Queue) AddSoftwareFallback(originalJob *Job, fallbackReason string) *Jo
 
 	// If too many fallbacks recently, refuse to create another
 	if len(q.fallbackTimes) >= fallbackRateLimitMax {
-		log.Printf("[queue] Warning: hardware fallback rate limit reached (%d in %v), skipping auto-retry",
-			fallbackRateLimitMax, fallbackRateLimitWindow)
+		queueLog.Warn("Hardware fallback rate limit reached, skipping auto-retry",
+			"limit", fallbackRateLimitMax, "window", fallbackRateLimitWindow)
 		return nil
 	}
 
@@ -572,17 +848,38 @@ func (q *Queue) AddSoftwareFallback(originalJob *Job, fallbackReason string) *Jo
 		IsHardware:         false,
 		Status:             StatusPending,
 		InputSize:          originalJob.InputSize,
+		EstimatedSize:      originalJob.EstimatedSize,
 		Duration:           originalJob.Duration,
 		Bitrate:            originalJob.Bitrate,
+		VideoBitrate:       originalJob.VideoBitrate,
 		BitDepth:           originalJob.BitDepth,
+		Width:              originalJob.Width,
+		Height:             originalJob.Height,
+		Interlaced:         originalJob.Interlaced,
 		PixFmt:             originalJob.PixFmt,
 		VideoCodec:         originalJob.VideoCodec,
+		HDR:                originalJob.HDR,
 		SubtitleCodecs:     originalJob.SubtitleCodecs,
+		AudioTracks:        originalJob.AudioTracks,
+		SubtitleTracks:     originalJob.SubtitleTracks,
+		Chapters:           originalJob.Chapters,
+		Attachments:        originalJob.Attachments,
+		Priority:           originalJob.Priority,
+		Tags:               originalJob.Tags,
+		Note:               originalJob.Note,
+		CustomArgs:         originalJob.CustomArgs,
+		TargetSizeMB:       originalJob.TargetSizeMB,
+		Threads:            originalJob.Threads,
 		CreatedAt:          time.Now(),
+		CreatedBy:          originalJob.CreatedBy,
+		BatchID:            originalJob.BatchID,
 		IsSoftwareFallback: true,
+		Attempts:           withAttempt(originalJob, "fallback"),
+		Timeline:           fallbackTimeline(originalJob, fallbackReason),
 		OriginalJobID:      originalJob.ID,
 		FallbackReason:     fallbackReason,
 		HardwarePath:       "cpu→cpu", // Explicit: software decode and encode
+		probe:              originalJob.probe,
 	}
 
 	q.jobs[job.ID] = job
@@ -592,7 +889,7 @@ func (q *Queue) AddSoftwareFallback(originalJob *Job, fallbackReason string) *Jo
 	q.fallbackTimes = append(q.fallbackTimes, now)
 
 	if err := q.save(); err != nil {
-		log.Printf("[queue] Warning: failed to persist queue: %v", err)
+		queueLog.Warn("Failed to persist queue", "error", err)
 	}
 
 	q.broadcast(JobEvent{Type: "added", Job: job})
@@ -622,17 +919,32 @@ func (q *Queue) GetAll() []*Job {
 }
 
 // GetNext returns the next workable job (pending_probe or pending) for workers to pick up.
+// The highest priority job wins; equal priorities keep queue order.
 // Jobs with pending_probe status need to be probed first by the worker.
 func (q *Queue) GetNext() *Job {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
+	return q.nextLocked((*Job).IsWorkable)
+}
+
+// nextLocked returns the job with the highest priority, oldest first among
+// equals, for which eligible is true, or nil while the queue is held. Jobs in
+// a paused batch are passed over. Must hold q.mu.
+func (q *Queue) nextLocked(eligible func(*Job) bool) *Job {
+	if q.holdReason != "" {
+		return nil
+	}
+
+	var next *Job
 	for _, id := range q.order {
-		if job, ok := q.jobs[id]; ok && job.IsWorkable() {
-			return job
+		if job, ok := q.jobs[id]; ok && eligible(job) && !q.batchHeldLocked(job) {
+			if next == nil || job.Priority > next.Priority {
+				next = job
+			}
 		}
 	}
-	return nil
+	return next
 }
 
 // StartJob marks a job as running.
@@ -652,12 +964,14 @@ func (q *Queue) StartJob(id string, tempPath string, hardwarePath string) error
 	}
 
 	job.Status = StatusRunning
+	job.Error = ""
 	job.TempPath = tempPath
 	job.HardwarePath = hardwarePath
 	job.StartedAt = time.Now()
+	job.recordEvent(EventStarted, hardwarePath)
 
 	if err := q.save(); err != nil {
-		log.Printf("[queue] Warning: failed to persist queue: %v", err)
+		queueLog.Warn("Failed to persist queue", "error", err)
 	}
 
 	q.broadcast(JobEvent{Type: "started", Job: job})
@@ -665,6 +979,111 @@ func (q *Queue) StartJob(id string, tempPath string, hardwarePath string) error
 	return nil
 }
 
+// ClaimNext atomically picks the next probed pending job and marks it
+// running on the named remote agent. Returns nil if nothing is claimable.
+// Jobs awaiting probe or disk space are left to local workers.
+func (q *Queue) ClaimNext(agent string) *Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	next := q.nextLocked(func(job *Job) bool { return job.Status == StatusPending })
+	if next == nil {
+		return nil
+	}
+
+	next.Status = StatusRunning
+	next.Error = ""
+	next.TempPath = ""
+	next.HardwarePath = ""
+	next.Agent = agent
+	next.StartedAt = time.Now()
+	next.recordEvent(EventStarted, agent)
+
+	if err := q.save(); err != nil {
+		queueLog.Warn("Failed to persist queue", "error", err)
+	}
+
+	q.broadcast(JobEvent{Type: "started", Job: next})
+
+	return next
+}
+
+// ReleaseJob returns a running job to pending, e.g. when a remote agent
+// stops reporting. The reason is kept in the job's error field.
+func (q *Queue) ReleaseJob(id string, reason string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return fmt.Errorf("job not found: %s", id)
+	}
+	if job.Status != StatusRunning {
+		return fmt.Errorf("job not running: %s", job.Status)
+	}
+
+	job.Status = StatusPending
+	job.Error = reason
+	job.Progress = 0
+	job.Speed = 0
+	job.ETA = ""
+	job.Agent = ""
+	job.TempPath = ""
+	job.recordEvent(EventRequeued, reason)
+
+	if err := q.save(); err != nil {
+		queueLog.Warn("Failed to persist queue", "error", err)
+	}
+
+	q.broadcast(JobEvent{Type: "updated", Job: job})
+
+	return nil
+}
+
+// RequeueStalled puts a running job whose encode the stall watchdog killed
+// back in the queue, keeping ffmpeg's output as diagnostics, and counts the
+// stall. Sends a "stalled" event.
+func (q *Queue) RequeueStalled(id string, reason string, details *FailJobDetails) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return fmt.Errorf("job not found: %s", id)
+	}
+	if job.Status != StatusRunning {
+		return fmt.Errorf("job not running: %s", job.Status)
+	}
+
+	job.Attempts = withAttempt(job, "stalled")
+	job.Attempts[len(job.Attempts)-1].Status = StatusFailed
+	job.Attempts[len(job.Attempts)-1].Error = reason
+	if details != nil {
+		job.Attempts[len(job.Attempts)-1].ExitCode = details.ExitCode
+	}
+	job.Status = StatusPending
+	job.Error = reason
+	job.Stalls++
+	job.recordEvent(EventRequeued, reason)
+	job.Progress = 0
+	job.Speed = 0
+	job.ETA = ""
+	job.TempPath = ""
+	if details != nil {
+		job.Stderr = details.Stderr
+		job.ExitCode = details.ExitCode
+		job.FFmpegArgs = details.FFmpegArgs
+	}
+
+	if err := q.save(); err != nil {
+		queueLog.Warn("Failed to persist queue", "error", err)
+	}
+
+	q.broadcast(JobEvent{Type: "stalled", Job: job})
+
+	return nil
+}
+
 // UpdateProgress updates a job's progress
 func (q *Queue) UpdateProgress(id string, progress float64, speed float64, eta string) {
 	q.mu.Lock()
@@ -677,6 +1096,10 @@ func (q *Queue) UpdateProgress(id string, progress float64, speed float64, eta s
 
 	job.Progress = progress
 	job.Speed = speed
+	// ffmpeg's own ETA is only used when the job's duration isn't known
+	if remaining := q.remainingSeconds(job); remaining > 0 {
+		eta = formatDuration(time.Duration(remaining * float64(time.Second)))
+	}
 	job.ETA = eta
 
 	// Don't persist on every progress update (too expensive)
@@ -684,15 +1107,28 @@ func (q *Queue) UpdateProgress(id string, progress float64, speed float64, eta s
 
 	// Performance: Use delta update instead of full Job struct
 	// This reduces SSE payload from ~500+ bytes to ~80 bytes per progress event
-	q.broadcast(JobEvent{
-		Type: "progress",
-		ProgressUpdate: &ProgressUpdate{
-			ID:       id,
-			Progress: progress,
-			Speed:    speed,
-			ETA:      eta,
-		},
-	})
+	update := ProgressUpdate{
+		ID:       id,
+		Progress: progress,
+		Speed:    speed,
+		ETA:      eta,
+	}
+	if q.batchProgress(update) {
+		return
+	}
+	q.broadcast(JobEvent{Type: "progress", ProgressUpdate: &update})
+}
+
+// SetJobEnergy records the energy a job's encode used, before it is
+// completed or discarded as no gain
+func (q *Queue) SetJobEnergy(id string, kwh, cost float64, measured bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if job, ok := q.jobs[id]; ok {
+		job.EnergyKWh = kwh
+		job.EnergyCost = cost
+		job.EnergyMeasured = measured
+	}
 }
 
 // CompleteJob marks a job as complete
@@ -716,9 +1152,14 @@ func (q *Queue) CompleteJob(id string, outputPath string, outputSize int64) erro
 	job.CompletedAt = time.Now()
 	job.TranscodeTime = int64(job.CompletedAt.Sub(job.StartedAt).Seconds())
 	job.TempPath = "" // Clear temp path
+	job.recordEvent(string(StatusComplete), "")
+	if !wasComplete {
+		q.speeds.record(job)
+	}
 	q.recordProcessedPathLocked(job.InputPath, job.CompletedAt)
 	if outputPath != "" {
 		q.recordProcessedPathLocked(outputPath, job.CompletedAt)
+		q.recordOutputLocked(outputPath, job.PresetID)
 	}
 
 	if wasComplete {
@@ -728,7 +1169,7 @@ func (q *Queue) CompleteJob(id string, outputPath string, outputSize int64) erro
 	}
 
 	if err := q.save(); err != nil {
-		log.Printf("[queue] Warning: failed to persist queue: %v", err)
+		queueLog.Warn("Failed to persist queue", "error", err)
 	}
 
 	q.broadcast(JobEvent{Type: "complete", Job: job})
@@ -747,6 +1188,7 @@ func (q *Queue) ProcessedPaths() map[string]struct{} {
 		if _, err := os.Stat(path); err != nil {
 			if os.IsNotExist(err) {
 				delete(q.processedPaths, path)
+				delete(q.outputs, path)
 				removed++
 			}
 			continue
@@ -755,7 +1197,7 @@ func (q *Queue) ProcessedPaths() map[string]struct{} {
 	}
 	if removed > 0 {
 		if err := q.save(); err != nil {
-			log.Printf("[queue] Warning: failed to persist queue: %v", err)
+			queueLog.Warn("Failed to persist queue", "error", err)
 		}
 	}
 	return paths
@@ -768,7 +1210,7 @@ func (q *Queue) PendingPaths() map[string]struct{} {
 
 	paths := make(map[string]struct{})
 	for _, job := range q.jobs {
-		if job.Status != StatusPending && job.Status != StatusPendingProbe {
+		if job.Status != StatusPending && job.Status != StatusPendingProbe && job.Status != StatusWaitingDisk {
 			continue
 		}
 		absPath, err := filepath.Abs(job.InputPath)
@@ -784,21 +1226,30 @@ func (q *Queue) PendingPaths() map[string]struct{} {
 func (q *Queue) EnqueuedPaths() map[string]struct{} {
 	q.mu.RLock()
 	defer q.mu.RUnlock()
+	return q.enqueuedPathsLocked()
+}
 
+// enqueuedPathsLocked is EnqueuedPaths with q.mu held
+func (q *Queue) enqueuedPathsLocked() map[string]struct{} {
 	paths := make(map[string]struct{})
 	for _, job := range q.jobs {
 		if job.IsTerminal() {
 			continue
 		}
-		absPath, err := filepath.Abs(job.InputPath)
-		if err != nil {
-			absPath = job.InputPath
-		}
-		paths[absPath] = struct{}{}
+		paths[absInputPath(job.InputPath)] = struct{}{}
 	}
 	return paths
 }
 
+// absInputPath is path made absolute, as queue paths are compared
+func absInputPath(path string) string {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	return absPath
+}
+
 // MarkProcessedPaths records input paths as processed.
 // Returns the number of new entries added.
 func (q *Queue) MarkProcessedPaths(paths []string) int {
@@ -823,7 +1274,7 @@ func (q *Queue) MarkProcessedPaths(paths []string) int {
 	}
 
 	if err := q.save(); err != nil {
-		log.Printf("[queue] Warning: failed to persist queue: %v", err)
+		queueLog.Warn("Failed to persist queue", "error", err)
 	}
 
 	return added
@@ -836,12 +1287,98 @@ func (q *Queue) ClearProcessedHistory() int {
 
 	count := len(q.processedPaths)
 	q.processedPaths = make(map[string]time.Time)
+	q.outputs = make(map[string]output)
+	q.processedFingerprints = make(map[string]time.Time)
 	if err := q.save(); err != nil {
-		log.Printf("[queue] Warning: failed to persist queue: %v", err)
+		queueLog.Warn("Failed to persist queue", "error", err)
 	}
 	return count
 }
 
+// output is a file shrinkray wrote, as it was when written
+type output struct {
+	PresetID string    `json:"preset_id"`
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"mod_time"`
+}
+
+// recordOutputLocked remembers the file at outputPath as written by
+// presetID. Must be called with q.mu held.
+func (q *Queue) recordOutputLocked(outputPath string, presetID string) {
+	absPath, err := filepath.Abs(outputPath)
+	if err != nil {
+		absPath = outputPath
+	}
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return
+	}
+	q.outputs[absPath] = output{PresetID: presetID, Size: info.Size(), ModTime: info.ModTime()}
+}
+
+// outputLocked returns how the file at path was written by shrinkray, as
+// long as it is still that file: a file replaced since (by an upgrade, or
+// a restore from the trash) is forgotten. Must be called with q.mu held.
+func (q *Queue) outputLocked(path string) (output, bool) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		absPath = path
+	}
+	out, ok := q.outputs[absPath]
+	if !ok {
+		return output{}, false
+	}
+	info, err := os.Stat(absPath)
+	if err != nil || info.Size() != out.Size || !info.ModTime().Equal(out.ModTime) {
+		delete(q.outputs, absPath)
+		return output{}, false
+	}
+	return out, true
+}
+
+// ForgetOutput stops treating the file at path as shrinkray's output, e.g.
+// once the original it replaced has been restored over it
+func (q *Queue) ForgetOutput(path string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		absPath = path
+	}
+	if _, ok := q.outputs[absPath]; !ok {
+		return
+	}
+	delete(q.outputs, absPath)
+	if err := q.save(); err != nil {
+		queueLog.Warn("Failed to persist queue", "error", err)
+	}
+}
+
+// OutputPreset returns the preset that produced path if it is a shrinkray output.
+func (q *Queue) OutputPreset(path string) (string, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	out, ok := q.outputLocked(path)
+	return out.PresetID, ok
+}
+
+// checkReencodeLocked returns a skip reason if path was written by shrinkray.
+// Re-encoding our own output compounds generation loss for little gain, so
+// it requires an explicit force retry. Must be called with q.mu held.
+func (q *Queue) checkReencodeLocked(path string, presetID string) string {
+	out, ok := q.outputLocked(path)
+	if !ok {
+		return ""
+	}
+	producedBy := out.PresetID
+	if producedBy == presetID {
+		return fmt.Sprintf("File was already transcoded by shrinkray with %s", producedBy)
+	}
+	return fmt.Sprintf("File was already transcoded by shrinkray with %s; re-encoding with %s would compound quality loss", producedBy, presetID)
+}
+
 func (q *Queue) recordProcessedPathLocked(inputPath string, completedAt time.Time) {
 	absPath, err := filepath.Abs(inputPath)
 	if err != nil {
@@ -877,6 +1414,7 @@ func (q *Queue) FailJobWithDetails(id string, errMsg string, details *FailJobDet
 	job.Error = errMsg
 	job.CompletedAt = time.Now()
 	job.TempPath = "" // Clear temp path
+	job.recordEvent(string(StatusFailed), errMsg)
 
 	// Add diagnostic details if provided
 	if details != nil {
@@ -889,7 +1427,7 @@ func (q *Queue) FailJobWithDetails(id string, errMsg string, details *FailJobDet
 	}
 
 	if err := q.save(); err != nil {
-		log.Printf("[queue] Warning: failed to persist queue: %v", err)
+		queueLog.Warn("Failed to persist queue", "error", err)
 	}
 
 	q.broadcast(JobEvent{Type: "failed", Job: job})
@@ -911,9 +1449,10 @@ func (q *Queue) SkipJob(id string, reason string) error {
 	job.Error = reason
 	job.CompletedAt = time.Now()
 	job.TempPath = ""
+	job.recordEvent(string(StatusSkipped), reason)
 
 	if err := q.save(); err != nil {
-		log.Printf("[queue] Warning: failed to persist queue: %v", err)
+		queueLog.Warn("Failed to persist queue", "error", err)
 	}
 
 	q.broadcast(JobEvent{Type: "skipped", Job: job})
@@ -922,7 +1461,7 @@ func (q *Queue) SkipJob(id string, reason string) error {
 }
 
 // NoGainJob marks a job as no_gain (transcoded file was larger than original)
-func (q *Queue) NoGainJob(id string, reason string) error {
+func (q *Queue) NoGainJob(id string, reason string, attemptedSize int64) error {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
@@ -933,11 +1472,13 @@ func (q *Queue) NoGainJob(id string, reason string) error {
 
 	job.Status = StatusNoGain
 	job.Error = reason
+	job.AttemptedSize = attemptedSize
 	job.CompletedAt = time.Now()
 	job.TempPath = ""
+	job.recordEvent(string(StatusNoGain), reason)
 
 	if err := q.save(); err != nil {
-		log.Printf("[queue] Warning: failed to persist queue: %v", err)
+		queueLog.Warn("Failed to persist queue", "error", err)
 	}
 
 	q.broadcast(JobEvent{Type: "no_gain", Job: job})
@@ -945,6 +1486,67 @@ func (q *Queue) NoGainJob(id string, reason string) error {
 	return nil
 }
 
+// VerifyFailJob marks a job whose output failed verification. The output
+// was discarded and the original left in place.
+func (q *Queue) VerifyFailJob(id string, reason string, stderr string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return fmt.Errorf("job not found: %s", id)
+	}
+
+	job.Status = StatusVerifyFailed
+	job.Error = reason
+	job.Stderr = stderr
+	job.CompletedAt = time.Now()
+	job.TempPath = ""
+	job.recordEvent(string(StatusVerifyFailed), reason)
+
+	if err := q.save(); err != nil {
+		queueLog.Warn("Failed to persist queue", "error", err)
+	}
+
+	q.broadcast(JobEvent{Type: "verify_failed", Job: job})
+
+	return nil
+}
+
+// WaitForDisk marks a job as waiting for free disk space.
+// The job stays workable so it is retried once space becomes available.
+// Only the transition into waiting_disk is broadcast to avoid repeated events.
+func (q *Queue) WaitForDisk(id string, reason string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return fmt.Errorf("job not found: %s", id)
+	}
+
+	if !job.IsWorkable() {
+		return fmt.Errorf("job not workable: %s", job.Status)
+	}
+
+	wasWaiting := job.Status == StatusWaitingDisk
+	job.Status = StatusWaitingDisk
+	job.Error = reason
+
+	if wasWaiting {
+		return nil
+	}
+	job.recordEvent(EventWaitingDisk, reason)
+
+	if err := q.save(); err != nil {
+		queueLog.Warn("Failed to persist queue", "error", err)
+	}
+
+	q.broadcast(JobEvent{Type: "waiting_disk", Job: job})
+
+	return nil
+}
+
 // ForceRetryJob resets a skipped or no_gain job to pending with ForceTranscode enabled.
 // This bypasses skip checks and size comparison on retry.
 func (q *Queue) ForceRetryJob(id string) error {
@@ -961,6 +1563,7 @@ func (q *Queue) ForceRetryJob(id string) error {
 	}
 
 	// Reset job state
+	job.Attempts = withAttempt(job, "force")
 	job.Status = StatusPending
 	job.Error = ""
 	job.Progress = 0
@@ -968,9 +1571,10 @@ func (q *Queue) ForceRetryJob(id string) error {
 	job.ETA = ""
 	job.CompletedAt = time.Time{}
 	job.ForceTranscode = true
+	job.recordEvent(EventRequeued, "force")
 
 	if err := q.save(); err != nil {
-		log.Printf("[queue] Warning: failed to persist queue: %v", err)
+		queueLog.Warn("Failed to persist queue", "error", err)
 	}
 
 	q.broadcast(JobEvent{Type: "added", Job: job})
@@ -994,9 +1598,10 @@ func (q *Queue) CancelJob(id string) error {
 
 	job.Status = StatusCancelled
 	job.CompletedAt = time.Now()
+	job.recordEvent(string(StatusCancelled), "")
 
 	if err := q.save(); err != nil {
-		log.Printf("[queue] Warning: failed to persist queue: %v", err)
+		queueLog.Warn("Failed to persist queue", "error", err)
 	}
 
 	q.broadcast(JobEvent{Type: "cancelled", Job: job})
@@ -1011,7 +1616,7 @@ func (q *Queue) Clear(includeCompleted bool) int {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
-	count := 0
+	var removed []*Job
 	newOrder := make([]string, 0, len(q.order))
 	for _, id := range q.order {
 		job, ok := q.jobs[id]
@@ -1023,16 +1628,21 @@ func (q *Queue) Clear(includeCompleted bool) int {
 			newOrder = append(newOrder, id)
 		} else {
 			delete(q.jobs, id)
-			count++
+			q.settleAttemptsLocked(job)
+			removed = append(removed, job)
 		}
 	}
 	q.order = newOrder
+	if len(removed) > 0 {
+		q.changes.remove(removed...)
+	}
+	q.pruneBatchesLocked()
 
 	if err := q.save(); err != nil {
-		log.Printf("[queue] Warning: failed to persist queue: %v", err)
+		queueLog.Warn("Failed to persist queue", "error", err)
 	}
 
-	return count
+	return len(removed)
 }
 
 // Remove removes a single job from the queue.
@@ -1046,6 +1656,7 @@ func (q *Queue) Remove(id string) (*Job, error) {
 	}
 
 	delete(q.jobs, id)
+	q.settleAttemptsLocked(job)
 
 	// Remove from order slice
 	newOrder := make([]string, 0, len(q.order))
@@ -1055,9 +1666,10 @@ func (q *Queue) Remove(id string) (*Job, error) {
 		}
 	}
 	q.order = newOrder
+	q.pruneBatchesLocked()
 
 	if err := q.save(); err != nil {
-		log.Printf("[queue] Warning: failed to persist queue: %v", err)
+		queueLog.Warn("Failed to persist queue", "error", err)
 	}
 
 	q.mu.Unlock()
@@ -1067,6 +1679,157 @@ func (q *Queue) Remove(id string) (*Job, error) {
 	return job, nil
 }
 
+// JobPatch is a partial update to a job; nil fields are left unchanged.
+// Priority, PresetID, CustomArgs, PreferredEncoder, TargetSizeMB and Threads
+// only apply to jobs that haven't started.
+type JobPatch struct {
+	Priority   *int      `json:"priority,omitempty"`
+	Tags       *[]string `json:"tags,omitempty"`
+	Note       *string   `json:"note,omitempty"`
+	PresetID   *string   `json:"preset_id,omitempty"`
+	CustomArgs *[]string `json:"custom_args,omitempty"`
+
+	PreferredEncoder *string `json:"preferred_encoder,omitempty"` // "" unpins
+	TargetSizeMB     *int    `json:"target_size_mb,omitempty"`    // 0 returns to quality mode
+	Threads          *int    `json:"threads,omitempty"`           // 0 uses preset_threads
+}
+
+// Limits for user-editable job fields
+const (
+	maxJobPriority = 100
+	maxJobTags     = 20
+	maxJobTagLen   = 64
+	maxJobNoteLen  = 1000
+	MaxJobThreads  = 256
+)
+
+// UpdateJob applies patch atomically: every field is validated before any is
+// changed, the queue is persisted once and a single "updated" event is sent.
+func (q *Queue) UpdateJob(id string, patch JobPatch) (*Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return nil, fmt.Errorf("job not found: %s", id)
+	}
+
+	if (patch.Priority != nil || patch.PresetID != nil || patch.CustomArgs != nil || patch.PreferredEncoder != nil || patch.TargetSizeMB != nil || patch.Threads != nil) && !job.IsWorkable() {
+		return nil, fmt.Errorf("priority, preset, custom args, encoder, target size and threads can only be changed before a job starts (status: %s)", job.Status)
+	}
+	if patch.TargetSizeMB != nil && *patch.TargetSizeMB < 0 {
+		return nil, fmt.Errorf("target_size_mb must be 0 or greater")
+	}
+	if patch.Threads != nil && (*patch.Threads < 0 || *patch.Threads > MaxJobThreads) {
+		return nil, fmt.Errorf("threads must be between 0 and %d", MaxJobThreads)
+	}
+	if patch.Priority != nil && (*patch.Priority < -maxJobPriority || *patch.Priority > maxJobPriority) {
+		return nil, fmt.Errorf("priority must be between %d and %d", -maxJobPriority, maxJobPriority)
+	}
+
+	var tags []string
+	if patch.Tags != nil {
+		seen := make(map[string]bool)
+		for _, tag := range *patch.Tags {
+			tag = strings.TrimSpace(tag)
+			if tag == "" || seen[tag] {
+				continue
+			}
+			if len(tag) > maxJobTagLen {
+				return nil, fmt.Errorf("tag %q is longer than %d characters", tag, maxJobTagLen)
+			}
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+		if len(tags) > maxJobTags {
+			return nil, fmt.Errorf("a job can have at most %d tags", maxJobTags)
+		}
+	}
+	if patch.Note != nil && len(*patch.Note) > maxJobNoteLen {
+		return nil, fmt.Errorf("note is longer than %d characters", maxJobNoteLen)
+	}
+
+	var preset *ffmpeg.Preset
+	if patch.PresetID != nil {
+		preset = ffmpeg.GetPreset(*patch.PresetID)
+		if preset == nil {
+			return nil, fmt.Errorf("unknown preset: %s", *patch.PresetID)
+		}
+		if reason := q.checkReencodeLocked(job.InputPath, preset.ID); reason != "" && !job.ForceTranscode {
+			return nil, fmt.Errorf("%s", reason)
+		}
+		if job.probe != nil && !job.ForceTranscode {
+			if reason := ffmpeg.SkipReason(job.probe, preset); reason != "" {
+				return nil, fmt.Errorf("%s", reason)
+			}
+		}
+	}
+	if patch.CustomArgs != nil {
+		if err := ffmpeg.ValidateCustomArgs(*patch.CustomArgs); err != nil {
+			return nil, err
+		}
+	}
+	var preferredEncoder ffmpeg.HWAccel
+	if patch.PreferredEncoder != nil && *patch.PreferredEncoder != "" {
+		accel, ok := ffmpeg.ParseHWAccel(*patch.PreferredEncoder)
+		if !ok {
+			return nil, fmt.Errorf("unknown encoder: %s", *patch.PreferredEncoder)
+		}
+		preferredEncoder = accel
+	}
+
+	// Everything validated - apply
+	if patch.Priority != nil {
+		job.Priority = *patch.Priority
+	}
+	if patch.Tags != nil {
+		job.Tags = tags
+	}
+	if patch.Note != nil {
+		job.Note = *patch.Note
+	}
+	if preset != nil && preset.ID != job.PresetID {
+		job.PresetID = preset.ID
+		if job.probe != nil {
+			job.EstimatedSize = estimatedSize(job.probe, preset)
+		} else if job.Status != StatusPendingProbe {
+			// Probed before a restart: probe it again, which re-checks the
+			// skip rules and the estimate for the new preset
+			job.Status = StatusPendingProbe
+			job.EstimatedSize = 0
+		}
+	}
+	if patch.CustomArgs != nil {
+		job.CustomArgs = append([]string(nil), *patch.CustomArgs...)
+	}
+	if patch.PreferredEncoder != nil {
+		job.PreferredEncoder = preferredEncoder
+	}
+	if patch.TargetSizeMB != nil {
+		job.TargetSizeMB = *patch.TargetSizeMB
+	}
+	if patch.Threads != nil {
+		job.Threads = *patch.Threads
+	}
+	if preset != nil || patch.PreferredEncoder != nil {
+		// Show the encoder the job will use
+		if job.PreferredEncoder != "" {
+			job.Encoder = string(job.PreferredEncoder)
+			job.IsHardware = job.PreferredEncoder != ffmpeg.HWAccelNone
+		} else if p := ffmpeg.GetPreset(job.PresetID); p != nil {
+			job.Encoder = string(p.Encoder)
+			job.IsHardware = p.Encoder != ffmpeg.HWAccelNone
+		}
+	}
+
+	if err := q.save(); err != nil {
+		queueLog.Warn("Failed to persist queue", "error", err)
+	}
+
+	q.broadcast(JobEvent{Type: "updated", Job: job})
+	return job, nil
+}
+
 // ReorderPending moves a pending job up or down within the pending queue order.
 // Only pending or pending_probe jobs can be reordered.
 // Returns true if the order changed.
@@ -1130,7 +1893,7 @@ func (q *Queue) ReorderPending(id string, direction string) (bool, error) {
 	q.order = newOrder
 
 	if err := q.save(); err != nil {
-		log.Printf("[queue] Warning: failed to persist queue: %v", err)
+		queueLog.Warn("Failed to persist queue", "error", err)
 	}
 
 	q.broadcast(JobEvent{Type: "reordered"})
@@ -1216,44 +1979,128 @@ func (q *Queue) MovePending(id string, beforeID string) (bool, error) {
 	q.order = newOrder
 
 	if err := q.save(); err != nil {
-		log.Printf("[queue] Warning: failed to persist queue: %v", err)
+		queueLog.Warn("Failed to persist queue", "error", err)
 	}
 
 	q.broadcast(JobEvent{Type: "reordered"})
 	return true, nil
 }
 
-// Subscribe returns a channel that receives job events
+// eventReplaySize is how many recent events are kept for clients resuming
+// a stream (see SubscribeFrom)
+const eventReplaySize = 1000
+
+// Subscribe returns a channel that receives job events. A subscriber that
+// can't keep up gets coalesced events, and EventResync if it falls too far
+// behind.
 func (q *Queue) Subscribe() chan JobEvent {
-	ch := make(chan JobEvent, 100)
+	sub := newSubscriber()
 
 	q.subsMu.Lock()
-	q.subscribers[ch] = struct{}{}
+	q.subscribers[sub.out] = sub
 	q.subsMu.Unlock()
 
-	return ch
+	return sub.out
+}
+
+// SubscribeFrom is Subscribe for a client that saw events up to lastID and
+// reconnected: it also returns the events it missed since then, oldest
+// first. ok is false if some are no longer kept, or lastID is from before a
+// restart; the client must then reload the full state.
+func (q *Queue) SubscribeFrom(lastID uint64) (ch chan JobEvent, missed []JobEvent, ok bool) {
+	sub := newSubscriber()
+	ch = sub.out
+
+	q.subsMu.Lock()
+	defer q.subsMu.Unlock()
+	q.subscribers[ch] = sub
+
+	if lastID < q.replayMissed || lastID > q.eventSeq {
+		return ch, nil, false
+	}
+	for _, event := range q.replay {
+		if event.ID > lastID {
+			missed = append(missed, event)
+		}
+	}
+	return ch, missed, true
+}
+
+// LastEventID returns the ID of the most recent event
+func (q *Queue) LastEventID() uint64 {
+	q.subsMu.RLock()
+	defer q.subsMu.RUnlock()
+	return q.eventSeq
 }
 
 // Unsubscribe removes a subscription
 func (q *Queue) Unsubscribe(ch chan JobEvent) {
 	q.subsMu.Lock()
+	sub := q.subscribers[ch]
 	delete(q.subscribers, ch)
 	q.subsMu.Unlock()
 
-	close(ch)
+	if sub != nil {
+		sub.close()
+	}
+}
+
+// Notify sends subscribers an event that isn't about a single job, such
+// as "encoders_changed"
+func (q *Queue) Notify(eventType string) {
+	q.broadcast(JobEvent{Type: eventType})
+}
+
+// Hold stops local workers and remote agents from starting jobs until
+// Release, e.g. while the media mount is unreachable. Running jobs are left
+// to the caller. Sends a "queue_held" event when the queue wasn't held.
+func (q *Queue) Hold(reason string) {
+	q.mu.Lock()
+	wasHeld := q.holdReason != ""
+	q.holdReason = reason
+	q.mu.Unlock()
+
+	if !wasHeld {
+		q.broadcast(JobEvent{Type: "queue_held", Reason: reason})
+	}
+}
+
+// Release lets jobs start again after Hold, sending a "queue_released" event
+func (q *Queue) Release() {
+	q.mu.Lock()
+	wasHeld := q.holdReason != ""
+	q.holdReason = ""
+	q.mu.Unlock()
+
+	if wasHeld {
+		q.broadcast(JobEvent{Type: "queue_released"})
+	}
 }
 
-// broadcast sends an event to all subscribers
+// broadcast numbers an event, keeps it for replay and sends it to all
+// subscribers
 func (q *Queue) broadcast(event JobEvent) {
-	q.subsMu.RLock()
-	defer q.subsMu.RUnlock()
+	q.subsMu.Lock()
+	defer q.subsMu.Unlock()
 
-	for ch := range q.subscribers {
-		select {
-		case ch <- event:
-		default:
-			// Channel full, skip this subscriber
+	q.eventSeq++
+	event.ID = q.eventSeq
+	if event.Job != nil {
+		event.BatchID = event.Job.BatchID
+	}
+	q.changes.recordEvent(event)
+
+	// Progress is superseded by the next update, so it isn't worth replaying
+	if event.Type != "progress" && event.Type != "progress_batch" {
+		if len(q.replay) == eventReplaySize {
+			q.replayMissed = q.replay[0].ID
+			q.replay = q.replay[1:]
 		}
+		q.replay = append(q.replay, event)
+	}
+
+	for _, sub := range q.subscribers {
+		sub.send(event)
 	}
 }
 
@@ -1267,17 +2114,39 @@ type Stats struct {
 	Cancelled    int   `json:"cancelled"`
 	Skipped      int   `json:"skipped"`
 	NoGain       int   `json:"no_gain"`
+	WaitingDisk  int   `json:"waiting_disk"` // Blocked on free disk space
+	VerifyFailed int   `json:"verify_failed"`
 	Total        int   `json:"total"`
 	TotalSaved   int64 `json:"total_saved"` // Total bytes saved by completed jobs
+
+	// EnergyKWh and EnergyCost total the energy of the queue's finished
+	// encodes (energy.enabled)
+	EnergyKWh  float64 `json:"energy_kwh,omitempty"`
+	EnergyCost float64 `json:"energy_cost,omitempty"`
+
+	// ETASeconds estimates how long until the queue is done (0 when idle),
+	// from the jobs' durations, recent encode speeds and the worker count;
+	// EstimatedCompletion is when that is
+	ETASeconds          int64      `json:"eta_seconds,omitempty"`
+	EstimatedCompletion *time.Time `json:"estimated_completion,omitempty"`
+
+	// HoldReason is why no jobs are starting, if the queue is held
+	HoldReason string `json:"hold_reason,omitempty"`
+
+	// AddingBatches counts batches whose files are still being probed and
+	// queued; the queue isn't drained while there are any
+	AddingBatches int `json:"adding_batches,omitempty"`
 }
 
 func (q *Queue) Stats() Stats {
 	q.mu.RLock()
 	defer q.mu.RUnlock()
 
-	stats := Stats{TotalSaved: q.totalSaved}
+	stats := Stats{TotalSaved: q.totalSaved, HoldReason: q.holdReason, AddingBatches: q.addingBatchesLocked()}
 	for _, job := range q.jobs {
 		stats.Total++
+		stats.EnergyKWh += job.EnergyKWh
+		stats.EnergyCost += job.EnergyCost
 		switch job.Status {
 		case StatusPendingProbe:
 			stats.PendingProbe++
@@ -1295,9 +2164,14 @@ func (q *Queue) Stats() Stats {
 			stats.Skipped++
 		case StatusNoGain:
 			stats.NoGain++
+		case StatusWaitingDisk:
+			stats.WaitingDisk++
+		case StatusVerifyFailed:
+			stats.VerifyFailed++
 		}
 	}
 	stats.TotalSaved = q.totalSaved
+	q.setETA(&stats)
 	return stats
 }
 
@@ -1312,30 +2186,3 @@ func generateID() string {
 	idCounter++
 	return fmt.Sprintf("%d-%d", time.Now().UnixNano(), idCounter)
 }
-
-// checkSkipReason returns an error message if the file should be skipped, empty string otherwise.
-func checkSkipReason(probe *ffmpeg.ProbeResult, preset *ffmpeg.Preset) string {
-	// For downscale presets, check if file already meets resolution target
-	if preset.MaxHeight > 0 && probe.Height <= preset.MaxHeight {
-		return fmt.Sprintf("File is already %dp or smaller", preset.MaxHeight)
-	}
-
-	// Check if file is already in target codec
-	var isAlreadyTarget bool
-	var codecName string
-
-	switch preset.Codec {
-	case ffmpeg.CodecHEVC:
-		isAlreadyTarget = probe.IsHEVC
-		codecName = "HEVC"
-	case ffmpeg.CodecAV1:
-		isAlreadyTarget = probe.IsAV1
-		codecName = "AV1"
-	}
-
-	if isAlreadyTarget {
-		return fmt.Sprintf("File is already encoded in %s", codecName)
-	}
-
-	return "" // Proceed with transcode
-}
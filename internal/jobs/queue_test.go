@@ -1,8 +1,13 @@
 package jobs
 
 import (
+	"errors"
+	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
@@ -207,6 +212,129 @@ func TestQueueCompleteMarksOutputProcessed(t *testing.T) {
 	}
 }
 
+func TestQueueRemuxSkipRules(t *testing.T) {
+	queue, err := NewQueue("")
+	if err != nil {
+		t.Fatalf("failed to create queue: %v", err)
+	}
+
+	tests := []struct {
+		path   string
+		codec  string
+		status Status
+	}{
+		{"/media/recording.ts", "hevc", StatusPending},
+		{"/media/old.avi", "mpeg4", StatusSkipped},
+		{"/media/movie.mkv", "hevc", StatusSkipped},
+	}
+	for _, tt := range tests {
+		probe := &ffmpeg.ProbeResult{Path: tt.path, Size: 1000000, Duration: 10 * time.Second,
+			VideoCodec: tt.codec, IsHEVC: tt.codec == "hevc"}
+		job, _ := queue.Add(probe.Path, "remux-mkv", probe)
+		if job.Status != tt.status {
+			t.Errorf("%s (%s): expected %s, got %s (%s)", tt.path, tt.codec, tt.status, job.Status, job.Error)
+		}
+	}
+}
+
+func TestQueueAudioOnlySkipRules(t *testing.T) {
+	queue, err := NewQueue("")
+	if err != nil {
+		t.Fatalf("failed to create queue: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		tracks []ffmpeg.AudioTrack
+		status Status
+	}{
+		{"truehd", []ffmpeg.AudioTrack{{Codec: "truehd", Channels: 8}}, StatusPending},
+		{"dts-hd", []ffmpeg.AudioTrack{{Codec: "ac3"}, {Index: 1, Codec: "dts", Profile: "DTS-HD MA"}}, StatusPending},
+		{"lossy", []ffmpeg.AudioTrack{{Codec: "eac3"}, {Index: 1, Codec: "dts", Profile: "DTS"}}, StatusSkipped},
+	}
+	for _, tt := range tests {
+		probe := &ffmpeg.ProbeResult{Path: "/media/" + tt.name + ".mkv", Size: 1000000, Duration: 10 * time.Second,
+			VideoCodec: "hevc", IsHEVC: true, AudioTracks: tt.tracks}
+		job, _ := queue.Add(probe.Path, "compress-audio", probe)
+		if job.Status != tt.status {
+			t.Errorf("%s: expected %s, got %s (%s)", tt.name, tt.status, job.Status, job.Error)
+		}
+	}
+}
+
+func TestCheckSkipReasonExcessiveBitrate(t *testing.T) {
+	preset := &ffmpeg.Preset{Codec: ffmpeg.CodecHEVC, ReencodeAboveBPP: 0.2}
+	remux := &ffmpeg.ProbeResult{Width: 3840, Height: 2160, FrameRate: 24, Bitrate: 60_000_000, IsHEVC: true}
+	if reason := ffmpeg.SkipReason(remux, preset); reason != "" {
+		t.Errorf("expected a 60 Mbps HEVC remux to be queued, got skip %q", reason)
+	}
+	web := &ffmpeg.ProbeResult{Width: 1920, Height: 1080, FrameRate: 24, Bitrate: 4_000_000, IsHEVC: true}
+	if reason := ffmpeg.SkipReason(web, preset); reason == "" {
+		t.Error("expected a low-bitrate HEVC file to be skipped")
+	}
+}
+
+func TestQueueSkipsReencodingOwnOutput(t *testing.T) {
+	tmpDir := t.TempDir()
+	queueFile := filepath.Join(tmpDir, "queue.json")
+	inputPath := filepath.Join(tmpDir, "video.mp4")
+	outputPath := filepath.Join(tmpDir, "video.mkv")
+
+	queue, _ := NewQueue(queueFile)
+
+	probe := &ffmpeg.ProbeResult{
+		Path:     inputPath,
+		Size:     1000000,
+		Duration: 10 * time.Second,
+	}
+
+	job, _ := queue.Add(probe.Path, "compress-hevc", probe)
+	queue.StartJob(job.ID, "/tmp/temp.mkv", "cpu→cpu")
+	if err := os.WriteFile(outputPath, []byte("transcoded"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := queue.CompleteJob(job.ID, outputPath, 500000); err != nil {
+		t.Fatalf("failed to complete job: %v", err)
+	}
+
+	if presetID, ok := queue.OutputPreset(outputPath); !ok || presetID != "compress-hevc" {
+		t.Errorf("expected output to be attributed to compress-hevc, got %q", presetID)
+	}
+
+	// Producing preset survives a restart
+	queue, _ = NewQueue(queueFile)
+
+	outputProbe := &ffmpeg.ProbeResult{
+		Path:     outputPath,
+		Size:     500000,
+		Duration: 10 * time.Second,
+	}
+	again, _ := queue.Add(outputProbe.Path, "compress-av1", outputProbe)
+	if again.Status != StatusSkipped {
+		t.Fatalf("expected re-encode of own output to be skipped, got %s", again.Status)
+	}
+	if !strings.Contains(again.Error, "compress-hevc") {
+		t.Errorf("expected skip reason to name the producing preset, got %q", again.Error)
+	}
+
+	// Force retry is the escape hatch
+	if err := queue.ForceRetryJob(again.ID); err != nil {
+		t.Fatalf("force retry failed: %v", err)
+	}
+	if got := queue.Get(again.ID); got.Status != StatusPending || !got.ForceTranscode {
+		t.Errorf("expected forced pending job, got %s", got.Status)
+	}
+	queue.CancelJob(again.ID)
+
+	// A different file at the same path (e.g. an upgrade) is encoded as usual
+	if err := os.WriteFile(outputPath, []byte("a new download"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if replaced, _ := queue.Add(outputProbe.Path, "compress-av1", outputProbe); replaced.Status != StatusPending {
+		t.Errorf("expected a replaced output to be queued, got %s (%s)", replaced.Status, replaced.Error)
+	}
+}
+
 func TestQueueRunningJobsResetOnLoad(t *testing.T) {
 	tmpDir := t.TempDir()
 	queueFile := filepath.Join(tmpDir, "queue.json")
@@ -395,6 +523,157 @@ func TestQueueSubscription(t *testing.T) {
 	t.Log("Subscription working correctly")
 }
 
+func TestQueueSubscribeFrom(t *testing.T) {
+	queue, _ := NewQueue("")
+
+	first, _ := queue.Add("/media/a.mkv", "compress", &ffmpeg.ProbeResult{Path: "/media/a.mkv", Size: 1000})
+	seen := queue.LastEventID()
+	queue.UpdateProgress(first.ID, 50, 1.0, "1m")
+	second, _ := queue.Add("/media/b.mkv", "compress", &ffmpeg.ProbeResult{Path: "/media/b.mkv", Size: 1000})
+
+	ch, missed, ok := queue.SubscribeFrom(seen)
+	defer queue.Unsubscribe(ch)
+	if !ok {
+		t.Fatal("expected to resume from a recent event")
+	}
+	// Progress isn't replayed
+	if len(missed) != 1 || missed[0].Job.ID != second.ID || missed[0].ID <= seen {
+		t.Fatalf("expected only the second add to be replayed, got %+v", missed)
+	}
+
+	// An ID from before a restart can't be resumed
+	time.Sleep(time.Millisecond)
+	restarted, _ := NewQueue("")
+	ch2, _, ok := restarted.SubscribeFrom(seen)
+	defer restarted.Unsubscribe(ch2)
+	if ok {
+		t.Error("expected an ID from another queue not to resume")
+	}
+
+	// Nor one whose events have been dropped from the replay buffer
+	for i := 0; i < eventReplaySize; i++ {
+		queue.Notify("encoders_changed")
+	}
+	ch3, _, ok := queue.SubscribeFrom(seen)
+	defer queue.Unsubscribe(ch3)
+	if ok {
+		t.Error("expected resuming past the replay buffer to fail")
+	}
+}
+
+func TestSlowSubscriberCoalesces(t *testing.T) {
+	queue, _ := NewQueue("")
+	ch := queue.Subscribe()
+	defer queue.Unsubscribe(ch)
+
+	job, _ := queue.Add("/media/a.mkv", "compress", &ffmpeg.ProbeResult{Path: "/media/a.mkv", Size: 1000})
+	queue.StartJob(job.ID, "/tmp/a.tmp", "cpu→cpu")
+	for i := 1; i <= 300; i++ {
+		queue.UpdateProgress(job.ID, float64(i)/3, 1.0, "")
+	}
+	queue.CompleteJob(job.ID, "/media/a.out.mkv", 500)
+
+	// The channel holds 100 events; the rest were coalesced into the
+	// completion, which supersedes pending progress (one more may have been
+	// on its way into the channel)
+	var events []JobEvent
+	for len(events) < 200 {
+		select {
+		case event := <-ch:
+			events = append(events, event)
+			continue
+		case <-time.After(100 * time.Millisecond):
+		}
+		break
+	}
+	if len(events) < 101 || len(events) > 102 {
+		t.Fatalf("expected 101 or 102 events, got %d", len(events))
+	}
+	last := events[len(events)-1]
+	if last.Type != "complete" {
+		t.Errorf("expected the completion last, got %s", last.Type)
+	}
+	for i := 1; i < len(events); i++ {
+		if events[i].ID <= events[i-1].ID {
+			t.Fatalf("event IDs out of order: %d after %d", events[i].ID, events[i-1].ID)
+		}
+	}
+}
+
+func TestSlowSubscriberResync(t *testing.T) {
+	queue, _ := NewQueue("")
+	ch := queue.Subscribe()
+	defer queue.Unsubscribe(ch)
+
+	for i := 0; i < 100+maxPendingEvents+10; i++ {
+		path := fmt.Sprintf("/media/%d.mkv", i)
+		queue.Add(path, "compress", &ffmpeg.ProbeResult{Path: path, Size: 1000})
+	}
+
+	resynced := false
+	for !resynced {
+		select {
+		case event := <-ch:
+			resynced = event.Type == EventResync
+		case <-time.After(time.Second):
+			t.Fatal("expected a resync event")
+		}
+	}
+
+	// Events sent after the backlog was dropped may still arrive first
+	queue.Notify("encoders_changed")
+	for {
+		select {
+		case event := <-ch:
+			switch event.Type {
+			case "encoders_changed":
+				return
+			case EventResync:
+				t.Fatal("expected a single resync")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for event after resync")
+		}
+	}
+}
+
+func TestProgressBatching(t *testing.T) {
+	queue, _ := NewQueue("")
+	queue.SetProgressRate(20)
+	ch := queue.Subscribe()
+	defer queue.Unsubscribe(ch)
+
+	first, _ := queue.Add("/media/a.mkv", "compress", &ffmpeg.ProbeResult{Path: "/media/a.mkv", Size: 1000})
+	second, _ := queue.Add("/media/b.mkv", "compress", &ffmpeg.ProbeResult{Path: "/media/b.mkv", Size: 1000})
+	queue.StartJob(first.ID, "/tmp/a.tmp", "cpu→cpu")
+	queue.StartJob(second.ID, "/tmp/b.tmp", "cpu→cpu")
+	for i := 1; i <= 50; i++ {
+		queue.UpdateProgress(first.ID, float64(i), 1.0, "")
+		queue.UpdateProgress(second.ID, float64(i)/2, 1.0, "")
+	}
+
+	for {
+		select {
+		case event := <-ch:
+			if event.Type == "progress" {
+				t.Fatal("expected no individual progress events while batching")
+			}
+			if event.Type != "progress_batch" {
+				continue
+			}
+			if len(event.ProgressBatch) != 2 {
+				t.Fatalf("expected both jobs in one batch, got %+v", event.ProgressBatch)
+			}
+			if event.ProgressBatch[0].Progress != 50 || event.ProgressBatch[1].Progress != 25 {
+				t.Errorf("expected the latest progress of each job, got %+v", event.ProgressBatch)
+			}
+			return
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for progress_batch")
+		}
+	}
+}
+
 func TestAddSoftwareFallback(t *testing.T) {
 	queue, err := NewQueue("")
 	if err != nil {
@@ -459,6 +738,124 @@ func TestAddSoftwareFallback(t *testing.T) {
 	}
 }
 
+func TestAttempts(t *testing.T) {
+	queue, err := NewQueue("")
+	if err != nil {
+		t.Fatalf("failed to create queue: %v", err)
+	}
+
+	probe := &ffmpeg.ProbeResult{Path: "/media/video.mkv", Size: 1000000, Duration: 10 * time.Second}
+	job, _ := queue.Add(probe.Path, "compress-hevc", probe)
+	job.IsHardware = true
+	if err := queue.StartJob(job.ID, "/tmp/video.tmp", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// The fallback is queued before the hardware job is marked failed
+	fallback := queue.AddSoftwareFallback(job, "GPU encode failed, retried with CPU encode")
+	if fallback == nil {
+		t.Fatal("expected fallback job to be created")
+	}
+	if err := queue.FailJobWithDetails(job.ID, "vaapi: device not found", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	attempts, err := queue.Attempts(fallback.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attempts) != 2 {
+		t.Fatalf("expected 2 attempts, got %d", len(attempts))
+	}
+	if attempts[0].JobID != job.ID || attempts[0].RetriedBy != "fallback" {
+		t.Errorf("unexpected first attempt: %+v", attempts[0])
+	}
+	if attempts[0].Status != StatusFailed || attempts[0].Error != "vaapi: device not found" {
+		t.Errorf("expected the hardware failure reported, got %s %q", attempts[0].Status, attempts[0].Error)
+	}
+	if attempts[1].JobID != fallback.ID {
+		t.Errorf("expected the chain to end with the job itself, got %s", attempts[1].JobID)
+	}
+
+	// A retry with another preset carries the whole chain
+	queue.FailJob(fallback.ID, "libx265 crashed")
+	retry, err := queue.AddWith(AddOptions{RetryOf: queue.Get(fallback.ID), RetriedBy: "retry_preset"}, probe.Path, "compress-av1", probe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue.Remove(job.ID)
+	queue.Remove(fallback.ID)
+
+	attempts, _ = queue.Attempts(retry.ID)
+	if len(attempts) != 3 {
+		t.Fatalf("expected 3 attempts, got %d", len(attempts))
+	}
+	if attempts[0].Error != "vaapi: device not found" {
+		t.Errorf("expected the removed hardware attempt kept, got %q", attempts[0].Error)
+	}
+	if attempts[1].PresetID != "compress-hevc" || attempts[1].RetriedBy != "retry_preset" || attempts[1].Error != "libx265 crashed" {
+		t.Errorf("unexpected second attempt: %+v", attempts[1])
+	}
+
+	if _, err := queue.Attempts("missing"); err == nil {
+		t.Error("expected an error for an unknown job")
+	}
+}
+
+func TestTimeline(t *testing.T) {
+	queue, _ := NewQueue("")
+	job, _ := queue.AddWithoutProbe("/media/video.mkv", "compress-hevc", 1000000)
+	queue.recordEvent(job.ID, EventProbing, "")
+	if err := queue.UpdateJobAfterProbe(job.ID, &ffmpeg.ProbeResult{Path: job.InputPath, Size: 1000000, Duration: 10 * time.Second}); err != nil {
+		t.Fatal(err)
+	}
+	_ = queue.StartJob(job.ID, "/tmp/video.tmp", "vaapi→vaapi")
+	fallback := queue.AddSoftwareFallback(queue.Get(job.ID), "GPU encode failed")
+	queue.FailJob(job.ID, "vaapi: device not found")
+	_ = queue.StartJob(fallback.ID, "/tmp/video.tmp", "cpu→cpu")
+	queue.recordEvent(fallback.ID, EventFinalizing, "")
+	queue.CompleteJob(fallback.ID, "/media/video.mkv", 500000)
+
+	timeline, err := queue.Timeline(fallback.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []string
+	for _, step := range timeline.Events {
+		events = append(events, step.Event)
+	}
+	want := []string{EventQueued, EventProbing, EventProbed, EventStarted, EventHWFallback, EventStarted, EventFinalizing, string(StatusComplete)}
+	if !slices.Equal(events, want) {
+		t.Errorf("expected events %v, got %v", want, events)
+	}
+	if last := timeline.Events[len(timeline.Events)-1]; last.Phase != "" || last.Seconds != 0 {
+		t.Errorf("expected no phase after completion, got %+v", last)
+	}
+
+	// Phases add up the time between events
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+	running := &Job{ID: "j", Status: StatusRunning, CreatedAt: start, Timeline: []TimelineEvent{
+		{Event: EventQueued, At: at(0)},
+		{Event: EventProbing, At: at(10)},
+		{Event: EventProbed, At: at(11)},
+		{Event: EventWaitingDisk, At: at(20)},
+		{Event: EventStarted, At: at(30)},
+	}}
+	got := running.timeline(at(90))
+	wantPhases := map[string]float64{PhaseQueueWait: 19 * 60, PhaseProbe: 60, PhaseDiskWait: 600, PhaseEncode: 3600}
+	if !maps.Equal(got.Phases, wantPhases) {
+		t.Errorf("expected phases %v, got %v", wantPhases, got.Phases)
+	}
+	if got.TotalSeconds != 90*60 {
+		t.Errorf("expected 90 minutes in total, got %vs", got.TotalSeconds)
+	}
+
+	if _, err := queue.Timeline("missing"); err == nil {
+		t.Error("expected an error for an unknown job")
+	}
+}
+
 func TestAddSoftwareFallbackRateLimit(t *testing.T) {
 	queue, err := NewQueue("")
 	if err != nil {
@@ -471,9 +868,11 @@ func TestAddSoftwareFallbackRateLimit(t *testing.T) {
 		Duration: 10 * time.Second,
 	}
 
-	// Create 5 fallbacks (the rate limit max)
+	// Create 5 fallbacks (the rate limit max), each for its own file since
+	// a path is only queued once
 	for i := 0; i < 5; i++ {
-		job, _ := queue.Add(probe.Path, "compress-hevc", probe)
+		path := fmt.Sprintf("/media/video%d.mkv", i)
+		job, _ := queue.Add(path, "compress-hevc", probe)
 		job.IsHardware = true
 		fallback := queue.AddSoftwareFallback(job, "test fallback")
 		if fallback == nil {
@@ -519,3 +918,467 @@ func TestFailJobWithFallbackReason(t *testing.T) {
 		t.Errorf("unexpected FallbackReason: %s", failedJob.FallbackReason)
 	}
 }
+
+func TestQueueWaitForDisk(t *testing.T) {
+	queue, _ := NewQueue("")
+
+	probe := &ffmpeg.ProbeResult{
+		Path:     "/media/video.mkv",
+		Size:     1000000,
+		Duration: 10 * time.Second,
+	}
+
+	job, _ := queue.Add(probe.Path, "compress", probe)
+	ch := queue.Subscribe()
+	defer queue.Unsubscribe(ch)
+
+	if err := queue.WaitForDisk(job.ID, "low disk"); err != nil {
+		t.Fatalf("WaitForDisk failed: %v", err)
+	}
+	// Second call shouldn't emit another event
+	if err := queue.WaitForDisk(job.ID, "low disk"); err != nil {
+		t.Fatalf("WaitForDisk failed: %v", err)
+	}
+
+	got := queue.Get(job.ID)
+	if got.Status != StatusWaitingDisk {
+		t.Errorf("expected status waiting_disk, got %s", got.Status)
+	}
+	if got.Error != "low disk" {
+		t.Errorf("expected reason to be recorded, got %q", got.Error)
+	}
+
+	select {
+	case event := <-ch:
+		if event.Type != "waiting_disk" {
+			t.Errorf("expected event type 'waiting_disk', got %s", event.Type)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for event")
+	}
+	select {
+	case event := <-ch:
+		t.Errorf("unexpected second event %s", event.Type)
+	default:
+	}
+
+	if stats := queue.Stats(); stats.WaitingDisk != 1 {
+		t.Errorf("expected waiting_disk 1, got %d", stats.WaitingDisk)
+	}
+
+	// Waiting jobs are still picked up so workers can re-check space
+	if next := queue.GetNext(); next == nil || next.ID != job.ID {
+		t.Errorf("expected waiting job from GetNext, got %+v", next)
+	}
+
+	queue.StartJob(job.ID, "/tmp/temp.mkv", "cpu→cpu")
+	got = queue.Get(job.ID)
+	if got.Status != StatusRunning || got.Error != "" {
+		t.Errorf("expected running job with cleared error, got %s %q", got.Status, got.Error)
+	}
+}
+
+func TestQueueUpdateJob(t *testing.T) {
+	queue, _ := NewQueue("")
+
+	probe := &ffmpeg.ProbeResult{
+		Path:     "/media/video.mkv",
+		Size:     1000000,
+		Duration: 10 * time.Second,
+	}
+
+	job1, _ := queue.Add("/media/video1.mkv", "compress-hevc", probe)
+	job2, _ := queue.Add("/media/video2.mkv", "compress-hevc", probe)
+
+	events := queue.Subscribe()
+	defer queue.Unsubscribe(events)
+
+	priority := 10
+	tags := []string{" anime ", "anime", ""}
+	note := "check subs"
+	preset := "compress-av1"
+	updated, err := queue.UpdateJob(job2.ID, JobPatch{Priority: &priority, Tags: &tags, Note: &note, PresetID: &preset})
+	if err != nil {
+		t.Fatalf("UpdateJob failed: %v", err)
+	}
+	if updated.Priority != 10 || updated.Note != note || updated.PresetID != "compress-av1" {
+		t.Errorf("patch not applied: %+v", updated)
+	}
+	if len(updated.Tags) != 1 || updated.Tags[0] != "anime" {
+		t.Errorf("expected normalized tags [anime], got %v", updated.Tags)
+	}
+
+	select {
+	case event := <-events:
+		if event.Type != "updated" {
+			t.Errorf("expected updated event, got %s", event.Type)
+		}
+	case <-time.After(time.Second):
+		t.Error("expected an updated event")
+	}
+
+	// Higher priority jumps the queue
+	if next := queue.GetNext(); next == nil || next.ID != job2.ID {
+		t.Errorf("expected prioritized job2 next, got %+v", next)
+	}
+
+	// Invalid custom args reject the whole patch
+	newNote := "should not apply"
+	badArgs := []string{"-preset", "slow", "-i", "/etc/passwd"}
+	if _, err := queue.UpdateJob(job2.ID, JobPatch{Note: &newNote, CustomArgs: &badArgs}); err == nil {
+		t.Error("expected custom args with -i to be rejected")
+	}
+	if queue.Get(job2.ID).Note != note {
+		t.Error("expected failed patch to leave job unchanged")
+	}
+
+	// Pinning an encoder shows it as the job's encoder; "" unpins
+	qsv, none, unpin, bogus := "qsv", "none", "", "quantum"
+	if updated, err := queue.UpdateJob(job1.ID, JobPatch{PreferredEncoder: &qsv}); err != nil || updated.PreferredEncoder != ffmpeg.HWAccelQSV || updated.Encoder != "qsv" || !updated.IsHardware {
+		t.Errorf("pin to qsv: job %+v, err %v", updated, err)
+	}
+	if updated, _ := queue.UpdateJob(job1.ID, JobPatch{PreferredEncoder: &none}); updated.IsHardware {
+		t.Error("expected a job pinned to software to not be hardware")
+	}
+	if updated, _ := queue.UpdateJob(job1.ID, JobPatch{PreferredEncoder: &unpin}); updated.PreferredEncoder != "" || updated.Encoder != string(ffmpeg.GetPreset("compress-hevc").Encoder) {
+		t.Errorf("expected unpinned job to use its preset's encoder, got %+v", updated)
+	}
+	if _, err := queue.UpdateJob(job1.ID, JobPatch{PreferredEncoder: &bogus}); err == nil {
+		t.Error("expected unknown encoder to be rejected")
+	}
+
+	// Size targets are per job; negative sizes are rejected
+	target, negative := 700, -1
+	if updated, err := queue.UpdateJob(job1.ID, JobPatch{TargetSizeMB: &target}); err != nil || updated.TargetSizeMB != 700 {
+		t.Errorf("set target size: job %+v, err %v", updated, err)
+	}
+	if _, err := queue.UpdateJob(job1.ID, JobPatch{TargetSizeMB: &negative}); err == nil {
+		t.Error("expected negative target size to be rejected")
+	}
+	if preset, err := PresetForJob(queue.Get(job1.ID), ffmpeg.HDRHandlingPreserve); err != nil || preset.TargetBitrate == 0 {
+		t.Errorf("expected a target bitrate from the target size, got %+v (%v)", preset, err)
+	}
+
+	// Preset can't change once a job has started; notes still can
+	queue.StartJob(job1.ID, "/tmp/temp.mkv", "cpu→cpu")
+	if _, err := queue.UpdateJob(job1.ID, JobPatch{PresetID: &preset}); err == nil {
+		t.Error("expected preset change on running job to fail")
+	}
+	if _, err := queue.UpdateJob(job1.ID, JobPatch{Note: &note}); err != nil {
+		t.Errorf("expected note change on running job to succeed: %v", err)
+	}
+
+	if _, err := queue.UpdateJob("missing", JobPatch{Note: &note}); err == nil {
+		t.Error("expected error for unknown job")
+	}
+}
+
+func TestQueueUpdateJobPresetRechecks(t *testing.T) {
+	queueFile := filepath.Join(t.TempDir(), "queue.json")
+	queue, _ := NewQueue(queueFile)
+
+	// A 4K AV1 file: HEVC and 1080p would transcode it, AV1 would skip it
+	probe := &ffmpeg.ProbeResult{
+		Path:     "/media/video.mkv",
+		Size:     1_000_000_000,
+		Duration: 10 * time.Minute,
+		Height:   2160,
+		IsAV1:    true,
+	}
+	job, _ := queue.Add(probe.Path, "compress-hevc", probe)
+	before := job.EstimatedSize
+
+	av1, downscale := "compress-av1", "1080p"
+	if _, err := queue.UpdateJob(job.ID, JobPatch{PresetID: &av1}); err == nil {
+		t.Error("expected a preset that would skip the file to be refused")
+	}
+	if got := queue.Get(job.ID); got.PresetID != "compress-hevc" || got.Status != StatusPending {
+		t.Errorf("expected the refused change to leave the job alone, got %s %s", got.PresetID, got.Status)
+	}
+
+	updated, err := queue.UpdateJob(job.ID, JobPatch{PresetID: &downscale})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.EstimatedSize == before || updated.EstimatedSize == 0 {
+		t.Errorf("expected a new estimate for the 1080p preset, got %d (was %d)", updated.EstimatedSize, before)
+	}
+
+	// After a restart the probe is gone, so the job is probed again
+	reloaded, _ := NewQueue(queueFile)
+	if _, err := reloaded.UpdateJob(job.ID, JobPatch{PresetID: &av1}); err != nil {
+		t.Fatal(err)
+	}
+	if got := reloaded.Get(job.ID); got.Status != StatusPendingProbe || got.PresetID != "compress-av1" {
+		t.Errorf("expected the job to be re-probed for its new preset, got %s %s", got.Status, got.PresetID)
+	}
+}
+
+func TestQueueList(t *testing.T) {
+	queue, _ := NewQueue("")
+
+	sizes := map[string]int64{"c.mkv": 300, "a.mkv": 100, "b.mkv": 200, "d.mkv": 400}
+	var ids []string
+	for _, name := range []string{"c.mkv", "a.mkv", "b.mkv", "d.mkv"} {
+		probe := &ffmpeg.ProbeResult{Path: "/media/" + name, Size: sizes[name], Duration: time.Minute}
+		preset := "compress-hevc"
+		if name == "d.mkv" {
+			preset = "compress-av1"
+		}
+		job, err := queue.Add(probe.Path, preset, probe)
+		if err != nil {
+			t.Fatalf("failed to add job: %v", err)
+		}
+		ids = append(ids, job.ID)
+	}
+	queue.CancelJob(ids[0])
+
+	names := func(list []*Job) string {
+		var out []string
+		for _, job := range list {
+			out = append(out, filepath.Base(job.InputPath))
+		}
+		return strings.Join(out, ",")
+	}
+
+	tests := []struct {
+		name  string
+		opts  ListOptions
+		want  string
+		total int
+	}{
+		{"queue order", ListOptions{}, "c.mkv,a.mkv,b.mkv,d.mkv", 4},
+		{"status", ListOptions{Statuses: []Status{StatusPending}}, "a.mkv,b.mkv,d.mkv", 3},
+		{"preset", ListOptions{PresetID: "compress-av1"}, "d.mkv", 1},
+		{"name", ListOptions{Sort: "name"}, "a.mkv,b.mkv,c.mkv,d.mkv", 4},
+		{"size desc", ListOptions{Sort: "-size"}, "d.mkv,c.mkv,b.mkv,a.mkv", 4},
+		{"page", ListOptions{Sort: "name", Page: 2, PageSize: 3}, "d.mkv", 4},
+		{"past end", ListOptions{Page: 5, PageSize: 3}, "", 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.opts.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			list, total := queue.List(tt.opts)
+			if got := names(list); got != tt.want || total != tt.total {
+				t.Errorf("got %q (total %d), want %q (total %d)", got, total, tt.want, tt.total)
+			}
+		})
+	}
+
+	bad := ListOptions{Sort: "bogus"}
+	if err := bad.Validate(); err == nil {
+		t.Error("expected an unknown sort to be rejected")
+	}
+}
+
+func TestRecoverInterruptedCompletesStagedFinalize(t *testing.T) {
+	tmpDir := t.TempDir()
+	queueFile := filepath.Join(tmpDir, "queue.json")
+	input := filepath.Join(tmpDir, "video.mkv")
+	if err := os.WriteFile(input, []byte("original content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	queue, _ := NewQueue(queueFile)
+	job, _ := queue.Add(input, "compress", &ffmpeg.ProbeResult{Path: input, Size: 16, Duration: time.Minute})
+	queue.StartJob(job.ID, "", "")
+
+	// Simulate a crash between writing the journal and swapping the file
+	staged := filepath.Join(tmpDir, ".video.shrinkray.staged")
+	os.WriteFile(staged, []byte("small"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, ".video.shrinkray.journal"),
+		[]byte(`{"input":"`+input+`","staged":"`+staged+`","final":"`+input+`"}`), 0644)
+	if err := queue.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := NewQueue(queueFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	RecoverInterrupted(reloaded, nil)
+
+	got := reloaded.Get(job.ID)
+	if got.Status != StatusComplete || got.OutputSize != 5 {
+		t.Errorf("expected recovered job complete with 5 bytes, got %s/%d", got.Status, got.OutputSize)
+	}
+	if content, _ := os.ReadFile(input); string(content) != "small" {
+		t.Errorf("expected the staged output in place, got %q", content)
+	}
+}
+
+func TestQueueBatches(t *testing.T) {
+	queueFile := filepath.Join(t.TempDir(), "queue.json")
+	queue, _ := NewQueue(queueFile)
+
+	batch := queue.CreateBatch([]string{"/media/Season 1/"}, "compress", "alice")
+	if batch.Name != "Season 1" {
+		t.Errorf("expected batch named after the folder, got %q", batch.Name)
+	}
+	added, err := queue.AddMultipleWith(AddOptions{BatchID: batch.ID}, []*ffmpeg.ProbeResult{
+		{Path: "/media/Season 1/e1.mkv", Size: 1000},
+		{Path: "/media/Season 1/e2.mkv", Size: 3000},
+	}, "compress")
+	if err != nil || len(added) != 2 {
+		t.Fatalf("AddMultipleWith: %v, %d jobs", err, len(added))
+	}
+	other, _ := queue.Add("/media/other.mkv", "compress", &ffmpeg.ProbeResult{Path: "/media/other.mkv", Size: 1000})
+
+	// A paused batch's jobs are passed over
+	if err := queue.SetBatchPaused(batch.ID, true); err != nil {
+		t.Fatalf("SetBatchPaused: %v", err)
+	}
+	if next := queue.GetNext(); next == nil || next.ID != other.ID {
+		t.Fatalf("expected the job outside the paused batch next, got %+v", next)
+	}
+	if claimed := queue.ClaimNext("agent"); claimed == nil || claimed.ID != other.ID {
+		t.Fatalf("expected the job outside the paused batch to be claimed, got %+v", claimed)
+	}
+	if claimed := queue.ClaimNext("agent"); claimed != nil {
+		t.Fatalf("expected nothing claimable, got %s", claimed.InputPath)
+	}
+	if err := queue.SetBatchPaused(batch.ID, false); err != nil {
+		t.Fatalf("SetBatchPaused: %v", err)
+	}
+	if next := queue.GetNext(); next == nil || next.BatchID != batch.ID {
+		t.Fatalf("expected a batch job once resumed, got %+v", next)
+	}
+
+	// Progress is weighted by size
+	_ = queue.StartJob(added[0].ID, "/tmp/e1.tmp", "cpu→cpu")
+	_ = queue.CompleteJob(added[0].ID, "/media/Season 1/e1.out.mkv", 400)
+	summary, batchJobs := queue.GetBatch(batch.ID)
+	if summary == nil || len(batchJobs) != 2 {
+		t.Fatalf("expected the batch with 2 jobs, got %+v", summary)
+	}
+	if summary.Progress != 25 || summary.SpaceSaved != 600 || summary.InputSize != 4000 || summary.Done {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+	if summary.Counts[StatusComplete] != 1 || summary.Counts[StatusPending] != 1 {
+		t.Errorf("unexpected counts: %v", summary.Counts)
+	}
+
+	// Batches survive a restart
+	_ = queue.SetBatchPaused(batch.ID, true)
+	reloaded, err := NewQueue(queueFile)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	batches := reloaded.Batches()
+	if len(batches) != 1 || batches[0].ID != batch.ID || !batches[0].Paused || batches[0].CreatedBy != "alice" {
+		t.Fatalf("expected the paused batch after reload, got %+v", batches)
+	}
+
+	// A batch goes once its jobs do
+	reloaded.Clear(true)
+	if summary, _ := reloaded.GetBatch(batch.ID); summary != nil {
+		t.Errorf("expected the batch to be dropped with its jobs, got %+v", summary)
+	}
+}
+
+func TestQueueStatsETA(t *testing.T) {
+	queue, _ := NewQueue("")
+	queue.SetWorkers(2)
+
+	if stats := queue.Stats(); stats.ETASeconds != 0 || stats.EstimatedCompletion != nil {
+		t.Fatalf("expected no ETA for an empty queue, got %+v", stats)
+	}
+
+	var added []*Job
+	for i := 0; i < 3; i++ {
+		path := fmt.Sprintf("/media/e%d.mkv", i)
+		job, _ := queue.Add(path, "compress", &ffmpeg.ProbeResult{Path: path, Size: 1000, Duration: 10 * time.Minute})
+		added = append(added, job)
+	}
+
+	// The encoder has been doing 2x realtime
+	start := time.Now().Add(-time.Hour)
+	queue.mu.Lock()
+	queue.speeds.record(&Job{Encoder: added[0].Encoder, Duration: 600000, StartedAt: start, CompletedAt: start.Add(5 * time.Minute)})
+	queue.mu.Unlock()
+
+	// Three 5-minute encodes on two workers
+	if stats := queue.Stats(); stats.ETASeconds != 600 || stats.EstimatedCompletion == nil {
+		t.Errorf("expected a 600s ETA, got %ds", stats.ETASeconds)
+	}
+
+	// A running job finishes at its own speed: 5 minutes left at 4x
+	_ = queue.StartJob(added[0].ID, "/tmp/e0.tmp", "cpu→cpu")
+	queue.UpdateProgress(added[0].ID, 50, 4, "")
+	if stats := queue.Stats(); stats.ETASeconds != 375 {
+		t.Errorf("expected a 375s ETA, got %ds", stats.ETASeconds)
+	}
+}
+
+func TestQueueETABlendsEarlySpeed(t *testing.T) {
+	queue, _ := NewQueue("")
+	probe := &ffmpeg.ProbeResult{Path: "/media/uhd.mkv", Size: 1000, Duration: 10 * time.Minute, Height: 2160}
+	job, _ := queue.Add(probe.Path, "compress", probe)
+
+	// 1080p encodes run at 4x, 2160p ones at 1x
+	start := time.Now().Add(-time.Hour)
+	queue.mu.Lock()
+	queue.speeds.record(&Job{Encoder: job.Encoder, Height: 1080, Duration: 600000, StartedAt: start, CompletedAt: start.Add(150 * time.Second)})
+	queue.speeds.record(&Job{Encoder: job.Encoder, Height: 2160, Duration: 600000, StartedAt: start, CompletedAt: start.Add(10 * time.Minute)})
+	if speed, _ := queue.speeds.lookup(job.Encoder, 2160); speed != 1 {
+		t.Errorf("expected the 2160p average of 1x, got %v", speed)
+	}
+	if speed, _ := queue.speeds.lookup(job.Encoder, 720); speed != 2.5 {
+		t.Errorf("expected an unseen resolution to use the encoder average of 2.5x, got %v", speed)
+	}
+	queue.mu.Unlock()
+
+	// A 9x burst at 0% is all history: 10 minutes left at 1x
+	_ = queue.StartJob(job.ID, "/tmp/uhd.tmp", "cpu→cpu")
+	queue.UpdateProgress(job.ID, 0, 9, "1s")
+	if got := queue.Get(job.ID); got.ETA != formatDuration(10*time.Minute) {
+		t.Errorf("expected the history-based ETA, got %q", got.ETA)
+	}
+
+	// Past speedSettleProgress the job's own speed is trusted
+	queue.UpdateProgress(job.ID, 50, 2, "")
+	if got := queue.Get(job.ID); got.ETA != formatDuration(150*time.Second) {
+		t.Errorf("expected 5 minutes left at 2x, got %q", got.ETA)
+	}
+}
+
+func TestQueueSkipsDuplicates(t *testing.T) {
+	queue, _ := NewQueue("")
+	probe := &ffmpeg.ProbeResult{Path: "/media/a.mkv", Size: 1000, Duration: time.Minute}
+	first, err := queue.Add(probe.Path, "compress-hevc", probe)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := queue.Add(probe.Path, "compress-hevc", probe); !errors.Is(err, ErrAlreadyQueued) {
+		t.Errorf("expected ErrAlreadyQueued, got %v", err)
+	}
+
+	batch := queue.CreateBatch([]string{"/media"}, "compress-hevc", "")
+	added, _ := queue.AddMultipleWith(AddOptions{BatchID: batch.ID}, []*ffmpeg.ProbeResult{
+		probe,
+		{Path: "/media/b.mkv", Size: 1000},
+		{Path: "/media/b.mkv", Size: 1000},
+	}, "compress-hevc")
+	if len(added) != 1 || added[0].InputPath != "/media/b.mkv" {
+		t.Fatalf("expected only b.mkv added once, got %d jobs", len(added))
+	}
+	if summary, _ := queue.GetBatch(batch.ID); summary == nil || summary.Duplicates != 2 {
+		t.Errorf("expected 2 duplicates counted on the batch, got %+v", summary)
+	}
+
+	pending := queue.AddMultipleWithoutProbeWith(AddOptions{AllowDuplicates: true}, []FileInfo{{Path: probe.Path, Size: 1000}}, "compress-hevc")
+	if len(pending) != 1 {
+		t.Error("expected a duplicate queued when allowed")
+	}
+
+	// Finished jobs don't count
+	_ = queue.StartJob(first.ID, "/tmp/a.tmp", "cpu→cpu")
+	_ = queue.FailJob(first.ID, "boom")
+	_ = queue.CancelJob(pending[0].ID)
+	if _, err := queue.Add(probe.Path, "compress-hevc", probe); err != nil {
+		t.Errorf("expected a finished path queued again, got %v", err)
+	}
+}
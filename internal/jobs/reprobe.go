@@ -0,0 +1,67 @@
+package jobs
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/ffmpeg"
+)
+
+// sourceStat is what's recorded about a job's input file when it's probed
+type sourceStat struct {
+	modTime   time.Time
+	hardlinks int // 0 unless the file has other hard links
+}
+
+// statSource stats a job's input; a file that can't be read gives zeros
+func statSource(path string) sourceStat {
+	info, err := os.Stat(path)
+	if err != nil {
+		return sourceStat{}
+	}
+	source := sourceStat{modTime: info.ModTime()}
+	if links := ffmpeg.LinkCount(info); links > 1 {
+		source.hardlinks = links
+	}
+	return source
+}
+
+// SourceChanged reports whether a probed job's input no longer matches what
+// was probed, e.g. because Sonarr/Radarr replaced it with an upgrade while
+// the job waited. Jobs queued before modification times were recorded are
+// compared by size alone. A missing input isn't a change; the encode fails
+// on it as usual.
+func SourceChanged(job *Job) bool {
+	if job.NeedsProbe() {
+		return false
+	}
+	info, err := os.Stat(job.InputPath)
+	if err != nil {
+		return false
+	}
+	if info.Size() != job.InputSize {
+		return true
+	}
+	return !job.InputModTime.IsZero() && !info.ModTime().Equal(job.InputModTime)
+}
+
+// RefreshProbe replaces a pending job's probe results after its input
+// changed, skipping it if the new file no longer needs encoding.
+func (q *Queue) RefreshProbe(id string, probe *ffmpeg.ProbeResult) error {
+	source := statSource(probe.Path)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return fmt.Errorf("job not found: %s", id)
+	}
+	if job.Status != StatusPending {
+		return fmt.Errorf("job not pending: %s", job.Status)
+	}
+
+	q.applyProbeLocked(job, probe, source)
+	return nil
+}
@@ -0,0 +1,49 @@
+package jobs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/ffmpeg"
+)
+
+func TestRefreshProbeAfterSourceChanged(t *testing.T) {
+	input := filepath.Join(t.TempDir(), "Show.S01E01.mkv")
+	if err := os.WriteFile(input, []byte("h264 release"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	queue, _ := NewQueue("")
+	job, err := queue.Add(input, "compress-hevc", &ffmpeg.ProbeResult{Path: input, Size: 12, VideoCodec: "h264", Duration: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.InputModTime.IsZero() {
+		t.Fatal("expected the source's modification time recorded")
+	}
+	if SourceChanged(job) {
+		t.Fatal("untouched source reported as changed")
+	}
+
+	// Replaced by an HEVC upgrade of a different size
+	if err := os.WriteFile(input, []byte("hevc upgrade, larger"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !SourceChanged(job) {
+		t.Fatal("replaced source not detected")
+	}
+
+	upgrade := &ffmpeg.ProbeResult{Path: input, Size: 20, VideoCodec: "hevc", IsHEVC: true, Duration: time.Minute}
+	if err := queue.RefreshProbe(job.ID, upgrade); err != nil {
+		t.Fatal(err)
+	}
+	job = queue.Get(job.ID)
+	if job.Status != StatusSkipped || job.InputSize != 20 {
+		t.Errorf("expected the upgrade skipped with its new size, got %s size %d", job.Status, job.InputSize)
+	}
+	if SourceChanged(job) {
+		t.Error("source still reported as changed after probing again")
+	}
+}
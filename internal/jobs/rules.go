@@ -0,0 +1,30 @@
+package jobs
+
+import (
+	"github.com/gwlsn/shrinkray/internal/config"
+	"github.com/gwlsn/shrinkray/internal/ffmpeg"
+)
+
+// MatchRule reports whether probe meets every criterion of rule. Path,
+// preset and processed-state filtering are left to the caller.
+func MatchRule(rule config.Rule, probe *ffmpeg.ProbeResult) bool {
+	return ffmpeg.ProbeCriteria{
+		Codecs:         rule.Codecs,
+		MinSize:        rule.MinSizeMB * 1024 * 1024,
+		MinHeight:      rule.MinHeight,
+		MaxHeight:      rule.MaxHeight,
+		MinBitrateMbps: rule.MinBitrateMbps,
+		MaxBitrateMbps: rule.MaxBitrateMbps,
+	}.Matches(probe)
+}
+
+// FilterByRule returns the probes that match rule, in order
+func FilterByRule(rule config.Rule, probes []*ffmpeg.ProbeResult) []*ffmpeg.ProbeResult {
+	matches := make([]*ffmpeg.ProbeResult, 0, len(probes))
+	for _, probe := range probes {
+		if MatchRule(rule, probe) {
+			matches = append(matches, probe)
+		}
+	}
+	return matches
+}
@@ -0,0 +1,41 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/config"
+	"github.com/gwlsn/shrinkray/internal/ffmpeg"
+)
+
+func TestMatchRule(t *testing.T) {
+	// 20 Mbps 4K H.264, 3 Mbps 1080p H.264 (bitrate derived from size), 18 Mbps HEVC
+	big := &ffmpeg.ProbeResult{Path: "/media/TV/a.mkv", VideoCodec: "h264", Height: 2160, Bitrate: 20_000_000, Size: 9 << 30}
+	small := &ffmpeg.ProbeResult{Path: "/media/TV/b.mkv", VideoCodec: "h264", Height: 1080, Size: 1_350_000_000, Duration: time.Hour}
+	hevc := &ffmpeg.ProbeResult{Path: "/media/TV/c.mkv", VideoCodec: "hevc", Height: 2160, Bitrate: 18_000_000}
+
+	tests := []struct {
+		name string
+		rule config.Rule
+		want []*ffmpeg.ProbeResult
+	}{
+		{"no criteria", config.Rule{}, []*ffmpeg.ProbeResult{big, small, hevc}},
+		{"min bitrate", config.Rule{MinBitrateMbps: 15}, []*ffmpeg.ProbeResult{big, hevc}},
+		{"max bitrate uses derived bitrate", config.Rule{MaxBitrateMbps: 5}, []*ffmpeg.ProbeResult{small}},
+		{"codec", config.Rule{MinBitrateMbps: 15, Codecs: []string{"h264"}}, []*ffmpeg.ProbeResult{big}},
+		{"height", config.Rule{MinHeight: 1440}, []*ffmpeg.ProbeResult{big, hevc}},
+		{"size", config.Rule{MinSizeMB: 2048}, []*ffmpeg.ProbeResult{big}},
+	}
+	for _, tt := range tests {
+		got := FilterByRule(tt.rule, []*ffmpeg.ProbeResult{big, small, hevc})
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %d matches, want %d", tt.name, len(got), len(tt.want))
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: match %d = %s, want %s", tt.name, i, got[i].Path, tt.want[i].Path)
+			}
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package jobs
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/ffmpeg"
+)
+
+// SimulatedJob is one job's projected slot in a simulated timeline
+type SimulatedJob struct {
+	ID        string    `json:"id"`
+	InputPath string    `json:"input_path"`
+	Worker    int       `json:"worker"`
+	Start     time.Time `json:"start"`
+	Finish    time.Time `json:"finish"`
+	Seconds   float64   `json:"seconds"` // Projected encode time
+	Basis     string    `json:"basis"`   // "running", "history", "encoder", "any" or "default" (see Queue.jobSeconds)
+}
+
+// Simulation is a projected completion timeline for one worker count
+type Simulation struct {
+	Workers      int            `json:"workers"`
+	Jobs         []SimulatedJob `json:"jobs"`
+	TotalSeconds float64        `json:"total_seconds"`
+	Completion   time.Time      `json:"completion"`
+}
+
+// SpeedHistory summarizes the recent encode speeds the queue's ETAs use
+type SpeedHistory struct {
+	// Speeds is the mean realtime multiple keyed by encoder and resolution,
+	// e.g. "vaapi@1080"
+	Speeds map[string]float64 `json:"speeds"`
+	// EncoderSpeeds is the mean realtime multiple keyed by encoder
+	EncoderSpeeds map[string]float64 `json:"encoder_speeds"`
+	// Samples is the number of recent completed jobs the speeds are taken over
+	Samples int `json:"samples"`
+}
+
+// summary averages each of s's keys
+func (s encodeSpeeds) summary() SpeedHistory {
+	h := SpeedHistory{Speeds: map[string]float64{}, EncoderSpeeds: map[string]float64{}}
+	for key, speeds := range s {
+		if len(speeds) == 0 {
+			continue
+		}
+		if strings.Contains(key, "@") {
+			h.Speeds[key] = mean(speeds)
+			continue
+		}
+		h.EncoderSpeeds[key] = mean(speeds)
+		h.Samples += len(speeds)
+	}
+	return h
+}
+
+// estimatedJob is a snapshot of a job with its projected encode time
+type estimatedJob struct {
+	job     Job
+	seconds float64
+	basis   string
+}
+
+// simulate assigns jobs in queue order to whichever worker frees up first.
+// Software encodes share the CPU, so their speed is scaled by
+// currentWorkers/workers; hardware encodes are assumed to run independently.
+func simulate(active []estimatedJob, workers, currentWorkers int, now time.Time) *Simulation {
+	if workers < 1 {
+		workers = 1
+	}
+	if currentWorkers < 1 {
+		currentWorkers = 1
+	}
+
+	sim := &Simulation{Workers: workers, Jobs: make([]SimulatedJob, 0, len(active)), Completion: now}
+	free := make([]time.Time, workers)
+	for i := range free {
+		free[i] = now
+	}
+
+	// Running jobs keep their worker; queued jobs follow in order
+	ordered := append([]estimatedJob(nil), active...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].job.Status == StatusRunning && ordered[j].job.Status != StatusRunning
+	})
+
+	for _, e := range ordered {
+		job, secs, basis := &e.job, e.seconds, e.basis
+		if job.Encoder == string(ffmpeg.HWAccelNone) && basis != "running" {
+			secs *= float64(workers) / float64(currentWorkers)
+		}
+
+		slot := 0
+		for i := range free {
+			if free[i].Before(free[slot]) {
+				slot = i
+			}
+		}
+		start := free[slot]
+		finish := start.Add(time.Duration(secs * float64(time.Second)))
+		free[slot] = finish
+
+		sim.Jobs = append(sim.Jobs, SimulatedJob{
+			ID:        job.ID,
+			InputPath: job.InputPath,
+			Worker:    slot,
+			Start:     start,
+			Finish:    finish,
+			Seconds:   secs,
+			Basis:     basis,
+		})
+		if finish.After(sim.Completion) {
+			sim.Completion = finish
+		}
+	}
+
+	sim.TotalSeconds = sim.Completion.Sub(now).Seconds()
+	return sim
+}
+
+// Simulate projects a completion timeline for the running and queued jobs
+// for each worker count, using the same recent encode speeds as the ETAs
+// in Stats.
+func (q *Queue) Simulate(workerCounts []int, currentWorkers int) (SpeedHistory, []*Simulation) {
+	q.mu.RLock()
+	avgDuration := q.averageDuration()
+	var active []estimatedJob
+	for _, id := range q.order {
+		job, ok := q.jobs[id]
+		if !ok || (job.Status != StatusRunning && !job.IsWorkable()) {
+			continue
+		}
+		// Copy so the simulation doesn't race with workers updating progress
+		secs, basis := q.jobSeconds(job, avgDuration)
+		active = append(active, estimatedJob{job: *job, seconds: secs, basis: basis})
+	}
+	history := q.speeds.summary()
+	q.mu.RUnlock()
+
+	now := time.Now()
+	sims := make([]*Simulation, 0, len(workerCounts))
+	for _, n := range workerCounts {
+		sims = append(sims, simulate(active, n, currentWorkers, now))
+	}
+	return history, sims
+}
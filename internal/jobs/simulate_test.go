@@ -0,0 +1,94 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/ffmpeg"
+)
+
+func TestSimulate(t *testing.T) {
+	active := []estimatedJob{
+		{job: Job{ID: "a", Status: StatusPending, Encoder: "vaapi"}, seconds: 100, basis: "history"},
+		{job: Job{ID: "b", Status: StatusPending, Encoder: "vaapi"}, seconds: 100, basis: "encoder"},
+		{job: Job{ID: "c", Status: StatusPendingProbe, Encoder: "vaapi"}, seconds: 100, basis: "any"},
+		{job: Job{ID: "r", Status: StatusRunning, Encoder: "vaapi"}, seconds: 10, basis: "running"},
+	}
+
+	now := time.Now()
+	one := simulate(active, 1, 1, now)
+	if len(one.Jobs) != 4 || one.Jobs[0].ID != "r" {
+		t.Fatalf("expected running job first, got %+v", one.Jobs)
+	}
+	// 10 + 100 + 100 + 100 seconds back to back
+	if one.TotalSeconds != 310 {
+		t.Errorf("expected 310s with one worker, got %f", one.TotalSeconds)
+	}
+
+	two := simulate(active, 2, 1, now)
+	if two.TotalSeconds >= one.TotalSeconds {
+		t.Errorf("expected two hardware workers to finish sooner: %f >= %f", two.TotalSeconds, one.TotalSeconds)
+	}
+}
+
+func TestSimulateSoftwareSharesCPU(t *testing.T) {
+	active := []estimatedJob{
+		{job: Job{ID: "a", Status: StatusPending, Encoder: "none"}, seconds: 100, basis: "encoder"},
+		{job: Job{ID: "b", Status: StatusPending, Encoder: "none"}, seconds: 100, basis: "encoder"},
+	}
+
+	now := time.Now()
+	one := simulate(active, 1, 1, now)
+	two := simulate(active, 2, 1, now)
+	if one.TotalSeconds != two.TotalSeconds {
+		t.Errorf("expected CPU-bound encodes not to speed up with more workers: %f vs %f", one.TotalSeconds, two.TotalSeconds)
+	}
+}
+
+func TestQueueSimulateUsesETASpeeds(t *testing.T) {
+	queue, _ := NewQueue("")
+	hd := &ffmpeg.ProbeResult{Path: "/media/hd.mkv", Size: 1000, Duration: 10 * time.Minute, Height: 1080}
+	uhd := &ffmpeg.ProbeResult{Path: "/media/uhd.mkv", Size: 1000, Duration: 10 * time.Minute, Height: 2160}
+	running := &ffmpeg.ProbeResult{Path: "/media/running.mkv", Size: 1000, Duration: 10 * time.Minute, Height: 1080}
+	hdJob, _ := queue.Add(hd.Path, "compress", hd)
+	uhdJob, _ := queue.Add(uhd.Path, "compress", uhd)
+	runningJob, _ := queue.Add(running.Path, "compress", running)
+	unprobed, _ := queue.AddWithoutProbe("/media/new.mkv", "compress", 1000)
+
+	// 1080p encodes have been doing 4x realtime
+	start := time.Now().Add(-time.Hour)
+	queue.mu.Lock()
+	queue.speeds.record(&Job{Encoder: hdJob.Encoder, Height: 1080, Duration: 600000, StartedAt: start, CompletedAt: start.Add(150 * time.Second)})
+	queue.mu.Unlock()
+
+	_ = queue.StartJob(runningJob.ID, "/tmp/running.tmp", "cpu→cpu")
+	queue.UpdateProgress(runningJob.ID, 50, 4, "")
+
+	history, sims := queue.Simulate([]int{1}, 1)
+	if history.Samples != 1 || history.EncoderSpeeds[hdJob.Encoder] != 4 || history.Speeds[speedKey(hdJob.Encoder, 1080)] != 4 {
+		t.Fatalf("unexpected history: %+v", history)
+	}
+
+	// The unprobed job is assumed as long as the probed ones and, like the
+	// 2160p one, falls back to the encoder's speed at any resolution
+	want := map[string]struct {
+		seconds float64
+		basis   string
+	}{
+		runningJob.ID: {75, "running"},
+		hdJob.ID:      {150, "history"},
+		uhdJob.ID:     {150, "encoder"},
+		unprobed.ID:   {150, "encoder"},
+	}
+	for _, j := range sims[0].Jobs {
+		if w := want[j.ID]; j.Seconds != w.seconds || j.Basis != w.basis {
+			t.Errorf("job %s: %vs from %s, want %vs from %s", j.InputPath, j.Seconds, j.Basis, w.seconds, w.basis)
+		}
+	}
+
+	// Stats' ETA agrees with the simulation for the same worker count
+	queue.SetWorkers(1)
+	if stats := queue.Stats(); stats.ETASeconds != int64(sims[0].TotalSeconds) {
+		t.Errorf("expected the ETA to match the simulation's %vs, got %ds", sims[0].TotalSeconds, stats.ETASeconds)
+	}
+}
@@ -0,0 +1,187 @@
+package jobs
+
+import (
+	"sync"
+)
+
+// EventResync is sent to a subscriber that fell too far behind: its
+// backlog was discarded, and it should reload the full state. Events sent
+// while the resync was on its way may follow it; they're already included
+// in the state reloaded after it, so applying them again is harmless.
+const EventResync = "resync"
+
+// maxPendingEvents is how many coalesced events a subscriber may have
+// waiting before it is considered too slow and told to resync
+const maxPendingEvents = 500
+
+// subscriber buffers events for one Subscribe channel. Events that don't fit
+// in the channel wait in pending, where a newer event about the same job (or
+// of the same type, for events not about a job) replaces the older one, so a
+// slow client still ends up with the latest state instead of missing
+// arbitrary updates. Pending events stay in ID order, so a client resuming
+// from the last ID it saw doesn't skip any.
+type subscriber struct {
+	out  chan JobEvent
+	wake chan struct{}
+	done chan struct{}
+	exit chan struct{}
+
+	mu       sync.Mutex
+	pending  []JobEvent
+	keys     map[string]int // Coalescing key -> index in pending
+	resync   bool
+	inFlight bool // The pump is sending an event taken from pending
+}
+
+func newSubscriber() *subscriber {
+	s := &subscriber{
+		out:  make(chan JobEvent, 100),
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+		exit: make(chan struct{}),
+		keys: make(map[string]int),
+	}
+	go s.pump()
+	return s
+}
+
+// send delivers event right away if the channel has room and nothing is
+// waiting; otherwise it's queued for the pump.
+func (s *subscriber) send(event JobEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.pending) == 0 && !s.resync && !s.inFlight {
+		select {
+		case s.out <- event:
+			return
+		default:
+		}
+	}
+	if s.resync {
+		// Everything is reloaded anyway
+		return
+	}
+
+	key := coalesceKey(event)
+	if i, ok := s.keys[key]; ok {
+		if event.ProgressBatch != nil {
+			event.ProgressBatch = mergeProgress(s.pending[i].ProgressBatch, event.ProgressBatch)
+		}
+		s.remove(i)
+	}
+	if event.Job != nil {
+		// The job's new state supersedes its pending progress
+		if i, ok := s.keys["progress:"+event.Job.ID]; ok {
+			s.remove(i)
+		}
+	}
+	if key != "" {
+		s.keys[key] = len(s.pending)
+	}
+	s.pending = append(s.pending, event)
+
+	if len(s.pending) > maxPendingEvents {
+		queueLog.Warn("Event subscriber is too slow, forcing a resync", "pending", len(s.pending))
+		s.pending = nil
+		s.keys = make(map[string]int)
+		s.resync = true
+	}
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next takes the oldest waiting event, after the previous one was sent
+func (s *subscriber) next() (JobEvent, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.inFlight = false
+	if s.resync {
+		s.resync = false
+		s.inFlight = true
+		return JobEvent{Type: EventResync}, true
+	}
+	if len(s.pending) == 0 {
+		return JobEvent{}, false
+	}
+	event := s.pending[0]
+	s.remove(0)
+	s.inFlight = true
+	return event, true
+}
+
+// remove drops pending[i]. Must hold s.mu.
+func (s *subscriber) remove(i int) {
+	delete(s.keys, coalesceKey(s.pending[i]))
+	s.pending = append(s.pending[:i], s.pending[i+1:]...)
+	for key, j := range s.keys {
+		if j > i {
+			s.keys[key] = j - 1
+		}
+	}
+}
+
+// pump moves waiting events into the channel as the client reads it
+func (s *subscriber) pump() {
+	defer close(s.exit)
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.wake:
+		}
+		for {
+			event, ok := s.next()
+			if !ok {
+				break
+			}
+			select {
+			case s.out <- event:
+			case <-s.done:
+				return
+			}
+		}
+	}
+}
+
+// close stops the pump and closes the channel
+func (s *subscriber) close() {
+	close(s.done)
+	<-s.exit
+	close(s.out)
+}
+
+// coalesceKey identifies the events a newer one supersedes; "" means the
+// event is always kept
+func coalesceKey(event JobEvent) string {
+	switch {
+	case event.ProgressUpdate != nil:
+		return "progress:" + event.ProgressUpdate.ID
+	case event.Job != nil:
+		return "job:" + event.Job.ID
+	case event.Batch != nil:
+		return "batch:" + event.Batch.ID
+	case event.Jobs != nil:
+		return ""
+	}
+	return "type:" + event.Type
+}
+
+// mergeProgress combines two progress batches, newer updates winning
+func mergeProgress(older, newer []ProgressUpdate) []ProgressUpdate {
+	merged := make([]ProgressUpdate, 0, len(older)+len(newer))
+	updated := make(map[string]bool, len(newer))
+	for _, update := range newer {
+		updated[update.ID] = true
+	}
+	for _, update := range older {
+		if !updated[update.ID] {
+			merged = append(merged, update)
+		}
+	}
+	return append(merged, newer...)
+}
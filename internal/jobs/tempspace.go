@@ -0,0 +1,112 @@
+package jobs
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/diskspace"
+	"github.com/gwlsn/shrinkray/internal/ffmpeg"
+)
+
+// tempReservation is a running job's claim on its temp filesystem: the
+// output it is projected to write, of which the temp file already holds part
+type tempReservation struct {
+	device    uint64
+	tempPath  string
+	projected int64
+}
+
+// outstanding is how much more the job is expected to write
+func (r tempReservation) outstanding() int64 {
+	var written int64
+	if info, err := os.Stat(r.tempPath); err == nil {
+		written = info.Size()
+	}
+	return max(0, r.projected-written)
+}
+
+// ProjectedOutputSize is how large the job's temp file is expected to grow:
+// its target size, otherwise the pessimistic end of the preset's size
+// estimate, otherwise the source's own size. A chunked encode also needs
+// room for its split and encoded segments.
+func ProjectedOutputSize(job *Job, preset *ffmpeg.Preset) int64 {
+	projected := projectedEncodeSize(job, preset)
+	if preset.Chunks > 1 {
+		return job.InputSize + 2*projected
+	}
+	return projected
+}
+
+// projectedEncodeSize is the expected size of the job's encoded output
+func projectedEncodeSize(job *Job, preset *ffmpeg.Preset) int64 {
+	if job.TargetSizeMB > 0 {
+		return int64(job.TargetSizeMB) << 20
+	}
+	probe := &ffmpeg.ProbeResult{
+		Size:       job.InputSize,
+		Duration:   time.Duration(job.Duration) * time.Millisecond,
+		VideoCodec: job.VideoCodec,
+		Height:     job.Height,
+		IsHEVC:     job.VideoCodec == "hevc",
+		IsAV1:      job.VideoCodec == "av1",
+	}
+	for _, track := range job.AudioTracks {
+		probe.Streams = append(probe.Streams, ffmpeg.ProbeStream{
+			Type: "audio", Codec: track.Codec, Channels: track.Channels, Bitrate: track.Bitrate,
+		})
+	}
+	if est := ffmpeg.EstimateTranscode(probe, preset); est != nil && est.MaxSize > 0 {
+		return est.MaxSize
+	}
+	return job.InputSize
+}
+
+// reserveTemp admits a job whose output is projected to take projected
+// bytes in tempDir, if that fits in the free space alongside what the jobs
+// already running on the same filesystem are still expected to write (and
+// min_free_space_mb). It returns a release func for when the job ends, or
+// the reason it has to wait. A job is always admitted when nothing else is
+// writing there, since waiting wouldn't free any space.
+func (p *WorkerPool) reserveTemp(job *Job, tempDir, tempPath string, projected int64) (func(), string) {
+	if !p.cfg.ReserveTempSpace || projected <= 0 {
+		return func() {}, ""
+	}
+	device, err := diskspace.Device(tempDir)
+	if err != nil {
+		workerLog.Warn("Could not check temp filesystem", "dir", tempDir, "error", err)
+		return func() {}, ""
+	}
+
+	p.tempMu.Lock()
+	defer p.tempMu.Unlock()
+
+	var pending int64
+	others := 0
+	for _, r := range p.tempReservations {
+		if r.device == device {
+			pending += r.outstanding()
+			others++
+		}
+	}
+	if others > 0 {
+		free, err := diskspace.Free(tempDir)
+		if err == nil {
+			available := int64(free) - p.cfg.MinFreeSpaceMB*1024*1024 - pending
+			if projected > available {
+				return nil, fmt.Sprintf("Waiting for temp space: this job needs about %s in %s, running jobs need %s more of the %s free",
+					ffmpeg.FormatBytes(projected), tempDir, ffmpeg.FormatBytes(pending), ffmpeg.FormatBytes(int64(free)))
+			}
+		}
+	}
+
+	if p.tempReservations == nil {
+		p.tempReservations = make(map[string]tempReservation)
+	}
+	p.tempReservations[job.ID] = tempReservation{device: device, tempPath: tempPath, projected: projected}
+	return func() {
+		p.tempMu.Lock()
+		delete(p.tempReservations, job.ID)
+		p.tempMu.Unlock()
+	}, ""
+}
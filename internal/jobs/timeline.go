@@ -0,0 +1,162 @@
+package jobs
+
+import (
+	"fmt"
+	"time"
+)
+
+// Timeline events. A job that ends records its final status (complete,
+// failed, skipped, ...) as the last event.
+const (
+	EventQueued      = "queued"
+	EventProbing     = "probing"
+	EventProbed      = "probed"
+	EventWaitingDisk = "waiting_disk"
+	EventStarted     = "started"
+	EventFinalizing  = "finalizing"  // Encode done; checking and moving the output into place
+	EventRequeued    = "requeued"    // Back in the queue after a shutdown, stall or retry
+	EventHWFallback  = "hw_fallback" // The hardware encode failed and this software job took over
+)
+
+// Phases of a job's time, between one timeline event and the next
+const (
+	PhaseQueueWait = "queue_wait"
+	PhaseProbe     = "probe"
+	PhaseDiskWait  = "disk_wait"
+	PhaseEncode    = "encode"
+	PhaseFinalize  = "finalize"
+)
+
+// maxTimelineEvents caps a job's timeline; a job requeued over and over
+// keeps its first event and its latest ones
+const maxTimelineEvents = 64
+
+// TimelineEvent is a state change in a job's life
+type TimelineEvent struct {
+	Event  string    `json:"event"`
+	At     time.Time `json:"at"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+// TimelineStep is an event with how long the job then spent before the next
+// one (or until now, for the latest event of an unfinished job)
+type TimelineStep struct {
+	TimelineEvent
+	Phase   string  `json:"phase,omitempty"`
+	Seconds float64 `json:"seconds,omitempty"`
+}
+
+// Timeline is a job's state changes with the time spent in each phase
+type Timeline struct {
+	JobID        string             `json:"job_id"`
+	Status       Status             `json:"status"`
+	Events       []TimelineStep     `json:"events"`
+	Phases       map[string]float64 `json:"phases"` // Seconds spent in each phase
+	TotalSeconds float64            `json:"total_seconds"`
+}
+
+// timelineEvents returns the job's events, starting with when it was
+// queued (jobs queued before timelines were recorded only have that)
+func (j *Job) timelineEvents() []TimelineEvent {
+	if len(j.Timeline) > 0 && j.Timeline[0].Event == EventQueued {
+		return j.Timeline
+	}
+	return append([]TimelineEvent{{Event: EventQueued, At: j.CreatedAt}}, j.Timeline...)
+}
+
+// recordEvent adds an event to the job's timeline. Must hold q.mu.
+func (j *Job) recordEvent(event, detail string) {
+	events := append(j.timelineEvents(), TimelineEvent{Event: event, At: time.Now(), Detail: detail})
+	if len(events) > maxTimelineEvents {
+		events = append(events[:1], events[len(events)-maxTimelineEvents+1:]...)
+	}
+	j.Timeline = events
+}
+
+// fallbackTimeline starts a software fallback's timeline with the hardware
+// job it replaces
+func fallbackTimeline(original *Job, reason string) []TimelineEvent {
+	events := append([]TimelineEvent(nil), original.timelineEvents()...)
+	return append(events, TimelineEvent{Event: EventHWFallback, At: time.Now(), Detail: reason})
+}
+
+// phaseAfter is what a job does after an event, or "" once it has ended
+func phaseAfter(event string) string {
+	switch event {
+	case EventQueued, EventProbed, EventRequeued, EventHWFallback:
+		return PhaseQueueWait
+	case EventProbing:
+		return PhaseProbe
+	case EventWaitingDisk:
+		return PhaseDiskWait
+	case EventStarted:
+		return PhaseEncode
+	case EventFinalizing:
+		return PhaseFinalize
+	}
+	return ""
+}
+
+// recordEvent adds an event to a job's timeline without broadcasting it,
+// for steps within a state: probing and finalizing
+func (q *Queue) recordEvent(id, event, detail string) {
+	q.mu.Lock()
+	job, ok := q.jobs[id]
+	if ok {
+		job.recordEvent(event, detail)
+	}
+	q.mu.Unlock()
+
+	if ok {
+		q.scheduleSave()
+	}
+}
+
+// Timeline returns a job's state changes and how long it spent queued,
+// probing, waiting for disk space, encoding and finalizing. A software
+// fallback's timeline includes the hardware job it replaced.
+func (q *Queue) Timeline(id string) (*Timeline, error) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return nil, fmt.Errorf("job not found: %s", id)
+	}
+	return job.timeline(time.Now()), nil
+}
+
+// timeline works out the job's phases, with an unfinished job's latest
+// phase running until now. Must hold q.mu.
+func (j *Job) timeline(now time.Time) *Timeline {
+	events := j.timelineEvents()
+	t := &Timeline{
+		JobID:  j.ID,
+		Status: j.Status,
+		Events: make([]TimelineStep, len(events)),
+		Phases: make(map[string]float64),
+	}
+	for i, event := range events {
+		step := TimelineStep{TimelineEvent: event, Phase: phaseAfter(event.Event)}
+		if step.Phase != "" {
+			end := now
+			if i+1 < len(events) {
+				end = events[i+1].At
+			} else if j.IsTerminal() {
+				// Ended without its final status recorded
+				step.Phase = ""
+			}
+			if step.Phase != "" && end.After(event.At) {
+				step.Seconds = end.Sub(event.At).Seconds()
+				t.Phases[step.Phase] += step.Seconds
+			}
+		}
+		t.Events[i] = step
+	}
+	end := now
+	if last := events[len(events)-1]; phaseAfter(last.Event) == "" || j.IsTerminal() {
+		end = last.At
+	}
+	t.TotalSeconds = end.Sub(events[0].At).Seconds()
+	return t
+}
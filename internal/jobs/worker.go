@@ -2,20 +2,60 @@ package jobs
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"runtime/debug"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gwlsn/shrinkray/internal/config"
+	"github.com/gwlsn/shrinkray/internal/diskspace"
+	"github.com/gwlsn/shrinkray/internal/energy"
 	"github.com/gwlsn/shrinkray/internal/ffmpeg"
+	"github.com/gwlsn/shrinkray/internal/logger"
+	"github.com/gwlsn/shrinkray/internal/trash"
 )
 
+var (
+	workerLog  = logger.For("worker")
+	recoverLog = logger.For("recover")
+)
+
+// diskRecheckInterval is how long a worker waits before retrying a job that
+// was blocked on free disk space.
+var diskRecheckInterval = time.Minute
+
+// stallUnit is the unit of stall_timeout_minutes, and encodeHourUnit of
+// max_encode_hours; tests shrink them.
+var (
+	stallUnit      = time.Minute
+	encodeHourUnit = time.Hour
+)
+
+// devicesFor lists the GPUs jobs on an encoder can be spread across; tests
+// swap it to fake multiple GPUs.
+var devicesFor = ffmpeg.DevicesFor
+
+// WorkerPanic records a recovered worker panic for diagnostics
+type WorkerPanic struct {
+	WorkerID int       `json:"worker_id"`
+	JobID    string    `json:"job_id,omitempty"`
+	Value    string    `json:"value"`
+	Stack    string    `json:"stack"`
+	Time     time.Time `json:"time"`
+}
+
 // CacheInvalidator is called when a file is transcoded to invalidate cached probe data
 type CacheInvalidator func(path string)
 
+// CompletionHook is called after a job completes and its output is in place
+type CompletionHook func(inputPath, outputPath string)
+
 // Worker processes transcoding jobs from the queue
 type Worker struct {
 	id              int
@@ -24,17 +64,52 @@ type Worker struct {
 	prober          *ffmpeg.Prober
 	cfg             *config.Config
 	invalidateCache CacheInvalidator
+	onPanic         func(WorkerPanic) // Called after a panic is recovered
+	onComplete      CompletionHook
+	trash           *trash.Store  // Where replaced originals go when trash_originals is on
+	log             *slog.Logger  // Tagged with the worker ID
+	draining        *atomic.Bool  // Set by the pool on shutdown: finish the current job, take no more
+	shutdown        chan struct{} // Closed when draining is set, to wake idle waits
+	drain           atomic.Bool   // Set by DrainWorker: finish the current job, then leave the pool
+	onDrained       func(*Worker)
+	pickDevice      func(*Worker, ffmpeg.HWAccel) string
+	reserveTemp     func(job *Job, tempDir, tempPath string, projected int64) (func(), string)
+	energy          *energy.Tracker // Set when energy use can be tracked (see SetEnergyTracker)
+	startedAt       time.Time
 
 	ctx    context.Context
 	cancel context.CancelFunc
 	wg     sync.WaitGroup
 
-	// Currently running job (for cancellation)
+	// Currently running job (for cancellation) and what it is doing
 	currentJobMu sync.Mutex
 	currentJob   *Job
 	jobCancel    context.CancelFunc
+	jobEncoder   ffmpeg.HWAccel
+	jobDevice    string
+	jobHWPath    string
+	jobFPS       float64
+	jobSpeed     float64
+}
+
+// WorkerStatus is a snapshot of one local worker for GET /api/workers
+type WorkerStatus struct {
+	ID            int       `json:"id"`
+	State         string    `json:"state"` // "idle", "busy", or "draining"
+	JobID         string    `json:"job_id,omitempty"`
+	InputPath     string    `json:"input_path,omitempty"`
+	Encoder       string    `json:"encoder,omitempty"`       // e.g. "vaapi", "none"
+	HardwarePath  string    `json:"hardware_path,omitempty"` // decode→encode, e.g. "vaapi→vaapi"
+	Device        string    `json:"device,omitempty"`        // GPU device, e.g. /dev/dri/renderD128
+	FPS           float64   `json:"fps,omitempty"`
+	Speed         float64   `json:"speed,omitempty"`
+	StartedAt     time.Time `json:"started_at"`
+	UptimeSeconds int64     `json:"uptime_secs"`
 }
 
+// ErrWorkerNotFound is returned by DrainWorker for unknown worker IDs
+var ErrWorkerNotFound = errors.New("worker not found")
+
 // WorkerPool manages multiple workers
 type WorkerPool struct {
 	mu              sync.Mutex
@@ -42,7 +117,28 @@ type WorkerPool struct {
 	queue           *Queue
 	cfg             *config.Config
 	invalidateCache CacheInvalidator
+	onComplete      CompletionHook
+	trash           *trash.Store
+	energy          *energy.Tracker
 	nextWorkerID    int
+	draining        atomic.Bool
+	shutdown        chan struct{} // Closed by Shutdown
+	shutdownOnce    sync.Once
+
+	// Crash tracking - separate lock since panics can happen while mu is held
+	panicMu   sync.Mutex
+	restarts  int
+	lastPanic *WorkerPanic
+
+	// deviceMu serializes GPU assignment so concurrent job starts see each
+	// other's devices; nextDevice rotates ties between equally busy GPUs
+	deviceMu   sync.Mutex
+	nextDevice int
+
+	// tempReservations holds running jobs' projected temp output by job ID,
+	// so jobs only start when their output fits (see reserveTemp)
+	tempMu           sync.Mutex
+	tempReservations map[string]tempReservation
 
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -58,6 +154,7 @@ func NewWorkerPool(queue *Queue, cfg *config.Config, invalidateCache CacheInvali
 		cfg:             cfg,
 		invalidateCache: invalidateCache,
 		nextWorkerID:    0,
+		shutdown:        make(chan struct{}),
 		ctx:             ctx,
 		cancel:          cancel,
 	}
@@ -66,6 +163,7 @@ func NewWorkerPool(queue *Queue, cfg *config.Config, invalidateCache CacheInvali
 	for i := 0; i < cfg.Workers; i++ {
 		pool.workers = append(pool.workers, pool.createWorker())
 	}
+	queue.SetWorkers(len(pool.workers))
 
 	return pool
 }
@@ -74,16 +172,186 @@ func NewWorkerPool(queue *Queue, cfg *config.Config, invalidateCache CacheInvali
 func (p *WorkerPool) createWorker() *Worker {
 	worker := &Worker{
 		id:              p.nextWorkerID,
+		log:             workerLog.With("worker", p.nextWorkerID),
 		queue:           p.queue,
 		transcoder:      ffmpeg.NewTranscoder(p.cfg.FFmpegPath),
 		prober:          ffmpeg.NewProber(p.cfg.FFprobePath),
 		cfg:             p.cfg,
 		invalidateCache: p.invalidateCache,
+		onPanic:         p.recordPanic,
+		onComplete:      p.onComplete,
+		trash:           p.trash,
+		energy:          p.energy,
+		draining:        &p.draining,
+		shutdown:        p.shutdown,
+		onDrained:       p.removeDrained,
+		pickDevice:      p.assignDevice,
+		reserveTemp:     p.reserveTemp,
 	}
 	p.nextWorkerID++
 	return worker
 }
 
+// Workers returns the status of every local worker, in ID order
+func (p *WorkerPool) Workers() []WorkerStatus {
+	p.mu.Lock()
+	workers := append([]*Worker{}, p.workers...)
+	p.mu.Unlock()
+
+	statuses := make([]WorkerStatus, 0, len(workers))
+	for _, w := range workers {
+		statuses = append(statuses, w.Status())
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].ID < statuses[j].ID })
+	return statuses
+}
+
+// DrainWorker lets a worker finish its current job and then removes it from
+// the pool, lowering the worker count by one. The last worker can't be drained.
+func (p *WorkerPool) DrainWorker(id int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var target *Worker
+	active := 0
+	for _, w := range p.workers {
+		if w.id == id {
+			target = w
+		}
+		if !w.drain.Load() {
+			active++
+		}
+	}
+	if target == nil {
+		return ErrWorkerNotFound
+	}
+	if target.drain.Load() {
+		return nil
+	}
+	if active <= 1 {
+		return errors.New("cannot drain the last worker")
+	}
+	target.drain.Store(true)
+	workerLog.Info("Draining: will stop after the current job", "worker", id)
+	return nil
+}
+
+// removeDrained drops a worker that exited after DrainWorker
+func (p *WorkerPool) removeDrained(worker *Worker) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, w := range p.workers {
+		if w == worker {
+			p.workers = append(p.workers[:i], p.workers[i+1:]...)
+			p.cfg.Workers = len(p.workers)
+			p.queue.SetWorkers(len(p.workers))
+			worker.cancel()
+			worker.log.Info("Drained and removed", "workers_left", len(p.workers))
+			return
+		}
+	}
+}
+
+// assignDevice picks the GPU worker's next job runs on and records it as
+// the worker's device. Workers pinned in worker_devices use their device;
+// others take the least busy detected device, rotating between ties, so
+// parallel hardware jobs spread across GPUs. Returns "" for software encoders.
+func (p *WorkerPool) assignDevice(worker *Worker, accel ffmpeg.HWAccel) string {
+	devices := devicesFor(accel)
+	if len(devices) == 0 {
+		return ""
+	}
+
+	p.deviceMu.Lock()
+	defer p.deviceMu.Unlock()
+
+	device := ""
+	if worker.id < len(p.cfg.WorkerDevices) && ffmpeg.DeviceMatches(accel, p.cfg.WorkerDevices[worker.id]) {
+		device = p.cfg.WorkerDevices[worker.id]
+	} else {
+		busy := make(map[string]int, len(devices))
+		p.mu.Lock()
+		for _, w := range p.workers {
+			if w == worker {
+				continue
+			}
+			w.currentJobMu.Lock()
+			if w.jobDevice != "" {
+				busy[w.jobDevice]++
+			}
+			w.currentJobMu.Unlock()
+		}
+		p.mu.Unlock()
+
+		start := p.nextDevice % len(devices)
+		for i := range devices {
+			candidate := devices[(start+i)%len(devices)]
+			if device == "" || busy[candidate] < busy[device] {
+				device = candidate
+			}
+		}
+		p.nextDevice++
+	}
+
+	worker.currentJobMu.Lock()
+	worker.jobDevice = device
+	worker.currentJobMu.Unlock()
+	return device
+}
+
+// SetOnComplete sets a hook called after each completed transcode.
+// Must be called before Start.
+func (p *WorkerPool) SetOnComplete(hook CompletionHook) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.onComplete = hook
+	for _, w := range p.workers {
+		w.onComplete = hook
+	}
+}
+
+// SetTrash sets the store replaced originals are moved to when
+// trash_originals is on. Must be called before Start.
+func (p *WorkerPool) SetTrash(store *trash.Store) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.trash = store
+	for _, w := range p.workers {
+		w.trash = store
+	}
+}
+
+// SetEnergyTracker sets what measures jobs' energy use when energy.enabled
+// is on. Must be called before Start.
+func (p *WorkerPool) SetEnergyTracker(tracker *energy.Tracker) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.energy = tracker
+	for _, w := range p.workers {
+		w.energy = tracker
+	}
+}
+
+// recordPanic counts a worker restart and keeps the panic for diagnostics
+func (p *WorkerPool) recordPanic(wp WorkerPanic) {
+	p.panicMu.Lock()
+	defer p.panicMu.Unlock()
+	p.restarts++
+	p.lastPanic = &wp
+}
+
+// RestartStats returns the number of worker restarts after panics and the
+// most recent panic (nil if none)
+func (p *WorkerPool) RestartStats() (int, *WorkerPanic) {
+	p.panicMu.Lock()
+	defer p.panicMu.Unlock()
+	if p.lastPanic == nil {
+		return p.restarts, nil
+	}
+	last := *p.lastPanic
+	return p.restarts, &last
+}
+
 // Start starts all workers
 func (p *WorkerPool) Start() {
 	p.mu.Lock()
@@ -108,6 +376,40 @@ func (p *WorkerPool) Stop() {
 	}
 }
 
+// ShuttingDown reports whether Shutdown has begun, after which no more jobs
+// should be handed out
+func (p *WorkerPool) ShuttingDown() bool {
+	return p.draining.Load()
+}
+
+// Shutdown stops workers from taking new jobs and waits for running jobs to
+// finish until ctx is done. Jobs still running then are stopped and put back
+// in the queue as pending, so they start over on the next boot.
+func (p *WorkerPool) Shutdown(ctx context.Context) {
+	p.draining.Store(true)
+	p.shutdownOnce.Do(func() { close(p.shutdown) })
+
+	p.mu.Lock()
+	workers := make([]*Worker, len(p.workers))
+	copy(workers, p.workers)
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		for _, w := range workers {
+			w.wg.Wait()
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		workerLog.Warn("Shutdown grace period over, requeueing running jobs")
+	}
+	p.Stop()
+}
+
 // CancelJob cancels a specific job if it's currently running
 func (p *WorkerPool) CancelJob(jobID string) bool {
 	p.mu.Lock()
@@ -249,6 +551,7 @@ func (p *WorkerPool) Resize(n int) {
 
 	// Update config
 	p.cfg.Workers = n
+	p.queue.SetWorkers(n)
 }
 
 // WorkerCount returns the current number of workers
@@ -261,6 +564,7 @@ func (p *WorkerPool) WorkerCount() int {
 // Start starts the worker's processing loop
 func (w *Worker) Start(parentCtx context.Context) {
 	w.ctx, w.cancel = context.WithCancel(parentCtx)
+	w.startedAt = time.Now()
 	w.wg.Add(1)
 
 	go w.run()
@@ -272,29 +576,66 @@ func (w *Worker) Stop() {
 	w.wg.Wait()
 }
 
-// run is the main worker loop
+// run is the main worker loop. A panic while processing a job is recovered
+// and the loop restarted so the worker slot isn't lost until the next restart.
 func (w *Worker) run() {
 	defer w.wg.Done()
+	defer func() {
+		// Removal takes the pool lock, which Resize may hold while waiting on us
+		if w.drain.Load() && w.ctx.Err() == nil && w.onDrained != nil {
+			go w.onDrained(w)
+		}
+	}()
 
-	for {
+	for !w.runLoop() {
+		// Brief pause so a persistent fault can't spin the CPU
 		select {
 		case <-w.ctx.Done():
 			return
+		case <-time.After(time.Second):
+		}
+		w.log.Warn("Restarted after panic")
+	}
+}
+
+// runLoop processes jobs until the worker is stopped. Returns false if it
+// recovered from a panic and should be restarted.
+func (w *Worker) runLoop() (clean bool) {
+	var job *Job
+	defer func() {
+		if r := recover(); r != nil {
+			w.handlePanic(r, job)
+			clean = false
+		}
+	}()
+
+	for {
+		job = nil
+		if w.drain.Load() || (w.draining != nil && w.draining.Load()) {
+			return true
+		}
+		select {
+		case <-w.ctx.Done():
+			return true
 		default:
-			if !w.isScheduleAllowed() {
+			if !ScheduleAllowed(w.cfg, time.Now()) {
 				select {
 				case <-w.ctx.Done():
-					return
+					return true
+				case <-w.shutdown:
+					return true
 				case <-time.After(30 * time.Second):
 					continue
 				}
 			}
 
-			job := w.queue.GetNext()
+			job = w.queue.GetNext()
 			if job == nil {
 				select {
 				case <-w.ctx.Done():
-					return
+					return true
+				case <-w.shutdown:
+					return true
 				case <-time.After(500 * time.Millisecond):
 					continue
 				}
@@ -305,14 +646,46 @@ func (w *Worker) run() {
 	}
 }
 
-func (w *Worker) isScheduleAllowed() bool {
-	if !w.cfg.ScheduleEnabled {
+// handlePanic logs a recovered panic, fails the job it interrupted and
+// reports it to the pool
+func (w *Worker) handlePanic(r interface{}, job *Job) {
+	stack := string(debug.Stack())
+	wp := WorkerPanic{
+		WorkerID: w.id,
+		Value:    fmt.Sprint(r),
+		Stack:    stack,
+		Time:     time.Now(),
+	}
+	w.log.Error("PANIC", "panic", r, "stack", string(stack))
+
+	if job != nil {
+		wp.JobID = job.ID
+	}
+	if w.onPanic != nil {
+		w.onPanic(wp)
+	}
+
+	if job != nil {
+		if current := w.queue.Get(job.ID); current != nil && !current.IsTerminal() {
+			if current.TempPath != "" {
+				os.Remove(current.TempPath)
+			}
+			w.queue.FailJob(job.ID, fmt.Sprintf("worker crashed: %v", r))
+		}
+	}
+}
+
+// ScheduleAllowed reports whether jobs may start at now under the
+// configured schedule window. Local workers and remote agent claims both
+// wait for it.
+func ScheduleAllowed(cfg *config.Config, now time.Time) bool {
+	if !cfg.ScheduleEnabled {
 		return true
 	}
 
-	hour := time.Now().Hour()
-	start := w.cfg.ScheduleStartHour
-	end := w.cfg.ScheduleEndHour
+	hour := now.Hour()
+	start := cfg.ScheduleStartHour
+	end := cfg.ScheduleEndHour
 
 	if start > end {
 		return hour >= start || hour < end
@@ -321,6 +694,231 @@ func (w *Worker) isScheduleAllowed() bool {
 	return hour >= start && hour < end
 }
 
+// HDRSkipReason returns why an HDR job must be skipped under hdrHandling,
+// or "" if it can be transcoded.
+func HDRSkipReason(job *Job, hdrHandling ffmpeg.HDRHandling) string {
+	if job.HDR == nil {
+		return ""
+	}
+	if !job.HDR.HasHDR10Fallback() {
+		return "Dolby Vision profile 5 has no HDR10 base layer and can't be re-encoded safely"
+	}
+	if hdrHandling == ffmpeg.HDRHandlingSkip && !job.ForceTranscode {
+		return fmt.Sprintf("HDR source (%s) skipped by hdr_handling setting", job.HDR.Format)
+	}
+	return ""
+}
+
+// HardlinkSkipReason returns why a job whose source has other hard links
+// must be skipped under hardlink_handling, or "" if it can be transcoded.
+// The link count is read again, since links may have come or gone since
+// the job was queued.
+func HardlinkSkipReason(cfg *config.Config, job *Job) string {
+	if job.ForceTranscode || cfg.HardlinkHandlingFor(job.InputPath) != "skip" {
+		return ""
+	}
+	info, err := os.Stat(job.InputPath)
+	if err != nil {
+		return ""
+	}
+	if links := ffmpeg.LinkCount(info); links > 1 {
+		return fmt.Sprintf("File has %d hard links, skipped by hardlink_handling setting", links)
+	}
+	return ""
+}
+
+// PresetForJob resolves the job's preset against the locally detected
+// encoders and adjusts it for the job: encoder pin, software fallback,
+// custom encoder options, thread limit, sources the hardware encoder can't
+// take (see ffmpeg.EncoderIncompatibility), CPU tone mapping and the audio
+// tracks an audio-only preset re-encodes.
+func PresetForJob(job *Job, hdrHandling ffmpeg.HDRHandling) (*ffmpeg.Preset, error) {
+	preset := ffmpeg.GetPreset(job.PresetID)
+	if preset == nil {
+		return nil, fmt.Errorf("unknown preset: %s", job.PresetID)
+	}
+
+	// Per-job encoder pin, if that encoder is available on this machine
+	if job.PreferredEncoder != "" && job.PreferredEncoder != preset.Encoder {
+		if ffmpeg.IsEncoderAvailableForCodec(job.PreferredEncoder, preset.Codec) {
+			pinnedPreset := *preset
+			pinnedPreset.Encoder = job.PreferredEncoder
+			preset = &pinnedPreset
+		} else {
+			workerLog.Warn("Pinned encoder isn't available for this codec; using the detected one",
+				"job_id", job.ID, "pinned", job.PreferredEncoder, "codec", preset.Codec, "encoder", preset.Encoder)
+		}
+	}
+
+	// For software fallback jobs, override the preset to use software encoding
+	if job.IsSoftwareFallback {
+		softwarePreset := *preset
+		softwarePreset.Encoder = ffmpeg.HWAccelNone
+		preset = &softwarePreset
+	}
+
+	if preset.AudioCodec != "" {
+		audioPreset := *preset
+		audioPreset.AudioEncode = ffmpeg.LosslessAudioTracks(job.AudioTracks)
+		preset = &audioPreset
+	}
+
+	// Size-targeted encode: derive the video bitrate from the target size
+	if job.TargetSizeMB > 0 {
+		if preset.Codec == ffmpeg.CodecCopy {
+			return nil, fmt.Errorf("a remux can't target a size; it keeps the source video")
+		}
+		duration := time.Duration(job.Duration) * time.Millisecond
+		if duration <= 0 {
+			return nil, fmt.Errorf("target size needs the video's duration, which is unknown")
+		}
+		bitrate := ffmpeg.TargetVideoBitrate(int64(job.TargetSizeMB)<<20, duration, ffmpeg.AudioBitrate(job.AudioTracks))
+		if bitrate == 0 {
+			return nil, fmt.Errorf("target size of %d MB is too small for a %s video with its audio",
+				job.TargetSizeMB, formatDuration(duration))
+		}
+		targetPreset := *preset
+		targetPreset.TargetBitrate = bitrate
+		preset = &targetPreset
+	}
+
+	// Per-job custom encoder options (set via PATCH /api/jobs/{id}), checked
+	// again here in case the job was saved before the current rules
+	if len(job.CustomArgs) > 0 {
+		if err := ffmpeg.ValidateCustomArgs(job.CustomArgs); err != nil {
+			return nil, fmt.Errorf("custom args: %w", err)
+		}
+		customPreset := *preset
+		customPreset.ExtraArgs = job.CustomArgs
+		preset = &customPreset
+	}
+
+	// Per-job thread limit; preset_threads applies where the job runs
+	if job.Threads > 0 {
+		threadsPreset := *preset
+		threadsPreset.Threads = job.Threads
+		preset = &threadsPreset
+	}
+
+	// Preflight: a source the hardware encoder can't take (too large, or
+	// 10-bit on 8-bit-only hardware, which would be silently truncated)
+	// goes straight to software rather than failing on the GPU first. A job
+	// pinned to that encoder fails instead, since software wasn't asked for.
+	if reason := ffmpeg.EncoderIncompatibility(preset, job.Width, job.Height, job.BitDepth); reason != "" {
+		if job.PreferredEncoder == preset.Encoder {
+			return nil, fmt.Errorf("pinned encoder can't encode this source: %s", reason)
+		}
+		workerLog.Info("Hardware encoder can't encode this source, using software encoder",
+			"job_id", job.ID, "reason", reason, "encoder", preset.Encoder, "codec", preset.Codec)
+		softwarePreset := *preset
+		softwarePreset.Encoder = ffmpeg.HWAccelNone
+		preset = &softwarePreset
+	}
+
+	// Tone mapping filters run on the CPU, so encode in software too
+	if job.HDR != nil && hdrHandling == ffmpeg.HDRHandlingTonemap && preset.Encoder != ffmpeg.HWAccelNone {
+		softwarePreset := *preset
+		softwarePreset.Encoder = ffmpeg.HWAccelNone
+		preset = &softwarePreset
+	}
+
+	return preset, nil
+}
+
+// NoGainReason returns why a job's output of outputSize bytes should be
+// discarded: it's no smaller than the original, or saves less than
+// min_savings_percent. "" if it should be kept. Forced jobs, remuxes and
+// keep_larger_files keep every output.
+func NoGainReason(cfg *config.Config, job *Job, outputSize int64) string {
+	if job.ForceTranscode || cfg.KeepLargerFiles || ffmpeg.IsRemuxPreset(job.PresetID) {
+		return ""
+	}
+	if outputSize >= job.InputSize {
+		return fmt.Sprintf("Transcoded file (%s) is larger than original (%s). File skipped.",
+			ffmpeg.FormatBytes(outputSize), ffmpeg.FormatBytes(job.InputSize))
+	}
+	if cfg.MinSavingsPercent > 0 && (job.InputSize-outputSize)*100 < job.InputSize*int64(cfg.MinSavingsPercent) {
+		saved := float64(job.InputSize-outputSize) * 100 / float64(job.InputSize)
+		return fmt.Sprintf("Transcoded file (%s) is only %.1f%% smaller than original (%s), under min_savings_percent (%d%%). File skipped.",
+			ffmpeg.FormatBytes(outputSize), saved, ffmpeg.FormatBytes(job.InputSize), cfg.MinSavingsPercent)
+	}
+	return ""
+}
+
+// OutputContainer picks the container for a job: MKV for remux and
+// audio-only presets,
+// the source's own when keep_source_container is set and it's MKV or MP4,
+// otherwise the preset's entry in preset_containers, otherwise
+// output_container.
+func OutputContainer(cfg *config.Config, job *Job) ffmpeg.Container {
+	if ffmpeg.IsRemuxPreset(job.PresetID) || ffmpeg.IsAudioPreset(job.PresetID) {
+		return ffmpeg.ContainerMKV
+	}
+	if cfg.KeepSourceContainer {
+		if c := ffmpeg.SourceContainer(job.InputPath); c != "" {
+			return c
+		}
+	}
+	if c, ok := ffmpeg.ParseContainer(cfg.PresetContainers[job.PresetID]); ok {
+		return c
+	}
+	if c, ok := ffmpeg.ParseContainer(cfg.OutputContainer); ok {
+		return c
+	}
+	return ffmpeg.ContainerMKV
+}
+
+// DeinterlaceMode returns the preset's entry in preset_deinterlace, or auto
+func DeinterlaceMode(cfg *config.Config, job *Job) ffmpeg.DeinterlaceMode {
+	if mode, ok := ffmpeg.ParseDeinterlaceMode(cfg.PresetDeinterlace[job.PresetID]); ok {
+		return mode
+	}
+	return ffmpeg.DeinterlaceAuto
+}
+
+// EncoderThreads returns the thread limit for the job's software encodes:
+// its own, otherwise the preset's entry in preset_threads, otherwise 0
+// (every core)
+func EncoderThreads(cfg *config.Config, job *Job) int {
+	if job.Threads > 0 {
+		return job.Threads
+	}
+	return cfg.PresetThreads[job.PresetID]
+}
+
+// ChunkCount returns how many segments to split the job's encode into
+// (chunked_segments), or 0 to encode it in one go: chunking is off, the
+// video is shorter than chunked_min_minutes, or the preset can't be
+// chunked (see ffmpeg.SupportsChunking)
+func ChunkCount(cfg *config.Config, job *Job, preset *ffmpeg.Preset) int {
+	if cfg.ChunkedSegments < 2 || !ffmpeg.SupportsChunking(preset) || job.Duration <= 0 {
+		return 0
+	}
+	if time.Duration(job.Duration)*time.Millisecond < time.Duration(cfg.ChunkedMinMinutes)*time.Minute {
+		return 0
+	}
+	return cfg.ChunkedSegments
+}
+
+// AutoQuality reports whether the quality of the preset's jobs is picked by
+// a sampled search: its entry in preset_auto_quality, otherwise auto_quality
+func AutoQuality(cfg *config.Config, presetID string) bool {
+	if enabled, ok := cfg.PresetAutoQuality[presetID]; ok {
+		return enabled
+	}
+	return cfg.AutoQuality
+}
+
+// MaxEncodeTime returns how long the job's encode may run: the preset's
+// entry in preset_max_encode_hours, otherwise max_encode_hours. 0 is no limit.
+func MaxEncodeTime(cfg *config.Config, job *Job) time.Duration {
+	hours, ok := cfg.PresetMaxEncodeHours[job.PresetID]
+	if !ok {
+		hours = cfg.MaxEncodeHours
+	}
+	return time.Duration(hours) * encodeHourUnit
+}
+
 // processJob handles a single transcoding job
 func (w *Worker) processJob(job *Job) {
 	// Create a cancellable context for this job
@@ -336,22 +934,29 @@ func (w *Worker) processJob(job *Job) {
 		w.currentJobMu.Lock()
 		w.currentJob = nil
 		w.jobCancel = nil
+		w.jobEncoder, w.jobDevice, w.jobHWPath = "", "", ""
+		w.jobFPS, w.jobSpeed = 0, 0
 		w.currentJobMu.Unlock()
 	}()
 
 	// If job needs probing (deferred probing mode), probe it first
 	if job.NeedsProbe() {
-		log.Printf("[worker-%d] Probing pending_probe job %s: %s", w.id, job.ID, job.InputPath)
+		w.log.Info("Probing pending_probe job", "job_id", job.ID, "path", job.InputPath)
+		w.queue.recordEvent(job.ID, EventProbing, "")
 
 		probe, err := w.prober.Probe(jobCtx, job.InputPath)
 		if err != nil {
+			if w.ctx.Err() != nil {
+				// Shutting down; the job stays queued for the next run
+				return
+			}
 			w.queue.FailJob(job.ID, fmt.Sprintf("probe failed: %v", err))
 			return
 		}
 
 		// Update job with probe results (this may fail the job if skip reason found)
 		if err := w.queue.UpdateJobAfterProbe(job.ID, probe); err != nil {
-			log.Printf("[worker-%d] Failed to update job after probe: %v", w.id, err)
+			w.log.Error("Failed to update job after probe", "job_id", job.ID, "error", err)
 			return
 		}
 
@@ -363,31 +968,87 @@ func (w *Worker) processJob(job *Job) {
 		}
 
 		// Update local job reference with probe data
-		log.Printf("[worker-%d] Job %s probed successfully: duration=%dms bitrate=%d",
-			w.id, job.ID, job.Duration, job.Bitrate)
+		w.log.Info("Job probed", "job_id", job.ID, "duration_ms", job.Duration, "bitrate", job.Bitrate)
 	}
 
-	// Get the preset
-	preset := ffmpeg.GetPreset(job.PresetID)
-	if preset == nil {
-		w.queue.FailJob(job.ID, fmt.Sprintf("unknown preset: %s", job.PresetID))
+	// The source may have been replaced since it was probed (an upgrade
+	// from Sonarr/Radarr); don't encode it from stale metadata
+	if SourceChanged(job) {
+		w.log.Info("Source changed since it was queued, probing again", "job_id", job.ID, "path", job.InputPath)
+		w.queue.recordEvent(job.ID, EventProbing, "source changed")
+
+		probe, err := w.prober.Probe(jobCtx, job.InputPath)
+		if err != nil {
+			if w.ctx.Err() != nil {
+				return
+			}
+			w.queue.FailJob(job.ID, fmt.Sprintf("probe failed: %v", err))
+			return
+		}
+		if err := w.queue.RefreshProbe(job.ID, probe); err != nil {
+			w.log.Error("Failed to update job after probe", "job_id", job.ID, "error", err)
+			return
+		}
+
+		job = w.queue.Get(job.ID)
+		if job == nil || job.Status != StatusPending {
+			// The new file doesn't need encoding
+			return
+		}
+	}
+
+	// Apply HDR policy before committing to an encoder
+	hdrHandling := ffmpeg.NormalizeHDRHandling(w.cfg.HDRHandling)
+	if reason := HDRSkipReason(job, hdrHandling); reason != "" {
+		w.queue.SkipJob(job.ID, reason)
+		return
+	}
+	if reason := HardlinkSkipReason(w.cfg, job); reason != "" {
+		w.queue.SkipJob(job.ID, reason)
 		return
 	}
 
-	// For software fallback jobs, override the preset to use software encoding
+	preset, err := PresetForJob(job, hdrHandling)
+	if err != nil {
+		w.queue.FailJob(job.ID, err.Error())
+		return
+	}
+	if container := OutputContainer(w.cfg, job); container != preset.Container {
+		containerPreset := *preset
+		containerPreset.Container = container
+		preset = &containerPreset
+	}
+	if DeinterlaceMode(w.cfg, job).ShouldDeinterlace(job.Interlaced) {
+		deinterlacePreset := *preset
+		deinterlacePreset.Deinterlace = true
+		preset = &deinterlacePreset
+		w.log.Info("Deinterlacing", "job_id", job.ID, "interlaced_source", job.Interlaced)
+	}
+	if threads := EncoderThreads(w.cfg, job); threads != preset.Threads {
+		threadsPreset := *preset
+		threadsPreset.Threads = threads
+		preset = &threadsPreset
+	}
+	if chunks := ChunkCount(w.cfg, job, preset); chunks > 1 {
+		chunkedPreset := *preset
+		chunkedPreset.Chunks = chunks
+		preset = &chunkedPreset
+		w.log.Info("Encoding in parallel segments", "job_id", job.ID, "segments", chunks)
+	}
 	if job.IsSoftwareFallback {
-		softwarePreset := *preset
-		softwarePreset.Encoder = ffmpeg.HWAccelNone
-		preset = &softwarePreset
-		log.Printf("[worker-%d] Starting job %s with SOFTWARE fallback for: %s", w.id, job.ID, job.InputPath)
+		w.log.Info("Starting job with SOFTWARE fallback", "job_id", job.ID, "path", job.InputPath)
 	} else {
-		log.Printf("[worker-%d] Starting job %s with encoder=%s codec=%s for: %s",
-			w.id, job.ID, preset.Encoder, preset.Codec, job.InputPath)
+		w.log.Info("Starting job", "job_id", job.ID, "encoder", preset.Encoder, "codec", preset.Codec, "path", job.InputPath)
+	}
+	if job.HDR != nil {
+		if job.HDR.HDR10Plus && hdrHandling == ffmpeg.HDRHandlingPreserve {
+			w.log.Warn("HDR10+ dynamic metadata will not be carried over, static HDR10 is kept", "job_id", job.ID)
+		}
+		w.log.Info("HDR source", "job_id", job.ID, "format", job.HDR.Format, "handling", hdrHandling)
 	}
 
 	// Log duration for debugging progress issues
-	log.Printf("[worker-%d] Job %s duration: %dms (%.1f minutes)",
-		w.id, job.ID, job.Duration, float64(job.Duration)/60000.0)
+	w.log.Debug("Job duration", "job_id", job.ID, "duration_ms", job.Duration, "minutes", float64(job.Duration)/60000.0)
 
 	// Build temp output path
 	tempDir := w.cfg.GetTempDir(job.InputPath)
@@ -396,32 +1057,192 @@ func (w *Worker) processJob(job *Job) {
 	// Determine the hardware path (decode→encode pipeline)
 	hardwarePath := ffmpeg.GetHardwarePath(preset.Encoder, job.PixFmt, job.VideoCodec)
 
+	// Refuse to start when the temp or destination filesystem is nearly full.
+	// A full disk otherwise shows up as a cryptic ffmpeg failure mid-encode.
+	if reason := w.checkDiskSpace(tempDir, filepath.Dir(job.InputPath)); reason != "" {
+		w.log.Warn("Waiting for disk space", "job_id", job.ID, "reason", reason)
+		if err := w.queue.WaitForDisk(job.ID, reason); err != nil {
+			return
+		}
+		select {
+		case <-jobCtx.Done():
+		case <-time.After(diskRecheckInterval):
+		}
+		return
+	}
+
+	// Don't start alongside running jobs whose outputs, with this one's,
+	// would overflow the temp filesystem partway through
+	if w.reserveTemp != nil {
+		release, reason := w.reserveTemp(job, tempDir, tempPath, ProjectedOutputSize(job, preset))
+		if reason != "" {
+			w.log.Info("Waiting for temp space", "job_id", job.ID, "reason", reason)
+			if err := w.queue.WaitForDisk(job.ID, reason); err != nil {
+				return
+			}
+			select {
+			case <-jobCtx.Done():
+			case <-time.After(diskRecheckInterval):
+			}
+			return
+		}
+		defer release()
+	}
+
 	// Mark job as started
 	if err := w.queue.StartJob(job.ID, tempPath, hardwarePath); err != nil {
 		// Job might have been cancelled or already started
 		return
 	}
+	if w.pickDevice != nil {
+		if device := w.pickDevice(w, preset.Encoder); device != "" {
+			devicePreset := *preset
+			devicePreset.Device = device
+			preset = &devicePreset
+			w.log.Info("Running on device", "job_id", job.ID, "device", device)
+		}
+	}
+	w.currentJobMu.Lock()
+	w.jobEncoder = preset.Encoder
+	w.jobHWPath = hardwarePath
+	w.currentJobMu.Unlock()
+
+	if w.energy != nil && w.cfg.Energy.Enabled {
+		source := energy.SourceNone
+		if w.cfg.Energy.Measure {
+			source = energy.SourceFor(string(preset.Encoder))
+		}
+		w.energy.Start(job.ID, source)
+		// Failed and cancelled encodes aren't recorded
+		defer w.energy.Stop(job.ID)
+	}
+
+	qualityHEVC, qualityAV1 := w.cfg.QualityHEVC, w.cfg.QualityAV1
+	duration := time.Duration(job.Duration) * time.Millisecond
+	w.transcoder.SetLimits(ffmpeg.ProcessLimits{
+		Nice:          w.cfg.FFmpegLimits.Nice,
+		IOClass:       w.cfg.FFmpegLimits.IOClass,
+		IOLevel:       w.cfg.FFmpegLimits.IOLevel,
+		CPUAffinity:   w.cfg.FFmpegLimits.CPUAffinity,
+		MemoryLimitMB: w.cfg.FFmpegLimits.MemoryLimitMB,
+		CgroupDir:     w.cfg.FFmpegLimits.CgroupDir,
+	})
+
+	// Auto crop: remove black bars found by sampling the source. Runs before
+	// the quality search so its samples are cropped too.
+	if w.cfg.AutoCrop && preset.Codec != ffmpeg.CodecCopy {
+		cropPreset := *preset
+		cropPreset.AutoCrop = true
+		preset = &cropPreset
+	}
+	if preset.AutoCrop && preset.Crop == nil {
+		crop, err := w.transcoder.DetectCrop(jobCtx, job.InputPath, job.Width, job.Height, duration)
+		if err != nil {
+			if jobCtx.Err() == context.Canceled {
+				w.stopJob(job.ID)
+				return
+			}
+			// A failed detection shouldn't block the encode; keep the full frame
+			w.log.Warn("Crop detection failed, not cropping", "job_id", job.ID, "error", err)
+		} else if crop != nil {
+			w.log.Info("Cropping", "job_id", job.ID, "width", job.Width, "height", job.Height, "crop", crop.String())
+			cropPreset := *preset
+			cropPreset.Crop = crop
+			preset = &cropPreset
+		}
+	}
+
+	// Auto quality: pick the CRF for this title from a few sampled encodes.
+	// Tone-mapped output can't be compared against the HDR source, so skip those.
+	if AutoQuality(w.cfg, job.PresetID) {
+		autoPreset := *preset
+		autoPreset.AutoQuality = true
+		preset = &autoPreset
+	}
+	tonemapping := job.HDR != nil && hdrHandling == ffmpeg.HDRHandlingTonemap
+	if preset.AutoQuality && ffmpeg.CanSearchQuality(preset) && !tonemapping {
+		search, err := w.transcoder.SearchQuality(jobCtx, job.InputPath, preset, duration, job.InputSize,
+			job.BitDepth, job.PixFmt, job.VideoCodec, qualityHEVC, qualityAV1, ffmpeg.QualitySearchOptions{
+				TargetSSIM:    w.cfg.AutoQualityTargetSSIM,
+				TargetSavings: float64(w.cfg.AutoQualityTargetSavings) / 100,
+				TempDir:       tempDir,
+
+				SourceVideoBitrate: job.VideoBitrate,
+			})
+		if err != nil {
+			if jobCtx.Err() == context.Canceled {
+				w.stopJob(job.ID)
+				return
+			}
+			// A failed search shouldn't block the encode; use the configured quality
+			w.log.Warn("Auto quality search failed, using default quality", "job_id", job.ID, "error", err)
+		} else {
+			w.log.Info("Auto quality chose a quality", "job_id", job.ID, "quality", search.Quality, "took", search.Duration.Round(time.Second))
+			qualityHEVC, qualityAV1 = search.Quality, search.Quality
+		}
+	}
 
 	// Create progress channel
 	progressCh := make(chan ffmpeg.Progress, 10)
 
-	// Start progress forwarding
+	// Start progress forwarding. Only progress that advances counts for the
+	// stall watchdog: a wedged encoder can keep reporting the same position.
+	var lastProgress atomic.Int64
+	lastProgress.Store(time.Now().UnixNano())
 	go func() {
+		furthest := -1.0
 		for progress := range progressCh {
+			if progress.Percent > furthest {
+				furthest = progress.Percent
+				lastProgress.Store(time.Now().UnixNano())
+			}
+			w.currentJobMu.Lock()
+			w.jobFPS, w.jobSpeed = progress.FPS, progress.Speed
+			w.currentJobMu.Unlock()
 			eta := formatDuration(progress.ETA)
 			w.queue.UpdateProgress(job.ID, progress.Percent, progress.Speed, eta)
 		}
 	}()
 
-	duration := time.Duration(job.Duration) * time.Millisecond
-	result, err := w.transcoder.Transcode(jobCtx, job.InputPath, tempPath, preset, duration, job.Bitrate, job.SubtitleCodecs, w.cfg.SubtitleHandling, job.BitDepth, job.PixFmt, job.VideoCodec, w.cfg.QualityHEVC, w.cfg.QualityAV1, progressCh)
+	// Kill ffmpeg if its progress stops advancing (wedged pipe, hung driver)
+	var stalled atomic.Bool
+	stallTimeout := time.Duration(w.cfg.StallTimeoutMinutes) * stallUnit
+	if stallTimeout > 0 {
+		go w.watchStall(jobCtx, job.ID, stallTimeout, &lastProgress, &stalled, jobCancel)
+	}
+
+	// Abort encodes that run past max_encode_hours
+	var timedOut atomic.Bool
+	maxEncode := MaxEncodeTime(w.cfg, job)
+	if maxEncode > 0 {
+		go w.watchEncodeTime(jobCtx, job.ID, maxEncode, &timedOut, jobCancel)
+	}
+
+	result, err := w.transcoder.Transcode(jobCtx, job.InputPath, tempPath, preset, duration, job.Bitrate, job.SubtitleCodecs, w.cfg.SubtitleHandling, job.BitDepth, job.PixFmt, job.VideoCodec, qualityHEVC, qualityAV1, job.HDR, hdrHandling, progressCh)
 
 	if err != nil {
 		// Check if it was cancelled
 		if jobCtx.Err() == context.Canceled {
 			// Clean up temp file
 			os.Remove(tempPath)
-			w.queue.CancelJob(job.ID)
+			if stalled.Load() && w.ctx.Err() == nil {
+				w.handleStall(job, stallTimeout, hardwarePath, err)
+				return
+			}
+			if timedOut.Load() && w.ctx.Err() == nil {
+				var progress float64
+				if current := w.queue.Get(job.ID); current != nil {
+					progress = current.Progress
+				}
+				var details *FailJobDetails
+				if te, ok := err.(*ffmpeg.TranscodeError); ok {
+					details = &FailJobDetails{Stderr: te.Stderr, ExitCode: te.ExitCode, FFmpegArgs: te.Args}
+				}
+				w.queue.FailJobWithDetails(job.ID, fmt.Sprintf("Encode aborted at %.0f%%: ran longer than the %s limit (max_encode_hours)",
+					progress, maxEncode), details)
+				return
+			}
+			w.stopJob(job.ID)
 			return
 		}
 
@@ -470,32 +1291,325 @@ func (w *Worker) processJob(job *Job) {
 		return
 	}
 
-	if result.OutputSize >= job.InputSize && !job.ForceTranscode && !w.cfg.KeepLargerFiles {
-		os.Remove(tempPath)
-		w.queue.NoGainJob(job.ID, fmt.Sprintf("Transcoded file (%s) is larger than original (%s). File skipped.",
-			formatBytes(result.OutputSize), formatBytes(job.InputSize)))
+	w.recordEnergy(job.ID, preset.Encoder)
+	finishJob(w.queue, w.cfg, w.invalidateCache, w.onComplete, w.trash, job, tempPath, result.OutputSize)
+}
+
+// recordEnergy stops tracking a finished encode and records the energy it
+// used, measured or modeled from energy.watts
+func (w *Worker) recordEnergy(jobID string, encoder ffmpeg.HWAccel) {
+	if w.energy == nil {
+		return
+	}
+	usage, ok := w.energy.Stop(jobID)
+	if !ok {
+		return
+	}
+	kwh := usage.KWh(w.cfg.Energy.Watts[string(encoder)])
+	if kwh <= 0 {
+		return
+	}
+	w.queue.SetJobEnergy(jobID, kwh, kwh*w.cfg.Energy.CostPerKWh, usage.Measured)
+}
+
+// stopJob records a running job that was interrupted: cancelled by the user,
+// or requeued if the worker itself is being stopped
+func (w *Worker) stopJob(jobID string) {
+	if w.ctx.Err() != nil {
+		if err := w.queue.ReleaseJob(jobID, "interrupted by shutdown; will restart"); err == nil {
+			w.log.Info("Job requeued for the next start", "job_id", jobID)
+		}
 		return
 	}
+	w.queue.CancelJob(jobID)
+}
+
+// CompleteExternal finishes a job whose output was produced elsewhere (a
+// remote agent) and is already at tempPath: it applies the same size check,
+// original handling and completion hooks as a local transcode.
+func (p *WorkerPool) CompleteExternal(job *Job, tempPath string, outputSize int64) {
+	p.mu.Lock()
+	onComplete := p.onComplete
+	trashStore := p.trash
+	p.mu.Unlock()
+	finishJob(p.queue, p.cfg, p.invalidateCache, onComplete, trashStore, job, tempPath, outputSize)
+}
+
+// finishJob moves a finished transcode into place and marks the job
+// complete, or discards it as no_gain when it didn't save enough (see
+// NoGainReason) or verify_failed when it is truncated or corrupt.
+func finishJob(queue *Queue, cfg *config.Config, invalidateCache CacheInvalidator, onComplete CompletionHook, trashStore *trash.Store, job *Job, tempPath string, outputSize int64) {
+	queue.recordEvent(job.ID, EventFinalizing, "")
+	if reason := NoGainReason(cfg, job, outputSize); reason != "" {
+		if err := os.Remove(tempPath); err != nil && !os.IsNotExist(err) {
+			workerLog.Warn("Failed to remove discarded output", "job_id", job.ID, "path", tempPath, "error", err)
+		}
+		workerLog.Info("Output discarded as no gain", "job_id", job.ID,
+			"input_size", job.InputSize, "output_size", outputSize)
+		queue.NoGainJob(job.ID, reason, outputSize)
+		return
+	}
+
+	// Check the output decodes cleanly before the original is touched
+	if cfg.VerifyOutput {
+		expect := ffmpeg.VerifyExpectation{
+			Duration:    time.Duration(job.Duration) * time.Millisecond,
+			AudioTracks: len(job.AudioTracks),
+			Chapters:    job.Chapters,
+		}
+		// MP4 output drops attachments by design
+		if OutputContainer(cfg, job) == ffmpeg.ContainerMKV {
+			expect.Attachments = job.Attachments
+		}
+		err := ffmpeg.VerifyOutput(context.Background(), cfg.FFmpegPath, cfg.FFprobePath, tempPath, expect)
+		if err != nil {
+			var verr *ffmpeg.VerifyError
+			stderr := ""
+			if errors.As(err, &verr) {
+				stderr = verr.Stderr
+			}
+			workerLog.Warn("Output failed verification; keeping original", "job_id", job.ID, "error", err, "path", job.InputPath)
+			os.Remove(tempPath)
+			queue.VerifyFailJob(job.ID, err.Error(), stderr)
+			return
+		}
+	}
 
 	// Finalize the transcode (handle original file)
-	replace := w.cfg.OriginalHandling == "replace"
-	finalPath, err := ffmpeg.FinalizeTranscode(job.InputPath, tempPath, replace)
+	opts := ffmpeg.FinalizeOptions{
+		Replace:           cfg.OriginalHandling == "replace",
+		PreserveOwnership: cfg.PreserveOwnership,
+		PreserveMTime:     cfg.PreserveMTime,
+		Ext:               ffmpeg.OutputExt(job.InputPath, OutputContainer(cfg, job)),
+	}
+	if opts.Replace && cfg.TrashOriginals && trashStore != nil {
+		opts.TrashPath = trashStore.PathFor(job.ID, job.InputPath)
+	}
+
+	// Find the source's other hard links while they still share its inode
+	var otherLinks []string
+	if cfg.HardlinkHandlingFor(job.InputPath) == "relink" {
+		links, err := ffmpeg.FindHardlinks(job.InputPath, cfg.HardlinkSearchDirs())
+		if err != nil {
+			workerLog.Warn("Could not search for hard links", "job_id", job.ID, "error", err)
+		}
+		otherLinks = links
+	}
+
+	finalPath, err := ffmpeg.FinalizeTranscode(job.InputPath, tempPath, opts)
 	if err != nil {
 		// Try to clean up
 		os.Remove(tempPath)
-		w.queue.FailJob(job.ID, fmt.Sprintf("failed to finalize: %v", err))
+		queue.FailJob(job.ID, fmt.Sprintf("failed to finalize: %v", err))
 		return
 	}
 
+	if len(otherLinks) > 0 {
+		relinked, err := ffmpeg.Relink(finalPath, otherLinks)
+		if err != nil {
+			workerLog.Warn("Some hard links still point at the original", "job_id", job.ID, "error", err)
+		}
+		if len(relinked) > 0 {
+			workerLog.Info("Pointed hard links at the new file", "job_id", job.ID, "links", relinked)
+		}
+	}
+
 	// Invalidate cache for the output file so browser shows updated metadata
-	if w.invalidateCache != nil {
-		w.invalidateCache(finalPath)
+	if invalidateCache != nil {
+		invalidateCache(finalPath)
 		// Also invalidate the original path in case it was cached
-		w.invalidateCache(job.InputPath)
+		invalidateCache(job.InputPath)
+	}
+
+	if opts.TrashPath != "" {
+		trashStore.Add(job.ID, job.InputPath, opts.TrashPath, finalPath)
 	}
 
 	// Mark job complete
-	w.queue.CompleteJob(job.ID, finalPath, result.OutputSize)
+	queue.CompleteJob(job.ID, finalPath, outputSize)
+	if cfg.FingerprintProcessed {
+		queue.RecordFingerprints([]string{finalPath})
+	}
+
+	if onComplete != nil {
+		onComplete(job.InputPath, finalPath)
+	}
+}
+
+// RecoverInterrupted cleans up after jobs that were running when the server
+// last stopped. A finalize cut short by a crash is completed from its staged
+// output and the job marked complete; otherwise leftover temp files are
+// removed and the job stays pending. Call once at startup, before Start.
+func RecoverInterrupted(queue *Queue, invalidateCache CacheInvalidator) {
+	queue.mu.Lock()
+	ids := queue.interrupted
+	queue.interrupted = nil
+	queue.mu.Unlock()
+
+	for _, id := range ids {
+		job := queue.Get(id)
+		if job == nil || job.Status != StatusPending {
+			continue
+		}
+
+		finalPath, err := ffmpeg.RecoverFinalize(job.InputPath)
+		if err != nil {
+			recoverLog.Error("Could not recover interrupted job", "job_id", job.ID, "error", err)
+			continue
+		}
+		if finalPath == "" {
+			if job.TempPath != "" {
+				os.Remove(job.TempPath)
+			}
+			continue
+		}
+
+		var outputSize int64
+		if info, err := os.Stat(finalPath); err == nil {
+			outputSize = info.Size()
+		}
+		if invalidateCache != nil {
+			invalidateCache(finalPath)
+			invalidateCache(job.InputPath)
+		}
+		queue.CompleteJob(job.ID, finalPath, outputSize)
+		recoverLog.Info("Finished interrupted replace", "job_id", job.ID, "path", job.InputPath, "output", finalPath)
+	}
+}
+
+// handleStall records a job the stall watchdog killed: requeued with
+// ffmpeg's output while it has retries left (stall_retries), failed after
+func (w *Worker) handleStall(job *Job, timeout time.Duration, hardwarePath string, err error) {
+	var progress float64
+	stalls := 0
+	if current := w.queue.Get(job.ID); current != nil {
+		progress, stalls = current.Progress, current.Stalls
+	}
+	reason := fmt.Sprintf("ffmpeg stalled at %.0f%%", progress)
+	if hardwarePath != "" {
+		reason += fmt.Sprintf(" (%s)", hardwarePath)
+	}
+	reason += fmt.Sprintf(": no progress for %s", timeout)
+
+	var details *FailJobDetails
+	if te, ok := err.(*ffmpeg.TranscodeError); ok {
+		details = &FailJobDetails{Stderr: te.Stderr, ExitCode: te.ExitCode, FFmpegArgs: te.Args}
+	}
+	if stalls < w.cfg.StallRetries {
+		w.log.Warn("Requeueing stalled job", "job_id", job.ID, "progress", progress, "stalls", stalls+1)
+		w.queue.RequeueStalled(job.ID, reason+"; retrying", details)
+		return
+	}
+	w.queue.FailJobWithDetails(job.ID, reason, details)
+}
+
+// watchEncodeTime cancels the job once it has been encoding, not counting
+// time paused, for longer than limit
+func (w *Worker) watchEncodeTime(ctx context.Context, jobID string, limit time.Duration, timedOut *atomic.Bool, cancel context.CancelFunc) {
+	interval := min(max(limit/100, 100*time.Millisecond), time.Minute)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var elapsed time.Duration
+	last := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if !w.IsCurrentJobPaused(jobID) {
+				elapsed += now.Sub(last)
+			}
+			last = now
+			if elapsed > limit {
+				w.log.Warn("Encode ran past max_encode_hours, aborting", "job_id", jobID, "limit", limit)
+				timedOut.Store(true)
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+// watchStall cancels the job if its progress doesn't advance within timeout.
+// Time spent paused doesn't count towards the timeout.
+func (w *Worker) watchStall(ctx context.Context, jobID string, timeout time.Duration, lastProgress *atomic.Int64, stalled *atomic.Bool, cancel context.CancelFunc) {
+	interval := timeout / 20
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if w.IsCurrentJobPaused(jobID) {
+				lastProgress.Store(time.Now().UnixNano())
+				continue
+			}
+			if time.Since(time.Unix(0, lastProgress.Load())) > timeout {
+				w.log.Warn("Job stalled, killing ffmpeg", "job_id", jobID, "no_progress_for", timeout)
+				stalled.Store(true)
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+// checkDiskSpace returns a human-readable reason if any of the given directories
+// has less free space than the configured minimum, or "" if all have enough.
+func (w *Worker) checkDiskSpace(dirs ...string) string {
+	if w.cfg.MinFreeSpaceMB <= 0 {
+		return ""
+	}
+	minFree := uint64(w.cfg.MinFreeSpaceMB) * 1024 * 1024
+
+	for _, dir := range dirs {
+		free, err := diskspace.Free(dir)
+		if err != nil {
+			// Don't block jobs on filesystems we can't inspect
+			w.log.Warn("Could not check free space", "dir", dir, "error", err)
+			continue
+		}
+		if free < minFree {
+			return fmt.Sprintf("Waiting for disk space: %s free in %s (minimum %s)",
+				ffmpeg.FormatBytes(int64(free)), dir, ffmpeg.FormatBytes(int64(minFree)))
+		}
+	}
+	return ""
+}
+
+// Status returns what the worker is doing right now
+func (w *Worker) Status() WorkerStatus {
+	w.currentJobMu.Lock()
+	defer w.currentJobMu.Unlock()
+
+	status := WorkerStatus{
+		ID:        w.id,
+		State:     "idle",
+		StartedAt: w.startedAt,
+	}
+	if !w.startedAt.IsZero() {
+		status.UptimeSeconds = int64(time.Since(w.startedAt).Seconds())
+	}
+	if w.currentJob != nil {
+		status.State = "busy"
+		status.JobID = w.currentJob.ID
+		status.InputPath = w.currentJob.InputPath
+		status.Encoder = string(w.jobEncoder)
+		status.HardwarePath = w.jobHWPath
+		status.Device = w.jobDevice
+		status.FPS = w.jobFPS
+		status.Speed = w.jobSpeed
+	}
+	if w.drain.Load() {
+		status.State = "draining"
+	}
+	return status
 }
 
 // CancelCurrentJob cancels the job if it matches the given ID
@@ -574,17 +1688,3 @@ func formatDuration(d time.Duration) string {
 	}
 	return fmt.Sprintf("%ds", s)
 }
-
-// formatBytes formats bytes as a human-readable string
-func formatBytes(b int64) string {
-	const unit = 1024
-	if b < unit {
-		return fmt.Sprintf("%d B", b)
-	}
-	div, exp := int64(unit), 0
-	for n := b / unit; n >= unit; n /= unit {
-		div *= unit
-		exp++
-	}
-	return fmt.Sprintf("%.1f %cB", float64(b)/float64(div), "KMGTPE"[exp])
-}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -250,3 +251,482 @@ func TestWorkerPoolResizeDown(t *testing.T) {
 
 	t.Log("Resize down is immediate")
 }
+
+func TestWorkerRecoversFromPanic(t *testing.T) {
+	queue, _ := NewQueue("")
+	cfg := config.DefaultConfig()
+	cfg.Workers = 1
+
+	pool := NewWorkerPool(queue, cfg, nil)
+	// A nil prober makes the deferred-probe path panic
+	pool.workers[0].prober = nil
+
+	waitForFailed := func(n int) {
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) && queue.Stats().Failed < n {
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+
+	job, _ := queue.AddWithoutProbe("/media/crash.mkv", "compress-hevc", 1000)
+
+	pool.Start()
+	defer pool.Stop()
+
+	waitForFailed(1)
+	if got := queue.Stats().Failed; got != 1 {
+		t.Fatalf("expected crashed job to be failed, got %d failed", got)
+	}
+
+	restarts, last := pool.RestartStats()
+	if restarts != 1 {
+		t.Errorf("expected 1 restart, got %d", restarts)
+	}
+	if last == nil || last.JobID != job.ID || last.Stack == "" {
+		t.Errorf("expected last panic for job %s with stack, got %+v", job.ID, last)
+	}
+
+	// The worker slot is still alive and picks up the next job
+	queue.AddWithoutProbe("/media/next.mkv", "compress-hevc", 1000)
+	waitForFailed(2)
+	if got := queue.Stats().Failed; got != 2 {
+		t.Errorf("expected restarted worker to process next job, got %d failed", got)
+	}
+}
+
+func TestWorkerPoolShutdownRequeuesRunningJob(t *testing.T) {
+	dir := t.TempDir()
+	// Stand-in ffmpeg that runs until it is killed
+	fakeFFmpeg := filepath.Join(dir, "ffmpeg")
+	if err := os.WriteFile(fakeFFmpeg, []byte("#!/bin/sh\nsleep 30\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	input := filepath.Join(dir, "video.mkv")
+	if err := os.WriteFile(input, []byte("source"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.FFmpegPath = fakeFFmpeg
+	cfg.MinFreeSpaceMB = 0
+	queue, _ := NewQueue("")
+	job, err := queue.Add(input, "compress-hevc", &ffmpeg.ProbeResult{
+		Path: input, Size: 6, Duration: time.Minute, VideoCodec: "h264",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := NewWorkerPool(queue, cfg, nil)
+	pool.Start()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for queue.Get(job.ID).Status != StatusRunning {
+		if time.Now().After(deadline) {
+			t.Fatalf("job never started: %s %s", queue.Get(job.ID).Status, queue.Get(job.ID).Error)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The grace period runs out while the job is still encoding
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	pool.Shutdown(ctx)
+
+	got := queue.Get(job.ID)
+	if got.Status != StatusPending || !strings.Contains(got.Error, "shutdown") {
+		t.Errorf("expected job requeued as pending, got %s (%q)", got.Status, got.Error)
+	}
+}
+
+func TestWorkerPoolShutdownOutsideSchedule(t *testing.T) {
+	cfg := config.DefaultConfig()
+	hour := time.Now().Hour()
+	cfg.ScheduleEnabled = true
+	cfg.ScheduleStartHour = (hour + 1) % 24
+	cfg.ScheduleEndHour = (hour + 2) % 24
+	queue, _ := NewQueue("")
+
+	pool := NewWorkerPool(queue, cfg, nil)
+	pool.Start()
+	time.Sleep(50 * time.Millisecond) // Let the idle workers start waiting
+
+	// Idle workers waiting for the window leave at once rather than when
+	// the grace period runs out
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	start := time.Now()
+	pool.Shutdown(ctx)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected shutdown not to wait for the schedule check, took %s", elapsed)
+	}
+}
+
+func TestWorkerPoolStalledJob(t *testing.T) {
+	dir := t.TempDir()
+	// Stand-in ffmpeg that never reports progress
+	fakeFFmpeg := filepath.Join(dir, "ffmpeg")
+	if err := os.WriteFile(fakeFFmpeg, []byte("#!/bin/sh\necho 'waiting for device' >&2\nsleep 30\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	input := filepath.Join(dir, "video.mkv")
+	if err := os.WriteFile(input, []byte("source"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	original := stallUnit
+	stallUnit = 100 * time.Millisecond
+	defer func() { stallUnit = original }()
+
+	cfg := config.DefaultConfig()
+	cfg.FFmpegPath = fakeFFmpeg
+	cfg.MinFreeSpaceMB = 0
+	cfg.StallTimeoutMinutes = 1
+	cfg.StallRetries = 1
+	queue, _ := NewQueue("")
+	job, err := queue.Add(input, "compress-hevc", &ffmpeg.ProbeResult{
+		Path: input, Size: 6, Duration: time.Minute, VideoCodec: "h264",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := NewWorkerPool(queue, cfg, nil)
+	pool.Start()
+	defer pool.Stop()
+
+	// Requeued once, then failed on the second stall
+	deadline := time.Now().Add(10 * time.Second)
+	for queue.Get(job.ID).Status != StatusFailed {
+		if time.Now().After(deadline) {
+			t.Fatalf("job never failed: %s %s", queue.Get(job.ID).Status, queue.Get(job.ID).Error)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	got := queue.Get(job.ID)
+	if got.Stalls != 1 {
+		t.Errorf("stalls = %d, want 1", got.Stalls)
+	}
+	if !strings.Contains(got.Error, "stalled") {
+		t.Errorf("error = %q, want a stall", got.Error)
+	}
+	if !strings.Contains(got.Stderr, "waiting for device") || len(got.FFmpegArgs) == 0 {
+		t.Errorf("expected ffmpeg diagnostics, got stderr %q args %v", got.Stderr, got.FFmpegArgs)
+	}
+}
+
+func TestWorkerPoolMaxEncodeTime(t *testing.T) {
+	dir := t.TempDir()
+	fakeFFmpeg := filepath.Join(dir, "ffmpeg")
+	if err := os.WriteFile(fakeFFmpeg, []byte("#!/bin/sh\nsleep 30\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	input := filepath.Join(dir, "video.mkv")
+	if err := os.WriteFile(input, []byte("source"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	original := encodeHourUnit
+	encodeHourUnit = 200 * time.Millisecond
+	defer func() { encodeHourUnit = original }()
+
+	cfg := config.DefaultConfig()
+	cfg.FFmpegPath = fakeFFmpeg
+	cfg.MinFreeSpaceMB = 0
+	cfg.StallTimeoutMinutes = 0
+	cfg.MaxEncodeHours = 1
+	queue, _ := NewQueue("")
+	job, err := queue.Add(input, "compress-hevc", &ffmpeg.ProbeResult{
+		Path: input, Size: 6, Duration: time.Minute, VideoCodec: "h264",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := NewWorkerPool(queue, cfg, nil)
+	pool.Start()
+	defer pool.Stop()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for queue.Get(job.ID).Status != StatusFailed {
+		if time.Now().After(deadline) {
+			t.Fatalf("job never aborted: %s %s", queue.Get(job.ID).Status, queue.Get(job.ID).Error)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if got := queue.Get(job.ID).Error; !strings.Contains(got, "max_encode_hours") {
+		t.Errorf("error = %q, want the max_encode_hours limit", got)
+	}
+}
+
+func TestMaxEncodeTime(t *testing.T) {
+	cfg := config.DefaultConfig()
+	job := &Job{PresetID: "compress-av1"}
+
+	if got := MaxEncodeTime(cfg, job); got != 0 {
+		t.Errorf("default limit = %s, want none", got)
+	}
+
+	cfg.MaxEncodeHours = 24
+	if got := MaxEncodeTime(cfg, job); got != 24*time.Hour {
+		t.Errorf("global limit = %s, want 24h", got)
+	}
+
+	cfg.PresetMaxEncodeHours = map[string]int{"compress-av1": 48}
+	if got := MaxEncodeTime(cfg, job); got != 48*time.Hour {
+		t.Errorf("preset limit = %s, want 48h", got)
+	}
+
+	// A preset can opt out of the global limit
+	cfg.PresetMaxEncodeHours["compress-av1"] = 0
+	if got := MaxEncodeTime(cfg, job); got != 0 {
+		t.Errorf("preset opt-out = %s, want none", got)
+	}
+}
+
+func TestAutoQuality(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.PresetAutoQuality = map[string]bool{"compress-av1": true}
+	if !AutoQuality(cfg, "compress-av1") || AutoQuality(cfg, "compress-hevc") {
+		t.Error("expected auto quality only for the preset that turns it on")
+	}
+
+	// A preset can opt out of the global setting
+	cfg.AutoQuality = true
+	cfg.PresetAutoQuality["compress-av1"] = false
+	if AutoQuality(cfg, "compress-av1") || !AutoQuality(cfg, "compress-hevc") {
+		t.Error("expected auto quality for every preset but the one opting out")
+	}
+}
+
+func TestNoGainReason(t *testing.T) {
+	job := &Job{PresetID: "compress-hevc", InputSize: 1000}
+	tests := []struct {
+		name       string
+		minSavings int
+		keepLarger bool
+		output     int64
+		noGain     bool
+	}{
+		{"smaller", 0, false, 990, false},
+		{"same size", 0, false, 1000, true},
+		{"larger", 0, false, 1200, true},
+		{"under tolerance", 5, false, 960, true},
+		{"at tolerance", 5, false, 950, false},
+		{"keep larger", 5, true, 1200, false},
+	}
+	for _, tt := range tests {
+		cfg := &config.Config{MinSavingsPercent: tt.minSavings, KeepLargerFiles: tt.keepLarger}
+		if got := NoGainReason(cfg, job, tt.output); (got != "") != tt.noGain {
+			t.Errorf("%s: NoGainReason = %q, want no_gain=%v", tt.name, got, tt.noGain)
+		}
+	}
+}
+
+func TestChunkCount(t *testing.T) {
+	cfg := &config.Config{ChunkedSegments: 4, ChunkedMinMinutes: 30}
+	hevc := &ffmpeg.Preset{Codec: ffmpeg.CodecHEVC}
+	movie := &Job{Duration: int64(2 * time.Hour / time.Millisecond)}
+	episode := &Job{Duration: int64(20 * time.Minute / time.Millisecond)}
+
+	if got := ChunkCount(cfg, movie, hevc); got != 4 {
+		t.Errorf("ChunkCount(movie) = %d, want 4", got)
+	}
+	if got := ChunkCount(cfg, episode, hevc); got != 0 {
+		t.Errorf("ChunkCount(episode) = %d, want 0 under chunked_min_minutes", got)
+	}
+	if got := ChunkCount(cfg, movie, &ffmpeg.Preset{Codec: ffmpeg.CodecHEVC, TargetBitrate: 4_000_000}); got != 0 {
+		t.Errorf("ChunkCount(size-targeted) = %d, want 0", got)
+	}
+	if got := ChunkCount(&config.Config{ChunkedMinMinutes: 30}, movie, hevc); got != 0 {
+		t.Errorf("ChunkCount with chunking off = %d, want 0", got)
+	}
+}
+
+func TestOutputContainer(t *testing.T) {
+	cfg := config.DefaultConfig()
+	job := &Job{InputPath: "/media/movie.mp4", PresetID: "compress-hevc"}
+
+	if got := OutputContainer(cfg, job); got != ffmpeg.ContainerMKV {
+		t.Errorf("default container = %q, want mkv", got)
+	}
+
+	cfg.PresetContainers = map[string]string{"compress-hevc": "mp4"}
+	if got := OutputContainer(cfg, job); got != ffmpeg.ContainerMP4 {
+		t.Errorf("preset override = %q, want mp4", got)
+	}
+
+	cfg.PresetContainers = nil
+	cfg.KeepSourceContainer = true
+	if got := OutputContainer(cfg, job); got != ffmpeg.ContainerMP4 {
+		t.Errorf("kept source container = %q, want mp4", got)
+	}
+
+	// Sources we don't write fall back to the configured container
+	job.InputPath = "/media/movie.avi"
+	if got := OutputContainer(cfg, job); got != ffmpeg.ContainerMKV {
+		t.Errorf("avi source = %q, want mkv", got)
+	}
+
+	// Remuxes always write MKV
+	cfg.OutputContainer = "mp4"
+	job.PresetID = "remux-mkv"
+	if got := OutputContainer(cfg, job); got != ffmpeg.ContainerMKV {
+		t.Errorf("remux = %q, want mkv", got)
+	}
+}
+
+func TestEncoderThreads(t *testing.T) {
+	cfg := config.DefaultConfig()
+	job := &Job{PresetID: "compress-hevc"}
+
+	if got := EncoderThreads(cfg, job); got != 0 {
+		t.Errorf("default threads = %d, want 0", got)
+	}
+
+	cfg.PresetThreads = map[string]int{"compress-hevc": 8}
+	if got := EncoderThreads(cfg, job); got != 8 {
+		t.Errorf("preset threads = %d, want 8", got)
+	}
+
+	job.Threads = 4
+	if got := EncoderThreads(cfg, job); got != 4 {
+		t.Errorf("job threads = %d, want 4", got)
+	}
+}
+
+func TestWorkerPoolReserveTemp(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.MinFreeSpaceMB = 0
+	pool := &WorkerPool{cfg: cfg}
+	tempDir := t.TempDir()
+	huge := int64(1) << 60
+
+	// Alone on the filesystem a job starts however large it is
+	release1, reason := pool.reserveTemp(&Job{ID: "a"}, tempDir, filepath.Join(tempDir, "a.tmp"), huge)
+	if reason != "" {
+		t.Fatalf("first job waits: %s", reason)
+	}
+
+	// A second job waits for the first one's output
+	if _, reason := pool.reserveTemp(&Job{ID: "b"}, tempDir, filepath.Join(tempDir, "b.tmp"), 1024); !strings.Contains(reason, "temp space") {
+		t.Errorf("second job reason = %q, want a temp space wait", reason)
+	}
+
+	release1()
+	release2, reason := pool.reserveTemp(&Job{ID: "b"}, tempDir, filepath.Join(tempDir, "b.tmp"), 1024)
+	if reason != "" {
+		t.Errorf("job waits after the first released: %s", reason)
+	}
+	release2()
+
+	// Disabled, nothing is reserved
+	cfg.ReserveTempSpace = false
+	pool.reserveTemp(&Job{ID: "a"}, tempDir, filepath.Join(tempDir, "a.tmp"), huge)
+	if len(pool.tempReservations) != 0 {
+		t.Errorf("reservations with reserve_temp_space off: %v", pool.tempReservations)
+	}
+}
+
+func TestProjectedOutputSize(t *testing.T) {
+	preset := &ffmpeg.Preset{ID: "compress-hevc", Codec: ffmpeg.CodecHEVC}
+	job := &Job{InputSize: 10 << 30, Duration: 2 * 3600 * 1000, VideoCodec: "h264"}
+	if got := ProjectedOutputSize(job, preset); got <= 0 || got >= job.InputSize {
+		t.Errorf("projected = %d, want below the %d input", got, job.InputSize)
+	}
+
+	job.TargetSizeMB = 700
+	if got := ProjectedOutputSize(job, preset); got != 700<<20 {
+		t.Errorf("target size projection = %d, want %d", got, 700<<20)
+	}
+
+	// Without a duration there's no estimate; assume the source's size
+	job = &Job{InputSize: 5 << 30}
+	if got := ProjectedOutputSize(job, preset); got != job.InputSize {
+		t.Errorf("unknown duration projection = %d, want %d", got, job.InputSize)
+	}
+}
+
+func TestWorkerPoolDrainWorker(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Workers = 2
+	queue, _ := NewQueue("")
+	pool := NewWorkerPool(queue, cfg, nil)
+	pool.Start()
+	defer pool.Stop()
+
+	statuses := pool.Workers()
+	if len(statuses) != 2 || statuses[0].State != "idle" || statuses[0].StartedAt.IsZero() {
+		t.Fatalf("expected 2 idle workers, got %+v", statuses)
+	}
+
+	if err := pool.DrainWorker(99); err != ErrWorkerNotFound {
+		t.Errorf("expected ErrWorkerNotFound, got %v", err)
+	}
+	if err := pool.DrainWorker(statuses[1].ID); err != nil {
+		t.Fatalf("DrainWorker: %v", err)
+	}
+	if err := pool.DrainWorker(statuses[0].ID); err == nil {
+		t.Error("expected draining the last worker to fail")
+	}
+
+	// An idle worker leaves the pool within one poll interval
+	deadline := time.Now().Add(5 * time.Second)
+	for pool.WorkerCount() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("drained worker never left the pool: %+v", pool.Workers())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if cfg.Workers != 1 {
+		t.Errorf("expected cfg.Workers = 1 after drain, got %d", cfg.Workers)
+	}
+}
+
+func TestWorkerPoolAssignDevice(t *testing.T) {
+	orig := devicesFor
+	t.Cleanup(func() { devicesFor = orig })
+	devicesFor = func(accel ffmpeg.HWAccel) []string {
+		if accel == ffmpeg.HWAccelVAAPI {
+			return []string{"/dev/dri/renderD128", "/dev/dri/renderD129"}
+		}
+		return nil
+	}
+
+	cfg := &config.Config{
+		Workers:       3,
+		WorkerDevices: []string{"", "", "/dev/dri/renderD129"},
+		FFmpegPath:    "ffmpeg",
+		FFprobePath:   "ffprobe",
+	}
+	queue, _ := NewQueue("")
+	pool := NewWorkerPool(queue, cfg, nil)
+	w0, w1, w2 := pool.workers[0], pool.workers[1], pool.workers[2]
+
+	// Concurrent jobs go to different GPUs
+	first := pool.assignDevice(w0, ffmpeg.HWAccelVAAPI)
+	second := pool.assignDevice(w1, ffmpeg.HWAccelVAAPI)
+	if first == second {
+		t.Errorf("both jobs assigned to %s, want different GPUs", first)
+	}
+	if w0.Status().Device != "" {
+		t.Errorf("idle worker reports device %q", w0.Status().Device)
+	}
+
+	// Once a GPU is free again it is picked over the busy one
+	w0.currentJobMu.Lock()
+	w0.jobDevice = ""
+	w0.currentJobMu.Unlock()
+	if got := pool.assignDevice(w0, ffmpeg.HWAccelVAAPI); got != first {
+		t.Errorf("assignDevice = %s, want the free GPU %s", got, first)
+	}
+
+	// Pinned workers use their device even when it is busy
+	if got := pool.assignDevice(w2, ffmpeg.HWAccelVAAPI); got != "/dev/dri/renderD129" {
+		t.Errorf("pinned worker got %s, want /dev/dri/renderD129", got)
+	}
+	// ...unless it doesn't fit the encoder
+	if got := pool.assignDevice(w2, ffmpeg.HWAccelNone); got != "" {
+		t.Errorf("software job got device %q, want none", got)
+	}
+}
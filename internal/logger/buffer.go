@@ -0,0 +1,149 @@
+package logger
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// DefaultBufferLines is how many recent log lines are kept for /api/logs
+const DefaultBufferLines = 5000
+
+// Entry is one log line kept in the in-memory buffer
+type Entry struct {
+	Seq     uint64            `json:"seq"` // Increases by one per line; use as ?since= to page
+	Time    time.Time         `json:"time"`
+	Level   string            `json:"level"`
+	Module  string            `json:"module,omitempty"`
+	Message string            `json:"message"`
+	Attrs   map[string]string `json:"attrs,omitempty"`
+}
+
+// buffer is a ring of the most recent log lines, plus live subscribers
+type buffer struct {
+	mu      sync.RWMutex
+	entries []Entry // Ring, oldest at next once full
+	next    int
+	full    bool
+	seq     uint64
+
+	subsMu      sync.RWMutex
+	subscribers map[chan Entry]struct{}
+}
+
+var recent = &buffer{
+	entries:     make([]Entry, DefaultBufferLines),
+	subscribers: make(map[chan Entry]struct{}),
+}
+
+// SetBufferSize changes how many lines are kept. Existing lines are dropped
+// if the size changes. Sizes below 1 keep the default.
+func SetBufferSize(lines int) {
+	if lines < 1 {
+		lines = DefaultBufferLines
+	}
+	recent.mu.Lock()
+	defer recent.mu.Unlock()
+	if lines == len(recent.entries) {
+		return
+	}
+	recent.entries = make([]Entry, lines)
+	recent.next = 0
+	recent.full = false
+}
+
+func (b *buffer) add(e Entry) {
+	b.mu.Lock()
+	b.seq++
+	e.Seq = b.seq
+	b.entries[b.next] = e
+	b.next++
+	if b.next == len(b.entries) {
+		b.next = 0
+		b.full = true
+	}
+	b.mu.Unlock()
+
+	b.subsMu.RLock()
+	defer b.subsMu.RUnlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- e:
+		default:
+			// Channel full, skip this subscriber
+		}
+	}
+}
+
+// Recent returns buffered lines after sequence number since, at minLevel or
+// above and newer than after (zero = any time), oldest first
+func Recent(since uint64, after time.Time, minLevel slog.Level) []Entry {
+	recent.mu.RLock()
+	defer recent.mu.RUnlock()
+
+	ordered := recent.entries[:recent.next]
+	if recent.full {
+		ordered = append(append([]Entry(nil), recent.entries[recent.next:]...), ordered...)
+	}
+	result := make([]Entry, 0)
+	for _, e := range ordered {
+		if e.Seq > since && e.Time.After(after) && EntryLevel(e) >= minLevel {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// EntryLevel returns e's level
+func EntryLevel(e Entry) slog.Level {
+	level, _ := ParseLevel(e.Level)
+	return level
+}
+
+// Subscribe returns a channel receiving each new log line
+func Subscribe() chan Entry {
+	ch := make(chan Entry, 100)
+
+	recent.subsMu.Lock()
+	recent.subscribers[ch] = struct{}{}
+	recent.subsMu.Unlock()
+
+	return ch
+}
+
+// Unsubscribe removes a subscription
+func Unsubscribe(ch chan Entry) {
+	recent.subsMu.Lock()
+	delete(recent.subscribers, ch)
+	recent.subsMu.Unlock()
+
+	close(ch)
+}
+
+// newEntry builds a buffer entry from a record and the logger's attrs
+func newEntry(module string, attrs []slog.Attr, r slog.Record) Entry {
+	e := Entry{
+		Time:    r.Time,
+		Level:   levelName(r.Level),
+		Module:  module,
+		Message: r.Message,
+	}
+	add := func(a slog.Attr) {
+		if a.Key == "module" || a.Key == "" {
+			return
+		}
+		if e.Attrs == nil {
+			e.Attrs = make(map[string]string)
+		}
+		e.Attrs[a.Key] = fmt.Sprint(a.Value.Resolve().Any())
+	}
+	for _, a := range attrs {
+		add(a)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		add(a)
+		return true
+	})
+	return e
+}
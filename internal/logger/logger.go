@@ -1,29 +1,258 @@
+// Package logger sets up shrinkray's structured logging: leveled slog output
+// as text or JSON, with per-module levels that can be changed at runtime
+// (see /api/logs/level), and the most recent lines kept in memory for
+// /api/logs. Each package logs through For("<module>"), which
+// tags records with module=<module>. Lines still written with the standard
+// log package are routed through the same handler, taking their module from
+// a leading "[module]" tag.
 package logger
 
 import (
+	"context"
+	"fmt"
+	"log"
 	"log/slog"
 	"os"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
-var Log *slog.Logger
+// Log is the root logger. Prefer For(module) so records carry a module.
+var Log = slog.New(&moduleHandler{})
 
-func Init(level string) {
-	var lvl slog.Level
-	switch strings.ToLower(level) {
+// output is the handler records are written to once Init has run
+var output atomic.Pointer[slog.Handler]
+
+// levels holds the default level and per-module overrides
+var levels = &levelSet{modules: make(map[string]slog.Level)}
+
+// levelSet is the default level plus per-module overrides
+type levelSet struct {
+	mu      sync.RWMutex
+	level   slog.Level
+	modules map[string]slog.Level
+}
+
+func (l *levelSet) enabled(module string, level slog.Level) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if minLevel, ok := l.modules[module]; ok {
+		return level >= minLevel
+	}
+	return level >= l.level
+}
+
+// moduleHandler filters records by their module's level and writes them to
+// the current output, so loggers created before Init follow it, and to the
+// buffer behind /api/logs
+type moduleHandler struct {
+	module string
+	attrs  []slog.Attr                       // From WithAttrs, for buffered entries
+	wrap   []func(slog.Handler) slog.Handler // WithAttrs/WithGroup calls, replayed on output
+}
+
+func (h *moduleHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return levels.enabled(h.module, level)
+}
+
+func (h *moduleHandler) Handle(ctx context.Context, r slog.Record) error {
+	recent.add(newEntry(h.module, h.attrs, r))
+
+	var inner slog.Handler
+	if out := output.Load(); out != nil {
+		inner = *out
+	} else {
+		inner = slog.NewTextHandler(os.Stderr, nil)
+	}
+	for _, wrap := range h.wrap {
+		inner = wrap(inner)
+	}
+	return inner.Handle(ctx, r)
+}
+
+func (h *moduleHandler) with(module string, attrs []slog.Attr, wrap func(slog.Handler) slog.Handler) *moduleHandler {
+	return &moduleHandler{
+		module: module,
+		attrs:  append(slices.Clip(h.attrs), attrs...),
+		wrap:   append(slices.Clip(h.wrap), wrap),
+	}
+}
+
+func (h *moduleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	module := h.module
+	for _, a := range attrs {
+		if a.Key == "module" {
+			module = a.Value.String()
+		}
+	}
+	return h.with(module, attrs, func(inner slog.Handler) slog.Handler { return inner.WithAttrs(attrs) })
+}
+
+func (h *moduleHandler) WithGroup(name string) slog.Handler {
+	return h.with(h.module, nil, func(inner slog.Handler) slog.Handler { return inner.WithGroup(name) })
+}
+
+// Init configures logging. level is debug, info, warn or error (default
+// info); format is "json" or text; moduleLevels overrides the level per
+// module, e.g. {"queue": "debug"}. Standard log output is redirected here.
+func Init(level, format string, moduleLevels map[string]string) {
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug} // Filtered by moduleHandler
+	var inner slog.Handler
+	if strings.EqualFold(format, "json") {
+		inner = slog.NewJSONHandler(os.Stdout, opts)
+	} else {
+		inner = slog.NewTextHandler(os.Stdout, opts)
+	}
+
+	lvl, _ := ParseLevel(level)
+	levels.mu.Lock()
+	levels.level = lvl
+	levels.modules = make(map[string]slog.Level)
+	for module, name := range moduleLevels {
+		if l, ok := ParseLevel(name); ok {
+			levels.modules[module] = l
+		}
+	}
+	levels.mu.Unlock()
+
+	output.Store(&inner)
+	log.SetFlags(0)
+	log.SetOutput(stdLogWriter{})
+}
+
+// For returns a logger whose records are tagged with module
+func For(module string) *slog.Logger {
+	seenMu.Lock()
+	seen[module] = struct{}{}
+	seenMu.Unlock()
+	return Log.With("module", module)
+}
+
+// ParseLevel parses debug, info, warn/warning or error. Unknown names are
+// info and return false.
+func ParseLevel(name string) (slog.Level, bool) {
+	switch strings.ToLower(name) {
 	case "debug":
-		lvl = slog.LevelDebug
+		return slog.LevelDebug, true
+	case "info":
+		return slog.LevelInfo, true
 	case "warn", "warning":
-		lvl = slog.LevelWarn
+		return slog.LevelWarn, true
 	case "error":
-		lvl = slog.LevelError
-	default:
-		lvl = slog.LevelInfo
+		return slog.LevelError, true
+	}
+	return slog.LevelInfo, false
+}
+
+// levelName is the config name of a level
+func levelName(level slog.Level) string {
+	return strings.ToLower(level.String())
+}
+
+// SetLevel changes the default level
+func SetLevel(name string) error {
+	level, ok := ParseLevel(name)
+	if !ok {
+		return fmt.Errorf("unknown log level %q (use debug, info, warn or error)", name)
 	}
+	levels.mu.Lock()
+	levels.level = level
+	levels.mu.Unlock()
+	return nil
+}
+
+// SetModuleLevel overrides one module's level; an empty name removes the
+// override so the module follows the default again
+func SetModuleLevel(module, name string) error {
+	if name == "" {
+		levels.mu.Lock()
+		delete(levels.modules, module)
+		levels.mu.Unlock()
+		return nil
+	}
+	level, ok := ParseLevel(name)
+	if !ok {
+		return fmt.Errorf("unknown log level %q (use debug, info, warn or error)", name)
+	}
+	levels.mu.Lock()
+	levels.modules[module] = level
+	levels.mu.Unlock()
+	return nil
+}
+
+// Levels returns the default level and the per-module overrides
+func Levels() (string, map[string]string) {
+	levels.mu.RLock()
+	defer levels.mu.RUnlock()
+	modules := make(map[string]string, len(levels.modules))
+	for module, level := range levels.modules {
+		modules[module] = levelName(level)
+	}
+	return levelName(levels.level), modules
+}
 
-	Log = slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
-		Level: lvl,
-	}))
+// Modules lists the module tags seen so far, for the level toggle
+func Modules() []string {
+	seenMu.Lock()
+	defer seenMu.Unlock()
+	modules := make([]string, 0, len(seen))
+	for module := range seen {
+		modules = append(modules, module)
+	}
+	sort.Strings(modules)
+	return modules
+}
+
+var (
+	seenMu sync.Mutex
+	seen   = make(map[string]struct{})
+)
+
+// stdLogWriter turns standard log lines into records: a leading "[module]"
+// tag becomes the module attribute, and lines starting with Warning or
+// Error (or "failed") are logged at those levels
+type stdLogWriter struct{}
+
+func (stdLogWriter) Write(p []byte) (int, error) {
+	line := strings.TrimRight(string(p), "\n")
+	module := ""
+	if strings.HasPrefix(line, "[") {
+		if end := strings.Index(line, "]"); end > 0 {
+			module = line[1:end]
+			line = strings.TrimSpace(line[end+1:])
+		}
+	}
+	level := stdLogLevel(line)
+
+	if module != "" {
+		seenMu.Lock()
+		seen[module] = struct{}{}
+		seenMu.Unlock()
+	}
+	if !levels.enabled(module, level) {
+		return len(p), nil
+	}
+	l := Log
+	if module != "" {
+		l = l.With("module", module)
+	}
+	l.Log(context.Background(), level, line)
+	return len(p), nil
+}
+
+// stdLogLevel guesses the level of an untagged log line from its wording
+func stdLogLevel(line string) slog.Level {
+	lower := strings.ToLower(line)
+	switch {
+	case strings.HasPrefix(lower, "error"), strings.HasPrefix(lower, "fatal"), strings.Contains(lower, "panic"):
+		return slog.LevelError
+	case strings.HasPrefix(lower, "warning"), strings.HasPrefix(lower, "failed"), strings.Contains(lower, " failed"):
+		return slog.LevelWarn
+	}
+	return slog.LevelInfo
 }
 
 func Debug(msg string, args ...any) {
@@ -0,0 +1,205 @@
+// Package mountwatch holds the queue while a media root is unreachable, so
+// a dropped NFS or SMB mount doesn't fail every job in the queue one after
+// another. Running jobs are paused rather than left to hit I/O errors, and
+// everything resumes once the mount is back.
+package mountwatch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/config"
+	"github.com/gwlsn/shrinkray/internal/diskspace"
+	"github.com/gwlsn/shrinkray/internal/jobs"
+	"github.com/gwlsn/shrinkray/internal/logger"
+)
+
+var mountLog = logger.For("mountwatch")
+
+// Pool is the part of jobs.WorkerPool the watchdog drives
+type Pool interface {
+	PauseJob(jobID string) bool
+	ResumeJob(jobID string) bool
+}
+
+// Status is the result of the latest check
+type Status struct {
+	Enabled   bool      `json:"enabled"`
+	Healthy   bool      `json:"healthy"`
+	Problem   string    `json:"problem,omitempty"` // e.g. "/media: not responding after 10s"
+	CheckedAt time.Time `json:"checked_at,omitempty"`
+}
+
+// Watcher checks the media roots and holds the queue while one is down
+type Watcher struct {
+	queue *jobs.Queue
+	pool  Pool
+	cfg   func() config.MountWatchConfig
+	paths func() []string
+	check func(path string, timeout time.Duration) (mountPoint bool, err error)
+
+	mu         sync.Mutex
+	status     Status
+	seen       map[string]bool // Roots that have been reachable
+	mounted    map[string]bool // Roots that were mount points when first seen healthy
+	pausedJobs []string        // Running jobs paused by the watchdog
+}
+
+// New creates a watcher for the roots paths returns. cfg and paths are
+// re-read every check so config changes apply without a restart.
+func New(queue *jobs.Queue, pool Pool, cfg func() config.MountWatchConfig, paths func() []string) *Watcher {
+	return &Watcher{
+		queue:   queue,
+		pool:    pool,
+		cfg:     cfg,
+		paths:   paths,
+		check:   checkPath,
+		seen:    make(map[string]bool),
+		mounted: make(map[string]bool),
+		status:  Status{Healthy: true},
+	}
+}
+
+// Start checks every interval_seconds until ctx is done
+func (w *Watcher) Start(ctx context.Context) {
+	go func() {
+		for {
+			interval := time.Duration(w.cfg().IntervalSeconds) * time.Second
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+			}
+			w.Check()
+		}
+	}()
+}
+
+// Status returns the result of the latest check
+func (w *Watcher) Status() Status {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	status := w.status
+	status.Enabled = w.cfg().Enabled
+	return status
+}
+
+// Check lists each root and holds or releases the queue on a change
+func (w *Watcher) Check() {
+	cfg := w.cfg()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !cfg.Enabled {
+		// Don't leave the queue held if the watchdog is turned off while down
+		if !w.status.Healthy {
+			w.recoverLocked()
+		}
+		return
+	}
+
+	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
+	problem := ""
+	for _, path := range w.paths() {
+		mountPoint, err := w.check(path, timeout)
+		switch {
+		case err != nil && !w.seen[path]:
+			// A root that has never been reachable is a misconfiguration
+			// (reported by the self-check), not a mount that dropped
+		case err != nil:
+			problem = fmt.Sprintf("%s: %v", path, err)
+		case w.mounted[path] && !mountPoint:
+			problem = fmt.Sprintf("%s: no longer mounted", path)
+		default:
+			if !w.seen[path] {
+				w.seen[path] = true
+				w.mounted[path] = mountPoint
+			}
+		}
+		if problem != "" {
+			break
+		}
+	}
+
+	wasHealthy := w.status.Healthy
+	w.status = Status{Healthy: problem == "", Problem: problem, CheckedAt: time.Now()}
+	switch {
+	case wasHealthy && problem != "":
+		w.holdLocked(problem)
+	case !wasHealthy && problem == "":
+		w.recoverLocked()
+	}
+}
+
+// holdLocked stops new jobs and pauses the local ones running
+func (w *Watcher) holdLocked(problem string) {
+	mountLog.Warn("Media unreachable, pausing the queue", "problem", problem)
+	w.queue.Hold("Media unreachable: " + problem)
+
+	w.pausedJobs = nil
+	for _, job := range w.queue.GetAll() {
+		if job.Status == jobs.StatusRunning && job.Agent == "" && w.pool.PauseJob(job.ID) {
+			w.pausedJobs = append(w.pausedJobs, job.ID)
+		}
+	}
+}
+
+// recoverLocked resumes the jobs holdLocked paused and releases the queue
+func (w *Watcher) recoverLocked() {
+	mountLog.Info("Media reachable again, resuming the queue", "jobs", len(w.pausedJobs))
+	for _, id := range w.pausedJobs {
+		w.pool.ResumeJob(id)
+	}
+	w.pausedJobs = nil
+	w.status = Status{Healthy: true, CheckedAt: time.Now()}
+	w.queue.Release()
+}
+
+// checkPath lists path within timeout, and reports whether it is a mount
+// point (on a different filesystem from its parent). A hung network mount
+// blocks the listing indefinitely, so it runs in a goroutine that is
+// abandoned on timeout.
+func checkPath(path string, timeout time.Duration) (bool, error) {
+	type result struct {
+		mountPoint bool
+		err        error
+	}
+	done := make(chan result, 1)
+	go func() {
+		f, err := os.Open(path)
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		defer f.Close()
+		if _, err := f.Readdirnames(1); err != nil && err != io.EOF {
+			done <- result{err: err}
+			return
+		}
+
+		self, err := diskspace.Device(path)
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		parent, err := diskspace.Device(filepath.Dir(path))
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		done <- result{mountPoint: self != parent}
+	}()
+
+	select {
+	case r := <-done:
+		return r.mountPoint, r.err
+	case <-time.After(timeout):
+		return false, fmt.Errorf("not responding after %s", timeout)
+	}
+}
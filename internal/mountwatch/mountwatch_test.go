@@ -0,0 +1,117 @@
+package mountwatch
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/config"
+	"github.com/gwlsn/shrinkray/internal/jobs"
+)
+
+type fakePool struct {
+	paused map[string]bool
+}
+
+func (p *fakePool) PauseJob(id string) bool {
+	p.paused[id] = true
+	return true
+}
+
+func (p *fakePool) ResumeJob(id string) bool {
+	delete(p.paused, id)
+	return true
+}
+
+func TestWatcherHoldsQueueWhileMediaIsDown(t *testing.T) {
+	queue, err := jobs.NewQueue(filepath.Join(t.TempDir(), "queue.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	running, _ := queue.AddWithoutProbe("/media/a.mkv", "compress-hevc", 1000)
+	if err := queue.StartJob(running.ID, "/tmp/a.tmp", ""); err != nil {
+		t.Fatal(err)
+	}
+	queue.AddWithoutProbe("/media/b.mkv", "compress-hevc", 1000)
+
+	pool := &fakePool{paused: make(map[string]bool)}
+	cfg := config.MountWatchConfig{Enabled: true, IntervalSeconds: 30, TimeoutSeconds: 1}
+	w := New(queue, pool, func() config.MountWatchConfig { return cfg }, func() []string { return []string{"/media"} })
+
+	var checkErr error
+	mountPoint := true
+	w.check = func(string, time.Duration) (bool, error) { return mountPoint, checkErr }
+
+	w.Check()
+	if !w.Status().Healthy || queue.GetNext() == nil {
+		t.Fatal("expected a healthy mount to leave the queue running")
+	}
+
+	checkErr = errors.New("not responding after 1s")
+	w.Check()
+	if w.Status().Healthy {
+		t.Error("expected an unhealthy status")
+	}
+	if queue.GetNext() != nil {
+		t.Error("expected no job to start while the mount is down")
+	}
+	if queue.Stats().HoldReason == "" {
+		t.Error("expected the hold reason in stats")
+	}
+	if !pool.paused[running.ID] {
+		t.Error("expected the running job to be paused")
+	}
+
+	checkErr = nil
+	w.Check()
+	if queue.GetNext() == nil || queue.Stats().HoldReason != "" {
+		t.Error("expected the queue released once the mount is back")
+	}
+	if len(pool.paused) != 0 {
+		t.Errorf("expected paused jobs resumed, still paused: %v", pool.paused)
+	}
+
+	// A mount point that's unmounted leaves an empty, reachable directory
+	mountPoint = false
+	w.Check()
+	if w.Status().Healthy {
+		t.Error("expected an unmounted root to be unhealthy")
+	}
+	mountPoint = true
+	w.Check()
+
+	// Turning the watchdog off while down releases the queue
+	checkErr = errors.New("stale file handle")
+	w.Check()
+	cfg.Enabled = false
+	w.Check()
+	if queue.Stats().HoldReason != "" {
+		t.Error("expected the queue released when the watchdog is disabled")
+	}
+}
+
+func TestWatcherIgnoresRootsNeverReachable(t *testing.T) {
+	queue, err := jobs.NewQueue(filepath.Join(t.TempDir(), "queue.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.MountWatchConfig{Enabled: true, TimeoutSeconds: 1}
+	w := New(queue, &fakePool{paused: make(map[string]bool)}, func() config.MountWatchConfig { return cfg },
+		func() []string { return []string{filepath.Join(t.TempDir(), "missing")} })
+
+	w.Check()
+	if !w.Status().Healthy || queue.Stats().HoldReason != "" {
+		t.Error("expected a root that never existed not to hold the queue")
+	}
+}
+
+func TestCheckPath(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := checkPath(dir, time.Second); err != nil {
+		t.Errorf("checkPath(%s) = %v", dir, err)
+	}
+	if _, err := checkPath(filepath.Join(dir, "missing"), time.Second); err == nil {
+		t.Error("expected an error for a missing root")
+	}
+}
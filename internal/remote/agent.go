@@ -0,0 +1,408 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/ffmpeg"
+	"github.com/gwlsn/shrinkray/internal/jobs"
+	"github.com/gwlsn/shrinkray/internal/logger"
+)
+
+var agentLog = logger.For("agent")
+
+// errGone means the server reported the lease lost (410)
+var errGone = errors.New("job was cancelled or reassigned")
+
+// errUnregistered means the server no longer knows the agent ID, e.g.
+// after a restart; the agent registers again
+var errUnregistered = errors.New("agent not registered")
+
+const (
+	// heartbeatInterval is how often the lease is renewed while a job runs;
+	// well under LeaseTimeout so a slow upload doesn't lose the job.
+	heartbeatInterval = 30 * time.Second
+	// downloadRetries is how many times a broken download is resumed
+	downloadRetries = 5
+)
+
+// AgentConfig configures a remote agent
+type AgentConfig struct {
+	Server       string // Base URL of the Shrinkray server
+	Token        string // Shared remote.token
+	Name         string // Shown in the server UI (default: hostname)
+	WorkDir      string // Where sources and outputs are staged
+	FFmpegPath   string
+	PollInterval time.Duration // Wait between claims when the queue is empty
+	Version      string
+}
+
+// RunAgent registers with the server and processes jobs one at a time until
+// ctx is cancelled. ffmpeg.DetectEncoders and InitPresets must have run so
+// presets resolve to this machine's encoders.
+func RunAgent(ctx context.Context, cfg AgentConfig) error {
+	if cfg.Name == "" {
+		cfg.Name, _ = os.Hostname()
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 15 * time.Second
+	}
+	if err := os.MkdirAll(cfg.WorkDir, 0755); err != nil {
+		return fmt.Errorf("failed to create work dir: %w", err)
+	}
+
+	a := &agent{cfg: cfg, client: &http.Client{}}
+	for ctx.Err() == nil {
+		if a.id == "" {
+			if err := a.register(ctx); err != nil {
+				agentLog.Warn("Register failed", "error", err)
+				sleep(ctx, cfg.PollInterval)
+				continue
+			}
+		}
+
+		assignment, err := a.claim(ctx)
+		if errors.Is(err, errUnregistered) {
+			a.id = ""
+			continue
+		}
+		if err != nil {
+			agentLog.Warn("Claim failed", "error", err)
+			sleep(ctx, cfg.PollInterval)
+			continue
+		}
+		if assignment == nil {
+			sleep(ctx, cfg.PollInterval)
+			continue
+		}
+
+		a.process(ctx, assignment)
+	}
+	return ctx.Err()
+}
+
+type agent struct {
+	cfg    AgentConfig
+	client *http.Client
+	id     string
+}
+
+func (a *agent) register(ctx context.Context) error {
+	var encoders []string
+	for _, enc := range ffmpeg.ListAvailableEncoders() {
+		if enc.Available {
+			encoders = append(encoders, enc.Encoder)
+		}
+	}
+
+	var resp RegisterResponse
+	req := RegisterRequest{Name: a.cfg.Name, Version: a.cfg.Version, Encoders: encoders}
+	if err := a.call(ctx, http.MethodPost, "/api/remote/register", req, &resp); err != nil {
+		return err
+	}
+	a.id = resp.AgentID
+	agentLog.Info("Registered", "server", a.cfg.Server, "name", a.cfg.Name)
+	return nil
+}
+
+func (a *agent) claim(ctx context.Context) (*Assignment, error) {
+	var assignment Assignment
+	if err := a.call(ctx, http.MethodPost, "/api/remote/claim", ClaimRequest{AgentID: a.id}, &assignment); err != nil {
+		return nil, err
+	}
+	if assignment.Job == nil {
+		return nil, nil
+	}
+	return &assignment, nil
+}
+
+// process runs one job: download, transcode, upload. Failures are reported
+// to the server; a lost lease abandons the job quietly.
+func (a *agent) process(ctx context.Context, as *Assignment) {
+	job := as.Job
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	agentLog.Info("Starting job", "job", job.ID, "path", job.InputPath)
+
+	srcPath := filepath.Join(a.cfg.WorkDir, job.ID+filepath.Ext(job.InputPath))
+	outPath := ffmpeg.BuildTempPath(job.InputPath, a.cfg.WorkDir)
+	defer os.Remove(srcPath)
+	defer os.Remove(outPath)
+
+	// Heartbeat for the whole job so long downloads/uploads keep the lease
+	var mu sync.Mutex
+	report := ProgressReport{}
+	go func() {
+		ticker := time.NewTicker(heartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-jobCtx.Done():
+				return
+			case <-ticker.C:
+				mu.Lock()
+				r := report
+				mu.Unlock()
+				if err := a.progress(jobCtx, job.ID, r); errors.Is(err, errGone) || errors.Is(err, errUnregistered) {
+					agentLog.Info("Job was cancelled on the server", "job", job.ID)
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	if err := a.download(jobCtx, job.ID, srcPath); err != nil {
+		a.fail(ctx, jobCtx, job.ID, FailReport{Error: fmt.Sprintf("download failed: %v", err)})
+		return
+	}
+
+	hdrHandling := ffmpeg.NormalizeHDRHandling(as.HDRHandling)
+	preset, err := jobs.PresetForJob(job, hdrHandling)
+	if err != nil {
+		a.fail(ctx, jobCtx, job.ID, FailReport{Error: err.Error()})
+		return
+	}
+	if container, ok := ffmpeg.ParseContainer(as.Container); ok {
+		containerPreset := *preset
+		containerPreset.Container = container
+		preset = &containerPreset
+	}
+
+	transcoder := ffmpeg.NewTranscoder(a.cfg.FFmpegPath)
+	duration := time.Duration(job.Duration) * time.Millisecond
+	qualityHEVC, qualityAV1 := as.QualityHEVC, as.QualityAV1
+	if as.AutoQuality {
+		autoPreset := *preset
+		autoPreset.AutoQuality = true
+		preset = &autoPreset
+	}
+	tonemapping := job.HDR != nil && hdrHandling == ffmpeg.HDRHandlingTonemap
+	if preset.AutoQuality && ffmpeg.CanSearchQuality(preset) && !tonemapping {
+		search, err := transcoder.SearchQuality(jobCtx, srcPath, preset, duration, job.InputSize,
+			job.BitDepth, job.PixFmt, job.VideoCodec, qualityHEVC, qualityAV1, ffmpeg.QualitySearchOptions{
+				TargetSSIM:    as.AutoQualityTargetSSIM,
+				TargetSavings: float64(as.AutoQualityTargetSavings) / 100,
+				TempDir:       a.cfg.WorkDir,
+
+				SourceVideoBitrate: job.VideoBitrate,
+			})
+		if err == nil {
+			qualityHEVC, qualityAV1 = search.Quality, search.Quality
+		} else if jobCtx.Err() != nil {
+			return
+		}
+	}
+
+	progressCh := make(chan ffmpeg.Progress, 10)
+	go func() {
+		for p := range progressCh {
+			mu.Lock()
+			report = ProgressReport{Progress: p.Percent, Speed: p.Speed, ETA: p.ETA.Round(time.Second).String()}
+			mu.Unlock()
+		}
+	}()
+
+	_, err = transcoder.Transcode(jobCtx, srcPath, outPath, preset, duration, job.Bitrate, job.SubtitleCodecs,
+		as.SubtitleHandling, job.BitDepth, job.PixFmt, job.VideoCodec, qualityHEVC, qualityAV1, job.HDR, hdrHandling, progressCh)
+	if err != nil {
+		if jobCtx.Err() != nil {
+			return
+		}
+		failure := FailReport{Error: err.Error()}
+		if te, ok := err.(*ffmpeg.TranscodeError); ok {
+			failure = FailReport{Error: te.Message, Stderr: te.Stderr, ExitCode: te.ExitCode, FFmpegArgs: te.Args}
+		}
+		a.fail(ctx, jobCtx, job.ID, failure)
+		return
+	}
+
+	mu.Lock()
+	report = ProgressReport{Progress: 100, ETA: "uploading"}
+	mu.Unlock()
+	if err := a.upload(jobCtx, job.ID, outPath); err != nil {
+		if errors.Is(err, errGone) || jobCtx.Err() != nil {
+			return
+		}
+		a.fail(ctx, jobCtx, job.ID, FailReport{Error: fmt.Sprintf("upload failed: %v", err)})
+		return
+	}
+	agentLog.Info("Job done", "job", job.ID)
+}
+
+// download fetches the source, resuming with Range requests after errors
+func (a *agent) download(ctx context.Context, jobID, dest string) error {
+	f, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var offset int64
+	var lastErr error
+	for attempt := 0; attempt < downloadRetries; attempt++ {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		req, err := a.newRequest(ctx, http.MethodGet, "/api/remote/jobs/"+jobID+"/source", nil)
+		if err != nil {
+			return err
+		}
+		if offset > 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		}
+
+		resp, err := a.client.Do(req)
+		if err != nil {
+			lastErr = err
+			sleep(ctx, time.Duration(attempt+1)*time.Second)
+			continue
+		}
+		if err := statusError(resp); err != nil {
+			resp.Body.Close()
+			return err
+		}
+		if offset > 0 && resp.StatusCode != http.StatusPartialContent {
+			// Server ignored the range; start over
+			offset = 0
+			f.Truncate(0)
+		}
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			resp.Body.Close()
+			return err
+		}
+
+		n, err := io.Copy(f, resp.Body)
+		resp.Body.Close()
+		offset += n
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		agentLog.Warn("Download interrupted, resuming", "job", jobID, "offset", offset, "error", err)
+	}
+	return lastErr
+}
+
+func (a *agent) upload(ctx context.Context, jobID, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	req, err := a.newRequest(ctx, http.MethodPut, "/api/remote/jobs/"+jobID+"/result", f)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = info.Size()
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return statusError(resp)
+}
+
+func (a *agent) progress(ctx context.Context, jobID string, report ProgressReport) error {
+	return a.call(ctx, http.MethodPost, "/api/remote/jobs/"+jobID+"/progress", report, nil)
+}
+
+// fail reports a failure unless the job was cancelled (jobCtx done)
+func (a *agent) fail(ctx, jobCtx context.Context, jobID string, report FailReport) {
+	if jobCtx.Err() != nil {
+		return
+	}
+	agentLog.Warn("Job failed", "job", jobID, "error", report.Error)
+	if err := a.call(ctx, http.MethodPost, "/api/remote/jobs/"+jobID+"/fail", report, nil); err != nil {
+		agentLog.Warn("Could not report job failure", "job", jobID, "error", err)
+	}
+}
+
+// call sends a JSON request and decodes the JSON response into out (if non-nil)
+func (a *agent) call(ctx context.Context, method, endpoint string, body, out interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := a.newRequest(ctx, method, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := statusError(resp); err != nil {
+		return err
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (a *agent) newRequest(ctx context.Context, method, endpoint string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(a.cfg.Server, "/")+endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+a.cfg.Token)
+	if a.id != "" {
+		req.Header.Set(AgentHeader, a.id)
+	}
+	return req, nil
+}
+
+// statusError maps error responses to errors, keeping the server's message
+func statusError(resp *http.Response) error {
+	if resp.StatusCode < 300 {
+		return nil
+	}
+	var body struct {
+		Error string `json:"error"`
+	}
+	json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&body)
+	switch resp.StatusCode {
+	case http.StatusGone:
+		return errGone
+	case http.StatusNotFound:
+		if body.Error == ErrUnknownAgent.Error() {
+			return errUnregistered
+		}
+	}
+	if body.Error == "" {
+		body.Error = resp.Status
+	}
+	return fmt.Errorf("server returned %d: %s", resp.StatusCode, body.Error)
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
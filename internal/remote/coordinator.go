@@ -0,0 +1,309 @@
+package remote
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/config"
+	"github.com/gwlsn/shrinkray/internal/ffmpeg"
+	"github.com/gwlsn/shrinkray/internal/jobs"
+	"github.com/gwlsn/shrinkray/internal/logger"
+)
+
+var remoteLog = logger.For("remote")
+
+var (
+	// ErrUnknownAgent is returned for an agent ID that isn't registered
+	// (e.g. after a server restart); the agent should register again.
+	ErrUnknownAgent = errors.New("unknown agent")
+	// ErrLeaseLost is returned when the job was cancelled, released or
+	// reassigned; the agent should abandon it.
+	ErrLeaseLost = errors.New("job is no longer assigned to this agent")
+)
+
+// agentExpiry removes agents that haven't been heard from in this long
+const agentExpiry = time.Hour
+
+// Agent is a registered remote worker
+type Agent struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Version      string    `json:"version"`
+	Encoders     []string  `json:"encoders"`
+	RegisteredAt time.Time `json:"registered_at"`
+	LastSeen     time.Time `json:"last_seen"`
+	JobID        string    `json:"job_id,omitempty"` // Job currently held
+}
+
+// Coordinator hands queued jobs to remote agents and takes back their results
+type Coordinator struct {
+	queue *jobs.Queue
+	pool  *jobs.WorkerPool
+	cfg   *config.Config
+
+	mu     sync.Mutex
+	agents map[string]*Agent
+	leases map[string]string // job ID -> agent ID
+}
+
+// NewCoordinator creates a coordinator; results are finalized through pool
+// so they get the same size check and completion hooks as local jobs.
+func NewCoordinator(queue *jobs.Queue, pool *jobs.WorkerPool, cfg *config.Config) *Coordinator {
+	return &Coordinator{
+		queue:  queue,
+		pool:   pool,
+		cfg:    cfg,
+		agents: make(map[string]*Agent),
+		leases: make(map[string]string),
+	}
+}
+
+// Register adds an agent and returns its ID
+func (c *Coordinator) Register(req RegisterRequest) *Agent {
+	id := make([]byte, 8)
+	rand.Read(id)
+
+	name := req.Name
+	if name == "" {
+		name = "agent"
+	}
+	now := time.Now()
+	agent := &Agent{
+		ID:           hex.EncodeToString(id),
+		Name:         name,
+		Version:      req.Version,
+		Encoders:     req.Encoders,
+		RegisteredAt: now,
+		LastSeen:     now,
+	}
+
+	c.mu.Lock()
+	c.agents[agent.ID] = agent
+	c.mu.Unlock()
+
+	remoteLog.Info("Agent registered", "agent", agent.Name, "id", agent.ID)
+	return agent
+}
+
+// Agents returns the registered agents by name
+func (c *Coordinator) Agents() []Agent {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	agents := make([]Agent, 0, len(c.agents))
+	for _, a := range c.agents {
+		agents = append(agents, *a)
+	}
+	sort.Slice(agents, func(i, j int) bool { return agents[i].Name < agents[j].Name })
+	return agents
+}
+
+// Claim assigns the next pending job to the agent. Returns nil when there
+// is nothing to do, including outside the schedule window and during
+// shutdown. HDR and hard-linked jobs the policies would skip are skipped
+// here.
+func (c *Coordinator) Claim(agentID string) (*Assignment, error) {
+	c.mu.Lock()
+	agent, ok := c.agents[agentID]
+	if !ok {
+		c.mu.Unlock()
+		return nil, ErrUnknownAgent
+	}
+	agent.LastSeen = time.Now()
+	name := agent.Name
+	c.mu.Unlock()
+
+	// Outside the schedule window or while shutting down agents wait, like
+	// local workers
+	if !jobs.ScheduleAllowed(c.cfg, time.Now()) || (c.pool != nil && c.pool.ShuttingDown()) {
+		return nil, nil
+	}
+
+	hdrHandling := ffmpeg.NormalizeHDRHandling(c.cfg.HDRHandling)
+	for {
+		job := c.queue.ClaimNext(name)
+		if job == nil {
+			return nil, nil
+		}
+		if reason := jobs.HDRSkipReason(job, hdrHandling); reason != "" {
+			c.queue.SkipJob(job.ID, reason)
+			continue
+		}
+		if reason := jobs.HardlinkSkipReason(c.cfg, job); reason != "" {
+			c.queue.SkipJob(job.ID, reason)
+			continue
+		}
+
+		c.mu.Lock()
+		c.leases[job.ID] = agentID
+		agent.JobID = job.ID
+		c.mu.Unlock()
+
+		remoteLog.Info("Agent claimed job", "agent", name, "job", job.ID, "path", job.InputPath)
+		return &Assignment{
+			Job:                      job,
+			SubtitleHandling:         c.cfg.SubtitleHandling,
+			HDRHandling:              string(hdrHandling),
+			Container:                string(jobs.OutputContainer(c.cfg, job)),
+			QualityHEVC:              c.cfg.QualityHEVC,
+			QualityAV1:               c.cfg.QualityAV1,
+			AutoQuality:              jobs.AutoQuality(c.cfg, job.PresetID),
+			AutoQualityTargetSSIM:    c.cfg.AutoQualityTargetSSIM,
+			AutoQualityTargetSavings: c.cfg.AutoQualityTargetSavings,
+		}, nil
+	}
+}
+
+// Source returns the input path of a job held by the agent
+func (c *Coordinator) Source(agentID, jobID string) (string, error) {
+	job, err := c.leased(agentID, jobID)
+	if err != nil {
+		return "", err
+	}
+	return job.InputPath, nil
+}
+
+// Progress records progress and renews the lease
+func (c *Coordinator) Progress(agentID, jobID string, report ProgressReport) error {
+	if _, err := c.leased(agentID, jobID); err != nil {
+		return err
+	}
+	c.queue.UpdateProgress(jobID, report.Progress, report.Speed, report.ETA)
+	return nil
+}
+
+// Complete stores the uploaded result next to the source (or in temp_path)
+// and finalizes the job. size is the expected length, or -1 if unknown.
+func (c *Coordinator) Complete(agentID, jobID string, body io.Reader, size int64) error {
+	job, err := c.leased(agentID, jobID)
+	if err != nil {
+		return err
+	}
+
+	tempPath := ffmpeg.BuildTempPath(job.InputPath, c.cfg.GetTempDir(job.InputPath))
+	f, err := os.Create(tempPath)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", tempPath, err)
+	}
+	written, err := io.Copy(f, body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && size >= 0 && written != size {
+		err = fmt.Errorf("upload truncated: got %d of %d bytes", written, size)
+	}
+	if err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	// The job may have been cancelled while the upload was in flight
+	if _, err := c.leased(agentID, jobID); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	c.release(jobID)
+	c.pool.CompleteExternal(job, tempPath, written)
+	remoteLog.Info("Job completed by agent", "job", jobID, "agent", job.Agent)
+	return nil
+}
+
+// Fail marks a job held by the agent as failed
+func (c *Coordinator) Fail(agentID, jobID string, report FailReport) error {
+	if _, err := c.leased(agentID, jobID); err != nil {
+		return err
+	}
+	c.release(jobID)
+
+	if report.Error == "" {
+		report.Error = "remote transcode failed"
+	}
+	return c.queue.FailJobWithDetails(jobID, report.Error, &jobs.FailJobDetails{
+		Stderr:     report.Stderr,
+		ExitCode:   report.ExitCode,
+		FFmpegArgs: report.FFmpegArgs,
+	})
+}
+
+// StartReaper periodically returns jobs from silent agents to the queue
+// and forgets agents that have gone away.
+func (c *Coordinator) StartReaper(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(LeaseTimeout / 5)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.reap(time.Now())
+			}
+		}
+	}()
+}
+
+func (c *Coordinator) reap(now time.Time) {
+	c.mu.Lock()
+	var expired []string
+	for jobID, agentID := range c.leases {
+		agent, ok := c.agents[agentID]
+		if !ok || now.Sub(agent.LastSeen) > LeaseTimeout {
+			expired = append(expired, jobID)
+		}
+	}
+	for id, agent := range c.agents {
+		if now.Sub(agent.LastSeen) > agentExpiry {
+			delete(c.agents, id)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, jobID := range expired {
+		c.release(jobID)
+		if err := c.queue.ReleaseJob(jobID, "remote agent stopped responding; job requeued"); err == nil {
+			remoteLog.Warn("Requeued job after its agent went silent", "job", jobID)
+		}
+	}
+}
+
+// leased returns the job if the agent still holds it, renewing the agent's
+// last-seen time. Cancelled or reassigned jobs drop the lease.
+func (c *Coordinator) leased(agentID, jobID string) (*jobs.Job, error) {
+	c.mu.Lock()
+	agent, ok := c.agents[agentID]
+	if !ok {
+		c.mu.Unlock()
+		return nil, ErrUnknownAgent
+	}
+	agent.LastSeen = time.Now()
+	holder := c.leases[jobID]
+	c.mu.Unlock()
+
+	job := c.queue.Get(jobID)
+	if holder != agentID || job == nil || job.Status != jobs.StatusRunning {
+		if holder == agentID {
+			c.release(jobID)
+		}
+		return nil, ErrLeaseLost
+	}
+	return job, nil
+}
+
+// release forgets the lease on a job
+func (c *Coordinator) release(jobID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if agent, ok := c.agents[c.leases[jobID]]; ok && agent.JobID == jobID {
+		agent.JobID = ""
+	}
+	delete(c.leases, jobID)
+}
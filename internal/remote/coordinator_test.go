@@ -0,0 +1,147 @@
+package remote
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/config"
+	"github.com/gwlsn/shrinkray/internal/ffmpeg"
+	"github.com/gwlsn/shrinkray/internal/jobs"
+)
+
+func newTestCoordinator(t *testing.T, content string) (*Coordinator, *jobs.Queue, *jobs.Job) {
+	t.Helper()
+	dir := t.TempDir()
+	input := filepath.Join(dir, "video.mp4")
+	if err := os.WriteFile(input, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	queue, err := jobs.NewQueue("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := queue.Add(input, "compress", &ffmpeg.ProbeResult{
+		Path:       input,
+		Size:       int64(len(content)),
+		Duration:   10 * time.Second,
+		VideoCodec: "h264",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.MediaPath = dir
+	cfg.VerifyOutput = false // The fake outputs aren't real video
+	pool := jobs.NewWorkerPool(queue, cfg, nil)
+	return NewCoordinator(queue, pool, cfg), queue, job
+}
+
+func TestCoordinatorCompletesUploadedResult(t *testing.T) {
+	c, queue, job := newTestCoordinator(t, "original source contents")
+
+	agent := c.Register(RegisterRequest{Name: "desktop"})
+	if _, err := c.Claim("nope"); err != ErrUnknownAgent {
+		t.Fatalf("expected ErrUnknownAgent, got %v", err)
+	}
+
+	assignment, err := c.Claim(agent.ID)
+	if err != nil || assignment == nil || assignment.Job.ID != job.ID {
+		t.Fatalf("expected to claim job %s, got %+v %v", job.ID, assignment, err)
+	}
+	if got := queue.Get(job.ID); got.Status != jobs.StatusRunning || got.Agent != "desktop" {
+		t.Fatalf("expected job running on desktop, got %s/%q", got.Status, got.Agent)
+	}
+	if next, _ := c.Claim(agent.ID); next != nil {
+		t.Fatalf("expected nothing left to claim, got %s", next.Job.ID)
+	}
+
+	other := c.Register(RegisterRequest{Name: "laptop"})
+	if _, err := c.Source(other.ID, job.ID); err != ErrLeaseLost {
+		t.Fatalf("expected ErrLeaseLost for another agent, got %v", err)
+	}
+
+	if err := c.Complete(agent.ID, job.ID, strings.NewReader("small"), 5); err != nil {
+		t.Fatalf("complete failed: %v", err)
+	}
+	got := queue.Get(job.ID)
+	if got.Status != jobs.StatusComplete {
+		t.Fatalf("expected complete, got %s (%s)", got.Status, got.Error)
+	}
+	data, err := os.ReadFile(got.OutputPath)
+	if err != nil || string(data) != "small" {
+		t.Errorf("expected uploaded output at %s, got %q %v", got.OutputPath, data, err)
+	}
+}
+
+func TestCoordinatorReleasesCancelledAndSilentJobs(t *testing.T) {
+	c, queue, job := newTestCoordinator(t, "source")
+	agent := c.Register(RegisterRequest{Name: "desktop"})
+
+	if _, err := c.Claim(agent.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Complete(agent.ID, job.ID, strings.NewReader("abc"), 10); err == nil {
+		t.Fatal("expected a truncated upload to be rejected")
+	}
+
+	// An agent that goes silent loses the job back to the queue
+	c.reap(time.Now().Add(LeaseTimeout + time.Minute))
+	if got := queue.Get(job.ID); got.Status != jobs.StatusPending || got.Agent != "" {
+		t.Fatalf("expected job requeued, got %s/%q", got.Status, got.Agent)
+	}
+
+	agent = c.Register(RegisterRequest{Name: "desktop"})
+	if _, err := c.Claim(agent.ID); err != nil {
+		t.Fatal(err)
+	}
+	queue.CancelJob(job.ID)
+	if err := c.Progress(agent.ID, job.ID, ProgressReport{Progress: 50}); err != ErrLeaseLost {
+		t.Fatalf("expected ErrLeaseLost after cancel, got %v", err)
+	}
+}
+
+func TestCoordinatorClaimsWithinSchedule(t *testing.T) {
+	c, queue, job := newTestCoordinator(t, "source")
+	agent := c.Register(RegisterRequest{Name: "desktop"})
+
+	// A window that excludes the current hour
+	hour := time.Now().Hour()
+	c.cfg.ScheduleEnabled = true
+	c.cfg.ScheduleStartHour = (hour + 1) % 24
+	c.cfg.ScheduleEndHour = (hour + 2) % 24
+	if assignment, err := c.Claim(agent.ID); err != nil || assignment != nil {
+		t.Fatalf("expected no claim outside the schedule, got %+v %v", assignment, err)
+	}
+	if got := queue.Get(job.ID); got.Status != jobs.StatusPending {
+		t.Fatalf("expected job still pending, got %s", got.Status)
+	}
+
+	c.cfg.ScheduleEndHour = (hour + 1) % 24
+	c.cfg.ScheduleStartHour = hour
+	if assignment, err := c.Claim(agent.ID); err != nil || assignment == nil {
+		t.Fatalf("expected a claim inside the schedule, got %+v %v", assignment, err)
+	}
+}
+
+func TestCoordinatorStopsClaimsOnShutdown(t *testing.T) {
+	c, queue, job := newTestCoordinator(t, "source")
+	agent := c.Register(RegisterRequest{Name: "desktop"})
+
+	// A pool without local workers, so none of them takes the job
+	cfg := *c.cfg
+	cfg.Workers = 0
+	c.pool = jobs.NewWorkerPool(queue, &cfg, nil)
+	c.pool.Shutdown(context.Background())
+	if assignment, err := c.Claim(agent.ID); err != nil || assignment != nil {
+		t.Fatalf("expected no claim during shutdown, got %+v %v", assignment, err)
+	}
+	if got := queue.Get(job.ID); got.Status != jobs.StatusPending {
+		t.Fatalf("expected job still pending, got %s", got.Status)
+	}
+}
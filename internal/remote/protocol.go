@@ -0,0 +1,73 @@
+// Package remote lets agents on other machines pull jobs from the queue,
+// transcode them with their own encoders and upload the results.
+//
+// The protocol is JSON over HTTP under /api/remote, authenticated with a
+// shared bearer token (remote.token in the server config):
+//
+//	POST /api/remote/register           RegisterRequest -> RegisterResponse
+//	POST /api/remote/claim              ClaimRequest -> Assignment, or 204 if idle
+//	GET  /api/remote/jobs/{id}/source   source file (supports Range requests)
+//	POST /api/remote/jobs/{id}/progress ProgressReport; 410 if the job was cancelled
+//	PUT  /api/remote/jobs/{id}/result   transcoded file as the request body
+//	POST /api/remote/jobs/{id}/fail     FailReport
+//
+// Every job request carries the agent ID in the X-Shrinkray-Agent header.
+// A job whose agent stops reporting for LeaseTimeout goes back to pending.
+package remote
+
+import (
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/jobs"
+)
+
+// AgentHeader carries the agent ID on job requests
+const AgentHeader = "X-Shrinkray-Agent"
+
+// LeaseTimeout is how long a claimed job survives without a progress report
+const LeaseTimeout = 5 * time.Minute
+
+// RegisterRequest announces an agent to the server
+type RegisterRequest struct {
+	Name     string   `json:"name"`
+	Version  string   `json:"version"`
+	Encoders []string `json:"encoders"` // Available ffmpeg encoders, for display
+}
+
+// RegisterResponse returns the ID the agent uses on later requests
+type RegisterResponse struct {
+	AgentID string `json:"agent_id"`
+}
+
+// ClaimRequest asks for the next job
+type ClaimRequest struct {
+	AgentID string `json:"agent_id"`
+}
+
+// Assignment is a claimed job plus the server settings that shape the encode
+type Assignment struct {
+	Job                      *jobs.Job `json:"job"`
+	SubtitleHandling         string    `json:"subtitle_handling"`
+	HDRHandling              string    `json:"hdr_handling"`
+	Container                string    `json:"container,omitempty"`
+	QualityHEVC              int       `json:"quality_hevc"`
+	QualityAV1               int       `json:"quality_av1"`
+	AutoQuality              bool      `json:"auto_quality"`
+	AutoQualityTargetSSIM    float64   `json:"auto_quality_target_ssim"`
+	AutoQualityTargetSavings int       `json:"auto_quality_target_savings"`
+}
+
+// ProgressReport is sent periodically while transcoding; it also renews the lease
+type ProgressReport struct {
+	Progress float64 `json:"progress"` // 0-100
+	Speed    float64 `json:"speed"`
+	ETA      string  `json:"eta"`
+}
+
+// FailReport describes a failed transcode
+type FailReport struct {
+	Error      string   `json:"error"`
+	Stderr     string   `json:"stderr,omitempty"`
+	ExitCode   int      `json:"exit_code,omitempty"`
+	FFmpegArgs []string `json:"ffmpeg_args,omitempty"`
+}
@@ -0,0 +1,265 @@
+// Package retention tracks the .old originals kept by original_handling:
+// keep, and deletes them once they pass the retention period or have been
+// verified by the user.
+package retention
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/logger"
+)
+
+var retentionLog = logger.For("retention")
+
+// cleanupTick is how often the scheduler looks for originals to delete
+const cleanupTick = time.Hour
+
+// ErrNotFound is returned for unknown original IDs
+var ErrNotFound = errors.New("original not found")
+
+// Original is a kept original file next to its transcoded replacement
+type Original struct {
+	ID         string     `json:"id"`
+	Path       string     `json:"path"`        // The .old file
+	OutputPath string     `json:"output_path"` // The file that replaced it
+	Size       int64      `json:"size"`
+	KeptAt     time.Time  `json:"kept_at"`
+	VerifiedAt *time.Time `json:"verified_at,omitempty"` // Set once the user has checked the output
+}
+
+// Summary is the total space held by kept originals
+type Summary struct {
+	Count       int   `json:"count"`
+	Reclaimable int64 `json:"reclaimable"`
+}
+
+// Store persists the list of kept originals
+type Store struct {
+	mu        sync.Mutex
+	originals map[string]*Original // By ID
+	filePath  string
+}
+
+// NewStore loads the store from filePath, or starts empty if it doesn't exist
+func NewStore(filePath string) (*Store, error) {
+	s := &Store{
+		originals: make(map[string]*Original),
+		filePath:  filePath,
+	}
+
+	data, err := os.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var originals []*Original
+	if err := json.Unmarshal(data, &originals); err != nil {
+		return nil, err
+	}
+	for _, o := range originals {
+		s.originals[o.ID] = o
+	}
+	return s, nil
+}
+
+// originalID derives a stable ID from the .old path
+func originalID(path string) string {
+	sum := sha1.Sum([]byte(path))
+	return hex.EncodeToString(sum[:6])
+}
+
+// Track records inputPath's .old sibling, if there is one, as kept at keptAt.
+// Tracking an already-known original only refreshes its size.
+func (s *Store) Track(inputPath, outputPath string, keptAt time.Time) {
+	oldPath := inputPath + ".old"
+	info, err := os.Stat(oldPath)
+	if err != nil || info.IsDir() {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := originalID(oldPath)
+	if o, ok := s.originals[id]; ok {
+		o.Size = info.Size()
+	} else {
+		s.originals[id] = &Original{
+			ID:         id,
+			Path:       oldPath,
+			OutputPath: outputPath,
+			Size:       info.Size(),
+			KeptAt:     keptAt,
+		}
+	}
+	s.save()
+}
+
+// List returns kept originals, oldest first, dropping any that were
+// removed outside shrinkray
+func (s *Store) List() []*Original {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.prune()
+	result := make([]*Original, 0, len(s.originals))
+	for _, o := range s.originals {
+		copied := *o
+		result = append(result, &copied)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].KeptAt.Before(result[j].KeptAt)
+	})
+	return result
+}
+
+// Summary returns how many originals are kept and their combined size
+func (s *Store) Summary() Summary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var summary Summary
+	for _, o := range s.originals {
+		summary.Count++
+		summary.Reclaimable += o.Size
+	}
+	return summary
+}
+
+// Verify marks an original as checked; it is deleted at the next cleanup
+func (s *Store) Verify(id string) (*Original, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.originals[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if o.VerifiedAt == nil {
+		now := time.Now()
+		o.VerifiedAt = &now
+		s.save()
+	}
+	copied := *o
+	return &copied, nil
+}
+
+// Delete removes an original from disk and stops tracking it
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.originals[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if err := os.Remove(o.Path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	delete(s.originals, id)
+	s.save()
+	return nil
+}
+
+// Cleanup deletes verified originals and, when retention is positive,
+// originals kept longer than retention. Returns the bytes freed.
+func (s *Store) Cleanup(retention time.Duration) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.prune()
+	var freed int64
+	deleted := false
+	for id, o := range s.originals {
+		expired := retention > 0 && time.Since(o.KeptAt) >= retention
+		if o.VerifiedAt == nil && !expired {
+			continue
+		}
+		if err := os.Remove(o.Path); err != nil && !os.IsNotExist(err) {
+			retentionLog.Warn("Failed to delete kept original", "path", o.Path, "error", err)
+			continue
+		}
+		retentionLog.Info("Deleted kept original", "path", o.Path)
+		freed += o.Size
+		delete(s.originals, id)
+		deleted = true
+	}
+	if deleted {
+		s.save()
+	}
+	return freed
+}
+
+// StartScheduler runs Cleanup every hour. retention is re-read each time so
+// config changes apply without a restart.
+func (s *Store) StartScheduler(ctx context.Context, retention func() time.Duration) {
+	go func() {
+		ticker := time.NewTicker(cleanupTick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			s.Cleanup(retention())
+		}
+	}()
+}
+
+// prune forgets originals whose file no longer exists. Must hold s.mu.
+func (s *Store) prune() {
+	changed := false
+	for id, o := range s.originals {
+		if _, err := os.Stat(o.Path); os.IsNotExist(err) {
+			delete(s.originals, id)
+			changed = true
+		}
+	}
+	if changed {
+		s.save()
+	}
+}
+
+// save writes the store to disk. Must hold s.mu.
+func (s *Store) save() {
+	originals := make([]*Original, 0, len(s.originals))
+	for _, o := range s.originals {
+		originals = append(originals, o)
+	}
+	sort.Slice(originals, func(i, j int) bool {
+		return originals[i].KeptAt.Before(originals[j].KeptAt)
+	})
+
+	data, err := json.MarshalIndent(originals, "", "  ")
+	if err != nil {
+		retentionLog.Warn("Failed to encode originals", "error", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(s.filePath), 0755); err != nil {
+		retentionLog.Warn("Failed to save originals", "error", err)
+		return
+	}
+
+	// Write to temp file first, then rename (atomic)
+	tmpPath := s.filePath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		retentionLog.Warn("Failed to save originals", "error", err)
+		return
+	}
+	if err := os.Rename(tmpPath, s.filePath); err != nil {
+		retentionLog.Warn("Failed to save originals", "error", err)
+	}
+}
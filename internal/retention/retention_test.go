@@ -0,0 +1,87 @@
+package retention
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStoreTracksAndCleansUpOriginals(t *testing.T) {
+	dir := t.TempDir()
+	storePath := filepath.Join(dir, "config", "originals.json")
+
+	oldMovie := filepath.Join(dir, "old.mkv")
+	newMovie := filepath.Join(dir, "new.mkv")
+	for _, path := range []string{oldMovie + ".old", newMovie + ".old"} {
+		if err := os.WriteFile(path, make([]byte, 100), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store, err := NewStore(storePath)
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	store.Track(oldMovie, oldMovie, time.Now().Add(-10*24*time.Hour))
+	store.Track(newMovie, newMovie, time.Now())
+	store.Track(filepath.Join(dir, "replaced.mkv"), "", time.Now()) // No .old: ignored
+
+	if summary := store.Summary(); summary.Count != 2 || summary.Reclaimable != 200 {
+		t.Fatalf("summary = %+v, want 2 originals / 200 bytes", summary)
+	}
+
+	// Reloading keeps the list
+	store, err = NewStore(storePath)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	originals := store.List()
+	if len(originals) != 2 || originals[0].Path != oldMovie+".old" {
+		t.Fatalf("List() = %+v, want old.mkv.old first", originals)
+	}
+
+	// Retention off: nothing expires
+	if freed := store.Cleanup(0); freed != 0 {
+		t.Errorf("Cleanup(0) freed %d bytes, want 0", freed)
+	}
+
+	// A week's retention removes only the 10-day-old original
+	if freed := store.Cleanup(7 * 24 * time.Hour); freed != 100 {
+		t.Errorf("Cleanup(7d) freed %d bytes, want 100", freed)
+	}
+	if _, err := os.Stat(oldMovie + ".old"); !os.IsNotExist(err) {
+		t.Errorf("expired original still on disk")
+	}
+
+	// Verified originals go at the next cleanup regardless of age
+	if _, err := store.Verify(originals[1].ID); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	store.Cleanup(0)
+	if summary := store.Summary(); summary.Count != 0 {
+		t.Errorf("summary after cleanup = %+v, want empty", summary)
+	}
+	if _, err := store.Verify(originals[1].ID); err != ErrNotFound {
+		t.Errorf("Verify(deleted) error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestStoreForgetsOriginalsRemovedElsewhere(t *testing.T) {
+	dir := t.TempDir()
+	movie := filepath.Join(dir, "movie.mkv")
+	if err := os.WriteFile(movie+".old", []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewStore(filepath.Join(dir, "originals.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Track(movie, movie, time.Now())
+	os.Remove(movie + ".old")
+
+	if originals := store.List(); len(originals) != 0 {
+		t.Errorf("List() = %+v, want manually deleted original dropped", originals)
+	}
+}
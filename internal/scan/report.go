@@ -0,0 +1,209 @@
+package scan
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/ffmpeg"
+)
+
+// Bucket counts files and bytes falling into one category of a distribution
+type Bucket struct {
+	Label string `json:"label"`
+	Files int    `json:"files"`
+	Size  int64  `json:"size"`
+}
+
+// CodecSavings is the estimated savings from converting every file of one
+// source codec with the report's preset.
+type CodecSavings struct {
+	Codec    string                `json:"codec"`
+	Estimate *ffmpeg.BatchEstimate `json:"estimate"`
+}
+
+// Report is the result of a full library scan
+type Report struct {
+	ID          string    `json:"id"`
+	Root        string    `json:"root"`
+	PresetID    string    `json:"preset_id"`
+	StartedAt   time.Time `json:"started_at"`
+	CompletedAt time.Time `json:"completed_at"`
+
+	Files     int   `json:"files"`      // Video files probed successfully
+	Failed    int   `json:"failed"`     // Video files that could not be probed
+	TotalSize int64 `json:"total_size"` // Combined size of probed files
+
+	Codecs      []Bucket `json:"codecs"`      // By source video codec, largest first
+	Resolutions []Bucket `json:"resolutions"` // 2160p, 1080p, 720p, SD
+	Bitrates    []Bucket `json:"bitrates"`    // Overall bitrate ranges
+
+	Savings     *ffmpeg.BatchEstimate `json:"savings"`     // Whole library
+	Reclaimable []CodecSavings        `json:"reclaimable"` // Per source codec, most savings first
+	Summary     string                `json:"summary"`     // e.g. "1.2 TB reclaimable by converting 843 H.264 files"
+}
+
+// ReportInfo is the listing entry for a saved report
+type ReportInfo struct {
+	ID          string    `json:"id"`
+	PresetID    string    `json:"preset_id"`
+	CompletedAt time.Time `json:"completed_at"`
+	Files       int       `json:"files"`
+	Summary     string    `json:"summary"`
+}
+
+func (r *Report) info() ReportInfo {
+	return ReportInfo{ID: r.ID, PresetID: r.PresetID, CompletedAt: r.CompletedAt, Files: r.Files, Summary: r.Summary}
+}
+
+// resolutionBuckets are matched top-down against the video height
+var resolutionBuckets = []struct {
+	label     string
+	minHeight int
+}{
+	{"2160p", 1800},
+	{"1440p", 1300},
+	{"1080p", 900},
+	{"720p", 600},
+	{"SD", 0},
+}
+
+// bitrateBuckets are matched top-down against the overall bitrate
+var bitrateBuckets = []struct {
+	label string
+	min   int64
+}{
+	{"> 20 Mbps", 20_000_000},
+	{"10-20 Mbps", 10_000_000},
+	{"5-10 Mbps", 5_000_000},
+	{"2-5 Mbps", 2_000_000},
+	{"< 2 Mbps", 0},
+}
+
+// codecNames are display names for common source codecs
+var codecNames = map[string]string{
+	"h264":       "H.264",
+	"hevc":       "HEVC",
+	"av1":        "AV1",
+	"mpeg2video": "MPEG-2",
+	"mpeg4":      "MPEG-4",
+	"vc1":        "VC-1",
+	"vp9":        "VP9",
+}
+
+func codecName(codec string) string {
+	if name, ok := codecNames[codec]; ok {
+		return name
+	}
+	if codec == "" {
+		return "unknown"
+	}
+	return strings.ToUpper(codec)
+}
+
+// buildReport aggregates probes into distributions and savings for preset
+func buildReport(probes []*ffmpeg.ProbeResult, failed int, preset *ffmpeg.Preset) *Report {
+	report := &Report{Failed: failed}
+	if preset != nil {
+		report.PresetID = preset.ID
+	}
+
+	codecs := make(map[string]*Bucket)
+	byCodec := make(map[string][]*ffmpeg.ProbeResult)
+	resolutions := make([]Bucket, len(resolutionBuckets))
+	for i, b := range resolutionBuckets {
+		resolutions[i].Label = b.label
+	}
+	bitrates := make([]Bucket, len(bitrateBuckets))
+	for i, b := range bitrateBuckets {
+		bitrates[i].Label = b.label
+	}
+
+	for _, probe := range probes {
+		if probe == nil {
+			continue
+		}
+		report.Files++
+		report.TotalSize += probe.Size
+
+		name := codecName(probe.VideoCodec)
+		bucket, ok := codecs[name]
+		if !ok {
+			bucket = &Bucket{Label: name}
+			codecs[name] = bucket
+		}
+		bucket.Files++
+		bucket.Size += probe.Size
+		byCodec[name] = append(byCodec[name], probe)
+
+		for i, b := range resolutionBuckets {
+			if probe.Height >= b.minHeight {
+				resolutions[i].Files++
+				resolutions[i].Size += probe.Size
+				break
+			}
+		}
+
+		bitrate := probe.OverallBitrate()
+		for i, b := range bitrateBuckets {
+			if bitrate >= b.min {
+				bitrates[i].Files++
+				bitrates[i].Size += probe.Size
+				break
+			}
+		}
+	}
+
+	for _, bucket := range codecs {
+		report.Codecs = append(report.Codecs, *bucket)
+	}
+	sort.Slice(report.Codecs, func(i, j int) bool {
+		if report.Codecs[i].Size != report.Codecs[j].Size {
+			return report.Codecs[i].Size > report.Codecs[j].Size
+		}
+		return report.Codecs[i].Label < report.Codecs[j].Label
+	})
+	report.Resolutions = resolutions
+	report.Bitrates = bitrates
+
+	report.Savings = ffmpeg.EstimateMultiple(probes, preset)
+	for name, group := range byCodec {
+		est := ffmpeg.EstimateMultiple(group, preset)
+		if est.Estimated == 0 {
+			continue
+		}
+		report.Reclaimable = append(report.Reclaimable, CodecSavings{Codec: name, Estimate: est})
+	}
+	sort.Slice(report.Reclaimable, func(i, j int) bool {
+		a, b := report.Reclaimable[i].Estimate, report.Reclaimable[j].Estimate
+		if midSavings(a) != midSavings(b) {
+			return midSavings(a) > midSavings(b)
+		}
+		return report.Reclaimable[i].Codec < report.Reclaimable[j].Codec
+	})
+	report.Summary = summarize(report)
+	return report
+}
+
+// midSavings is the midpoint of an estimate's savings range
+func midSavings(est *ffmpeg.BatchEstimate) int64 {
+	return (est.SavingsMin + est.SavingsMax) / 2
+}
+
+// summarize describes the biggest savings opportunity in one sentence
+func summarize(report *Report) string {
+	if report.Files == 0 {
+		return "No video files found"
+	}
+	if len(report.Reclaimable) == 0 || midSavings(report.Reclaimable[0].Estimate) <= 0 {
+		return fmt.Sprintf("Nothing to reclaim across %d files", report.Files)
+	}
+	top := report.Reclaimable[0]
+	summary := fmt.Sprintf("%s reclaimable by converting %d %s files",
+		ffmpeg.FormatBytes(midSavings(top.Estimate)), top.Estimate.Estimated, top.Codec)
+	if rest := midSavings(report.Savings) - midSavings(top.Estimate); len(report.Reclaimable) > 1 && rest > 0 {
+		summary += fmt.Sprintf(" (%s more from other codecs)", ffmpeg.FormatBytes(rest))
+	}
+	return summary
+}
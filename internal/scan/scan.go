@@ -0,0 +1,323 @@
+// Package scan walks the whole media library, records codec, resolution and
+// bitrate distributions, and saves savings reports.
+package scan
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/browse"
+	"github.com/gwlsn/shrinkray/internal/ffmpeg"
+	"github.com/gwlsn/shrinkray/internal/logger"
+)
+
+var scanLog = logger.For("scan")
+
+const (
+	// maxReports is how many saved reports are kept on disk
+	maxReports = 20
+
+	// probeBatchSize bounds concurrent probes so a full-library scan
+	// doesn't start thousands of ffprobe processes at once
+	probeBatchSize = 8
+
+	// schedulerTick is how often the scheduler checks whether a scan is due
+	schedulerTick = time.Minute
+)
+
+var (
+	// ErrScanRunning is returned by Start while a scan is in progress
+	ErrScanRunning = errors.New("scan already running")
+	// ErrReportNotFound is returned for unknown report IDs
+	ErrReportNotFound = errors.New("report not found")
+)
+
+// Prober probes video files; *browse.Browser satisfies it (and caches results).
+type Prober interface {
+	MediaRoot() string
+	GetVideoFiles(ctx context.Context, paths []string) ([]*ffmpeg.ProbeResult, error)
+}
+
+// Status is the progress of the current or most recent scan
+type Status struct {
+	Running      bool      `json:"running"`
+	Phase        string    `json:"phase,omitempty"` // "discovering" or "probing" while running
+	Processed    int       `json:"processed"`
+	Total        int       `json:"total"`
+	StartedAt    time.Time `json:"started_at,omitempty"`
+	Error        string    `json:"error,omitempty"` // Why the last scan failed
+	LastReportID string    `json:"last_report_id,omitempty"`
+}
+
+// Scanner runs library scans one at a time and saves their reports
+type Scanner struct {
+	prober    Prober
+	reportDir string
+
+	mu      sync.Mutex
+	status  Status
+	cancel  context.CancelFunc
+	reports []ReportInfo // Newest first
+}
+
+// NewScanner creates a scanner that saves reports as JSON under reportDir.
+// Existing reports in reportDir are loaded so history survives restarts.
+func NewScanner(prober Prober, reportDir string) *Scanner {
+	s := &Scanner{prober: prober, reportDir: reportDir}
+	s.loadReports()
+	if len(s.reports) > 0 {
+		s.status.LastReportID = s.reports[0].ID
+	}
+	return s
+}
+
+// Start begins a scan of the whole media root in the background, estimating
+// savings with preset. Returns ErrScanRunning if a scan is in progress.
+func (s *Scanner) Start(preset *ffmpeg.Preset) error {
+	if preset == nil {
+		return errors.New("preset is required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.status.Running {
+		return ErrScanRunning
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.status = Status{
+		Running:      true,
+		Phase:        "discovering",
+		StartedAt:    time.Now(),
+		LastReportID: s.status.LastReportID,
+	}
+
+	go s.run(ctx, preset)
+	return nil
+}
+
+// Cancel stops the running scan, if any
+func (s *Scanner) Cancel() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		s.cancel()
+	}
+}
+
+// Status returns the progress of the current or most recent scan
+func (s *Scanner) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+// Reports lists saved reports, newest first
+func (s *Scanner) Reports() []ReportInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]ReportInfo{}, s.reports...)
+}
+
+// Report loads a saved report. An empty id returns the latest report.
+func (s *Scanner) Report(id string) (*Report, error) {
+	s.mu.Lock()
+	if id == "" {
+		if len(s.reports) == 0 {
+			s.mu.Unlock()
+			return nil, ErrReportNotFound
+		}
+		id = s.reports[0].ID
+	}
+	known := false
+	for _, info := range s.reports {
+		if info.ID == id {
+			known = true
+			break
+		}
+	}
+	s.mu.Unlock()
+
+	// Only serve IDs we wrote, so the id can't be used to read other files
+	if !known {
+		return nil, ErrReportNotFound
+	}
+
+	data, err := os.ReadFile(s.reportPath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrReportNotFound
+		}
+		return nil, err
+	}
+	var report Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// StartScheduler runs a scan whenever interval() has passed since the last
+// completed one. interval is re-read every tick so config changes apply
+// without a restart; a zero interval disables scheduled scans.
+func (s *Scanner) StartScheduler(ctx context.Context, interval func() time.Duration, preset func() *ffmpeg.Preset) {
+	go func() {
+		ticker := time.NewTicker(schedulerTick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				s.Cancel()
+				return
+			case <-ticker.C:
+			}
+
+			every := interval()
+			if every <= 0 {
+				continue
+			}
+			var last time.Time
+			if reports := s.Reports(); len(reports) > 0 {
+				last = reports[0].CompletedAt
+			}
+			if time.Since(last) < every {
+				continue
+			}
+			if err := s.Start(preset()); err == nil {
+				scanLog.Info("Starting scheduled library scan")
+			}
+		}
+	}()
+}
+
+// run performs one scan and saves its report
+func (s *Scanner) run(ctx context.Context, preset *ffmpeg.Preset) {
+	root := s.prober.MediaRoot()
+	started := s.Status().StartedAt
+
+	report, err := s.scan(ctx, root, preset)
+	if err == nil {
+		report.ID = started.UTC().Format("20060102-150405.000")
+		report.Root = root
+		report.StartedAt = started
+		report.CompletedAt = time.Now()
+		err = s.saveReport(report)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cancel = nil
+	s.status.Running = false
+	s.status.Phase = ""
+	if err != nil {
+		s.status.Error = err.Error()
+		scanLog.Warn("Library scan failed", "error", err)
+		return
+	}
+	s.status.LastReportID = report.ID
+	scanLog.Info("Library scan complete", "summary", report.Summary)
+}
+
+// scan discovers and probes every video under root
+func (s *Scanner) scan(ctx context.Context, root string, preset *ffmpeg.Preset) (*Report, error) {
+	paths, err := browse.DiscoverMediaFiles(root, true, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.status.Phase = "probing"
+	s.status.Total = len(paths)
+	s.mu.Unlock()
+
+	probes := make([]*ffmpeg.ProbeResult, 0, len(paths))
+	for start := 0; start < len(paths); start += probeBatchSize {
+		if err := ctx.Err(); err != nil {
+			return nil, errors.New("scan cancelled")
+		}
+		end := min(start+probeBatchSize, len(paths))
+		results, err := s.prober.GetVideoFiles(ctx, paths[start:end])
+		if err != nil {
+			return nil, err
+		}
+		probes = append(probes, results...)
+
+		s.mu.Lock()
+		s.status.Processed = end
+		s.mu.Unlock()
+	}
+
+	return buildReport(probes, len(paths)-len(probes), preset), nil
+}
+
+// saveReport writes report to disk and trims old reports
+func (s *Scanner) saveReport(report *Report) error {
+	if err := os.MkdirAll(s.reportDir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to temp file first, then rename (atomic)
+	path := s.reportPath(report.ID)
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reports = append([]ReportInfo{report.info()}, s.reports...)
+	for len(s.reports) > maxReports {
+		old := s.reports[len(s.reports)-1]
+		s.reports = s.reports[:len(s.reports)-1]
+		if err := os.Remove(s.reportPath(old.ID)); err != nil && !os.IsNotExist(err) {
+			scanLog.Warn("Failed to remove old report", "report", old.ID, "error", err)
+		}
+	}
+	return nil
+}
+
+// loadReports indexes the reports already saved in reportDir
+func (s *Scanner) loadReports() {
+	entries, err := os.ReadDir(s.reportDir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.reportDir, name))
+		if err != nil {
+			continue
+		}
+		var report Report
+		if err := json.Unmarshal(data, &report); err != nil || report.ID+".json" != name {
+			continue
+		}
+		s.reports = append(s.reports, report.info())
+	}
+	sort.Slice(s.reports, func(i, j int) bool {
+		return s.reports[i].CompletedAt.After(s.reports[j].CompletedAt)
+	})
+}
+
+func (s *Scanner) reportPath(id string) string {
+	return filepath.Join(s.reportDir, fmt.Sprintf("%s.json", id))
+}
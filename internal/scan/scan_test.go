@@ -0,0 +1,116 @@
+package scan
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/ffmpeg"
+)
+
+// fakeProber returns a canned probe for every path
+type fakeProber struct {
+	root  string
+	probe func(path string) *ffmpeg.ProbeResult
+}
+
+func (f *fakeProber) MediaRoot() string { return f.root }
+
+func (f *fakeProber) GetVideoFiles(_ context.Context, paths []string) ([]*ffmpeg.ProbeResult, error) {
+	var results []*ffmpeg.ProbeResult
+	for _, p := range paths {
+		if r := f.probe(p); r != nil {
+			results = append(results, r)
+		}
+	}
+	return results, nil
+}
+
+func TestBuildReport(t *testing.T) {
+	const gb = 1 << 30
+	probes := []*ffmpeg.ProbeResult{
+		{VideoCodec: "h264", Height: 1080, Size: 4 * gb, Duration: time.Hour, Bitrate: 9_000_000},
+		{VideoCodec: "h264", Height: 2160, Size: 20 * gb, Duration: 2 * time.Hour, Bitrate: 22_000_000},
+		{VideoCodec: "hevc", Height: 1080, Size: 2 * gb, Duration: time.Hour, Bitrate: 4_000_000, IsHEVC: true},
+	}
+	preset := &ffmpeg.Preset{ID: "compress-hevc", Codec: ffmpeg.CodecHEVC}
+
+	report := buildReport(probes, 1, preset)
+	if report.Files != 3 || report.Failed != 1 || report.TotalSize != 26*gb {
+		t.Fatalf("unexpected totals: %+v", report)
+	}
+	if report.Codecs[0].Label != "H.264" || report.Codecs[0].Files != 2 {
+		t.Errorf("expected H.264 as the largest codec bucket, got %+v", report.Codecs)
+	}
+
+	counts := map[string]int{}
+	for _, b := range report.Resolutions {
+		counts[b.Label] = b.Files
+	}
+	if counts["2160p"] != 1 || counts["1080p"] != 2 {
+		t.Errorf("unexpected resolution buckets: %+v", report.Resolutions)
+	}
+
+	// HEVC sources are skipped for an HEVC preset, so only H.264 is reclaimable
+	if len(report.Reclaimable) != 1 || report.Reclaimable[0].Codec != "H.264" {
+		t.Fatalf("expected only H.264 to be reclaimable, got %+v", report.Reclaimable)
+	}
+	if report.Savings.Skipped != 1 {
+		t.Errorf("expected 1 skipped file, got %d", report.Savings.Skipped)
+	}
+	if !strings.Contains(report.Summary, "reclaimable by converting 2 H.264 files") {
+		t.Errorf("unexpected summary: %q", report.Summary)
+	}
+}
+
+func TestScannerSavesReports(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a.mkv", "b.mp4", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	prober := &fakeProber{root: root, probe: func(path string) *ffmpeg.ProbeResult {
+		return &ffmpeg.ProbeResult{Path: path, VideoCodec: "h264", Height: 1080, Size: 1 << 30, Duration: time.Hour}
+	}}
+
+	reportDir := filepath.Join(t.TempDir(), "scans")
+	scanner := NewScanner(prober, reportDir)
+	if _, err := scanner.Report(""); err != ErrReportNotFound {
+		t.Fatalf("expected ErrReportNotFound before any scan, got %v", err)
+	}
+
+	preset := &ffmpeg.Preset{ID: "compress-hevc", Codec: ffmpeg.CodecHEVC}
+	if err := scanner.Start(preset); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for scanner.Status().Running {
+		if time.Now().After(deadline) {
+			t.Fatal("scan did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	status := scanner.Status()
+	if status.Error != "" || status.Total != 2 || status.Processed != 2 {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+
+	// A new scanner picks up the saved report
+	reloaded := NewScanner(prober, reportDir)
+	report, err := reloaded.Report(status.LastReportID)
+	if err != nil {
+		t.Fatalf("report not found after reload: %v", err)
+	}
+	if report.Files != 2 || report.PresetID != "compress-hevc" {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if _, err := reloaded.Report("../../etc/passwd"); err != ErrReportNotFound {
+		t.Errorf("expected unknown id to be rejected, got %v", err)
+	}
+}
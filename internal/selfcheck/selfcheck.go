@@ -0,0 +1,323 @@
+// Package selfcheck verifies the runtime environment (ffmpeg, paths, disk
+// space, encoders, auth) so misconfigured deployments are easy to diagnose.
+package selfcheck
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/config"
+	"github.com/gwlsn/shrinkray/internal/diskspace"
+	"github.com/gwlsn/shrinkray/internal/ffmpeg"
+	"github.com/gwlsn/shrinkray/internal/logger"
+)
+
+var selfcheckLog = logger.For("selfcheck")
+
+// Status is the outcome of a check
+type Status string
+
+const (
+	StatusOK   Status = "ok"
+	StatusWarn Status = "warn"
+	StatusFail Status = "fail"
+)
+
+// severity orders statuses so the report can take the worst
+var severity = map[Status]int{StatusOK: 0, StatusWarn: 1, StatusFail: 2}
+
+// commandTimeout bounds each "-version" probe of ffmpeg/ffprobe
+const commandTimeout = 10 * time.Second
+
+// Check is the result of one self-check
+type Check struct {
+	Name    string `json:"name"`
+	Status  Status `json:"status"`
+	Message string `json:"message"`
+	Hint    string `json:"hint,omitempty"` // How to fix a warn/fail
+}
+
+// Report is the result of a full self-check
+type Report struct {
+	Status    Status    `json:"status"` // Worst status of all checks
+	CheckedAt time.Time `json:"checked_at"`
+	Checks    []Check   `json:"checks"`
+}
+
+// Run performs every check against cfg. Encoder detection must already
+// have run (ffmpeg.DetectEncoders) for the encoder summary to be useful.
+func Run(ctx context.Context, cfg *config.Config) *Report {
+	return newReport(
+		checkBinary(ctx, "ffmpeg", cfg.FFmpegPath),
+		checkBinary(ctx, "ffprobe", cfg.FFprobePath),
+		checkMediaPath(cfg),
+		checkTempSpace(cfg),
+		checkQueueFile(cfg.QueueFile),
+		checkEncoders(ffmpeg.ListAvailableEncoders()),
+		checkAuth(cfg.Auth),
+	)
+}
+
+// Ready performs the checks a readiness probe needs: ffmpeg and ffprobe
+// run, the media root is reachable, the temp directory and queue file are
+// writable, and encoder detection has finished. Unlike Run it skips auth,
+// and doesn't wait on encoder detection.
+func Ready(ctx context.Context, cfg *config.Config) *Report {
+	encoders := Check{
+		Name:    "encoders",
+		Status:  StatusFail,
+		Message: "encoder detection has not finished",
+	}
+	if ffmpeg.EncodersDetected() {
+		encoders = checkEncoders(ffmpeg.ListAvailableEncoders())
+	}
+	return newReport(
+		checkBinary(ctx, "ffmpeg", cfg.FFmpegPath),
+		checkBinary(ctx, "ffprobe", cfg.FFprobePath),
+		checkMediaPath(cfg),
+		checkTempSpace(cfg),
+		checkQueueFile(cfg.QueueFile),
+		encoders,
+	)
+}
+
+// newReport collects checks into a report with the worst of their statuses
+func newReport(checks ...Check) *Report {
+	report := &Report{Status: StatusOK, CheckedAt: time.Now(), Checks: checks}
+	for _, c := range checks {
+		if severity[c.Status] > severity[report.Status] {
+			report.Status = c.Status
+		}
+	}
+	return report
+}
+
+// Log writes one line per check, with the fix hint for anything not ok
+func (r *Report) Log() {
+	selfcheckLog.Info("Self-check complete", "status", r.Status)
+	for _, c := range r.Checks {
+		attrs := []any{"check", c.Name, "status", c.Status, "message", c.Message}
+		if c.Hint != "" {
+			attrs = append(attrs, "hint", c.Hint)
+		}
+		if c.Status == StatusOK {
+			selfcheckLog.Info("Self-check", attrs...)
+		} else {
+			selfcheckLog.Warn("Self-check", attrs...)
+		}
+	}
+}
+
+// checkBinary runs "<path> -version" and reports the version line
+func checkBinary(ctx context.Context, name, path string) Check {
+	check := Check{Name: name}
+	ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, path, "-version").Output()
+	if err != nil {
+		check.Status = StatusFail
+		check.Message = fmt.Sprintf("%s could not be run: %v", path, err)
+		check.Hint = fmt.Sprintf("Install %s or set %s_path in the config", name, name)
+		return check
+	}
+
+	version := strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+	check.Status = StatusOK
+	check.Message = version
+	return check
+}
+
+// checkMediaPath verifies the media root is a readable, writable directory
+// (transcoded files are written next to the originals).
+func checkMediaPath(cfg *config.Config) Check {
+	check := Check{Name: "media_path"}
+	info, err := os.Stat(cfg.MediaPath)
+	if err != nil || !info.IsDir() {
+		check.Status = StatusFail
+		check.Message = fmt.Sprintf("%s is not a directory", cfg.MediaPath)
+		check.Hint = "Mount your library at the media path (e.g. -v /path/to/media:/media)"
+		return check
+	}
+	if _, err := os.ReadDir(cfg.MediaPath); err != nil {
+		check.Status = StatusFail
+		check.Message = fmt.Sprintf("%s is not readable: %v", cfg.MediaPath, err)
+		check.Hint = "Check PUID/PGID match the owner of your media files"
+		return check
+	}
+	if err := probeWritable(cfg.MediaPath); err != nil {
+		check.Status = StatusFail
+		check.Message = fmt.Sprintf("%s is not writable: %v", cfg.MediaPath, err)
+		check.Hint = "Transcoded files are written next to the originals; check PUID/PGID and that the mount isn't read-only"
+		return check
+	}
+	check.Status = StatusOK
+	check.Message = fmt.Sprintf("%s is readable and writable", cfg.MediaPath)
+	return check
+}
+
+// checkTempSpace verifies the temp directory is writable and has at least
+// min_free_space_mb available.
+func checkTempSpace(cfg *config.Config) Check {
+	check := Check{Name: "temp_space"}
+	dir := cfg.TempPath
+	if dir == "" {
+		dir = cfg.MediaPath
+	} else if err := probeWritable(dir); err != nil {
+		check.Status = StatusFail
+		check.Message = fmt.Sprintf("temp path %s is not writable: %v", dir, err)
+		check.Hint = "Create the temp directory and make sure it is writable, or clear temp_path"
+		return check
+	}
+
+	free, err := diskspace.Free(dir)
+	if err != nil {
+		check.Status = StatusWarn
+		check.Message = fmt.Sprintf("could not read free space for %s: %v", dir, err)
+		return check
+	}
+
+	minFree := uint64(cfg.MinFreeSpaceMB) * 1024 * 1024
+	freeMB := free / (1024 * 1024)
+	if minFree > 0 && free < minFree {
+		check.Status = StatusWarn
+		check.Message = fmt.Sprintf("%d MB free in %s, below min_free_space_mb (%d MB); jobs will wait", freeMB, dir, cfg.MinFreeSpaceMB)
+		check.Hint = "Free up space or point temp_path at a larger disk"
+		return check
+	}
+	check.Status = StatusOK
+	check.Message = fmt.Sprintf("%d MB free in %s", freeMB, dir)
+	return check
+}
+
+// checkQueueFile verifies the queue can be persisted
+func checkQueueFile(path string) Check {
+	check := Check{Name: "queue_file"}
+	if path == "" {
+		check.Status = StatusWarn
+		check.Message = "no queue file configured; the queue will not survive restarts"
+		return check
+	}
+	if err := probeWritable(filepath.Dir(path)); err != nil {
+		check.Status = StatusFail
+		check.Message = fmt.Sprintf("%s is not writable: %v", filepath.Dir(path), err)
+		check.Hint = "Mount a writable config directory (e.g. -v /path/to/config:/config)"
+		return check
+	}
+	if f, err := os.OpenFile(path, os.O_WRONLY, 0); err == nil {
+		f.Close()
+	} else if !os.IsNotExist(err) {
+		check.Status = StatusFail
+		check.Message = fmt.Sprintf("%s is not writable: %v", path, err)
+		check.Hint = "Fix the ownership of the queue file"
+		return check
+	}
+	check.Status = StatusOK
+	check.Message = fmt.Sprintf("%s is writable", path)
+	return check
+}
+
+// checkEncoders summarizes detected encoders, warning when only software is available
+func checkEncoders(encoders []*ffmpeg.HWEncoder) Check {
+	check := Check{Name: "encoders"}
+	var names []string
+	hardware := false
+	for _, enc := range encoders {
+		if !enc.Available {
+			continue
+		}
+		names = append(names, enc.Encoder)
+		if enc.Accel != ffmpeg.HWAccelNone {
+			hardware = true
+		}
+	}
+	if len(names) == 0 {
+		check.Status = StatusFail
+		check.Message = "no usable encoders detected"
+		check.Hint = "Check that ffmpeg was built with libx265/libsvtav1"
+		return check
+	}
+	check.Message = strings.Join(names, ", ")
+	if !hardware {
+		check.Status = StatusWarn
+		check.Message = "software only: " + check.Message
+		check.Hint = "Pass through your GPU (e.g. --device /dev/dri:/dev/dri or --gpus all) for hardware encoding"
+		return check
+	}
+	check.Status = StatusOK
+	return check
+}
+
+// checkAuth verifies the selected auth provider has what it needs
+func checkAuth(cfg config.AuthConfig) Check {
+	check := Check{Name: "auth"}
+	if !cfg.Enabled {
+		check.Status = StatusOK
+		check.Message = "disabled"
+		return check
+	}
+
+	var missing []string
+	if cfg.Secret == "" && cfg.Provider != "header" {
+		missing = append(missing, "secret")
+	}
+	switch cfg.Provider {
+	case "password":
+		if len(cfg.Password.Users) == 0 {
+			missing = append(missing, "password.users")
+		}
+	case "oidc":
+		if cfg.OIDC.Issuer == "" {
+			missing = append(missing, "oidc.issuer")
+		}
+		if cfg.OIDC.ClientID == "" {
+			missing = append(missing, "oidc.client_id")
+		}
+		if cfg.OIDC.ClientSecret == "" {
+			missing = append(missing, "oidc.client_secret")
+		}
+		if cfg.OIDC.RedirectURL == "" {
+			missing = append(missing, "oidc.redirect_url")
+		}
+	case "header":
+		if len(cfg.Header.TrustedProxies) == 0 {
+			missing = append(missing, "header.trusted_proxies")
+		}
+	case "", "noop":
+		check.Status = StatusWarn
+		check.Message = "enabled with the noop provider; every request is allowed"
+		check.Hint = "Set auth.provider to password, oidc or header"
+		return check
+	default:
+		check.Status = StatusFail
+		check.Message = fmt.Sprintf("unknown provider %q", cfg.Provider)
+		check.Hint = "Set auth.provider to password, oidc or header"
+		return check
+	}
+
+	if len(missing) > 0 {
+		check.Status = StatusFail
+		check.Message = fmt.Sprintf("%s provider is missing %s", cfg.Provider, strings.Join(missing, ", "))
+		check.Hint = "See the Authentication section of the README"
+		return check
+	}
+	check.Status = StatusOK
+	check.Message = fmt.Sprintf("enabled (%s)", cfg.Provider)
+	return check
+}
+
+// probeWritable creates and removes a file in dir
+func probeWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".shrinkray-selfcheck-*")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	f.Close()
+	return os.Remove(name)
+}
@@ -0,0 +1,115 @@
+package selfcheck
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gwlsn/shrinkray/internal/config"
+	"github.com/gwlsn/shrinkray/internal/ffmpeg"
+)
+
+func TestCheckBinaryMissing(t *testing.T) {
+	check := checkBinary(context.Background(), "ffmpeg", "/nonexistent/ffmpeg")
+	if check.Status != StatusFail || check.Hint == "" {
+		t.Errorf("expected fail with hint, got %+v", check)
+	}
+}
+
+func TestCheckQueueFile(t *testing.T) {
+	dir := t.TempDir()
+	if check := checkQueueFile(filepath.Join(dir, "queue.json")); check.Status != StatusOK {
+		t.Errorf("expected ok for missing file in writable dir, got %+v", check)
+	}
+	if check := checkQueueFile(""); check.Status != StatusWarn {
+		t.Errorf("expected warn without a queue file, got %+v", check)
+	}
+	if check := checkQueueFile(filepath.Join(dir, "missing", "queue.json")); check.Status != StatusFail {
+		t.Errorf("expected fail for missing directory, got %+v", check)
+	}
+}
+
+func TestCheckMediaPath(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.MediaPath = t.TempDir()
+	if check := checkMediaPath(cfg); check.Status != StatusOK {
+		t.Errorf("expected ok, got %+v", check)
+	}
+
+	// No stray probe files left behind
+	entries, _ := os.ReadDir(cfg.MediaPath)
+	if len(entries) != 0 {
+		t.Errorf("expected empty media dir, found %d entries", len(entries))
+	}
+
+	cfg.MediaPath = filepath.Join(cfg.MediaPath, "missing")
+	if check := checkMediaPath(cfg); check.Status != StatusFail {
+		t.Errorf("expected fail for missing media path, got %+v", check)
+	}
+}
+
+func TestCheckEncoders(t *testing.T) {
+	software := []*ffmpeg.HWEncoder{{Accel: ffmpeg.HWAccelNone, Encoder: "libx265", Available: true}}
+	if check := checkEncoders(software); check.Status != StatusWarn {
+		t.Errorf("expected warn for software only, got %+v", check)
+	}
+	hardware := append(software, &ffmpeg.HWEncoder{Accel: ffmpeg.HWAccelVAAPI, Encoder: "hevc_vaapi", Available: true})
+	if check := checkEncoders(hardware); check.Status != StatusOK {
+		t.Errorf("expected ok with hardware, got %+v", check)
+	}
+	if check := checkEncoders(nil); check.Status != StatusFail {
+		t.Errorf("expected fail with no encoders, got %+v", check)
+	}
+}
+
+func TestCheckAuth(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.AuthConfig
+		want Status
+	}{
+		{"disabled", config.AuthConfig{}, StatusOK},
+		{"noop", config.AuthConfig{Enabled: true, Provider: "noop"}, StatusWarn},
+		{"unknown", config.AuthConfig{Enabled: true, Provider: "ldap", Secret: "s"}, StatusFail},
+		{"password without users", config.AuthConfig{Enabled: true, Provider: "password", Secret: "s"}, StatusFail},
+		{"password", config.AuthConfig{Enabled: true, Provider: "password", Secret: "s",
+			Password: config.PasswordAuthConfig{Users: map[string]string{"admin": "$2b$..."}}}, StatusOK},
+		{"oidc missing secret", config.AuthConfig{Enabled: true, Provider: "oidc",
+			OIDC: config.OIDCAuthConfig{Issuer: "i", ClientID: "c", ClientSecret: "s", RedirectURL: "r"}}, StatusFail},
+		{"header without proxies", config.AuthConfig{Enabled: true, Provider: "header"}, StatusFail},
+		{"header", config.AuthConfig{Enabled: true, Provider: "header",
+			Header: config.HeaderAuthConfig{TrustedProxies: []string{"172.16.0.0/12"}}}, StatusOK},
+	}
+	for _, tt := range tests {
+		if got := checkAuth(tt.cfg); got.Status != tt.want {
+			t.Errorf("%s: got %s (%s), want %s", tt.name, got.Status, got.Message, tt.want)
+		}
+	}
+}
+
+func TestReady(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.MediaPath = t.TempDir()
+	cfg.QueueFile = filepath.Join(t.TempDir(), "queue.json")
+	cfg.FFmpegPath = "/nonexistent/ffmpeg"
+	cfg.Auth.Enabled = true // Misconfigured auth doesn't make the server unready
+
+	report := Ready(context.Background(), cfg)
+	if report.Status != StatusFail {
+		t.Errorf("expected fail with a missing ffmpeg, got %s", report.Status)
+	}
+	statuses := make(map[string]Status)
+	for _, c := range report.Checks {
+		statuses[c.Name] = c.Status
+	}
+	if _, ok := statuses["auth"]; ok {
+		t.Error("expected no auth check in the readiness report")
+	}
+	if statuses["ffmpeg"] != StatusFail || statuses["media_path"] != StatusOK || statuses["queue_file"] != StatusOK {
+		t.Errorf("unexpected statuses %v", statuses)
+	}
+	if _, ok := statuses["encoders"]; !ok {
+		t.Error("expected an encoders check")
+	}
+}
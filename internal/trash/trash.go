@@ -0,0 +1,254 @@
+// Package trash keeps the originals replaced by original_handling: replace
+// in a .shrinkray-trash folder under the media root, listed in a manifest
+// there, so a transcode can be undone until the trash is purged.
+package trash
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gwlsn/shrinkray/internal/ffmpeg"
+	"github.com/gwlsn/shrinkray/internal/logger"
+)
+
+var trashLog = logger.For("trash")
+
+// DirName is the trash folder under the media root. Hidden, so browsing
+// and scans skip it.
+const DirName = ".shrinkray-trash"
+
+// manifestName is the manifest file in the trash folder
+const manifestName = "manifest.json"
+
+// purgeTick is how often the scheduler looks for expired originals
+const purgeTick = time.Hour
+
+// ErrNotFound is returned for jobs without a trashed original
+var ErrNotFound = errors.New("no trashed original for this job")
+
+// Entry is an original moved to the trash when its transcode replaced it
+type Entry struct {
+	JobID        string    `json:"job_id"`
+	OriginalPath string    `json:"original_path"` // Where the original was, and is restored to
+	TrashPath    string    `json:"trash_path"`
+	OutputPath   string    `json:"output_path"` // The transcode that replaced it
+	Size         int64     `json:"size"`
+	TrashedAt    time.Time `json:"trashed_at"`
+}
+
+// Store tracks the originals in one media root's trash
+type Store struct {
+	mu      sync.Mutex
+	dir     string
+	entries map[string]*Entry // By job ID
+}
+
+// NewStore loads the trash under mediaRoot, or starts empty if there is none
+func NewStore(mediaRoot string) (*Store, error) {
+	s := &Store{
+		dir:     filepath.Join(mediaRoot, DirName),
+		entries: make(map[string]*Entry),
+	}
+
+	data, err := os.ReadFile(filepath.Join(s.dir, manifestName))
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		s.entries[e.JobID] = e
+	}
+	return s, nil
+}
+
+// PathFor returns where the original at inputPath is moved for jobID. Each
+// job gets its own folder so originals with the same name don't collide.
+func (s *Store) PathFor(jobID, inputPath string) string {
+	return filepath.Join(s.dir, jobID, filepath.Base(inputPath))
+}
+
+// Add records an original moved to trashPath once its replacement is in place
+func (s *Store) Add(jobID, originalPath, trashPath, outputPath string) {
+	info, err := os.Stat(trashPath)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[jobID] = &Entry{
+		JobID:        jobID,
+		OriginalPath: originalPath,
+		TrashPath:    trashPath,
+		OutputPath:   outputPath,
+		Size:         info.Size(),
+		TrashedAt:    time.Now(),
+	}
+	s.save()
+}
+
+// List returns the trashed originals, oldest first, dropping any that were
+// removed outside shrinkray
+func (s *Store) List() []*Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.prune()
+	result := make([]*Entry, 0, len(s.entries))
+	for _, e := range s.entries {
+		copied := *e
+		result = append(result, &copied)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].TrashedAt.Before(result[j].TrashedAt)
+	})
+	return result
+}
+
+// Restore undoes jobID's transcode: the original is moved back and the
+// transcoded output, if it had a different name, is removed.
+func (s *Store) Restore(jobID string) (*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[jobID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if _, err := os.Stat(e.TrashPath); os.IsNotExist(err) {
+		delete(s.entries, jobID)
+		s.save()
+		return nil, ErrNotFound
+	}
+	if e.OriginalPath != e.OutputPath {
+		if _, err := os.Stat(e.OriginalPath); err == nil {
+			return nil, fmt.Errorf("%s already exists", e.OriginalPath)
+		}
+	}
+
+	// Renaming over a same-named output replaces it in one step (a trash on
+	// another mount is copied back instead)
+	if err := ffmpeg.MoveFile(e.TrashPath, e.OriginalPath); err != nil {
+		return nil, fmt.Errorf("failed to restore original: %w", err)
+	}
+	if e.OriginalPath != e.OutputPath {
+		if err := os.Remove(e.OutputPath); err != nil && !os.IsNotExist(err) {
+			trashLog.Warn("Restored original but could not remove the output", "path", e.OriginalPath, "output", e.OutputPath, "error", err)
+		}
+	}
+	os.Remove(filepath.Dir(e.TrashPath))
+
+	delete(s.entries, jobID)
+	s.save()
+	trashLog.Info("Restored original", "path", e.OriginalPath)
+	copied := *e
+	return &copied, nil
+}
+
+// Purge deletes originals trashed longer than maxAge ago. Returns the bytes freed.
+func (s *Store) Purge(maxAge time.Duration) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.prune()
+	var freed int64
+	deleted := false
+	for id, e := range s.entries {
+		if time.Since(e.TrashedAt) < maxAge {
+			continue
+		}
+		if err := os.Remove(e.TrashPath); err != nil && !os.IsNotExist(err) {
+			trashLog.Warn("Failed to delete trashed original", "path", e.TrashPath, "error", err)
+			continue
+		}
+		os.Remove(filepath.Dir(e.TrashPath))
+		trashLog.Info("Purged original", "path", e.OriginalPath)
+		freed += e.Size
+		delete(s.entries, id)
+		deleted = true
+	}
+	if deleted {
+		s.save()
+	}
+	return freed
+}
+
+// StartScheduler runs Purge every hour. maxAge is re-read each time so
+// config changes apply without a restart; 0 keeps originals until restored.
+func (s *Store) StartScheduler(ctx context.Context, maxAge func() time.Duration) {
+	go func() {
+		ticker := time.NewTicker(purgeTick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if age := maxAge(); age > 0 {
+				s.Purge(age)
+			}
+		}
+	}()
+}
+
+// prune forgets originals whose file no longer exists. Must hold s.mu.
+func (s *Store) prune() {
+	changed := false
+	for id, e := range s.entries {
+		if _, err := os.Stat(e.TrashPath); os.IsNotExist(err) {
+			delete(s.entries, id)
+			changed = true
+		}
+	}
+	if changed {
+		s.save()
+	}
+}
+
+// save writes the manifest. Must hold s.mu.
+func (s *Store) save() {
+	entries := make([]*Entry, 0, len(s.entries))
+	for _, e := range s.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].TrashedAt.Before(entries[j].TrashedAt)
+	})
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		trashLog.Warn("Failed to encode manifest", "error", err)
+		return
+	}
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		trashLog.Warn("Failed to save manifest", "error", err)
+		return
+	}
+
+	// Write to temp file first, then rename (atomic)
+	path := filepath.Join(s.dir, manifestName)
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		trashLog.Warn("Failed to save manifest", "error", err)
+		return
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		trashLog.Warn("Failed to save manifest", "error", err)
+	}
+}
@@ -0,0 +1,135 @@
+package trash
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStoreRestoresOriginal(t *testing.T) {
+	root := t.TempDir()
+	store, err := NewStore(root)
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+
+	// movie.mp4 was transcoded to movie.mkv and its original trashed
+	original := filepath.Join(root, "Movies", "movie.mp4")
+	output := filepath.Join(root, "Movies", "movie.mkv")
+	trashPath := store.PathFor("job-1", original)
+	writeFile(t, trashPath, "original")
+	writeFile(t, output, "transcoded")
+	store.Add("job-1", original, trashPath, output)
+
+	// Reloading keeps the manifest
+	store, err = NewStore(root)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	entries := store.List()
+	if len(entries) != 1 || entries[0].OriginalPath != original || entries[0].Size != 8 {
+		t.Fatalf("List() = %+v, want movie.mp4 (8 bytes)", entries)
+	}
+
+	if _, err := store.Restore("job-1"); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if content, err := os.ReadFile(original); err != nil || string(content) != "original" {
+		t.Errorf("restored original = %q, %v", content, err)
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Error("transcoded output still exists after restore")
+	}
+	if _, err := os.Stat(filepath.Dir(trashPath)); !os.IsNotExist(err) {
+		t.Error("job's trash folder still exists after restore")
+	}
+	if _, err := store.Restore("job-1"); err != ErrNotFound {
+		t.Errorf("second Restore error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestStoreRestoreSameName(t *testing.T) {
+	root := t.TempDir()
+	store, err := NewStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// mkv → mkv: the output took the original's name
+	path := filepath.Join(root, "show.mkv")
+	trashPath := store.PathFor("job-2", path)
+	writeFile(t, trashPath, "original")
+	writeFile(t, path, "transcoded")
+	store.Add("job-2", path, trashPath, path)
+
+	if _, err := store.Restore("job-2"); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if content, _ := os.ReadFile(path); string(content) != "original" {
+		t.Errorf("file = %q, want the original back", content)
+	}
+}
+
+func TestStoreRestoreRefusesToOverwrite(t *testing.T) {
+	root := t.TempDir()
+	store, err := NewStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	original := filepath.Join(root, "movie.avi")
+	trashPath := store.PathFor("job-3", original)
+	writeFile(t, trashPath, "original")
+	writeFile(t, original, "something new")
+	store.Add("job-3", original, trashPath, filepath.Join(root, "movie.mkv"))
+
+	if _, err := store.Restore("job-3"); err == nil {
+		t.Fatal("expected Restore to refuse overwriting an existing file")
+	}
+	if _, err := os.Stat(trashPath); err != nil {
+		t.Error("trashed original should stay in the trash")
+	}
+}
+
+func TestStorePurge(t *testing.T) {
+	root := t.TempDir()
+	store, err := NewStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldPath := store.PathFor("old", filepath.Join(root, "old.mkv"))
+	newPath := store.PathFor("new", filepath.Join(root, "new.mkv"))
+	writeFile(t, oldPath, "0123456789")
+	writeFile(t, newPath, "0123456789")
+	store.Add("old", filepath.Join(root, "old.mkv"), oldPath, filepath.Join(root, "old.mkv"))
+	store.Add("new", filepath.Join(root, "new.mkv"), newPath, filepath.Join(root, "new.mkv"))
+	store.entries["old"].TrashedAt = time.Now().Add(-10 * 24 * time.Hour)
+
+	if freed := store.Purge(7 * 24 * time.Hour); freed != 10 {
+		t.Errorf("Purge(7d) freed %d bytes, want 10", freed)
+	}
+	if _, err := os.Stat(oldPath); !os.IsNotExist(err) {
+		t.Error("expired original still in the trash")
+	}
+	if entries := store.List(); len(entries) != 1 || entries[0].JobID != "new" {
+		t.Errorf("List() = %+v, want only the new original", entries)
+	}
+
+	// Originals deleted by hand drop out of the list
+	os.Remove(newPath)
+	if entries := store.List(); len(entries) != 0 {
+		t.Errorf("List() = %+v, want empty", entries)
+	}
+}